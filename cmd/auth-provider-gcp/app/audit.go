@@ -0,0 +1,122 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/journal"
+	"k8s.io/cloud-provider-gcp/pkg/credentialconfig"
+)
+
+// journaldAuditLog is the value of --auditLog that sends audit records to journald
+// instead of a file.
+const journaldAuditLog = "journald"
+
+// auditRecord describes a single credential issuance decision. Credentials
+// themselves are never recorded.
+type auditRecord struct {
+	Time           time.Time  `json:"time"`
+	Image          string     `json:"image"`
+	AuthFlow       string     `json:"authFlow"`
+	Registries     []string   `json:"registries"`
+	ServiceAccount string     `json:"serviceAccount,omitempty"`
+	Expiry         *time.Time `json:"expiry,omitempty"`
+	// CallerPID is the PID of the process that executed the plugin, normally the kubelet.
+	CallerPID int `json:"callerPID"`
+	// CredentialConflicts lists the registries several merged auth flows
+	// provided different credentials for.
+	CredentialConflicts []credentialconfig.CredentialConflict `json:"credentialConflicts,omitempty"`
+}
+
+// auditingDockerConfigProvider implements DockerConfigProvider by composing
+// with another DockerConfigProvider and recording the credentials it provides.
+type auditingDockerConfigProvider struct {
+	provider credentialconfig.DockerConfigProvider
+	record   auditRecord
+}
+
+// Enabled implements DockerConfigProvider.
+func (a *auditingDockerConfigProvider) Enabled(ctx context.Context) bool {
+	return a.provider.Enabled(ctx)
+}
+
+// Provide implements DockerConfigProvider.
+func (a *auditingDockerConfigProvider) Provide(ctx context.Context, image string) credentialconfig.DockerConfig {
+	cfg := a.provider.Provide(ctx, image)
+	a.record.Registries = []string{}
+	for registry, entry := range cfg {
+		a.record.Registries = append(a.record.Registries, registry)
+		if entry.Email != "" {
+			a.record.ServiceAccount = entry.Email
+		}
+		if !entry.Expiry.IsZero() {
+			expiry := entry.Expiry
+			a.record.Expiry = &expiry
+		}
+	}
+	sort.Strings(a.record.Registries)
+	return cfg
+}
+
+// writeAuditRecord appends the record to the audit log at dest, which is either
+// a file path or journaldAuditLog.
+func writeAuditRecord(dest string, record auditRecord) error {
+	if dest == journaldAuditLog {
+		vars := map[string]string{
+			"IMAGE":      record.Image,
+			"AUTH_FLOW":  record.AuthFlow,
+			"CALLER_PID": strconv.Itoa(record.CallerPID),
+		}
+		if record.ServiceAccount != "" {
+			vars["SERVICE_ACCOUNT"] = record.ServiceAccount
+		}
+		if record.Expiry != nil {
+			vars["TOKEN_EXPIRY"] = record.Expiry.Format(time.RFC3339)
+		}
+		if len(record.CredentialConflicts) > 0 {
+			registries := make([]string, 0, len(record.CredentialConflicts))
+			for _, c := range record.CredentialConflicts {
+				registries = append(registries, c.Registry)
+			}
+			vars["CREDENTIAL_CONFLICTS"] = strings.Join(registries, ",")
+		}
+		msg := fmt.Sprintf("credential request for image %q (authFlow %s, registries %v)", record.Image, record.AuthFlow, record.Registries)
+		return journal.Send(msg, journal.PriInfo, vars)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
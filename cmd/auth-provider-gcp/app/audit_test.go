@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/cloud-provider-gcp/pkg/credentialconfig"
+)
+
+type fakeProvider struct {
+	cfg credentialconfig.DockerConfig
+}
+
+func (f *fakeProvider) Enabled(ctx context.Context) bool {
+	return true
+}
+
+func (f *fakeProvider) Provide(ctx context.Context, image string) credentialconfig.DockerConfig {
+	return f.cfg
+}
+
+func TestAuditingProvider(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+	entry := credentialconfig.DockerConfigEntry{Username: "_token", Password: "secret", Email: "sa@project.iam.gserviceaccount.com", Expiry: expiry}
+	auditor := &auditingDockerConfigProvider{provider: &fakeProvider{cfg: credentialconfig.DockerConfig{"gcr.io": entry, "*.pkg.dev": entry}}}
+	auditor.Provide(context.Background(), "gcr.io/project/image")
+
+	if expected := []string{"*.pkg.dev", "gcr.io"}; !reflect.DeepEqual(auditor.record.Registries, expected) {
+		t.Errorf("got registries %v, expected %v", auditor.record.Registries, expected)
+	}
+	if auditor.record.ServiceAccount != entry.Email {
+		t.Errorf("got service account %q, expected %q", auditor.record.ServiceAccount, entry.Email)
+	}
+	if auditor.record.Expiry == nil || !auditor.record.Expiry.Equal(expiry) {
+		t.Errorf("got expiry %v, expected %v", auditor.record.Expiry, expiry)
+	}
+}
+
+func TestWriteAuditRecordConflicts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	conflicts := []credentialconfig.CredentialConflict{{Registry: "gcr.io", Sources: []string{dockerConfigAuthFlow, gcrAuthFlow}, Selected: dockerConfigAuthFlow}}
+	record := auditRecord{Time: time.Now(), Image: "gcr.io/project/a", AuthFlow: dockerConfigAuthFlow + "," + gcrAuthFlow, Registries: []string{"gcr.io"}, CredentialConflicts: conflicts}
+	if err := writeAuditRecord(path, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	line, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got auditRecord
+	if err := json.Unmarshal(line, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.CredentialConflicts, conflicts) {
+		t.Errorf("got audited conflicts %+v, expected %+v", got.CredentialConflicts, conflicts)
+	}
+}
+
+func TestWriteAuditRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, image := range []string{"gcr.io/project/a", "gcr.io/project/b"} {
+		record := auditRecord{Time: time.Now(), Image: image, AuthFlow: gcrAuthFlow, Registries: []string{"gcr.io"}, CallerPID: 1}
+		if err := writeAuditRecord(path, record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	var images []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "secret") {
+			t.Errorf("audit record %q contains credentials", scanner.Text())
+		}
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		images = append(images, record.Image)
+	}
+	if expected := []string{"gcr.io/project/a", "gcr.io/project/b"}; !reflect.DeepEqual(images, expected) {
+		t.Errorf("got audited images %v, expected %v", images, expected)
+	}
+}
@@ -17,11 +17,14 @@ limitations under the License.
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -36,11 +39,39 @@ const (
 	gcrAuthFlow             = "gcr"
 	dockerConfigAuthFlow    = "dockercfg"
 	dockerConfigURLAuthFlow = "dockercfg-url"
+	defaultProviderName     = "auth-provider-gcp"
 )
 
 // CredentialOptions contains a representation of the options passed to the credential provider.
 type CredentialOptions struct {
 	AuthFlow string
+	// CredentialProviderConfig is the path to the kubelet's credential provider config.
+	// If set, credentials are only returned for images matching the matchImages
+	// configured for ProviderName.
+	CredentialProviderConfig string
+	// ProviderName is the name of this plugin in the kubelet's credential provider config.
+	ProviderName string
+	// AuditLog is the file to append an audit record of each request to, or
+	// "journald" to send them to the systemd journal. Auditing is disabled if empty.
+	AuditLog string
+	// FlowPolicy is the path to a policy selecting the auth flow and instance
+	// service account per workload, for kubelets passing the service account
+	// of the workload with the requests. AuthFlow applies if empty.
+	FlowPolicy string
+}
+
+// credentialRequest is a CredentialProviderRequest with the service account
+// fields sent by the kubelets configured to pass the service account of the
+// workload to the plugin, which are not part of the vendored API version.
+type credentialRequest struct {
+	credentialproviderapi.CredentialProviderRequest `json:",inline"`
+
+	// ServiceAccountToken is a token of the Kubernetes service account of the
+	// workload the image is pulled for.
+	ServiceAccountToken string `json:"serviceAccountToken,omitempty"`
+	// ServiceAccountAnnotations are the annotations of the Kubernetes service
+	// account of the workload the image is pulled for.
+	ServiceAccountAnnotations map[string]string `json:"serviceAccountAnnotations,omitempty"`
 }
 
 // AuthFlowFlagError represents an error that occurred during flag validation.
@@ -82,7 +113,7 @@ func NewGetCredentialsCommand() (*cobra.Command, error) {
 		Use:   "get-credentials",
 		Short: "Get authentication credentials",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return getCredentials(options.AuthFlow)
+			return getCredentials(cmd.Context(), &options)
 		},
 	}
 	defineFlags(cmd, &options)
@@ -92,11 +123,30 @@ func NewGetCredentialsCommand() (*cobra.Command, error) {
 	return cmd, nil
 }
 
-func providerFromFlow(flow string) (credentialconfig.DockerConfigProvider, error) {
+// providerFromFlow returns the provider of the given auth flow. A comma
+// separated list of flows merges the credentials of all of them, earlier flows
+// taking precedence over later ones.
+func providerFromFlow(flow, serviceAccount string) (credentialconfig.DockerConfigProvider, error) {
+	flows := strings.Split(flow, ",")
+	if len(flows) == 1 {
+		return singleProviderFromFlow(flow, serviceAccount)
+	}
+	merger := &credentialconfig.MergingDockerConfigProvider{}
+	for _, f := range flows {
+		p, err := singleProviderFromFlow(f, serviceAccount)
+		if err != nil {
+			return nil, err
+		}
+		merger.Providers = append(merger.Providers, credentialconfig.NamedDockerConfigProvider{Name: f, Provider: p})
+	}
+	return merger, nil
+}
+
+func singleProviderFromFlow(flow, serviceAccount string) (credentialconfig.DockerConfigProvider, error) {
 	transport := utilnet.SetTransportDefaults(&http.Transport{})
 	switch flow {
 	case gcrAuthFlow:
-		return provider.MakeRegistryProvider(transport), nil
+		return provider.MakeServiceAccountRegistryProvider(transport, serviceAccount), nil
 	case dockerConfigAuthFlow:
 		return provider.MakeDockerConfigProvider(transport), nil
 	case dockerConfigURLAuthFlow:
@@ -106,25 +156,81 @@ func providerFromFlow(flow string) (credentialconfig.DockerConfigProvider, error
 	}
 }
 
-func getCredentials(authFlow string) error {
-	klog.V(2).Infof("get-credentials (authFlow %s)", authFlow)
-	authProvider, err := providerFromFlow(authFlow)
+// selectFlow returns the auth flow and instance service account to answer the
+// request with, according to the flow policy if any.
+func selectFlow(options *CredentialOptions, request *credentialRequest) (string, string, error) {
+	if options.FlowPolicy == "" {
+		return options.AuthFlow, "", nil
+	}
+	policy, err := provider.ReadFlowPolicy(options.FlowPolicy)
 	if err != nil {
-		return err
+		return "", "", err
+	}
+	workload, err := provider.WorkloadIdentityFromRequest(request.ServiceAccountToken, request.ServiceAccountAnnotations)
+	if err != nil {
+		return "", "", err
+	}
+	rule := policy.Match(workload)
+	if rule == nil {
+		return options.AuthFlow, "", nil
 	}
+	klog.V(2).Infof("flow policy rule %+v matches service account %s/%s", *rule, workload.Namespace, workload.ServiceAccount)
+	flow := rule.AuthFlow
+	if flow == "" {
+		flow = options.AuthFlow
+	}
+	return flow, rule.GCEServiceAccount, nil
+}
+
+func getCredentials(ctx context.Context, options *CredentialOptions) error {
 	unparsedRequest, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 		return err
 	}
-	var authRequest credentialproviderapi.CredentialProviderRequest
+	var authRequest credentialRequest
 	err = json.Unmarshal(unparsedRequest, &authRequest)
 	if err != nil {
 		return fmt.Errorf("error unmarshaling auth credential request: %w", err)
 	}
-	authCredentials, err := provider.GetResponse(authRequest.Image, authProvider)
+	authFlow, serviceAccount, err := selectFlow(options, &authRequest)
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("get-credentials (authFlow %s)", authFlow)
+	authProvider, err := providerFromFlow(authFlow, serviceAccount)
+	if err != nil {
+		return err
+	}
+	merger, _ := authProvider.(*credentialconfig.MergingDockerConfigProvider)
+	if options.CredentialProviderConfig != "" {
+		matchImages, err := provider.ReadMatchImages(options.CredentialProviderConfig, options.ProviderName)
+		if err != nil {
+			return err
+		}
+		authProvider = &provider.ScopedDockerConfigProvider{Provider: authProvider, MatchImages: matchImages}
+	}
+	var auditor *auditingDockerConfigProvider
+	if options.AuditLog != "" {
+		auditor = &auditingDockerConfigProvider{provider: authProvider}
+		authProvider = auditor
+	}
+	authCredentials, err := provider.GetResponse(ctx, authRequest.Image, authProvider)
 	if err != nil {
 		return fmt.Errorf("error getting authentication response from provider: %w", err)
 	}
+	if auditor != nil {
+		auditor.record.Time = time.Now()
+		auditor.record.Image = authRequest.Image
+		auditor.record.AuthFlow = authFlow
+		auditor.record.CallerPID = os.Getppid()
+		if merger != nil {
+			auditor.record.CredentialConflicts = merger.Conflicts()
+		}
+		// Failing to audit must not fail the image pull.
+		if err := writeAuditRecord(options.AuditLog, auditor.record); err != nil {
+			klog.Errorf("error writing audit record to %q: %v", options.AuditLog, err)
+		}
+	}
 	jsonResponse, err := json.Marshal(authCredentials)
 	if err != nil {
 		// The error from json.Marshal is intentionally not included so as to not leak credentials into the logs
@@ -136,12 +242,18 @@ func getCredentials(authFlow string) error {
 }
 
 func defineFlags(credCmd *cobra.Command, options *CredentialOptions) {
-	credCmd.Flags().StringVarP(&options.AuthFlow, "authFlow", "a", gcrAuthFlow, fmt.Sprintf("authentication flow (valid values are %q, %q, and %q)", gcrAuthFlow, dockerConfigAuthFlow, dockerConfigURLAuthFlow))
+	credCmd.Flags().StringVarP(&options.AuthFlow, "authFlow", "a", gcrAuthFlow, fmt.Sprintf("authentication flow (valid values are %q, %q, and %q), or a comma separated list of them to merge their credentials, earlier flows taking precedence", gcrAuthFlow, dockerConfigAuthFlow, dockerConfigURLAuthFlow))
+	credCmd.Flags().StringVar(&options.CredentialProviderConfig, "credentialProviderConfig", "", "path to the kubelet credential provider config; if set, credentials are only returned for images matching the provider's matchImages")
+	credCmd.Flags().StringVar(&options.ProviderName, "providerName", defaultProviderName, "name of this plugin in the kubelet credential provider config")
+	credCmd.Flags().StringVar(&options.FlowPolicy, "flowPolicy", "", "path to a policy selecting the auth flow and instance service account by Kubernetes service account, for kubelets passing the service account of the workload to the plugin")
+	credCmd.Flags().StringVar(&options.AuditLog, "auditLog", "", fmt.Sprintf("file to append an audit record of each credential request to, or %q to write them to the systemd journal", journaldAuditLog))
 }
 
 func validateFlags(options *CredentialOptions) error {
-	if options.AuthFlow != gcrAuthFlow && options.AuthFlow != dockerConfigAuthFlow && options.AuthFlow != dockerConfigURLAuthFlow {
-		return &AuthFlowFlagError{flagValue: options.AuthFlow}
+	for _, flow := range strings.Split(options.AuthFlow, ",") {
+		if flow != gcrAuthFlow && flow != dockerConfigAuthFlow && flow != dockerConfigURLAuthFlow {
+			return &AuthFlowFlagError{flagValue: options.AuthFlow}
+		}
 	}
 	return nil
 }
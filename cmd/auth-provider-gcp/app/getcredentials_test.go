@@ -17,10 +17,15 @@ limitations under the License.
 package app
 
 import (
+	"encoding/base64"
 	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+
+	"k8s.io/cloud-provider-gcp/pkg/credentialconfig"
 )
 
 func TestValidateAuthFlow(t *testing.T) {
@@ -36,6 +41,9 @@ func TestValidateAuthFlow(t *testing.T) {
 		{Name: "bad auth flow option", Flow: "bad-flow", Error: &AuthFlowFlagError{flagValue: "bad-flow"}},
 		{Name: "empty auth flow option", Flow: "", Error: &AuthFlowFlagError{flagValue: ""}},
 		{Name: "case-sensitive auth flow", Flow: "Gcrauthflow", Error: &AuthFlowFlagError{flagValue: "Gcrauthflow"}},
+		{Name: "validate auth flow list", Flow: dockerConfigAuthFlow + "," + gcrAuthFlow},
+		{Name: "bad flow in auth flow list", Flow: gcrAuthFlow + ",bad-flow", Error: &AuthFlowFlagError{flagValue: gcrAuthFlow + ",bad-flow"}},
+		{Name: "empty flow in auth flow list", Flow: gcrAuthFlow + ",", Error: &AuthFlowFlagError{flagValue: gcrAuthFlow + ","}},
 	}
 	for _, tc := range tests {
 		t.Run(tc.Name, func(t *testing.T) {
@@ -72,7 +80,7 @@ func TestProviderFromFlow(t *testing.T) {
 	}
 	for _, tc := range tests {
 		t.Run(tc.Name, func(t *testing.T) {
-			provider, err := providerFromFlow(tc.Flow)
+			provider, err := providerFromFlow(tc.Flow, "")
 			if tc.Error != nil {
 				if err == nil {
 					t.Fatalf("with flow %q did not get expected error %q", tc.Flow, err)
@@ -93,6 +101,28 @@ func TestProviderFromFlow(t *testing.T) {
 	}
 }
 
+func TestProviderFromFlowList(t *testing.T) {
+	p, err := providerFromFlow(dockerConfigAuthFlow+","+gcrAuthFlow, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+	merger, ok := p.(*credentialconfig.MergingDockerConfigProvider)
+	if !ok {
+		t.Fatalf("unexpected provider type %q", reflect.TypeOf(p))
+	}
+	var names []string
+	for _, named := range merger.Providers {
+		names = append(names, named.Name)
+	}
+	if expected := []string{dockerConfigAuthFlow, gcrAuthFlow}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("got merged flows %v, expected %v in precedence order", names, expected)
+	}
+
+	if _, err := providerFromFlow(gcrAuthFlow+",bad-flow", ""); !errors.Is(err, &AuthFlowTypeError{}) {
+		t.Errorf("did not get expected error for a bad flow in the list (got %q instead)", err)
+	}
+}
+
 func TestFlagError(t *testing.T) {
 	type FlagErrorTest struct {
 		Name            string
@@ -130,7 +160,7 @@ func TestFlowError(t *testing.T) {
 	}
 	for _, tc := range tests {
 		t.Run(tc.Name, func(t *testing.T) {
-			_, err := providerFromFlow(tc.Flow)
+			_, err := providerFromFlow(tc.Flow, "")
 			if !errors.Is(err, &tc.ExpectedError) {
 				t.Fatalf("did not get expected error %q (got %q instead", &tc.ExpectedError, err)
 			}
@@ -140,3 +170,44 @@ func TestFlowError(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectFlow(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "policy.yaml")
+	contents := `
+rules:
+  - namespace: team-a
+    gceServiceAccount: team-a@project.iam.gserviceaccount.com
+  - annotations:
+      example.com/flow: dockercfg
+    authFlow: dockercfg
+`
+	if err := os.WriteFile(policy, []byte(contents), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"kubernetes.io":{"namespace":"team-a","serviceaccount":{"name":"default"}}}`))
+	teamAToken := "header." + claims + ".signature"
+
+	tests := []struct {
+		Name           string
+		FlowPolicy     string
+		Request        credentialRequest
+		Flow           string
+		ServiceAccount string
+	}{
+		{Name: "no flow policy", Request: credentialRequest{ServiceAccountToken: teamAToken}, Flow: gcrAuthFlow},
+		{Name: "service account selected by namespace", FlowPolicy: policy, Request: credentialRequest{ServiceAccountToken: teamAToken}, Flow: gcrAuthFlow, ServiceAccount: "team-a@project.iam.gserviceaccount.com"},
+		{Name: "flow selected by annotation", FlowPolicy: policy, Request: credentialRequest{ServiceAccountAnnotations: map[string]string{"example.com/flow": "dockercfg"}}, Flow: dockerConfigAuthFlow},
+		{Name: "no matching rule", FlowPolicy: policy, Request: credentialRequest{}, Flow: gcrAuthFlow},
+	}
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			flow, serviceAccount, err := selectFlow(&CredentialOptions{AuthFlow: gcrAuthFlow, FlowPolicy: tc.FlowPolicy}, &tc.Request)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if flow != tc.Flow || serviceAccount != tc.ServiceAccount {
+				t.Errorf("got flow %q and service account %q, want %q and %q", flow, serviceAccount, tc.Flow, tc.ServiceAccount)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/cloud-provider-gcp/cmd/auth-provider-gcp/provider"
+	klog "k8s.io/klog/v2"
+)
+
+const defaultMinTokenLifetime = time.Minute
+
+// NewSelfTestCommand returns a cobra command that checks whether the plugin
+// can provide credentials. It is meant to be run as a node-problem-detector
+// custom plugin: it prints a JSON report and exits with 0 if healthy, 1 if a
+// problem was found and 2 if the health could not be determined.
+func NewSelfTestCommand() *cobra.Command {
+	var minTokenLifetime time.Duration
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "Check metadata server reachability, token freshness and cache health",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			transport := utilnet.SetTransportDefaults(&http.Transport{})
+			report := provider.RunSelfTest(cmd.Context(), transport, minTokenLifetime)
+			out, err := json.Marshal(report)
+			if err != nil {
+				return fmt.Errorf("error marshaling self-test report: %w", err)
+			}
+			fmt.Println(string(out))
+			if code := report.Status.ExitCode(); code != 0 {
+				klog.Flush()
+				os.Exit(code)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&minTokenLifetime, "minTokenLifetime", defaultMinTokenLifetime, "minimum remaining lifetime of the access token for the token freshness check to pass")
+	return cmd
+}
@@ -17,12 +17,15 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/cloud-provider-gcp/cmd/auth-provider-gcp/app"
 	klog "k8s.io/klog/v2"
 	"os"
+	"os/signal"
+	"syscall"
 
 	// bazel test on "k8s.io/cloud-provider-gcp/providers/gce/gcpcredential" run into issues
 	// because it has dependencies on "k8s.io/cloud-provider/credentialconfig" which is not required by "k8s.io/cloud-provider-gcp" hence
@@ -43,10 +46,15 @@ func main() {
 		os.Exit(1)
 	}
 	rootCmd.AddCommand(credCmd)
+	rootCmd.AddCommand(app.NewSelfTestCommand())
 	klog.InitFlags(nil)
 	flag.Parse()
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
-	if err := rootCmd.Execute(); err != nil {
+	// The kubelet terminates the plugin when its exec timeout expires; stop
+	// any in-flight metadata server requests when that happens.
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		klog.Errorf(err.Error())
 		os.Exit(1)
 	}
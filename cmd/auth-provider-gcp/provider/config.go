@@ -0,0 +1,133 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/cloud-provider-gcp/pkg/credentialconfig"
+	"sigs.k8s.io/yaml"
+)
+
+// credentialProviderConfig is the subset of the kubelet's CredentialProviderConfig
+// (kubelet.config.k8s.io) that is needed to scope the images this plugin answers for.
+type credentialProviderConfig struct {
+	Providers []credentialProvider `json:"providers"`
+}
+
+// credentialProvider is the subset of the kubelet's CredentialProvider.
+type credentialProvider struct {
+	Name        string   `json:"name"`
+	MatchImages []string `json:"matchImages"`
+}
+
+// ReadMatchImages reads the kubelet credential provider config at the given path
+// and returns the matchImages configured for the provider with the given name.
+func ReadMatchImages(path, name string) ([]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credential provider config %q: %w", path, err)
+	}
+	var config credentialProviderConfig
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("error parsing credential provider config %q: %w", path, err)
+	}
+	for _, p := range config.Providers {
+		if p.Name == name {
+			return p.MatchImages, nil
+		}
+	}
+	return nil, fmt.Errorf("provider %q not found in credential provider config %q", name, path)
+}
+
+// ScopedDockerConfigProvider implements DockerConfigProvider by composing with
+// another DockerConfigProvider and only providing credentials for images that
+// match one of MatchImages, using the kubelet's matchImages semantics.
+type ScopedDockerConfigProvider struct {
+	Provider    credentialconfig.DockerConfigProvider
+	MatchImages []string
+}
+
+// Enabled implements DockerConfigProvider.
+func (s *ScopedDockerConfigProvider) Enabled(ctx context.Context) bool {
+	return s.Provider.Enabled(ctx)
+}
+
+// Provide implements DockerConfigProvider.
+func (s *ScopedDockerConfigProvider) Provide(ctx context.Context, image string) credentialconfig.DockerConfig {
+	for _, matchImage := range s.MatchImages {
+		if matched, _ := matchImageURL(matchImage, image); matched {
+			return s.Provider.Provide(ctx, image)
+		}
+	}
+	return credentialconfig.DockerConfig{}
+}
+
+// matchImageURL returns true if image matches the matchImage pattern. The
+// pattern follows the kubelet's matchImages rules: the host may contain globs
+// per domain segment, the port must match exactly and the pattern path must
+// be a prefix of the image path.
+func matchImageURL(matchImage, image string) (bool, error) {
+	matchURL, err := parseSchemelessURL(matchImage)
+	if err != nil {
+		return false, err
+	}
+	imageURL, err := parseSchemelessURL(image)
+	if err != nil {
+		return false, err
+	}
+
+	matchHost, matchPort := splitHostPort(matchURL.Host)
+	imageHost, imagePort := splitHostPort(imageURL.Host)
+	if matchPort != imagePort {
+		return false, nil
+	}
+	matchParts := strings.Split(matchHost, ".")
+	imageParts := strings.Split(imageHost, ".")
+	if len(matchParts) != len(imageParts) {
+		return false, nil
+	}
+	for i, part := range matchParts {
+		if matched, err := filepath.Match(part, imageParts[i]); err != nil || !matched {
+			return false, err
+		}
+	}
+	return strings.HasPrefix(imageURL.Path, matchURL.Path), nil
+}
+
+func parseSchemelessURL(schemelessURL string) (*url.URL, error) {
+	parsed, err := url.Parse("https://" + schemelessURL)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Scheme = ""
+	return parsed, nil
+}
+
+func splitHostPort(hostport string) (string, string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport, ""
+	}
+	return host, port
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/cloud-provider-gcp/pkg/credentialconfig"
+)
+
+const testCredentialProviderConfig = `
+apiVersion: kubelet.config.k8s.io/v1
+kind: CredentialProviderConfig
+providers:
+  - name: auth-provider-gcp
+    apiVersion: credentialprovider.kubelet.k8s.io/v1
+    matchImages:
+      - "gcr.io"
+      - "*.gcr.io"
+      - "*.pkg.dev/my-project"
+    defaultCacheDuration: 1m
+  - name: other-provider
+    apiVersion: credentialprovider.kubelet.k8s.io/v1
+    matchImages:
+      - "registry.example.com"
+    defaultCacheDuration: 1m
+`
+
+type fakeProvider struct{}
+
+func (f *fakeProvider) Enabled(ctx context.Context) bool {
+	return true
+}
+
+func (f *fakeProvider) Provide(ctx context.Context, image string) credentialconfig.DockerConfig {
+	return credentialconfig.DockerConfig{"gcr.io": credentialconfig.DockerConfigEntry{Username: "_token"}}
+}
+
+func TestReadMatchImages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testCredentialProviderConfig), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matchImages, err := ReadMatchImages(path, "auth-provider-gcp")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"gcr.io", "*.gcr.io", "*.pkg.dev/my-project"}
+	if !reflect.DeepEqual(matchImages, expected) {
+		t.Errorf("got matchImages %v, expected %v", matchImages, expected)
+	}
+	if _, err := ReadMatchImages(path, "missing-provider"); err == nil {
+		t.Errorf("expected error for provider missing from config")
+	}
+	if _, err := ReadMatchImages(filepath.Join(t.TempDir(), "missing.yaml"), "auth-provider-gcp"); err == nil {
+		t.Errorf("expected error for missing config file")
+	}
+}
+
+func TestScopedDockerConfigProvider(t *testing.T) {
+	scoped := &ScopedDockerConfigProvider{
+		Provider:    &fakeProvider{},
+		MatchImages: []string{"gcr.io", "*.gcr.io", "*.pkg.dev/my-project", "localhost:5000"},
+	}
+	tests := []struct {
+		image   string
+		matches bool
+	}{
+		{image: "gcr.io/project/image:tag", matches: true},
+		{image: "us.gcr.io/project/image", matches: true},
+		{image: "us-docker.pkg.dev/my-project/repo/image", matches: true},
+		{image: "us-docker.pkg.dev/other-project/repo/image", matches: false},
+		{image: "a.b.gcr.io/project/image", matches: false},
+		{image: "registry.k8s.io/pause", matches: false},
+		{image: "localhost:5000/image", matches: true},
+		{image: "localhost:5001/image", matches: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.image, func(t *testing.T) {
+			cfg := scoped.Provide(context.Background(), tc.image)
+			if matches := len(cfg) > 0; matches != tc.matches {
+				t.Errorf("image %q got match %t, expected %t", tc.image, matches, tc.matches)
+			}
+		})
+	}
+}
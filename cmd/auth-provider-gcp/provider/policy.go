@@ -0,0 +1,135 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FlowPolicy selects the auth flow and the instance service account used to
+// answer a credential request depending on the workload the image is pulled
+// for. The rules are evaluated in order and the first matching rule applies.
+type FlowPolicy struct {
+	Rules []FlowRule `json:"rules"`
+}
+
+// FlowRule selects the auth flow and the instance service account of the
+// workloads it matches. Empty fields match any workload.
+type FlowRule struct {
+	// Namespace is the namespace of the Kubernetes service account of the
+	// workload.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceAccount is the name of the Kubernetes service account of the
+	// workload.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Annotations must all be set to the given values on the Kubernetes
+	// service account of the workload.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// AuthFlow is the auth flow to use, the one set on the command line if
+	// empty.
+	AuthFlow string `json:"authFlow,omitempty"`
+	// GCEServiceAccount is the email or alias of the instance service account
+	// whose access token the gcr auth flow provides, "default" if empty.
+	GCEServiceAccount string `json:"gceServiceAccount,omitempty"`
+}
+
+// ReadFlowPolicy reads the flow policy at the given path.
+func ReadFlowPolicy(path string) (*FlowPolicy, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading flow policy %q: %w", path, err)
+	}
+	var policy FlowPolicy
+	if err := yaml.UnmarshalStrict(contents, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing flow policy %q: %w", path, err)
+	}
+	return &policy, nil
+}
+
+// Match returns the first rule matching the workload, or nil if none does.
+func (p *FlowPolicy) Match(workload *WorkloadIdentity) *FlowRule {
+	for i := range p.Rules {
+		if p.Rules[i].matches(workload) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+func (r *FlowRule) matches(workload *WorkloadIdentity) bool {
+	if r.Namespace != "" && r.Namespace != workload.Namespace {
+		return false
+	}
+	if r.ServiceAccount != "" && r.ServiceAccount != workload.ServiceAccount {
+		return false
+	}
+	for key, value := range r.Annotations {
+		if workload.Annotations[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// WorkloadIdentity is the Kubernetes service account an image is pulled for,
+// as passed by kubelets that send service account tokens to credential
+// providers.
+type WorkloadIdentity struct {
+	Namespace      string
+	ServiceAccount string
+	Annotations    map[string]string
+}
+
+// WorkloadIdentityFromRequest returns the workload identity of a credential
+// request carrying the given service account token and annotations. The token
+// was issued by the API server to the kubelet, so its claims are read without
+// verifying its signature.
+func WorkloadIdentityFromRequest(serviceAccountToken string, annotations map[string]string) (*WorkloadIdentity, error) {
+	workload := &WorkloadIdentity{Annotations: annotations}
+	if serviceAccountToken == "" {
+		return workload, nil
+	}
+	parts := strings.Split(serviceAccountToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed service account token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed service account token payload: %w", err)
+	}
+	var claims struct {
+		Kubernetes struct {
+			Namespace      string `json:"namespace"`
+			ServiceAccount struct {
+				Name string `json:"name"`
+			} `json:"serviceaccount"`
+		} `json:"kubernetes.io"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed service account token claims: %w", err)
+	}
+	workload.Namespace = claims.Kubernetes.Namespace
+	workload.ServiceAccount = claims.Kubernetes.ServiceAccount.Name
+	return workload, nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testFlowPolicy = `
+rules:
+  - namespace: team-a
+    serviceAccount: puller
+    gceServiceAccount: team-a-puller@project.iam.gserviceaccount.com
+  - namespace: team-a
+    authFlow: dockercfg
+  - annotations:
+      registry.example.com/isolated: "true"
+    authFlow: dockercfg-url
+`
+
+// makeServiceAccountToken returns an unsigned token with the claims of a
+// Kubernetes service account token.
+func makeServiceAccountToken(namespace, name string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"kubernetes.io":{"namespace":"` + namespace + `","serviceaccount":{"name":"` + name + `"}}}`))
+	return header + "." + claims + ".signature"
+}
+
+func TestFlowPolicyMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(testFlowPolicy), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policy, err := ReadFlowPolicy(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testCases := []struct {
+		desc        string
+		token       string
+		annotations map[string]string
+		want        *FlowRule
+	}{
+		{
+			desc:  "namespace and service account",
+			token: makeServiceAccountToken("team-a", "puller"),
+			want:  &policy.Rules[0],
+		},
+		{
+			desc:  "namespace",
+			token: makeServiceAccountToken("team-a", "default"),
+			want:  &policy.Rules[1],
+		},
+		{
+			desc:        "annotations",
+			token:       makeServiceAccountToken("team-b", "default"),
+			annotations: map[string]string{"registry.example.com/isolated": "true"},
+			want:        &policy.Rules[2],
+		},
+		{
+			desc:        "annotations without token",
+			annotations: map[string]string{"registry.example.com/isolated": "true"},
+			want:        &policy.Rules[2],
+		},
+		{
+			desc:  "no match",
+			token: makeServiceAccountToken("team-b", "default"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			workload, err := WorkloadIdentityFromRequest(tc.token, tc.annotations)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := policy.Match(workload); got != tc.want {
+				t.Errorf("got rule %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWorkloadIdentityFromRequest(t *testing.T) {
+	workload, err := WorkloadIdentityFromRequest(makeServiceAccountToken("ns", "sa"), map[string]string{"a": "b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &WorkloadIdentity{Namespace: "ns", ServiceAccount: "sa", Annotations: map[string]string{"a": "b"}}
+	if !reflect.DeepEqual(workload, want) {
+		t.Errorf("got %+v, want %+v", workload, want)
+	}
+	for _, token := range []string{"not-a-token", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte("[]")) + ".c"} {
+		if _, err := WorkloadIdentityFromRequest(token, nil); err == nil {
+			t.Errorf("expected error for token %q", token)
+		}
+	}
+}
+
+func TestReadFlowPolicyInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n  - namespaces: team-a\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ReadFlowPolicy(path); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+	if _, err := ReadFlowPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("expected error for missing policy file")
+	}
+}
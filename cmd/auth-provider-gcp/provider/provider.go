@@ -17,6 +17,7 @@ limitations under the License.
 package provider
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -41,9 +42,17 @@ const (
 
 // MakeRegistryProvider returns a ContainerRegistryProvider with the given transport.
 func MakeRegistryProvider(transport *http.Transport) *gcpcredential.ContainerRegistryProvider {
+	return MakeServiceAccountRegistryProvider(transport, "")
+}
+
+// MakeServiceAccountRegistryProvider returns a ContainerRegistryProvider with
+// the given transport providing the access token of the given instance service
+// account, or of the default one if empty.
+func MakeServiceAccountRegistryProvider(transport *http.Transport, serviceAccount string) *gcpcredential.ContainerRegistryProvider {
 	httpClient := makeHTTPClient(transport)
 	provider := &gcpcredential.ContainerRegistryProvider{
 		MetadataProvider: gcpcredential.MetadataProvider{Client: httpClient},
+		ServiceAccount:   serviceAccount,
 	}
 	return provider
 }
@@ -108,8 +117,8 @@ func getCacheKeyType() (credentialproviderapi.PluginCacheKeyType, error) {
 }
 
 // GetResponse queries the given provider for credentials.
-func GetResponse(image string, provider credentialconfig.DockerConfigProvider) (*credentialproviderapi.CredentialProviderResponse, error) {
-	cfg := provider.Provide(image)
+func GetResponse(ctx context.Context, image string, provider credentialconfig.DockerConfigProvider) (*credentialproviderapi.CredentialProviderResponse, error) {
+	cfg := provider.Provide(ctx, image)
 	response := &credentialproviderapi.CredentialProviderResponse{Auth: make(map[string]credentialproviderapi.AuthConfig)}
 	for url, dockerConfig := range cfg {
 		response.Auth[url] = credentialproviderapi.AuthConfig{Username: dockerConfig.Username, Password: dockerConfig.Password}
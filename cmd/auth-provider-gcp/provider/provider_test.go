@@ -16,6 +16,7 @@ limitations under the License.
 package provider
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -24,6 +25,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/cloud-provider-gcp/pkg/gcpcredential"
@@ -81,7 +83,7 @@ func TestContainerRegistry(t *testing.T) {
 		},
 	})
 	provider := MakeRegistryProvider(transport)
-	response, err := GetResponse(dummyImage, provider)
+	response, err := GetResponse(context.Background(), dummyImage, provider)
 	if err != nil {
 		t.Fatalf("Unexpected error while getting response: %s", err.Error())
 	}
@@ -101,6 +103,75 @@ func TestContainerRegistry(t *testing.T) {
 	}
 }
 
+func TestContainerRegistryServiceAccount(t *testing.T) {
+	serviceAccount := "puller@project.iam.gserviceaccount.com"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := "/computeMetadata/v1/instance/service-accounts/" + serviceAccount + "/"
+		switch r.URL.Path {
+		case prefix + "email":
+			fmt.Fprint(w, serviceAccount)
+		case prefix + "token":
+			json.NewEncoder(w).Encode(&gcpcredential.TokenBlob{AccessToken: dummyToken})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	transport := utilnet.SetTransportDefaults(&http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL + req.URL.Path)
+		},
+	})
+	provider := MakeServiceAccountRegistryProvider(transport, serviceAccount)
+	response, err := GetResponse(context.Background(), dummyImage, provider)
+	if err != nil {
+		t.Fatalf("Unexpected error while getting response: %s", err.Error())
+	}
+	auth, ok := response.Auth["gcr.io"]
+	if !ok {
+		t.Fatalf("Expected credentials for gcr.io, got %v", response.Auth)
+	}
+	if auth.Password != dummyToken {
+		t.Errorf("Expected password %s not found (password: %s)", dummyToken, auth.Password)
+	}
+}
+
+func TestContainerRegistryCancelled(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang like an unresponsive metadata server.
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(unblock)
+	transport := utilnet.SetTransportDefaults(&http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL + req.URL.Path)
+		},
+	})
+	provider := MakeRegistryProvider(transport)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if provider.Enabled(ctx) {
+		t.Errorf("Expected provider to be disabled once the context is done")
+	}
+	response, err := GetResponse(ctx, dummyImage, provider)
+	if err != nil {
+		t.Fatalf("Unexpected error while getting response: %s", err.Error())
+	}
+	if len(response.Auth) != 0 {
+		t.Errorf("Expected no credentials once the context is done, got %v", response.Auth)
+	}
+	if elapsed := time.Since(start); elapsed > metadataHTTPClientTimeout {
+		t.Errorf("Expected requests to be cancelled with the context, took %v", elapsed)
+	}
+}
+
 func TestConfigProvider(t *testing.T) {
 	// Taken from from pkg/credentialprovider/gcp/metadata_test.go in kubernetes/kubernetes
 	registryURL := "hello.kubernetes.io"
@@ -137,7 +208,7 @@ func TestConfigProvider(t *testing.T) {
 		},
 	})
 	provider := MakeDockerConfigProvider(transport)
-	response, err := GetResponse(dummyImage, provider)
+	response, err := GetResponse(context.Background(), dummyImage, provider)
 	if err != nil {
 		t.Fatalf("Unexpected error while getting response: %s", err.Error())
 	}
@@ -194,7 +265,7 @@ func TestConfigURLProvider(t *testing.T) {
 	})
 
 	provider := MakeDockerConfigURLProvider(transport)
-	response, err := GetResponse(dummyImage, provider)
+	response, err := GetResponse(context.Background(), dummyImage, provider)
 	if err != nil {
 		t.Fatalf("Unexpected error while getting response: %s", err.Error())
 	}
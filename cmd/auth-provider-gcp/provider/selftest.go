@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/cloud-provider-gcp/pkg/gcpcredential"
+)
+
+// SelfTestStatus is the result of a self-test check. The values match the
+// results of node-problem-detector custom plugins.
+type SelfTestStatus string
+
+const (
+	// SelfTestOK means the check passed.
+	SelfTestOK SelfTestStatus = "OK"
+	// SelfTestNonOK means the check found a problem.
+	SelfTestNonOK SelfTestStatus = "NonOK"
+	// SelfTestUnknown means the check could not be run.
+	SelfTestUnknown SelfTestStatus = "Unknown"
+)
+
+// ExitCode returns the exit code a node-problem-detector custom plugin
+// reports the status with.
+func (s SelfTestStatus) ExitCode() int {
+	switch s {
+	case SelfTestOK:
+		return 0
+	case SelfTestNonOK:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// SelfTestCheck is the result of one self-test check.
+type SelfTestCheck struct {
+	Name    string         `json:"name"`
+	Status  SelfTestStatus `json:"status"`
+	Message string         `json:"message"`
+}
+
+// SelfTestReport is the result of the self-test. Status is NonOK if any check
+// is NonOK, and Unknown if any check is Unknown and none is NonOK.
+type SelfTestReport struct {
+	Status SelfTestStatus  `json:"status"`
+	Checks []SelfTestCheck `json:"checks"`
+}
+
+func (r *SelfTestReport) add(name string, status SelfTestStatus, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, SelfTestCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+	switch {
+	case status == SelfTestNonOK:
+		r.Status = SelfTestNonOK
+	case status == SelfTestUnknown && r.Status == SelfTestOK:
+		r.Status = SelfTestUnknown
+	}
+}
+
+// RunSelfTest checks that the metadata server is reachable, that it serves an
+// access token valid for at least minTokenLifetime, and that the credential
+// cache settings are valid and do not outlive the token.
+func RunSelfTest(ctx context.Context, transport *http.Transport, minTokenLifetime time.Duration) *SelfTestReport {
+	report := &SelfTestReport{Status: SelfTestOK}
+	metadata := gcpcredential.MetadataProvider{Client: makeHTTPClient(transport)}
+
+	metadataErr := metadata.CheckMetadataServer(ctx)
+	if metadataErr != nil {
+		report.add("metadata-server", SelfTestNonOK, "metadata server unreachable: %v", metadataErr)
+	} else {
+		report.add("metadata-server", SelfTestOK, "metadata server reachable")
+	}
+
+	var tokenLifetime time.Duration
+	var tokenErr error
+	if metadataErr != nil {
+		report.add("token-freshness", SelfTestUnknown, "skipped, metadata server unreachable")
+	} else {
+		tokenLifetime, tokenErr = metadata.TokenLifetime(ctx)
+		switch {
+		case tokenErr != nil:
+			report.add("token-freshness", SelfTestNonOK, "failed to get access token: %v", tokenErr)
+		case tokenLifetime < minTokenLifetime:
+			report.add("token-freshness", SelfTestNonOK, "access token expires in %v, less than %v", tokenLifetime, minTokenLifetime)
+		default:
+			report.add("token-freshness", SelfTestOK, "access token expires in %v", tokenLifetime)
+		}
+	}
+
+	cacheDuration, err := getCacheDuration()
+	if err != nil {
+		report.add("cache", SelfTestNonOK, "invalid %s: %v", cacheDurationKey, err)
+		return report
+	}
+	if _, err := getCacheKeyType(); err != nil {
+		report.add("cache", SelfTestNonOK, "invalid %s: %v", cacheTypeKey, err)
+		return report
+	}
+	switch {
+	case metadataErr != nil || tokenErr != nil:
+		report.add("cache", SelfTestUnknown, "cache duration %v, token lifetime unknown", cacheDuration)
+	case cacheDuration > tokenLifetime:
+		report.add("cache", SelfTestNonOK, "cache duration %v exceeds the access token lifetime %v, cached credentials may be expired", cacheDuration, tokenLifetime)
+	default:
+		report.add("cache", SelfTestOK, "cache duration %v", cacheDuration)
+	}
+	return report
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/cloud-provider-gcp/pkg/gcpcredential"
+)
+
+func TestRunSelfTest(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		metadataDown  bool
+		expiresIn     int64
+		cacheDuration string
+		wantStatus    SelfTestStatus
+		wantChecks    map[string]SelfTestStatus
+	}{
+		{
+			desc:       "healthy",
+			expiresIn:  3000,
+			wantStatus: SelfTestOK,
+			wantChecks: map[string]SelfTestStatus{"metadata-server": SelfTestOK, "token-freshness": SelfTestOK, "cache": SelfTestOK},
+		},
+		{
+			desc:       "token about to expire",
+			expiresIn:  10,
+			wantStatus: SelfTestNonOK,
+			wantChecks: map[string]SelfTestStatus{"metadata-server": SelfTestOK, "token-freshness": SelfTestNonOK, "cache": SelfTestOK},
+		},
+		{
+			desc:          "cache outlives token",
+			expiresIn:     3000,
+			cacheDuration: "2h",
+			wantStatus:    SelfTestNonOK,
+			wantChecks:    map[string]SelfTestStatus{"metadata-server": SelfTestOK, "token-freshness": SelfTestOK, "cache": SelfTestNonOK},
+		},
+		{
+			desc:          "invalid cache duration",
+			expiresIn:     3000,
+			cacheDuration: "forever",
+			wantStatus:    SelfTestNonOK,
+			wantChecks:    map[string]SelfTestStatus{"metadata-server": SelfTestOK, "token-freshness": SelfTestOK, "cache": SelfTestNonOK},
+		},
+		{
+			desc:         "metadata server down",
+			metadataDown: true,
+			wantStatus:   SelfTestNonOK,
+			wantChecks:   map[string]SelfTestStatus{"metadata-server": SelfTestNonOK, "token-freshness": SelfTestUnknown, "cache": SelfTestUnknown},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Setenv(cacheDurationKey, tc.cacheDuration)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.metadataDown {
+					http.Error(w, "", http.StatusServiceUnavailable)
+					return
+				}
+				switch r.URL.Path {
+				case "/computeMetadata/v1/":
+					w.WriteHeader(http.StatusOK)
+				case "/computeMetadata/v1/instance/service-accounts/default/token":
+					w.WriteHeader(http.StatusOK)
+					json.NewEncoder(w).Encode(&gcpcredential.TokenBlob{AccessToken: dummyToken, ExpiresIn: tc.expiresIn})
+				default:
+					http.Error(w, "", http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+			transport := utilnet.SetTransportDefaults(&http.Transport{
+				Proxy: func(req *http.Request) (*url.URL, error) {
+					return url.Parse(server.URL + req.URL.Path)
+				},
+			})
+
+			report := RunSelfTest(context.Background(), transport, time.Minute)
+			if report.Status != tc.wantStatus {
+				t.Errorf("Got status %q, want %q (report: %+v)", report.Status, tc.wantStatus, report)
+			}
+			gotChecks := map[string]SelfTestStatus{}
+			for _, check := range report.Checks {
+				gotChecks[check.Name] = check.Status
+			}
+			for name, want := range tc.wantChecks {
+				if gotChecks[name] != want {
+					t.Errorf("Got check %q status %q, want %q (report: %+v)", name, gotChecks[name], want, report)
+				}
+			}
+		})
+	}
+}
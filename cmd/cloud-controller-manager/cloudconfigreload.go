@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// cloudConfigReloader is implemented by cloud providers that can apply a
+// modified cloud config without restarting.
+type cloudConfigReloader interface {
+	ReloadConfig(config io.Reader) error
+}
+
+// cloudConfigWatcher polls the cloud config file and reloads the cloud
+// provider config when the file content changes.
+type cloudConfigWatcher struct {
+	path     string
+	reloader cloudConfigReloader
+	// lastHash is the hash of the last content passed to the reloader, so
+	// that a rejected config is not retried until the file changes again.
+	lastHash [sha256.Size]byte
+}
+
+// startCloudConfigReload reloads the cloud provider config from path every
+// period if its content changed. It is a no-op if the cloud provider does
+// not support reloading its config.
+func startCloudConfigReload(cloud cloudprovider.Interface, path string, period time.Duration, stopCh <-chan struct{}) {
+	reloader, ok := cloud.(cloudConfigReloader)
+	if !ok {
+		klog.Warningf("Cloud provider %q does not support reloading its config", cloud.ProviderName())
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		klog.Errorf("Failed to read cloud config %q, not watching it for changes: %v", path, err)
+		return
+	}
+	w := &cloudConfigWatcher{path: path, reloader: reloader, lastHash: sha256.Sum256(content)}
+	go wait.Until(w.sync, period, stopCh)
+}
+
+func (w *cloudConfigWatcher) sync() {
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		klog.Errorf("Failed to read cloud config %q: %v", w.path, err)
+		return
+	}
+	hash := sha256.Sum256(content)
+	if hash == w.lastHash {
+		return
+	}
+	w.lastHash = hash
+	if err := w.reloader.ReloadConfig(bytes.NewReader(content)); err != nil {
+		klog.Errorf("Failed to reload cloud config %q, keeping the current config: %v", w.path, err)
+		return
+	}
+	klog.Infof("Reloaded cloud config %q", w.path)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeReloader struct {
+	configs []string
+	err     error
+}
+
+func (f *fakeReloader) ReloadConfig(config io.Reader) error {
+	content, err := io.ReadAll(config)
+	if err != nil {
+		return err
+	}
+	f.configs = append(f.configs, string(content))
+	return f.err
+}
+
+func TestCloudConfigWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gce.conf")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	writeConfig("[Global]\nnode-tags = a\n")
+	reloader := &fakeReloader{}
+	w := &cloudConfigWatcher{path: path, reloader: reloader, lastHash: sha256.Sum256([]byte("[Global]\nnode-tags = a\n"))}
+
+	// Unchanged config is not reloaded.
+	w.sync()
+	if len(reloader.configs) != 0 {
+		t.Errorf("got %d reloads of an unchanged config, want 0", len(reloader.configs))
+	}
+
+	writeConfig("[Global]\nnode-tags = b\n")
+	w.sync()
+	w.sync()
+	if len(reloader.configs) != 1 || reloader.configs[0] != "[Global]\nnode-tags = b\n" {
+		t.Errorf("got reloads %q, want one reload of the changed config", reloader.configs)
+	}
+
+	// A rejected config is not retried until it changes again.
+	reloader.err = errors.New("rejected")
+	writeConfig("[Global]\nproject-id = other\n")
+	w.sync()
+	w.sync()
+	if len(reloader.configs) != 2 {
+		t.Errorf("got %d reloads, want 2", len(reloader.configs))
+	}
+}
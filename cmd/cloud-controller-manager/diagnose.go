@@ -0,0 +1,204 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/cloud-provider/names"
+	kcmnames "k8s.io/kubernetes/cmd/kube-controller-manager/names"
+)
+
+// controllerPermissions are the IAM permissions a controller needs on the
+// project of the cluster and on the project of its network, which differ on
+// Shared VPC, and a predefined role granting them.
+type controllerPermissions struct {
+	project        []string
+	networkProject []string
+	role           string
+}
+
+// requiredPermissions maps the controllers to the IAM permissions they need.
+var requiredPermissions = map[string]controllerPermissions{
+	names.CloudNodeController: {
+		project: []string{"compute.instances.get", "compute.instances.list", "compute.zones.get", "compute.zones.list"},
+		role:    "roles/compute.viewer",
+	},
+	names.CloudNodeLifecycleController: {
+		project: []string{"compute.instances.get", "compute.instances.list"},
+		role:    "roles/compute.viewer",
+	},
+	names.ServiceLBController: {
+		project: []string{
+			"compute.addresses.create", "compute.addresses.delete", "compute.addresses.get", "compute.addresses.list",
+			"compute.forwardingRules.create", "compute.forwardingRules.delete", "compute.forwardingRules.get", "compute.forwardingRules.list", "compute.forwardingRules.setTarget",
+			"compute.targetPools.create", "compute.targetPools.delete", "compute.targetPools.get", "compute.targetPools.addInstance", "compute.targetPools.removeInstance", "compute.targetPools.addHealthCheck", "compute.targetPools.removeHealthCheck",
+			"compute.httpHealthChecks.create", "compute.httpHealthChecks.delete", "compute.httpHealthChecks.get", "compute.httpHealthChecks.update", "compute.httpHealthChecks.useReadOnly",
+			"compute.healthChecks.create", "compute.healthChecks.delete", "compute.healthChecks.get", "compute.healthChecks.update", "compute.healthChecks.useReadOnly",
+			"compute.regionBackendServices.create", "compute.regionBackendServices.delete", "compute.regionBackendServices.get", "compute.regionBackendServices.update",
+			"compute.instanceGroups.create", "compute.instanceGroups.delete", "compute.instanceGroups.get", "compute.instanceGroups.list", "compute.instanceGroups.update",
+			"compute.instances.get", "compute.instances.list", "compute.instances.use",
+		},
+		networkProject: []string{
+			"compute.firewalls.create", "compute.firewalls.delete", "compute.firewalls.get", "compute.firewalls.update",
+			"compute.networks.updatePolicy", "compute.subnetworks.use",
+		},
+		role: "roles/compute.loadBalancerAdmin and roles/compute.securityAdmin",
+	},
+	names.NodeRouteController: {
+		project:        []string{"compute.instances.get", "compute.instances.list"},
+		networkProject: []string{"compute.routes.create", "compute.routes.delete", "compute.routes.get", "compute.routes.list", "compute.networks.updatePolicy"},
+		role:           "roles/compute.networkAdmin",
+	},
+	kcmnames.NodeIpamController: {
+		project:        []string{"compute.instances.get", "compute.instances.list", "compute.instances.updateNetworkInterface"},
+		networkProject: []string{"compute.subnetworks.get", "compute.subnetworks.use"},
+		role:           "roles/compute.networkAdmin",
+	},
+}
+
+// diagnoser is implemented by cloud providers which can check their IAM
+// permissions and config.
+type diagnoser interface {
+	ProjectID() string
+	NetworkProjectID() string
+	MissingPermissions(ctx context.Context, project string, permissions []string) ([]string, error)
+	DiagnoseConfig(ctx context.Context) []gce.ConfigDiagnostic
+}
+
+// newDiagnoseCommand returns the diagnose subcommand, which checks the IAM
+// permissions of the running identity against the ones needed by the
+// controllers and the cloud config against the live project and network,
+// and prints a remediation report.
+func newDiagnoseCommand() *cobra.Command {
+	var cloudConfigFile string
+	var controllers []string
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Check the IAM permissions and the cloud config of the cloud controller manager",
+		Long: `Check that the identity the cloud controller manager runs as has the IAM
+permissions needed by the controllers, and that the project, network,
+subnetwork, secondary range and zone of the cloud config exist, and print how
+to fix the problems found. Exits with a non-zero status if any check fails.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			aliases := controllerAliases()
+			for i, c := range controllers {
+				if name, ok := aliases[c]; ok {
+					controllers[i] = name
+				}
+				if _, ok := requiredPermissions[controllers[i]]; !ok {
+					return fmt.Errorf("unknown controller %q", c)
+				}
+			}
+			cloud, err := cloudprovider.InitCloudProvider(gce.ProviderName, cloudConfigFile)
+			if err != nil {
+				return fmt.Errorf("failed to initialize the cloud provider with config %q: %w", cloudConfigFile, err)
+			}
+			d, ok := cloud.(diagnoser)
+			if !ok {
+				return fmt.Errorf("cloud provider %q does not support diagnose", cloud.ProviderName())
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if !diagnose(ctx, d, controllers, cmd.OutOrStdout()) {
+				return errors.New("some checks failed")
+			}
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&cloudConfigFile, "cloud-config", "", "The path to the cloud provider configuration file.")
+	fs.StringSliceVar(&controllers, "controllers", []string{
+		names.CloudNodeController,
+		names.CloudNodeLifecycleController,
+		names.ServiceLBController,
+		names.NodeRouteController,
+		kcmnames.NodeIpamController,
+	}, "The controllers whose IAM permissions are checked, by name or alias.")
+	fs.DurationVar(&timeout, "timeout", time.Minute, "How long the checks may take.")
+	// The root command prints the sections of its own flags.
+	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n  %s\n\nFlags:\n%s", cmd.UseLine(), cmd.LocalFlags().FlagUsages())
+		return nil
+	})
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\nUsage:\n  %s\n\nFlags:\n%s", cmd.Long, cmd.UseLine(), cmd.LocalFlags().FlagUsages())
+	})
+	return cmd
+}
+
+// diagnose prints the outcome of the permission and config checks to out,
+// and returns whether they all passed.
+func diagnose(ctx context.Context, d diagnoser, controllers []string, out io.Writer) bool {
+	passed := true
+	report := func(check string, err error, remediation string) {
+		if err == nil {
+			fmt.Fprintf(out, "[PASS] %s\n", check)
+			return
+		}
+		passed = false
+		fmt.Fprintf(out, "[FAIL] %s: %v\n", check, err)
+		if remediation != "" {
+			fmt.Fprintf(out, "       Remediation: %s\n", remediation)
+		}
+	}
+
+	for _, c := range controllers {
+		perms := requiredPermissions[c]
+		projects := []struct {
+			id          string
+			permissions []string
+		}{
+			{d.ProjectID(), perms.project},
+			{d.NetworkProjectID(), perms.networkProject},
+		}
+		if projects[0].id == projects[1].id {
+			projects[0].permissions = append(append([]string{}, perms.project...), perms.networkProject...)
+			projects = projects[:1]
+		}
+		for _, p := range projects {
+			if len(p.permissions) == 0 {
+				continue
+			}
+			check := fmt.Sprintf("%s permissions on project %s", c, p.id)
+			missing, err := d.MissingPermissions(ctx, p.id, p.permissions)
+			if err != nil {
+				report(check, err, fmt.Sprintf("Enable the Cloud Resource Manager API on project %s.", p.id))
+				continue
+			}
+			if len(missing) > 0 {
+				err = fmt.Errorf("missing %s", strings.Join(missing, ", "))
+			}
+			report(check, err, fmt.Sprintf("Grant the identity of the cloud controller manager %s, or a custom role with the missing permissions, on project %s.", perms.role, p.id))
+		}
+	}
+
+	for _, diag := range d.DiagnoseConfig(ctx) {
+		report("cloud config "+diag.Field, diag.Err, diag.Remediation)
+	}
+	return passed
+}
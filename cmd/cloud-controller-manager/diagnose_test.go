@@ -0,0 +1,169 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/cloud-provider/names"
+	kcmnames "k8s.io/kubernetes/cmd/kube-controller-manager/names"
+)
+
+type fakeDiagnoser struct {
+	projectID        string
+	networkProjectID string
+	// granted are the permissions granted on each project.
+	granted map[string][]string
+	testErr error
+	config  []gce.ConfigDiagnostic
+	// tested are the projects whose permissions were tested.
+	tested []string
+}
+
+func (d *fakeDiagnoser) ProjectID() string        { return d.projectID }
+func (d *fakeDiagnoser) NetworkProjectID() string { return d.networkProjectID }
+
+func (d *fakeDiagnoser) MissingPermissions(ctx context.Context, project string, permissions []string) ([]string, error) {
+	d.tested = append(d.tested, project)
+	if d.testErr != nil {
+		return nil, d.testErr
+	}
+	var missing []string
+	for _, p := range permissions {
+		if !slices.Contains(d.granted[project], p) {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+func (d *fakeDiagnoser) DiagnoseConfig(ctx context.Context) []gce.ConfigDiagnostic {
+	return d.config
+}
+
+func TestDiagnose(t *testing.T) {
+	routePermissions := requiredPermissions[names.NodeRouteController]
+	allRoutePermissions := append(append([]string{}, routePermissions.project...), routePermissions.networkProject...)
+
+	testCases := []struct {
+		desc        string
+		d           *fakeDiagnoser
+		controllers []string
+		wantPassed  bool
+		wantTested  []string
+		// wantOutput are substrings of the report.
+		wantOutput []string
+	}{
+		{
+			desc: "all permissions granted",
+			d: &fakeDiagnoser{
+				projectID:        "project",
+				networkProjectID: "project",
+				granted:          map[string][]string{"project": allRoutePermissions},
+				config:           []gce.ConfigDiagnostic{{Field: "network-name"}},
+			},
+			controllers: []string{names.NodeRouteController},
+			wantPassed:  true,
+			wantTested:  []string{"project"},
+			wantOutput: []string{
+				"[PASS] node-route-controller permissions on project project",
+				"[PASS] cloud config network-name",
+			},
+		},
+		{
+			desc: "permissions missing on the network project",
+			d: &fakeDiagnoser{
+				projectID:        "service-project",
+				networkProjectID: "host-project",
+				granted: map[string][]string{
+					"service-project": allRoutePermissions,
+					"host-project":    {"compute.routes.list"},
+				},
+			},
+			controllers: []string{names.NodeRouteController},
+			wantTested:  []string{"service-project", "host-project"},
+			wantOutput: []string{
+				"[PASS] node-route-controller permissions on project service-project",
+				"[FAIL] node-route-controller permissions on project host-project: missing compute.routes.create, compute.routes.delete, compute.routes.get, compute.networks.updatePolicy",
+				"Remediation: Grant the identity of the cloud controller manager roles/compute.networkAdmin",
+			},
+		},
+		{
+			desc: "permissions cannot be tested",
+			d: &fakeDiagnoser{
+				projectID:        "project",
+				networkProjectID: "project",
+				testErr:          errors.New("API not enabled"),
+			},
+			controllers: []string{names.CloudNodeController, kcmnames.NodeIpamController},
+			wantTested:  []string{"project", "project"},
+			wantOutput: []string{
+				"[FAIL] cloud-node-controller permissions on project project: API not enabled",
+				"[FAIL] node-ipam-controller permissions on project project: API not enabled",
+				"Remediation: Enable the Cloud Resource Manager API on project project.",
+			},
+		},
+		{
+			desc: "invalid config",
+			d: &fakeDiagnoser{
+				projectID:        "project",
+				networkProjectID: "project",
+				config: []gce.ConfigDiagnostic{
+					{Field: "network-name"},
+					{Field: "subnetwork-name", Err: errors.New("subnetwork not found"), Remediation: "Set subnetwork-name."},
+				},
+			},
+			wantOutput: []string{
+				"[PASS] cloud config network-name",
+				"[FAIL] cloud config subnetwork-name: subnetwork not found\n       Remediation: Set subnetwork-name.",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var out bytes.Buffer
+			passed := diagnose(context.Background(), tc.d, tc.controllers, &out)
+			if passed != tc.wantPassed {
+				t.Errorf("diagnose() = %v, want %v", passed, tc.wantPassed)
+			}
+			if !reflect.DeepEqual(tc.d.tested, tc.wantTested) {
+				t.Errorf("tested projects %v, want %v", tc.d.tested, tc.wantTested)
+			}
+			for _, want := range tc.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report does not contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRequiredPermissionsCoverDefaultControllers(t *testing.T) {
+	for _, c := range []string{names.CloudNodeController, names.CloudNodeLifecycleController, names.ServiceLBController, names.NodeRouteController, kcmnames.NodeIpamController} {
+		perms, ok := requiredPermissions[c]
+		if !ok || len(perms.project)+len(perms.networkProject) == 0 || perms.role == "" {
+			t.Errorf("No required permissions for controller %s", c)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/apiserver/pkg/server/mux"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/app/config"
+	"k8s.io/cloud-provider/names"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	controllerhealthz "k8s.io/controller-manager/pkg/healthz"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// healthProbeBindAddress is the address the /healthz and /readyz probes
+	// are served on. The probe server is disabled if empty.
+	healthProbeBindAddress string
+	// controllerSyncHealthTimeout is how long a controller sync loop may fail
+	// or stall before its health check fails.
+	controllerSyncHealthTimeout time.Duration
+
+	// probes holds the checks served by the probe server.
+	probes = &healthProbes{}
+)
+
+// controllerSyncLoops maps controllers to the cloud provider sync loop they
+// drive.
+var controllerSyncLoops = map[string]string{
+	names.NodeRouteController:          gce.SyncLoopRoute,
+	names.ServiceLBController:          gce.SyncLoopService,
+	names.CloudNodeController:          gce.SyncLoopNode,
+	names.CloudNodeLifecycleController: gce.SyncLoopNodeLifecycle,
+}
+
+// syncLoopHealthChecker is implemented by cloud providers that track the
+// outcome of the cloud calls made by the controller sync loops.
+type syncLoopHealthChecker interface {
+	CheckSyncLoop(loop string, timeout time.Duration) error
+}
+
+// apiReachabilityChecker is implemented by cloud providers that can check
+// whether their API is reachable.
+type apiReachabilityChecker interface {
+	CheckAPIReachable(ctx context.Context) error
+}
+
+// syncLoopController is returned for controllers whose sync loop is tracked
+// by the cloud provider, so that the controller manager adds a check of the
+// sync loop to /healthz instead of a ping.
+type syncLoopController struct {
+	name    string
+	loop    string
+	checker syncLoopHealthChecker
+}
+
+func (c *syncLoopController) Name() string {
+	return c.name
+}
+
+func (c *syncLoopController) HealthChecker() controllerhealthz.UnnamedHealthChecker {
+	return c
+}
+
+func (c *syncLoopController) Check(_ *http.Request) error {
+	return c.checker.CheckSyncLoop(c.loop, controllerSyncHealthTimeout)
+}
+
+// withSyncLoopHealthCheck wraps the constructor of the named controller so
+// that the started controller reports the health of its sync loop.
+func withSyncLoopHealthCheck(name string, constructor app.InitFuncConstructor) app.InitFuncConstructor {
+	return func(initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+		initFunc := constructor(initContext, completedConfig, cloud)
+		return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+			ctrl, started, err := initFunc(ctx, controllerContext)
+			if err != nil || !started || ctrl != nil {
+				return ctrl, started, err
+			}
+			checker, ok := cloud.(syncLoopHealthChecker)
+			if !ok {
+				return ctrl, started, err
+			}
+			c := &syncLoopController{name: name, loop: controllerSyncLoops[name], checker: checker}
+			probes.add(false, healthz.NamedCheck(name, c.Check))
+			return c, true, nil
+		}
+	}
+}
+
+// healthProbes serves /healthz and /readyz with checks that can be added
+// after the probe server started. Liveness checks are part of both. It also
+// serves the read-only inspection endpoints of the replica.
+type healthProbes struct {
+	mu          sync.RWMutex
+	liveChecks  []healthz.HealthChecker
+	readyChecks []healthz.HealthChecker
+	endpoints   map[string]http.Handler
+	handler     http.Handler
+}
+
+// add adds checks to /readyz, and to /healthz unless readyOnly is set.
+func (p *healthProbes) add(readyOnly bool, checks ...healthz.HealthChecker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !readyOnly {
+		p.liveChecks = append(p.liveChecks, checks...)
+	}
+	p.readyChecks = append(p.readyChecks, checks...)
+	p.rebuild()
+}
+
+// handle serves handler on path.
+func (p *healthProbes) handle(path string, handler http.Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints == nil {
+		p.endpoints = map[string]http.Handler{}
+	}
+	p.endpoints[path] = handler
+	p.rebuild()
+}
+
+// rebuild must be called with the lock held.
+func (p *healthProbes) rebuild() {
+	m := mux.NewPathRecorderMux("health-probes")
+	healthz.InstallPathHandler(m, "/healthz", append([]healthz.HealthChecker{healthz.PingHealthz}, p.liveChecks...)...)
+	healthz.InstallPathHandler(m, "/readyz", append([]healthz.HealthChecker{healthz.PingHealthz}, p.readyChecks...)...)
+	for path, handler := range p.endpoints {
+		m.Handle(path, handler)
+	}
+	p.handler = m
+}
+
+func (p *healthProbes) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.handler == nil {
+		http.NotFound(w, req)
+		return
+	}
+	p.handler.ServeHTTP(w, req)
+}
+
+// startHealthProbeServer serves /healthz and /readyz on addr. Besides the
+// controller sync loop checks, /readyz checks that the cloud API is reachable.
+func startHealthProbeServer(addr string, cloud cloudprovider.Interface) {
+	var readyChecks []healthz.HealthChecker
+	if checker, ok := cloud.(apiReachabilityChecker); ok {
+		readyChecks = append(readyChecks, healthz.NamedCheck("cloud-api", func(req *http.Request) error {
+			return checker.CheckAPIReachable(req.Context())
+		}))
+	}
+	probes.add(true, readyChecks...)
+	go func() {
+		klog.Infof("Serving health probes on %s", addr)
+		if err := http.ListenAndServe(addr, probes); err != nil {
+			klog.Errorf("Health probe server failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/app/config"
+	"k8s.io/cloud-provider/names"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+)
+
+type fakeSyncLoopCloud struct {
+	cloudprovider.Interface
+	loopErrs map[string]error
+	apiErr   error
+}
+
+func (f *fakeSyncLoopCloud) CheckSyncLoop(loop string, _ time.Duration) error {
+	return f.loopErrs[loop]
+}
+
+func (f *fakeSyncLoopCloud) CheckAPIReachable(_ context.Context) error {
+	return f.apiErr
+}
+
+func TestSyncLoopHealthCheck(t *testing.T) {
+	defer func(old *healthProbes) { probes = old }(probes)
+	probes = &healthProbes{}
+
+	cloud := &fakeSyncLoopCloud{loopErrs: map[string]error{}}
+	startHealthProbeServer("127.0.0.1:0", cloud)
+
+	constructor := func(app.ControllerInitContext, *config.CompletedConfig, cloudprovider.Interface) app.InitFunc {
+		return func(context.Context, genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+			return nil, true, nil
+		}
+	}
+	initFunc := withSyncLoopHealthCheck(names.NodeRouteController, constructor)(app.ControllerInitContext{}, nil, cloud)
+	ctrl, started, err := initFunc(context.Background(), genericcontrollermanager.ControllerContext{})
+	if err != nil || !started {
+		t.Fatalf("initFunc() = %v, %t, %v, want started controller", ctrl, started, err)
+	}
+	checkable, ok := ctrl.(controller.HealthCheckable)
+	if !ok {
+		t.Fatalf("controller %T is not health checkable", ctrl)
+	}
+
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		probes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz got %d, want %d", code, http.StatusOK)
+	}
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz got %d, want %d", code, http.StatusOK)
+	}
+
+	// A failing sync loop fails both probes and the controller health check.
+	cloud.loopErrs["route"] = errors.New("route sync stalled")
+	if err := checkable.HealthChecker().Check(nil); err == nil {
+		t.Errorf("controller health check succeeded, want error")
+	}
+	if code := probe("/healthz"); code != http.StatusInternalServerError {
+		t.Errorf("/healthz got %d, want %d", code, http.StatusInternalServerError)
+	}
+
+	// An unreachable cloud API only fails readiness.
+	cloud.loopErrs["route"] = nil
+	cloud.apiErr = errors.New("connection refused")
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz got %d, want %d", code, http.StatusOK)
+	}
+	if code := probe("/readyz"); code != http.StatusInternalServerError {
+		t.Errorf("/readyz got %d, want %d", code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// leaderElectLeasePerControllerGroup makes replicas running different sets of
+// controllers, selected with --controllers, use separate leader election
+// leases, so that e.g. the route and service controllers can run on
+// different replicas of very large clusters.
+var leaderElectLeasePerControllerGroup bool
+
+// controllerGroupLeaseName returns the name of the leader election lease of
+// the replicas running controllers: base, suffixed with the controllers
+// unless all controllers enabled by default are run. Aliases are resolved so
+// that equivalent --controllers values share a lease.
+func controllerGroupLeaseName(base string, controllers []string, aliases map[string]string) string {
+	if len(controllers) == 0 || (len(controllers) == 1 && controllers[0] == "*") {
+		return base
+	}
+	var group []string
+	for _, controller := range controllers {
+		prefix := ""
+		if strings.HasPrefix(controller, "-") {
+			prefix = "no-"
+			controller = strings.TrimPrefix(controller, "-")
+		}
+		if canonical, ok := aliases[controller]; ok {
+			controller = canonical
+		}
+		if controller == "*" {
+			controller = "all"
+		}
+		group = append(group, prefix+controller)
+	}
+	sort.Strings(group)
+	return base + "." + strings.Join(group, ".")
+}
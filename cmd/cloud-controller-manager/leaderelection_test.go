@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestControllerGroupLeaseName(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		controllers []string
+		want        string
+	}{
+		{
+			desc:        "all controllers",
+			controllers: []string{"*"},
+			want:        "cloud-controller-manager",
+		},
+		{
+			desc:        "route controller",
+			controllers: []string{"route"},
+			want:        "cloud-controller-manager.node-route-controller",
+		},
+		{
+			desc:        "canonical name shares the lease of the alias",
+			controllers: []string{"node-route-controller"},
+			want:        "cloud-controller-manager.node-route-controller",
+		},
+		{
+			desc:        "all but the route controller",
+			controllers: []string{"*", "-route"},
+			want:        "cloud-controller-manager.all.no-node-route-controller",
+		},
+		{
+			desc:        "order does not matter",
+			controllers: []string{"service", "cloud-node"},
+			want:        "cloud-controller-manager.cloud-node-controller.service-lb-controller",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := controllerGroupLeaseName("cloud-controller-manager", tc.controllers, controllerAliases()); got != tc.want {
+				t.Errorf("controllerGroupLeaseName(%q) = %q, want %q", tc.controllers, got, tc.want)
+			}
+		})
+	}
+}
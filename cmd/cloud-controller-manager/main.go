@@ -20,26 +20,59 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"math/rand"
 	"os"
 	"time"
 
+	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	cloudprovider "k8s.io/cloud-provider"
-	_ "k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/cloud-provider-gcp/providers/gce"
 	"k8s.io/cloud-provider/app"
 	"k8s.io/cloud-provider/app/config"
 	"k8s.io/cloud-provider/names"
 	"k8s.io/cloud-provider/options"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/logs"
+	_ "k8s.io/component-base/logs/json/register"          // for JSON log format registration
 	_ "k8s.io/component-base/metrics/prometheus/clientgo" // load all the prometheus client-go plugins
 	_ "k8s.io/component-base/metrics/prometheus/version"  // for version metric registration
 	"k8s.io/klog/v2"
 	kcmnames "k8s.io/kubernetes/cmd/kube-controller-manager/names"
 )
 
+// cloudConfigReloadPeriod is how often the cloud config file is checked for
+// changes to reload. Reloading is disabled if zero.
+var cloudConfigReloadPeriod time.Duration
+
+// dryRun makes the cloud provider log the cloud resources mutations instead
+// of executing them.
+var dryRun bool
+
+// dryRunner is implemented by cloud providers supporting a dry-run mode.
+type dryRunner interface {
+	SetDryRun(dryRun bool)
+}
+
+// intentLogFile is the path of the write-ahead log of the cloud resources
+// mutations. Mutations are not logged if empty.
+var intentLogFile string
+
+// intentLogger is implemented by cloud providers supporting an intent log.
+type intentLogger interface {
+	EnableIntentLog(path string) error
+}
+
+func init() {
+	// Register the GCE feature gates so that they can be set with --feature-gates.
+	utilruntime.Must(gce.AddFeatureGates(utilfeature.DefaultMutableFeatureGate))
+	gce.SetFeatureGate(utilfeature.DefaultFeatureGate)
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
@@ -50,26 +83,51 @@ func main() {
 		klog.Fatalf("unable to initialize command options: %v", err)
 	}
 
-	controllerInitializers := app.DefaultInitFuncConstructors
-
 	// add new controllers and initializers
 	nodeIpamController := nodeIPAMController{}
 	nodeIpamController.nodeIPAMControllerOptions.NodeIPAMControllerConfiguration = &nodeIpamController.nodeIPAMControllerConfiguration
 	fss := cliflag.NamedFlagSets{}
 	nodeIpamController.nodeIPAMControllerOptions.AddFlags(fss.FlagSet("nodeipam controller"))
-	controllerInitializers[kcmnames.NodeIpamController] = app.ControllerInitFuncConstructor{
-		Constructor: nodeIpamController.startNodeIpamControllerWrapper,
-	}
-
-	controllerInitializers["gkenetworkparamset"] = app.ControllerInitFuncConstructor{
-		Constructor: startGkeNetworkParamSetControllerWrapper,
-	}
+	fss.FlagSet("health probes").StringVar(&healthProbeBindAddress, "health-probe-bind-address", "", "The address to serve the /healthz and /readyz probes on over plain HTTP, e.g. :10259. /readyz also checks that the cloud API is reachable. Disabled if empty.")
+	fss.FlagSet("health probes").DurationVar(&controllerSyncHealthTimeout, "controller-sync-health-timeout", 15*time.Minute, "How long the route, service and node controllers may fail to sync with the cloud for other reasons than errors of the GCE API, or the route and node controllers may stop syncing, before their health checks fail.")
+	fss.FlagSet("health probes").BoolVar(&routePlanEndpoint, "route-plan-endpoint", false, "Serve the route creations and deletions the route controller would perform, with their reasons, on /debug/routes of the --health-probe-bind-address server, on every replica and whether or not the route controller is enabled. Routes are planned for --cluster-cidr.")
+	fss.FlagSet("leader election").BoolVar(&standbyWarmup, "standby-warmup", false, "Start the Node and Service informers on every replica, including those waiting for the leader election lease, so that a new leader runs its controllers on synced caches. Only the leader runs the controllers and modifies the cloud. If --health-probe-bind-address is set, every replica also serves a snapshot of its caches on /debug/cache.")
+	fss.FlagSet("leader election").BoolVar(&leaderElectLeasePerControllerGroup, "leader-elect-lease-per-controller-group", false, "Suffix the --leader-elect-resource-name lease with the controllers selected with --controllers, so that replicas running different controllers, e.g. --controllers=route and --controllers=*,-route, hold separate leases. The lease name is not changed when all controllers are run.")
+	fss.FlagSet("tracing").StringVar(&tracingEndpoint, "tracing-endpoint", "", "The OTLP gRPC endpoint, e.g. localhost:4317, to export the OpenTelemetry spans of the service, route, node and node IPAM syncs and of the GCE API calls they make to. Tracing is disabled if empty.")
+	fss.FlagSet("tracing").Int32Var(&tracingSamplingRatePerMillion, "tracing-sampling-rate-per-million", 0, "The number of syncs traced per million, between 0 and 1000000. Only the syncs whose context is already sampled are traced if 0.")
+	fss.FlagSet("cloud config").DurationVar(&cloudConfigReloadPeriod, "cloud-config-reload-period", 0, "How often to check the cloud config file for changes and reload it without restarting. Only some fields, such as node-tags, can be reloaded. Disabled if 0.")
+	fss.FlagSet("cloud provider").StringVar(&intentLogFile, "intent-log-file", "", "File to record the insertions, updates and deletions of forwarding rules, firewalls, routes and target pools to before they are issued. The mutations left unacknowledged by a previous run are reconciled against the cloud resources and logged at startup. Disabled if empty.")
+	fss.FlagSet("cloud provider").BoolVar(&dryRun, "dry-run", false, "Log the mutations of the GCE resources, e.g. the insertions, updates and deletions of the load balancer resources, routes, instance groups, alias IP ranges and disks, instead of executing them, to preview the changes the cloud controller manager would make.")
+	fss.FlagSet("service controller").DurationVar(&serviceResyncPeriod, "service-resync-period", 0, "The resync period of the Service and Node informers of the service controller, which then uses informers of its own. Together with --concurrent-service-syncs, it trades cloud API QPS for faster load balancer convergence on large clusters. The informers shared with the other controllers, resynced every --min-resync-period, are used if 0.")
+	fss.FlagSet("service controller").DurationVar(&serviceReconcilePeriod, "service-reconcile-period", 0, "How often the service controller reconciles the load balancers of all the Services, even if neither the Services nor the Nodes changed, to correct the drift of the load balancers. Only the changed Services are reconciled if 0.")
+	fss.FlagSet("node controller").DurationVar(&nodeResyncPeriod, "node-resync-period", 0, "The resync period of the Node informer of the cloud node controller, which then uses an informer of its own. The addresses of the Nodes are reconciled every --node-status-update-frequency. The informers shared with the other controllers, resynced every --min-resync-period, are used if 0.")
+	controllerInitializers := newControllerInitializers(&nodeIpamController)
 
 	// add controllers disabled by default
 	app.ControllersDisabledByDefault.Insert("gkenetworkparamset")
-	aliasMap := names.CCMControllerAliases()
-	aliasMap["nodeipam"] = kcmnames.NodeIpamController
+	aliasMap := controllerAliases()
 	command := app.NewCloudControllerManagerCommand(ccmOptions, cloudInitializer, controllerInitializers, aliasMap, fss, wait.NeverStop)
+	command.AddCommand(newDiagnoseCommand())
+	command.AddCommand(newValidateConfigCommand())
+	command.PreRun = func(cmd *cobra.Command, args []string) {
+		if err := validateServiceControllerFlags(ccmOptions.ServiceController.ConcurrentServiceSyncs, serviceResyncPeriod); err != nil {
+			klog.Fatalf("Invalid service controller flags: %v", err)
+		}
+		if err := validateResyncPeriods(map[string]time.Duration{
+			"service-reconcile-period": serviceReconcilePeriod,
+			"node-resync-period":       nodeResyncPeriod,
+		}); err != nil {
+			klog.Fatalf("Invalid resync flags: %v", err)
+		}
+		if err := setupTracing(context.Background(), tracingEndpoint, tracingSamplingRatePerMillion); err != nil {
+			klog.Fatalf("Failed to set up tracing: %v", err)
+		}
+		if leaderElectLeasePerControllerGroup {
+			leaderElection := &ccmOptions.Generic.LeaderElection
+			leaderElection.ResourceName = controllerGroupLeaseName(leaderElection.ResourceName, ccmOptions.Generic.Controllers, aliasMap)
+			klog.Infof("Using leader election lease %s/%s", leaderElection.ResourceNamespace, leaderElection.ResourceName)
+		}
+	}
 
 	logs.InitLogs()
 	defer logs.FlushLogs()
@@ -79,6 +137,40 @@ func main() {
 	}
 }
 
+// newControllerInitializers returns the controllers run by the cloud controller
+// manager: the upstream cloud controllers plus the GCP specific ones. Any of them
+// can be disabled with --controllers, e.g. --controllers=*,-route.
+func newControllerInitializers(nodeIpamController *nodeIPAMController) map[string]app.ControllerInitFuncConstructor {
+	controllerInitializers := map[string]app.ControllerInitFuncConstructor{}
+	for name, initializer := range app.DefaultInitFuncConstructors {
+		if name == names.ServiceLBController {
+			initializer.Constructor = startServiceControllerWrapper
+		}
+		if period, ok := controllerResyncPeriods[name]; ok {
+			initializer.Constructor = withResyncPeriod(name, period, initializer.Constructor)
+		}
+		if _, ok := controllerSyncLoops[name]; ok {
+			initializer.Constructor = withSyncLoopHealthCheck(name, initializer.Constructor)
+		}
+		controllerInitializers[name] = initializer
+	}
+	controllerInitializers[kcmnames.NodeIpamController] = app.ControllerInitFuncConstructor{
+		Constructor: nodeIpamController.startNodeIpamControllerWrapper,
+	}
+	controllerInitializers["gkenetworkparamset"] = app.ControllerInitFuncConstructor{
+		Constructor: startGkeNetworkParamSetControllerWrapper,
+	}
+	return controllerInitializers
+}
+
+// controllerAliases returns the short names accepted by --controllers in
+// addition to the canonical controller names.
+func controllerAliases() map[string]string {
+	aliasMap := names.CCMControllerAliases()
+	aliasMap["nodeipam"] = kcmnames.NodeIpamController
+	return aliasMap
+}
+
 func cloudInitializer(config *config.CompletedConfig) cloudprovider.Interface {
 	cloudConfig := config.ComponentConfig.KubeCloudShared.CloudProvider
 
@@ -98,5 +190,44 @@ func cloudInitializer(config *config.CompletedConfig) cloudprovider.Interface {
 			klog.Fatalf("no ClusterID found.  A ClusterID is required for the cloud provider to function properly.  This check can be bypassed by setting the allow-untagged-cloud option")
 		}
 	}
+	if dryRun {
+		runner, ok := cloud.(dryRunner)
+		if !ok {
+			klog.Fatalf("Cloud provider %q does not support --dry-run", cloud.ProviderName())
+		}
+		klog.Warning("Running in dry-run mode, cloud resources will not be modified")
+		runner.SetDryRun(true)
+	}
+	if intentLogFile != "" {
+		logger, ok := cloud.(intentLogger)
+		if !ok {
+			klog.Fatalf("Cloud provider %q does not support --intent-log-file", cloud.ProviderName())
+		}
+		if err := logger.EnableIntentLog(intentLogFile); err != nil {
+			klog.Fatalf("Failed to enable the intent log %q: %v", intentLogFile, err)
+		}
+	}
+	if healthProbeBindAddress != "" {
+		startHealthProbeServer(healthProbeBindAddress, cloud)
+	}
+	if standbyWarmup {
+		inspector := startStandbyWarmup(config.SharedInformers, wait.NeverStop)
+		probes.handle("/debug/cache", inspector)
+	}
+	if routePlanEndpoint {
+		routes, ok := cloud.Routes()
+		if !ok {
+			klog.Fatalf("Cloud provider %q does not support routes, --route-plan-endpoint cannot be used", cloud.ProviderName())
+		}
+		shared := config.ComponentConfig.KubeCloudShared
+		planner, err := newRoutePlanner(routes, shared.ClusterName, shared.ClusterCIDR, config.SharedInformers, wait.NeverStop)
+		if err != nil {
+			klog.Fatalf("Invalid --cluster-cidr %q for --route-plan-endpoint: %v", shared.ClusterCIDR, err)
+		}
+		probes.handle("/debug/routes", planner)
+	}
+	if cloudConfigReloadPeriod > 0 && cloudConfig.CloudConfigFile != "" {
+		startCloudConfigReload(cloud, cloudConfig.CloudConfigFile, cloudConfigReloadPeriod, wait.NeverStop)
+	}
 	return cloud
 }
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/names"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	cmconfig "k8s.io/controller-manager/config"
+	cmoptions "k8s.io/controller-manager/options"
+	kcmnames "k8s.io/kubernetes/cmd/kube-controller-manager/names"
+)
+
+func TestControllersFlag(t *testing.T) {
+	allControllers := app.ControllerNames(newControllerInitializers(&nodeIPAMController{}))
+	disabledByDefault := []string{"gkenetworkparamset"}
+
+	testCases := []struct {
+		desc         string
+		controllers  []string
+		wantErr      bool
+		wantEnabled  []string
+		wantDisabled []string
+	}{
+		{
+			desc:         "default controllers",
+			controllers:  []string{"*"},
+			wantEnabled:  []string{names.CloudNodeController, names.CloudNodeLifecycleController, names.ServiceLBController, names.NodeRouteController, kcmnames.NodeIpamController},
+			wantDisabled: []string{"gkenetworkparamset"},
+		},
+		{
+			desc:         "exclude aliased controllers",
+			controllers:  []string{"*", "-route", "-nodeipam", "-cloud-node-lifecycle"},
+			wantEnabled:  []string{names.CloudNodeController, names.ServiceLBController},
+			wantDisabled: []string{names.NodeRouteController, kcmnames.NodeIpamController, names.CloudNodeLifecycleController},
+		},
+		{
+			desc:         "explicit controllers",
+			controllers:  []string{"cloud-node", "service", "gkenetworkparamset"},
+			wantEnabled:  []string{names.CloudNodeController, names.ServiceLBController, "gkenetworkparamset"},
+			wantDisabled: []string{names.CloudNodeLifecycleController, names.NodeRouteController, kcmnames.NodeIpamController},
+		},
+		{
+			desc:        "unknown controller",
+			controllers: []string{"*", "-foo"},
+			wantErr:     true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := cmoptions.GenericControllerManagerConfigurationOptions{
+				GenericControllerManagerConfiguration: &cmconfig.GenericControllerManagerConfiguration{Controllers: tc.controllers},
+			}
+			errs := opts.Validate(allControllers, disabledByDefault, controllerAliases())
+			if gotErr := len(errs) > 0; gotErr != tc.wantErr {
+				t.Fatalf("Validate() got errors %v, want error %t", errs, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			cfg := cmconfig.GenericControllerManagerConfiguration{}
+			if err := opts.ApplyTo(&cfg, allControllers, disabledByDefault, controllerAliases()); err != nil {
+				t.Fatalf("ApplyTo() got error %v", err)
+			}
+			for _, name := range tc.wantEnabled {
+				if !genericcontrollermanager.IsControllerEnabled(name, sets.NewString(disabledByDefault...), cfg.Controllers) {
+					t.Errorf("controller %q is disabled with --controllers=%v, want enabled", name, tc.controllers)
+				}
+			}
+			for _, name := range tc.wantDisabled {
+				if genericcontrollermanager.IsControllerEnabled(name, sets.NewString(disabledByDefault...), cfg.Controllers) {
+					t.Errorf("controller %q is enabled with --controllers=%v, want disabled", name, tc.controllers)
+				}
+			}
+		})
+	}
+}
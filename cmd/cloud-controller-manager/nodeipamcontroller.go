@@ -58,16 +58,18 @@ type nodeIPAMController struct {
 func (nodeIpamController *nodeIPAMController) startNodeIpamControllerWrapper(initContext app.ControllerInitContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
 	errors := nodeIpamController.nodeIPAMControllerOptions.Validate()
 	if len(errors) > 0 {
-		klog.Fatal("NodeIPAM controller values are not properly set.")
+		klog.Fatalf("NodeIPAM controller values are not properly set: %v", errors)
 	}
 	nodeIpamController.nodeIPAMControllerOptions.ApplyTo(&nodeIpamController.nodeIPAMControllerConfiguration)
+	// Validated above.
+	allocatorParams, _ := nodeIpamController.nodeIPAMControllerOptions.AllocatorParams()
 
 	return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
-		return startNodeIpamController(completedConfig, nodeIpamController.nodeIPAMControllerConfiguration, controllerContext, cloud)
+		return startNodeIpamController(completedConfig, nodeIpamController.nodeIPAMControllerConfiguration, controllerContext, cloud, allocatorParams)
 	}
 }
 
-func startNodeIpamController(ccmConfig *cloudcontrollerconfig.CompletedConfig, nodeIPAMConfig nodeipamconfig.NodeIPAMControllerConfiguration, ctx genericcontrollermanager.ControllerContext, cloud cloudprovider.Interface) (controller.Interface, bool, error) {
+func startNodeIpamController(ccmConfig *cloudcontrollerconfig.CompletedConfig, nodeIPAMConfig nodeipamconfig.NodeIPAMControllerConfiguration, ctx genericcontrollermanager.ControllerContext, cloud cloudprovider.Interface, allocatorParams ipam.CIDRAllocatorParams) (controller.Interface, bool, error) {
 	var serviceCIDR *net.IPNet
 	var secondaryServiceCIDR *net.IPNet
 	var clusterCIDRs []*net.IPNet
@@ -122,6 +124,13 @@ func startNodeIpamController(ccmConfig *cloudcontrollerconfig.CompletedConfig, n
 		}
 	}
 
+	// failure: IPv4 cluster or service CIDRs in an IPv6-only cluster
+	if allocatorParams.IPv6Only {
+		if err := validateIPv6Only(clusterCIDRs, serviceCIDR, secondaryServiceCIDR); err != nil {
+			return nil, false, err
+		}
+	}
+
 	// get list of node cidr mask sizes
 	nodeCIDRMaskSizes, err = setNodeCIDRMaskSizes(nodeIPAMConfig, clusterCIDRs)
 	if err != nil {
@@ -148,6 +157,7 @@ func startNodeIpamController(ccmConfig *cloudcontrollerconfig.CompletedConfig, n
 		secondaryServiceCIDR,
 		nodeCIDRMaskSizes,
 		ipam.CIDRAllocatorType(ccmConfig.ComponentConfig.KubeCloudShared.CIDRAllocatorType),
+		allocatorParams,
 	)
 	if err != nil {
 		return nil, false, err
@@ -176,6 +186,23 @@ func processCIDRs(cidrsList string) ([]*net.IPNet, bool, error) {
 	return cidrs, dualstack, nil
 }
 
+// validateIPv6Only checks that the cluster and service CIDRs of an IPv6-only
+// cluster are IPv6, which rules out dual-stack services.
+func validateIPv6Only(clusterCIDRs []*net.IPNet, serviceCIDR, secondaryServiceCIDR *net.IPNet) error {
+	for _, cidr := range clusterCIDRs {
+		if !netutils.IsIPv6CIDR(cidr) {
+			return fmt.Errorf("cluster CIDR %v is not IPv6, which is required by --ipv6-only", cidr)
+		}
+	}
+	if serviceCIDR != nil && !netutils.IsIPv6CIDR(serviceCIDR) {
+		return fmt.Errorf("service CIDR %v is not IPv6, which is required by --ipv6-only", serviceCIDR)
+	}
+	if secondaryServiceCIDR != nil {
+		return fmt.Errorf("secondary service CIDR %v cannot be used with --ipv6-only", secondaryServiceCIDR)
+	}
+	return nil
+}
+
 // setNodeCIDRMaskSizes returns the IPv4 and IPv6 node cidr mask sizes to the value provided
 // for --node-cidr-mask-size-ipv4 and --node-cidr-mask-size-ipv6 respectively. If value not provided,
 // then it will return default IPv4 and IPv6 cidr mask sizes.
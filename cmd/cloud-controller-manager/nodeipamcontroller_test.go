@@ -5,6 +5,7 @@ import (
 
 	cloudprovider "k8s.io/cloud-provider"
 	nodeipamconfig "k8s.io/cloud-provider-gcp/pkg/controller/nodeipam/config"
+	"k8s.io/cloud-provider-gcp/pkg/controller/nodeipam/ipam"
 	cloudcontrollerconfig "k8s.io/cloud-provider/app/config"
 	"k8s.io/cloud-provider/config"
 	genericcontrollermanager "k8s.io/controller-manager/app"
@@ -52,10 +53,11 @@ func (f *fakeCloudProvider) HasClusterID() bool {
 
 func TestStartNodeIpamController(t *testing.T) {
 	testCases := []struct {
-		desc           string
-		ccmConfig      *cloudcontrollerconfig.Config
-		nodeIPAMConfig nodeipamconfig.NodeIPAMControllerConfiguration
-		wantErr        bool
+		desc            string
+		ccmConfig       *cloudcontrollerconfig.Config
+		nodeIPAMConfig  nodeipamconfig.NodeIPAMControllerConfiguration
+		allocatorParams ipam.CIDRAllocatorParams
+		wantErr         bool
 	}{
 		{
 			desc: "Allocate node CIDRs disabled",
@@ -195,12 +197,55 @@ func TestStartNodeIpamController(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			desc: "IPv4 cluster CIDR in an IPv6-only cluster",
+			ccmConfig: &cloudcontrollerconfig.Config{
+				ComponentConfig: config.CloudControllerManagerConfiguration{
+					KubeCloudShared: config.KubeCloudSharedConfiguration{
+						AllocateNodeCIDRs: true,
+						ClusterCIDR:       "10.0.0.0/16",
+					},
+				},
+			},
+			allocatorParams: ipam.CIDRAllocatorParams{IPv6Only: true},
+			wantErr:         true,
+		},
+		{
+			desc: "Dual stack cluster CIDRs in an IPv6-only cluster",
+			ccmConfig: &cloudcontrollerconfig.Config{
+				ComponentConfig: config.CloudControllerManagerConfiguration{
+					KubeCloudShared: config.KubeCloudSharedConfiguration{
+						AllocateNodeCIDRs: true,
+						ClusterCIDR:       "2001:db8::/48,10.0.0.0/16",
+					},
+				},
+			},
+			allocatorParams: ipam.CIDRAllocatorParams{IPv6Only: true},
+			wantErr:         true,
+		},
+		{
+			desc: "Dual stack service CIDRs in an IPv6-only cluster",
+			ccmConfig: &cloudcontrollerconfig.Config{
+				ComponentConfig: config.CloudControllerManagerConfiguration{
+					KubeCloudShared: config.KubeCloudSharedConfiguration{
+						AllocateNodeCIDRs: true,
+						ClusterCIDR:       "2001:db8::/48",
+					},
+				},
+			},
+			nodeIPAMConfig: nodeipamconfig.NodeIPAMControllerConfiguration{
+				ServiceCIDR:          "2001:db9::/112",
+				SecondaryServiceCIDR: "10.1.0.0/16",
+			},
+			allocatorParams: ipam.CIDRAllocatorParams{IPv6Only: true},
+			wantErr:         true,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
 			ctx := genericcontrollermanager.ControllerContext{}
-			_, _, err := startNodeIpamController(tc.ccmConfig.Complete(), tc.nodeIPAMConfig, ctx, &fakeCloudProvider{})
+			_, _, err := startNodeIpamController(tc.ccmConfig.Complete(), tc.nodeIPAMConfig, ctx, &fakeCloudProvider{}, tc.allocatorParams)
 
 			if err == nil && tc.wantErr {
 				t.Fatalf("startNodeIpamController succeeded, want error")
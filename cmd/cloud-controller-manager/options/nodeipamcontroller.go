@@ -18,16 +18,56 @@ package options
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 
 	nodeipamconfig "k8s.io/cloud-provider-gcp/pkg/controller/nodeipam/config"
+	"k8s.io/cloud-provider-gcp/pkg/controller/nodeipam/ipam"
+	netutils "k8s.io/utils/net"
 )
 
 // NodeIPAMControllerOptions holds the NodeIpamController options.
 type NodeIPAMControllerOptions struct {
 	*nodeipamconfig.NodeIPAMControllerConfiguration
+
+	// PodRangeName is the name of the secondary range of the node pod CIDRs.
+	PodRangeName string
+	// PodRangeNameOverrides are the SELECTOR:RANGE_NAME overrides of
+	// PodRangeName.
+	PodRangeNameOverrides []string
+	// CIDRLeakReconcilePeriod is how often the leaked node CIDRs are
+	// released, never if 0.
+	CIDRLeakReconcilePeriod time.Duration
+	// AdditionalClusterCIDRs are the CIDR[:NODE_CIDR_MASK_SIZE] blocks
+	// allocated from once the cluster CIDRs are exhausted.
+	AdditionalClusterCIDRs []string
+	// NodeCIDRMaskSizeOverrides are the SELECTOR:MASK_SIZE[,MASK_SIZE]
+	// overrides of the node CIDR mask sizes.
+	NodeCIDRMaskSizeOverrides []string
+	// IPv6Only allocates only IPv6 pod CIDRs to the nodes.
+	IPv6Only bool
+	// PodRangeExpansion adds alias IP ranges to the pod CIDRs of the nodes
+	// whose max pods exceed them.
+	PodRangeExpansion bool
+	// PodRangePreallocationMaskSize is the mask size of the alias IP ranges
+	// preallocated to the instances of the nodes, disabled if 0.
+	PodRangePreallocationMaskSize int
+	// ExternalIPAMURL is the URL of the external IPAM service.
+	ExternalIPAMURL string
+	// ExternalIPAMTimeout bounds the requests to the external IPAM service.
+	ExternalIPAMTimeout time.Duration
+	// ExternalIPAMCAFile is the CA verifying the external IPAM service.
+	ExternalIPAMCAFile string
+	// ExternalIPAMClientCertFile and ExternalIPAMClientKeyFile are the
+	// client certificate authenticating to the external IPAM service.
+	ExternalIPAMClientCertFile string
+	ExternalIPAMClientKeyFile  string
+	// ExternalIPAMTokenFile holds the bearer token authenticating to the
+	// external IPAM service.
+	ExternalIPAMTokenFile string
 }
 
 // AddFlags adds flags related to NodeIpamController for controller manager to the specified FlagSet.
@@ -39,6 +79,20 @@ func (o *NodeIPAMControllerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.Int32Var(&o.NodeCIDRMaskSize, "node-cidr-mask-size", o.NodeCIDRMaskSize, "Mask size for node cidr in cluster. Default is 24 for IPv4 and 64 for IPv6.")
 	fs.Int32Var(&o.NodeCIDRMaskSizeIPv4, "node-cidr-mask-size-ipv4", o.NodeCIDRMaskSizeIPv4, "Mask size for IPv4 node cidr in dual-stack cluster. Default is 24.")
 	fs.Int32Var(&o.NodeCIDRMaskSizeIPv6, "node-cidr-mask-size-ipv6", o.NodeCIDRMaskSizeIPv6, "Mask size for IPv6 node cidr in dual-stack cluster. Default is 64.")
+	fs.StringVar(&o.PodRangeName, "pod-range-name", o.PodRangeName, "Name of the secondary range of the node subnet to take the pod CIDRs of the nodes from, with --cidr-allocator-type=CloudAllocator. The first alias IP range of a node is taken if empty. The cloud.google.com/gke-np-default-pod-range label of a node takes precedence.")
+	fs.DurationVar(&o.CIDRLeakReconcilePeriod, "cidr-leak-reconcile-period", o.CIDRLeakReconcilePeriod, "How often to release the node CIDRs allocated by --cidr-allocator-type=RangeAllocator but held by no Node, e.g. after a failed Node update, and to flag the pod CIDRs held by several Nodes with either allocator. Disabled if 0.")
+	fs.StringArrayVar(&o.AdditionalClusterCIDRs, "additional-cluster-cidr", o.AdditionalClusterCIDRs, "Additional block of the --cluster-cidr of its IP family, as CIDR[:NODE_CIDR_MASK_SIZE], e.g. 10.100.0.0/16:25, which --cidr-allocator-type=RangeAllocator allocates node CIDRs from once the cluster CIDR is exhausted. The node CIDR mask size defaults to the one of the cluster CIDR. May be repeated, the blocks are allocated from in order.")
+	fs.StringArrayVar(&o.NodeCIDRMaskSizeOverrides, "node-cidr-mask-size-override", o.NodeCIDRMaskSizeOverrides, "Override of the node CIDR mask sizes of --cidr-allocator-type=RangeAllocator for the nodes matching a label selector, as SELECTOR:MASK_SIZE[,MASK_SIZE] with a mask size for each --cluster-cidr, e.g. cloud.google.com/gke-nodepool=high-density:23. The mask sizes must not be larger than the node CIDR mask sizes, which should be set to the smallest node CIDRs. May be repeated, the first override matching a node is used.")
+	fs.BoolVar(&o.IPv6Only, "ipv6-only", o.IPv6Only, "Allocate only IPv6 pod CIDRs to the nodes, for single-stack IPv6 VPCs. The --cluster-cidr and --service-cluster-ip-range must be IPv6. With --cidr-allocator-type=CloudAllocator the pod CIDRs are taken from the IPv6 ranges of the node interfaces and their alias IP ranges are ignored, so --pod-range-name cannot be used.")
+	fs.BoolVar(&o.PodRangeExpansion, "pod-range-expansion", o.PodRangeExpansion, "With --cidr-allocator-type=CloudAllocator, add an alias IP range from the secondary range of the pod CIDR of a node whose IPv4 pod CIDR has fewer than two addresses for each pod of its max pods, e.g. after its max pods were raised, instead of requiring the node to be replaced. The additional ranges are listed in the cloud.google.com/additional-pod-cidrs annotation of the node, which the CNI must route to its pods.")
+	fs.IntVar(&o.PodRangePreallocationMaskSize, "pod-range-preallocation-mask-size", o.PodRangePreallocationMaskSize, "With --cidr-allocator-type=CloudAllocator, add an alias IP range of this mask size from the secondary range of --pod-range-name, or the one of the cloud config, to the instances of the node instance groups, named with the node-instance-prefix of the cloud config, without alias IP ranges as soon as they are listed, before their nodes register, so that the node pod CIDRs are programmed by the time the nodes join. For instance templates without alias IP ranges. Requires the node-instance-prefix. Disabled if 0.")
+	fs.StringVar(&o.ExternalIPAMURL, "external-ipam-url", o.ExternalIPAMURL, "URL of the external IPAM service choosing the pod CIDRs of the nodes with --cidr-allocator-type=ExternalAllocator. The allocator asks the service to allocate the pod CIDRs of the nodes lacking them and to release the ones of the deleted nodes, retrying the failed releases, and adds the allocated IPv4 pod CIDRs to the alias IP ranges of the instances. The requests are posted as JSON to http and https URLs, and sent to the Allocate and Release methods of the gRPC service cloudprovidergcp.ipam.v1.ExternalIPAM at the host of grpc and grpcs URLs as google.protobuf.Struct messages with the same fields.")
+	fs.DurationVar(&o.ExternalIPAMTimeout, "external-ipam-timeout", o.ExternalIPAMTimeout, "Timeout of the requests to the --external-ipam-url service. Defaults to 10s if 0.")
+	fs.StringVar(&o.ExternalIPAMCAFile, "external-ipam-ca-file", o.ExternalIPAMCAFile, "PEM CA bundle verifying the https or grpcs --external-ipam-url service. Defaults to the system roots.")
+	fs.StringVar(&o.ExternalIPAMClientCertFile, "external-ipam-client-cert-file", o.ExternalIPAMClientCertFile, "PEM client certificate authenticating to the https or grpcs --external-ipam-url service. Requires --external-ipam-client-key-file.")
+	fs.StringVar(&o.ExternalIPAMClientKeyFile, "external-ipam-client-key-file", o.ExternalIPAMClientKeyFile, "PEM key of the --external-ipam-client-cert-file.")
+	fs.StringVar(&o.ExternalIPAMTokenFile, "external-ipam-token-file", o.ExternalIPAMTokenFile, "File holding the bearer token authenticating to the https or grpcs --external-ipam-url service, read at each request so that it can be rotated.")
+	fs.StringArrayVar(&o.PodRangeNameOverrides, "pod-range-name-override", o.PodRangeNameOverrides, "Override of --pod-range-name for the nodes matching a label selector, as SELECTOR:RANGE_NAME, e.g. cloud.google.com/gke-nodepool=pool-1:pods-1. May be repeated, the first override matching a node is used.")
 }
 
 // ApplyTo fills up NodeIpamController config with options.
@@ -74,6 +128,86 @@ func (o *NodeIPAMControllerOptions) Validate() []error {
 	if len(serviceCIDRList) > 2 {
 		errs = append(errs, fmt.Errorf("--service-cluster-ip-range can not contain more than two entries"))
 	}
+	if _, err := o.AllocatorParams(); err != nil {
+		errs = append(errs, err)
+	}
+	if o.CIDRLeakReconcilePeriod < 0 {
+		errs = append(errs, fmt.Errorf("--cidr-leak-reconcile-period must not be negative"))
+	}
+	if o.ExternalIPAMURL != "" {
+		u, err := url.Parse(o.ExternalIPAMURL)
+		switch {
+		case err != nil || u.Host == "":
+			errs = append(errs, fmt.Errorf("--external-ipam-url %q is not an http, https, grpc or grpcs URL", o.ExternalIPAMURL))
+		case u.Scheme == "http" || u.Scheme == "grpc":
+			if o.ExternalIPAMCAFile != "" || o.ExternalIPAMClientCertFile != "" || o.ExternalIPAMTokenFile != "" {
+				errs = append(errs, fmt.Errorf("--external-ipam-ca-file, --external-ipam-client-cert-file and --external-ipam-token-file require an https or grpcs --external-ipam-url"))
+			}
+		case u.Scheme != "https" && u.Scheme != "grpcs":
+			errs = append(errs, fmt.Errorf("--external-ipam-url %q is not an http, https, grpc or grpcs URL", o.ExternalIPAMURL))
+		}
+	}
+	if (o.ExternalIPAMClientCertFile == "") != (o.ExternalIPAMClientKeyFile == "") {
+		errs = append(errs, fmt.Errorf("--external-ipam-client-cert-file and --external-ipam-client-key-file must be set together"))
+	}
+	if o.ExternalIPAMTimeout < 0 {
+		errs = append(errs, fmt.Errorf("--external-ipam-timeout must not be negative"))
+	}
+	if o.PodRangePreallocationMaskSize < 0 || o.PodRangePreallocationMaskSize > 32 {
+		errs = append(errs, fmt.Errorf("--pod-range-preallocation-mask-size %d is not an IPv4 mask size", o.PodRangePreallocationMaskSize))
+	}
+	if o.IPv6Only && o.PodRangePreallocationMaskSize > 0 {
+		errs = append(errs, fmt.Errorf("--pod-range-preallocation-mask-size preallocates IPv4 alias IP ranges and cannot be used with --ipv6-only"))
+	}
+	if o.IPv6Only && o.PodRangeExpansion {
+		errs = append(errs, fmt.Errorf("--pod-range-expansion expands IPv4 pod CIDRs and cannot be used with --ipv6-only"))
+	}
+	if o.IPv6Only {
+		if o.PodRangeName != "" || len(o.PodRangeNameOverrides) > 0 {
+			errs = append(errs, fmt.Errorf("--pod-range-name and --pod-range-name-override select IPv4 alias IP ranges and cannot be used with --ipv6-only"))
+		}
+		for _, cidr := range serviceCIDRList {
+			if cidr != "" && !netutils.IsIPv6CIDRString(cidr) {
+				errs = append(errs, fmt.Errorf("--service-cluster-ip-range %q is not IPv6, which is required by --ipv6-only", cidr))
+			}
+		}
+	}
 
 	return errs
 }
+
+// AllocatorParams returns the CIDR allocator parameters of the options, which
+// are not part of NodeIPAMControllerConfiguration.
+func (o *NodeIPAMControllerOptions) AllocatorParams() (ipam.CIDRAllocatorParams, error) {
+	if o == nil {
+		return ipam.CIDRAllocatorParams{}, nil
+	}
+	podRanges, err := ipam.ParsePodRangeSelection(o.PodRangeName, o.PodRangeNameOverrides)
+	if err != nil {
+		return ipam.CIDRAllocatorParams{}, err
+	}
+	blocks, err := ipam.ParseClusterCIDRBlocks(o.AdditionalClusterCIDRs)
+	if err != nil {
+		return ipam.CIDRAllocatorParams{}, err
+	}
+	maskSizeOverrides, err := ipam.ParseNodeCIDRMaskSizeOverrides(o.NodeCIDRMaskSizeOverrides)
+	if err != nil {
+		return ipam.CIDRAllocatorParams{}, err
+	}
+	return ipam.CIDRAllocatorParams{
+		PodRangeSelection:          podRanges,
+		LeakReconcilePeriod:        o.CIDRLeakReconcilePeriod,
+		AdditionalClusterCIDRs:     blocks,
+		NodeCIDRMaskSizeOverrides:  maskSizeOverrides,
+		IPv6Only:                   o.IPv6Only,
+		PodRangeExpansion:          o.PodRangeExpansion,
+		ExternalIPAMURL:            o.ExternalIPAMURL,
+		ExternalIPAMTimeout:        o.ExternalIPAMTimeout,
+		ExternalIPAMCAFile:         o.ExternalIPAMCAFile,
+		ExternalIPAMClientCertFile: o.ExternalIPAMClientCertFile,
+		ExternalIPAMClientKeyFile:  o.ExternalIPAMClientKeyFile,
+		ExternalIPAMTokenFile:      o.ExternalIPAMTokenFile,
+
+		PodRangePreallocationMaskSize: o.PodRangePreallocationMaskSize,
+	}, nil
+}
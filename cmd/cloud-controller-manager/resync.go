@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/informers"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/app/config"
+	"k8s.io/cloud-provider/names"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+)
+
+// nodeResyncPeriod is the resync period of the Node informer of the cloud
+// node controller. The informers shared with the other controllers are used if
+// zero.
+var nodeResyncPeriod time.Duration
+
+// controllerResyncPeriods maps the controllers which can use informers of
+// their own to their resync period. The service controller, which has its
+// own flags, is started by startServiceControllerWrapper. The route
+// controller reconciles every --route-reconciliation-period whatever its
+// informer, so it has no resync period.
+var controllerResyncPeriods = map[string]*time.Duration{
+	names.CloudNodeController: &nodeResyncPeriod,
+}
+
+// validateResyncPeriods checks the resync and reconcile periods by flag name.
+func validateResyncPeriods(periods map[string]time.Duration) error {
+	flags := make([]string, 0, len(periods))
+	for flag := range periods {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		if periods[flag] < 0 {
+			return fmt.Errorf("--%s must not be negative, got %v", flag, periods[flag])
+		}
+	}
+	return nil
+}
+
+// withResyncPeriod wraps the constructor of the named controller so that, if
+// *period is not zero, the controller uses informers of its own resynced
+// every *period instead of the shared informers.
+func withResyncPeriod(name string, period *time.Duration, constructor app.InitFuncConstructor) app.InitFuncConstructor {
+	return func(initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+		if *period == 0 {
+			return constructor(initContext, completedConfig, cloud)
+		}
+		client := completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName)
+		factory := informers.NewSharedInformerFactory(client, *period)
+		c := *completedConfig.Config
+		c.SharedInformers = factory
+		initFunc := constructor(initContext, c.Complete(), cloud)
+		return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+			ctrl, started, err := initFunc(ctx, controllerContext)
+			if err != nil || !started {
+				return ctrl, started, err
+			}
+			klog.Infof("Starting the informers of the %s controller with a resync period of %v", name, *period)
+			factory.Start(ctx.Done())
+			return ctrl, started, err
+		}
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/app/config"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+)
+
+func TestValidateResyncPeriods(t *testing.T) {
+	if err := validateResyncPeriods(map[string]time.Duration{"service-reconcile-period": time.Hour, "node-resync-period": 0}); err != nil {
+		t.Errorf("validateResyncPeriods() = %v, want nil", err)
+	}
+	if err := validateResyncPeriods(map[string]time.Duration{"node-resync-period": -time.Second}); err == nil {
+		t.Errorf("validateResyncPeriods() = nil, want error for a negative period")
+	}
+}
+
+// fakeClientBuilder builds the clients of the controllers from a fake
+// clientset.
+type fakeClientBuilder struct {
+	client clientset.Interface
+}
+
+func (b fakeClientBuilder) Config(string) (*restclient.Config, error) {
+	return &restclient.Config{}, nil
+}
+func (b fakeClientBuilder) ConfigOrDie(string) *restclient.Config      { return &restclient.Config{} }
+func (b fakeClientBuilder) Client(string) (clientset.Interface, error) { return b.client, nil }
+func (b fakeClientBuilder) ClientOrDie(string) clientset.Interface     { return b.client }
+
+func TestWithResyncPeriod(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	shared := informers.NewSharedInformerFactory(client, 0)
+	completedConfig := (&config.Config{ClientBuilder: fakeClientBuilder{client}, SharedInformers: shared}).Complete()
+
+	for _, period := range []time.Duration{0, time.Minute} {
+		var got informers.SharedInformerFactory
+		constructor := func(initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+			got = completedConfig.SharedInformers
+			// Like the controllers, get the informer before the factory
+			// starts.
+			got.Core().V1().Nodes().Informer()
+			return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+				return nil, true, nil
+			}
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		initFunc := withResyncPeriod("route", &period, constructor)(app.ControllerInitContext{ClientName: "route-controller"}, completedConfig, nil)
+		if _, started, err := initFunc(ctx, genericcontrollermanager.ControllerContext{}); err != nil || !started {
+			t.Fatalf("initFunc() = %t, %v, want started", started, err)
+		}
+		if period == 0 {
+			if got != shared {
+				t.Errorf("Controller got informers of its own without a resync period")
+			}
+		} else {
+			if got == shared {
+				t.Errorf("Controller got the shared informers with a resync period of %v", period)
+			}
+			if !cache.WaitForCacheSync(ctx.Done(), got.Core().V1().Nodes().Informer().HasSynced) {
+				t.Errorf("Informers of the controller not started")
+			}
+		}
+		cancel()
+		got.Shutdown()
+	}
+}
+
+// recordingHandler records the events delivered to it.
+type recordingHandler struct {
+	adds, updates int
+}
+
+func (h *recordingHandler) OnAdd(obj interface{}, isInInitialList bool) { h.adds++ }
+func (h *recordingHandler) OnUpdate(oldObj, newObj interface{})         { h.updates++ }
+func (h *recordingHandler) OnDelete(obj interface{})                    {}
+
+func TestResyncAsAddHandler(t *testing.T) {
+	h := &recordingHandler{}
+	handler := resyncAsAddHandler{h}
+	svc := func(resourceVersion string) *v1.Service {
+		return &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", ResourceVersion: resourceVersion}}
+	}
+
+	// A resync is delivered as an addition.
+	handler.OnUpdate(svc("1"), svc("1"))
+	if h.adds != 1 || h.updates != 0 {
+		t.Errorf("Resync delivered as %d additions and %d updates, want 1 addition", h.adds, h.updates)
+	}
+	// A change is delivered as an update.
+	handler.OnUpdate(svc("1"), svc("2"))
+	if h.adds != 1 || h.updates != 1 {
+		t.Errorf("Change delivered as %d additions and %d updates, want 1 update", h.adds-1, h.updates)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	netutils "k8s.io/utils/net"
+)
+
+// routePlanEndpoint makes every replica serve the route creations and
+// deletions the route controller would perform on /debug/routes, so that they
+// can be reviewed before the controller is enabled in a cluster whose routes
+// were created by other means.
+var routePlanEndpoint bool
+
+// Reasons of the planned route changes.
+const (
+	// routeReasonNewNode is given for the routes of a node that has no route yet.
+	routeReasonNewNode = "NewNode"
+	// routeReasonDeletedNode is given for the routes of a node that does not
+	// exist or has no pod CIDR.
+	routeReasonDeletedNode = "DeletedNode"
+	// routeReasonCIDRMismatch is given for the routes whose destination does
+	// not match the pod CIDRs of their node, and for the missing routes of a
+	// node that has other routes.
+	routeReasonCIDRMismatch = "CIDRMismatch"
+	// routeReasonNodeAddressesChanged is given for the routes that are
+	// recreated because the addresses of their node changed.
+	routeReasonNodeAddressesChanged = "NodeAddressesChanged"
+	// routeReasonBlackhole is given for the routes whose next hop is gone.
+	routeReasonBlackhole = "Blackhole"
+)
+
+// routePlanner computes the route changes the route controller would make,
+// following the same rules, without making them.
+type routePlanner struct {
+	routes       cloudprovider.Routes
+	clusterName  string
+	clusterCIDRs []*net.IPNet
+	nodes        corelisters.NodeLister
+	nodesSynced  cache.InformerSynced
+}
+
+// plannedRouteChange is a route creation or deletion in a routePlan.
+type plannedRouteChange struct {
+	Name            string `json:"name,omitempty"`
+	TargetNode      string `json:"targetNode"`
+	DestinationCIDR string `json:"destinationCIDR"`
+	Reason          string `json:"reason"`
+}
+
+// routePlan is the response of the /debug/routes endpoint.
+type routePlan struct {
+	Synced    bool                 `json:"synced"`
+	Creations []plannedRouteChange `json:"creations"`
+	Deletions []plannedRouteChange `json:"deletions"`
+}
+
+// newRoutePlanner starts the Node informer of the shared informer factory the
+// controllers are started with, which is idempotent, and returns a planner of
+// the routes of the given cluster CIDRs, e.g. "10.0.0.0/14".
+func newRoutePlanner(routes cloudprovider.Routes, clusterName, clusterCIDRs string, factory informers.SharedInformerFactory, stopCh <-chan struct{}) (*routePlanner, error) {
+	cidrs, _, err := processCIDRs(clusterCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	nodes := factory.Core().V1().Nodes()
+	p := &routePlanner{
+		routes:       routes,
+		clusterName:  clusterName,
+		clusterCIDRs: cidrs,
+		nodes:        nodes.Lister(),
+		nodesSynced:  nodes.Informer().HasSynced,
+	}
+	factory.Start(stopCh)
+	return p, nil
+}
+
+func (p *routePlanner) plan(ctx context.Context) (*routePlan, error) {
+	routes, err := p.routes.ListRoutes(ctx, p.clusterName)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := p.nodes.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	plan := planRoutes(nodes, routes, p.clusterCIDRs)
+	plan.Synced = p.nodesSynced()
+	return plan, nil
+}
+
+// planRoutes returns the routes the route controller would delete and create
+// to reconcile routes with nodes.
+func planRoutes(nodes []*v1.Node, routes []*cloudprovider.Route, clusterCIDRs []*net.IPNet) *routePlan {
+	nodeRoutes := map[types.NodeName][]*cloudprovider.Route{}
+	for _, route := range routes {
+		if route.TargetNode != "" {
+			nodeRoutes[route.TargetNode] = append(nodeRoutes[route.TargetNode], route)
+		}
+	}
+	// The pod CIDRs of the nodes mapped to the reason their route has to be
+	// created, or to "" if it is up to date.
+	nodeCIDRs := map[types.NodeName]map[string]string{}
+	for _, node := range nodes {
+		name := types.NodeName(node.Name)
+		for _, podCIDR := range node.Spec.PodCIDRs {
+			if nodeCIDRs[name] == nil {
+				nodeCIDRs[name] = map[string]string{}
+			}
+			nodeCIDRs[name][podCIDR] = routeCreationReason(nodeRoutes[name], podCIDR, node.Status.Addresses)
+		}
+	}
+
+	plan := &routePlan{Creations: []plannedRouteChange{}, Deletions: []plannedRouteChange{}}
+	for _, route := range routes {
+		if !routeInClusterCIDRs(route, clusterCIDRs) {
+			continue
+		}
+		reason := ""
+		cidrs, nodeExists := nodeCIDRs[route.TargetNode]
+		creationReason, cidrExists := cidrs[route.DestinationCIDR]
+		switch {
+		case route.Blackhole:
+			reason = routeReasonBlackhole
+		case !nodeExists:
+			reason = routeReasonDeletedNode
+		case !cidrExists:
+			reason = routeReasonCIDRMismatch
+		case creationReason == routeReasonNodeAddressesChanged:
+			reason = routeReasonNodeAddressesChanged
+		default:
+			continue
+		}
+		plan.Deletions = append(plan.Deletions, plannedRouteChange{
+			Name:            route.Name,
+			TargetNode:      string(route.TargetNode),
+			DestinationCIDR: route.DestinationCIDR,
+			Reason:          reason,
+		})
+	}
+	for name, cidrs := range nodeCIDRs {
+		for cidr, reason := range cidrs {
+			if reason != "" {
+				plan.Creations = append(plan.Creations, plannedRouteChange{
+					TargetNode:      string(name),
+					DestinationCIDR: cidr,
+					Reason:          reason,
+				})
+			}
+		}
+	}
+	sort.Slice(plan.Deletions, func(i, j int) bool {
+		return plan.Deletions[i].Name < plan.Deletions[j].Name
+	})
+	sort.Slice(plan.Creations, func(i, j int) bool {
+		a, b := plan.Creations[i], plan.Creations[j]
+		return a.TargetNode < b.TargetNode || a.TargetNode == b.TargetNode && a.DestinationCIDR < b.DestinationCIDR
+	})
+	return plan
+}
+
+// routeCreationReason returns why the route of a node pod CIDR has to be
+// created, or "" if the node already has an up to date route for it.
+func routeCreationReason(routes []*cloudprovider.Route, podCIDR string, nodeAddrs []v1.NodeAddress) string {
+	for _, route := range routes {
+		if route.DestinationCIDR != podCIDR {
+			continue
+		}
+		if route.EnableNodeAddresses && !equalNodeAddresses(route.TargetNodeAddresses, nodeAddrs) {
+			return routeReasonNodeAddressesChanged
+		}
+		return ""
+	}
+	if len(routes) == 0 {
+		return routeReasonNewNode
+	}
+	return routeReasonCIDRMismatch
+}
+
+func equalNodeAddresses(a, b []v1.NodeAddress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, addrA := range a {
+		found := false
+		for _, addrB := range b {
+			if reflect.DeepEqual(addrA, addrB) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// routeInClusterCIDRs returns whether the route controller is responsible for
+// the route, that is whether its destination overlaps a cluster CIDR.
+func routeInClusterCIDRs(route *cloudprovider.Route, clusterCIDRs []*net.IPNet) bool {
+	_, cidr, err := netutils.ParseCIDRSloppy(route.DestinationCIDR)
+	if err != nil {
+		return false
+	}
+	lastIP := make([]byte, len(cidr.IP))
+	for i := range lastIP {
+		lastIP[i] = cidr.IP[i] | ^cidr.Mask[i]
+	}
+	for _, clusterCIDR := range clusterCIDRs {
+		if clusterCIDR.Contains(cidr.IP) || clusterCIDR.Contains(lastIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP serves the route plan as JSON.
+func (p *routePlanner) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	plan, err := p.plan(req.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
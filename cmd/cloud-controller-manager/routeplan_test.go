@@ -0,0 +1,152 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+type fakeRoutes struct {
+	routes []*cloudprovider.Route
+}
+
+func (f *fakeRoutes) ListRoutes(context.Context, string) ([]*cloudprovider.Route, error) {
+	return f.routes, nil
+}
+
+func (f *fakeRoutes) CreateRoute(context.Context, string, string, *cloudprovider.Route) error {
+	panic("the route planner must not create routes")
+}
+
+func (f *fakeRoutes) DeleteRoute(context.Context, string, *cloudprovider.Route) error {
+	panic("the route planner must not delete routes")
+}
+
+func routePlanNode(name string, podCIDRs ...string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{PodCIDRs: podCIDRs},
+	}
+}
+
+func TestPlanRoutes(t *testing.T) {
+	clusterCIDRs, _, err := processCIDRs("10.0.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.5"}}
+	movedNode := routePlanNode("node-moved", "10.0.5.0/24")
+	movedNode.Status.Addresses = addrs
+	nodes := []*v1.Node{
+		routePlanNode("node-ok", "10.0.1.0/24"),
+		routePlanNode("node-new", "10.0.2.0/24"),
+		routePlanNode("node-changed", "10.0.3.0/24"),
+		routePlanNode("node-no-cidr"),
+		movedNode,
+	}
+	routes := []*cloudprovider.Route{
+		{Name: "r-ok", TargetNode: "node-ok", DestinationCIDR: "10.0.1.0/24"},
+		{Name: "r-changed", TargetNode: "node-changed", DestinationCIDR: "10.0.30.0/24"},
+		{Name: "r-deleted", TargetNode: "node-deleted", DestinationCIDR: "10.0.4.0/24"},
+		{Name: "r-no-cidr", TargetNode: "node-no-cidr", DestinationCIDR: "10.0.6.0/24"},
+		{Name: "r-blackhole", TargetNode: "node-ok", DestinationCIDR: "10.0.7.0/24", Blackhole: true},
+		{Name: "r-moved", TargetNode: "node-moved", DestinationCIDR: "10.0.5.0/24", EnableNodeAddresses: true},
+		{Name: "r-other", TargetNode: "node-deleted", DestinationCIDR: "172.16.0.0/24"},
+	}
+
+	plan := planRoutes(nodes, routes, clusterCIDRs)
+
+	wantDeletions := []plannedRouteChange{
+		{Name: "r-blackhole", TargetNode: "node-ok", DestinationCIDR: "10.0.7.0/24", Reason: routeReasonBlackhole},
+		{Name: "r-changed", TargetNode: "node-changed", DestinationCIDR: "10.0.30.0/24", Reason: routeReasonCIDRMismatch},
+		{Name: "r-deleted", TargetNode: "node-deleted", DestinationCIDR: "10.0.4.0/24", Reason: routeReasonDeletedNode},
+		{Name: "r-moved", TargetNode: "node-moved", DestinationCIDR: "10.0.5.0/24", Reason: routeReasonNodeAddressesChanged},
+		{Name: "r-no-cidr", TargetNode: "node-no-cidr", DestinationCIDR: "10.0.6.0/24", Reason: routeReasonDeletedNode},
+	}
+	if !reflect.DeepEqual(plan.Deletions, wantDeletions) {
+		t.Errorf("deletions: got %+v, want %+v", plan.Deletions, wantDeletions)
+	}
+	wantCreations := []plannedRouteChange{
+		{TargetNode: "node-changed", DestinationCIDR: "10.0.3.0/24", Reason: routeReasonCIDRMismatch},
+		{TargetNode: "node-moved", DestinationCIDR: "10.0.5.0/24", Reason: routeReasonNodeAddressesChanged},
+		{TargetNode: "node-new", DestinationCIDR: "10.0.2.0/24", Reason: routeReasonNewNode},
+	}
+	if !reflect.DeepEqual(plan.Creations, wantCreations) {
+		t.Errorf("creations: got %+v, want %+v", plan.Creations, wantCreations)
+	}
+}
+
+func TestRoutePlanEndpoint(t *testing.T) {
+	defer func(old *healthProbes) { probes = old }(probes)
+	probes = &healthProbes{}
+
+	client := fake.NewSimpleClientset(routePlanNode("node-1", "10.0.1.0/24"))
+	factory := informers.NewSharedInformerFactory(client, 0)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	routes := &fakeRoutes{routes: []*cloudprovider.Route{
+		{Name: "r-2", TargetNode: types.NodeName("node-2"), DestinationCIDR: "10.0.2.0/24"},
+	}}
+	planner, err := newRoutePlanner(routes, "cluster", "10.0.0.0/16", factory, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	probes.handle("/debug/routes", planner)
+
+	var plan routePlan
+	err = wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		rec := httptest.NewRecorder()
+		probes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/debug/routes got %d, want %d", rec.Code, http.StatusOK)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &plan); err != nil {
+			t.Fatalf("invalid /debug/routes response %q: %v", rec.Body.String(), err)
+		}
+		return plan.Synced, nil
+	})
+	if err != nil {
+		t.Fatalf("Node cache not synced: %v", err)
+	}
+	if len(plan.Creations) != 1 || plan.Creations[0].TargetNode != "node-1" || plan.Creations[0].Reason != routeReasonNewNode {
+		t.Errorf("got creations %+v, want a route for new node node-1", plan.Creations)
+	}
+	if len(plan.Deletions) != 1 || plan.Deletions[0].Name != "r-2" || plan.Deletions[0].Reason != routeReasonDeletedNode {
+		t.Errorf("got deletions %+v, want route r-2 of deleted node node-2", plan.Deletions)
+	}
+}
+
+func TestNewRoutePlannerInvalidClusterCIDR(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	if _, err := newRoutePlanner(&fakeRoutes{}, "cluster", "", factory, wait.NeverStop); err == nil {
+		t.Error("expected an error for an empty cluster CIDR")
+	}
+}
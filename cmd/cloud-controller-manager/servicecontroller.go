@@ -0,0 +1,179 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/cloud-provider/app"
+	"k8s.io/cloud-provider/app/config"
+	servicecontroller "k8s.io/cloud-provider/controllers/service"
+	genericcontrollermanager "k8s.io/controller-manager/app"
+	"k8s.io/controller-manager/controller"
+	"k8s.io/klog/v2"
+)
+
+// serviceResyncPeriod is the resync period of the Service and Node informers
+// of the service controller. The informers shared with the other controllers,
+// resynced every --min-resync-period, are used if zero.
+var serviceResyncPeriod time.Duration
+
+// validateServiceControllerFlags checks the number of load balancers the
+// service controller reconciles concurrently, set with
+// --concurrent-service-syncs, and its resync period.
+func validateServiceControllerFlags(concurrentServiceSyncs int32, resyncPeriod time.Duration) error {
+	if concurrentServiceSyncs < 1 {
+		return fmt.Errorf("--concurrent-service-syncs must be at least 1, got %d", concurrentServiceSyncs)
+	}
+	if resyncPeriod < 0 {
+		return fmt.Errorf("--service-resync-period must not be negative, got %v", resyncPeriod)
+	}
+	return nil
+}
+
+// serviceReconcilePeriod is how often the service controller reconciles the
+// load balancers of all the Services, even the unchanged ones. Only the
+// changed Services are reconciled if zero.
+var serviceReconcilePeriod time.Duration
+
+// startServiceControllerWrapper starts the upstream service controller with
+// --concurrent-service-syncs workers. If --service-resync-period is set, its
+// informers come from a dedicated informer factory resynced with that period.
+// If --service-reconcile-period is set, it reconciles all the Services with
+// that period. If the provider claims a LoadBalancerClass, the Services come
+// from a dedicated informer factory presenting the claimed Services as
+// Services without a class, the only ones the upstream controller syncs.
+func startServiceControllerWrapper(initContext app.ControllerInitContext, completedConfig *config.CompletedConfig, cloud cloudprovider.Interface) app.InitFunc {
+	var loadBalancerClass string
+	if gceCloud, ok := cloud.(*gce.Cloud); ok {
+		loadBalancerClass = gceCloud.LoadBalancerClass()
+	}
+	if serviceResyncPeriod == 0 && serviceReconcilePeriod == 0 && loadBalancerClass == "" {
+		return app.StartServiceControllerWrapper(initContext, completedConfig, cloud)
+	}
+	return func(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext) (controller.Interface, bool, error) {
+		client := completedConfig.ClientBuilder.ClientOrDie(initContext.ClientName)
+		factory := completedConfig.SharedInformers
+		if serviceResyncPeriod != 0 {
+			factory = informers.NewSharedInformerFactory(client, serviceResyncPeriod)
+		}
+		servicesFactory := factory
+		if loadBalancerClass != "" {
+			servicesFactory = informers.NewSharedInformerFactoryWithOptions(client, serviceResyncPeriod, informers.WithTransform(claimLoadBalancerClass(loadBalancerClass)))
+		}
+		var services coreinformers.ServiceInformer = servicesFactory.Core().V1().Services()
+		if serviceReconcilePeriod != 0 {
+			services = reconcilingServiceInformer{ServiceInformer: services, period: serviceReconcilePeriod}
+		}
+		serviceController, err := servicecontroller.New(
+			cloud,
+			client,
+			services,
+			factory.Core().V1().Nodes(),
+			completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+			utilfeature.DefaultFeatureGate,
+		)
+		if err != nil {
+			// Like upstream, this does not fail the controller manager.
+			klog.Errorf("Failed to start service controller: %v", err)
+			return nil, false, nil
+		}
+		if serviceResyncPeriod != 0 {
+			factory.Start(ctx.Done())
+		}
+		if loadBalancerClass != "" {
+			servicesFactory.Start(ctx.Done())
+		}
+
+		workers := int(completedConfig.ComponentConfig.ServiceController.ConcurrentServiceSyncs)
+		klog.Infof("Starting service controller with %d workers, a resync period of %v, a reconcile period of %v and the claimed load balancer class %q", workers, serviceResyncPeriod, serviceReconcilePeriod, loadBalancerClass)
+		go serviceController.Run(ctx, workers, controllerContext.ControllerManagerMetrics)
+		return nil, true, nil
+	}
+}
+
+// claimLoadBalancerClass returns the transform of the Services of the service
+// controller clearing the LoadBalancerClass claimed by the provider, so that
+// the upstream controller, which only syncs the Services without a class,
+// syncs the claimed ones too. Its status and finalizer patches only carry the
+// changed fields, so the class of the Services is left untouched.
+func claimLoadBalancerClass(class string) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		svc, ok := obj.(*v1.Service)
+		if !ok || svc.Spec.LoadBalancerClass == nil || *svc.Spec.LoadBalancerClass != class {
+			return obj, nil
+		}
+		svc = svc.DeepCopy()
+		svc.Spec.LoadBalancerClass = nil
+		return svc, nil
+	}
+}
+
+// reconcilingServiceInformer makes the service controller reconcile all the
+// Services every period: the Services are redelivered to its event handlers
+// every period, as additions, since it ignores the updates which do not
+// change the Service.
+type reconcilingServiceInformer struct {
+	coreinformers.ServiceInformer
+	period time.Duration
+}
+
+// Informer implements coreinformers.ServiceInformer.
+func (i reconcilingServiceInformer) Informer() cache.SharedIndexInformer {
+	return reconcilingInformer{SharedIndexInformer: i.ServiceInformer.Informer(), period: i.period}
+}
+
+type reconcilingInformer struct {
+	cache.SharedIndexInformer
+	period time.Duration
+}
+
+// AddEventHandlerWithResyncPeriod implements cache.SharedIndexInformer.
+func (i reconcilingInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, _ time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	return i.SharedIndexInformer.AddEventHandlerWithResyncPeriod(resyncAsAddHandler{handler}, i.period)
+}
+
+// resyncAsAddHandler delivers the resyncs of the objects, which are updates
+// leaving their resource version unchanged, as additions.
+type resyncAsAddHandler struct {
+	cache.ResourceEventHandler
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (h resyncAsAddHandler) OnUpdate(oldObj, newObj interface{}) {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		h.ResourceEventHandler.OnUpdate(oldObj, newObj)
+		return
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil || oldMeta.GetResourceVersion() != newMeta.GetResourceVersion() {
+		h.ResourceEventHandler.OnUpdate(oldObj, newObj)
+		return
+	}
+	h.ResourceEventHandler.OnAdd(newObj, false)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestValidateServiceControllerFlags(t *testing.T) {
+	testCases := []struct {
+		desc                   string
+		concurrentServiceSyncs int32
+		resyncPeriod           time.Duration
+		wantErr                bool
+	}{
+		{
+			desc:                   "defaults",
+			concurrentServiceSyncs: 1,
+		},
+		{
+			desc:                   "many workers and a resync period",
+			concurrentServiceSyncs: 50,
+			resyncPeriod:           10 * time.Minute,
+		},
+		{
+			desc:                   "no workers",
+			concurrentServiceSyncs: 0,
+			wantErr:                true,
+		},
+		{
+			desc:                   "negative resync period",
+			concurrentServiceSyncs: 1,
+			resyncPeriod:           -time.Second,
+			wantErr:                true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateServiceControllerFlags(tc.concurrentServiceSyncs, tc.resyncPeriod)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("validateServiceControllerFlags(%d, %v) got error %v, want error %t", tc.concurrentServiceSyncs, tc.resyncPeriod, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestClaimLoadBalancerClass(t *testing.T) {
+	claimed, other := "gce.example.com/l4", "metallb.io/metallb"
+	transform := claimLoadBalancerClass(claimed)
+	for _, tc := range []struct {
+		desc      string
+		class     *string
+		wantClass *string
+	}{
+		{desc: "no class"},
+		{desc: "claimed class", class: &claimed},
+		{desc: "other class", class: &other, wantClass: &other},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &v1.Service{Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, LoadBalancerClass: tc.class}}
+			obj, err := transform(svc)
+			if err != nil {
+				t.Fatalf("claimLoadBalancerClass() got error %v", err)
+			}
+			got := obj.(*v1.Service).Spec.LoadBalancerClass
+			if (got == nil) != (tc.wantClass == nil) || (got != nil && *got != *tc.wantClass) {
+				t.Errorf("claimLoadBalancerClass() got class %v, want %v", got, tc.wantClass)
+			}
+			if svc.Spec.LoadBalancerClass != tc.class {
+				t.Errorf("claimLoadBalancerClass() modified the Service")
+			}
+		})
+	}
+}
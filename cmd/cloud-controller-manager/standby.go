@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// standbyWarmup makes every replica, including those waiting for the leader
+// election lease, start the informers of the cloud controllers and serve
+// read-only inspection endpoints, so that a new leader starts its controllers
+// on synced caches instead of listing the cluster after acquiring the lease.
+var standbyWarmup bool
+
+// cacheInspector serves a snapshot of the informer caches shared with the
+// controllers.
+type cacheInspector struct {
+	nodes       corelisters.NodeLister
+	services    corelisters.ServiceLister
+	nodesSynced cache.InformerSynced
+	svcsSynced  cache.InformerSynced
+}
+
+// cacheSnapshot is the response of the /debug/cache inspection endpoint.
+type cacheSnapshot struct {
+	Synced   bool `json:"synced"`
+	Nodes    int  `json:"nodes"`
+	Services int  `json:"services"`
+}
+
+// startStandbyWarmup starts the Node and Service informers of the shared
+// informer factory the controllers are started with, which is idempotent, and
+// returns an inspector of their caches. It is called by every replica.
+func startStandbyWarmup(factory informers.SharedInformerFactory, stopCh <-chan struct{}) *cacheInspector {
+	nodes := factory.Core().V1().Nodes()
+	services := factory.Core().V1().Services()
+	i := &cacheInspector{
+		nodes:       nodes.Lister(),
+		services:    services.Lister(),
+		nodesSynced: nodes.Informer().HasSynced,
+		svcsSynced:  services.Informer().HasSynced,
+	}
+	factory.Start(stopCh)
+	go func() {
+		if cache.WaitForCacheSync(stopCh, i.nodesSynced, i.svcsSynced) {
+			klog.Infof("Standby warm-up: Node and Service caches synced")
+		}
+	}()
+	return i
+}
+
+func (i *cacheInspector) snapshot() (*cacheSnapshot, error) {
+	s := &cacheSnapshot{Synced: i.nodesSynced() && i.svcsSynced()}
+	nodes, err := i.nodes.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	services, err := i.services.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	s.Nodes = len(nodes)
+	s.Services = len(services)
+	return s, nil
+}
+
+// ServeHTTP serves the cache snapshot as JSON.
+func (i *cacheInspector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s, err := i.snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStandbyWarmup(t *testing.T) {
+	defer func(old *healthProbes) { probes = old }(probes)
+	probes = &healthProbes{}
+
+	client := fake.NewSimpleClientset(
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc"}},
+	)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	probes.handle("/debug/cache", startStandbyWarmup(factory, stopCh))
+
+	var snapshot cacheSnapshot
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		rec := httptest.NewRecorder()
+		probes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cache", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/debug/cache got %d, want %d", rec.Code, http.StatusOK)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+			t.Fatalf("invalid /debug/cache response %q: %v", rec.Body.String(), err)
+		}
+		return snapshot.Synced, nil
+	})
+	if err != nil {
+		t.Fatalf("caches not synced: %v", err)
+	}
+	if want := (cacheSnapshot{Synced: true, Nodes: 2, Services: 1}); snapshot != want {
+		t.Errorf("/debug/cache got %+v, want %+v", snapshot, want)
+	}
+
+	// The health probes are still served along the inspection endpoints.
+	rec := httptest.NewRecorder()
+	probes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz got %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/component-base/tracing"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
+)
+
+// tracingEndpoint is the OTLP gRPC endpoint the spans of the service, route,
+// node and node IPAM syncs and of their GCE API calls are exported to.
+// Tracing is disabled if empty.
+var tracingEndpoint string
+
+// tracingSamplingRatePerMillion is the number of syncs traced per million.
+var tracingSamplingRatePerMillion int32
+
+// tracingServiceName is the name the spans are exported under.
+const tracingServiceName = "cloud-controller-manager"
+
+// setupTracing makes the global OpenTelemetry tracer provider, used by the
+// cloud provider and the controllers, export the sampled spans to endpoint
+// over OTLP, if endpoint is not empty.
+func setupTracing(ctx context.Context, endpoint string, samplingRatePerMillion int32) error {
+	if endpoint == "" {
+		return nil
+	}
+	config := &tracingapi.TracingConfiguration{
+		Endpoint:               &endpoint,
+		SamplingRatePerMillion: &samplingRatePerMillion,
+	}
+	if errs := tracingapi.ValidateTracingConfiguration(config, nil, field.NewPath("tracing")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	tp, err := tracing.NewProvider(ctx, config, nil, []resource.Option{
+		resource.WithHost(),
+		resource.WithAttributes(semconv.ServiceName(tracingServiceName)),
+	})
+	if err != nil {
+		return err
+	}
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(tracing.Propagators())
+	return nil
+}
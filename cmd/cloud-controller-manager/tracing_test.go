@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetupTracing(t *testing.T) {
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	testCases := []struct {
+		desc         string
+		endpoint     string
+		samplingRate int32
+		wantErr      bool
+	}{
+		{
+			desc: "disabled",
+		},
+		{
+			desc:         "enabled",
+			endpoint:     "localhost:4317",
+			samplingRate: 1000,
+		},
+		{
+			desc:         "invalid sampling rate",
+			endpoint:     "localhost:4317",
+			samplingRate: 2000000,
+			wantErr:      true,
+		},
+		{
+			desc:     "invalid endpoint",
+			endpoint: "http://localhost:4317/path",
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := setupTracing(context.Background(), tc.endpoint, tc.samplingRate)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("setupTracing() = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+)
+
+// configCheck is the outcome of a check of the cloud config in a
+// configValidation.
+type configCheck struct {
+	Field       string `json:"field"`
+	Passed      bool   `json:"passed"`
+	Error       string `json:"error,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// configValidation is the report printed by the validate-config subcommand.
+type configValidation struct {
+	ConfigFile string        `json:"configFile"`
+	Valid      bool          `json:"valid"`
+	Checks     []configCheck `json:"checks"`
+}
+
+// configDiagnoser is implemented by cloud providers which can check their
+// config against the cloud.
+type configDiagnoser interface {
+	DiagnoseConfig(ctx context.Context) []gce.ConfigDiagnostic
+}
+
+// newValidateConfigCommand returns the validate-config subcommand, which
+// parses and validates a cloud config and checks it against GCE, and prints
+// the outcome as JSON for CI to gate changes of the config on.
+func newValidateConfigCommand() *cobra.Command {
+	var cloudConfigFile string
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "validate-config",
+		Short: "Validate a cloud config against GCE",
+		Long: `Parse the cloud config, check the values of its fields, and check that the
+credentials work, that the project, network, subnetwork, secondary range and
+zone exist, and that some instance has the node tags. Prints the outcome of
+each check as JSON, and exits with a non-zero status if any check fails.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cloudConfigFile == "" {
+				return errors.New("--cloud-config is required")
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			report := validateConfig(ctx, cloudConfigFile, initConfigDiagnoser)
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			if !report.Valid {
+				return errors.New("invalid cloud config")
+			}
+			return nil
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&cloudConfigFile, "cloud-config", "", "The path to the cloud provider configuration file to validate.")
+	fs.DurationVar(&timeout, "timeout", time.Minute, "How long the checks may take.")
+	// The root command prints the sections of its own flags.
+	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n  %s\n\nFlags:\n%s", cmd.UseLine(), cmd.LocalFlags().FlagUsages())
+		return nil
+	})
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\nUsage:\n  %s\n\nFlags:\n%s", cmd.Long, cmd.UseLine(), cmd.LocalFlags().FlagUsages())
+	})
+	return cmd
+}
+
+// initConfigDiagnoser initializes the GCE cloud provider from the config.
+func initConfigDiagnoser(config io.Reader) (configDiagnoser, error) {
+	cloud, err := cloudprovider.GetCloudProvider(gce.ProviderName, config)
+	if err != nil {
+		return nil, err
+	}
+	if cloud == nil {
+		return nil, fmt.Errorf("cloud provider %q is not registered", gce.ProviderName)
+	}
+	d, ok := cloud.(configDiagnoser)
+	if !ok {
+		return nil, fmt.Errorf("cloud provider %q does not support config validation", cloud.ProviderName())
+	}
+	return d, nil
+}
+
+// validateConfig checks the cloud config file in stages, each run only if the
+// previous one passed: parsing and validating its fields, initializing the
+// cloud provider, and checking the config against GCE.
+func validateConfig(ctx context.Context, path string, initDiagnoser func(io.Reader) (configDiagnoser, error)) *configValidation {
+	report := &configValidation{ConfigFile: path, Valid: true}
+	add := func(field string, err error, remediation string) {
+		check := configCheck{Field: field, Passed: err == nil}
+		if err != nil {
+			report.Valid = false
+			check.Error = err.Error()
+			check.Remediation = remediation
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = gce.ValidateConfig(bytes.NewReader(data))
+	}
+	add("config", err, "Fix the syntax or the invalid values of the cloud config.")
+	if err != nil {
+		return report
+	}
+	d, err := initDiagnoser(bytes.NewReader(data))
+	add("cloud-provider", err, "Check the credentials, project-id and network-name of the cloud config.")
+	if err != nil {
+		return report
+	}
+	for _, diag := range d.DiagnoseConfig(ctx) {
+		add(diag.Field, diag.Err, diag.Remediation)
+	}
+	return report
+}
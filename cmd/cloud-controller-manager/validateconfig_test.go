@@ -0,0 +1,119 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/cloud-provider-gcp/providers/gce"
+)
+
+func TestValidateConfig(t *testing.T) {
+	// The token-url skips the detection of the metadata server.
+	const validConfig = `[global]
+token-url = nil
+project-id = my-project
+network-name = my-network
+local-zone = us-central1-a
+`
+	testCases := []struct {
+		desc       string
+		config     string
+		diagnoser  *fakeDiagnoser
+		initErr    error
+		wantValid  bool
+		wantChecks []configCheck
+	}{
+		{
+			desc:      "valid config",
+			config:    validConfig,
+			diagnoser: &fakeDiagnoser{config: []gce.ConfigDiagnostic{{Field: "network-name"}}},
+			wantValid: true,
+			wantChecks: []configCheck{
+				{Field: "config", Passed: true},
+				{Field: "cloud-provider", Passed: true},
+				{Field: "network-name", Passed: true},
+			},
+		},
+		{
+			desc:   "syntax error",
+			config: "[global\n",
+			wantChecks: []configCheck{
+				{Field: "config", Passed: false},
+			},
+		},
+		{
+			desc:    "cloud provider initialization failure",
+			config:  validConfig,
+			initErr: errors.New("network not found"),
+			wantChecks: []configCheck{
+				{Field: "config", Passed: true},
+				{Field: "cloud-provider", Passed: false, Error: "network not found"},
+			},
+		},
+		{
+			desc:   "failed check",
+			config: validConfig,
+			diagnoser: &fakeDiagnoser{config: []gce.ConfigDiagnostic{
+				{Field: "node-tags", Err: errors.New("no instance has tags"), Remediation: "Set node-tags."},
+			}},
+			wantChecks: []configCheck{
+				{Field: "config", Passed: true},
+				{Field: "cloud-provider", Passed: true},
+				{Field: "node-tags", Passed: false, Error: "no instance has tags"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gce.conf")
+			if err := os.WriteFile(path, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			initDiagnoser := func(io.Reader) (configDiagnoser, error) {
+				if tc.initErr != nil {
+					return nil, tc.initErr
+				}
+				return tc.diagnoser, nil
+			}
+			report := validateConfig(context.Background(), path, initDiagnoser)
+			if report.Valid != tc.wantValid {
+				t.Errorf("Valid = %v, want %v", report.Valid, tc.wantValid)
+			}
+			// The errors of the config parser and the remediations are not
+			// compared.
+			for i, check := range report.Checks {
+				if !check.Passed && check.Remediation == "" {
+					t.Errorf("No remediation for failed check %s", check.Field)
+				}
+				if check.Field == "config" {
+					report.Checks[i].Error = ""
+				}
+				report.Checks[i].Remediation = ""
+			}
+			if !reflect.DeepEqual(report.Checks, tc.wantChecks) {
+				t.Errorf("Checks = %+v, want %+v", report.Checks, tc.wantChecks)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	capi "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"k8s.io/klog/v2"
+	certutil "k8s.io/kubernetes/pkg/apis/certificates/v1"
+	"k8s.io/kubernetes/pkg/controller/certificates"
+)
+
+const (
+	// casBasePath is the endpoint of the Certificate Authority Service API.
+	casBasePath = "https://privateca.googleapis.com/v1/"
+	// casMaxResponseBytes bounds the size of responses read from the
+	// Certificate Authority Service API.
+	casMaxResponseBytes = 1024 * 1024
+)
+
+// casPoolRegexp matches the resource names of CA pools.
+var casPoolRegexp = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/caPools/[^/]+$`)
+
+// casCertificate is the subset of the Certificate resource of the Certificate
+// Authority Service API used to issue certificates.
+type casCertificate struct {
+	PemCSR              string   `json:"pemCsr,omitempty"`
+	Lifetime            string   `json:"lifetime,omitempty"`
+	PemCertificate      string   `json:"pemCertificate,omitempty"`
+	PemCertificateChain []string `json:"pemCertificateChain,omitempty"`
+}
+
+// parseCASSignerPools validates the CA pools signing the CSRs of each signer
+// name, as projects/PROJECT/locations/LOCATION/caPools/POOL.
+func parseCASSignerPools(pools map[string]string) (map[string]string, error) {
+	for signerName, pool := range pools {
+		if signerName == "" {
+			return nil, fmt.Errorf("empty signer name for CA pool %q", pool)
+		}
+		if !casPoolRegexp.MatchString(pool) {
+			return nil, fmt.Errorf("invalid CA pool %q for signer name %q, must be projects/PROJECT/locations/LOCATION/caPools/POOL", pool, signerName)
+		}
+	}
+	return pools, nil
+}
+
+// casSigner signs the approved CSRs of the configured signer names with
+// Certificate Authority Service CA pools rather than the cluster CA, so that
+// their issuing CAs can be kept in an HSM-backed managed service.
+type casSigner struct {
+	ctx        *controllerContext
+	client     *http.Client
+	basePath   string
+	validators []csrValidator
+}
+
+func newCASSigner(ctx *controllerContext) *casSigner {
+	return &casSigner{
+		ctx:        ctx,
+		client:     ctx.gcpCfg.HTTPClient,
+		basePath:   casBasePath,
+		validators: csrValidators(),
+	}
+}
+
+// handle is called by the generic Kubernetes certificate controller.
+func (s *casSigner) handle(ctx context.Context, csr *capi.CertificateSigningRequest) error {
+	if !certificates.IsCertificateRequestApproved(csr) || len(csr.Status.Certificate) != 0 {
+		return nil
+	}
+	pool, ok := s.ctx.casSignerPools[csr.Spec.SignerName]
+	if !ok {
+		return nil
+	}
+
+	klog.Infof("casSigner triggered for %q", csr.Name)
+
+	recordMetric := csrmetrics.SigningStartRecorder(authFlowLabelNone)
+	x509cr, err := certutil.ParseCSR(csr.Spec.Request)
+	if err != nil {
+		recordMetric(csrmetrics.SigningStatusParseError)
+		return fmt.Errorf("unable to parse csr %q: %v", csr.Name, err)
+	}
+	recordMetric = csrmetrics.SigningStartRecorder(metricLabel(s.validators, csr, x509cr))
+	cert, err := s.sign(ctx, pool, csr)
+	if err != nil {
+		recordMetric(csrmetrics.SigningStatusSignError)
+		klog.V(2).Infof("error signing csr %q with CA pool %q: %v", csr.Name, pool, err)
+		s.ctx.recorder.Eventf(csr, v1.EventTypeWarning, "SigningError", "error while calling Certificate Authority Service: %v", err)
+		return fmt.Errorf("error signing csr %q with CA pool %q: %v", csr.Name, pool, err)
+	}
+	csr = csr.DeepCopy()
+	csr.Status.Certificate = cert
+	updateRecordMetric := csrmetrics.OutboundRPCStartRecorder("k8s.CertificateSigningRequests.updateStatus")
+	if _, err := s.ctx.client.CertificatesV1().CertificateSigningRequests().UpdateStatus(ctx, csr, metav1.UpdateOptions{}); err != nil {
+		updateRecordMetric(csrmetrics.OutboundRPCStatusError)
+		recordMetric(csrmetrics.SigningStatusUpdateError)
+		return fmt.Errorf("error updating signature for csr: %v", err)
+	}
+	updateRecordMetric(csrmetrics.OutboundRPCStatusOK)
+	klog.Infof("CSR %q signed by CA pool %q", csr.Name, pool)
+	recordMetric(csrmetrics.SigningStatusSigned)
+	return nil
+}
+
+// sign issues the certificate of the CSR from the CA pool, returning it
+// followed by its chain. The certificate is named after the UID of the CSR,
+// so that a CSR whose certificate was issued but not stored in its status is
+// not issued another one.
+func (s *casSigner) sign(ctx context.Context, pool string, csr *capi.CertificateSigningRequest) ([]byte, error) {
+	certificateID := "csr-" + string(csr.UID)
+	lifetime := s.ctx.casSignerCertificateDuration
+	if csr.Spec.ExpirationSeconds != nil {
+		if requested := time.Duration(*csr.Spec.ExpirationSeconds) * time.Second; requested < lifetime {
+			lifetime = requested
+		}
+	}
+	body, err := json.Marshal(casCertificate{
+		PemCSR:   string(csr.Spec.Request),
+		Lifetime: fmt.Sprintf("%ds", int64(lifetime/time.Second)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	createURL := s.basePath + pool + "/certificates?" + url.Values{"certificateId": {certificateID}, "requestId": {string(csr.UID)}}.Encode()
+	var cert casCertificate
+	err = s.call(ctx, "privateca.Certificates.Create", http.MethodPost, createURL, body, &cert)
+	if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusConflict {
+		klog.Infof("Certificate %q of CSR %q already issued by CA pool %q, getting it", certificateID, csr.Name, pool)
+		err = s.call(ctx, "privateca.Certificates.Get", http.MethodGet, s.basePath+pool+"/certificates/"+certificateID, nil, &cert)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cert.PemCertificate == "" {
+		return nil, fmt.Errorf("no certificate issued by CA pool %q", pool)
+	}
+
+	var pem bytes.Buffer
+	for _, c := range append([]string{cert.PemCertificate}, cert.PemCertificateChain...) {
+		pem.WriteString(c)
+		if !strings.HasSuffix(c, "\n") {
+			pem.WriteString("\n")
+		}
+	}
+	return pem.Bytes(), nil
+}
+
+func (s *casSigner) call(ctx context.Context, rpc, method, url string, body []byte, out *casCertificate) error {
+	recordMetric := csrmetrics.OutboundRPCStartRecorder(rpc)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return err
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return err
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, casMaxResponseBytes)).Decode(out); err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return fmt.Errorf("malformed response: %v", err)
+	}
+	recordMetric(csrmetrics.OutboundRPCStatusOK)
+	return nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	capi "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseCASSignerPools(t *testing.T) {
+	cases := map[string]struct {
+		pools     map[string]string
+		expectErr bool
+	}{
+		"none": {},
+		"valid": {
+			pools: map[string]string{capi.KubeletServingSignerName: "projects/p0/locations/us-central1/caPools/pool0"},
+		},
+		"empty signer name": {
+			pools:     map[string]string{"": "projects/p0/locations/us-central1/caPools/pool0"},
+			expectErr: true,
+		},
+		"invalid pool": {
+			pools:     map[string]string{capi.KubeletServingSignerName: "pool0"},
+			expectErr: true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseCASSignerPools(c.pools)
+			if got, want := (err != nil), c.expectErr; got != want {
+				t.Errorf("unexpected error value: %v", err)
+			}
+		})
+	}
+}
+
+func TestCASSigner(t *testing.T) {
+	const pool = "projects/p0/locations/us-central1/caPools/pool0"
+	issued := casCertificate{
+		PemCertificate:      "cert\n",
+		PemCertificateChain: []string{"intermediate", "root\n"},
+	}
+
+	cases := []struct {
+		name       string
+		signerName string
+		approved   bool
+		handler    func(t *testing.T, w http.ResponseWriter, r *http.Request)
+		wantCert   string
+		wantErr    bool
+	}{
+		{
+			name:       "signs approved CSRs",
+			signerName: capi.KubeletServingSignerName,
+			approved:   true,
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if got, want := r.URL.Path, "/"+pool+"/certificates"; got != want {
+					t.Errorf("got path %q, want %q", got, want)
+				}
+				if got, want := r.URL.Query().Get("certificateId"), "csr-uid-1"; got != want {
+					t.Errorf("got certificate ID %q, want %q", got, want)
+				}
+				var req casCertificate
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("decoding request: %v", err)
+				}
+				if got, want := req.Lifetime, "3600s"; got != want {
+					t.Errorf("got lifetime %q, want %q", got, want)
+				}
+				json.NewEncoder(w).Encode(issued)
+			},
+			wantCert: "cert\nintermediate\nroot\n",
+		},
+		{
+			name:       "gets certificates already issued",
+			signerName: capi.KubeletServingSignerName,
+			approved:   true,
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				if got, want := r.URL.Path, "/"+pool+"/certificates/csr-uid-1"; got != want {
+					t.Errorf("got path %q, want %q", got, want)
+				}
+				json.NewEncoder(w).Encode(issued)
+			},
+			wantCert: "cert\nintermediate\nroot\n",
+		},
+		{
+			name:       "ignores unapproved CSRs",
+			signerName: capi.KubeletServingSignerName,
+		},
+		{
+			name:       "ignores other signer names",
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+			approved:   true,
+		},
+		{
+			name:       "returns errors",
+			signerName: capi.KubeletServingSignerName,
+			approved:   true,
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.handler == nil {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+					return
+				}
+				c.handler(t, w, r)
+			}))
+			defer server.Close()
+
+			expirationSeconds := int32(3600)
+			csr := &capi.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "csr-1", UID: "uid-1"},
+				Spec: capi.CertificateSigningRequestSpec{
+					SignerName:        c.signerName,
+					Request:           generateCSR(),
+					ExpirationSeconds: &expirationSeconds,
+				},
+			}
+			if c.approved {
+				csr.Status = statusApproved
+			}
+			client := fake.NewSimpleClientset(csr)
+			ctx := &controllerContext{
+				client:                       client,
+				recorder:                     record.NewFakeRecorder(10),
+				casSignerPools:               map[string]string{capi.KubeletServingSignerName: pool},
+				casSignerCertificateDuration: 24 * time.Hour,
+			}
+			ctx.gcpCfg.HTTPClient = server.Client()
+			signer := newCASSigner(ctx)
+			signer.basePath = server.URL + "/"
+
+			err := signer.handle(context.Background(), csr)
+			if gotErr := err != nil; gotErr != c.wantErr {
+				t.Fatalf("handle() got err %v, want error %t", err, c.wantErr)
+			}
+			got, err := client.CertificatesV1().CertificateSigningRequests().Get(context.Background(), csr.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got.Status.Certificate) != c.wantCert {
+				t.Errorf("got certificate %q, want %q", got.Status.Certificate, c.wantCert)
+			}
+		})
+	}
+}
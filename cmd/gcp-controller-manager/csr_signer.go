@@ -85,13 +85,7 @@ func (s *gkeSigner) handleInternal(csr *capi.CertificateSigningRequest) (process
 	}
 
 	// Ignore CSRs that are not addressed to the default signer.
-	if csr.Spec.SignerName != "" &&
-		csr.Spec.SignerName != certsv1.KubeAPIServerClientSignerName &&
-		csr.Spec.SignerName != certsv1.KubeAPIServerClientKubeletSignerName &&
-		csr.Spec.SignerName != certsv1.KubeletServingSignerName &&
-		csr.Spec.SignerName != certsv1b1.LegacyUnknownSignerName &&
-		csr.Spec.SignerName != istiodSignerName &&
-		csr.Spec.SignerName != oidcSignerName {
+	if !s.signs(csr.Spec.SignerName) {
 		return false, nil, nil
 	}
 
@@ -103,7 +97,7 @@ func (s *gkeSigner) handleInternal(csr *capi.CertificateSigningRequest) (process
 		recordMetric(csrmetrics.SigningStatusParseError)
 		return true, nil, fmt.Errorf("unable to parse csr %q: %v", csr.Name, err)
 	}
-	recordMetric = csrmetrics.SigningStartRecorder(s.metricLabel(csr, x509cr))
+	recordMetric = csrmetrics.SigningStartRecorder(metricLabel(s.validators, csr, x509cr))
 	csr, err = s.sign(csr)
 	if err != nil {
 		recordMetric(csrmetrics.SigningStatusSignError)
@@ -123,8 +117,31 @@ func (s *gkeSigner) handleInternal(csr *capi.CertificateSigningRequest) (process
 	return true, csr, nil
 }
 
-func (s *gkeSigner) metricLabel(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) string {
-	for _, v := range s.validators {
+// isGKESignerName returns whether CSRs addressed to signerName are signed by
+// the gkeSigner.
+func isGKESignerName(signerName string) bool {
+	switch signerName {
+	case "",
+		certsv1.KubeAPIServerClientSignerName,
+		certsv1.KubeAPIServerClientKubeletSignerName,
+		certsv1.KubeletServingSignerName,
+		certsv1b1.LegacyUnknownSignerName,
+		istiodSignerName,
+		oidcSignerName:
+		return true
+	}
+	return false
+}
+
+// signs returns whether CSRs addressed to signerName are signed by the
+// gkeSigner rather than by a Certificate Authority Service CA pool.
+func (s *gkeSigner) signs(signerName string) bool {
+	_, cas := s.ctx.casSignerPools[signerName]
+	return isGKESignerName(signerName) && !cas
+}
+
+func metricLabel(validators []csrValidator, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) string {
+	for _, v := range validators {
 		if v.recognize(csr, x509cr) {
 			return v.authFlowLabel
 		}
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	capi "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	certlisters "k8s.io/client-go/listers/certificates/v1"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/controller/certificates"
+)
+
+// stalledIssuanceThreshold is how long after its approval a CSR without a
+// certificate is reported as stalled.
+const stalledIssuanceThreshold = 5 * time.Minute
+
+// reconcileUnissuedCSRs signs the CSRs that were approved but not issued a
+// certificate before the controller started, e.g. because it crashed between
+// the approval and the signing, so that nodes are not left stuck at bootstrap.
+// CSRs approved more than stalledIssuanceThreshold ago get a warning event to
+// alert on. It is run once after the CSR informer synced, before the signer
+// controller starts.
+func reconcileUnissuedCSRs(ctx context.Context, lister certlisters.CertificateSigningRequestLister, signer *gkeSigner, now time.Time) {
+	csrs, err := lister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list CSRs to reconcile at startup: %v", err)
+		return
+	}
+	for _, csr := range csrs {
+		if ctx.Err() != nil {
+			return
+		}
+		if len(csr.Status.Certificate) > 0 || isCertificateRequestFailed(csr) || !certificates.IsCertificateRequestApproved(csr) || !signer.signs(csr.Spec.SignerName) {
+			continue
+		}
+		stalled := false
+		if approvedAt := certificateRequestApprovalTime(csr); !approvedAt.IsZero() && now.Sub(approvedAt) > stalledIssuanceThreshold {
+			stalled = true
+			klog.Warningf("CSR %q was approved %v ago but not issued a certificate, signing it", csr.Name, now.Sub(approvedAt).Round(time.Second))
+			signer.ctx.recorder.Eventf(csr, v1.EventTypeWarning, "CertificateIssuanceStalled", "CSR was approved %v ago but not issued a certificate", now.Sub(approvedAt).Round(time.Second))
+		} else {
+			klog.Infof("CSR %q was approved but not issued a certificate, signing it", csr.Name)
+		}
+		if _, _, err := signer.handleInternal(csr.DeepCopy()); err != nil {
+			klog.Errorf("Failed to sign CSR %q approved before startup: %v", csr.Name, err)
+			csrmetrics.RecordUnissuedAtStartup(csrmetrics.SigningStatusSignError, stalled)
+			continue
+		}
+		csrmetrics.RecordUnissuedAtStartup(csrmetrics.SigningStatusSigned, stalled)
+	}
+}
+
+// certificateRequestApprovalTime returns when the CSR was approved, or the
+// zero time if unknown.
+func certificateRequestApprovalTime(csr *capi.CertificateSigningRequest) time.Time {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == capi.CertificateApproved {
+			if !c.LastUpdateTime.IsZero() {
+				return c.LastUpdateTime.Time
+			}
+			return c.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+func isCertificateRequestFailed(csr *capi.CertificateSigningRequest) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == capi.CertificateFailed {
+			return true
+		}
+	}
+	return false
+}
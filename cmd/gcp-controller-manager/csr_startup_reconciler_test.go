@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	capi "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	certlisters "k8s.io/client-go/listers/certificates/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReconcileUnissuedCSRs(t *testing.T) {
+	now := time.Now()
+	approvedAt := func(at time.Time) capi.CertificateSigningRequestStatus {
+		return capi.CertificateSigningRequestStatus{
+			Conditions: []capi.CertificateSigningRequestCondition{
+				{Type: capi.CertificateApproved, LastUpdateTime: metav1.NewTime(at)},
+			},
+		}
+	}
+	newCSR := func(name, signerName string, status capi.CertificateSigningRequestStatus) *capi.CertificateSigningRequest {
+		return &capi.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: capi.CertificateSigningRequestSpec{
+				SignerName: signerName,
+				Request:    generateCSR(),
+			},
+			Status: status,
+		}
+	}
+	issued := approvedAt(now.Add(-time.Hour))
+	issued.Certificate = []byte("existing certificate")
+	failed := approvedAt(now.Add(-time.Hour))
+	failed.Conditions = append(failed.Conditions, capi.CertificateSigningRequestCondition{Type: capi.CertificateFailed})
+
+	csrs := []*capi.CertificateSigningRequest{
+		newCSR("stalled", capi.KubeAPIServerClientKubeletSignerName, approvedAt(now.Add(-time.Hour))),
+		newCSR("recent", capi.KubeAPIServerClientKubeletSignerName, approvedAt(now.Add(-time.Minute))),
+		newCSR("pending", capi.KubeAPIServerClientKubeletSignerName, capi.CertificateSigningRequestStatus{}),
+		newCSR("issued", capi.KubeAPIServerClientKubeletSignerName, issued),
+		newCSR("failed", capi.KubeAPIServerClientKubeletSignerName, failed),
+		newCSR("other-signer", "example.com/signer", approvedAt(now.Add(-time.Hour))),
+	}
+	wantCertificates := map[string][]byte{
+		"stalled":      []byte("fake certificate"),
+		"recent":       []byte("fake certificate"),
+		"pending":      nil,
+		"issued":       []byte("existing certificate"),
+		"failed":       nil,
+		"other-signer": nil,
+	}
+
+	server, err := newTestServer(&capi.CertificateSigningRequest{
+		Status: capi.CertificateSigningRequestStatus{Certificate: []byte("fake certificate")},
+	}, 0)
+	if err != nil {
+		t.Fatalf("error creating test server: %v", err)
+	}
+	defer server.httpserver.Close()
+	kubeConfig := filepath.Join(t.TempDir(), "kubeconfig")
+	var buf bytes.Buffer
+	if err := template.Must(template.New("kubeconfig").Parse(kubeConfigTmpl)).Execute(&buf, struct{ Server string }{server.httpserver.URL}); err != nil {
+		t.Fatalf("error executing kubeconfig template: %v", err)
+	}
+	if err := os.WriteFile(kubeConfig, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("error writing kubeconfig: %v", err)
+	}
+
+	client := fake.NewSimpleClientset()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, csr := range csrs {
+		if _, err := client.CertificatesV1().CertificateSigningRequests().Create(context.TODO(), csr, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("error creating CSR %q: %v", csr.Name, err)
+		}
+		indexer.Add(csr)
+	}
+	recorder := record.NewFakeRecorder(10)
+	signer, err := newGKESigner(&controllerContext{
+		client:                      client,
+		clusterSigningGKEKubeconfig: kubeConfig,
+		recorder:                    recorder,
+	})
+	if err != nil {
+		t.Fatalf("error creating GKESigner: %v", err)
+	}
+
+	reconcileUnissuedCSRs(context.TODO(), certlisters.NewCertificateSigningRequestLister(indexer), signer, now)
+
+	for name, want := range wantCertificates {
+		csr, err := client.CertificatesV1().CertificateSigningRequests().Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("error getting CSR %q: %v", name, err)
+		}
+		if !bytes.Equal(csr.Status.Certificate, want) {
+			t.Errorf("CSR %q: got certificate %q, want %q", name, csr.Status.Certificate, want)
+		}
+	}
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	if len(events) != 1 || !strings.Contains(events[0], "CertificateIssuanceStalled") {
+		t.Errorf("got events %q, want one CertificateIssuanceStalled event", events)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	genDashboardsCommand = "gen-dashboards"
+
+	dashboardFileName      = "gcp-controller-manager-dashboard.json"
+	prometheusRuleFileName = "gcp-controller-manager-prometheusrule.yaml"
+
+	// dashboardRateInterval is the range of the rates in the dashboard
+	// panels and alert expressions.
+	dashboardRateInterval = "5m"
+	// errorStatusRegexp matches the values of the status label of the
+	// metrics that are errors.
+	errorStatusRegexp = ".*error.*"
+)
+
+// genDashboards implements the gen-dashboards subcommand, writing a Grafana
+// dashboard and a PrometheusRule with alerts for the metrics of the
+// controllers to the output directory.
+func genDashboards(args []string) error {
+	fs := pflag.NewFlagSet(genDashboardsCommand, pflag.ContinueOnError)
+	outputDir := fs.String("output-dir", ".", "Directory to write the Grafana dashboard and the PrometheusRule to.")
+	latencyThreshold := fs.Duration("latency-alert-threshold", 10*time.Second, "99th percentile latency above which the latency alerts fire.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	definitions := csrmetrics.Definitions()
+	dashboard, err := json.MarshalIndent(grafanaDashboard(definitions), "", "  ")
+	if err != nil {
+		return err
+	}
+	rule, err := yaml.Marshal(prometheusRule(definitions, *latencyThreshold))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*outputDir, dashboardFileName), append(dashboard, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(*outputDir, prometheusRuleFileName), rule, 0644)
+}
+
+// panelQuery returns the PromQL query and legend of the dashboard panel of
+// the metric.
+func panelQuery(d csrmetrics.Definition) (string, string) {
+	labels := strings.Join(d.Labels, ", ")
+	legend := make([]string, 0, len(d.Labels))
+	for _, l := range d.Labels {
+		legend = append(legend, "{{"+l+"}}")
+	}
+	if d.Type == csrmetrics.MetricTypeHistogram {
+		return fmt.Sprintf("histogram_quantile(0.99, sum by (le, %s) (rate(%s_bucket[%s])))", labels, d.Name, dashboardRateInterval), strings.Join(legend, " ")
+	}
+	return fmt.Sprintf("sum by (%s) (rate(%s[%s]))", labels, d.Name, dashboardRateInterval), strings.Join(legend, " ")
+}
+
+func grafanaDashboard(definitions []csrmetrics.Definition) map[string]interface{} {
+	datasource := map[string]interface{}{"type": "prometheus", "uid": "${datasource}"}
+	var panels []interface{}
+	for i, d := range definitions {
+		expr, legend := panelQuery(d)
+		unit := "ops"
+		if d.Type == csrmetrics.MetricTypeHistogram {
+			unit = "s"
+		}
+		panels = append(panels, map[string]interface{}{
+			"id":          i + 1,
+			"type":        "timeseries",
+			"title":       d.Name,
+			"description": d.Help,
+			"datasource":  datasource,
+			"gridPos":     map[string]interface{}{"h": 8, "w": 12, "x": 12 * (i % 2), "y": 8 * (i / 2)},
+			"fieldConfig": map[string]interface{}{"defaults": map[string]interface{}{"unit": unit}},
+			"targets": []interface{}{map[string]interface{}{
+				"refId":        "A",
+				"datasource":   datasource,
+				"expr":         expr,
+				"legendFormat": legend,
+			}},
+		})
+	}
+	return map[string]interface{}{
+		"title":         "gcp-controller-manager",
+		"uid":           "gcp-controller-manager",
+		"schemaVersion": 39,
+		"tags":          []string{"gcp-controller-manager"},
+		"time":          map[string]interface{}{"from": "now-6h", "to": "now"},
+		"templating": map[string]interface{}{"list": []interface{}{map[string]interface{}{
+			"name":  "datasource",
+			"type":  "datasource",
+			"query": "prometheus",
+		}}},
+		"panels": panels,
+	}
+}
+
+// alertName returns the name of an alert on the metric, e.g.
+// CsrSigningCountErrors for csr_signing_count and Errors.
+func alertName(metric, suffix string) string {
+	var name strings.Builder
+	for _, word := range strings.Split(metric, "_") {
+		if word != "" {
+			name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return name.String() + suffix
+}
+
+func hasLabel(d csrmetrics.Definition, label string) bool {
+	for _, l := range d.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+func labelsExcept(d csrmetrics.Definition, label string) []string {
+	var labels []string
+	for _, l := range d.Labels {
+		if l != label {
+			labels = append(labels, l)
+		}
+	}
+	return labels
+}
+
+// prometheusRule returns a PrometheusRule alerting on the error statuses of
+// the counters, and on the 99th percentile of the latencies above
+// latencyThreshold.
+func prometheusRule(definitions []csrmetrics.Definition, latencyThreshold time.Duration) map[string]interface{} {
+	var rules []interface{}
+	for _, d := range definitions {
+		switch {
+		case d.Type == csrmetrics.MetricTypeCounter && hasLabel(d, "status"):
+			rules = append(rules, map[string]interface{}{
+				"alert": alertName(d.Name, "Errors"),
+				"expr":  fmt.Sprintf(`sum by (%s) (rate(%s{status=~"%s"}[%s])) > 0`, strings.Join(labelsExcept(d, "status"), ", "), d.Name, errorStatusRegexp, dashboardRateInterval),
+				"for":   "15m",
+				"labels": map[string]string{
+					"severity": "warning",
+				},
+				"annotations": map[string]string{
+					"summary":     fmt.Sprintf("%s reports error statuses", d.Name),
+					"description": strings.TrimSuffix(d.Help, ".") + ".",
+				},
+			})
+		case d.Type == csrmetrics.MetricTypeHistogram:
+			expr, _ := panelQuery(d)
+			rules = append(rules, map[string]interface{}{
+				"alert": alertName(d.Name, "High"),
+				"expr":  fmt.Sprintf("%s > %g", expr, latencyThreshold.Seconds()),
+				"for":   "15m",
+				"labels": map[string]string{
+					"severity": "warning",
+				},
+				"annotations": map[string]string{
+					"summary":     fmt.Sprintf("99th percentile of %s is above %v", d.Name, latencyThreshold),
+					"description": strings.TrimSuffix(d.Help, ".") + ".",
+				},
+			})
+		}
+	}
+	return map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "PrometheusRule",
+		"metadata": map[string]interface{}{
+			"name":      "gcp-controller-manager",
+			"namespace": "kube-system",
+		},
+		"spec": map[string]interface{}{
+			"groups": []interface{}{map[string]interface{}{
+				"name":  "gcp-controller-manager",
+				"rules": rules,
+			}},
+		},
+	}
+}
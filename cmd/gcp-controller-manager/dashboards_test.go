@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"sigs.k8s.io/yaml"
+)
+
+func TestGenDashboards(t *testing.T) {
+	dir := t.TempDir()
+	if err := genDashboards([]string{"--output-dir", dir, "--latency-alert-threshold", "30s"}); err != nil {
+		t.Fatalf("genDashboards() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, dashboardFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dashboard struct {
+		Panels []struct {
+			Title   string
+			Targets []struct {
+				Expr string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		t.Fatalf("dashboard is not valid JSON: %v", err)
+	}
+	definitions := csrmetrics.Definitions()
+	if len(dashboard.Panels) != len(definitions) {
+		t.Fatalf("dashboard has %d panels, want one per metric: %d", len(dashboard.Panels), len(definitions))
+	}
+	for i, d := range definitions {
+		p := dashboard.Panels[i]
+		if p.Title != d.Name || len(p.Targets) != 1 || !strings.Contains(p.Targets[0].Expr, d.Name) {
+			t.Errorf("panel %d = %+v, want a query of %s", i, p, d.Name)
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, prometheusRuleFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rule struct {
+		Kind string
+		Spec struct {
+			Groups []struct {
+				Rules []struct {
+					Alert string
+					Expr  string
+				}
+			}
+		}
+	}
+	if err := yaml.Unmarshal(data, &rule); err != nil {
+		t.Fatalf("PrometheusRule is not valid YAML: %v", err)
+	}
+	if rule.Kind != "PrometheusRule" || len(rule.Spec.Groups) != 1 {
+		t.Fatalf("PrometheusRule = %s, want one group", data)
+	}
+	alerts := map[string]string{}
+	for _, r := range rule.Spec.Groups[0].Rules {
+		alerts[r.Alert] = r.Expr
+	}
+	for alert, want := range map[string]string{
+		"CsrSigningCountErrors":    `sum by (kind) (rate(csr_signing_count{status=~".*error.*"}[5m])) > 0`,
+		"OutboundRpcLatencyHigh":   `histogram_quantile(0.99, sum by (le, status, kind) (rate(outbound_rpc_latency_bucket[5m]))) > 30`,
+		"CsrApprovalLatenciesHigh": `histogram_quantile(0.99, sum by (le, status, kind) (rate(csr_approval_latencies_bucket[5m]))) > 30`,
+	} {
+		if got := alerts[alert]; got != want {
+			t.Errorf("alert %s expr = %q, want %q", alert, got, want)
+		}
+	}
+}
+
+func TestGenDashboardsUnknownFlag(t *testing.T) {
+	if err := genDashboards([]string{"--unknown"}); err == nil {
+		t.Error("genDashboards() with an unknown flag succeeded, want error")
+	}
+}
@@ -23,6 +23,7 @@ import (
 
 	core "k8s.io/api/core/v1"
 	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/cloud-provider-gcp/cmd/gcp-controller-manager/dpwi/ctxlog"
 	"k8s.io/cloud-provider-gcp/cmd/gcp-controller-manager/dpwi/eventhandler"
@@ -40,23 +41,32 @@ const (
 // It forces the Verifier to verify if a KSA can act as a GCP Service Account (GSA) or not,
 // and then update Verifier's in memory result. When a KSA's permission changes,
 // it notifies the configmap handler to update the configmap and the node syncer
-// to sync all related nodes.
+// to sync all related nodes. It optionally records the verification of each KSA in
+// its verification.iam.gke.io/AUDIENCE annotation.
 type Handler struct {
 	eventhandler.EventHandler
 	podIndexer             cache.Indexer
 	verifier               *Verifier
+	recorder               *verificationRecorder
 	notifyConfigmapHandler func()
 	notifyNodeSyncer       func(string)
 }
 
-// NewEventHandler creates a new handler.
+// NewEventHandler creates a new handler. The verifications are recorded with the
+// client in the annotation of verificationAudience, unless it is empty.
 func NewEventHandler(
+	client kubernetes.Interface,
 	saInformer coreinformers.ServiceAccountInformer,
 	podInformer coreinformers.PodInformer,
 	verifier *Verifier,
+	verificationAudience string,
 	notifyConfigmapHandler func(),
 	notifyNodeSyncer func(string),
-) *Handler {
+) (*Handler, error) {
+	recorder, err := newVerificationRecorder(client, verificationAudience)
+	if err != nil {
+		return nil, err
+	}
 	podIndexer := podInformer.Informer().GetIndexer()
 	podIndexer.AddIndexers(map[string]cache.IndexFunc{
 		indexByKSA: func(obj interface{}) ([]string, error) {
@@ -71,12 +81,13 @@ func NewEventHandler(
 	h := &Handler{
 		podIndexer:             podIndexer,
 		verifier:               verifier,
+		recorder:               recorder,
 		notifyConfigmapHandler: notifyConfigmapHandler,
 		notifyNodeSyncer:       notifyNodeSyncer,
 	}
 	h.InitEventHandler(saVerifierSAQueueName, h.process)
 	saInformer.Informer().AddEventHandlerWithResyncPeriod(h.ResourceEventHandler(), serviceAccountResyncPeriod)
-	return h
+	return h, nil
 }
 
 func (h *Handler) process(ctx context.Context, key string) error {
@@ -90,16 +101,31 @@ func (h *Handler) process(ctx context.Context, key string) error {
 		return err
 	}
 	if res.denied {
+		if err := h.recordVerification(ctx, ksa, res); err != nil {
+			return err
+		}
 		// https://cloud.google.com/iam/docs/access-change-propagation
 		return fmt.Errorf("retry denied error as IAM propagation can take 7 minutes or longer")
 	}
-	if res.curGSA == res.preVerifiedGSA {
+	if res.curGSA != res.preVerifiedGSA {
+		// gsa changes, so the permission changes.
+		h.notifyConfigmapHandler()
+		h.notifyAffectedNodes(ctx, ksa)
+	}
+	// The verification is recorded last, since a retry after a failure
+	// would not notify the change again.
+	return h.recordVerification(ctx, ksa, res)
+}
+
+func (h *Handler) recordVerification(ctx context.Context, ksa ServiceAccount, res verifyResult) error {
+	if h.recorder == nil {
 		return nil
 	}
-	// gsa changes, so the permission changes.
-	h.notifyConfigmapHandler()
-	h.notifyAffectedNodes(ctx, ksa)
-	return nil
+	sa, err := h.verifier.getSA(ksa)
+	if err != nil {
+		return err
+	}
+	return h.recorder.record(ctx, sa, res)
 }
 
 func (h *Handler) notifyAffectedNodes(ctx context.Context, ksa ServiceAccount) {
@@ -125,5 +125,9 @@ func (m *saMap) serialize() ([]byte, error) {
 type verifyResult struct {
 	preVerifiedGSA GSAEmail
 	curGSA         GSAEmail
-	denied         bool
+	// annotatedGSA is the GSA annotation of the KSA, verified or not.
+	annotatedGSA GSAEmail
+	denied       bool
+	// invalid is set if annotatedGSA is not a GSA email.
+	invalid bool
 }
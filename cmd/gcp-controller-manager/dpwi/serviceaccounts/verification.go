@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceaccounts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/cloud-provider-gcp/cmd/gcp-controller-manager/dpwi/ctxlog"
+)
+
+const (
+	// verificationAnnotationPrefix is the prefix of the annotations recording
+	// the verification of the GSA of a KSA, followed by the audience of the
+	// verification, e.g. verification.iam.gke.io/direct-path.
+	verificationAnnotationPrefix = "verification.iam.gke.io/"
+)
+
+// VerificationStatus is the outcome of the verification of the GSA of a KSA.
+type VerificationStatus string
+
+const (
+	// VerificationVerified means that the KSA can act as the GSA.
+	VerificationVerified VerificationStatus = "Verified"
+	// VerificationDenied means that the GSA does not exist or that the KSA is
+	// not bound to roles/iam.workloadIdentityUser on it.
+	VerificationDenied VerificationStatus = "Denied"
+	// VerificationInvalid means that the annotation of the KSA is not a GSA
+	// email.
+	VerificationInvalid VerificationStatus = "Invalid"
+)
+
+// gsaEmailPattern matches the emails of the GCP service accounts, e.g.
+// NAME@PROJECT.iam.gserviceaccount.com or
+// PROJECT_NUMBER-compute@developer.gserviceaccount.com.
+var gsaEmailPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+@([a-z0-9.-]+\.)?gserviceaccount\.com$`)
+
+// Verification is the verification of the GSA of a KSA, recorded as JSON in
+// its verification.iam.gke.io/AUDIENCE annotation for the admission webhooks
+// of the audience. It only holds for the GSA it names: a webhook must compare
+// it with the current iam.gke.io/gcp-service-account annotation of the KSA,
+// which may have changed since.
+type Verification struct {
+	GSA    GSAEmail           `json:"gsa"`
+	Status VerificationStatus `json:"status"`
+	Reason string             `json:"reason,omitempty"`
+	// LastTransitionTime is when the GSA or status last changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// verificationAnnotation returns the key of the verification annotation of
+// the audience.
+func verificationAnnotation(audience string) (string, error) {
+	key := verificationAnnotationPrefix + audience
+	if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+		return "", fmt.Errorf("invalid verification audience %q: %v", audience, errs)
+	}
+	return key, nil
+}
+
+// verification returns the Verification of the result, or nil if the KSA
+// has no GSA to verify.
+func (res verifyResult) verification() *Verification {
+	switch {
+	case res.invalid:
+		return &Verification{GSA: res.annotatedGSA, Status: VerificationInvalid, Reason: "not a GCP service account email"}
+	case res.denied:
+		return &Verification{GSA: res.annotatedGSA, Status: VerificationDenied, Reason: "the GCP service account does not exist or the Kubernetes service account is not allowed to act as it"}
+	case res.curGSA != "":
+		return &Verification{GSA: res.curGSA, Status: VerificationVerified}
+	}
+	return nil
+}
+
+// verificationRecorder records the verification of the GSA of the KSAs in
+// their annotation of an audience.
+type verificationRecorder struct {
+	client     kubernetes.Interface
+	annotation string
+}
+
+// newVerificationRecorder returns a verificationRecorder for the audience,
+// or nil if it is empty.
+func newVerificationRecorder(client kubernetes.Interface, audience string) (*verificationRecorder, error) {
+	if audience == "" {
+		return nil, nil
+	}
+	annotation, err := verificationAnnotation(audience)
+	if err != nil {
+		return nil, err
+	}
+	return &verificationRecorder{client: client, annotation: annotation}, nil
+}
+
+// record patches the verification annotation of the KSA, if it exists, with
+// the verification of the result, removing it if the KSA has no GSA. The KSA
+// is left unchanged if the GSA and status of the annotation are already the
+// ones of the result.
+func (r *verificationRecorder) record(ctx context.Context, sa *core.ServiceAccount, res verifyResult) error {
+	if r == nil || sa == nil {
+		return nil
+	}
+	want := res.verification()
+	current, found := sa.ObjectMeta.Annotations[r.annotation]
+	var value *string
+	switch {
+	case want == nil && !found:
+		return nil
+	case want != nil:
+		var got Verification
+		if found && json.Unmarshal([]byte(current), &got) == nil && got.GSA == want.GSA && got.Status == want.Status && got.Reason == want.Reason {
+			return nil
+		}
+		want.LastTransitionTime = metav1.Now()
+		b, err := json.Marshal(want)
+		if err != nil {
+			return err
+		}
+		s := string(b)
+		value = &s
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]*string{r.annotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := r.client.CoreV1().ServiceAccounts(sa.Namespace).Patch(ctx, sa.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to record the verification of %s/%s: %w", sa.Namespace, sa.Name, err)
+	}
+	if want != nil {
+		ctxlog.Infof(ctx, "Recorded %s verification of GSA %q in %s/%s", want.Status, want.GSA, sa.Namespace, sa.Name)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceaccounts
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testAudience = "direct-path"
+
+func TestProcessRecordsVerification(t *testing.T) {
+	invalidKSA := ServiceAccount{Namespace: testNamespace, Name: "invalid"}
+	stale, err := json.Marshal(Verification{GSA: gsa1, Status: VerificationDenied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleSA := newV1SA(ksa3, "")
+	staleSA.ObjectMeta.Annotations[verificationAnnotationPrefix+testAudience] = string(stale)
+
+	tests := []struct {
+		desc       string
+		ksa        ServiceAccount
+		sa         *v1.ServiceAccount
+		wantErr    bool
+		wantStatus VerificationStatus
+		wantGSA    GSAEmail
+	}{
+		{
+			desc:       "verified",
+			ksa:        ksa1,
+			sa:         newV1SA(ksa1, gsa1),
+			wantStatus: VerificationVerified,
+			wantGSA:    gsa1,
+		},
+		{
+			desc:       "denied",
+			ksa:        ksa2,
+			sa:         newV1SA(ksa2, gsa2),
+			wantErr:    true,
+			wantStatus: VerificationDenied,
+			wantGSA:    gsa2,
+		},
+		{
+			desc:       "invalid",
+			ksa:        invalidKSA,
+			sa:         newV1SA(invalidKSA, "not-an-email"),
+			wantStatus: VerificationInvalid,
+			wantGSA:    "not-an-email",
+		},
+		{
+			desc: "no GSA removes the verification",
+			ksa:  ksa3,
+			sa:   staleSA,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tc.sa)
+			v, s := setUpVerifierForTest(t, map[string]*v1.ServiceAccount{tc.ksa.Key(): tc.sa}, map[string]string{
+				ksa1.Key(): gsa1,
+			})
+			recorder, err := newVerificationRecorder(client, testAudience)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counter := counter{notifySyncerCount: make(map[string]int)}
+			h := &Handler{
+				podIndexer:             &fakePodIndexer{},
+				verifier:               v,
+				recorder:               recorder,
+				notifyConfigmapHandler: counter.notifyConfigmapHandler,
+				notifyNodeSyncer:       counter.notifyNodeSyncer,
+			}
+			err = h.process(context.Background(), tc.ksa.Key())
+			if got := err != nil; got != tc.wantErr {
+				t.Fatalf("process(%v) got error %v, want error %t", tc.ksa, err, tc.wantErr)
+			}
+			if tc.wantStatus == VerificationInvalid && s.AuthorizeCount[tc.ksa.Key()] != 0 {
+				t.Errorf("process(%v) authorized an invalid GSA", tc.ksa)
+			}
+
+			sa, err := client.CoreV1().ServiceAccounts(tc.ksa.Namespace).Get(context.Background(), tc.ksa.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, found := sa.ObjectMeta.Annotations[verificationAnnotationPrefix+testAudience]
+			if tc.wantStatus == "" {
+				if found {
+					t.Errorf("got verification %s, want none", value)
+				}
+				return
+			}
+			var got Verification
+			if err := json.Unmarshal([]byte(value), &got); err != nil {
+				t.Fatalf("decoding verification %q: %v", value, err)
+			}
+			if got.Status != tc.wantStatus || got.GSA != tc.wantGSA {
+				t.Errorf("got verification %s of %q, want %s of %q", got.Status, got.GSA, tc.wantStatus, tc.wantGSA)
+			}
+			if got.LastTransitionTime.IsZero() {
+				t.Errorf("got no lastTransitionTime")
+			}
+		})
+	}
+}
+
+func TestRecordUnchangedVerification(t *testing.T) {
+	sa := newV1SA(ksa1, gsa1)
+	sa.ObjectMeta.Annotations[verificationAnnotationPrefix+testAudience] = `{"gsa":"` + gsa1 + `","status":"Verified","lastTransitionTime":"2024-01-01T00:00:00Z"}`
+	client := fake.NewSimpleClientset(sa)
+	recorder, err := newVerificationRecorder(client, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.record(context.Background(), sa, verifyResult{curGSA: gsa1, annotatedGSA: gsa1}); err != nil {
+		t.Fatalf("record() failed: %v", err)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("got actions %v for an unchanged verification, want none", actions)
+	}
+}
+
+func TestNewVerificationRecorder(t *testing.T) {
+	for audience, wantErr := range map[string]bool{
+		"":            false,
+		"direct-path": false,
+		"bad/name":    true,
+		"-bad":        true,
+	} {
+		_, err := newVerificationRecorder(fake.NewSimpleClientset(), audience)
+		if got := err != nil; got != wantErr {
+			t.Errorf("newVerificationRecorder(%q) got error %v, want error %t", audience, err, wantErr)
+		}
+	}
+}
+
+func TestGSAEmailPattern(t *testing.T) {
+	for email, want := range map[string]bool{
+		gsa1: true,
+		"123456789-compute@developer.gserviceaccount.com":     true,
+		"sa@example.com:project.iam.gserviceaccount.com":      false,
+		"sa@domain.com:project.iam.gserviceaccount.com.other": false,
+		"user@example.com": false,
+		"not-an-email":     false,
+	} {
+		if got := gsaEmailPattern.MatchString(email); got != want {
+			t.Errorf("gsaEmailPattern.MatchString(%q) = %t, want %t", email, got, want)
+		}
+	}
+}
@@ -98,6 +98,12 @@ func (v *Verifier) verify(ctx context.Context, ksa ServiceAccount) (res verifyRe
 		v.verifiedSAs.remove(ksa)
 		return res, nil
 	}
+	res.annotatedGSA = gsa
+	if !gsaEmailPattern.MatchString(string(gsa)) {
+		v.verifiedSAs.remove(ksa)
+		res.invalid = true
+		return res, nil
+	}
 	permitted, err := v.auth.Authorize(ctx, ksa.Namespace, ksa.Name, string(gsa))
 	if err != nil {
 		return res, fmt.Errorf("failed to authorize %s:%s; err: %w", ksa, gsa, err)
@@ -113,20 +119,28 @@ func (v *Verifier) verify(ctx context.Context, ksa ServiceAccount) (res verifyRe
 }
 
 func (v *Verifier) getGSA(ctx context.Context, ksa ServiceAccount) (GSAEmail, bool, error) {
+	sa, err := v.getSA(ksa)
+	if err != nil || sa == nil {
+		return "", false, err
+	}
+	ann, found := sa.ObjectMeta.Annotations[serviceAccountAnnotationGSAEmail]
+	return GSAEmail(ann), found, nil
+}
+
+// getSA returns the ServiceAccount of the KSA, or nil if it does not exist.
+func (v *Verifier) getSA(ksa ServiceAccount) (*core.ServiceAccount, error) {
 	o, exists, err := v.saIndexer.GetByKey(ksa.Key())
 	if err != nil {
-		return "", false, fmt.Errorf("failed to get ServiceAccount %v: %w", ksa, err)
+		return nil, fmt.Errorf("failed to get ServiceAccount %v: %w", ksa, err)
 	}
 	if !exists {
-		return "", false, nil
+		return nil, nil
 	}
 	sa, ok := o.(*core.ServiceAccount)
 	if !ok {
-		return "", false, fmt.Errorf("invalid object for service account %v: %#v", ksa, o)
+		return nil, fmt.Errorf("invalid object for service account %v: %#v", ksa, o)
 	}
-
-	ann, found := sa.ObjectMeta.Annotations[serviceAccountAnnotationGSAEmail]
-	return GSAEmail(ann), found, nil
+	return sa, nil
 }
 
 // AllVerified returns a full set of verified KSA-GSA pairs.
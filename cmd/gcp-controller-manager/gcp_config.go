@@ -23,6 +23,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"k8s.io/cloud-provider-gcp/providers/gce"
+	"net/http"
 	"sort"
 	"strings"
 
@@ -49,6 +50,17 @@ type gcpConfig struct {
 	Compute               *compute.Service
 	BetaCompute           *betacompute.Service
 	Container             *container.Service
+	// HTTPClient is authenticated like the GCE and GKE API clients, for the
+	// APIs without one.
+	HTTPClient *http.Client
+	// NodeProjects are the projects besides ProjectID whose instances are
+	// trusted as nodes, and NodeProjectsCompute the GCE API clients of those
+	// resolved with impersonated credentials.
+	NodeProjects        []string
+	NodeProjectsCompute map[string]*compute.Service
+	// InstanceCache caches the instances looked up by the node CSR approval,
+	// if set.
+	InstanceCache *instanceCache
 }
 
 func getRegionFromLocation(loc string) (string, error) {
@@ -83,6 +95,7 @@ func loadGCPConfig(gceConfigPath, gceAPIEndpointOverride string) (gcpConfig, err
 	// Get the token source for GCE and GKE APIs.
 	tokenSource := gce.NewAltTokenSource(gceConfig.Global.TokenURL, gceConfig.Global.TokenBody)
 	client := oauth2.NewClient(context.Background(), tokenSource)
+	a.HTTPClient = client
 	var err error
 	a.Compute, err = compute.New(client)
 	if err != nil {
@@ -0,0 +1,341 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	authorization "k8s.io/api/authorization/v1"
+	capi "k8s.io/api/certificates/v1"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// googleCertsURL serves the keys signing the Google ID tokens, including
+	// the instance identity tokens, as a JSON Web Key Set.
+	googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+	// googleKeysMaxAge is how long the keys are cached for.
+	googleKeysMaxAge = time.Hour
+	// googleKeysMinRefreshInterval bounds how often the keys are fetched
+	// for tokens signed by unknown keys, so that forged tokens cannot be used
+	// to flood the endpoint.
+	googleKeysMinRefreshInterval = time.Minute
+	// instanceIdentityClockSkew is the clock skew tolerated when checking
+	// the expiry of instance identity tokens.
+	instanceIdentityClockSkew = time.Minute
+
+	// instanceIdentityTokenPEMType is the type of the PEM block carrying the
+	// instance identity token after the CERTIFICATE REQUEST block of a CSR.
+	instanceIdentityTokenPEMType = "INSTANCE IDENTITY TOKEN"
+	// instanceIdentityTokenAnnotation carries the instance identity token of
+	// a CSR not embedding it in its request.
+	instanceIdentityTokenAnnotation = "cloud.google.com/instance-identity-token"
+)
+
+// instanceIdentityClaims are the claims of the full format of the instance
+// identity tokens, which include the instance details.
+type instanceIdentityClaims struct {
+	Issuer   string `json:"iss"`
+	Audience string `json:"aud"`
+	Expiry   int64  `json:"exp"`
+	IssuedAt int64  `json:"iat"`
+	Google   struct {
+		ComputeEngine struct {
+			ProjectID    string `json:"project_id"`
+			Zone         string `json:"zone"`
+			InstanceID   string `json:"instance_id"`
+			InstanceName string `json:"instance_name"`
+		} `json:"compute_engine"`
+	} `json:"google"`
+}
+
+// instanceIdentityVerifier verifies the GCE instance identity tokens attesting
+// the node client CSRs of instances without a vTPM, such as some sole-tenant
+// or nested virtualization setups.
+type instanceIdentityVerifier struct {
+	// audience is the audience the tokens must be requested for, with the
+	// hash of the key of the CSR they attest.
+	audience string
+	keys     *googleKeySet
+	now      func() time.Time
+}
+
+func newInstanceIdentityVerifier(audience string) *instanceIdentityVerifier {
+	return &instanceIdentityVerifier{
+		audience: audience,
+		keys:     newGoogleKeySet(googleCertsURL, http.DefaultClient),
+		now:      time.Now,
+	}
+}
+
+// instanceIdentityValidator recognizes the node client CSRs of the bootstrap
+// identity attested by an instance identity token.
+func instanceIdentityValidator() csrValidator {
+	return csrValidator{
+		name:          "kubelet client certificate with instance identity",
+		authFlowLabel: "kubelet_client_instance_identity",
+		recognize:     isInstanceIdentityNodeClientCert,
+		validate:      validateInstanceIdentity,
+		permission:    authorization.ResourceAttributes{Group: "certificates.k8s.io", Resource: "certificatesigningrequests", Verb: "create", Subresource: "nodeclient"},
+		approveMsg:    "Auto approving kubelet client certificate with instance identity after SubjectAccessReview.",
+
+		preApproveHook: ensureNodeMatchesMetadataOrDelete,
+	}
+}
+
+func isInstanceIdentityNodeClientCert(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) bool {
+	if !isNodeClientCert(csr, x509cr) {
+		return false
+	}
+	return csr.Spec.Username == tpmKubeletUsername && instanceIdentityToken(csr) != ""
+}
+
+// instanceIdentityToken returns the instance identity token of the CSR,
+// embedded in its request or else in an annotation, or "" if none.
+func instanceIdentityToken(csr *capi.CertificateSigningRequest) string {
+	rest := csr.Spec.Request
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == instanceIdentityTokenPEMType {
+			return strings.TrimSpace(string(block.Bytes))
+		}
+	}
+	return csr.Annotations[instanceIdentityTokenAnnotation]
+}
+
+// instanceIdentityTokenAudience returns the audience the instance identity
+// token of the CSR must be requested for: the configured audience followed by
+// the hex-encoded SHA-256 hash of the DER-encoded public key of the CSR, so
+// that a token cannot attest any other key than the one of the instance.
+func instanceIdentityTokenAudience(audience string, x509cr *x509.CertificateRequest) string {
+	digest := sha256.Sum256(x509cr.RawSubjectPublicKeyInfo)
+	return audience + "?csr-key-sha256=" + hex.EncodeToString(digest[:])
+}
+
+// validateInstanceIdentity checks that the instance identity token of the CSR
+// is signed by Google for the configured audience and the key of the CSR, and
+// identifies the existing instance of the node in a node project and the
+// zones of the cluster.
+func validateInstanceIdentity(ctx *controllerContext, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (bool, error) {
+	v := ctx.instanceIdentityVerifier
+	if v == nil {
+		return false, nil
+	}
+	claims, reason, err := v.verify(instanceIdentityToken(csr), instanceIdentityTokenAudience(v.audience, x509cr))
+	if err != nil {
+		return false, err
+	}
+	if reason != "" {
+		klog.Infof("deny CSR %q: invalid instance identity token: %s", csr.Name, reason)
+		return false, nil
+	}
+	gce := claims.Google.ComputeEngine
+	instanceName := strings.TrimPrefix(x509cr.Subject.CommonName, "system:node:")
+	switch {
+	case !contains(ctx.gcpCfg.nodeProjects(), gce.ProjectID):
+		klog.Infof("deny CSR %q: instance identity token of project %q, not one of %q", csr.Name, gce.ProjectID, ctx.gcpCfg.nodeProjects())
+		return false, nil
+	case !contains(ctx.gcpCfg.Zones, gce.Zone):
+		klog.Infof("deny CSR %q: instance identity token of zone %q, not one of %q", csr.Name, gce.Zone, ctx.gcpCfg.Zones)
+		return false, nil
+	case gce.InstanceName != instanceName:
+		klog.Infof("deny CSR %q: instance identity token of instance %q, not %q", csr.Name, gce.InstanceName, instanceName)
+		return false, nil
+	}
+
+	// The token of a deleted instance must not attest a new instance of the
+	// same name.
+	inst, err := getInstance(ctx, gce.ProjectID, gce.Zone, instanceName)
+	if isNotFound(err) {
+		klog.Infof("deny CSR %q: instance %q not found", csr.Name, instanceName)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if strconv.FormatUint(inst.Id, 10) != gce.InstanceID {
+		klog.Infof("deny CSR %q: instance identity token of instance ID %s, not %d", csr.Name, gce.InstanceID, inst.Id)
+		return false, nil
+	}
+	return true, nil
+}
+
+// verify returns the claims of the token if it is a valid, unexpired
+// instance identity token for the audience, and otherwise why it is not.
+// Errors fetching the signing keys are returned as errors.
+func (v *instanceIdentityVerifier) verify(token, audience string) (*instanceIdentityClaims, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, "malformed token", nil
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Sprintf("malformed token header: %v", err), nil
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Sprintf("unsupported signing algorithm %q", header.Algorithm), nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Sprintf("malformed token signature: %v", err), nil
+	}
+	key, err := v.keys.get(header.KeyID)
+	if err != nil {
+		return nil, "", err
+	}
+	if key == nil {
+		return nil, fmt.Sprintf("unknown signing key %q", header.KeyID), nil
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Sprintf("invalid token signature: %v", err), nil
+	}
+
+	var claims instanceIdentityClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Sprintf("malformed token claims: %v", err), nil
+	}
+	now := v.now()
+	switch {
+	case claims.Issuer != "https://accounts.google.com" && claims.Issuer != "accounts.google.com":
+		return nil, fmt.Sprintf("unexpected issuer %q", claims.Issuer), nil
+	case claims.Audience != audience:
+		return nil, fmt.Sprintf("unexpected audience %q", claims.Audience), nil
+	case now.After(time.Unix(claims.Expiry, 0).Add(instanceIdentityClockSkew)):
+		return nil, fmt.Sprintf("token expired at %v", time.Unix(claims.Expiry, 0)), nil
+	case now.Before(time.Unix(claims.IssuedAt, 0).Add(-instanceIdentityClockSkew)):
+		return nil, fmt.Sprintf("token issued in the future at %v", time.Unix(claims.IssuedAt, 0)), nil
+	case claims.Google.ComputeEngine.InstanceID == "":
+		return nil, "token without instance details, it must be requested with format=full", nil
+	}
+	return &claims, "", nil
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// googleKeySet caches the RSA keys of a JSON Web Key Set by key ID.
+type googleKeySet struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+	now     func() time.Time
+}
+
+func newGoogleKeySet(url string, client *http.Client) *googleKeySet {
+	return &googleKeySet{url: url, client: client, now: time.Now}
+}
+
+// get returns the key of the ID, or nil if unknown, fetching the keys if they
+// are stale or do not include it, e.g. after a key rotation.
+func (s *googleKeySet) get(keyID string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[keyID]
+	age := s.now().Sub(s.fetched)
+	switch {
+	case ok && age < googleKeysMaxAge:
+		return key, nil
+	case !ok && s.keys != nil && age < googleKeysMinRefreshInterval:
+		return nil, nil
+	}
+	recordMetric := csrmetrics.OutboundRPCStartRecorder("google.Certs.Get")
+	keys, err := s.fetch()
+	if err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return nil, fmt.Errorf("fetching signing keys: %v", err)
+	}
+	recordMetric(csrmetrics.OutboundRPCStatusOK)
+	s.keys, s.fetched = keys, s.now()
+	return s.keys[keyID], nil
+}
+
+func (s *googleKeySet) fetch() (map[string]*rsa.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response code %d", resp.StatusCode)
+	}
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("malformed response: %v", err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.KeyType != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("malformed modulus of key %q: %v", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("malformed exponent of key %q: %v", k.KeyID, err)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	capi "k8s.io/api/certificates/v1"
+	certutil "k8s.io/kubernetes/pkg/apis/certificates/v1"
+)
+
+const testInstanceIdentityAudience = "https://gke.example.com"
+
+// signTestJWT signs the claims as an RS256 JWT with the key of the ID.
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, keyID string, claims interface{}) string {
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"}) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(insecureRand, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// fakeGoogleCerts serves the public key of the ID as a JSON Web Key Set,
+// counting the requests.
+func fakeGoogleCerts(key *rsa.PublicKey, keyID string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+}
+
+func TestValidateInstanceIdentity(t *testing.T) {
+	signingKey, err := rsa.GenerateKey(insecureRand, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(insecureRand, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certsRequests int32
+	certs := fakeGoogleCerts(&signingKey.PublicKey, "k0", &certsRequests)
+	defer certs.Close()
+	client, srv := fakeGCPAPI(t, nil)
+	defer srv.Close()
+	cs, err := compute.New(client)
+	if err != nil {
+		t.Fatalf("creating GCE API client: %v", err)
+	}
+
+	now := time.Now()
+	// goodClaims are the claims of a token requested for the key of the CSR.
+	goodClaims := func(key *ecdsa.PrivateKey) instanceIdentityClaims {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c instanceIdentityClaims
+		c.Issuer = "https://accounts.google.com"
+		c.Audience = instanceIdentityTokenAudience(testInstanceIdentityAudience, &x509.CertificateRequest{RawSubjectPublicKeyInfo: der})
+		c.IssuedAt = now.Add(-time.Minute).Unix()
+		c.Expiry = now.Add(59 * time.Minute).Unix()
+		c.Google.ComputeEngine.ProjectID = "2"
+		c.Google.ComputeEngine.Zone = "r0-a"
+		c.Google.ComputeEngine.InstanceID = "4"
+		c.Google.ComputeEngine.InstanceName = "i1"
+		return c
+	}
+
+	cases := map[string]struct {
+		token          func(key *ecdsa.PrivateKey) string
+		annotation     bool
+		clusterProject string
+		want           bool
+	}{
+		"valid": {
+			token: func(key *ecdsa.PrivateKey) string { return signTestJWT(t, signingKey, "k0", goodClaims(key)) },
+			want:  true,
+		},
+		"valid in annotation": {
+			token:      func(key *ecdsa.PrivateKey) string { return signTestJWT(t, signingKey, "k0", goodClaims(key)) },
+			annotation: true,
+			want:       true,
+		},
+		"valid in node project": {
+			token:          func(key *ecdsa.PrivateKey) string { return signTestJWT(t, signingKey, "k0", goodClaims(key)) },
+			clusterProject: "p0",
+			want:           true,
+		},
+		"malformed": {
+			token: func(*ecdsa.PrivateKey) string { return "not.a.jwt" },
+		},
+		"other signing key": {
+			token: func(key *ecdsa.PrivateKey) string { return signTestJWT(t, otherKey, "k0", goodClaims(key)) },
+		},
+		"unknown key ID": {
+			token: func(key *ecdsa.PrivateKey) string { return signTestJWT(t, otherKey, "k1", goodClaims(key)) },
+		},
+		"wrong audience": {
+			token: func(key *ecdsa.PrivateKey) string {
+				c := goodClaims(key)
+				c.Audience = "https://other.example.com"
+				return signTestJWT(t, signingKey, "k0", c)
+			},
+		},
+		"audience without the key": {
+			token: func(key *ecdsa.PrivateKey) string {
+				c := goodClaims(key)
+				c.Audience = testInstanceIdentityAudience
+				return signTestJWT(t, signingKey, "k0", c)
+			},
+		},
+		"token of another key": {
+			token: func(*ecdsa.PrivateKey) string {
+				key, err := ecdsa.GenerateKey(elliptic.P224(), insecureRand)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signTestJWT(t, signingKey, "k0", goodClaims(key))
+			},
+		},
+		"expired": {
+			token: func(key *ecdsa.PrivateKey) string {
+				c := goodClaims(key)
+				c.Expiry = now.Add(-time.Hour).Unix()
+				return signTestJWT(t, signingKey, "k0", c)
+			},
+		},
+		"no instance details": {
+			token: func(key *ecdsa.PrivateKey) string {
+				c := goodClaims(key)
+				c.Google.ComputeEngine.InstanceID = ""
+				return signTestJWT(t, signingKey, "k0", c)
+			},
+		},
+		"wrong project": {
+			token: func(key *ecdsa.PrivateKey) string {
+				c := goodClaims(key)
+				c.Google.ComputeEngine.ProjectID = "p0"
+				return signTestJWT(t, signingKey, "k0", c)
+			},
+		},
+		"wrong instance name": {
+			token: func(key *ecdsa.PrivateKey) string {
+				c := goodClaims(key)
+				c.Google.ComputeEngine.InstanceName = "i0"
+				return signTestJWT(t, signingKey, "k0", c)
+			},
+		},
+		"recreated instance": {
+			token: func(key *ecdsa.PrivateKey) string {
+				c := goodClaims(key)
+				c.Google.ComputeEngine.InstanceID = "3"
+				return signTestJWT(t, signingKey, "k0", c)
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pk, err := ecdsa.GenerateKey(elliptic.P224(), insecureRand)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := csrBuilder{
+				cn:         "system:node:i1",
+				orgs:       []string{"system:nodes"},
+				requestor:  tpmKubeletUsername,
+				signerName: capi.KubeAPIServerClientKubeletSignerName,
+				usages:     kubeletClientUsages,
+				extraPEM:   map[string][]byte{},
+				key:        pk,
+			}
+			token := c.token(pk)
+			if !c.annotation {
+				b.extraPEM[instanceIdentityTokenPEMType] = []byte(token)
+			}
+			csr := makeFancyTestCSR(t, b)
+			if c.annotation {
+				csr.Annotations = map[string]string{instanceIdentityTokenAnnotation: token}
+			}
+			x509cr, err := certutil.ParseCSR(csr.Spec.Request)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !isInstanceIdentityNodeClientCert(csr, x509cr) {
+				t.Fatalf("CSR not recognized")
+			}
+
+			ctx := &controllerContext{instanceIdentityVerifier: newInstanceIdentityVerifier(testInstanceIdentityAudience)}
+			ctx.instanceIdentityVerifier.keys = newGoogleKeySet(certs.URL, certs.Client())
+			ctx.gcpCfg.Compute = cs
+			ctx.gcpCfg.ProjectID = "2"
+			if c.clusterProject != "" {
+				ctx.gcpCfg.ProjectID = c.clusterProject
+				ctx.gcpCfg.NodeProjects = []string{"2"}
+			}
+			ctx.gcpCfg.Zones = []string{"r0-a"}
+			got, err := validateInstanceIdentity(ctx, csr, x509cr)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("got: %v, want: %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGoogleKeySet(t *testing.T) {
+	key, err := rsa.GenerateKey(insecureRand, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	certs := fakeGoogleCerts(&key.PublicKey, "k0", &requests)
+	defer certs.Close()
+	now := time.Now()
+	keys := newGoogleKeySet(certs.URL, certs.Client())
+	keys.now = func() time.Time { return now }
+
+	get := func(keyID string, wantKey bool, wantRequests int32) {
+		t.Helper()
+		got, err := keys.get(keyID)
+		if err != nil {
+			t.Fatalf("get(%q) = %v", keyID, err)
+		}
+		if (got != nil) != wantKey {
+			t.Errorf("get(%q) got key %v, want key: %v", keyID, got, wantKey)
+		}
+		if got := atomic.LoadInt32(&requests); got != wantRequests {
+			t.Errorf("got %d requests, want %d", got, wantRequests)
+		}
+	}
+
+	get("k0", true, 1)
+	// The keys are cached.
+	get("k0", true, 1)
+	// Unknown keys are not fetched again right away.
+	get("k1", false, 1)
+	now = now.Add(googleKeysMinRefreshInterval)
+	get("k1", false, 2)
+	// Stale keys are fetched again.
+	now = now.Add(googleKeysMaxAge)
+	get("k0", true, 3)
+}
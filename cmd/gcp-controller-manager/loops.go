@@ -18,9 +18,13 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
+	"fmt"
 	"sort"
+	"strings"
 	"time"
 
+	core "k8s.io/api/core/v1"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -45,7 +49,36 @@ type controllerContext struct {
 	authSyncNodeURL                       string
 	hmsAuthorizeSAMappingURL              string
 	hmsSyncNodeURL                        string
+	serviceAccountVerificationAudience    string
 	clearStalePodsOnNodeRegistration      bool
+	verificationWebhookURLs               []string
+	verificationWebhookRootCAs            *x509.CertPool
+	verificationWebhookTimeout            time.Duration
+	verificationWebhookRetries            int
+	casSignerPools                        map[string]string
+	casSignerCertificateDuration          time.Duration
+	instanceIdentityVerifier              *instanceIdentityVerifier
+	nodeCSRApproverWorkers                int
+	nodeCSRApprovalQPS                    float32
+	nodeCSRApprovalBurst                  int
+	nodeCSRApprovalDryRun                 bool
+	nodeCertificateDegradedCondition      bool
+	verificationWebhookFailurePolicy      string
+	csrApprovalPolicy                     *csrApprovalPolicy
+	nodeCSRApprovalPolicy                 *nodeCSRApprovalPolicyWatcher
+	preemptibleNodeTaint                  *core.Taint
+	nodeInstanceLabels                    *instanceLabelSync
+	nodeMachineLabels                     bool
+	nodeInstanceLabelResyncPeriod         time.Duration
+}
+
+// loopGroups are the names which select several loops in --controllers, so
+// that the certificate, node and service account duties can be split across
+// deployments.
+var loopGroups = map[string][]string{
+	"certificate-approvers":    {"node-certificate-approver", "istiod-certificate-approver", "oidc-certificate-approver", "policy-certificate-approver"},
+	"certificate-signers":      {"certificate-signer", "cas-certificate-signer"},
+	"service-account-verifier": {"direct-path-with-workload-identity"},
 }
 
 // loops returns all the control loops that the GCPControllerManager can start.
@@ -61,7 +94,10 @@ func loops() map[string]func(context.Context, *controllerContext) error {
 				controllerCtx.sharedInformers.Certificates().V1().CertificateSigningRequests(),
 				approver.handle,
 			)
-			go approveController.Run(ctx, 20)
+			go approveController.Run(ctx, controllerCtx.nodeCSRApproverWorkers)
+			if controllerCtx.nodeCSRApprovalPolicy != nil {
+				go controllerCtx.nodeCSRApprovalPolicy.run(ctx.Done())
+			}
 			return nil
 		},
 		"istiod-certificate-approver": func(ctx context.Context, controllerCtx *controllerContext) error {
@@ -86,18 +122,52 @@ func loops() map[string]func(context.Context, *controllerContext) error {
 			go approveController.Run(ctx, 20)
 			return nil
 		},
+		"policy-certificate-approver": func(ctx context.Context, controllerCtx *controllerContext) error {
+			if controllerCtx.csrApprovalPolicy == nil {
+				return nil
+			}
+			approver := newPolicyApprover(controllerCtx)
+			approveController := certificates.NewCertificateController(ctx,
+				"policy-certificate-approver",
+				controllerCtx.client,
+				controllerCtx.sharedInformers.Certificates().V1().CertificateSigningRequests(),
+				approver.handle,
+			)
+			go approveController.Run(ctx, 20)
+			return nil
+		},
 		"certificate-signer": func(ctx context.Context, controllerCtx *controllerContext) error {
 			signer, err := newGKESigner(controllerCtx)
 			if err != nil {
 				return err
 			}
+			csrInformer := controllerCtx.sharedInformers.Certificates().V1().CertificateSigningRequests()
 			signController := certificates.NewCertificateController(ctx,
 				"signer",
 				controllerCtx.client,
-				controllerCtx.sharedInformers.Certificates().V1().CertificateSigningRequests(),
+				csrInformer,
 				signer.handle,
 			)
 
+			go func() {
+				if cache.WaitForNamedCacheSync("certificate-signer-startup", ctx.Done(), csrInformer.Informer().HasSynced) {
+					reconcileUnissuedCSRs(ctx, csrInformer.Lister(), signer, time.Now())
+				}
+				signController.Run(ctx, 20)
+			}()
+			return nil
+		},
+		"cas-certificate-signer": func(ctx context.Context, controllerCtx *controllerContext) error {
+			if len(controllerCtx.casSignerPools) == 0 {
+				return nil
+			}
+			signer := newCASSigner(controllerCtx)
+			signController := certificates.NewCertificateController(ctx,
+				"cas-signer",
+				controllerCtx.client,
+				controllerCtx.sharedInformers.Certificates().V1().CertificateSigningRequests(),
+				signer.handle,
+			)
 			go signController.Run(ctx, 20)
 			return nil
 		},
@@ -106,6 +176,10 @@ func loops() map[string]func(context.Context, *controllerContext) error {
 				controllerCtx.client,
 				controllerCtx.sharedInformers.Core().V1().Nodes(),
 				controllerCtx.gcpCfg.BetaCompute,
+				controllerCtx.preemptibleNodeTaint,
+				controllerCtx.nodeInstanceLabels,
+				controllerCtx.nodeMachineLabels,
+				controllerCtx.nodeInstanceLabelResyncPeriod,
 			)
 			if err != nil {
 				return err
@@ -129,6 +203,39 @@ func loopNames() []string {
 	return names
 }
 
+// loopGroupNames returns the sorted names of the loop groups.
+func loopGroupNames() []string {
+	names := make([]string, 0, len(loopGroups))
+	for name := range loopGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateControllers checks that the controllers of --controllers are all
+// loops or loop groups, optionally disabled with a "-" prefix, or "*".
+func validateControllers(controllers []string) error {
+	known := map[string]bool{"*": true}
+	for _, name := range loopNames() {
+		known[name] = true
+	}
+	for group, names := range loopGroups {
+		known[group] = true
+		// The loops of a group may not be registered, e.g. without
+		// --direct-path.
+		for _, name := range names {
+			known[name] = true
+		}
+	}
+	for _, controller := range controllers {
+		if !known[strings.TrimPrefix(controller, "-")] {
+			return fmt.Errorf("unknown controller %q, must be one of %s, a group of %s, or *", controller, strings.Join(loopNames(), ","), strings.Join(loopGroupNames(), ","))
+		}
+	}
+	return nil
+}
+
 func directPathV2Loop(ctx context.Context, controllerCtx *controllerContext) error {
 	auth, err := auth.NewClient(controllerCtx.authAuthorizeServiceAccountMappingURL, controllerCtx.hmsAuthorizeSAMappingURL, &clientcmdapi.AuthProviderConfig{Name: "gcp"})
 	if err != nil {
@@ -162,13 +269,18 @@ func directPathV2Loop(ctx context.Context, controllerCtx *controllerContext) err
 	if err != nil {
 		return nil
 	}
-	saHandler := serviceaccounts.NewEventHandler(
+	saHandler, err := serviceaccounts.NewEventHandler(
+		controllerCtx.client,
 		controllerCtx.sharedInformers.Core().V1().ServiceAccounts(),
 		controllerCtx.sharedInformers.Core().V1().Pods(),
 		verifier,
+		controllerCtx.serviceAccountVerificationAudience,
 		cmHandler.Enqueue,
 		syncer.EnqueueKey,
 	)
+	if err != nil {
+		return err
+	}
 	podSync := controllerCtx.sharedInformers.Core().V1().Pods().Informer().HasSynced
 	go func() {
 		start := time.Now()
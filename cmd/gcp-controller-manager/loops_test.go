@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateControllers(t *testing.T) {
+	cases := map[string]struct {
+		controllers []string
+		expectErr   bool
+	}{
+		"all":                   {controllers: []string{"*"}},
+		"loop":                  {controllers: []string{"node-annotator"}},
+		"disabled loop":         {controllers: []string{"-node-annotator", "*"}},
+		"group":                 {controllers: []string{"certificate-approvers", "certificate-signers"}},
+		"unregistered in group": {controllers: []string{"direct-path-with-workload-identity"}},
+		"disabled group":        {controllers: []string{"-certificate-signers", "*"}},
+		"unknown":               {controllers: []string{"node-annotater"}, expectErr: true},
+		"unknown disabled":      {controllers: []string{"-node-annotater", "*"}, expectErr: true},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := validateControllers(c.controllers)
+			if got, want := (err != nil), c.expectErr; got != want {
+				t.Errorf("unexpected error value: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsEnabled(t *testing.T) {
+	cases := map[string]struct {
+		controllers []string
+		want        map[string]bool
+	}{
+		"all": {
+			controllers: []string{"*"},
+			want:        map[string]bool{"node-annotator": true, "node-certificate-approver": true, "certificate-signer": true},
+		},
+		"loop": {
+			controllers: []string{"node-annotator"},
+			want:        map[string]bool{"node-annotator": true, "node-certificate-approver": false, "certificate-signer": false},
+		},
+		"group": {
+			controllers: []string{"certificate-approvers"},
+			want:        map[string]bool{"node-annotator": false, "node-certificate-approver": true, "policy-certificate-approver": true, "certificate-signer": false},
+		},
+		"disabled group": {
+			controllers: []string{"-certificate-approvers", "*"},
+			want:        map[string]bool{"node-annotator": true, "node-certificate-approver": false, "certificate-signer": true},
+		},
+		"loop enabled before its disabled group": {
+			controllers: []string{"node-certificate-approver", "-certificate-approvers", "*"},
+			want:        map[string]bool{"node-certificate-approver": true, "istiod-certificate-approver": false},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := &controllerManager{controllers: c.controllers}
+			for loop, want := range c.want {
+				if got := s.isEnabled(loop); got != want {
+					t.Errorf("isEnabled(%q) = %t, want %t", loop, got, want)
+				}
+			}
+		})
+	}
+}
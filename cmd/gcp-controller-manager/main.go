@@ -21,17 +21,21 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -46,6 +50,8 @@ import (
 	componentbaseconfig "k8s.io/component-base/config"
 	"k8s.io/component-base/config/options"
 	"k8s.io/component-base/logs"
+	logsapi "k8s.io/component-base/logs/api/v1"
+	_ "k8s.io/component-base/logs/json/register" // for JSON log format registration
 	"k8s.io/component-base/version/verflag"
 	"k8s.io/controller-manager/pkg/clientbuilder"
 	"k8s.io/klog/v2"
@@ -65,24 +71,65 @@ var (
 	kubeconfig                            = pflag.String("kubeconfig", "", "Path to kubeconfig file with authorization and master location information.")
 	clusterSigningGKEKubeconfig           = pflag.String("cluster-signing-gke-kubeconfig", "", "If set, use the kubeconfig file to call GKE to sign cluster-scoped certificates instead of using a local private key.")
 	gceConfigPath                         = pflag.String("gce-config", "/etc/gce.conf", "Path to gce.conf.")
-	controllers                           = pflag.StringSlice("controllers", []string{"*"}, "Controllers to enable. Possible controllers are: "+strings.Join(loopNames(), ",")+".")
+	leaderElectIdentity                   = pflag.String("leader-elect-identity", "", "Identity of this replica in the leader election Lease. Defaults to the hostname, which must then be unique across the replicas.")
+	controllers                           = pflag.StringSlice("controllers", []string{"*"}, "Controllers to enable, '*' for all of them, or disable with a '-' prefix, the first match winning. Possible controllers are: "+strings.Join(loopNames(), ",")+", and the groups "+strings.Join(loopGroupNames(), ",")+". Deployments running different controllers need different --leader-elect-resource-name.")
 	gceAPIEndpointOverride                = pflag.String("gce-api-endpoint-override", "", "If set, talks to a different GCE API Endpoint. By default it talks to https://www.googleapis.com/compute/v1/projects/")
 	directPath                            = pflag.Bool("direct-path", false, "Enable Direct Path.")
 	authAuthorizeServiceAccountMappingURL = pflag.String("auth-authorize-service-account-mapping-url", "", "URL for reaching the Auth Service AuthorizeServiceAccountMapping API.")
 	authSyncNodeURL                       = pflag.String("auth-sync-node-url", "", "URL for reaching the Auth Service SyncNode API.")
 	hmsAuthorizeSAMappingURL              = pflag.String("hms-authorize-sa-mapping-url", "", "URL for reaching the Hosted Master Service AuthorizeSAMapping API.")
 	hmsSyncNodeURL                        = pflag.String("hms-sync-node-url", "", "URL for reaching the Hosted Master Service SyncNode API.")
+	serviceAccountVerificationAudience    = pflag.String("service-account-verification-audience", "", "If set, the direct-path-with-workload-identity controller records whether each Kubernetes service account can act as the GCP service account of its iam.gke.io/gcp-service-account annotation in its verification.iam.gke.io/AUDIENCE annotation, as JSON with the gsa, status (Verified, Denied or Invalid), reason and lastTransitionTime, for the admission webhooks of the audience.")
 	autopilotEnabled                      = pflag.Bool("autopilot", false, "Is this a GKE Autopilot cluster.")
 	clearStalePodsOnNodeRegistration      = pflag.Bool("clearStalePodsOnNodeRegistration", false, "If true, after node registration, delete pods bound to old node.")
 	kubeconfigQPS                         = pflag.Float32("kubeconfig-qps", 100, "QPS to use while talking with kube-apiserver.")
 	kubeconfigBurst                       = pflag.Int("kubeconfig-burst", 200, "Burst to use while talking with kube-apiserver.")
+	verificationWebhookURLs               = pflag.StringSlice("node-csr-verification-webhooks", nil, "HTTPS URLs of external webhooks that must allow node CSRs before they are approved.")
+	verificationWebhookCAFile             = pflag.String("node-csr-verification-webhook-ca-file", "", "Path to a PEM bundle of the CA certificates against which the server certificates of the node CSR verification webhooks are verified. The system roots are used if empty.")
+	verificationWebhookTimeout            = pflag.Duration("node-csr-verification-webhook-timeout", 5*time.Second, "Timeout for each call to a node CSR verification webhook.")
+	verificationWebhookRetries            = pflag.Int("node-csr-verification-webhook-retries", 2, "Number of retries, with exponential backoff, of the calls to a node CSR verification webhook failing with a connection error, a timeout, or a 429 or 5xx response code.")
+	verificationWebhookFailurePolicy      = pflag.String("node-csr-verification-webhook-failure-policy", verificationWebhookFailurePolicyFail, "What to do with the node CSRs when a verification webhook fails after its retries. Fail keeps them pending until the webhook allows or denies them. Ignore approves them without the verdict of the webhook when it is unreachable, times out or answers 429 or 5xx, but skips it for a while after repeated such failures, keeping the CSRs pending meanwhile; other failures also keep the CSRs pending.")
+	preemptibleNodeTaint                  = pflag.String("preemptible-node-taint", "", "Taint, as KEY[=VALUE]:EFFECT, added by the node-annotator controller to the Nodes of Spot and Preemptible instances, which it labels cloud.google.com/gke-spot=true and cloud.google.com/gke-preemptible=true respectively. No taint is added if empty.")
+	nodeInstanceLabels                    = pflag.StringSlice("node-instance-labels", nil, "Keys of the GCE instance labels copied onto the labels of their Node by the node-annotator controller, as PREFIXKEY, and kept reconciled.")
+	nodeInstanceMetadataLabels            = pflag.StringSlice("node-instance-metadata-labels", nil, "Keys of the GCE instance metadata entries copied onto the labels of their Node by the node-annotator controller, as PREFIXmetadata-KEY, and kept reconciled. Values which are not valid label values are skipped.")
+	nodeInstanceLabelPrefix               = pflag.String("node-instance-label-prefix", "instance.gke.io/", "Prefix of the Node labels copied from the GCE instance labels and metadata entries.")
+	nodeMachineLabels                     = pflag.Bool("node-machine-labels", false, "If true, the node-annotator controller labels the Nodes with the machine family, CPU platform, local SSD count, GPU type and count, and network bandwidth tier of their GCE instance, under cloud.google.com/, and keeps them reconciled.")
+	nodeInstanceLabelResyncPeriod         = pflag.Duration("node-instance-label-resync-period", 10*time.Minute, "Period of the reconciliation of the Node labels copied from the GCE instance labels, metadata entries and machine attributes.")
+	nodeCSRApprovalPolicyFile             = pflag.String("node-csr-approval-policy-file", "", "Path to a policy narrowing down the node client and serving CSRs approved by the node-certificate-approver controller, by key usages, requester groups, project and instance groups, or requiring TPM attestation, and quarantining the suspicious ones until their cloud.google.com/csr-quarantine-override annotation is set. The file is reloaded when it changes.")
+	casSignerPools                        = pflag.StringToString("cas-signer-pools", nil, "Certificate Authority Service CA pools, as SIGNER_NAME=projects/PROJECT/locations/LOCATION/caPools/POOL, signing the approved CSRs of their signer name instead of the cluster CA. These CSRs are ignored by the certificate-signer controller.")
+	casSignerCertificateDuration          = pflag.Duration("cas-signer-certificate-duration", 365*24*time.Hour, "Maximum lifetime of the certificates issued by Certificate Authority Service CA pools. CSRs may request a shorter one with spec.expirationSeconds.")
+	instanceIdentityAudience              = pflag.String("node-csr-instance-identity-audience", "", "If set, the node-certificate-approver controller also approves the node client CSRs of the kubelet-bootstrap user attested by a GCE instance identity token of this audience followed by ?csr-key-sha256= and the hex-encoded SHA-256 hash of the DER-encoded public key of the CSR, requested with format=full and embedded in the CSR as an INSTANCE IDENTITY TOKEN PEM block or in its cloud.google.com/instance-identity-token annotation. For instances without a vTPM.")
+	nodeCSRApproverWorkers                = pflag.Int("node-csr-approver-workers", 20, "Number of CSRs the node-certificate-approver controller handles concurrently.")
+	nodeCSRApprovalQPS                    = pflag.Float32("node-csr-approval-qps", 0, "Maximum number of CSRs the node-certificate-approver controller handles per second, bounding its compute API calls during mass node creations. Unlimited if 0.")
+	nodeCSRApprovalBurst                  = pflag.Int("node-csr-approval-burst", 10, "Burst of CSRs the node-certificate-approver controller handles over node-csr-approval-qps.")
+	nodeCSRApprovalDryRun                 = pflag.Bool("node-csr-approval-dry-run", false, "If true, the node-certificate-approver controller evaluates the CSRs, logging what it would approve, deny or quarantine and recording it in the csr_dry_run_decision_count metric, without approving, denying or annotating them nor touching their Node, e.g. to try a new node CSR approval policy.")
+	nodeCertificateDegradedCondition      = pflag.Bool("node-certificate-degraded-condition", false, "If true, the node-certificate-approver controller sets the NodeCertificateDegraded condition of the Nodes whose CSRs it denies or repeatedly fails to verify, besides the events it records on them, and clears it when it approves one.")
+	nodeProjects                          = pflag.StringSlice("node-projects", nil, "Projects besides the cluster project whose GCE instances are trusted as nodes, and looked up in the zones of the cluster when validating node CSRs.")
+	nodeProjectServiceAccounts            = pflag.StringToString("node-project-service-accounts", nil, "Service accounts impersonated to look up the instances of node projects, as PROJECT=EMAIL. The instances of the other node projects are looked up with the credentials of the cluster project.")
+	nodeCSRInstanceCacheTTL               = pflag.Duration("node-csr-instance-cache-ttl", 0, "How long the node-certificate-approver controller caches the GCE instances it looks up, sharing the lookups of the several CSRs of a node and of concurrent CSRs. The instances which are not found are cached for a backoff starting at 1s and doubling up to this TTL while they stay not found. Instances are not cached if 0.")
+	csrApprovalPolicyFile                 = pflag.String("csr-approval-policy-file", "", "Path to a policy allowing the approval of CSRs for signers other than the node, istiod and OIDC ones, scoped by requester, subject, usages and DNS names. CSRs are only approved by the policy-certificate-approver controller if set.")
 )
 
+func init() {
+	utilruntime.Must(logsapi.AddFeatureGates(utilfeature.DefaultMutableFeatureGate))
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == genDashboardsCommand {
+		if err := genDashboards(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 
-	logs.AddFlags(pflag.CommandLine)
+	// --logging-format, -v and --vmodule are registered from the logging
+	// configuration so that e.g. JSON logs can be selected.
+	logOptions := logs.NewOptions()
+	logs.AddFlags(pflag.CommandLine, logs.SkipLoggingConfigurationFlags())
+	logsapi.AddFlags(logOptions, pflag.CommandLine)
 
 	leConfig := &componentbaseconfig.LeaderElectionConfiguration{
 		LeaderElect:   true,
@@ -90,12 +137,20 @@ func main() {
 		RenewDeadline: metav1.Duration{Duration: 10 * time.Second},
 		RetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
 		ResourceLock:  rl.LeasesResourceLock,
+		// Set so that deployments running different controllers can lead
+		// with different locks.
+		ResourceName:      leaderElectionResourceLockName,
+		ResourceNamespace: leaderElectionResourceLockNamespace,
 	}
 	options.BindLeaderElectionFlags(leConfig, pflag.CommandLine)
 
 	pflag.Parse()
 	verflag.PrintAndExitIfRequested()
 
+	if err := logsapi.ValidateAndApply(logOptions, utilfeature.DefaultFeatureGate); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 	// InitLogs should be called after parsing flags.
 	logs.InitLogs()
 
@@ -104,15 +159,36 @@ func main() {
 		gceConfigPath:                         *gceConfigPath,
 		gceAPIEndpointOverride:                *gceAPIEndpointOverride,
 		controllers:                           *controllers,
+		leaderElectIdentity:                   *leaderElectIdentity,
 		leaderElectionConfig:                  *leConfig,
 		authAuthorizeServiceAccountMappingURL: *authAuthorizeServiceAccountMappingURL,
 		authSyncNodeURL:                       *authSyncNodeURL,
 		hmsAuthorizeSAMappingURL:              *hmsAuthorizeSAMappingURL,
 		hmsSyncNodeURL:                        *hmsSyncNodeURL,
+		serviceAccountVerificationAudience:    *serviceAccountVerificationAudience,
 		healthz:                               healthz.NewHandler(),
+		leaderStatus:                          &leaderStatus{electing: leConfig.LeaderElect},
 		autopilotEnabled:                      *autopilotEnabled,
 		clearStalePodsOnNodeRegistration:      *clearStalePodsOnNodeRegistration,
+		verificationWebhookURLs:               *verificationWebhookURLs,
+		verificationWebhookTimeout:            *verificationWebhookTimeout,
+		verificationWebhookRetries:            *verificationWebhookRetries,
+		casSignerCertificateDuration:          *casSignerCertificateDuration,
+		nodeCSRApproverWorkers:                *nodeCSRApproverWorkers,
+		nodeCSRApprovalQPS:                    *nodeCSRApprovalQPS,
+		nodeCSRApprovalBurst:                  *nodeCSRApprovalBurst,
+		nodeCSRApprovalDryRun:                 *nodeCSRApprovalDryRun,
+		nodeCertificateDegradedCondition:      *nodeCertificateDegradedCondition,
+		verificationWebhookFailurePolicy:      *verificationWebhookFailurePolicy,
+		csrApprovalPolicyFile:                 *csrApprovalPolicyFile,
+		nodeCSRApprovalPolicyFile:             *nodeCSRApprovalPolicyFile,
+		nodeMachineLabels:                     *nodeMachineLabels,
+		nodeInstanceLabelResyncPeriod:         *nodeInstanceLabelResyncPeriod,
 	}
+	if err := validateControllers(s.controllers); err != nil {
+		klog.Exitf("invalid controllers: %v", err)
+	}
+
 	var err error
 	s.informerKubeconfig, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
 	if err != nil {
@@ -131,10 +207,70 @@ func main() {
 	if err != nil {
 		klog.Exitf("failed loading GCP config: %v", err)
 	}
+	if err := s.gcpConfig.configureNodeProjects(*nodeProjects, *nodeProjectServiceAccounts); err != nil {
+		klog.Exitf("invalid node projects: %v", err)
+	}
+	s.gcpConfig.InstanceCache = newInstanceCache(*nodeCSRInstanceCacheTTL)
+	if s.csrApprovalPolicyFile != "" {
+		s.csrApprovalPolicy, err = readCSRApprovalPolicy(s.csrApprovalPolicyFile)
+		if err != nil {
+			klog.Exitf("failed loading CSR approval policy: %v", err)
+		}
+	}
+
+	if s.nodeCSRApprovalPolicyFile != "" {
+		s.nodeCSRApprovalPolicy, err = watchNodeCSRApprovalPolicy(s.nodeCSRApprovalPolicyFile)
+		if err != nil {
+			klog.Exitf("failed loading node CSR approval policy: %v", err)
+		}
+	}
+
+	if p := s.verificationWebhookFailurePolicy; p != verificationWebhookFailurePolicyIgnore && p != verificationWebhookFailurePolicyFail {
+		klog.Exitf("invalid node CSR verification webhook failure policy %q, must be %q or %q", p, verificationWebhookFailurePolicyIgnore, verificationWebhookFailurePolicyFail)
+	}
+	if s.verificationWebhookRetries < 0 {
+		klog.Exitf("invalid node CSR verification webhook retries %d, must not be negative", s.verificationWebhookRetries)
+	}
+	if err := validateVerificationWebhookURLs(s.verificationWebhookURLs); err != nil {
+		klog.Exitf("invalid node CSR verification webhooks: %v", err)
+	}
+	if *verificationWebhookCAFile != "" {
+		s.verificationWebhookRootCAs, err = loadVerificationWebhookRootCAs(*verificationWebhookCAFile)
+		if err != nil {
+			klog.Exitf("failed loading node CSR verification webhook CA file: %v", err)
+		}
+	}
+
+	if *instanceIdentityAudience != "" {
+		s.instanceIdentityVerifier = newInstanceIdentityVerifier(*instanceIdentityAudience)
+	}
+
+	if s.nodeCSRApproverWorkers <= 0 {
+		klog.Exitf("invalid node CSR approver workers %d, must be positive", s.nodeCSRApproverWorkers)
+	}
+	if s.nodeCSRApprovalQPS < 0 || (s.nodeCSRApprovalQPS > 0 && s.nodeCSRApprovalBurst <= 0) {
+		klog.Exitf("invalid node CSR approval rate %v qps with a burst of %d", s.nodeCSRApprovalQPS, s.nodeCSRApprovalBurst)
+	}
+
+	s.casSignerPools, err = parseCASSignerPools(*casSignerPools)
+	if err != nil {
+		klog.Exitf("invalid Certificate Authority Service signer pools: %v", err)
+	}
+
+	s.preemptibleNodeTaint, err = parseProvisioningTaint(*preemptibleNodeTaint)
+	if err != nil {
+		klog.Exitf("invalid preemptible node taint: %v", err)
+	}
+
+	s.nodeInstanceLabels, err = newInstanceLabelSync(*nodeInstanceLabelPrefix, *nodeInstanceLabels, *nodeInstanceMetadataLabels)
+	if err != nil {
+		klog.Exitf("invalid node instance labels: %v", err)
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.Handle("/healthz", s.healthz)
+	mux.Handle("/healthz/leader", s.leaderStatus)
 	go func() {
 		klog.Exit(http.ListenAndServe(fmt.Sprintf(":%d", *port), mux))
 	}()
@@ -162,28 +298,53 @@ type controllerManager struct {
 	gceConfigPath                         string
 	gceAPIEndpointOverride                string
 	controllers                           []string
+	leaderElectIdentity                   string
 	leaderElectionConfig                  componentbaseconfig.LeaderElectionConfiguration
 	authAuthorizeServiceAccountMappingURL string
 	authSyncNodeURL                       string
 	hmsAuthorizeSAMappingURL              string
 	hmsSyncNodeURL                        string
+	serviceAccountVerificationAudience    string
 	autopilotEnabled                      bool
 	clearStalePodsOnNodeRegistration      bool
+	verificationWebhookURLs               []string
+	verificationWebhookRootCAs            *x509.CertPool
+	verificationWebhookTimeout            time.Duration
+	verificationWebhookRetries            int
+	casSignerPools                        map[string]string
+	casSignerCertificateDuration          time.Duration
+	instanceIdentityVerifier              *instanceIdentityVerifier
+	nodeCSRApproverWorkers                int
+	nodeCSRApprovalQPS                    float32
+	nodeCSRApprovalBurst                  int
+	nodeCSRApprovalDryRun                 bool
+	nodeCertificateDegradedCondition      bool
+	verificationWebhookFailurePolicy      string
+	csrApprovalPolicyFile                 string
+	nodeCSRApprovalPolicyFile             string
+	nodeMachineLabels                     bool
+	nodeInstanceLabelResyncPeriod         time.Duration
 
 	// Fields initialized from other sources.
 	gcpConfig            gcpConfig
 	informerKubeconfig   *restclient.Config
 	controllerKubeconfig *restclient.Config
 	healthz              *healthz.Handler
+	leaderStatus         *leaderStatus
+	csrApprovalPolicy    *csrApprovalPolicy
+	// nodeCSRApprovalPolicy is reloaded by the node-certificate-approver.
+	nodeCSRApprovalPolicy *nodeCSRApprovalPolicyWatcher
+	preemptibleNodeTaint  *v1.Taint
+	nodeInstanceLabels    *instanceLabelSync
 }
 
 func (s *controllerManager) isEnabled(name string) bool {
 	var star bool
 	for _, controller := range s.controllers {
-		if controller == name {
+		if controller == name || contains(loopGroups[controller], name) {
 			return true
 		}
-		if controller == "-"+name {
+		if controller == "-"+name || (strings.HasPrefix(controller, "-") && contains(loopGroups[controller[1:]], name)) {
 			return false
 		}
 		if controller == "*" {
@@ -232,7 +393,27 @@ func run(s *controllerManager) error {
 				authSyncNodeURL:                       s.authSyncNodeURL,
 				hmsAuthorizeSAMappingURL:              s.hmsAuthorizeSAMappingURL,
 				hmsSyncNodeURL:                        s.hmsSyncNodeURL,
+				serviceAccountVerificationAudience:    s.serviceAccountVerificationAudience,
 				clearStalePodsOnNodeRegistration:      s.clearStalePodsOnNodeRegistration,
+				verificationWebhookURLs:               s.verificationWebhookURLs,
+				verificationWebhookRootCAs:            s.verificationWebhookRootCAs,
+				verificationWebhookTimeout:            s.verificationWebhookTimeout,
+				verificationWebhookRetries:            s.verificationWebhookRetries,
+				casSignerPools:                        s.casSignerPools,
+				casSignerCertificateDuration:          s.casSignerCertificateDuration,
+				instanceIdentityVerifier:              s.instanceIdentityVerifier,
+				nodeCSRApprovalQPS:                    s.nodeCSRApprovalQPS,
+				nodeCSRApprovalBurst:                  s.nodeCSRApprovalBurst,
+				nodeCSRApprovalDryRun:                 s.nodeCSRApprovalDryRun,
+				nodeCertificateDegradedCondition:      s.nodeCertificateDegradedCondition,
+				nodeCSRApproverWorkers:                s.nodeCSRApproverWorkers,
+				verificationWebhookFailurePolicy:      s.verificationWebhookFailurePolicy,
+				csrApprovalPolicy:                     s.csrApprovalPolicy,
+				nodeCSRApprovalPolicy:                 s.nodeCSRApprovalPolicy,
+				preemptibleNodeTaint:                  s.preemptibleNodeTaint,
+				nodeInstanceLabels:                    s.nodeInstanceLabels,
+				nodeMachineLabels:                     s.nodeMachineLabels,
+				nodeInstanceLabelResyncPeriod:         s.nodeInstanceLabelResyncPeriod,
 			}); err != nil {
 				klog.Fatalf("Failed to start %q: %v", name, err)
 			}
@@ -246,7 +427,7 @@ func run(s *controllerManager) error {
 		if err != nil {
 			return err
 		}
-		leaderElectionConfig, err := makeLeaderElectionConfig(s.leaderElectionConfig, leaderElectionClient, eventBroadcaster.NewRecorder(legacyscheme.Scheme, v1.EventSource{
+		leaderElectionConfig, err := makeLeaderElectionConfig(s.leaderElectionConfig, s.leaderElectIdentity, leaderElectionClient, eventBroadcaster.NewRecorder(legacyscheme.Scheme, v1.EventSource{
 			Component: "gcp-controller-manager-leader-election",
 		}))
 		if err != nil {
@@ -264,6 +445,7 @@ func run(s *controllerManager) error {
 			return err
 		}
 		s.healthz.Checks["leader election"] = leaderElectorCheck(leaderElector)
+		s.leaderStatus.set(leaderElector)
 		leaderElector.Run(ctx)
 		return fmt.Errorf("should never reach this point")
 	}
@@ -272,20 +454,23 @@ func run(s *controllerManager) error {
 	return fmt.Errorf("should never reach this point")
 }
 
-func makeLeaderElectionConfig(config componentbaseconfig.LeaderElectionConfiguration, client clientset.Interface, recorder record.EventRecorder) (*leaderelection.LeaderElectionConfig, error) {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return nil, fmt.Errorf("unable to get hostname: %v", err)
+func makeLeaderElectionConfig(config componentbaseconfig.LeaderElectionConfiguration, identity string, client clientset.Interface, recorder record.EventRecorder) (*leaderelection.LeaderElectionConfig, error) {
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get hostname: %v", err)
+		}
+		identity = hostname
 	}
 
 	rl, err := resourcelock.New(
 		config.ResourceLock,
-		leaderElectionResourceLockNamespace,
-		leaderElectionResourceLockName,
+		config.ResourceNamespace,
+		config.ResourceName,
 		client.CoreV1(),
 		client.CoordinationV1(),
 		resourcelock.ResourceLockConfig{
-			Identity:      hostname,
+			Identity:      identity,
 			EventRecorder: recorder,
 		})
 	if err != nil {
@@ -324,3 +509,41 @@ func leaderElectorCheck(le *leaderelection.LeaderElector) healthz.Check {
 		return nil
 	}
 }
+
+// leader is the part of leaderelection.LeaderElector reporting the leader.
+type leader interface {
+	IsLeader() bool
+	GetLeader() string
+}
+
+// leaderStatus serves whether this replica is the leader, e.g. for the
+// readiness probe of the replicas, succeeding without leader election.
+type leaderStatus struct {
+	// electing is whether the replicas elect a leader.
+	electing bool
+
+	mu sync.RWMutex
+	le leader
+}
+
+func (l *leaderStatus) set(le leader) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.le = le
+}
+
+func (l *leaderStatus) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	l.mu.RLock()
+	le := l.le
+	l.mu.RUnlock()
+	switch {
+	case !l.electing:
+		fmt.Fprintln(rw, "ok: leader election disabled")
+	case le == nil:
+		http.Error(rw, "leader election not started", http.StatusServiceUnavailable)
+	case le.IsLeader():
+		fmt.Fprintln(rw, "ok: leader")
+	default:
+		http.Error(rw, fmt.Sprintf("not leader, the leader is %q", le.GetLeader()), http.StatusServiceUnavailable)
+	}
+}
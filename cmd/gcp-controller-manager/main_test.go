@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeLeader struct {
+	leader   string
+	isLeader bool
+}
+
+func (l fakeLeader) IsLeader() bool    { return l.isLeader }
+func (l fakeLeader) GetLeader() string { return l.leader }
+
+func TestLeaderStatus(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		electing   bool
+		le         leader
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			desc:       "leader election disabled",
+			wantStatus: http.StatusOK,
+			wantBody:   "disabled",
+		},
+		{
+			desc:       "leader election not started",
+			electing:   true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "not started",
+		},
+		{
+			desc:       "leader",
+			electing:   true,
+			le:         fakeLeader{leader: "r0", isLeader: true},
+			wantStatus: http.StatusOK,
+			wantBody:   "leader",
+		},
+		{
+			desc:       "follower",
+			electing:   true,
+			le:         fakeLeader{leader: "r1"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `the leader is "r1"`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			l := &leaderStatus{electing: tc.electing}
+			if tc.le != nil {
+				l.set(tc.le)
+			}
+			rw := httptest.NewRecorder()
+			l.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/healthz/leader", nil))
+			if rw.Code != tc.wantStatus {
+				t.Errorf("got status %d, want %d", rw.Code, tc.wantStatus)
+			}
+			if !strings.Contains(rw.Body.String(), tc.wantBody) {
+				t.Errorf("got body %q, want it to contain %q", rw.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
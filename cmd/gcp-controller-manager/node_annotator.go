@@ -26,6 +26,7 @@ import (
 
 	compute "google.golang.org/api/compute/v0.beta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	taintsutil "k8s.io/kubernetes/pkg/util/taints"
 
 	core "k8s.io/api/core/v1"
@@ -59,11 +60,17 @@ type nodeAnnotator struct {
 	hasSynced  func() bool
 	queue      workqueue.RateLimitingInterface
 	annotators []annotator
+	// resyncAnnotators are run on all the Nodes every resyncPeriod, queued
+	// in resyncQueue, while the annotators only run when the Nodes are added
+	// or reboot.
+	resyncAnnotators []annotator
+	resyncQueue      workqueue.RateLimitingInterface
+	resyncPeriod     time.Duration
 	// for testing
 	getInstance func(nodeURL string) (*compute.Instance, error)
 }
 
-func newNodeAnnotator(client clientset.Interface, nodeInformer coreinformers.NodeInformer, cs *compute.Service) (*nodeAnnotator, error) {
+func newNodeAnnotator(client clientset.Interface, nodeInformer coreinformers.NodeInformer, cs *compute.Service, provisioningTaint *core.Taint, instanceLabels *instanceLabelSync, machineLabels bool, resyncPeriod time.Duration) (*nodeAnnotator, error) {
 	gce := compute.NewInstancesService(cs)
 
 	// TODO(mikedanese): create a registry for the labels that GKE uses. This was
@@ -188,8 +195,38 @@ func newNodeAnnotator(client clientset.Interface, nodeInformer coreinformers.Nod
 					return true
 				},
 			},
+			{
+				name:     "provisioning-model-reconciler",
+				annotate: provisioningModelAnnotator(provisioningTaint),
+			},
 		},
 	}
+	if instanceLabels != nil {
+		ann := annotator{
+			name:     "instance-labels-reconciler",
+			annotate: instanceLabels.annotate,
+		}
+		na.annotators = append(na.annotators, ann)
+		// The instance labels and metadata change without Node events.
+		na.resyncAnnotators = append(na.resyncAnnotators, ann)
+		na.resyncPeriod = resyncPeriod
+	}
+	if machineLabels {
+		ann := annotator{
+			name:     "machine-labels-reconciler",
+			annotate: annotateMachineLabels,
+		}
+		na.annotators = append(na.annotators, ann)
+		// The machine attributes change while the instance is stopped, and are
+		// resynced in case the reboot of its Node was missed.
+		na.resyncAnnotators = append(na.resyncAnnotators, ann)
+		na.resyncPeriod = resyncPeriod
+	}
+	if len(na.resyncAnnotators) > 0 {
+		na.resyncQueue = workqueue.NewNamedRateLimitingQueue(workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(200*time.Millisecond, 1000*time.Second),
+		), "node-annotator-resync")
+	}
 	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    na.add,
 		UpdateFunc: na.update,
@@ -225,34 +262,66 @@ func (na *nodeAnnotator) Run(workers int, stopCh <-chan struct{}) {
 	for i := 0; i < workers; i++ {
 		go wait.Until(na.work, time.Second, stopCh)
 	}
+	if na.resyncQueue != nil && na.resyncPeriod > 0 {
+		go wait.Until(na.resyncWork, time.Second, stopCh)
+		go wait.Until(na.resync, na.resyncPeriod, stopCh)
+	}
 	<-stopCh
 }
 
-func (na *nodeAnnotator) processNextWorkItem() bool {
-	key, quit := na.queue.Get()
+// resync queues all the Nodes for the resyncAnnotators.
+func (na *nodeAnnotator) resync() {
+	nodes, err := na.ns.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't list nodes: %v", err))
+		return
+	}
+	for _, node := range nodes {
+		key, err := controller.KeyFunc(node)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("couldn't get key for object %+v: %v", node, err))
+			continue
+		}
+		na.resyncQueue.Add(key)
+	}
+}
+
+func (na *nodeAnnotator) processNextWorkItem(queue workqueue.RateLimitingInterface, annotators []annotator) bool {
+	key, quit := queue.Get()
 	if quit {
 		return false
 	}
-	defer na.queue.Done(key)
+	defer queue.Done(key)
 
-	err := na.sync(key.(string))
+	err := na.syncWith(key.(string), annotators)
 	if err != nil {
-		klog.Warningf("Requeue %v (%v times) due to err: %v", key, na.queue.NumRequeues(key), err)
-		na.queue.AddRateLimited(key)
+		klog.Warningf("Requeue %v (%v times) due to err: %v", key, queue.NumRequeues(key), err)
+		queue.AddRateLimited(key)
 		return true
 	}
 	// Item successfully proceeded, remove from rate limiter.
-	na.queue.Forget(key)
+	queue.Forget(key)
 	return true
 }
 
 func (na *nodeAnnotator) work() {
-	for na.processNextWorkItem() {
+	for na.processNextWorkItem(na.queue, na.annotators) {
+	}
+}
+
+func (na *nodeAnnotator) resyncWork() {
+	for na.processNextWorkItem(na.resyncQueue, na.resyncAnnotators) {
 	}
 }
 
 func (na *nodeAnnotator) sync(key string) error {
-	node, err := na.ns.Get(key)
+	return na.syncWith(key, na.annotators)
+}
+
+// syncWith runs the annotators on a copy of the Node and updates it if any
+// changed it.
+func (na *nodeAnnotator) syncWith(key string, annotators []annotator) error {
+	cached, err := na.ns.Get(key)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			klog.Infof("Node %v doesn't exist, dropping from the queue", key)
@@ -260,6 +329,9 @@ func (na *nodeAnnotator) sync(key string) error {
 		}
 		return err
 	}
+	// The annotators modify the Node, which must not be the one shared by
+	// the informer cache.
+	node := cached.DeepCopy()
 
 	instance, err := na.getInstance(node.Spec.ProviderID)
 	if err != nil {
@@ -267,7 +339,7 @@ func (na *nodeAnnotator) sync(key string) error {
 	}
 
 	var update bool
-	for _, ann := range na.annotators {
+	for _, ann := range annotators {
 		modified := ann.annotate(node, instance)
 		if modified {
 			klog.Infof("%q annotater acting on %q", ann.name, node.Name)
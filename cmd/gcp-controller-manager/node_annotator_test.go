@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -26,6 +27,7 @@ import (
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/fake"
 	v1lister "k8s.io/client-go/listers/core/v1"
@@ -602,6 +604,10 @@ type fakeNodeLister struct {
 
 func (f fakeNodeLister) Get(name string) (*core.Node, error) { return f.node, f.err }
 
+func (f fakeNodeLister) List(labels.Selector) ([]*core.Node, error) {
+	return []*core.Node{f.node}, f.err
+}
+
 func TestNodeAnnotatorSync(t *testing.T) {
 	node := &core.Node{
 		TypeMeta: v1.TypeMeta{
@@ -686,3 +692,46 @@ func TestNodeAnnotatorSync(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeAnnotatorResync(t *testing.T) {
+	node := &core.Node{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "test-node",
+		},
+	}
+	c := fake.NewSimpleClientset(node)
+	na := &nodeAnnotator{
+		c:           c,
+		ns:          fakeNodeLister{node: node},
+		getInstance: func(nodeURL string) (*compute.Instance, error) { return nil, nil },
+		resyncAnnotators: []annotator{{
+			name: "foo",
+			annotate: func(node *core.Node, _ *compute.Instance) bool {
+				node.Labels = map[string]string{"foo": "bar"}
+				return true
+			},
+		}},
+		queue:       workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		resyncQueue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+
+	na.resync()
+	if got := na.resyncQueue.Len(); got != 1 {
+		t.Fatalf("got %d queued Nodes, want 1", got)
+	}
+	if got := na.queue.Len(); got != 0 {
+		t.Errorf("got %d Nodes queued for the annotators, want 0", got)
+	}
+	na.processNextWorkItem(na.resyncQueue, na.resyncAnnotators)
+
+	updated, err := c.CoreV1().Nodes().Get(context.TODO(), node.Name, v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := updated.Labels["foo"]; got != "bar" {
+		t.Errorf("got label foo=%q on the updated Node, want bar", got)
+	}
+	if node.Labels != nil {
+		t.Errorf("the cached Node was modified: %v", node.Labels)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+
+	capi "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// nodeCertificateDegraded is the condition of the Nodes whose last
+	// certificate CSR was denied or repeatedly could not be verified.
+	nodeCertificateDegraded v1.NodeConditionType = "NodeCertificateDegraded"
+
+	nodeCSRDeniedReason       = "NodeCSRDenied"
+	nodeCSRUnverifiableReason = "NodeCSRUnverifiable"
+	nodeCSRApprovedReason     = "NodeCSRApproved"
+
+	// nodeCSRUnverifiableThreshold is the number of consecutive validation
+	// errors of a CSR after which it is reported on its Node, and again after
+	// each as many more.
+	nodeCSRUnverifiableThreshold = 3
+)
+
+// nodeAttestationStatus reports the node CSRs which are denied or cannot be
+// verified on the Node they are for, if it exists, with an event and
+// optionally its NodeCertificateDegraded condition, so that failed bootstraps
+// show up in kubectl describe node.
+type nodeAttestationStatus struct {
+	ctx          *controllerContext
+	setCondition bool
+
+	mu sync.Mutex
+	// failures counts the consecutive validation errors of the pending CSRs.
+	failures map[types.UID]int
+}
+
+func newNodeAttestationStatus(ctx *controllerContext) *nodeAttestationStatus {
+	return &nodeAttestationStatus{
+		ctx:          ctx,
+		setCondition: ctx.nodeCertificateDegradedCondition,
+		failures:     make(map[types.UID]int),
+	}
+}
+
+// denied reports the denied CSR on its Node.
+func (s *nodeAttestationStatus) denied(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest, msg string) {
+	if s == nil {
+		return
+	}
+	s.forget(csr)
+	s.report(csr, x509cr, v1.ConditionTrue, nodeCSRDeniedReason, fmt.Sprintf("CSR %q denied: %s", csr.Name, msg))
+}
+
+// failed counts the validation error of the CSR, reporting it on its Node
+// every nodeCSRUnverifiableThreshold consecutive errors.
+func (s *nodeAttestationStatus) failed(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failures[csr.UID]++
+	n := s.failures[csr.UID]
+	s.mu.Unlock()
+	if n%nodeCSRUnverifiableThreshold != 0 {
+		return
+	}
+	s.report(csr, x509cr, v1.ConditionTrue, nodeCSRUnverifiableReason, fmt.Sprintf("CSR %q could not be verified after %d attempts: %v", csr.Name, n, err))
+}
+
+// approved clears the NodeCertificateDegraded condition of the Node of the
+// approved CSR.
+func (s *nodeAttestationStatus) approved(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) {
+	if s == nil {
+		return
+	}
+	s.forget(csr)
+	if !s.setCondition {
+		return
+	}
+	s.updateCondition(nodeName(x509cr), v1.ConditionFalse, nodeCSRApprovedReason, fmt.Sprintf("CSR %q approved", csr.Name), true)
+}
+
+func (s *nodeAttestationStatus) forget(csr *capi.CertificateSigningRequest) {
+	s.mu.Lock()
+	delete(s.failures, csr.UID)
+	s.mu.Unlock()
+}
+
+func (s *nodeAttestationStatus) report(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest, status v1.ConditionStatus, reason, msg string) {
+	name := nodeName(x509cr)
+	if name == "" {
+		return
+	}
+	recordMetric := csrmetrics.OutboundRPCStartRecorder("k8s.Nodes.get")
+	node, err := s.ctx.client.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		recordMetric(csrmetrics.OutboundRPCStatusNotFound)
+		return
+	}
+	if err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		klog.Warningf("Failed to get node %q of CSR %q: %v", name, csr.Name, err)
+		return
+	}
+	recordMetric(csrmetrics.OutboundRPCStatusOK)
+	if s.ctx.recorder != nil {
+		s.ctx.recorder.Event(node, v1.EventTypeWarning, reason, msg)
+	}
+	if s.setCondition {
+		s.updateCondition(name, status, reason, msg, false)
+	}
+}
+
+// updateCondition sets the NodeCertificateDegraded condition of the Node,
+// only if it already has one when onlyIfSet.
+func (s *nodeAttestationStatus) updateCondition(name string, status v1.ConditionStatus, reason, msg string, onlyIfSet bool) {
+	if name == "" {
+		return
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := s.ctx.client.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		now := metav1.Now()
+		condition := v1.NodeCondition{
+			Type:               nodeCertificateDegraded,
+			Status:             status,
+			Reason:             reason,
+			Message:            msg,
+			LastHeartbeatTime:  now,
+			LastTransitionTime: now,
+		}
+		found := false
+		for i, c := range node.Status.Conditions {
+			if c.Type != nodeCertificateDegraded {
+				continue
+			}
+			found = true
+			if c.Status == status {
+				if c.Reason == reason && c.Message == msg {
+					return nil
+				}
+				condition.LastTransitionTime = c.LastTransitionTime
+			}
+			node.Status.Conditions[i] = condition
+		}
+		if !found {
+			if onlyIfSet {
+				return nil
+			}
+			node.Status.Conditions = append(node.Status.Conditions, condition)
+		}
+		recordMetric := csrmetrics.OutboundRPCStartRecorder("k8s.Nodes.updateStatus")
+		if _, err := s.ctx.client.CoreV1().Nodes().UpdateStatus(context.TODO(), node, metav1.UpdateOptions{}); err != nil {
+			recordMetric(csrmetrics.OutboundRPCStatusError)
+			return err
+		}
+		recordMetric(csrmetrics.OutboundRPCStatusOK)
+		return nil
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("Failed to update the %s condition of node %q: %v", nodeCertificateDegraded, name, err)
+	}
+}
+
+// nodeName returns the name of the Node of the node CSR, or "" if it is not
+// one.
+func nodeName(x509cr *x509.CertificateRequest) string {
+	if !strings.HasPrefix(x509cr.Subject.CommonName, "system:node:") {
+		return ""
+	}
+	return strings.TrimPrefix(x509cr.Subject.CommonName, "system:node:")
+}
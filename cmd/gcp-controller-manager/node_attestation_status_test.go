@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"strings"
+	"testing"
+
+	capi "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestNodeAttestationStatus(t *testing.T) {
+	csr := &capi.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-1", UID: "uid-1"}}
+	x509cr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:n0"}}
+	missingX509cr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:missing"}}
+
+	cases := []struct {
+		desc          string
+		setCondition  bool
+		report        func(s *nodeAttestationStatus)
+		wantEvents    []string
+		wantCondition v1.ConditionStatus
+	}{
+		{
+			desc:       "denied",
+			report:     func(s *nodeAttestationStatus) { s.denied(csr, x509cr, "bad") },
+			wantEvents: []string{"Warning NodeCSRDenied CSR \"csr-1\" denied: bad"},
+		},
+		{
+			desc:          "denied with condition",
+			setCondition:  true,
+			report:        func(s *nodeAttestationStatus) { s.denied(csr, x509cr, "bad") },
+			wantEvents:    []string{"Warning NodeCSRDenied CSR \"csr-1\" denied: bad"},
+			wantCondition: v1.ConditionTrue,
+		},
+		{
+			desc:         "denied without node",
+			setCondition: true,
+			report:       func(s *nodeAttestationStatus) { s.denied(csr, missingX509cr, "bad") },
+		},
+		{
+			desc:         "failed less than the threshold",
+			setCondition: true,
+			report: func(s *nodeAttestationStatus) {
+				for i := 0; i < nodeCSRUnverifiableThreshold-1; i++ {
+					s.failed(csr, x509cr, errors.New("unavailable"))
+				}
+			},
+		},
+		{
+			desc:         "failed repeatedly",
+			setCondition: true,
+			report: func(s *nodeAttestationStatus) {
+				for i := 0; i < nodeCSRUnverifiableThreshold; i++ {
+					s.failed(csr, x509cr, errors.New("unavailable"))
+				}
+			},
+			wantEvents:    []string{"Warning NodeCSRUnverifiable CSR \"csr-1\" could not be verified after 3 attempts: unavailable"},
+			wantCondition: v1.ConditionTrue,
+		},
+		{
+			desc:         "approval resets failures",
+			setCondition: true,
+			report: func(s *nodeAttestationStatus) {
+				for i := 0; i < nodeCSRUnverifiableThreshold-1; i++ {
+					s.failed(csr, x509cr, errors.New("unavailable"))
+				}
+				s.approved(csr, x509cr)
+				s.failed(csr, x509cr, errors.New("unavailable"))
+			},
+		},
+		{
+			desc:         "approved clears condition",
+			setCondition: true,
+			report: func(s *nodeAttestationStatus) {
+				s.denied(csr, x509cr, "bad")
+				s.approved(csr, x509cr)
+			},
+			wantEvents:    []string{"Warning NodeCSRDenied CSR \"csr-1\" denied: bad"},
+			wantCondition: v1.ConditionFalse,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			client := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n0"}})
+			recorder := record.NewFakeRecorder(10)
+			s := newNodeAttestationStatus(&controllerContext{
+				client:                           client,
+				recorder:                         recorder,
+				nodeCertificateDegradedCondition: c.setCondition,
+			})
+			c.report(s)
+
+			close(recorder.Events)
+			var events []string
+			for e := range recorder.Events {
+				events = append(events, e)
+			}
+			if got, want := strings.Join(events, "\n"), strings.Join(c.wantEvents, "\n"); got != want {
+				t.Errorf("got events %q, want %q", got, want)
+			}
+			node, err := client.CoreV1().Nodes().Get(context.Background(), "n0", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got v1.ConditionStatus
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == nodeCertificateDegraded {
+					got = condition.Status
+				}
+			}
+			if got != c.wantCondition {
+				t.Errorf("got %s condition %q, want %q", nodeCertificateDegraded, got, c.wantCondition)
+			}
+		})
+	}
+}
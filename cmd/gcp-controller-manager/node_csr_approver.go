@@ -35,7 +35,9 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
 	"k8s.io/klog/v2"
 	apipod "k8s.io/kubernetes/pkg/api/v1/pod"
@@ -50,9 +52,17 @@ const (
 	tpmKubeletUsername    = "kubelet-bootstrap"
 
 	authFlowLabelNone = "unknown"
+
+	// servingCertSANMismatchReason is the reason of the events recorded on
+	// the kubelet serving CSRs denied for SANs not matching their instance.
+	servingCertSANMismatchReason = "ServingCertificateSANMismatch"
 )
 
 var (
+	// computeRetryBackoff is the backoff between the retries of the compute
+	// API calls of the node approver.
+	computeRetryBackoff = &wait.Backoff{Duration: 500 * time.Millisecond, Factor: 2, Jitter: 0.1, Steps: 5}
+
 	// For the first startupErrorsThreshold after startupTime, label SAR errors
 	// differently.
 	// When kube-apiserver starts up (around the same time), it takes some time
@@ -70,12 +80,43 @@ var (
 type nodeApprover struct {
 	ctx        *controllerContext
 	validators []csrValidator
+	// verificationWebhooks are optional external verifiers that run after
+	// the validators for every recognized CSR.
+	verificationWebhooks []*verificationWebhook
+	// limiter bounds the rate of the CSRs handled, and so of their compute
+	// API calls, if set.
+	limiter flowcontrol.RateLimiter
+	// status reports the denied and unverifiable CSRs on their Node, if set.
+	status *nodeAttestationStatus
+	// dryRun only logs and records the decisions, leaving the CSRs and the
+	// Nodes untouched.
+	dryRun bool
+	// submissions counts the CSRs of the nodes for the quarantine of the
+	// node CSR approval policy.
+	submissions *csrSubmissions
 }
 
 func newNodeApprover(ctx *controllerContext) *nodeApprover {
+	validators := csrValidators()
+	if ctx.instanceIdentityVerifier != nil {
+		validators = append(validators, instanceIdentityValidator())
+	}
+	var limiter flowcontrol.RateLimiter
+	if ctx.nodeCSRApprovalQPS > 0 {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(ctx.nodeCSRApprovalQPS, ctx.nodeCSRApprovalBurst)
+	}
+	var status *nodeAttestationStatus
+	if !ctx.nodeCSRApprovalDryRun {
+		status = newNodeAttestationStatus(ctx)
+	}
 	return &nodeApprover{
-		ctx:        ctx,
-		validators: csrValidators(),
+		ctx:                  ctx,
+		validators:           validators,
+		limiter:              limiter,
+		status:               status,
+		dryRun:               ctx.nodeCSRApprovalDryRun,
+		submissions:          newCSRSubmissions(),
+		verificationWebhooks: newVerificationWebhooks(ctx.verificationWebhookURLs, ctx.verificationWebhookRootCAs, ctx.verificationWebhookTimeout, ctx.verificationWebhookRetries, ctx.verificationWebhookFailurePolicy),
 	}
 }
 
@@ -112,11 +153,21 @@ func (a *nodeApprover) handle(ctx context.Context, csr *capi.CertificateSigningR
 	if approved, denied := certificates.GetCertApprovalCondition(&csr.Status); approved || denied {
 		return nil
 	}
+	if a.limiter != nil {
+		if err := a.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
 	klog.Infof("approver got CSR %q", csr.Name)
+	recordDecision := csrmetrics.DecisionStartRecorder(csr.Spec.SignerName)
+	if a.dryRun {
+		recordDecision = csrmetrics.DryRunDecisionStartRecorder(csr.Spec.SignerName)
+	}
 
 	x509cr, err := certutil.ParseCSR(csr.Spec.Request)
 	if err != nil {
 		recordMetric(csrmetrics.ApprovalStatusParseError)
+		recordDecision(csrmetrics.DecisionError, csrmetrics.DenialReasonNone)
 		return fmt.Errorf("unable to parse csr %q: %v", csr.Name, err)
 	}
 
@@ -127,25 +178,61 @@ func (a *nodeApprover) handle(ctx context.Context, csr *capi.CertificateSigningR
 		}
 		klog.Infof("validator %q: matched CSR %q", r.name, csr.Name)
 		if r.validate != nil {
+			recordVerification := csrmetrics.AttestationVerificationStartRecorder(r.authFlowLabel)
 			ok, err := r.validate(a.ctx, csr, x509cr)
 			if err != nil {
+				recordVerification(csrmetrics.VerificationStatusError)
+				recordDecision(csrmetrics.DecisionError, csrmetrics.DenialReasonNone)
+				a.status.failed(csr, x509cr, err)
 				return fmt.Errorf("validating CSR %q: %v", csr.Name, err)
 			}
 			if !ok {
 				klog.Infof("validator %q: denied CSR %q", r.name, csr.Name)
+				recordVerification(csrmetrics.VerificationStatusReject)
+				recordDecision(csrmetrics.DecisionDeny, csrmetrics.DenialReasonValidation)
+				if a.dryRun {
+					klog.Infof("dry run: would deny CSR %q: %s", csr.Name, r.denyMsg)
+					return nil
+				}
 				recordValidatorMetric(csrmetrics.ApprovalStatusDeny)
+				a.status.denied(csr, x509cr, fmt.Sprintf("validator %q denied it", r.name))
 				return a.updateCSR(csr, false, r.denyMsg)
 			}
+			recordVerification(csrmetrics.VerificationStatusOK)
+		}
+		denyMsg, quarantineReason, denialReason, err := a.checkPolicy(ctx, r, csr, x509cr)
+		switch {
+		case err != nil:
+			recordDecision(csrmetrics.DecisionError, csrmetrics.DenialReasonNone)
+			a.status.failed(csr, x509cr, err)
+			return fmt.Errorf("validating CSR %q: %v", csr.Name, err)
+		case denyMsg != "":
+			recordDecision(csrmetrics.DecisionDeny, denialReason)
+			if a.dryRun {
+				klog.Infof("dry run: would deny CSR %q: %s", csr.Name, denyMsg)
+				return nil
+			}
+			recordValidatorMetric(csrmetrics.ApprovalStatusDeny)
+			a.status.denied(csr, x509cr, denyMsg)
+			return a.updateCSR(csr, false, denyMsg)
+		case quarantineReason != "":
+			recordDecision(csrmetrics.DecisionQuarantine, denialReason)
+			if a.dryRun {
+				klog.Infof("dry run: would quarantine CSR %q: %s", csr.Name, quarantineReason)
+				return nil
+			}
+			return a.quarantine(csr, quarantineReason)
 		}
 		klog.Infof("CSR %q validation passed", csr.Name)
 
-		approved, err := a.authorizeSAR(csr, r.permission)
+		approved, err := authorizeSAR(a.ctx, csr, r.permission)
 		if err != nil {
 			if time.Since(startupTime) < startupErrorsThreshold {
 				recordValidatorMetric(csrmetrics.ApprovalStatusSARErrorAtStartup)
 			} else {
 				recordValidatorMetric(csrmetrics.ApprovalStatusSARError)
 			}
+			recordDecision(csrmetrics.DecisionError, csrmetrics.DenialReasonNone)
 			return err
 		}
 		if !approved {
@@ -154,26 +241,81 @@ func (a *nodeApprover) handle(ctx context.Context, csr *capi.CertificateSigningR
 			} else {
 				recordValidatorMetric(csrmetrics.ApprovalStatusSARReject)
 			}
+			recordDecision(csrmetrics.DecisionIgnore, csrmetrics.DenialReasonNone)
 			return certificates.IgnorableError("recognized csr %q as %q but subject access review was not approved", csr.Name, r.name)
 		}
 		klog.Infof("validator %q: SubjectAccessReview approved for CSR %q", r.name, csr.Name)
+		if a.dryRun {
+			klog.Infof("dry run: would approve CSR %q: %s", csr.Name, r.approveMsg)
+			recordDecision(csrmetrics.DecisionApprove, csrmetrics.DenialReasonNone)
+			return nil
+		}
 		if r.preApproveHook != nil {
 			if err := r.preApproveHook(a.ctx, csr, x509cr); err != nil {
 				klog.Warningf("validator %q: preApproveHook failed for CSR %q: %v", r.name, csr.Name, err)
 				recordValidatorMetric(csrmetrics.ApprovalStatusPreApproveHookError)
+				recordDecision(csrmetrics.DecisionError, csrmetrics.DenialReasonNone)
 				return err
 			}
 			klog.Infof("validator %q: preApproveHook passed for CSR %q", r.name, csr.Name)
 		}
 		recordValidatorMetric(csrmetrics.ApprovalStatusApprove)
+		recordDecision(csrmetrics.DecisionApprove, csrmetrics.DenialReasonNone)
+		a.status.approved(csr, x509cr)
 		return a.updateCSR(csr, true, r.approveMsg)
 	}
 
 	klog.Infof("no validators matched CSR %q", csr.Name)
 	recordMetric(csrmetrics.ApprovalStatusIgnore)
+	recordDecision(csrmetrics.DecisionIgnore, csrmetrics.DenialReasonNone)
 	return nil
 }
 
+// checkPolicy checks the CSR recognized by the validator against the node CSR
+// approval policy, its quarantine and the verification webhooks. It returns
+// the message to deny the CSR with or the reason to quarantine it for, if any,
+// with the reason recorded in the decision metrics.
+func (a *nodeApprover) checkPolicy(ctx context.Context, r csrValidator, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (denyMsg, quarantineReason string, denialReason csrmetrics.DenialReason, err error) {
+	if a.ctx.nodeCSRApprovalPolicy != nil {
+		reason, err := a.ctx.nodeCSRApprovalPolicy.get().check(a.ctx, csr, x509cr)
+		if err != nil {
+			return "", "", csrmetrics.DenialReasonNone, err
+		}
+		if reason != "" {
+			klog.Infof("validator %q: node CSR approval policy denied CSR %q: %s", r.name, csr.Name, reason)
+			return fmt.Sprintf("Denied by node CSR approval policy: %s", reason), "", csrmetrics.DenialReasonPolicy, nil
+		}
+		if q := a.ctx.nodeCSRApprovalPolicy.get().Quarantine; q != nil && csr.Annotations[csrQuarantineOverrideAnnotation] != csrQuarantineOverrideApprove {
+			reason, metricReason, err := q.check(a.ctx, a.submissions, csr, x509cr)
+			if err != nil {
+				return "", "", csrmetrics.DenialReasonNone, err
+			}
+			if reason != "" && csr.Annotations[csrQuarantineOverrideAnnotation] == csrQuarantineOverrideDeny {
+				klog.Infof("validator %q: quarantined CSR %q denied by override: %s", r.name, csr.Name, reason)
+				return fmt.Sprintf("Denied by quarantine override: %s", reason), "", csrmetrics.DenialReasonOverride, nil
+			}
+			if reason != "" {
+				return "", reason, metricReason, nil
+			}
+		}
+	}
+	for _, w := range a.verificationWebhooks {
+		allowed, reason, err := w.verify(ctx, csr, x509cr)
+		if err != nil && w.ignore(err) {
+			klog.Warningf("validator %q: ignoring failed verification webhook %q for CSR %q: %v", r.name, w.url, csr.Name, err)
+			continue
+		}
+		if err != nil {
+			return "", "", csrmetrics.DenialReasonNone, err
+		}
+		if !allowed {
+			klog.Infof("validator %q: verification webhook %q denied CSR %q: %s", r.name, w.url, csr.Name, reason)
+			return fmt.Sprintf("Denied by verification webhook: %s", reason), "", csrmetrics.DenialReasonVerificationWebhook, nil
+		}
+	}
+	return "", "", csrmetrics.DenialReasonNone, nil
+}
+
 func (a *nodeApprover) updateCSR(csr *capi.CertificateSigningRequest, approved bool, msg string) error {
 	if approved {
 		csr.Status.Conditions = append(csr.Status.Conditions, capi.CertificateSigningRequestCondition{
@@ -231,7 +373,8 @@ type csrValidator struct {
 	preApproveHook preApproveHookFunc
 }
 
-func (a *nodeApprover) authorizeSAR(csr *capi.CertificateSigningRequest, rattrs authorization.ResourceAttributes) (bool, error) {
+// authorizeSAR reports whether the requester of the CSR is allowed rattrs.
+func authorizeSAR(ctx *controllerContext, csr *capi.CertificateSigningRequest, rattrs authorization.ResourceAttributes) (bool, error) {
 	extra := make(map[string]authorization.ExtraValue)
 	for k, v := range csr.Spec.Extra {
 		extra[k] = authorization.ExtraValue(v)
@@ -246,7 +389,7 @@ func (a *nodeApprover) authorizeSAR(csr *capi.CertificateSigningRequest, rattrs
 			ResourceAttributes: &rattrs,
 		},
 	}
-	sar, err := a.ctx.client.AuthorizationV1().SubjectAccessReviews().Create(context.TODO(), sar, metav1.CreateOptions{})
+	sar, err := ctx.client.AuthorizationV1().SubjectAccessReviews().Create(context.TODO(), sar, metav1.CreateOptions{})
 	if err != nil {
 		return false, err
 	}
@@ -341,7 +484,7 @@ func isNodeServerCert(csr *capi.CertificateSigningRequest, x509cr *x509.Certific
 	return csr.Spec.Username == x509cr.Subject.CommonName
 }
 
-// Only check that IPs in SAN match an existing VM in the project.
+// Only check that IPs in SAN match an existing VM in the node projects.
 // Username was already checked against CN, so this CSR is coming from
 // authenticated kubelet.
 func validateNodeServerCert(ctx *controllerContext, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (bool, error) {
@@ -354,50 +497,69 @@ func validateNodeServerCert(ctx *controllerContext, csr *capi.CertificateSigning
 		return false, nil
 	}
 
-	srv := compute.NewInstancesService(ctx.gcpCfg.Compute)
 	instanceName := strings.TrimPrefix(csr.Spec.Username, "system:node:")
-	for _, z := range ctx.gcpCfg.Zones {
-		inst, err := srv.Get(ctx.gcpCfg.ProjectID, z, instanceName).Do()
-		if err != nil {
-			if isNotFound(err) {
-				continue
+	for _, project := range ctx.gcpCfg.nodeProjects() {
+		for _, z := range ctx.gcpCfg.Zones {
+			inst, err := getInstance(ctx, project, z, instanceName)
+			if err != nil {
+				if isNotFound(err) {
+					continue
+				}
+				return false, err
 			}
-			return false, err
-		}
 
-		// Format the Domain-scoped projectID before validating the DNS name, e.g. example.com:my-project-123456789012
-		projectID := ctx.gcpCfg.ProjectID
-		if strings.Contains(projectID, ":") {
-			parts := strings.Split(projectID, ":")
-			if len(parts) != 2 {
-				klog.Infof("expected the Domain-scoped project to contain only one colon, got: %s", projectID)
-				return false, err
+			// Format the Domain-scoped projectID before validating the DNS name, e.g. example.com:my-project-123456789012
+			projectID := project
+			if strings.Contains(projectID, ":") {
+				parts := strings.Split(projectID, ":")
+				if len(parts) != 2 {
+					klog.Infof("expected the Domain-scoped project to contain only one colon, got: %s", projectID)
+					return false, err
+				}
+				projectID = fmt.Sprintf("%s.%s", parts[1], parts[0])
 			}
-			projectID = fmt.Sprintf("%s.%s", parts[1], parts[0])
-		}
 
-		for _, dns := range x509cr.DNSNames {
 			// Linux DNSName should be as the format of [INSTANCE_NAME].c.[PROJECT_ID].internal when using the global DNS, and [INSTANCE_NAME].[ZONE].c.[PROJECT_ID].internal when using zonal DNS.
 			// Windows DNSName should be INSTANCE_NAME
-			if dns != instanceName && dns != fmt.Sprintf("%s.c.%s.internal", instanceName, projectID) && dns != fmt.Sprintf("%s.%s.c.%s.internal", instanceName, z, projectID) {
-				klog.Infof("deny CSR %q: DNSName in CSR (%q) doesn't match default DNS format on instance %q", csr.Name, dns, instanceName)
-				return false, nil
+			instDNSNames := []string{instanceName, fmt.Sprintf("%s.c.%s.internal", instanceName, projectID), fmt.Sprintf("%s.%s.c.%s.internal", instanceName, z, projectID)}
+			if inst.Hostname != "" {
+				instDNSNames = append(instDNSNames, inst.Hostname)
 			}
-		}
-		instIps := getInstanceIps(inst.NetworkInterfaces)
-	scanIPs:
-		for _, ip := range x509cr.IPAddresses {
-			for _, instIP := range instIps {
-				if ip.Equal(net.ParseIP(instIP)) {
-					continue scanIPs
+			var extraDNSNames []string
+			for _, dns := range x509cr.DNSNames {
+				if !contains(instDNSNames, dns) {
+					extraDNSNames = append(extraDNSNames, dns)
 				}
 			}
-			klog.Infof("deny CSR %q: IP addresses in CSR (%q) don't match NetworkInterfaces on instance %q (%+v)", csr.Name, x509cr.IPAddresses, instanceName, instIps)
-			return false, nil
+			instIps := getInstanceIps(inst.NetworkInterfaces)
+			aliasRanges := getInstanceAliasIPRanges(inst.NetworkInterfaces)
+			var extraIPs []string
+		scanIPs:
+			for _, ip := range x509cr.IPAddresses {
+				for _, instIP := range instIps {
+					if ip.Equal(net.ParseIP(instIP)) {
+						continue scanIPs
+					}
+				}
+				for _, aliasRange := range aliasRanges {
+					if aliasRange.Contains(ip) {
+						continue scanIPs
+					}
+				}
+				extraIPs = append(extraIPs, ip.String())
+			}
+			if len(extraDNSNames) != 0 || len(extraIPs) != 0 {
+				msg := fmt.Sprintf("SANs don't match instance %q: DNS names %q not in %q, IP addresses %q not in %q or alias IP ranges %q", instanceName, extraDNSNames, instDNSNames, extraIPs, instIps, aliasRanges)
+				klog.Infof("deny CSR %q: %s", csr.Name, msg)
+				if ctx.recorder != nil {
+					ctx.recorder.Event(csr, v1.EventTypeWarning, servingCertSANMismatchReason, msg)
+				}
+				return false, nil
+			}
+			return true, nil
 		}
-		return true, nil
 	}
-	klog.Infof("deny CSR %q: instance name %q doesn't match any VM in cluster project/zone", csr.Name, instanceName)
+	klog.Infof("deny CSR %q: instance name %q doesn't match any VM in node projects/cluster zones", csr.Name, instanceName)
 	return false, nil
 }
 
@@ -422,6 +584,32 @@ func getInstanceIps(ifaces []*compute.NetworkInterface) []string {
 	return ips
 }
 
+// getInstanceAliasIPRanges returns the alias IP ranges of the network
+// interfaces, e.g. the Pod ranges of the instance.
+func getInstanceAliasIPRanges(ifaces []*compute.NetworkInterface) []*net.IPNet {
+	var ranges []*net.IPNet
+	for _, iface := range ifaces {
+		for _, r := range iface.AliasIpRanges {
+			// A range of a single IP may have no prefix length.
+			cidr := r.IpCidrRange
+			if !strings.Contains(cidr, "/") {
+				if strings.Contains(cidr, ":") {
+					cidr += "/128"
+				} else {
+					cidr += "/32"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				klog.Warningf("ignoring invalid alias IP range %q: %v", r.IpCidrRange, err)
+				continue
+			}
+			ranges = append(ranges, ipNet)
+		}
+	}
+	return ranges
+}
+
 func isNotFound(err error) bool {
 	gerr, ok := err.(*googleapi.Error)
 	return ok && gerr.Code == http.StatusNotFound
@@ -595,21 +783,73 @@ func markFailedAndDeletePodWithCondition(ctx *controllerContext, pod *v1.Pod) er
 	return ctx.client.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, *metav1.NewDeleteOptions(0))
 }
 
+// getInstanceByName looks the instance up in the zones of the cluster, in the
+// cluster project and then in the other node projects.
 func getInstanceByName(ctx *controllerContext, instanceName string) (*compute.Instance, error) {
-	srv := compute.NewInstancesService(ctx.gcpCfg.Compute)
-	for _, z := range ctx.gcpCfg.Zones {
-		recordMetric := csrmetrics.OutboundRPCStartRecorder("compute.InstancesService.Get")
-		inst, err := srv.Get(ctx.gcpCfg.ProjectID, z, instanceName).Do()
-		if err != nil {
-			if isNotFound(err) {
-				recordMetric(csrmetrics.OutboundRPCStatusNotFound)
-				continue
+	for _, project := range ctx.gcpCfg.nodeProjects() {
+		for _, z := range ctx.gcpCfg.Zones {
+			inst, err := getInstance(ctx, project, z, instanceName)
+			if err != nil {
+				if isNotFound(err) {
+					continue
+				}
+				return nil, err
 			}
-			recordMetric(csrmetrics.OutboundRPCStatusError)
-			return nil, err
+			return inst, nil
 		}
-		recordMetric(csrmetrics.OutboundRPCStatusOK)
-		return inst, nil
 	}
 	return nil, errInstanceNotFound
 }
+
+// getInstance gets the instance in the zone of the node project, retrying
+// with computeRetryBackoff while the compute API is rate limiting or
+// unavailable, as during mass node creations. The instance is looked up in
+// the instance cache first, if any.
+func getInstance(ctx *controllerContext, project, zone, instanceName string) (*compute.Instance, error) {
+	return ctx.gcpCfg.InstanceCache.get(project, zone, instanceName, func() (*compute.Instance, error) {
+		return fetchInstance(ctx, project, zone, instanceName)
+	})
+}
+
+func fetchInstance(ctx *controllerContext, project, zone, instanceName string) (*compute.Instance, error) {
+	srv := compute.NewInstancesService(ctx.gcpCfg.computeFor(project))
+	var inst *compute.Instance
+	var err error
+	wait.ExponentialBackoff(*computeRetryBackoff, func() (bool, error) {
+		recordMetric := csrmetrics.OutboundRPCStartRecorder("compute.InstancesService.Get")
+		inst, err = srv.Get(project, zone, instanceName).Do()
+		switch {
+		case err == nil:
+			recordMetric(csrmetrics.OutboundRPCStatusOK)
+		case isNotFound(err):
+			recordMetric(csrmetrics.OutboundRPCStatusNotFound)
+		default:
+			recordMetric(csrmetrics.OutboundRPCStatusError)
+			if isRetryableComputeError(err) {
+				klog.V(2).Infof("retrying to get instance %q in project %q zone %q: %v", instanceName, project, zone, err)
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	// err is the last error once the retries are exhausted.
+	return inst, err
+}
+
+// isRetryableComputeError returns whether the compute API call failed because
+// of rate limiting, quota or a server error.
+func isRetryableComputeError(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	if gerr.Code == http.StatusTooManyRequests || gerr.Code >= http.StatusInternalServerError {
+		return true
+	}
+	for _, e := range gerr.Errors {
+		if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" || e.Reason == "quotaExceeded" {
+			return true
+		}
+	}
+	return false
+}
@@ -31,7 +31,10 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -47,8 +50,10 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/fake"
 	testclient "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	certutil "k8s.io/kubernetes/pkg/apis/certificates/v1"
 	"k8s.io/utils/pointer"
@@ -296,11 +301,188 @@ func TestNodeApproverHandle(t *testing.T) {
 	}
 }
 
+func TestNodeApproverDryRun(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		username    string
+		validated   bool
+		wantActions int
+	}{
+		{desc: "would approve", username: "kubelet-bootstrap", validated: true, wantActions: 1},
+		{desc: "would quarantine", username: "someone", validated: true, wantActions: 0},
+		{desc: "would deny", username: "kubelet-bootstrap", validated: false, wantActions: 0},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			client := &fake.Clientset{}
+			client.AddReactor("create", "subjectaccessreviews", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+				return true, &authorization.SubjectAccessReview{
+					Status: authorization.SubjectAccessReviewStatus{Allowed: true},
+				}, nil
+			})
+			policy := &nodeCSRApprovalPolicyWatcher{policy: &nodeCSRApprovalPolicy{
+				Quarantine: &nodeCSRQuarantine{Usernames: []string{"kubelet-bootstrap"}},
+			}}
+			approver := newNodeApprover(&controllerContext{client: client, nodeCSRApprovalPolicy: policy, nodeCSRApprovalDryRun: true})
+			if approver.status != nil {
+				t.Errorf("got Node status reporting in dry run")
+			}
+			approver.validators = []csrValidator{{
+				approveMsg: "tester",
+				permission: authorization.ResourceAttributes{Group: "foo", Resource: "bar", Subresource: "baz"},
+				recognize: func(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) bool {
+					return true
+				},
+				validate: func(ctx *controllerContext, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (bool, error) {
+					return tc.validated, nil
+				},
+				preApproveHook: func(_ *controllerContext, _ *capi.CertificateSigningRequest, _ *x509.CertificateRequest) error {
+					t.Errorf("preApproveHook called in dry run")
+					return nil
+				},
+			}}
+			csr := makeTestCSR(t)
+			csr.Spec.Username = tc.username
+			if err := approver.handle(context.TODO(), csr); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			// Only the SubjectAccessReview is created, the CSR is not updated.
+			if as := client.Actions(); len(as) != tc.wantActions {
+				t.Errorf("expected %d calls but got: %#v", tc.wantActions, as)
+			}
+			if len(csr.Status.Conditions) != 0 {
+				t.Errorf("got CSR conditions %v, want none", csr.Status.Conditions)
+			}
+			if _, ok := csr.Annotations[csrQuarantinedAnnotation]; ok {
+				t.Errorf("got CSR annotated as quarantined in dry run")
+			}
+		})
+	}
+}
+
 // stringPointer copies a constant string and returns a pointer to the copy.
 func stringPointer(str string) *string {
 	return &str
 }
 
+func TestNodeApproverVerificationWebhookCircuitOpen(t *testing.T) {
+	client := &fake.Clientset{}
+	client.AddReactor("create", "subjectaccessreviews", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+		return true, &authorization.SubjectAccessReview{
+			Status: authorization.SubjectAccessReviewStatus{Allowed: true},
+		}, nil
+	})
+	approver := newNodeApprover(&controllerContext{
+		client:                           client,
+		verificationWebhookURLs:          []string{"http://127.0.0.1:0"},
+		verificationWebhookFailurePolicy: verificationWebhookFailurePolicyIgnore,
+	})
+	approver.validators = []csrValidator{{
+		approveMsg: "tester",
+		permission: authorization.ResourceAttributes{Group: "foo", Resource: "bar", Subresource: "baz"},
+		recognize: func(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) bool {
+			return true
+		},
+	}}
+	approver.verificationWebhooks[0].openUntil = time.Now().Add(time.Hour)
+
+	csr := makeTestCSR(t)
+	if err := approver.handle(context.TODO(), csr); err == nil || !strings.Contains(err.Error(), errVerificationWebhookCircuitOpen.Error()) {
+		t.Errorf("got err %v, want %v", err, errVerificationWebhookCircuitOpen)
+	}
+	if len(csr.Status.Conditions) != 0 {
+		t.Errorf("got CSR conditions %v, want none", csr.Status.Conditions)
+	}
+}
+
+func TestGetInstanceRetries(t *testing.T) {
+	defer func(backoff *wait.Backoff) { computeRetryBackoff = backoff }(computeRetryBackoff)
+	computeRetryBackoff = &wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+	for _, tc := range []struct {
+		desc         string
+		failures     int32
+		code         int
+		wantRequests int32
+		wantErr      bool
+	}{
+		{
+			desc:         "rate limited",
+			failures:     2,
+			code:         http.StatusTooManyRequests,
+			wantRequests: 3,
+		},
+		{
+			desc:         "unavailable",
+			failures:     1,
+			code:         http.StatusServiceUnavailable,
+			wantRequests: 2,
+		},
+		{
+			desc:         "retries exhausted",
+			failures:     3,
+			code:         http.StatusInternalServerError,
+			wantRequests: 3,
+			wantErr:      true,
+		},
+		{
+			desc:         "not retried",
+			failures:     1,
+			code:         http.StatusForbidden,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tc.failures {
+					http.Error(rw, "failed", tc.code)
+					return
+				}
+				json.NewEncoder(rw).Encode(compute.Instance{Name: "i0"})
+			}))
+			defer srv.Close()
+			client := srv.Client()
+			client.Transport = fakeTransport{srv.URL}
+			cs, err := compute.New(client)
+			if err != nil {
+				t.Fatalf("creating GCE API client: %v", err)
+			}
+			ctx := &controllerContext{}
+			ctx.gcpCfg.Compute = cs
+			ctx.gcpCfg.ProjectID = "p0"
+
+			inst, err := getInstance(ctx, "p0", "z0", "i0")
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("getInstance() got err %v, want error %t", err, tc.wantErr)
+			}
+			if !tc.wantErr && inst.Name != "i0" {
+				t.Errorf("getInstance() got instance %q, want i0", inst.Name)
+			}
+			if got := atomic.LoadInt32(&requests); got != tc.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tc.wantRequests)
+			}
+		})
+	}
+}
+
+func TestNodeApproverRateLimit(t *testing.T) {
+	approver := newNodeApprover(&controllerContext{nodeCSRApprovalQPS: 0.001, nodeCSRApprovalBurst: 1})
+	csr := makeTestCSR(t)
+	csr.Spec.Request = []byte("not a CSR")
+
+	// The burst is used by the first CSR, so that the second one waits until
+	// its context is done.
+	if err := approver.handle(context.Background(), csr); err == nil {
+		t.Fatalf("handle() of an invalid CSR succeeded")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := approver.handle(ctx, csr); err == nil || !strings.Contains(err.Error(), "rate") {
+		t.Errorf("handle() got err %v, want rate limiter error", err)
+	}
+}
+
 func TestValidators(t *testing.T) {
 	t.Run("isLegacyNodeClientCert", func(t *testing.T) {
 		goodCase := func(b *csrBuilder, _ *controllerContext) {
@@ -413,17 +595,31 @@ func TestValidators(t *testing.T) {
 			b.ips = []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("2600:1900:1:1:0:5::")}
 			b.dns = []string{"ds1.z0.c.p0.internal", "ds1.c.p0.internal", "ds1"}
 		}
+		aliasCase := func(b *csrBuilder, c *controllerContext) {
+			c.gcpCfg.ProjectID = "p0"
+			c.gcpCfg.Zones = []string{"z1", "z0"}
+			b.requestor = "system:node:a0"
+			b.ips = []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("10.0.0.7"), net.ParseIP("10.1.0.1")}
+			b.dns = []string{"a0.z0.c.p0.internal", "a0.c.p0.internal", "a0", "a0.example.com"}
+		}
 		cases := []func(*csrBuilder, *controllerContext){
 			// None Domain-scoped project
 			goodCase,
 			dualStackCase,
 			dualStackExtCase,
+			aliasCase,
 			// Domain-scoped project
 			func(b *csrBuilder, c *controllerContext) {
 				goodCase(b, c)
 				c.gcpCfg.ProjectID = "p0:p1"
 				b.dns = []string{"i0.z0.c.p1.p0.internal", "i0.c.p1.p0.internal", "i0"}
 			},
+			// Instance in a node project.
+			func(b *csrBuilder, c *controllerContext) {
+				goodCase(b, c)
+				c.gcpCfg.ProjectID = "p99"
+				c.gcpCfg.NodeProjects = []string{"p98", "p0"}
+			},
 		}
 		testValidator(t, "good", cases, fn, true, false)
 
@@ -444,6 +640,19 @@ func TestValidators(t *testing.T) {
 				goodCase(b, c)
 				c.gcpCfg.ProjectID = "p99"
 			},
+			// Wrong node project.
+			func(b *csrBuilder, c *controllerContext) {
+				goodCase(b, c)
+				c.gcpCfg.ProjectID = "p99"
+				c.gcpCfg.NodeProjects = []string{"p98"}
+			},
+			// DNS of the cluster project for an instance in a node project.
+			func(b *csrBuilder, c *controllerContext) {
+				goodCase(b, c)
+				c.gcpCfg.ProjectID = "p99"
+				c.gcpCfg.NodeProjects = []string{"p0"}
+				b.dns = []string{"i0.z0.c.p99.internal", "i0.c.p99.internal", "i0"}
+			},
 			// Wrong zone.
 			func(b *csrBuilder, c *controllerContext) {
 				goodCase(b, c)
@@ -480,8 +689,36 @@ func TestValidators(t *testing.T) {
 				c.gcpCfg.ProjectID = "p0:p1:p2"
 				b.dns = []string{"i0.z0.c.p0.internal", "i0.c.p1.p2.p0.internal", "i0"}
 			},
+			// Not matching hostname.
+			func(b *csrBuilder, c *controllerContext) {
+				goodCase(b, c)
+				b.dns = []string{"a0.example.com"}
+			},
+			// IP outside of the alias IP ranges.
+			func(b *csrBuilder, c *controllerContext) {
+				aliasCase(b, c)
+				b.ips = []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("10.1.0.2")}
+			},
 		}
 		testValidator(t, "bad", cases, fn, false, false)
+
+		// The SANs not matching are reported in an event on the CSR.
+		forAllCases(t, "event", []func(*csrBuilder, *controllerContext){func(b *csrBuilder, c *controllerContext) {
+			aliasCase(b, c)
+			b.ips = append(b.ips, net.ParseIP("10.2.0.1"))
+			b.dns = append(b.dns, "other.example.com")
+			c.recorder = record.NewFakeRecorder(1)
+		}}, func(t *testing.T, ctx *controllerContext, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) {
+			if ok, err := fn(ctx, csr, x509cr); ok || err != nil {
+				t.Fatalf("got (%v, %v), want (false, nil)", ok, err)
+			}
+			event := <-ctx.recorder.(*record.FakeRecorder).Events
+			for _, want := range []string{servingCertSANMismatchReason, `"other.example.com"`, `"10.2.0.1"`} {
+				if !strings.Contains(event, want) {
+					t.Errorf("got event %q, want it to contain %q", event, want)
+				}
+			}
+		})
 	})
 }
 
@@ -692,6 +929,22 @@ func fakeGCPAPI(t *testing.T, ekPub *rsa.PublicKey) (*http.Client, *httptest.Ser
 				Zone:              "z0",
 				NetworkInterfaces: []*compute.NetworkInterface{{NetworkIP: "1.2.3.4", Ipv6Address: "fd20:fbc:b0e2:0:0:b:0:0"}},
 			})
+		case "/compute/v1/projects/p0/zones/z0/instances/a0":
+			json.NewEncoder(rw).Encode(compute.Instance{
+				Id:       1,
+				Name:     "a0",
+				Zone:     "z0",
+				Hostname: "a0.example.com",
+				NetworkInterfaces: []*compute.NetworkInterface{
+					{
+						NetworkIP: "1.2.3.4",
+						AliasIpRanges: []*compute.AliasIpRange{
+							{IpCidrRange: "10.0.0.0/24"},
+							{IpCidrRange: "10.1.0.1"},
+						},
+					},
+				},
+			})
 		case "/compute/v1/projects/p0/zones/z0/instances/ds1":
 			json.NewEncoder(rw).Encode(compute.Instance{
 				Id:   1,
@@ -0,0 +1,218 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	capi "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// nodeCSRApprovalPolicyReloadPeriod is how often the node CSR approval
+// policy file is checked for changes.
+const nodeCSRApprovalPolicyReloadPeriod = 30 * time.Second
+
+// nodeCSRApprovalPolicy narrows down the node client and serving CSRs
+// approved by the node approver, on top of its built-in checks. A CSR
+// recognized by the node approver and not allowed by the policy is denied.
+type nodeCSRApprovalPolicy struct {
+	// ClientUsages are the allowed sets of exact key usages of node client
+	// CSRs. The built-in ones are allowed if empty.
+	ClientUsages [][]capi.KeyUsage `json:"clientUsages,omitempty"`
+	// ServerUsages are the allowed sets of exact key usages of kubelet
+	// serving CSRs. The built-in ones are allowed if empty.
+	ServerUsages [][]capi.KeyUsage `json:"serverUsages,omitempty"`
+	// RequiredGroups are the groups the requesters of the CSRs must all be
+	// in, as authenticated by the apiserver.
+	RequiredGroups []string `json:"requiredGroups,omitempty"`
+	// Projects are the projects the instances of the nodes may be in. Any
+	// if empty.
+	Projects []string `json:"projects,omitempty"`
+	// InstanceGroups are the names of the managed instance groups the
+	// instances of the nodes may be created by. Any instance, including the
+	// ones not created by a managed instance group, if empty.
+	InstanceGroups []string `json:"instanceGroups,omitempty"`
+	// RequireTPMAttestation would deny the node client CSRs which are not
+	// attested by the TPM of their instance. The node approver approves no
+	// attested flow, so that it would deny all of them, and a policy setting
+	// it is rejected.
+	RequireTPMAttestation bool `json:"requireTPMAttestation,omitempty"`
+	// Quarantine holds back the CSRs allowed by the policy which look
+	// suspicious, neither approving nor denying them, until an operator
+	// overrides it.
+	Quarantine *nodeCSRQuarantine `json:"quarantine,omitempty"`
+}
+
+// parseNodeCSRApprovalPolicy parses and validates a node CSR approval policy.
+func parseNodeCSRApprovalPolicy(contents []byte) (*nodeCSRApprovalPolicy, error) {
+	var policy nodeCSRApprovalPolicy
+	if err := yaml.UnmarshalStrict(contents, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing node CSR approval policy: %w", err)
+	}
+	for _, usages := range append(append([][]capi.KeyUsage{}, policy.ClientUsages...), policy.ServerUsages...) {
+		if len(usages) == 0 {
+			return nil, fmt.Errorf("invalid node CSR approval policy: empty set of usages")
+		}
+	}
+	if policy.RequireTPMAttestation {
+		return nil, fmt.Errorf("invalid node CSR approval policy: requireTPMAttestation is not supported, as no node client CSR is TPM attested")
+	}
+	if q := policy.Quarantine; q != nil {
+		if q.MaxSubmissions < 0 {
+			return nil, fmt.Errorf("invalid node CSR approval policy: negative quarantine maxSubmissions %d", q.MaxSubmissions)
+		}
+		if q.SubmissionWindow.Duration < 0 {
+			return nil, fmt.Errorf("invalid node CSR approval policy: negative quarantine submissionWindow %v", q.SubmissionWindow.Duration)
+		}
+	}
+	return &policy, nil
+}
+
+// check returns why the policy does not allow the CSR, or "" if it does.
+// The instance of the node is looked up for every CSR if the policy restricts
+// the projects or the instance groups.
+func (p *nodeCSRApprovalPolicy) check(ctx *controllerContext, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (string, error) {
+	usages := p.ServerUsages
+	if csr.Spec.SignerName == capi.KubeAPIServerClientKubeletSignerName {
+		usages = p.ClientUsages
+	}
+	if len(usages) != 0 && !hasAnyExactUsages(csr, usages) {
+		return fmt.Sprintf("usages %v not allowed", csr.Spec.Usages), nil
+	}
+	for _, group := range p.RequiredGroups {
+		if !contains(csr.Spec.Groups, group) {
+			return fmt.Sprintf("requester not in required group %q", group), nil
+		}
+	}
+
+	if len(p.Projects) == 0 && len(p.InstanceGroups) == 0 {
+		return "", nil
+	}
+	instanceName := strings.TrimPrefix(x509cr.Subject.CommonName, "system:node:")
+	inst, err := getInstanceByName(ctx, instanceName)
+	if err == errInstanceNotFound {
+		return fmt.Sprintf("instance %q not found", instanceName), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if project := instanceProject(ctx, inst); len(p.Projects) != 0 && !contains(p.Projects, project) {
+		return fmt.Sprintf("project %q not allowed", project), nil
+	}
+	if len(p.InstanceGroups) == 0 {
+		return "", nil
+	}
+	if !contains(p.InstanceGroups, instanceGroup(inst)) {
+		return fmt.Sprintf("instance %q not created by an allowed instance group", instanceName), nil
+	}
+	return "", nil
+}
+
+// instanceGroup returns the name of the managed instance group which created
+// the instance, or "" if none did.
+func instanceGroup(inst *compute.Instance) string {
+	var name string
+	if inst.Metadata != nil {
+		for _, item := range inst.Metadata.Items {
+			if item != nil && item.Key == "created-by" && item.Value != nil {
+				// e.g. projects/NUMBER/zones/ZONE/instanceGroupManagers/NAME
+				name = (*item.Value)[strings.LastIndex(*item.Value, "/")+1:]
+			}
+		}
+	}
+	return name
+}
+
+func hasAnyExactUsages(csr *capi.CertificateSigningRequest, allowed [][]capi.KeyUsage) bool {
+	for _, usages := range allowed {
+		if hasExactUsages(csr, usages) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeCSRApprovalPolicyWatcher holds a node CSR approval policy read from a
+// file, and reloads it when the file changes.
+type nodeCSRApprovalPolicyWatcher struct {
+	path string
+
+	mu     sync.RWMutex
+	policy *nodeCSRApprovalPolicy
+	// contents are the last contents read, so that an invalid policy is
+	// not parsed again until the file changes.
+	contents []byte
+}
+
+// watchNodeCSRApprovalPolicy reads the node CSR approval policy at path, to
+// be reloaded by run.
+func watchNodeCSRApprovalPolicy(path string) (*nodeCSRApprovalPolicyWatcher, error) {
+	w := &nodeCSRApprovalPolicyWatcher{path: path}
+	if err := w.reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// get returns the current policy.
+func (w *nodeCSRApprovalPolicyWatcher) get() *nodeCSRApprovalPolicy {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.policy
+}
+
+// run reloads the policy every nodeCSRApprovalPolicyReloadPeriod until
+// stopCh is closed. An invalid policy is logged and the current one kept.
+func (w *nodeCSRApprovalPolicyWatcher) run(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := w.reload(); err != nil {
+			klog.Errorf("Failed to reload node CSR approval policy %q, keeping the current policy: %v", w.path, err)
+		}
+	}, nodeCSRApprovalPolicyReloadPeriod, stopCh)
+}
+
+func (w *nodeCSRApprovalPolicyWatcher) reload() error {
+	contents, err := os.ReadFile(w.path)
+	if err != nil {
+		return fmt.Errorf("error reading node CSR approval policy %q: %w", w.path, err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.contents != nil && bytes.Equal(contents, w.contents) {
+		return nil
+	}
+	w.contents = contents
+	policy, err := parseNodeCSRApprovalPolicy(contents)
+	if err != nil {
+		return fmt.Errorf("%q: %w", w.path, err)
+	}
+	if w.policy != nil {
+		klog.Infof("Reloaded node CSR approval policy %q", w.path)
+	}
+	w.policy = policy
+	return nil
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"os"
+	"path/filepath"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+	capi "k8s.io/api/certificates/v1"
+	certutil "k8s.io/kubernetes/pkg/apis/certificates/v1"
+)
+
+func TestParseNodeCSRApprovalPolicy(t *testing.T) {
+	cs := map[string]struct {
+		policy    string
+		expectErr bool
+	}{
+		"empty": {},
+		"valid": {
+			policy: `
+clientUsages:
+- [digital signature, client auth]
+serverUsages:
+- [digital signature, server auth]
+requiredGroups: [system:nodes]
+projects: [p0]
+instanceGroups: [ig0]
+quarantine:
+  usernames: [kubelet-bootstrap, "system:node:*"]
+  instanceGroups: [ig0]
+  maxSubmissions: 3
+  submissionWindow: 30m
+`,
+		},
+		"TPM attestation required": {
+			policy:    "requireTPMAttestation: true",
+			expectErr: true,
+		},
+		"negative quarantine maxSubmissions": {
+			policy:    "quarantine: {maxSubmissions: -1}",
+			expectErr: true,
+		},
+		"empty usages": {
+			policy:    "clientUsages: [[]]",
+			expectErr: true,
+		},
+		"unknown field": {
+			policy:    "instanceGroup: [ig0]",
+			expectErr: true,
+		},
+	}
+
+	for name, c := range cs {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseNodeCSRApprovalPolicy([]byte(c.policy))
+			if got, want := (err != nil), c.expectErr; got != want {
+				t.Errorf("unexpected error value: %v", err)
+			}
+		})
+	}
+}
+
+func TestNodeCSRApprovalPolicyCheck(t *testing.T) {
+	client, srv := fakeGCPAPI(t, nil)
+	defer srv.Close()
+	cs, err := compute.New(client)
+	if err != nil {
+		t.Fatalf("creating GCE API client: %v", err)
+	}
+	cases := map[string]struct {
+		policy         nodeCSRApprovalPolicy
+		signerName     string
+		usages         []capi.KeyUsage
+		cn             string
+		clusterProject string
+		nodeProjects   []string
+		wantDeny       bool
+	}{
+		"empty policy": {
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+		},
+		"allowed client usages": {
+			policy:     nodeCSRApprovalPolicy{ClientUsages: [][]capi.KeyUsage{kubeletServerUsages, kubeletClientUsages}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+		},
+		"disallowed client usages": {
+			policy:     nodeCSRApprovalPolicy{ClientUsages: [][]capi.KeyUsage{kubeletClientUsagesNoEncipherment}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+			wantDeny:   true,
+		},
+		"client usages do not apply to server CSRs": {
+			policy:     nodeCSRApprovalPolicy{ClientUsages: [][]capi.KeyUsage{kubeletClientUsagesNoEncipherment}},
+			signerName: capi.KubeletServingSignerName,
+			usages:     kubeletServerUsages,
+		},
+		"disallowed server usages": {
+			policy:     nodeCSRApprovalPolicy{ServerUsages: [][]capi.KeyUsage{kubeletServerUsagesNoEncipherment}},
+			signerName: capi.KubeletServingSignerName,
+			usages:     kubeletServerUsages,
+			wantDeny:   true,
+		},
+		"required group": {
+			policy:     nodeCSRApprovalPolicy{RequiredGroups: []string{"system:authenticated"}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+		},
+		"missing required group": {
+			policy:     nodeCSRApprovalPolicy{RequiredGroups: []string{"system:authenticated", "system:nodes"}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+			wantDeny:   true,
+		},
+		"allowed project": {
+			policy:     nodeCSRApprovalPolicy{Projects: []string{"1", "2"}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+		},
+		"disallowed project": {
+			policy:     nodeCSRApprovalPolicy{Projects: []string{"1"}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+			wantDeny:   true,
+		},
+		"allowed node project": {
+			policy:         nodeCSRApprovalPolicy{Projects: []string{"2"}},
+			signerName:     capi.KubeAPIServerClientKubeletSignerName,
+			clusterProject: "p0",
+			nodeProjects:   []string{"2"},
+		},
+		"disallowed node project": {
+			policy:         nodeCSRApprovalPolicy{Projects: []string{"p0"}},
+			signerName:     capi.KubeAPIServerClientKubeletSignerName,
+			clusterProject: "p0",
+			nodeProjects:   []string{"2"},
+			wantDeny:       true,
+		},
+		"allowed instance group": {
+			policy:     nodeCSRApprovalPolicy{InstanceGroups: []string{"ig1"}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+		},
+		"disallowed instance group": {
+			policy:     nodeCSRApprovalPolicy{InstanceGroups: []string{"ig0"}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+			wantDeny:   true,
+		},
+		"instance not found": {
+			policy:     nodeCSRApprovalPolicy{InstanceGroups: []string{"ig1"}},
+			signerName: capi.KubeAPIServerClientKubeletSignerName,
+			cn:         "system:node:missing",
+			wantDeny:   true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pk, err := ecdsa.GenerateKey(elliptic.P224(), insecureRand)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := csrBuilder{
+				cn:         "system:node:i1",
+				orgs:       []string{"system:nodes"},
+				requestor:  legacyKubeletUsername,
+				signerName: c.signerName,
+				usages:     kubeletClientUsages,
+				key:        pk,
+			}
+			if c.usages != nil {
+				b.usages = c.usages
+			}
+			if c.cn != "" {
+				b.cn = c.cn
+			}
+			csr := makeFancyTestCSR(t, b)
+			csr.Spec.Groups = []string{"system:authenticated"}
+			x509cr, err := certutil.ParseCSR(csr.Spec.Request)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			ctx := &controllerContext{}
+			ctx.gcpCfg.Compute = cs
+			ctx.gcpCfg.ProjectID = "2"
+			if c.clusterProject != "" {
+				ctx.gcpCfg.ProjectID = c.clusterProject
+			}
+			ctx.gcpCfg.NodeProjects = c.nodeProjects
+			ctx.gcpCfg.Zones = []string{"r0-a"}
+			reason, err := c.policy.check(ctx, csr, x509cr)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if got := reason != ""; got != c.wantDeny {
+				t.Errorf("got deny reason %q, want deny: %v", reason, c.wantDeny)
+			}
+		})
+	}
+}
+
+func TestNodeCSRApprovalPolicyWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(policy string) {
+		if err := os.WriteFile(path, []byte(policy), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("projects: [p0]")
+	w, err := watchNodeCSRApprovalPolicy(path)
+	if err != nil {
+		t.Fatalf("watchNodeCSRApprovalPolicy() = %v", err)
+	}
+	if got := w.get(); len(got.Projects) != 1 {
+		t.Errorf("got policy %+v, want projects restricted", got)
+	}
+
+	// A changed policy replaces the current one.
+	write("requiredGroups: [system:nodes]")
+	if err := w.reload(); err != nil {
+		t.Fatalf("reload() = %v", err)
+	}
+	if got := w.get(); len(got.Projects) != 0 || len(got.RequiredGroups) != 1 {
+		t.Errorf("got policy %+v after reload", got)
+	}
+
+	// An invalid policy is rejected and the current one kept.
+	write("requiredGroup: [system:nodes]")
+	if err := w.reload(); err == nil {
+		t.Errorf("reload() of an invalid policy succeeded")
+	}
+	if got := w.get(); len(got.RequiredGroups) != 1 {
+		t.Errorf("got policy %+v after invalid reload", got)
+	}
+	// It is not parsed again until the file changes.
+	if err := w.reload(); err != nil {
+		t.Errorf("reload() of an unchanged policy = %v", err)
+	}
+
+	// A missing initial policy is an error.
+	if _, err := watchNodeCSRApprovalPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("watchNodeCSRApprovalPolicy() of a missing file succeeded")
+	}
+}
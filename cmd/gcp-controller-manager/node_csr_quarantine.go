@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	capi "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// csrQuarantinedAnnotation is set by the node approver on the CSRs it
+	// quarantines, to why they are.
+	csrQuarantinedAnnotation = "cloud.google.com/csr-quarantined"
+	// csrQuarantineOverrideAnnotation is set by operators on quarantined
+	// CSRs to release them, with csrQuarantineOverrideApprove, or deny them,
+	// with csrQuarantineOverrideDeny.
+	csrQuarantineOverrideAnnotation = "cloud.google.com/csr-quarantine-override"
+	csrQuarantineOverrideApprove    = "approve"
+	csrQuarantineOverrideDeny       = "deny"
+
+	csrQuarantinedReason = "CSRQuarantined"
+
+	// defaultCSRSubmissionWindow is the window of the repeat submissions of
+	// a quarantine without one.
+	defaultCSRSubmissionWindow = time.Hour
+)
+
+// nodeCSRQuarantine describes the suspicious node CSRs, which are quarantined
+// by the node approver: left pending, with a warning event and the
+// cloud.google.com/csr-quarantined annotation, until an operator sets their
+// cloud.google.com/csr-quarantine-override annotation to approve, to have them
+// handled as usual, or deny.
+type nodeCSRQuarantine struct {
+	// Usernames are the expected requesters of the CSRs, e.g.
+	// kubelet-bootstrap, or a prefix ending with *, e.g. system:node:*. The
+	// CSRs of the other requesters are quarantined. Any requester is expected
+	// if empty.
+	Usernames []string `json:"usernames,omitempty"`
+	// InstanceGroups are the names of the managed instance groups the
+	// instances of the nodes are expected to be created by. The CSRs of the
+	// other instances are quarantined. Any instance is expected if empty.
+	InstanceGroups []string `json:"instanceGroups,omitempty"`
+	// MaxSubmissions is the number of CSRs for a node within SubmissionWindow
+	// beyond which they are quarantined. Unlimited if 0.
+	MaxSubmissions int `json:"maxSubmissions,omitempty"`
+	// SubmissionWindow is the window of MaxSubmissions, an hour if 0.
+	SubmissionWindow metav1.Duration `json:"submissionWindow,omitempty"`
+}
+
+// check returns why the CSR is quarantined, and the reason of the decision
+// metric, or "" if it is not. The submissions of the CSR are counted.
+func (q *nodeCSRQuarantine) check(ctx *controllerContext, submissions *csrSubmissions, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (string, csrmetrics.DenialReason, error) {
+	if len(q.Usernames) != 0 && !matchesUsername(q.Usernames, csr.Spec.Username) {
+		return fmt.Sprintf("unexpected requester %q", csr.Spec.Username), csrmetrics.DenialReasonUnknownUsername, nil
+	}
+	if q.MaxSubmissions > 0 {
+		window := q.SubmissionWindow.Duration
+		if window == 0 {
+			window = defaultCSRSubmissionWindow
+		}
+		if n := submissions.add(nodeName(x509cr), csr.UID, window); n > q.MaxSubmissions {
+			return fmt.Sprintf("%d CSRs for node %q within %v, more than %d", n, nodeName(x509cr), window, q.MaxSubmissions), csrmetrics.DenialReasonRepeatSubmission, nil
+		}
+	}
+	if len(q.InstanceGroups) != 0 {
+		instanceName := nodeName(x509cr)
+		inst, err := getInstanceByName(ctx, instanceName)
+		if err == errInstanceNotFound {
+			// Left to the validators.
+			return "", "", nil
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if group := instanceGroup(inst); !contains(q.InstanceGroups, group) {
+			return fmt.Sprintf("instance %q not created by an expected instance group", instanceName), csrmetrics.DenialReasonInstanceGroup, nil
+		}
+	}
+	return "", "", nil
+}
+
+func matchesUsername(patterns []string, username string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(username, prefix) {
+			return true
+		}
+		if pattern == username {
+			return true
+		}
+	}
+	return false
+}
+
+// csrSubmissions counts the distinct CSRs submitted for each node.
+type csrSubmissions struct {
+	now func() time.Time
+
+	mu sync.Mutex
+	// byNode holds when the CSRs of each node were first seen.
+	byNode map[string]map[types.UID]time.Time
+}
+
+func newCSRSubmissions() *csrSubmissions {
+	return &csrSubmissions{
+		now:    time.Now,
+		byNode: make(map[string]map[types.UID]time.Time),
+	}
+}
+
+// add records the CSR of the node, unless it already is, and returns the
+// number of CSRs of the node seen within the window, forgetting the older
+// ones.
+func (s *csrSubmissions) add(node string, uid types.UID, window time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for n, csrs := range s.byNode {
+		for u, seen := range csrs {
+			if now.Sub(seen) > window {
+				delete(csrs, u)
+			}
+		}
+		if len(csrs) == 0 {
+			delete(s.byNode, n)
+		}
+	}
+	if s.byNode[node] == nil {
+		s.byNode[node] = make(map[types.UID]time.Time)
+	}
+	if _, ok := s.byNode[node][uid]; !ok {
+		s.byNode[node][uid] = now
+	}
+	return len(s.byNode[node])
+}
+
+// quarantine annotates the CSR with why it is quarantined and records a
+// warning event on it, unless it already is for the same reason.
+func (a *nodeApprover) quarantine(csr *capi.CertificateSigningRequest, reason string) error {
+	if csr.Annotations[csrQuarantinedAnnotation] == reason {
+		return nil
+	}
+	klog.Warningf("Quarantined CSR %q: %s", csr.Name, reason)
+	if a.ctx.recorder != nil {
+		a.ctx.recorder.Eventf(csr, v1.EventTypeWarning, csrQuarantinedReason, "Quarantined: %s. Set the %s annotation to %s or %s to release it.", reason, csrQuarantineOverrideAnnotation, csrQuarantineOverrideApprove, csrQuarantineOverrideDeny)
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{csrQuarantinedAnnotation: reason},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	recordMetric := csrmetrics.OutboundRPCStartRecorder("k8s.CertificateSigningRequests.patch")
+	if _, err := a.ctx.client.CertificatesV1().CertificateSigningRequests().Patch(context.TODO(), csr.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return fmt.Errorf("error annotating quarantined CSR %q: %v", csr.Name, err)
+	}
+	recordMetric(csrmetrics.OutboundRPCStatusOK)
+	return nil
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	authorization "k8s.io/api/authorization/v1"
+	capi "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testclient "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	certutil "k8s.io/kubernetes/pkg/apis/certificates/v1"
+)
+
+func TestNodeCSRQuarantineCheck(t *testing.T) {
+	client, srv := fakeGCPAPI(t, nil)
+	defer srv.Close()
+	cs, err := compute.New(client)
+	if err != nil {
+		t.Fatalf("creating GCE API client: %v", err)
+	}
+	cases := map[string]struct {
+		quarantine  nodeCSRQuarantine
+		requestor   string
+		cn          string
+		submissions int
+		wantReason  csrmetrics.DenialReason
+	}{
+		"empty quarantine": {},
+		"expected username": {
+			quarantine: nodeCSRQuarantine{Usernames: []string{"kubelet-bootstrap", "system:node:*"}},
+			requestor:  "system:node:i1",
+		},
+		"unknown username": {
+			quarantine: nodeCSRQuarantine{Usernames: []string{"kubelet-bootstrap", "system:node:*"}},
+			requestor:  "someone",
+			wantReason: csrmetrics.DenialReasonUnknownUsername,
+		},
+		"expected instance group": {
+			quarantine: nodeCSRQuarantine{InstanceGroups: []string{"ig1"}},
+		},
+		"unexpected instance group": {
+			quarantine: nodeCSRQuarantine{InstanceGroups: []string{"ig0"}},
+			wantReason: csrmetrics.DenialReasonInstanceGroup,
+		},
+		"instance not found is left to the validators": {
+			quarantine: nodeCSRQuarantine{InstanceGroups: []string{"ig0"}},
+			cn:         "system:node:missing",
+		},
+		"submissions up to the maximum": {
+			quarantine:  nodeCSRQuarantine{MaxSubmissions: 3},
+			submissions: 2,
+		},
+		"repeat submissions": {
+			quarantine:  nodeCSRQuarantine{MaxSubmissions: 3},
+			submissions: 3,
+			wantReason:  csrmetrics.DenialReasonRepeatSubmission,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pk, err := ecdsa.GenerateKey(elliptic.P224(), insecureRand)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := csrBuilder{
+				cn:         "system:node:i1",
+				orgs:       []string{"system:nodes"},
+				requestor:  legacyKubeletUsername,
+				signerName: capi.KubeAPIServerClientKubeletSignerName,
+				usages:     kubeletClientUsages,
+				key:        pk,
+			}
+			if c.requestor != "" {
+				b.requestor = c.requestor
+			}
+			if c.cn != "" {
+				b.cn = c.cn
+			}
+			csr := makeFancyTestCSR(t, b)
+			csr.UID = "uid"
+			x509cr, err := certutil.ParseCSR(csr.Spec.Request)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			ctx := &controllerContext{}
+			ctx.gcpCfg.Compute = cs
+			ctx.gcpCfg.ProjectID = "2"
+			ctx.gcpCfg.Zones = []string{"r0-a"}
+			submissions := newCSRSubmissions()
+			for i := 0; i < c.submissions; i++ {
+				submissions.add(nodeName(x509cr), types.UID(rune('a'+i)), time.Hour)
+			}
+			reason, metricReason, err := c.quarantine.check(ctx, submissions, csr, x509cr)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if metricReason != c.wantReason || (reason != "") != (c.wantReason != "") {
+				t.Errorf("got quarantine reason %q (%q), want %q", reason, metricReason, c.wantReason)
+			}
+		})
+	}
+}
+
+func TestCSRSubmissions(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newCSRSubmissions()
+	s.now = func() time.Time { return now }
+
+	if got := s.add("n0", "a", time.Hour); got != 1 {
+		t.Errorf("got %d submissions, want 1", got)
+	}
+	// The same CSR is only counted once.
+	if got := s.add("n0", "a", time.Hour); got != 1 {
+		t.Errorf("got %d submissions for the same CSR, want 1", got)
+	}
+	if got := s.add("n1", "b", time.Hour); got != 1 {
+		t.Errorf("got %d submissions of another node, want 1", got)
+	}
+	now = now.Add(30 * time.Minute)
+	if got := s.add("n0", "c", time.Hour); got != 2 {
+		t.Errorf("got %d submissions, want 2", got)
+	}
+	now = now.Add(31 * time.Minute)
+	if got := s.add("n0", "d", time.Hour); got != 2 {
+		t.Errorf("got %d submissions after the first left the window, want 2", got)
+	}
+	if _, ok := s.byNode["n1"]; ok {
+		t.Errorf("got submissions of n1 after they left the window")
+	}
+}
+
+func TestNodeApproverQuarantine(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		override      string
+		annotated     bool
+		wantPatch     bool
+		wantEvent     bool
+		wantCondition capi.RequestConditionType
+	}{
+		{desc: "quarantined", wantPatch: true, wantEvent: true},
+		{desc: "already quarantined", annotated: true},
+		{desc: "override approve", override: csrQuarantineOverrideApprove, wantCondition: capi.CertificateApproved},
+		{desc: "override deny", override: csrQuarantineOverrideDeny, wantCondition: capi.CertificateDenied},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			client := &fake.Clientset{}
+			client.AddReactor("create", "subjectaccessreviews", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+				return true, &authorization.SubjectAccessReview{
+					Status: authorization.SubjectAccessReviewStatus{Allowed: true},
+				}, nil
+			})
+			recorder := record.NewFakeRecorder(10)
+			policy := &nodeCSRApprovalPolicyWatcher{policy: &nodeCSRApprovalPolicy{
+				Quarantine: &nodeCSRQuarantine{Usernames: []string{"kubelet-bootstrap"}},
+			}}
+			approver := newNodeApprover(&controllerContext{client: client, recorder: recorder, nodeCSRApprovalPolicy: policy})
+			approver.validators = []csrValidator{{
+				approveMsg: "tester",
+				permission: authorization.ResourceAttributes{Group: "foo", Resource: "bar", Subresource: "baz"},
+				recognize: func(csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) bool {
+					return true
+				},
+			}}
+			csr := makeTestCSR(t)
+			csr.Spec.Username = "someone"
+			csr.ObjectMeta = metav1.ObjectMeta{Name: "csr-1", Annotations: map[string]string{}}
+			if tc.override != "" {
+				csr.Annotations[csrQuarantineOverrideAnnotation] = tc.override
+			}
+			if tc.annotated {
+				csr.Annotations[csrQuarantinedAnnotation] = `unexpected requester "someone"`
+			}
+			if err := approver.handle(context.TODO(), csr); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			var patched bool
+			for _, a := range client.Actions() {
+				if a.GetVerb() == "patch" {
+					patched = true
+				}
+			}
+			if patched != tc.wantPatch {
+				t.Errorf("got CSR patched: %t, want %t", patched, tc.wantPatch)
+			}
+			if got := len(recorder.Events) != 0; got != tc.wantEvent {
+				t.Errorf("got quarantine event: %t, want %t", got, tc.wantEvent)
+			}
+			var condition capi.RequestConditionType
+			if len(csr.Status.Conditions) != 0 {
+				condition = csr.Status.Conditions[0].Type
+			}
+			if condition != tc.wantCondition {
+				t.Errorf("got CSR condition %q, want %q", condition, tc.wantCondition)
+			}
+		})
+	}
+}
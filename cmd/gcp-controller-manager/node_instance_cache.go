@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/klog/v2"
+)
+
+// instanceNotFoundInitialBackoff is how long an instance is first cached as
+// not found, doubling while it stays not found, up to the TTL of the cache.
+const instanceNotFoundInitialBackoff = time.Second
+
+type instanceCacheKey struct {
+	project, zone, name string
+}
+
+type instanceCacheEntry struct {
+	instance *compute.Instance
+	// err is the NotFound error of the instance, if it was not found.
+	err     error
+	expires time.Time
+	// notFoundBackoff is how long the instance is cached as not found.
+	notFoundBackoff time.Duration
+}
+
+// instanceCache caches the instances looked up by the node CSR approval for a
+// short TTL, since the several CSRs of a node, and the lookups of a CSR in the
+// zones and node projects it is not in, would otherwise get the same instance
+// from the compute API again and again during node pool rollouts. The
+// concurrent lookups of an instance are also shared. The instances which are
+// not found are cached with a backoff, doubling while they stay not found, so
+// that an instance created after its lookup is seen quickly.
+type instanceCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	group singleflight.Group
+
+	mu        sync.Mutex
+	entries   map[instanceCacheKey]*instanceCacheEntry
+	lastSweep time.Time
+}
+
+// newInstanceCache returns an instanceCache with the TTL, or nil, which does
+// not cache, if it is not positive.
+func newInstanceCache(ttl time.Duration) *instanceCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &instanceCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[instanceCacheKey]*instanceCacheEntry),
+	}
+}
+
+// get returns the cached instance, or its NotFound error, or gets it with
+// fetch, sharing the call with the concurrent lookups of the instance.
+func (c *instanceCache) get(project, zone, name string, fetch func() (*compute.Instance, error)) (*compute.Instance, error) {
+	if c == nil {
+		return fetch()
+	}
+	key := instanceCacheKey{project: project, zone: zone, name: name}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && c.now().Before(e.expires) {
+		c.mu.Unlock()
+		klog.V(4).Infof("using cached instance %q in project %q zone %q", name, project, zone)
+		return e.instance, e.err
+	}
+	c.mu.Unlock()
+
+	v, err, _ := c.group.Do(path.Join(project, zone, name), func() (interface{}, error) {
+		inst, err := fetch()
+		c.store(key, inst, err)
+		return inst, err
+	})
+	inst, _ := v.(*compute.Instance)
+	return inst, err
+}
+
+func (c *instanceCache) store(key instanceCacheKey, inst *compute.Instance, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	prev := c.entries[key]
+	c.sweep(now)
+	switch {
+	case err == nil:
+		c.entries[key] = &instanceCacheEntry{instance: inst, expires: now.Add(c.ttl)}
+	case isNotFound(err):
+		backoff := instanceNotFoundInitialBackoff
+		if prev != nil && prev.notFoundBackoff > 0 {
+			backoff = 2 * prev.notFoundBackoff
+		}
+		if backoff > c.ttl {
+			backoff = c.ttl
+		}
+		c.entries[key] = &instanceCacheEntry{err: err, expires: now.Add(backoff), notFoundBackoff: backoff}
+	default:
+		// The other errors are not cached.
+		delete(c.entries, key)
+	}
+}
+
+// sweep drops the expired entries, at most once per TTL. The entries of the
+// instances which are not found are kept for twice their backoff, so that it
+// keeps doubling.
+func (c *instanceCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for key, e := range c.entries {
+		if now.After(e.expires.Add(e.notFoundBackoff)) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestInstanceCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newInstanceCache(10 * time.Second)
+	c.now = func() time.Time { return now }
+
+	var fetches int
+	var fetchErr error
+	fetch := func() (*compute.Instance, error) {
+		fetches++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return &compute.Instance{Name: "i0"}, nil
+	}
+	get := func(desc string, wantFetches int, wantErr bool) {
+		t.Helper()
+		inst, err := c.get("p0", "z0", "i0", fetch)
+		if got := err != nil; got != wantErr {
+			t.Errorf("%s: got error %v, want error %t", desc, err, wantErr)
+		}
+		if !wantErr && (inst == nil || inst.Name != "i0") {
+			t.Errorf("%s: got instance %v, want i0", desc, inst)
+		}
+		if fetches != wantFetches {
+			t.Errorf("%s: got %d fetches, want %d", desc, fetches, wantFetches)
+		}
+	}
+
+	get("first lookup", 1, false)
+	get("cached", 1, false)
+	now = now.Add(11 * time.Second)
+	get("expired", 2, false)
+
+	fetchErr = &googleapi.Error{Code: http.StatusServiceUnavailable}
+	now = now.Add(11 * time.Second)
+	get("unavailable", 3, true)
+	get("unavailable is not cached", 4, true)
+
+	fetchErr = &googleapi.Error{Code: http.StatusNotFound}
+	get("not found", 5, true)
+	get("not found is cached", 5, true)
+	now = now.Add(instanceNotFoundInitialBackoff)
+	get("not found after backoff", 6, true)
+	now = now.Add(instanceNotFoundInitialBackoff)
+	get("not found backoff doubled", 6, true)
+	now = now.Add(instanceNotFoundInitialBackoff)
+	get("not found after doubled backoff", 7, true)
+
+	now = now.Add(4 * time.Second)
+	get("not found after 4s", 8, true)
+	now = now.Add(8 * time.Second)
+	get("not found after 8s", 9, true)
+	// The backoff is capped at the TTL.
+	now = now.Add(9 * time.Second)
+	get("not found backoff capped", 9, true)
+	now = now.Add(time.Second)
+	get("not found after capped backoff", 10, true)
+	now = now.Add(10 * time.Second)
+	get("not found after capped backoff again", 11, true)
+
+	fetchErr = nil
+	now = now.Add(10 * time.Second)
+	get("found", 12, false)
+	get("found is cached", 12, false)
+
+	if _, err := c.get("p0", "z1", "i0", fetch); err != nil || fetches != 13 {
+		t.Errorf("got error %v and %d fetches for another zone, want no error and 13 fetches", err, fetches)
+	}
+}
+
+func TestInstanceCacheSharesConcurrentLookups(t *testing.T) {
+	c := newInstanceCache(time.Minute)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var fetches int
+	fetch := func() (*compute.Instance, error) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		return &compute.Instance{Name: "i0"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.get("p0", "z0", "i0", fetch); err != nil {
+				t.Errorf("get() = %v", err)
+			}
+		}()
+	}
+	// Let the lookups start before the first one returns.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("got %d fetches for concurrent lookups, want 1", fetches)
+	}
+}
+
+func TestNilInstanceCache(t *testing.T) {
+	c := newInstanceCache(0)
+	if c != nil {
+		t.Fatalf("newInstanceCache(0) = %v, want nil", c)
+	}
+	var fetches int
+	for i := 0; i < 2; i++ {
+		c.get("p0", "z0", "i0", func() (*compute.Instance, error) {
+			fetches++
+			return &compute.Instance{}, nil
+		})
+	}
+	if fetches != 2 {
+		t.Errorf("got %d fetches without a cache, want 2", fetches)
+	}
+}
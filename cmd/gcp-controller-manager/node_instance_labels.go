@@ -0,0 +1,155 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	compute "google.golang.org/api/compute/v0.beta"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// lastAppliedInstanceLabelsKey is the node annotation key listing the
+	// labels copied from the instance, so that they are removed from the
+	// Node once they are removed from the instance.
+	lastAppliedInstanceLabelsKey = "node.gke.io/last-applied-instance-labels"
+	// instanceMetadataLabelPrefix prefixes the names of the Node labels
+	// copied from instance metadata entries, after the label prefix.
+	instanceMetadataLabelPrefix = "metadata-"
+)
+
+// instanceLabelSync copies allowlisted GCE instance labels and metadata
+// entries onto Node labels, under a prefix, so that Pods can be scheduled on
+// VM attributes.
+type instanceLabelSync struct {
+	// prefix prefixes the Node labels, e.g. instance.gke.io/.
+	prefix string
+	// labels are the keys of the instance labels copied as PREFIXKEY.
+	labels []string
+	// metadata are the keys of the metadata entries copied as
+	// PREFIXmetadata-KEY.
+	metadata []string
+}
+
+// newInstanceLabelSync returns an instanceLabelSync copying the labels and
+// metadata entries with the given keys, or nil if there are none.
+func newInstanceLabelSync(prefix string, labels, metadata []string) (*instanceLabelSync, error) {
+	if len(labels) == 0 && len(metadata) == 0 {
+		return nil, nil
+	}
+	domain, ok := strings.CutSuffix(prefix, "/")
+	if !ok || len(validation.IsDNS1123Subdomain(domain)) != 0 {
+		return nil, fmt.Errorf("invalid instance label prefix %q, must be a DNS subdomain followed by /", prefix)
+	}
+	s := &instanceLabelSync{prefix: prefix, labels: labels, metadata: metadata}
+	for _, key := range s.labelKeys() {
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid instance label %q: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	return s, nil
+}
+
+func (s *instanceLabelSync) labelKeys() []string {
+	var keys []string
+	for _, key := range s.labels {
+		keys = append(keys, s.prefix+key)
+	}
+	for _, key := range s.metadata {
+		keys = append(keys, s.prefix+instanceMetadataLabelPrefix+key)
+	}
+	return keys
+}
+
+// desiredLabels returns the Node labels of the allowlisted labels and
+// metadata entries of the instance. The metadata values which are not valid
+// label values are skipped.
+func (s *instanceLabelSync) desiredLabels(instance *compute.Instance) map[string]string {
+	desired := map[string]string{}
+	for _, key := range s.labels {
+		if value, ok := instance.Labels[key]; ok {
+			desired[s.prefix+key] = value
+		}
+	}
+	if instance.Metadata == nil {
+		return desired
+	}
+	for _, key := range s.metadata {
+		value, found := findValue(instance.Metadata.Items, key, instance.SelfLink)
+		if !found {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) != 0 {
+			klog.Warningf("Not copying metadata %q of instance %q onto a node label: %s", key, instance.SelfLink, strings.Join(errs, ", "))
+			continue
+		}
+		desired[s.prefix+instanceMetadataLabelPrefix+key] = value
+	}
+	return desired
+}
+
+// annotate reconciles the Node labels copied from the instance: the ones no
+// longer on the instance, as recorded by the last applied annotation, are
+// removed. It returns whether the Node changed.
+func (s *instanceLabelSync) annotate(node *core.Node, instance *compute.Instance) bool {
+	desired := s.desiredLabels(instance)
+	var lastApplied map[string]string
+	if serialized := node.ObjectMeta.Annotations[lastAppliedInstanceLabelsKey]; serialized != "" {
+		var err error
+		if lastApplied, err = parseLabels(serialized); err != nil {
+			klog.Errorf("Failed to parse the %s annotation of node %q, treating it as not set: %v", lastAppliedInstanceLabelsKey, node.Name, err)
+		}
+	}
+
+	labels := map[string]string{}
+	for key, value := range node.ObjectMeta.Labels {
+		if _, ok := lastApplied[key]; !ok {
+			labels[key] = value
+		}
+	}
+	for key, value := range desired {
+		labels[key] = value
+	}
+	annotation := serializeLabels(desired)
+	if equalLabels(labels, node.ObjectMeta.Labels) && annotation == node.ObjectMeta.Annotations[lastAppliedInstanceLabelsKey] {
+		return false
+	}
+	node.ObjectMeta.Labels = labels
+	if node.ObjectMeta.Annotations == nil {
+		node.ObjectMeta.Annotations = make(map[string]string)
+	}
+	node.ObjectMeta.Annotations[lastAppliedInstanceLabelsKey] = annotation
+	return true
+}
+
+// equalLabels returns whether a and b have the same labels, a nil map having
+// none.
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	compute "google.golang.org/api/compute/v0.beta"
+	core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewInstanceLabelSync(t *testing.T) {
+	cs := map[string]struct {
+		prefix    string
+		labels    []string
+		metadata  []string
+		expectNil bool
+		expectErr bool
+	}{
+		"nothing to copy": {
+			prefix:    "instance.gke.io/",
+			expectNil: true,
+		},
+		"labels and metadata": {
+			prefix:   "instance.gke.io/",
+			labels:   []string{"team"},
+			metadata: []string{"cluster-name"},
+		},
+		"prefix without slash": {
+			prefix:    "instance.gke.io",
+			labels:    []string{"team"},
+			expectErr: true,
+		},
+		"invalid prefix": {
+			prefix:    "Instance_GKE/",
+			labels:    []string{"team"},
+			expectErr: true,
+		},
+		"invalid label": {
+			prefix:    "instance.gke.io/",
+			labels:    []string{"team/name"},
+			expectErr: true,
+		},
+		"label too long with the metadata prefix": {
+			prefix:    "instance.gke.io/",
+			metadata:  []string{"abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz0123456"},
+			expectErr: true,
+		},
+	}
+
+	for name, c := range cs {
+		t.Run(name, func(t *testing.T) {
+			s, err := newInstanceLabelSync(c.prefix, c.labels, c.metadata)
+			if got, want := (err != nil), c.expectErr; got != want {
+				t.Fatalf("unexpected error value: %v", err)
+			}
+			if got, want := (s == nil), c.expectNil || c.expectErr; got != want {
+				t.Errorf("got instanceLabelSync %+v, want nil: %v", s, want)
+			}
+		})
+	}
+}
+
+func TestAnnotateInstanceLabels(t *testing.T) {
+	s, err := newInstanceLabelSync("instance.gke.io/", []string{"team", "env"}, []string{"pool"})
+	if err != nil {
+		t.Fatalf("newInstanceLabelSync() = %v", err)
+	}
+	metadata := func(value string) *compute.Metadata {
+		return &compute.Metadata{Items: []*compute.MetadataItems{{Key: "pool", Value: &value}}}
+	}
+
+	cs := map[string]struct {
+		labels         map[string]string
+		annotations    map[string]string
+		instance       *compute.Instance
+		outLabels      map[string]string
+		outAnnotations map[string]string
+		expectUpdate   bool
+	}{
+		"add labels": {
+			labels: map[string]string{"a": "1"},
+			instance: &compute.Instance{
+				Labels:   map[string]string{"team": "infra", "other": "x"},
+				Metadata: metadata("blue"),
+			},
+			outLabels: map[string]string{
+				"a":                             "1",
+				"instance.gke.io/team":          "infra",
+				"instance.gke.io/metadata-pool": "blue",
+			},
+			outAnnotations: map[string]string{lastAppliedInstanceLabelsKey: "instance.gke.io/metadata-pool=blue,instance.gke.io/team=infra"},
+			expectUpdate:   true,
+		},
+		"update and remove labels": {
+			labels: map[string]string{
+				"a":                    "1",
+				"instance.gke.io/team": "infra",
+				"instance.gke.io/env":  "prod",
+			},
+			annotations: map[string]string{lastAppliedInstanceLabelsKey: "instance.gke.io/env=prod,instance.gke.io/team=infra"},
+			instance: &compute.Instance{
+				Labels: map[string]string{"team": "web"},
+			},
+			outLabels: map[string]string{
+				"a":                    "1",
+				"instance.gke.io/team": "web",
+			},
+			outAnnotations: map[string]string{lastAppliedInstanceLabelsKey: "instance.gke.io/team=web"},
+			expectUpdate:   true,
+		},
+		"skip invalid metadata value": {
+			instance: &compute.Instance{
+				Labels:   map[string]string{"env": "prod"},
+				Metadata: metadata("not a label value"),
+			},
+			outLabels:      map[string]string{"instance.gke.io/env": "prod"},
+			outAnnotations: map[string]string{lastAppliedInstanceLabelsKey: "instance.gke.io/env=prod"},
+			expectUpdate:   true,
+		},
+		"unchanged": {
+			labels: map[string]string{
+				"a":                   "1",
+				"instance.gke.io/env": "prod",
+			},
+			annotations: map[string]string{lastAppliedInstanceLabelsKey: "instance.gke.io/env=prod"},
+			instance: &compute.Instance{
+				Labels: map[string]string{"env": "prod"},
+			},
+			outLabels: map[string]string{
+				"a":                   "1",
+				"instance.gke.io/env": "prod",
+			},
+			outAnnotations: map[string]string{lastAppliedInstanceLabelsKey: "instance.gke.io/env=prod"},
+		},
+	}
+
+	for name, c := range cs {
+		t.Run(name, func(t *testing.T) {
+			node := &core.Node{
+				ObjectMeta: v1.ObjectMeta{
+					Name:        "test-node",
+					Labels:      c.labels,
+					Annotations: c.annotations,
+				},
+			}
+			update := s.annotate(node, c.instance)
+			if got, want := node.ObjectMeta.Labels, c.outLabels; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected labels\n\tgot:\t%v\n\twant:\t%v", got, want)
+			}
+			if got, want := node.ObjectMeta.Annotations, c.outAnnotations; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected annotations\n\tgot:\t%v\n\twant:\t%v", got, want)
+			}
+			if update != c.expectUpdate {
+				t.Errorf("annotate() = %v, want %v", update, c.expectUpdate)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	compute "google.golang.org/api/compute/v0.beta"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	machineFamilyLabelKey        = "cloud.google.com/machine-family"
+	cpuPlatformLabelKey          = "cloud.google.com/cpu-platform"
+	localSSDCountLabelKey        = "cloud.google.com/local-ssd-count"
+	gpuTypeLabelKey              = "cloud.google.com/gpu-type"
+	gpuCountLabelKey             = "cloud.google.com/gpu-count"
+	networkBandwidthTierLabelKey = "cloud.google.com/network-bandwidth-tier"
+
+	// scratchDiskType is the type of the local SSDs attached to an instance.
+	scratchDiskType = "SCRATCH"
+)
+
+// machineLabelKeys are the Node labels owned by annotateMachineLabels.
+var machineLabelKeys = []string{
+	machineFamilyLabelKey,
+	cpuPlatformLabelKey,
+	localSSDCountLabelKey,
+	gpuTypeLabelKey,
+	gpuCountLabelKey,
+	networkBandwidthTierLabelKey,
+}
+
+// invalidLabelValueChars matches the runs of characters not allowed in label
+// values, e.g. the spaces of "Intel Cascade Lake".
+var invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// machineLabels returns the Node labels of the machine attributes of the
+// instance: its machine family, CPU platform, local SSD count, GPU type and
+// count, and network bandwidth tier. The attributes the instance does not
+// have are left out.
+func machineLabels(instance *compute.Instance) map[string]string {
+	labels := map[string]string{}
+	if family := machineFamily(instance.MachineType); family != "" {
+		labels[machineFamilyLabelKey] = family
+	}
+	if platform := labelValue(instance.CpuPlatform); platform != "" {
+		labels[cpuPlatformLabelKey] = platform
+	}
+	var localSSDs int
+	for _, disk := range instance.Disks {
+		if disk != nil && disk.Type == scratchDiskType {
+			localSSDs++
+		}
+	}
+	if localSSDs > 0 {
+		labels[localSSDCountLabelKey] = strconv.Itoa(localSSDs)
+	}
+	var gpus int64
+	for _, accelerator := range instance.GuestAccelerators {
+		if accelerator == nil || accelerator.AcceleratorCount == 0 {
+			continue
+		}
+		// Instances have a single accelerator type.
+		if _, ok := labels[gpuTypeLabelKey]; !ok {
+			labels[gpuTypeLabelKey] = labelValue(lastPathSegment(accelerator.AcceleratorType))
+		}
+		gpus += accelerator.AcceleratorCount
+	}
+	if gpus > 0 {
+		labels[gpuCountLabelKey] = strconv.FormatInt(gpus, 10)
+	}
+	if c := instance.NetworkPerformanceConfig; c != nil && c.TotalEgressBandwidthTier != "" {
+		labels[networkBandwidthTierLabelKey] = labelValue(c.TotalEgressBandwidthTier)
+	}
+	return labels
+}
+
+// machineFamily returns the family of the machine type URL, e.g. n2 for
+// .../machineTypes/n2-standard-4, and n1 for the custom machine types without
+// a family, e.g. .../machineTypes/custom-2-4096.
+func machineFamily(machineType string) string {
+	name := lastPathSegment(machineType)
+	if name == "" {
+		return ""
+	}
+	family, _, _ := strings.Cut(name, "-")
+	if family == "custom" {
+		family = "n1"
+	}
+	return labelValue(family)
+}
+
+func lastPathSegment(url string) string {
+	return url[strings.LastIndex(url, "/")+1:]
+}
+
+// labelValue returns value as a valid label value, with the runs of invalid
+// characters replaced by a dash, or "" if it cannot be one.
+func labelValue(value string) string {
+	value = strings.Trim(invalidLabelValueChars.ReplaceAllString(value, "-"), "-_.")
+	if len(validation.IsValidLabelValue(value)) != 0 {
+		return ""
+	}
+	return value
+}
+
+// annotateMachineLabels reconciles the machine attribute labels of the Node
+// with its instance, removing the ones of the attributes the instance no
+// longer has, e.g. after its GPUs are detached. It returns whether the Node
+// changed.
+func annotateMachineLabels(node *core.Node, instance *compute.Instance) bool {
+	desired := machineLabels(instance)
+	var update bool
+	for _, key := range machineLabelKeys {
+		value, ok := desired[key]
+		current, found := node.ObjectMeta.Labels[key]
+		switch {
+		case !ok && found:
+			delete(node.ObjectMeta.Labels, key)
+			update = true
+		case ok && (!found || current != value):
+			if node.ObjectMeta.Labels == nil {
+				node.ObjectMeta.Labels = make(map[string]string)
+			}
+			node.ObjectMeta.Labels[key] = value
+			update = true
+		}
+	}
+	return update
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	compute "google.golang.org/api/compute/v0.beta"
+	core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestMachineFamily(t *testing.T) {
+	for machineType, want := range map[string]string{
+		"https://www.googleapis.com/compute/v1/projects/p0/zones/z0/machineTypes/n2-standard-4": "n2",
+		"zones/z0/machineTypes/e2-micro":         "e2",
+		"zones/z0/machineTypes/n2-custom-2-4096": "n2",
+		"zones/z0/machineTypes/custom-2-4096":    "n1",
+		"":                                       "",
+	} {
+		if got := machineFamily(machineType); got != want {
+			t.Errorf("machineFamily(%q) = %q, want %q", machineType, got, want)
+		}
+	}
+}
+
+func TestAnnotateMachineLabels(t *testing.T) {
+	gpuInstance := &compute.Instance{
+		MachineType: "zones/z0/machineTypes/a2-highgpu-2g",
+		CpuPlatform: "Intel Cascade Lake",
+		Disks: []*compute.AttachedDisk{
+			{Type: "PERSISTENT"},
+			{Type: "SCRATCH"},
+			{Type: "SCRATCH"},
+		},
+		GuestAccelerators: []*compute.AcceleratorConfig{
+			{AcceleratorType: "projects/p0/zones/z0/acceleratorTypes/nvidia-tesla-a100", AcceleratorCount: 2},
+		},
+		NetworkPerformanceConfig: &compute.NetworkPerformanceConfig{TotalEgressBandwidthTier: "TIER_1"},
+	}
+	gpuLabels := map[string]string{
+		machineFamilyLabelKey:        "a2",
+		cpuPlatformLabelKey:          "Intel-Cascade-Lake",
+		localSSDCountLabelKey:        "2",
+		gpuTypeLabelKey:              "nvidia-tesla-a100",
+		gpuCountLabelKey:             "2",
+		networkBandwidthTierLabelKey: "TIER_1",
+	}
+
+	cs := map[string]struct {
+		labels       map[string]string
+		instance     *compute.Instance
+		outLabels    map[string]string
+		expectUpdate bool
+	}{
+		"add labels": {
+			labels:   map[string]string{"a": "1"},
+			instance: gpuInstance,
+			outLabels: map[string]string{
+				"a":                          "1",
+				machineFamilyLabelKey:        "a2",
+				cpuPlatformLabelKey:          "Intel-Cascade-Lake",
+				localSSDCountLabelKey:        "2",
+				gpuTypeLabelKey:              "nvidia-tesla-a100",
+				gpuCountLabelKey:             "2",
+				networkBandwidthTierLabelKey: "TIER_1",
+			},
+			expectUpdate: true,
+		},
+		"update and remove labels": {
+			labels: gpuLabels,
+			instance: &compute.Instance{
+				MachineType: "zones/z0/machineTypes/n2-standard-4",
+				CpuPlatform: "Intel Ice Lake",
+			},
+			outLabels: map[string]string{
+				machineFamilyLabelKey: "n2",
+				cpuPlatformLabelKey:   "Intel-Ice-Lake",
+			},
+			expectUpdate: true,
+		},
+		"unchanged": {
+			labels:    gpuLabels,
+			instance:  gpuInstance,
+			outLabels: gpuLabels,
+		},
+		"no attributes": {
+			instance: &compute.Instance{},
+		},
+	}
+
+	for name, c := range cs {
+		t.Run(name, func(t *testing.T) {
+			labels := map[string]string{}
+			for key, value := range c.labels {
+				labels[key] = value
+			}
+			if c.labels == nil {
+				labels = nil
+			}
+			node := &core.Node{ObjectMeta: v1.ObjectMeta{Name: "test-node", Labels: labels}}
+			update := annotateMachineLabels(node, c.instance)
+			if got, want := node.ObjectMeta.Labels, c.outLabels; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected labels\n\tgot:\t%v\n\twant:\t%v", got, want)
+			}
+			if update != c.expectUpdate {
+				t.Errorf("got update %t, want %t", update, c.expectUpdate)
+			}
+		})
+	}
+}
+
+func TestMachineLabelsResync(t *testing.T) {
+	// The Node in the informer cache, with the labels of a stopped instance
+	// since resized.
+	cached := &core.Node{ObjectMeta: v1.ObjectMeta{
+		Name:   "test-node",
+		Labels: map[string]string{machineFamilyLabelKey: "e2"},
+	}}
+	c := fake.NewSimpleClientset(cached.DeepCopy())
+	ann := annotator{name: "machine-labels-reconciler", annotate: annotateMachineLabels}
+	na := &nodeAnnotator{
+		c:  c,
+		ns: fakeNodeLister{node: cached},
+		getInstance: func(nodeURL string) (*compute.Instance, error) {
+			return &compute.Instance{MachineType: "zones/z0/machineTypes/n2-standard-4"}, nil
+		},
+		annotators:       []annotator{ann},
+		resyncAnnotators: []annotator{ann},
+		queue:            workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		resyncQueue:      workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+
+	na.resync()
+	na.processNextWorkItem(na.resyncQueue, na.resyncAnnotators)
+
+	node, err := c.CoreV1().Nodes().Get(context.TODO(), cached.Name, v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := node.Labels[machineFamilyLabelKey]; got != "n2" {
+		t.Errorf("got machine family %q on the updated Node, want n2", got)
+	}
+	if got := cached.Labels[machineFamilyLabelKey]; got != "e2" {
+		t.Errorf("got machine family %q on the cached Node, want it unmodified", got)
+	}
+}
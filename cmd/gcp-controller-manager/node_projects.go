@@ -0,0 +1,156 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+)
+
+const (
+	// iamCredentialsBasePath is the endpoint of the IAM Service Account
+	// Credentials API.
+	iamCredentialsBasePath = "https://iamcredentials.googleapis.com/v1/"
+	// computeReadOnlyScope is the scope of the access tokens of the
+	// impersonated service accounts, which only resolve instances.
+	computeReadOnlyScope = "https://www.googleapis.com/auth/compute.readonly"
+)
+
+// configureNodeProjects trusts the nodes of the projects besides the cluster
+// project during CSR validation. The instances of the projects with a service
+// account are resolved by impersonating it, the others with the credentials of
+// the cluster project.
+func (c *gcpConfig) configureNodeProjects(projects []string, serviceAccounts map[string]string) error {
+	for project := range serviceAccounts {
+		if !contains(projects, project) {
+			return fmt.Errorf("service account of project %q which is not a node project", project)
+		}
+	}
+	c.NodeProjects = nil
+	c.NodeProjectsCompute = make(map[string]*compute.Service)
+	for _, project := range projects {
+		if project == "" {
+			return fmt.Errorf("empty node project")
+		}
+		if project == c.ProjectID || contains(c.NodeProjects, project) {
+			continue
+		}
+		c.NodeProjects = append(c.NodeProjects, project)
+		serviceAccount, ok := serviceAccounts[project]
+		if !ok {
+			continue
+		}
+		ts := oauth2.ReuseTokenSource(nil, &impersonatedTokenSource{
+			client:         c.HTTPClient,
+			basePath:       iamCredentialsBasePath,
+			serviceAccount: serviceAccount,
+		})
+		svc, err := compute.New(oauth2.NewClient(context.Background(), ts))
+		if err != nil {
+			return fmt.Errorf("creating GCE API client of project %q: %v", project, err)
+		}
+		svc.BasePath = c.Compute.BasePath
+		svc.UserAgent = userAgentName
+		c.NodeProjectsCompute[project] = svc
+	}
+	return nil
+}
+
+// nodeProjects returns the projects the instances of the nodes may be in,
+// starting with the cluster project.
+func (c *gcpConfig) nodeProjects() []string {
+	return append([]string{c.ProjectID}, c.NodeProjects...)
+}
+
+// computeFor returns the GCE API client resolving the instances of the node
+// project.
+func (c *gcpConfig) computeFor(project string) *compute.Service {
+	if svc, ok := c.NodeProjectsCompute[project]; ok {
+		return svc
+	}
+	return c.Compute
+}
+
+// instanceProject returns the project of the instance, from its zone URL,
+// e.g. https://www.googleapis.com/compute/v1/projects/PROJECT/zones/ZONE, or
+// the cluster project if the zone is not a URL.
+func instanceProject(ctx *controllerContext, inst *compute.Instance) string {
+	parts := strings.Split(inst.Zone, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "projects" {
+			return parts[i+1]
+		}
+	}
+	return ctx.gcpCfg.ProjectID
+}
+
+// impersonatedTokenSource gets access tokens of a service account, which the
+// credentials of its client must be allowed to impersonate.
+type impersonatedTokenSource struct {
+	client         *http.Client
+	basePath       string
+	serviceAccount string
+}
+
+func (ts *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"scope":    []string{computeReadOnlyScope},
+		"lifetime": "3600s",
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	url := ts.basePath + "projects/-/serviceAccounts/" + ts.serviceAccount + ":generateAccessToken"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	recordMetric := csrmetrics.OutboundRPCStartRecorder("iamcredentials.GenerateAccessToken")
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return nil, fmt.Errorf("impersonating service account %q: %v", ts.serviceAccount, err)
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return nil, fmt.Errorf("impersonating service account %q: %v", ts.serviceAccount, err)
+	}
+	var token struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		return nil, fmt.Errorf("impersonating service account %q: malformed response: %v", ts.serviceAccount, err)
+	}
+	recordMetric(csrmetrics.OutboundRPCStatusOK)
+	return &oauth2.Token{AccessToken: token.AccessToken, TokenType: "Bearer", Expiry: token.ExpireTime}, nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestConfigureNodeProjects(t *testing.T) {
+	cs, err := compute.New(http.DefaultClient)
+	if err != nil {
+		t.Fatalf("creating GCE API client: %v", err)
+	}
+	cases := map[string]struct {
+		projects         []string
+		serviceAccounts  map[string]string
+		wantNodeProjects []string
+		wantImpersonated []string
+		expectErr        bool
+	}{
+		"none": {
+			wantNodeProjects: []string{"p0"},
+		},
+		"node projects": {
+			projects:         []string{"p1", "p0", "p2", "p1"},
+			wantNodeProjects: []string{"p0", "p1", "p2"},
+		},
+		"impersonated": {
+			projects:         []string{"p1", "p2"},
+			serviceAccounts:  map[string]string{"p2": "sa@p2.iam.gserviceaccount.com"},
+			wantNodeProjects: []string{"p0", "p1", "p2"},
+			wantImpersonated: []string{"p2"},
+		},
+		"service account of other project": {
+			projects:        []string{"p1"},
+			serviceAccounts: map[string]string{"p2": "sa@p2.iam.gserviceaccount.com"},
+			expectErr:       true,
+		},
+		"empty project": {
+			projects:  []string{""},
+			expectErr: true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := gcpConfig{ProjectID: "p0", Compute: cs, HTTPClient: http.DefaultClient}
+			err := cfg.configureNodeProjects(c.projects, c.serviceAccounts)
+			if got, want := (err != nil), c.expectErr; got != want {
+				t.Fatalf("unexpected error value: %v", err)
+			}
+			if c.expectErr {
+				return
+			}
+			if got := cfg.nodeProjects(); !reflect.DeepEqual(got, c.wantNodeProjects) {
+				t.Errorf("got node projects %q, want %q", got, c.wantNodeProjects)
+			}
+			for _, project := range cfg.nodeProjects() {
+				impersonated := cfg.computeFor(project) != cs
+				if want := contains(c.wantImpersonated, project); impersonated != want {
+					t.Errorf("got impersonated client for project %q: %t, want %t", project, impersonated, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImpersonatedTokenSource(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/projects/-/serviceAccounts/missing@p1.iam.gserviceaccount.com:generateAccessToken" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if got, want := r.URL.Path, "/projects/-/serviceAccounts/sa@p1.iam.gserviceaccount.com:generateAccessToken"; got != want {
+			t.Errorf("got path %q, want %q", got, want)
+		}
+		var req struct {
+			Scope []string `json:"scope"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		if want := []string{computeReadOnlyScope}; !reflect.DeepEqual(req.Scope, want) {
+			t.Errorf("got scope %q, want %q", req.Scope, want)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"accessToken": "token", "expireTime": expiry.Format(time.RFC3339)})
+	}))
+	defer srv.Close()
+
+	ts := &impersonatedTokenSource{client: srv.Client(), basePath: srv.URL + "/", serviceAccount: "sa@p1.iam.gserviceaccount.com"}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token() = %v", err)
+	}
+	if token.AccessToken != "token" || !token.Expiry.Equal(expiry) {
+		t.Errorf("got token %q expiring at %v, want %q expiring at %v", token.AccessToken, token.Expiry, "token", expiry)
+	}
+
+	ts.serviceAccount = "missing@p1.iam.gserviceaccount.com"
+	if _, err := ts.Token(); err == nil {
+		t.Errorf("Token() got no error for a service account which cannot be impersonated")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	compute "google.golang.org/api/compute/v0.beta"
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	spotNodeLabelKey        = "cloud.google.com/gke-spot"
+	preemptibleNodeLabelKey = "cloud.google.com/gke-preemptible"
+
+	spotProvisioningModel = "SPOT"
+)
+
+// parseProvisioningTaint parses the taint of the Spot and Preemptible nodes,
+// KEY[=VALUE]:EFFECT, or returns nil if it is empty.
+func parseProvisioningTaint(taint string) (*core.Taint, error) {
+	if taint == "" {
+		return nil, nil
+	}
+	taints, err := parseTaints(taint)
+	if err != nil {
+		return nil, err
+	}
+	if len(taints) != 1 {
+		return nil, fmt.Errorf("expected a single taint, got %q", taint)
+	}
+	return &taints[0], nil
+}
+
+// provisioningModelLabel returns the label of the Node of a Spot or
+// Preemptible instance, or "" for a standard one.
+func provisioningModelLabel(instance *compute.Instance) string {
+	if instance == nil || instance.Scheduling == nil {
+		return ""
+	}
+	switch {
+	case instance.Scheduling.ProvisioningModel == spotProvisioningModel:
+		return spotNodeLabelKey
+	case instance.Scheduling.Preemptible:
+		return preemptibleNodeLabelKey
+	}
+	return ""
+}
+
+// provisioningModelAnnotator returns an annotate func labelling the Nodes of
+// Spot and Preemptible instances, which can be preempted at any time, and
+// adding the taint to them if it is not nil. The provisioning model of an
+// instance never changes, so neither the label nor the taint are removed,
+// and a taint removed by the user is only added back when the Node reboots.
+func provisioningModelAnnotator(taint *core.Taint) func(*core.Node, *compute.Instance) bool {
+	return func(node *core.Node, instance *compute.Instance) bool {
+		key := provisioningModelLabel(instance)
+		if key == "" {
+			return false
+		}
+		var update bool
+		if node.ObjectMeta.Labels[key] != "true" {
+			if node.ObjectMeta.Labels == nil {
+				node.ObjectMeta.Labels = make(map[string]string)
+			}
+			node.ObjectMeta.Labels[key] = "true"
+			update = true
+		}
+		if taint != nil && !hasTaint(node, taint) {
+			node.Spec.Taints = append(node.Spec.Taints, *taint)
+			update = true
+		}
+		return update
+	}
+}
+
+// hasTaint returns whether the Node has a taint with the key and effect of
+// taint.
+func hasTaint(node *core.Node, taint *core.Taint) bool {
+	for i := range node.Spec.Taints {
+		if node.Spec.Taints[i].MatchTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
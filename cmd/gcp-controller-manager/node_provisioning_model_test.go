@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	compute "google.golang.org/api/compute/v0.beta"
+	core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseProvisioningTaint(t *testing.T) {
+	cs := map[string]struct {
+		taint     string
+		out       *core.Taint
+		expectErr bool
+	}{
+		"empty": {},
+		"taint": {
+			taint: "cloud.google.com/gke-spot=true:NoSchedule",
+			out:   &core.Taint{Key: "cloud.google.com/gke-spot", Value: "true", Effect: core.TaintEffectNoSchedule},
+		},
+		"taint without value": {
+			taint: "spot:PreferNoSchedule",
+			out:   &core.Taint{Key: "spot", Effect: core.TaintEffectPreferNoSchedule},
+		},
+		"several taints": {
+			taint:     "a=1:NoSchedule,b=2:NoSchedule",
+			expectErr: true,
+		},
+		"invalid effect": {
+			taint:     "spot=true:Never",
+			expectErr: true,
+		},
+	}
+
+	for name, c := range cs {
+		t.Run(name, func(t *testing.T) {
+			taint, err := parseProvisioningTaint(c.taint)
+			if got, want := (err != nil), c.expectErr; got != want {
+				t.Fatalf("unexpected error value: %v", err)
+			}
+			if !reflect.DeepEqual(taint, c.out) {
+				t.Errorf("unexpected taint\n\tgot:\t%v\n\twant:\t%v", taint, c.out)
+			}
+		})
+	}
+}
+
+func TestProvisioningModelAnnotator(t *testing.T) {
+	taint := &core.Taint{Key: "cloud.google.com/gke-spot", Value: "true", Effect: core.TaintEffectNoSchedule}
+	spot := &compute.Instance{Scheduling: &compute.Scheduling{ProvisioningModel: "SPOT"}}
+
+	cs := map[string]struct {
+		instance     *compute.Instance
+		taint        *core.Taint
+		labels       map[string]string
+		taints       []core.Taint
+		outLabels    map[string]string
+		outTaints    []core.Taint
+		expectUpdate bool
+	}{
+		"standard instance": {
+			instance: &compute.Instance{Scheduling: &compute.Scheduling{ProvisioningModel: "STANDARD"}},
+			taint:    taint,
+		},
+		"instance without scheduling": {
+			instance: &compute.Instance{},
+			taint:    taint,
+		},
+		"spot instance": {
+			instance:     spot,
+			labels:       map[string]string{"a": "1"},
+			outLabels:    map[string]string{"a": "1", spotNodeLabelKey: "true"},
+			expectUpdate: true,
+		},
+		"preemptible instance with taint": {
+			instance:     &compute.Instance{Scheduling: &compute.Scheduling{Preemptible: true}},
+			taint:        taint,
+			outLabels:    map[string]string{preemptibleNodeLabelKey: "true"},
+			outTaints:    []core.Taint{*taint},
+			expectUpdate: true,
+		},
+		"spot instance with other taint": {
+			instance:     spot,
+			taint:        taint,
+			labels:       map[string]string{spotNodeLabelKey: "true"},
+			taints:       []core.Taint{{Key: "a", Effect: core.TaintEffectNoExecute}},
+			outLabels:    map[string]string{spotNodeLabelKey: "true"},
+			outTaints:    []core.Taint{{Key: "a", Effect: core.TaintEffectNoExecute}, *taint},
+			expectUpdate: true,
+		},
+		"spot instance already labelled and tainted": {
+			instance:  spot,
+			taint:     taint,
+			labels:    map[string]string{spotNodeLabelKey: "true"},
+			taints:    []core.Taint{*taint},
+			outLabels: map[string]string{spotNodeLabelKey: "true"},
+			outTaints: []core.Taint{*taint},
+		},
+	}
+
+	for name, c := range cs {
+		t.Run(name, func(t *testing.T) {
+			node := &core.Node{
+				ObjectMeta: v1.ObjectMeta{Labels: c.labels},
+				Spec:       core.NodeSpec{Taints: c.taints},
+			}
+			update := provisioningModelAnnotator(c.taint)(node, c.instance)
+			if got, want := node.ObjectMeta.Labels, c.outLabels; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected labels\n\tgot:\t%v\n\twant:\t%v", got, want)
+			}
+			if got, want := node.Spec.Taints, c.outTaints; !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected taints\n\tgot:\t%v\n\twant:\t%v", got, want)
+			}
+			if update != c.expectUpdate {
+				t.Errorf("annotate() = %v, want %v", update, c.expectUpdate)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	authorization "k8s.io/api/authorization/v1"
+	capi "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	certutil "k8s.io/kubernetes/pkg/apis/certificates/v1"
+	"k8s.io/kubernetes/pkg/controller/certificates"
+	"sigs.k8s.io/yaml"
+)
+
+// csrApprovalPolicy allows the approval of CSRs for signers that are not
+// approved by the built-in approvers, e.g. client certificates of
+// konnectivity agents or metrics components. A CSR is approved if it matches
+// one of the rules for its signer and requester, and denied if it matches
+// none of them. CSRs of requesters no rule is for are left to other
+// approvers. Rules may not hand out the system:masters or system:nodes
+// organizations, and kube-apiserver client certificates additionally require
+// the requester to pass a SubjectAccessReview.
+type csrApprovalPolicy struct {
+	Rules []csrApprovalRule `json:"rules"`
+}
+
+// csrApprovalRule scopes the CSRs a requester may get approved for a signer.
+type csrApprovalRule struct {
+	// Name identifies the rule in the approval conditions.
+	Name string `json:"name"`
+	// SignerName is the signer of the CSRs the rule is for.
+	SignerName string `json:"signerName"`
+	// Usernames are the requesters the rule is for.
+	Usernames []string `json:"usernames"`
+	// CommonNames are the allowed subject common names. The common name must
+	// be the requester username if empty.
+	CommonNames []string `json:"commonNames,omitempty"`
+	// Organizations are the allowed subject organizations. The subject may
+	// not have organizations if empty.
+	Organizations []string `json:"organizations,omitempty"`
+	// Usages are the exact key usages CSRs must request.
+	Usages []capi.KeyUsage `json:"usages"`
+	// DNSNames are the allowed DNS SANs. Other SANs are never allowed.
+	DNSNames []string `json:"dnsNames,omitempty"`
+}
+
+// reservedSignerNames are the signers whose CSRs are approved by the built-in
+// approvers, and which policy rules can therefore not be for.
+var reservedSignerNames = map[string]bool{
+	capi.KubeAPIServerClientKubeletSignerName: true,
+	capi.KubeletServingSignerName:             true,
+	istiodSignerName:                          true,
+	oidcSignerName:                            true,
+}
+
+// reservedOrganizations are the subject organizations that grant privileges
+// no policy rule may hand out.
+var reservedOrganizations = map[string]bool{
+	"system:masters": true,
+	"system:nodes":   true,
+}
+
+// kubeAPIServerClientPermission is the permission requesters need to get
+// kube-apiserver client certificates approved by the policy, checked with a
+// SubjectAccessReview like the node approvers do.
+var kubeAPIServerClientPermission = authorization.ResourceAttributes{Group: "certificates.k8s.io", Resource: "certificatesigningrequests", Verb: "create", Subresource: "apiserverclient"}
+
+// readCSRApprovalPolicy reads and validates the CSR approval policy at path.
+func readCSRApprovalPolicy(path string) (*csrApprovalPolicy, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSR approval policy %q: %w", path, err)
+	}
+	var policy csrApprovalPolicy
+	if err := yaml.UnmarshalStrict(contents, &policy); err != nil {
+		return nil, fmt.Errorf("error parsing CSR approval policy %q: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid CSR approval policy %q: %w", path, err)
+	}
+	return &policy, nil
+}
+
+func (p *csrApprovalPolicy) validate() error {
+	names := map[string]bool{}
+	for i, r := range p.Rules {
+		switch {
+		case r.Name == "":
+			return fmt.Errorf("rule %d: name is required", i)
+		case names[r.Name]:
+			return fmt.Errorf("rule %q: duplicate name", r.Name)
+		case r.SignerName == "":
+			return fmt.Errorf("rule %q: signerName is required", r.Name)
+		case reservedSignerNames[r.SignerName]:
+			return fmt.Errorf("rule %q: CSRs for signer %q are approved by a built-in approver", r.Name, r.SignerName)
+		case len(r.Usernames) == 0:
+			return fmt.Errorf("rule %q: usernames are required", r.Name)
+		case len(r.Usages) == 0:
+			return fmt.Errorf("rule %q: usages are required", r.Name)
+		}
+		for _, org := range r.Organizations {
+			if reservedOrganizations[org] {
+				return fmt.Errorf("rule %q: organization %q is not allowed", r.Name, org)
+			}
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+// rulesFor returns the rules for CSRs of requester username for signerName.
+func (p *csrApprovalPolicy) rulesFor(signerName, username string) []*csrApprovalRule {
+	var rules []*csrApprovalRule
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.SignerName == signerName && contains(r.Usernames, username) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// check returns why the CSR does not match the rule, or nil if it does.
+func (r *csrApprovalRule) check(csr *capi.CertificateSigningRequest) error {
+	if !hasExactUsages(csr, r.Usages) {
+		return fmt.Errorf("disallowed usages requested")
+	}
+	x509cr, err := certutil.ParseCSR(csr.Spec.Request)
+	if err != nil {
+		return fmt.Errorf("unable to parse csr")
+	}
+	if len(r.CommonNames) == 0 {
+		if x509cr.Subject.CommonName != csr.Spec.Username {
+			return fmt.Errorf("common name %q does not match the requester", x509cr.Subject.CommonName)
+		}
+	} else if !contains(r.CommonNames, x509cr.Subject.CommonName) {
+		return fmt.Errorf("common name %q not allowed", x509cr.Subject.CommonName)
+	}
+	for _, org := range x509cr.Subject.Organization {
+		if !contains(r.Organizations, org) {
+			return fmt.Errorf("organization %q not allowed", org)
+		}
+	}
+	if len(x509cr.URIs) != 0 || len(x509cr.EmailAddresses) != 0 || len(x509cr.IPAddresses) != 0 {
+		return fmt.Errorf("disallowed sans requested")
+	}
+	for _, name := range x509cr.DNSNames {
+		if !contains(r.DNSNames, name) {
+			return fmt.Errorf("dns name %q not allowed", name)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newPolicyApprover(ctx *controllerContext) *policyApprover {
+	return &policyApprover{
+		ctx: ctx,
+	}
+}
+
+// policyApprover approves the CSRs allowed by the CSR approval policy.
+type policyApprover struct {
+	ctx *controllerContext
+}
+
+func (a *policyApprover) handle(_ context.Context, csr *capi.CertificateSigningRequest) error {
+	rules := a.ctx.csrApprovalPolicy.rulesFor(csr.Spec.SignerName, csr.Spec.Username)
+	if len(rules) == 0 {
+		return nil
+	}
+	if approved, denied := certificates.GetCertApprovalCondition(&csr.Status); approved || denied {
+		return nil
+	}
+
+	var reasons []string
+	for _, r := range rules {
+		err := r.check(csr)
+		if err == nil {
+			return a.authorizeAndApprove(csr, r.Name)
+		}
+		reasons = append(reasons, fmt.Sprintf("rule %q: %v", r.Name, err))
+	}
+	return a.deny(csr, strings.Join(reasons, "; "))
+}
+
+// authorizeAndApprove approves the CSR matching rule, after a
+// SubjectAccessReview of its requester for kube-apiserver client certificates.
+// The CSR is left pending if the review is not approved.
+func (a *policyApprover) authorizeAndApprove(csr *capi.CertificateSigningRequest, rule string) error {
+	if csr.Spec.SignerName == capi.KubeAPIServerClientSignerName {
+		approved, err := authorizeSAR(a.ctx, csr, kubeAPIServerClientPermission)
+		if err != nil {
+			return err
+		}
+		if !approved {
+			return certificates.IgnorableError("csr %q matches rule %q but subject access review was not approved", csr.Name, rule)
+		}
+	}
+	return a.approve(csr, rule)
+}
+
+func (a *policyApprover) approve(csr *capi.CertificateSigningRequest, rule string) error {
+	csr.Status.Conditions = append(csr.Status.Conditions, capi.CertificateSigningRequestCondition{
+		Type:    capi.CertificateApproved,
+		Reason:  "AutoApproved",
+		Message: fmt.Sprintf("approved by CSR approval policy rule %q", rule),
+		Status:  v1.ConditionTrue,
+	})
+	_, err := a.ctx.client.CertificatesV1().CertificateSigningRequests().UpdateApproval(context.TODO(), csr.Name, csr, metav1.UpdateOptions{})
+	return err
+}
+
+func (a *policyApprover) deny(csr *capi.CertificateSigningRequest, msg string) error {
+	csr.Status.Conditions = append(csr.Status.Conditions, capi.CertificateSigningRequestCondition{
+		Type:    capi.CertificateDenied,
+		Reason:  "AutoDenied",
+		Message: msg,
+		Status:  v1.ConditionTrue,
+	})
+	_, err := a.ctx.client.CertificatesV1().CertificateSigningRequests().UpdateApproval(context.TODO(), csr.Name, csr, metav1.UpdateOptions{})
+	return err
+}
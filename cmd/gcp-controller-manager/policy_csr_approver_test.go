@@ -0,0 +1,299 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	authorization "k8s.io/api/authorization/v1"
+	capi "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	testclient "k8s.io/client-go/testing"
+	"k8s.io/kubernetes/pkg/controller/certificates"
+)
+
+const testCSRApprovalPolicy = `
+rules:
+- name: konnectivity-agent
+  signerName: kubernetes.io/kube-apiserver-client
+  usernames:
+  - system:serviceaccount:kube-system:konnectivity-agent
+  commonNames:
+  - system:konnectivity-agent
+  organizations:
+  - system:konnectivity
+  usages:
+  - digital signature
+  - client auth
+- name: metrics-server
+  signerName: example.com/metrics
+  usernames:
+  - system:serviceaccount:kube-system:metrics-server
+  usages:
+  - digital signature
+  - server auth
+  dnsNames:
+  - metrics-server.kube-system.svc
+`
+
+func TestReadCSRApprovalPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		policy  string
+		wantErr string
+	}{
+		{
+			desc:   "valid",
+			policy: testCSRApprovalPolicy,
+		},
+		{
+			desc:    "unknown field",
+			policy:  "rules:\n- name: a\n  signer: example.com/a\n",
+			wantErr: "error parsing",
+		},
+		{
+			desc:    "missing name",
+			policy:  "rules:\n- signerName: example.com/a\n  usernames: [a]\n  usages: [client auth]\n",
+			wantErr: "name is required",
+		},
+		{
+			desc:    "duplicate name",
+			policy:  "rules:\n- name: a\n  signerName: example.com/a\n  usernames: [a]\n  usages: [client auth]\n- name: a\n  signerName: example.com/b\n  usernames: [a]\n  usages: [client auth]\n",
+			wantErr: "duplicate name",
+		},
+		{
+			desc:    "node signer",
+			policy:  "rules:\n- name: a\n  signerName: kubernetes.io/kube-apiserver-client-kubelet\n  usernames: [a]\n  usages: [client auth]\n",
+			wantErr: "built-in approver",
+		},
+		{
+			desc:    "missing usernames",
+			policy:  "rules:\n- name: a\n  signerName: example.com/a\n  usages: [client auth]\n",
+			wantErr: "usernames are required",
+		},
+		{
+			desc:    "missing usages",
+			policy:  "rules:\n- name: a\n  signerName: example.com/a\n  usernames: [a]\n",
+			wantErr: "usages are required",
+		},
+		{
+			desc:    "masters organization",
+			policy:  "rules:\n- name: a\n  signerName: kubernetes.io/kube-apiserver-client\n  usernames: [a]\n  organizations: [system:masters]\n  usages: [client auth]\n",
+			wantErr: "organization \"system:masters\" is not allowed",
+		},
+		{
+			desc:    "nodes organization",
+			policy:  "rules:\n- name: a\n  signerName: example.com/a\n  usernames: [a]\n  organizations: [system:nodes]\n  usages: [client auth]\n",
+			wantErr: "organization \"system:nodes\" is not allowed",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(path, []byte(tc.policy), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readCSRApprovalPolicy(path)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("readCSRApprovalPolicy() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("readCSRApprovalPolicy() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyApproverHandle(t *testing.T) {
+	pk, err := ecdsa.GenerateKey(elliptic.P224(), insecureRand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(testCSRApprovalPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := readCSRApprovalPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	konnectivity := csrBuilder{
+		cn:         "system:konnectivity-agent",
+		orgs:       []string{"system:konnectivity"},
+		requestor:  "system:serviceaccount:kube-system:konnectivity-agent",
+		signerName: capi.KubeAPIServerClientSignerName,
+		usages:     []capi.KeyUsage{capi.UsageDigitalSignature, capi.UsageClientAuth},
+		key:        pk,
+	}
+	metrics := csrBuilder{
+		cn:         "system:serviceaccount:kube-system:metrics-server",
+		requestor:  "system:serviceaccount:kube-system:metrics-server",
+		signerName: "example.com/metrics",
+		usages:     []capi.KeyUsage{capi.UsageDigitalSignature, capi.UsageServerAuth},
+		dns:        []string{"metrics-server.kube-system.svc"},
+		key:        pk,
+	}
+
+	tcs := []struct {
+		desc        string
+		csr         func() csrBuilder
+		sarDenied   bool
+		wantActions int
+		wantDenied  bool
+		wantErr     bool
+	}{
+		{
+			desc:        "konnectivity agent",
+			csr:         func() csrBuilder { return konnectivity },
+			wantActions: 2,
+		},
+		{
+			desc:        "konnectivity agent without permission",
+			csr:         func() csrBuilder { return konnectivity },
+			sarDenied:   true,
+			wantActions: 1,
+			wantErr:     true,
+		},
+		{
+			desc:        "metrics server",
+			csr:         func() csrBuilder { return metrics },
+			wantActions: 1,
+		},
+		{
+			desc: "ignore other requesters",
+			csr: func() csrBuilder {
+				b := konnectivity
+				b.requestor = "system:serviceaccount:kube-system:other"
+				return b
+			},
+		},
+		{
+			desc: "ignore other signers",
+			csr: func() csrBuilder {
+				b := konnectivity
+				b.signerName = "example.com/other"
+				return b
+			},
+		},
+		{
+			desc: "extra usage",
+			csr: func() csrBuilder {
+				b := konnectivity
+				b.usages = append([]capi.KeyUsage{capi.UsageServerAuth}, b.usages...)
+				return b
+			},
+			wantActions: 1,
+			wantDenied:  true,
+		},
+		{
+			desc: "bad common name",
+			csr: func() csrBuilder {
+				b := konnectivity
+				b.cn = "system:admin"
+				return b
+			},
+			wantActions: 1,
+			wantDenied:  true,
+		},
+		{
+			desc: "common name must match the requester",
+			csr: func() csrBuilder {
+				b := metrics
+				b.cn = "metrics-server"
+				return b
+			},
+			wantActions: 1,
+			wantDenied:  true,
+		},
+		{
+			desc: "bad organization",
+			csr: func() csrBuilder {
+				b := konnectivity
+				b.orgs = []string{"system:masters"}
+				return b
+			},
+			wantActions: 1,
+			wantDenied:  true,
+		},
+		{
+			desc: "bad dns name",
+			csr: func() csrBuilder {
+				b := metrics
+				b.dns = []string{"kubernetes.default.svc"}
+				return b
+			},
+			wantActions: 1,
+			wantDenied:  true,
+		},
+		{
+			desc: "email san",
+			csr: func() csrBuilder {
+				b := metrics
+				b.emails = []string{"metrics@example.com"}
+				return b
+			},
+			wantActions: 1,
+			wantDenied:  true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			client := &fake.Clientset{}
+			client.AddReactor("create", "subjectaccessreviews", func(action testclient.Action) (handled bool, ret runtime.Object, err error) {
+				sar := action.(testclient.CreateAction).GetObject().(*authorization.SubjectAccessReview)
+				if sar.Spec.User != konnectivity.requestor || *sar.Spec.ResourceAttributes != kubeAPIServerClientPermission {
+					t.Errorf("unexpected SubjectAccessReview: %#v", sar.Spec)
+				}
+				return true, &authorization.SubjectAccessReview{
+					Status: authorization.SubjectAccessReviewStatus{Allowed: !tc.sarDenied},
+				}, nil
+			})
+			approver := policyApprover{
+				ctx: &controllerContext{client: client, csrApprovalPolicy: policy},
+			}
+
+			csr := makeFancyTestCSR(t, tc.csr())
+			err := approver.handle(context.TODO(), csr)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("handle() = %v, want error: %v", err, tc.wantErr)
+			}
+			as := client.Actions()
+			if len(as) != tc.wantActions {
+				t.Fatalf("expected %d actions, got: %d", tc.wantActions, len(as))
+			}
+			if tc.wantActions == 0 || tc.wantErr {
+				return
+			}
+			csr = as[len(as)-1].(testclient.UpdateAction).GetObject().(*capi.CertificateSigningRequest)
+			approved, denied := certificates.GetCertApprovalCondition(&csr.Status)
+			if approved == tc.wantDenied || denied != tc.wantDenied {
+				t.Fatalf("expected CSR to be denied=%v: %#v", tc.wantDenied, csr.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	capi "k8s.io/api/certificates/v1"
+	"k8s.io/cloud-provider-gcp/pkg/csrmetrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// verificationWebhookFailureThreshold is the number of consecutive
+	// failures after which a verification webhook is skipped.
+	verificationWebhookFailureThreshold = 5
+	// verificationWebhookCooldown is how long a verification webhook is
+	// skipped for once it reached verificationWebhookFailureThreshold.
+	verificationWebhookCooldown = time.Minute
+	// verificationWebhookMaxResponseBytes bounds the size of responses read
+	// from verification webhooks.
+	verificationWebhookMaxResponseBytes = 64 * 1024
+	// verificationWebhookMaxReasonLength bounds the deny reason copied into
+	// the CSR condition.
+	verificationWebhookMaxReasonLength = 1024
+	// verificationWebhookRetryBackoff is the delay before the first retry of
+	// a failed call to a verification webhook, doubled on every retry.
+	verificationWebhookRetryBackoff = 100 * time.Millisecond
+
+	// verificationWebhookFailurePolicyIgnore approves the CSRs without the
+	// verdict of a verification webhook failing transiently. Once repeated
+	// such failures open its circuit breaker, the webhook is skipped and the
+	// CSRs are kept pending until it recovers. Other failures, such as
+	// malformed responses, also keep the CSRs pending.
+	verificationWebhookFailurePolicyIgnore = "Ignore"
+	// verificationWebhookFailurePolicyFail keeps the CSRs pending, to be
+	// retried, until a failing verification webhook allows or denies them.
+	// The webhooks are never skipped.
+	verificationWebhookFailurePolicyFail = "Fail"
+)
+
+var errVerificationWebhookCircuitOpen = errors.New("verification webhook circuit breaker is open")
+
+// verificationRequest is the body POSTed to verification webhooks.
+type verificationRequest struct {
+	Name        string   `json:"name"`
+	SignerName  string   `json:"signerName"`
+	Username    string   `json:"username"`
+	Groups      []string `json:"groups,omitempty"`
+	CommonName  string   `json:"commonName"`
+	DNSNames    []string `json:"dnsNames,omitempty"`
+	IPAddresses []string `json:"ipAddresses,omitempty"`
+}
+
+// verificationResponse is the body expected from verification webhooks.
+// Allowed is required.
+type verificationResponse struct {
+	Allowed *bool  `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// verificationWebhook calls an external endpoint to verify node CSRs before
+// they are approved. Calls are bounded by a timeout and, with the Ignore
+// failure policy, guarded by a circuit breaker, so an unavailable webhook
+// does not hold up the approver with calls bound to time out. The CSRs are
+// never approved while its circuit is open.
+type verificationWebhook struct {
+	url           string
+	client        *http.Client
+	retries       int
+	failurePolicy string
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+	now                 func() time.Time
+}
+
+// newVerificationWebhooks returns the verification webhooks of urls. Their
+// server certificates are verified against rootCAs, or the system roots if
+// nil.
+func newVerificationWebhooks(urls []string, rootCAs *x509.CertPool, timeout time.Duration, retries int, failurePolicy string) []*verificationWebhook {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	var webhooks []*verificationWebhook
+	for _, url := range urls {
+		webhooks = append(webhooks, &verificationWebhook{
+			url:           url,
+			client:        &http.Client{Timeout: timeout, Transport: transport},
+			retries:       retries,
+			failurePolicy: failurePolicy,
+			now:           time.Now,
+		})
+	}
+	return webhooks
+}
+
+// validateVerificationWebhookURLs returns an error if any of urls is not an
+// https URL: the verdict of the webhooks gates the approval of the node
+// CSRs, so it must not be spoofable on the network path.
+func validateVerificationWebhookURLs(urls []string) error {
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("invalid verification webhook URL %q: %v", u, err)
+		}
+		if parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid verification webhook URL %q: must be an https URL", u)
+		}
+	}
+	return nil
+}
+
+// loadVerificationWebhookRootCAs returns the CA certificates of the PEM
+// bundle at path, against which the server certificates of the
+// verification webhooks are verified.
+func loadVerificationWebhookRootCAs(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificate found in %q", path)
+	}
+	return pool, nil
+}
+
+// verify returns whether the webhook allows the CSR and, if not, why. It
+// returns errVerificationWebhookCircuitOpen if the webhook is being skipped
+// after repeated transient failures, which only happens with the Ignore
+// failure policy.
+func (w *verificationWebhook) verify(ctx context.Context, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (bool, string, error) {
+	if w.failurePolicy == verificationWebhookFailurePolicyIgnore && !w.allow() {
+		return false, "", fmt.Errorf("verification webhook %q: %w", w.url, errVerificationWebhookCircuitOpen)
+	}
+	recordMetric := csrmetrics.OutboundRPCStartRecorder("verificationwebhook.Verify")
+	allowed, reason, err := w.callWithRetries(ctx, csr, x509cr)
+	if err != nil {
+		recordMetric(csrmetrics.OutboundRPCStatusError)
+		var transient *transientWebhookError
+		if errors.As(err, &transient) {
+			w.recordFailure()
+		}
+		return false, "", fmt.Errorf("verification webhook %q: %w", w.url, err)
+	}
+	recordMetric(csrmetrics.OutboundRPCStatusOK)
+	w.recordSuccess()
+	return allowed, reason, nil
+}
+
+// ignore returns whether the CSRs are approved despite the error returned by
+// verify: only with the Ignore failure policy, when the webhook failed
+// transiently. The CSRs are not approved while the webhook is skipped.
+func (w *verificationWebhook) ignore(err error) bool {
+	if w.failurePolicy != verificationWebhookFailurePolicyIgnore {
+		return false
+	}
+	var transient *transientWebhookError
+	return errors.As(err, &transient)
+}
+
+// callWithRetries calls the webhook, retrying up to w.retries times with an
+// exponential backoff on transient failures: connection errors, timeouts,
+// and 429 or 5xx response codes.
+func (w *verificationWebhook) callWithRetries(ctx context.Context, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (bool, string, error) {
+	backoff := verificationWebhookRetryBackoff
+	for attempt := 0; ; attempt++ {
+		allowed, reason, err := w.call(ctx, csr, x509cr)
+		var transient *transientWebhookError
+		if err == nil || attempt >= w.retries || !errors.As(err, &transient) {
+			return allowed, reason, err
+		}
+		klog.V(2).Infof("verification webhook %q failed for CSR %q, retrying in %v: %v", w.url, csr.Name, backoff, err)
+		select {
+		case <-ctx.Done():
+			return false, "", err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transientWebhookError is a failed call to a verification webhook which
+// may succeed if retried.
+type transientWebhookError struct {
+	err error
+}
+
+func (e *transientWebhookError) Error() string { return e.err.Error() }
+
+func (e *transientWebhookError) Unwrap() error { return e.err }
+
+func (w *verificationWebhook) call(ctx context.Context, csr *capi.CertificateSigningRequest, x509cr *x509.CertificateRequest) (bool, string, error) {
+	req := verificationRequest{
+		Name:       csr.Name,
+		SignerName: csr.Spec.SignerName,
+		Username:   csr.Spec.Username,
+		Groups:     csr.Spec.Groups,
+		CommonName: x509cr.Subject.CommonName,
+		DNSNames:   x509cr.DNSNames,
+	}
+	for _, ip := range x509cr.IPAddresses {
+		req.IPAddresses = append(req.IPAddresses, ip.String())
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return false, "", err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return false, "", &transientWebhookError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected response code %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return false, "", &transientWebhookError{err}
+		}
+		return false, "", err
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, verificationWebhookMaxResponseBytes+1))
+	if err != nil {
+		return false, "", err
+	}
+	if len(respBody) > verificationWebhookMaxResponseBytes {
+		return false, "", fmt.Errorf("response exceeds %d bytes", verificationWebhookMaxResponseBytes)
+	}
+	var verification verificationResponse
+	if err := json.Unmarshal(respBody, &verification); err != nil {
+		return false, "", fmt.Errorf("malformed response: %v", err)
+	}
+	if verification.Allowed == nil {
+		return false, "", errors.New("malformed response: missing required field \"allowed\"")
+	}
+	reason := verification.Reason
+	if len(reason) > verificationWebhookMaxReasonLength {
+		reason = reason[:verificationWebhookMaxReasonLength]
+	}
+	return *verification.Allowed, reason, nil
+}
+
+// allow returns false while the circuit breaker is open.
+func (w *verificationWebhook) allow() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !w.now().Before(w.openUntil)
+}
+
+func (w *verificationWebhook) recordSuccess() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.consecutiveFailures = 0
+}
+
+func (w *verificationWebhook) recordFailure() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.consecutiveFailures++
+	if w.consecutiveFailures >= verificationWebhookFailureThreshold {
+		klog.Warningf("verification webhook %q failed %d consecutive times, skipping it for %v", w.url, w.consecutiveFailures, verificationWebhookCooldown)
+		w.openUntil = w.now().Add(verificationWebhookCooldown)
+		w.consecutiveFailures = 0
+	}
+}
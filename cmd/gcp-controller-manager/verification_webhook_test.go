@@ -0,0 +1,331 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	capi "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVerificationWebhook(t *testing.T) {
+	csr := &capi.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-1"}}
+	x509cr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:node-1"}}
+
+	for _, tc := range []struct {
+		desc        string
+		handler     http.HandlerFunc
+		wantAllowed bool
+		wantReason  string
+		wantErr     bool
+	}{
+		{
+			desc:        "allowed",
+			handler:     func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, `{"allowed": true}`) },
+			wantAllowed: true,
+		},
+		{
+			desc: "denied",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"allowed": false, "reason": "unknown node"}`)
+			},
+			wantReason: "unknown node",
+		},
+		{
+			desc:    "missing allowed field",
+			handler: func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, `{"reason": "ok"}`) },
+			wantErr: true,
+		},
+		{
+			desc:    "malformed response",
+			handler: func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, `not json`) },
+			wantErr: true,
+		},
+		{
+			desc:    "error response code",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+			wantErr: true,
+		},
+		{
+			desc: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(500 * time.Millisecond)
+				fmt.Fprint(w, `{"allowed": true}`)
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+			webhook := newVerificationWebhooks([]string{server.URL}, nil, 100*time.Millisecond, 0, verificationWebhookFailurePolicyIgnore)[0]
+
+			allowed, reason, err := webhook.verify(context.Background(), csr, x509cr)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("verify() got err %v, want error %t", err, tc.wantErr)
+			}
+			if allowed != tc.wantAllowed || reason != tc.wantReason {
+				t.Errorf("verify() got (%t, %q), want (%t, %q)", allowed, reason, tc.wantAllowed, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestValidateVerificationWebhookURLs(t *testing.T) {
+	for _, tc := range []struct {
+		urls    []string
+		wantErr bool
+	}{
+		{urls: nil},
+		{urls: []string{"https://verifier.example.com/verify", "https://10.0.0.1:8443"}},
+		{urls: []string{"https://verifier.example.com/verify", "http://verifier.example.com/verify"}, wantErr: true},
+		{urls: []string{"verifier.example.com/verify"}, wantErr: true},
+		{urls: []string{"https:///verify"}, wantErr: true},
+		{urls: []string{"https://verifier.example.com/%zz"}, wantErr: true},
+	} {
+		err := validateVerificationWebhookURLs(tc.urls)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("validateVerificationWebhookURLs(%q) got err %v, want error %t", tc.urls, err, tc.wantErr)
+		}
+	}
+}
+
+func TestVerificationWebhookRootCAs(t *testing.T) {
+	csr := &capi.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-1"}}
+	x509cr := &x509.CertificateRequest{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"allowed": true}`)
+	}))
+	defer server.Close()
+
+	// The server certificate is not signed by the system roots.
+	webhook := newVerificationWebhooks([]string{server.URL}, nil, time.Second, 0, verificationWebhookFailurePolicyFail)[0]
+	if _, _, err := webhook.verify(context.Background(), csr, x509cr); err == nil {
+		t.Fatalf("verify() with the system roots succeeded, want error")
+	}
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rootCAs, err := loadVerificationWebhookRootCAs(caFile)
+	if err != nil {
+		t.Fatalf("loadVerificationWebhookRootCAs() = %v", err)
+	}
+	webhook = newVerificationWebhooks([]string{server.URL}, rootCAs, time.Second, 0, verificationWebhookFailurePolicyFail)[0]
+	allowed, _, err := webhook.verify(context.Background(), csr, x509cr)
+	if err != nil || !allowed {
+		t.Errorf("verify() got (%t, %v), want allowed", allowed, err)
+	}
+
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalidFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadVerificationWebhookRootCAs(invalidFile); err == nil {
+		t.Errorf("loadVerificationWebhookRootCAs() of an invalid bundle succeeded, want error")
+	}
+}
+
+func TestVerificationWebhookCircuitBreaker(t *testing.T) {
+	csr := &capi.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-1"}}
+	x509cr := &x509.CertificateRequest{}
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	webhook := newVerificationWebhooks([]string{server.URL}, nil, time.Second, 0, verificationWebhookFailurePolicyIgnore)[0]
+	webhook.now = func() time.Time { return now }
+
+	for i := 0; i < verificationWebhookFailureThreshold; i++ {
+		if _, _, err := webhook.verify(context.Background(), csr, x509cr); err == nil || errors.Is(err, errVerificationWebhookCircuitOpen) {
+			t.Fatalf("call %d: got err %v, want webhook error", i, err)
+		}
+	}
+	_, _, err := webhook.verify(context.Background(), csr, x509cr)
+	if !errors.Is(err, errVerificationWebhookCircuitOpen) {
+		t.Fatalf("got err %v, want %v", err, errVerificationWebhookCircuitOpen)
+	}
+	// The CSRs are not approved while the webhook is skipped.
+	if webhook.ignore(err) {
+		t.Errorf("ignore(%v) got true, want false", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != verificationWebhookFailureThreshold {
+		t.Errorf("got %d calls, want %d", got, verificationWebhookFailureThreshold)
+	}
+
+	now = now.Add(verificationWebhookCooldown)
+	if _, _, err := webhook.verify(context.Background(), csr, x509cr); err == nil || errors.Is(err, errVerificationWebhookCircuitOpen) {
+		t.Fatalf("got err %v after cooldown, want webhook error", err)
+	}
+}
+
+func TestVerificationWebhookRetries(t *testing.T) {
+	csr := &capi.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-1"}}
+	x509cr := &x509.CertificateRequest{}
+
+	for _, tc := range []struct {
+		desc        string
+		failures    int32
+		code        int
+		retries     int
+		wantCalls   int32
+		wantAllowed bool
+		wantErr     bool
+	}{
+		{
+			desc:        "succeeds after retries",
+			failures:    2,
+			code:        http.StatusServiceUnavailable,
+			retries:     2,
+			wantCalls:   3,
+			wantAllowed: true,
+		},
+		{
+			desc:      "retries exhausted",
+			failures:  3,
+			code:      http.StatusTooManyRequests,
+			retries:   2,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			desc:      "no retries",
+			failures:  1,
+			code:      http.StatusBadGateway,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			desc:      "client errors are not retried",
+			failures:  1,
+			code:      http.StatusBadRequest,
+			retries:   2,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= tc.failures {
+					w.WriteHeader(tc.code)
+					return
+				}
+				fmt.Fprint(w, `{"allowed": true}`)
+			}))
+			defer server.Close()
+			webhook := newVerificationWebhooks([]string{server.URL}, nil, time.Second, tc.retries, verificationWebhookFailurePolicyIgnore)[0]
+
+			allowed, _, err := webhook.verify(context.Background(), csr, x509cr)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("verify() got err %v, want error %t", err, tc.wantErr)
+			}
+			if allowed != tc.wantAllowed {
+				t.Errorf("verify() got allowed %t, want %t", allowed, tc.wantAllowed)
+			}
+			if got := atomic.LoadInt32(&calls); got != tc.wantCalls {
+				t.Errorf("got %d calls, want %d", got, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestVerificationWebhookFailurePolicyFail(t *testing.T) {
+	csr := &capi.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-1"}}
+	x509cr := &x509.CertificateRequest{}
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	webhook := newVerificationWebhooks([]string{server.URL}, nil, time.Second, 0, verificationWebhookFailurePolicyFail)[0]
+
+	// The webhook is never skipped, however many times it fails.
+	for i := 0; i < 2*verificationWebhookFailureThreshold; i++ {
+		if _, _, err := webhook.verify(context.Background(), csr, x509cr); err == nil || errors.Is(err, errVerificationWebhookCircuitOpen) {
+			t.Fatalf("call %d: got err %v, want webhook error", i, err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 2*verificationWebhookFailureThreshold {
+		t.Errorf("got %d calls, want %d", got, 2*verificationWebhookFailureThreshold)
+	}
+}
+
+func TestVerificationWebhookIgnore(t *testing.T) {
+	csr := &capi.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr-1"}}
+	x509cr := &x509.CertificateRequest{}
+
+	for _, tc := range []struct {
+		desc          string
+		handler       http.HandlerFunc
+		failurePolicy string
+		wantIgnore    bool
+	}{
+		{
+			desc:          "unavailable",
+			handler:       func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			failurePolicy: verificationWebhookFailurePolicyIgnore,
+			wantIgnore:    true,
+		},
+		{
+			desc:          "unavailable with the Fail policy",
+			handler:       func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			failurePolicy: verificationWebhookFailurePolicyFail,
+		},
+		{
+			desc:          "client error",
+			handler:       func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusForbidden) },
+			failurePolicy: verificationWebhookFailurePolicyIgnore,
+		},
+		{
+			desc:          "malformed response",
+			handler:       func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, `{}`) },
+			failurePolicy: verificationWebhookFailurePolicyIgnore,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+			webhook := newVerificationWebhooks([]string{server.URL}, nil, time.Second, 0, tc.failurePolicy)[0]
+
+			_, _, err := webhook.verify(context.Background(), csr, x509cr)
+			if err == nil {
+				t.Fatal("verify() got no error")
+			}
+			if got := webhook.ignore(err); got != tc.wantIgnore {
+				t.Errorf("ignore(%v) got %t, want %t", err, got, tc.wantIgnore)
+			}
+		})
+	}
+}
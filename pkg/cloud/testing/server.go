@@ -0,0 +1,742 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testing provides a fake GCE compute API server keeping the
+// resources in memory, which providers/gce and the controllers can be run
+// against in integration tests and local development without a GCP project.
+//
+// The server implements the REST conventions of the compute API for any
+// collection of the v1, beta and alpha versions rather than each resource:
+// insert, get, list, aggregated list, update, patch and delete, along with
+// the operations they return. The custom methods setting a field of a
+// resource (e.g. setLabels, setTarget) or adding to and removing from a list
+// of a resource (e.g. addInstance, removeHealthCheck) are applied
+// generically, others must be registered with HandleMethod. The resources are
+// not validated, nor are the references between them.
+package testing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MethodFunc applies the custom method of a resource to it, given the body
+// and the query of the request.
+type MethodFunc func(resource map[string]interface{}, body map[string]interface{}, query map[string][]string) error
+
+// Fault is an error the server answers the requests matching it with.
+type Fault struct {
+	// Method is the HTTP method of the requests, any if empty.
+	Method string
+	// Path is a regular expression matched against the path of the
+	// requests, e.g. "/instances/node-1$", any if empty.
+	Path string
+	// Code is the HTTP status code of the error.
+	Code int
+	// Reason is the reason of the error, e.g. "resourceInUseByAnotherResource".
+	Reason string
+	// Message is the message of the error.
+	Message string
+	// Operation fails the operation of the request instead of the request,
+	// as GCE does for the errors found after accepting a mutation.
+	Operation bool
+	// Times is how many requests the fault answers, all of them if 0.
+	Times int
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Body   []byte
+}
+
+// Server is a fake GCE compute API server.
+type Server struct {
+	// OperationPolls is how many gets or waits report the operations of the
+	// mutations RUNNING before they are DONE.
+	OperationPolls int
+
+	server *httptest.Server
+
+	lock sync.Mutex
+	// resources are the resources by path relative to the projects, e.g.
+	// "p1/zones/z1/instances/n1".
+	resources map[string]map[string]interface{}
+	// polls are the remaining polls of the RUNNING operations by path.
+	polls    map[string]int
+	quotas   map[string]int
+	faults   []*Fault
+	methods  map[string]MethodFunc
+	requests []Request
+	nextID   uint64
+}
+
+// NewServer starts a fake GCE compute API server. It must be closed once
+// done.
+func NewServer() *Server {
+	s := &Server{
+		resources: map[string]map[string]interface{}{},
+		polls:     map[string]int{},
+		quotas:    map[string]int{},
+		methods:   map[string]MethodFunc{},
+		nextID:    1000,
+	}
+	s.HandleMethod("instances", "updateNetworkInterface", updateNetworkInterface)
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// URL returns the root URL of the server, which the endpoints of the compute
+// API versions are under, e.g. URL()+"/compute/v1/".
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetQuota limits the number of the resources of the collection, e.g.
+// "addresses", across all the projects and scopes. Insertions beyond it fail
+// with a quotaExceeded error.
+func (s *Server) SetQuota(collection string, limit int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.quotas[collection] = limit
+}
+
+// AddFault makes the server answer the requests matching the fault with its
+// error, ahead of the faults added before.
+func (s *Server) AddFault(f Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append([]*Fault{&f}, s.faults...)
+}
+
+// HandleMethod registers the custom method of the resources of the
+// collection, e.g. ("instances", "setMachineType").
+func (s *Server) HandleMethod(collection, method string, fn MethodFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.methods[collection+"/"+method] = fn
+}
+
+// Requests returns the requests received by the server, in order.
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Put stores the resource at the path relative to the projects, e.g.
+// "p1/zones/z1/instances/n1", replacing the existing one.
+func (s *Server) Put(path string, resource interface{}) error {
+	r, err := toMap(resource)
+	if err != nil {
+		return err
+	}
+	p, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.initResource(p, r)
+	s.resources[p.key()] = r
+	return nil
+}
+
+// Get decodes the resource at the path relative to the projects into out,
+// and returns whether it exists.
+func (s *Server) Get(path string, out interface{}) (bool, error) {
+	p, err := parsePath(path)
+	if err != nil {
+		return false, err
+	}
+	s.lock.Lock()
+	r, ok := s.resources[p.key()]
+	var data []byte
+	if ok {
+		data, err = json.Marshal(r)
+	}
+	s.lock.Unlock()
+	if !ok || err != nil {
+		return ok, err
+	}
+	return true, json.Unmarshal(data, out)
+}
+
+// resourcePath is the path of a request relative to the projects.
+type resourcePath struct {
+	project string
+	// scope is "global", "zones/ZONE" or "regions/REGION".
+	scope      string
+	collection string
+	name       string
+	method     string
+	aggregated bool
+}
+
+func (p *resourcePath) collectionKey() string {
+	return p.project + "/" + p.scope + "/" + p.collection
+}
+
+func (p *resourcePath) key() string {
+	return p.collectionKey() + "/" + p.name
+}
+
+// parsePath parses a path relative to the projects, e.g.
+// "p1/zones/z1/instances/n1/setLabels".
+func parsePath(path string) (*resourcePath, error) {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segs) < 2 || segs[0] == "" {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	p := &resourcePath{project: segs[0], scope: "global"}
+	rest := segs[1:]
+	switch {
+	case rest[0] == "aggregated" && len(rest) == 2:
+		p.aggregated = true
+		p.collection = rest[1]
+		return p, nil
+	case rest[0] == "global":
+		rest = rest[1:]
+	case (rest[0] == "zones" || rest[0] == "regions") && len(rest) > 2:
+		p.scope = rest[0] + "/" + rest[1]
+		rest = rest[2:]
+	}
+	if len(rest) == 0 || len(rest) > 3 {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	p.collection = rest[0]
+	if len(rest) > 1 {
+		p.name = rest[1]
+	}
+	if len(rest) > 2 {
+		p.method = rest[2]
+	}
+	return p, nil
+}
+
+var pathRE = regexp.MustCompile(`^/compute/(v1|beta|alpha)/projects/(.+)$`)
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, Request{Method: req.Method, Path: req.URL.Path, Query: req.URL.Query(), Body: body})
+
+	m := pathRE.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		writeError(w, http.StatusNotFound, "notFound", fmt.Sprintf("unknown path %s", req.URL.Path))
+		return
+	}
+	base := fmt.Sprintf("%s/compute/%s/projects/", s.server.URL, m[1])
+	p, err := parsePath(m[2])
+	if err != nil {
+		writeError(w, http.StatusNotFound, "notFound", err.Error())
+		return
+	}
+
+	f := s.fault(req)
+	if f != nil && (!f.Operation || req.Method == http.MethodGet) {
+		writeError(w, f.Code, f.Reason, f.Message)
+		return
+	}
+
+	var resp interface{}
+	var code int
+	switch {
+	case p.collection == "operations" && p.name != "" && (req.Method == http.MethodGet || p.method == "wait"):
+		resp, code = s.getOperation(p)
+	case p.aggregated && req.Method == http.MethodGet:
+		resp, code = s.aggregatedList(p, req.URL.Query())
+	case f != nil:
+		// The mutation is accepted but not applied, its operation fails.
+		op := s.operation(p, strings.ToLower(req.Method))
+		key := p.project + "/" + p.scope + "/operations/" + op["name"].(string)
+		delete(s.polls, key)
+		stored := s.resources[key]
+		stored["status"] = "DONE"
+		stored["httpErrorStatusCode"] = f.Code
+		stored["httpErrorMessage"] = f.Message
+		stored["error"] = map[string]interface{}{
+			"errors": []interface{}{map[string]interface{}{"code": f.Reason, "message": f.Message}},
+		}
+		resp, code = copyMap(stored), http.StatusOK
+	case p.name == "" && req.Method == http.MethodGet:
+		resp, code = s.list(p, req.URL.Query())
+	case p.name == "" && req.Method == http.MethodPost:
+		resp, code = s.insert(p, body)
+	case p.method == "" && req.Method == http.MethodGet:
+		resp, code = s.get(p)
+	default:
+		resp, code = s.mutate(p, req.Method, body, req.URL.Query())
+	}
+	writeJSON(w, code, withLinks(resp, base))
+}
+
+// fault returns the first fault matching the request, and counts it.
+func (s *Server) fault(req *http.Request) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != req.Method {
+			continue
+		}
+		if f.Path != "" {
+			if matched, _ := regexp.MatchString(f.Path, req.URL.Path); !matched {
+				continue
+			}
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) get(p *resourcePath) (interface{}, int) {
+	r, ok := s.resources[p.key()]
+	if !ok {
+		return notFound(p), http.StatusNotFound
+	}
+	return r, http.StatusOK
+}
+
+func (s *Server) list(p *resourcePath, query map[string][]string) (interface{}, int) {
+	items, err := s.collectionItems(p.collectionKey()+"/", query)
+	if err != nil {
+		return errorBody(http.StatusBadRequest, "invalid", err.Error()), http.StatusBadRequest
+	}
+	return paginate(items, query), http.StatusOK
+}
+
+func (s *Server) aggregatedList(p *resourcePath, query map[string][]string) (interface{}, int) {
+	scopes := map[string]bool{}
+	prefix := p.project + "/"
+	for key := range s.resources {
+		if rp, err := parsePath(key); err == nil && strings.HasPrefix(key, prefix) && rp.collection == p.collection {
+			scopes[rp.scope] = true
+		}
+	}
+	items := map[string]interface{}{}
+	for scope := range scopes {
+		scoped, err := s.collectionItems(prefix+scope+"/"+p.collection+"/", query)
+		if err != nil {
+			return errorBody(http.StatusBadRequest, "invalid", err.Error()), http.StatusBadRequest
+		}
+		if len(scoped) > 0 {
+			items[scope] = map[string]interface{}{p.collection: scoped}
+		}
+	}
+	return map[string]interface{}{"items": items}, http.StatusOK
+}
+
+// collectionItems returns the resources under prefix matching the filter of
+// the query, ordered by name.
+func (s *Server) collectionItems(prefix string, query map[string][]string) ([]interface{}, error) {
+	match, err := parseFilter(first(query["filter"]))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key := range s.resources {
+		if strings.HasPrefix(key, prefix) && !strings.Contains(key[len(prefix):], "/") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	items := []interface{}{}
+	for _, key := range keys {
+		if match(s.resources[key]) {
+			items = append(items, s.resources[key])
+		}
+	}
+	return items, nil
+}
+
+func (s *Server) insert(p *resourcePath, body []byte) (interface{}, int) {
+	r := map[string]interface{}{}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return errorBody(http.StatusBadRequest, "invalid", err.Error()), http.StatusBadRequest
+	}
+	name, _ := r["name"].(string)
+	if name == "" {
+		return errorBody(http.StatusBadRequest, "required", "Required field 'resource.name' not specified"), http.StatusBadRequest
+	}
+	p.name = name
+	if _, ok := s.resources[p.key()]; ok {
+		msg := fmt.Sprintf("The resource 'projects/%s' already exists", p.key())
+		return errorBody(http.StatusConflict, "alreadyExists", msg), http.StatusConflict
+	}
+	if limit, ok := s.quotas[p.collection]; ok && s.count(p.collection) >= limit {
+		msg := fmt.Sprintf("Quota '%s' exceeded. Limit: %d.0", strings.ToUpper(p.collection), limit)
+		return errorBody(http.StatusForbidden, "quotaExceeded", msg), http.StatusForbidden
+	}
+	s.initResource(p, r)
+	s.resources[p.key()] = r
+	return s.operation(p, "insert"), http.StatusOK
+}
+
+func (s *Server) mutate(p *resourcePath, method string, body []byte, query map[string][]string) (interface{}, int) {
+	r, ok := s.resources[p.key()]
+	if !ok {
+		return notFound(p), http.StatusNotFound
+	}
+	var patch map[string]interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return errorBody(http.StatusBadRequest, "invalid", err.Error()), http.StatusBadRequest
+		}
+	}
+	opType := p.method
+	switch {
+	case method == http.MethodDelete && p.method == "":
+		delete(s.resources, p.key())
+		opType = "delete"
+	case method == http.MethodPatch && p.method == "":
+		for k, v := range patch {
+			r[k] = v
+		}
+		opType = "patch"
+	case method == http.MethodPut && p.method == "":
+		for _, k := range []string{"id", "creationTimestamp", "selfLink", "zone", "region"} {
+			if v, ok := r[k]; ok {
+				patch[k] = v
+			}
+		}
+		s.resources[p.key()] = patch
+		opType = "update"
+	case (method == http.MethodPost || method == http.MethodPatch) && p.method != "":
+		if err := s.applyMethod(p, r, patch, query); err != nil {
+			return errorBody(http.StatusBadRequest, "invalid", err.Error()), http.StatusBadRequest
+		}
+	default:
+		msg := fmt.Sprintf("%s %s is not implemented by the fake server", method, p.key())
+		return errorBody(http.StatusNotImplemented, "notImplemented", msg), http.StatusNotImplemented
+	}
+	return s.operation(p, opType), http.StatusOK
+}
+
+// applyMethod applies the custom method of the path to the resource r: the
+// registered one, or else a generic setFoo, addFoo or removeFoo.
+func (s *Server) applyMethod(p *resourcePath, r, body map[string]interface{}, query map[string][]string) error {
+	if fn, ok := s.methods[p.collection+"/"+p.method]; ok {
+		return fn(r, body, query)
+	}
+	switch {
+	case strings.HasPrefix(p.method, "set") && len(p.method) > 3:
+		field := lowerFirst(p.method[3:])
+		if _, ok := body[field]; !ok {
+			// e.g. setTags and setMetadata, whose body is the field.
+			r[field] = body
+			return nil
+		}
+		for k, v := range body {
+			r[k] = v
+		}
+		return nil
+	case strings.HasPrefix(p.method, "add") || strings.HasPrefix(p.method, "remove"):
+		// e.g. addInstance of a target pool, whose body is
+		// {"instances": [{"instance": URL}]} and whose field is
+		// {"instances": [URL]}.
+		for field, v := range body {
+			refs, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			current, _ := r[field].([]interface{})
+			for _, ref := range refs {
+				url := ref
+				if m, ok := ref.(map[string]interface{}); ok && len(m) == 1 {
+					for _, u := range m {
+						url = u
+					}
+				}
+				if strings.HasPrefix(p.method, "add") {
+					current = append(current, url)
+					continue
+				}
+				for i := range current {
+					if current[i] == url {
+						current = append(current[:i], current[i+1:]...)
+						break
+					}
+				}
+			}
+			r[field] = current
+		}
+		return nil
+	}
+	return fmt.Errorf("method %s of %s is not implemented by the fake server", p.method, p.collection)
+}
+
+// updateNetworkInterface replaces the fields of the network interface of an
+// instance named by the networkInterface query parameter with the ones of
+// the body.
+func updateNetworkInterface(r, body map[string]interface{}, query map[string][]string) error {
+	name := first(query["networkInterface"])
+	nics, _ := r["networkInterfaces"].([]interface{})
+	for _, nic := range nics {
+		if m, ok := nic.(map[string]interface{}); ok && m["name"] == name {
+			for k, v := range body {
+				m[k] = v
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("network interface %q not found", name)
+}
+
+// count returns the number of resources of the collection.
+func (s *Server) count(collection string) int {
+	n := 0
+	for key := range s.resources {
+		if p, err := parsePath(key); err == nil && p.collection == collection && p.name != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// initResource sets the output only fields of a new resource.
+func (s *Server) initResource(p *resourcePath, r map[string]interface{}) {
+	s.nextID++
+	r["name"] = p.name
+	r["id"] = strconv.FormatUint(s.nextID, 10)
+	r["creationTimestamp"] = time.Now().Format(time.RFC3339)
+	r["selfLink"] = p.key()
+	switch {
+	case strings.HasPrefix(p.scope, "zones/"):
+		r["zone"] = p.project + "/" + p.scope
+	case strings.HasPrefix(p.scope, "regions/"):
+		r["region"] = p.project + "/" + p.scope
+	}
+}
+
+// operation stores and returns the operation of a mutation of the resource
+// of the path.
+func (s *Server) operation(p *resourcePath, opType string) map[string]interface{} {
+	s.nextID++
+	name := fmt.Sprintf("operation-%d", s.nextID)
+	status := "DONE"
+	key := p.project + "/" + p.scope + "/operations/" + name
+	if s.OperationPolls > 0 {
+		status = "RUNNING"
+		s.polls[key] = s.OperationPolls
+	}
+	op := map[string]interface{}{
+		"kind":          "compute#operation",
+		"name":          name,
+		"id":            strconv.FormatUint(s.nextID, 10),
+		"operationType": opType,
+		"status":        status,
+		"targetLink":    p.key(),
+		"selfLink":      key,
+	}
+	switch {
+	case strings.HasPrefix(p.scope, "zones/"):
+		op["zone"] = p.project + "/" + p.scope
+	case strings.HasPrefix(p.scope, "regions/"):
+		op["region"] = p.project + "/" + p.scope
+	}
+	s.resources[key] = op
+	return copyMap(op)
+}
+
+// getOperation returns the operation of the path, counting down its polls.
+func (s *Server) getOperation(p *resourcePath) (interface{}, int) {
+	key := p.key()
+	op, ok := s.resources[key]
+	if !ok {
+		return notFound(p), http.StatusNotFound
+	}
+	if n, ok := s.polls[key]; ok {
+		if n--; n > 0 {
+			s.polls[key] = n
+		} else {
+			delete(s.polls, key)
+			op["status"] = "DONE"
+		}
+	}
+	return copyMap(op), http.StatusOK
+}
+
+// linkFields are the fields of the resources holding paths relative to the
+// projects, which are served as URLs of the API version of the request.
+var linkFields = []string{"selfLink", "zone", "region", "targetLink"}
+
+// withLinks returns a copy of the resource, list or operation v with the
+// links made URLs under base.
+func withLinks(v interface{}, base string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = withLinks(val, base)
+		}
+		for _, k := range linkFields {
+			if s, ok := v[k].(string); ok && s != "" && !strings.Contains(s, "://") {
+				out[k] = base + s
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = withLinks(v[i], base)
+		}
+		return out
+	}
+	return v
+}
+
+// filterExpressionRegexp matches the parenthesized expressions of a filter
+// of several expressions.
+var filterExpressionRegexp = regexp.MustCompile(`\(([^()]*)\)`)
+
+// parseFilter returns the matcher of a filter of "FIELD eq|ne REGEXP"
+// expressions, as used by providers/gce: a single one, or several ones in
+// parentheses which must all match, or of no filter. The regular expressions
+// of the expressions of a filter of several ones must not hold parentheses.
+func parseFilter(filter string) (func(map[string]interface{}) bool, error) {
+	if filter == "" {
+		return func(map[string]interface{}) bool { return true }, nil
+	}
+	expressions := []string{filter}
+	if strings.HasPrefix(filter, "(") {
+		expressions = nil
+		for _, m := range filterExpressionRegexp.FindAllStringSubmatch(filter, -1) {
+			expressions = append(expressions, m[1])
+		}
+		if strings.TrimSpace(filterExpressionRegexp.ReplaceAllString(filter, "")) != "" {
+			return nil, fmt.Errorf("unsupported filter %q", filter)
+		}
+	}
+	var matchers []func(map[string]interface{}) bool
+	for _, expression := range expressions {
+		fields := strings.Fields(expression)
+		if len(fields) != 3 || (fields[1] != "eq" && fields[1] != "ne") {
+			return nil, fmt.Errorf("unsupported filter %q", filter)
+		}
+		re, err := regexp.Compile("^(?:" + fields[2] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+		}
+		matchers = append(matchers, func(r map[string]interface{}) bool {
+			v, _ := r[fields[0]].(string)
+			return re.MatchString(v) == (fields[1] == "eq")
+		})
+	}
+	return func(r map[string]interface{}) bool {
+		for _, match := range matchers {
+			if !match(r) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// paginate returns the page of the items of the pageToken and maxResults of
+// the query.
+func paginate(items []interface{}, query map[string][]string) map[string]interface{} {
+	start, _ := strconv.Atoi(first(query["pageToken"]))
+	if start > len(items) {
+		start = len(items)
+	}
+	page := map[string]interface{}{}
+	end := len(items)
+	if max, _ := strconv.Atoi(first(query["maxResults"])); max > 0 && start+max < end {
+		end = start + max
+		page["nextPageToken"] = strconv.Itoa(end)
+	}
+	page["items"] = items[start:end]
+	return page
+}
+
+func notFound(p *resourcePath) map[string]interface{} {
+	return errorBody(http.StatusNotFound, "notFound", fmt.Sprintf("The resource 'projects/%s' was not found", p.key()))
+}
+
+// errorBody returns the body of an error of the compute API.
+func errorBody(code int, reason, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors":  []interface{}{map[string]interface{}{"reason": reason, "message": message, "domain": "global"}},
+		},
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	writeJSON(w, code, errorBody(code, reason, message))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func toMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	return m, json.Unmarshal(data, &m)
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	cloudtesting "k8s.io/cloud-provider-gcp/pkg/cloud/testing"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+)
+
+func newCloud(t *testing.T) (*cloudtesting.Server, *gce.Cloud, gce.TestClusterValues) {
+	t.Helper()
+	server := cloudtesting.NewServer()
+	t.Cleanup(server.Close)
+	vals := gce.DefaultTestClusterValues()
+	g, err := gce.NewFakeGCECloudWithEndpoint(vals, server.URL())
+	if err != nil {
+		t.Fatalf("NewFakeGCECloudWithEndpoint() = %v", err)
+	}
+	return server, g, vals
+}
+
+func TestInstances(t *testing.T) {
+	server, g, vals := newCloud(t)
+	server.OperationPolls = 2
+	ctx := context.Background()
+	key := meta.ZonalKey("node-1", vals.ZoneName)
+	if err := g.Compute().Instances().Insert(ctx, key, &compute.Instance{
+		Name:              "node-1",
+		NetworkInterfaces: []*compute.NetworkInterface{{Name: "nic0", Fingerprint: "fp"}},
+	}); err != nil {
+		t.Fatalf("Insert() = %v", err)
+	}
+	if err := g.Compute().Instances().Insert(ctx, key, &compute.Instance{Name: "node-1"}); !isHTTPError(err, http.StatusConflict) {
+		t.Errorf("Insert() of an existing instance = %v, want a %d error", err, http.StatusConflict)
+	}
+
+	// The alias IP range is added with the beta API and its operation polled
+	// until done.
+	providerID := fmt.Sprintf("gce://%s/%s/node-1", vals.ProjectID, vals.ZoneName)
+	_, alias, _ := net.ParseCIDR("10.0.0.0/24")
+	if err := g.AddAliasFromRangeToInstanceByProviderID(providerID, alias, "pods"); err != nil {
+		t.Fatalf("AddAliasFromRangeToInstanceByProviderID() = %v", err)
+	}
+	instance, err := g.InstanceByProviderID(providerID)
+	if err != nil {
+		t.Fatalf("InstanceByProviderID() = %v", err)
+	}
+	want := []*compute.AliasIpRange{{IpCidrRange: "10.0.0.0/24", SubnetworkRangeName: "pods"}}
+	if got := instance.NetworkInterfaces[0].AliasIpRanges; !reflect.DeepEqual(got, want) {
+		t.Errorf("got alias IP ranges %v, want %v", got, want)
+	}
+	if instance.Zone != fmt.Sprintf("%s/compute/v1/projects/%s/zones/%s", server.URL(), vals.ProjectID, vals.ZoneName) {
+		t.Errorf("got zone %q, want the URL of the zone", instance.Zone)
+	}
+	polls := 0
+	for _, r := range server.Requests() {
+		if strings.HasPrefix(r.Path, fmt.Sprintf("/compute/beta/projects/%s/zones/%s/operations/", vals.ProjectID, vals.ZoneName)) {
+			polls++
+		}
+	}
+	if polls != 2 {
+		t.Errorf("got %d polls of the operation, want 2", polls)
+	}
+
+	instances, err := g.ListInstanceNetworkInterfaces(ctx)
+	if err != nil {
+		t.Fatalf("ListInstanceNetworkInterfaces() = %v", err)
+	}
+	if len(instances) != 1 || instances[providerID] == nil {
+		t.Errorf("ListInstanceNetworkInterfaces() = %v, want %s", instances, providerID)
+	}
+
+	if err := g.Compute().Instances().Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, err := g.Compute().Instances().Get(ctx, key); !isHTTPError(err, http.StatusNotFound) {
+		t.Errorf("Get() of a deleted instance = %v, want a %d error", err, http.StatusNotFound)
+	}
+}
+
+func TestGetAllZonesFromCloudProvider(t *testing.T) {
+	server := cloudtesting.NewServer()
+	t.Cleanup(server.Close)
+	vals := gce.DefaultTestClusterValues()
+	vals.ManagedZones = []string{vals.ZoneName, vals.SecondaryZoneName}
+	g, err := gce.NewFakeGCECloudWithEndpoint(vals, server.URL())
+	if err != nil {
+		t.Fatalf("NewFakeGCECloudWithEndpoint() = %v", err)
+	}
+	ctx := context.Background()
+	for _, zone := range []string{vals.ZoneName, "us-central1-f"} {
+		if err := g.Compute().Instances().Insert(ctx, meta.ZonalKey("node-1", zone), &compute.Instance{Name: "node-1"}); err != nil {
+			t.Fatalf("Insert() = %v", err)
+		}
+	}
+
+	// The instances of the zones which are not managed are left out.
+	zones, err := g.GetAllZonesFromCloudProvider()
+	if err != nil {
+		t.Fatalf("GetAllZonesFromCloudProvider() = %v", err)
+	}
+	if want := []string{vals.ZoneName}; !reflect.DeepEqual(zones.List(), want) {
+		t.Errorf("GetAllZonesFromCloudProvider() = %v, want %v", zones.List(), want)
+	}
+	// They are not even listed.
+	var lists int
+	for _, r := range server.Requests() {
+		if r.Path != fmt.Sprintf("/compute/v1/projects/%s/aggregated/instances", vals.ProjectID) {
+			continue
+		}
+		lists++
+		if got, want := first(r.Query["filter"]), fmt.Sprintf("zone eq .*/zones/%s|.*/zones/%s", vals.ZoneName, vals.SecondaryZoneName); got != want {
+			t.Errorf("got filter %q, want %q", got, want)
+		}
+	}
+	if lists != 1 {
+		t.Errorf("got %d aggregated lists of the instances, want 1", lists)
+	}
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func TestTargetPoolMethods(t *testing.T) {
+	server, g, vals := newCloud(t)
+	if err := g.CreateTargetPool(&compute.TargetPool{Name: "tp"}, vals.Region); err != nil {
+		t.Fatalf("CreateTargetPool() = %v", err)
+	}
+	refs := []*compute.InstanceReference{{Instance: "zones/z/instances/n1"}, {Instance: "zones/z/instances/n2"}}
+	if err := g.AddInstancesToTargetPool("tp", vals.Region, refs); err != nil {
+		t.Fatalf("AddInstancesToTargetPool() = %v", err)
+	}
+	if err := g.RemoveInstancesFromTargetPool("tp", vals.Region, refs[:1]); err != nil {
+		t.Fatalf("RemoveInstancesFromTargetPool() = %v", err)
+	}
+	var tp compute.TargetPool
+	if ok, err := server.Get(fmt.Sprintf("%s/regions/%s/targetPools/tp", vals.ProjectID, vals.Region), &tp); !ok || err != nil {
+		t.Fatalf("Get() = %t, %v", ok, err)
+	}
+	if want := []string{"zones/z/instances/n2"}; !reflect.DeepEqual(tp.Instances, want) {
+		t.Errorf("got instances %v, want %v", tp.Instances, want)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	server, g, vals := newCloud(t)
+	server.SetQuota("addresses", 1)
+	if err := g.ReserveRegionAddress(&compute.Address{Name: "a1"}, vals.Region); err != nil {
+		t.Fatalf("ReserveRegionAddress() = %v", err)
+	}
+	if err := g.ReserveRegionAddress(&compute.Address{Name: "a2"}, vals.Region); !isHTTPError(err, http.StatusForbidden) {
+		t.Errorf("ReserveRegionAddress() beyond the quota = %v, want a %d error", err, http.StatusForbidden)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	server, g, vals := newCloud(t)
+	if err := server.Put(fmt.Sprintf("%s/regions/%s/addresses/a1", vals.ProjectID, vals.Region), &compute.Address{Address: "1.2.3.4"}); err != nil {
+		t.Fatalf("Put() = %v", err)
+	}
+
+	server.AddFault(cloudtesting.Fault{Method: http.MethodGet, Path: "/addresses/a1$", Code: http.StatusServiceUnavailable, Times: 1})
+	if _, err := g.GetRegionAddress("a1", vals.Region); !isHTTPError(err, http.StatusServiceUnavailable) {
+		t.Errorf("GetRegionAddress() = %v, want a %d error", err, http.StatusServiceUnavailable)
+	}
+	addr, err := g.GetRegionAddress("a1", vals.Region)
+	if err != nil || addr.Address != "1.2.3.4" {
+		t.Errorf("GetRegionAddress() once the fault is exhausted = %v, %v, want 1.2.3.4", addr, err)
+	}
+
+	// The delete is accepted but its operation fails, so the address stays.
+	server.AddFault(cloudtesting.Fault{Method: http.MethodDelete, Code: http.StatusBadRequest, Reason: "resourceInUseByAnotherResource", Message: "in use", Operation: true})
+	if err := g.DeleteRegionAddress("a1", vals.Region); err == nil {
+		t.Errorf("DeleteRegionAddress() of a failing operation = nil, want error")
+	}
+	if _, err := g.GetRegionAddress("a1", vals.Region); err != nil {
+		t.Errorf("GetRegionAddress() after a failed delete = %v", err)
+	}
+}
+
+func isHTTPError(err error, code int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == code
+}
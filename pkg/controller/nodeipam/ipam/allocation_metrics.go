@@ -0,0 +1,152 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	nodeutil "k8s.io/cloud-provider-gcp/pkg/util"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	netutils "k8s.io/utils/net"
+)
+
+// podRangeUsagePeriod is how often the usage of the pod ranges is reported.
+// This is a variable instead of a const to enable testing.
+var podRangeUsagePeriod = time.Minute
+
+var (
+	podRangeCapacity = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "pod_range_capacity_addresses",
+			Help:           "Gauge measuring the number of addresses of the pod range, i.e. the secondary range of the subnet with the cloud allocator or the cluster CIDR with the range allocator.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"range"},
+	)
+	podRangeAllocated = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "pod_range_allocated_addresses",
+			Help:           "Gauge measuring the number of addresses of the pod range allocated to nodes.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"range"},
+	)
+	podRangeFree = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "pod_range_free_addresses",
+			Help:           "Gauge measuring the number of addresses of the pod range which are not allocated to nodes.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"range"},
+	)
+	cidrAllocationDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "cidr_allocation_duration_seconds",
+			Help:           "Histogram measuring the time taken to set the pod CIDRs of a node, from its allocation with the range allocator or from the lookup of its instance with the cloud allocator.",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.ExponentialBuckets(0.01, 2, 12),
+		},
+		[]string{"allocator"},
+	)
+	cidrAllocationFailures = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "cidr_allocation_failures_total",
+			Help:           "Counter measuring the total number of failed pod CIDR allocations of nodes, by the reason of the event recorded on the node.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"allocator", "reason"},
+	)
+)
+
+var registerAllocationMetricsOnce sync.Once
+
+// registerAllocationMetrics registers the allocation metrics shared by the
+// CIDR allocators.
+func registerAllocationMetrics() {
+	registerAllocationMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(podRangeCapacity)
+		legacyregistry.MustRegister(podRangeAllocated)
+		legacyregistry.MustRegister(podRangeFree)
+		legacyregistry.MustRegister(cidrAllocationDuration)
+		legacyregistry.MustRegister(cidrAllocationFailures)
+	})
+}
+
+// setPodRangeUsage sets the usage metrics of the pod range.
+func setPodRangeUsage(rangeName string, capacity, allocated float64) {
+	podRangeCapacity.WithLabelValues(rangeName).Set(capacity)
+	podRangeAllocated.WithLabelValues(rangeName).Set(allocated)
+	podRangeFree.WithLabelValues(rangeName).Set(math.Max(capacity-allocated, 0))
+}
+
+// observeAllocation records the duration of a successful pod CIDR allocation
+// started at start.
+func observeAllocation(allocatorType CIDRAllocatorType, start time.Time) {
+	cidrAllocationDuration.WithLabelValues(string(allocatorType)).Observe(time.Since(start).Seconds())
+}
+
+// recordAllocationFailure records an event of the reason on the node and
+// counts the failed allocation.
+func recordAllocationFailure(recorder record.EventRecorder, node *v1.Node, allocatorType CIDRAllocatorType, reason string) {
+	nodeutil.RecordNodeStatusChange(recorder, node, reason)
+	cidrAllocationFailures.WithLabelValues(string(allocatorType), reason).Inc()
+}
+
+// podRangeUsage returns the number of addresses of each secondary range of
+// the subnet, by name, and of the pod CIDRs of the nodes in it.
+func podRangeUsage(subnet *compute.Subnetwork, nodes []*v1.Node) (capacity, allocated map[string]float64) {
+	capacity = make(map[string]float64)
+	allocated = make(map[string]float64)
+	var podCIDRs []string
+	for _, node := range nodes {
+		podCIDRs = append(podCIDRs, node.Spec.PodCIDRs...)
+	}
+	for _, r := range subnet.SecondaryIpRanges {
+		_, rangeCIDR, err := netutils.ParseCIDRSloppy(r.IpCidrRange)
+		if err != nil {
+			continue
+		}
+		capacity[r.RangeName] = cidrAddresses(rangeCIDR)
+		allocated[r.RangeName] = 0
+		for _, cidr := range podCIDRs {
+			_, podCIDR, err := netutils.ParseCIDRSloppy(cidr)
+			if err != nil || !rangeCIDR.Contains(podCIDR.IP) {
+				continue
+			}
+			allocated[r.RangeName] += cidrAddresses(podCIDR)
+		}
+	}
+	return capacity, allocated
+}
+
+// cidrAddresses returns the number of addresses of the CIDR.
+func cidrAddresses(cidr *net.IPNet) float64 {
+	ones, bits := cidr.Mask.Size()
+	return math.Ldexp(1, bits-ones)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"reflect"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/cloud-provider-gcp/pkg/controller/testutil"
+	metricsutil "k8s.io/component-base/metrics/testutil"
+	netutils "k8s.io/utils/net"
+)
+
+func TestPodRangeUsage(t *testing.T) {
+	subnet := &compute.Subnetwork{
+		SecondaryIpRanges: []*compute.SubnetworkSecondaryRange{
+			{RangeName: "pods-0", IpCidrRange: "10.0.0.0/20"},
+			{RangeName: "pods-1", IpCidrRange: "10.1.0.0/22"},
+			{RangeName: "invalid", IpCidrRange: "10.2.0.0"},
+		},
+	}
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node0"}, Spec: v1.NodeSpec{PodCIDRs: []string{"10.0.0.0/24", "2001:db8::/112"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: v1.NodeSpec{PodCIDRs: []string{"10.0.1.0/25"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: v1.NodeSpec{PodCIDRs: []string{"10.3.0.0/24"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node3"}},
+	}
+	capacity, allocated := podRangeUsage(subnet, nodes)
+	if want := map[string]float64{"pods-0": 4096, "pods-1": 1024}; !reflect.DeepEqual(capacity, want) {
+		t.Errorf("got capacity %v, want %v", capacity, want)
+	}
+	if want := map[string]float64{"pods-0": 384, "pods-1": 0}; !reflect.DeepEqual(allocated, want) {
+		t.Errorf("got allocated %v, want %v", allocated, want)
+	}
+}
+
+func TestRangeAllocatorReportPodRangeUsage(t *testing.T) {
+	fakeNodeHandler := &testutil.FakeNodeHandler{Clientset: fake.NewSimpleClientset()}
+	clusterCIDRs, _ := netutils.ParseCIDRs([]string{"10.20.0.0/22"})
+	allocator, err := NewCIDRRangeAllocator(fakeNodeHandler, getFakeNodeInformer(fakeNodeHandler), CIDRAllocatorParams{
+		ClusterCIDRs:      clusterCIDRs,
+		NodeCIDRMaskSizes: []int{24},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewCIDRRangeAllocator() = %v", err)
+	}
+	r := allocator.(*rangeAllocator)
+	if _, err := r.cidrSets[0].AllocateNext(); err != nil {
+		t.Fatalf("AllocateNext() = %v", err)
+	}
+	r.reportPodRangeUsage()
+
+	label := clusterCIDRs[0].String()
+	if got, _ := metricsutil.GetGaugeMetricValue(podRangeCapacity.WithLabelValues(label)); got != 1024 {
+		t.Errorf("got capacity %v, want 1024", got)
+	}
+	if got, _ := metricsutil.GetGaugeMetricValue(podRangeAllocated.WithLabelValues(label)); got != 256 {
+		t.Errorf("got allocated %v, want 256", got)
+	}
+	if got, _ := metricsutil.GetGaugeMetricValue(podRangeFree.WithLabelValues(label)); got != 768 {
+		t.Errorf("got free %v, want 768", got)
+	}
+}
+
+func TestRecordAllocationFailure(t *testing.T) {
+	registerAllocationMetrics()
+	cidrAllocationFailures.Reset()
+	recorder := testutil.NewFakeRecorder()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node0"}}
+
+	recordAllocationFailure(recorder, node, CloudAllocatorType, "CIDRNotAvailable")
+	recordAllocationFailure(recorder, node, CloudAllocatorType, "CIDRNotAvailable")
+	recordAllocationFailure(recorder, node, RangeAllocatorType, "CIDRAssignmentFailed")
+
+	if got, _ := metricsutil.GetCounterMetricValue(cidrAllocationFailures.WithLabelValues(string(CloudAllocatorType), "CIDRNotAvailable")); got != 2 {
+		t.Errorf("got %v CIDRNotAvailable failures of the cloud allocator, want 2", got)
+	}
+	if got, _ := metricsutil.GetCounterMetricValue(cidrAllocationFailures.WithLabelValues(string(RangeAllocatorType), "CIDRAssignmentFailed")); got != 1 {
+		t.Errorf("got %v CIDRAssignmentFailed failures of the range allocator, want 1", got)
+	}
+	if len(recorder.Events) != 3 {
+		t.Errorf("got %d events, want 3", len(recorder.Events))
+	}
+}
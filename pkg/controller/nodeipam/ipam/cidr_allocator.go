@@ -45,6 +45,10 @@ const (
 	// CloudAllocatorType is the allocator that uses cloud platform
 	// support to do node CIDR range allocations.
 	CloudAllocatorType CIDRAllocatorType = "CloudAllocator"
+	// ExternalAllocatorType is the allocator that delegates node CIDR range
+	// allocations to an external IPAM service and enforces them onto the
+	// alias IP ranges of the instances.
+	ExternalAllocatorType CIDRAllocatorType = "ExternalAllocator"
 	// IPAMFromClusterAllocatorType uses the ipam controller sync'ing the node
 	// CIDR range allocations from the cluster to the cloud.
 	IPAMFromClusterAllocatorType = "IPAMFromCluster"
@@ -105,6 +109,49 @@ type CIDRAllocatorParams struct {
 	SecondaryServiceCIDR *net.IPNet
 	// NodeCIDRMaskSizes is list of node cidr mask sizes
 	NodeCIDRMaskSizes []int
+	// AdditionalClusterCIDRs are the blocks the range allocator allocates
+	// node CIDRs from once the cluster CIDR of their IP family is exhausted.
+	AdditionalClusterCIDRs []ClusterCIDRBlock
+	// IPv6Only allocates only IPv6 pod CIDRs, for single-stack IPv6 VPCs:
+	// the cloud allocator ignores the alias IP ranges of the nodes and the
+	// range allocator only accepts IPv6 cluster CIDRs.
+	IPv6Only bool
+	// PodRangeExpansion adds alias IP ranges to the IPv4 pod CIDRs of the
+	// nodes whose max pods exceed them with the cloud allocator, recorded in
+	// the AdditionalPodCIDRsAnnotationKey annotation of the nodes.
+	PodRangeExpansion bool
+	// PodRangePreallocationMaskSize is the mask size of the alias IP ranges
+	// the cloud allocator adds to the instances lacking one as soon as they
+	// are listed, before their nodes register, disabled if 0.
+	PodRangePreallocationMaskSize int
+	// NodeCIDRMaskSizeOverrides override NodeCIDRMaskSizes for the nodes
+	// matching them with the range allocator.
+	NodeCIDRMaskSizeOverrides []NodeCIDRMaskSizeOverride
+	// PodRangeSelection pins the secondary ranges of the node pod CIDRs
+	// allocated by the cloud allocator.
+	PodRangeSelection PodRangeSelection
+	// ExternalIPAMURL is the URL of the external IPAM service the external
+	// allocator sends its ExternalIPAMRequests to: posted as JSON for http
+	// and https URLs, or to the ExternalIPAMGRPCService for grpc and grpcs
+	// URLs.
+	ExternalIPAMURL string
+	// ExternalIPAMTimeout bounds the requests to the external IPAM service,
+	// 10s if 0.
+	ExternalIPAMTimeout time.Duration
+	// ExternalIPAMCAFile is the CA verifying the https and grpcs external
+	// IPAM services, the system roots if empty.
+	ExternalIPAMCAFile string
+	// ExternalIPAMClientCertFile and ExternalIPAMClientKeyFile are the
+	// client certificate authenticating to the https and grpcs external
+	// IPAM services, if set.
+	ExternalIPAMClientCertFile string
+	ExternalIPAMClientKeyFile  string
+	// ExternalIPAMTokenFile holds the bearer token authenticating to the
+	// external IPAM service, if set.
+	ExternalIPAMTokenFile string
+	// LeakReconcilePeriod is how often the leaked node CIDRs are released
+	// and the double allocated ones flagged, never if 0.
+	LeakReconcilePeriod time.Duration
 }
 
 // New creates a new CIDR range allocator.
@@ -119,6 +166,8 @@ func New(kubeClient clientset.Interface, cloud cloudprovider.Interface, nodeInfo
 		return NewCIDRRangeAllocator(kubeClient, nodeInformer, allocatorParams, nodeList)
 	case CloudAllocatorType:
 		return NewCloudCIDRAllocator(kubeClient, cloud, nwInformer, gnpInformer, nodeInformer, allocatorParams)
+	case ExternalAllocatorType:
+		return NewExternalCIDRAllocator(kubeClient, cloud, nodeInformer, allocatorParams)
 	default:
 		return nil, fmt.Errorf("invalid CIDR allocator type: %v", allocatorType)
 	}
@@ -0,0 +1,191 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"net"
+	"sort"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	nodeutil "k8s.io/cloud-provider-gcp/pkg/util"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+var (
+	leakedCIDRs = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "leaked_cidrs",
+			Help:           "Gauge measuring the number of node CIDRs of the cluster CIDR which are allocated but held by no Node, as of the last leak reconciliation.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"clusterCIDR"},
+	)
+	reclaimedCIDRs = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "reclaimed_cidrs_total",
+			Help:           "Counter measuring the total number of leaked node CIDRs of the cluster CIDR released by the leak reconciliation.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"clusterCIDR"},
+	)
+	doubleAllocatedCIDRs = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "double_allocated_cidrs",
+			Help:           "Gauge measuring the number of pod CIDRs held by more than one Node, as of the last leak reconciliation.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+)
+
+var registerLeakMetrics sync.Once
+
+// registerCIDRLeakMetrics registers the metrics of the leak reconciliation.
+func registerCIDRLeakMetrics() {
+	registerLeakMetrics.Do(func() {
+		legacyregistry.MustRegister(leakedCIDRs)
+		legacyregistry.MustRegister(reclaimedCIDRs)
+		legacyregistry.MustRegister(doubleAllocatedCIDRs)
+	})
+}
+
+// doubleAllocatedPodCIDRs returns the names of the nodes holding each of the
+// pod CIDRs held by more than one of them.
+func doubleAllocatedPodCIDRs(nodes []*v1.Node) map[string][]string {
+	holders := make(map[string][]string)
+	for _, node := range nodes {
+		for _, cidr := range node.Spec.PodCIDRs {
+			holders[cidr] = append(holders[cidr], node.Name)
+		}
+	}
+	for cidr, names := range holders {
+		if len(names) < 2 {
+			delete(holders, cidr)
+			continue
+		}
+		sort.Strings(names)
+	}
+	return holders
+}
+
+// reportDoubleAllocations flags the pod CIDRs held by more than one of the
+// nodes, with an error log and a CIDRDoubleAllocated event on each of their
+// nodes. The nodes are left as is: their pod CIDRs can't be changed.
+func reportDoubleAllocations(recorder record.EventRecorder, nodes []*v1.Node) {
+	double := doubleAllocatedPodCIDRs(nodes)
+	doubleAllocatedCIDRs.Set(float64(len(double)))
+	if len(double) == 0 {
+		return
+	}
+	byName := make(map[string]*v1.Node, len(nodes))
+	for _, node := range nodes {
+		byName[node.Name] = node
+	}
+	for cidr, names := range double {
+		klog.Errorf("Pod CIDR %s is allocated to several nodes: %v", cidr, names)
+		for _, name := range names {
+			nodeutil.RecordNodeStatusChange(recorder, byName[name], "CIDRDoubleAllocated")
+		}
+	}
+}
+
+// reconcileLeakedCIDRs releases the node CIDRs of the cidrSets held by no
+// Node and not pending assignment, e.g. the ones of Nodes whose update timed
+// out or whose deletion was missed, and flags the pod CIDRs held by more than
+// one Node. A CIDR is only released once it is seen leaked by two
+// reconciliations in a row, so that the Nodes whose assignment just succeeded
+// are seen with it first.
+func (r *rangeAllocator) reconcileLeakedCIDRs() {
+	nodes, err := r.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list nodes for CIDR leak reconciliation: %v", err)
+		return
+	}
+	reportDoubleAllocations(r.recorder, nodes)
+
+	held := sets.NewString()
+	for _, node := range nodes {
+		for _, cidr := range node.Spec.PodCIDRs {
+			if _, podCIDR, err := net.ParseCIDR(cidr); err == nil {
+				held.Insert(podCIDR.String())
+			}
+		}
+	}
+	r.lock.Lock()
+	pending := sets.NewString(r.pendingCIDRs.UnsortedList()...)
+	r.lock.Unlock()
+
+	suspected := sets.NewString()
+	for _, cidrSet := range r.allCIDRSets() {
+		label := cidrSet.ClusterCIDR().String()
+		leaked := 0
+		for _, cidr := range cidrSet.Allocated() {
+			key := cidr.String()
+			if coveredBy(held, cidr) || coveredBy(pending, cidr) || r.isReservedCIDR(cidr) {
+				continue
+			}
+			if !r.suspectedLeaks.Has(key) {
+				suspected.Insert(key)
+				leaked++
+				continue
+			}
+			klog.Warningf("Releasing leaked CIDR %s of cluster CIDR %s, held by no node", key, label)
+			if err := cidrSet.Release(cidr); err != nil {
+				klog.Errorf("Error releasing leaked CIDR %s: %v", key, err)
+				suspected.Insert(key)
+				leaked++
+				continue
+			}
+			reclaimedCIDRs.WithLabelValues(label).Inc()
+		}
+		leakedCIDRs.WithLabelValues(label).Set(float64(leaked))
+	}
+	r.suspectedLeaks = suspected
+}
+
+// coveredBy tells whether the CIDR or one of the CIDRs containing it is in
+// cidrs, e.g. the node CIDRs of a cidrSet are covered by a larger one of a
+// node CIDR mask size override.
+func coveredBy(cidrs sets.String, cidr *net.IPNet) bool {
+	ones, bits := cidr.Mask.Size()
+	for ; ones >= 0; ones-- {
+		mask := net.CIDRMask(ones, bits)
+		if cidrs.Has((&net.IPNet{IP: cidr.IP.Mask(mask), Mask: mask}).String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReservedCIDR tells whether the node CIDR is in the service CIDRs, which
+// are occupied so that they aren't allocated to nodes.
+func (r *rangeAllocator) isReservedCIDR(cidr *net.IPNet) bool {
+	for _, reserved := range r.reservedCIDRs {
+		if reserved.Contains(cidr.IP) || cidr.Contains(reserved.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/cloud-provider-gcp/pkg/controller/testutil"
+	metricsutil "k8s.io/component-base/metrics/testutil"
+	netutils "k8s.io/utils/net"
+)
+
+func TestReconcileLeakedCIDRs(t *testing.T) {
+	fakeNodeHandler := &testutil.FakeNodeHandler{
+		Existing: []*v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+				Spec:       v1.NodeSpec{PodCIDR: "10.10.0.0/24", PodCIDRs: []string{"10.10.0.0/24"}},
+			},
+		},
+		Clientset: fake.NewSimpleClientset(),
+	}
+	clusterCIDR, _ := netutils.ParseCIDRs([]string{"10.10.0.0/16"})
+	_, serviceCIDR, _ := netutils.ParseCIDRSloppy("10.10.255.0/24")
+	allocator, err := NewCIDRRangeAllocator(fakeNodeHandler, getFakeNodeInformer(fakeNodeHandler), CIDRAllocatorParams{
+		ClusterCIDRs:      clusterCIDR,
+		ServiceCIDR:       serviceCIDR,
+		NodeCIDRMaskSizes: []int{24},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewCIDRRangeAllocator() = %v", err)
+	}
+	r := allocator.(*rangeAllocator)
+	for _, cidr := range []string{"10.10.0.0/24", "10.10.1.0/24", "10.10.2.0/24"} {
+		_, podCIDR, _ := net.ParseCIDR(cidr)
+		if err := r.cidrSets[0].Occupy(podCIDR); err != nil {
+			t.Fatalf("Occupy(%s) = %v", cidr, err)
+		}
+	}
+	// 10.10.2.0/24 is being assigned.
+	_, pending, _ := net.ParseCIDR("10.10.2.0/24")
+	r.setPending([]*net.IPNet{pending}, true)
+
+	allocated := func() []string {
+		var cidrs []string
+		for _, cidr := range r.cidrSets[0].Allocated() {
+			if !r.isReservedCIDR(cidr) {
+				cidrs = append(cidrs, cidr.String())
+			}
+		}
+		return cidrs
+	}
+	label := clusterCIDR[0].String()
+	expectMetrics := func(wantLeaked, wantReclaimed float64) {
+		t.Helper()
+		if got, _ := metricsutil.GetGaugeMetricValue(leakedCIDRs.WithLabelValues(label)); got != wantLeaked {
+			t.Errorf("got %v leaked CIDRs, want %v", got, wantLeaked)
+		}
+		if got, _ := metricsutil.GetCounterMetricValue(reclaimedCIDRs.WithLabelValues(label)); got != wantReclaimed {
+			t.Errorf("got %v reclaimed CIDRs, want %v", got, wantReclaimed)
+		}
+	}
+	leakedCIDRs.Reset()
+	reclaimedCIDRs.Reset()
+
+	// The leaked CIDR is only suspected at first.
+	r.reconcileLeakedCIDRs()
+	want := []string{"10.10.0.0/24", "10.10.1.0/24", "10.10.2.0/24"}
+	if got := allocated(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got allocated CIDRs %v after the first reconciliation, want %v", got, want)
+	}
+	expectMetrics(1, 0)
+
+	r.reconcileLeakedCIDRs()
+	want = []string{"10.10.0.0/24", "10.10.2.0/24"}
+	if got := allocated(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got allocated CIDRs %v after the second reconciliation, want %v", got, want)
+	}
+	expectMetrics(0, 1)
+
+	// The service CIDR stays occupied.
+	_, svc, _ := net.ParseCIDR("10.10.255.0/24")
+	var found bool
+	for _, cidr := range r.cidrSets[0].Allocated() {
+		if cidr.String() == svc.String() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("service CIDR %v released, want it occupied", svc)
+	}
+
+	// Once assigned, the CIDR isn't pending anymore and is reclaimed if no
+	// Node holds it.
+	r.setPending([]*net.IPNet{pending}, false)
+	r.reconcileLeakedCIDRs()
+	r.reconcileLeakedCIDRs()
+	want = []string{"10.10.0.0/24"}
+	if got := allocated(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got allocated CIDRs %v after the assignment, want %v", got, want)
+	}
+	expectMetrics(0, 2)
+}
+
+func TestReportDoubleAllocations(t *testing.T) {
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node0"}, Spec: v1.NodeSpec{PodCIDRs: []string{"10.10.0.0/24", "fd00::/64"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: v1.NodeSpec{PodCIDRs: []string{"10.10.1.0/24"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: v1.NodeSpec{PodCIDRs: []string{"10.10.0.0/24"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node3"}},
+	}
+	want := map[string][]string{"10.10.0.0/24": {"node0", "node2"}}
+	if got := doubleAllocatedPodCIDRs(nodes); !reflect.DeepEqual(got, want) {
+		t.Errorf("doubleAllocatedPodCIDRs() = %v, want %v", got, want)
+	}
+
+	recorder := testutil.NewFakeRecorder()
+	reportDoubleAllocations(recorder, nodes)
+	if got, _ := metricsutil.GetGaugeMetricValue(doubleAllocatedCIDRs); got != 1 {
+		t.Errorf("got %v double allocated CIDRs, want 1", got)
+	}
+	var flagged []string
+	for _, e := range recorder.Events {
+		if e.Reason == "CIDRDoubleAllocated" {
+			flagged = append(flagged, e.InvolvedObject.Name)
+		}
+	}
+	if want := []string{"node0", "node2"}; !reflect.DeepEqual(flagged, want) {
+		t.Errorf("got CIDRDoubleAllocated events on %v, want %v", flagged, want)
+	}
+
+	reportDoubleAllocations(recorder, nodes[:2])
+	if got, _ := metricsutil.GetGaugeMetricValue(doubleAllocatedCIDRs); got != 0 {
+		t.Errorf("got %v double allocated CIDRs once fixed, want 0", got)
+	}
+}
@@ -20,9 +20,11 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"math/bits"
 	"net"
+	"strconv"
 	"sync"
 )
 
@@ -72,6 +74,11 @@ var (
 	// big compared to the CIDR mask size.
 	ErrCIDRSetSubNetTooBig = errors.New(
 		"New CIDR set failed; the node CIDR size is too big")
+	// ErrCIDRSetMaskSizeOutOfRange occurs when a CIDR is allocated with a
+	// mask size which is neither the one of the node CIDRs nor a smaller one
+	// within the cluster CIDR.
+	ErrCIDRSetMaskSizeOutOfRange = errors.New(
+		"CIDR allocation failed; the mask size is out of the range of the cluster CIDR and node CIDR mask sizes")
 )
 
 // NewCIDRSet creates a new CidrSet.
@@ -88,14 +95,16 @@ func NewCIDRSet(clusterCIDR *net.IPNet, subNetMaskSize int) (*CidrSet, error) {
 	registerCidrsetMetrics()
 
 	maxCIDRs = 1 << uint32(subNetMaskSize-clusterMaskSize)
-	return &CidrSet{
+	s := &CidrSet{
 		clusterCIDR:     clusterCIDR,
 		nodeMask:        net.CIDRMask(subNetMaskSize, bits),
 		clusterMaskSize: clusterMaskSize,
 		maxCIDRs:        maxCIDRs,
 		nodeMaskSize:    subNetMaskSize,
 		label:           clusterCIDR.String(),
-	}, nil
+	}
+	s.updateFragmentationMetrics()
+	return s, nil
 }
 
 func (s *CidrSet) indexToCIDRBlock(index int) *net.IPNet {
@@ -145,6 +154,62 @@ func (s *CidrSet) indexToCIDRBlock(index int) *net.IPNet {
 	}
 }
 
+// FragmentationStats describes how the free node CIDRs of a CidrSet are
+// spread over the cluster CIDR.
+type FragmentationStats struct {
+	// LargestFreeBlock is the size, in node CIDRs, of the largest free block
+	// aligned on its size, or 0 if the cluster CIDR is fully allocated.
+	LargestFreeBlock int
+	// FreeBlocks is the number of free blocks aligned on their size by mask
+	// size, from the node mask size to the cluster mask size. It is the
+	// number of CIDRs of each mask size that can still be allocated.
+	FreeBlocks map[int]int
+}
+
+// FragmentationStats returns the current fragmentation of the CidrSet.
+func (s *CidrSet) FragmentationStats() FragmentationStats {
+	s.Lock()
+	defer s.Unlock()
+	return s.fragmentationStats()
+}
+
+func (s *CidrSet) fragmentationStats() FragmentationStats {
+	stats := FragmentationStats{FreeBlocks: map[int]int{}}
+	// free[i] tells whether the i-th block of the current size is free,
+	// the blocks of the next size are free if both their halves are.
+	free := make([]bool, s.maxCIDRs)
+	for i := range free {
+		free[i] = s.used.Bit(i) == 0
+	}
+	for maskSize, blockSize := s.nodeMaskSize, 1; maskSize >= s.clusterMaskSize; maskSize, blockSize = maskSize-1, blockSize*2 {
+		count := 0
+		for _, f := range free {
+			if f {
+				count++
+			}
+		}
+		stats.FreeBlocks[maskSize] = count
+		if count > 0 {
+			stats.LargestFreeBlock = blockSize
+		}
+		for i := 0; i < len(free)/2; i++ {
+			free[i] = free[2*i] && free[2*i+1]
+		}
+		free = free[:len(free)/2]
+	}
+	return stats
+}
+
+// updateFragmentationMetrics updates the fragmentation metrics, it must be
+// called with the lock held.
+func (s *CidrSet) updateFragmentationMetrics() {
+	stats := s.fragmentationStats()
+	cidrSetLargestFreeBlock.WithLabelValues(s.label).Set(float64(stats.LargestFreeBlock))
+	for maskSize, count := range stats.FreeBlocks {
+		cidrSetFreeBlocks.WithLabelValues(s.label, strconv.Itoa(maskSize)).Set(float64(count))
+	}
+}
+
 // AllocateNext allocates the next free CIDR range. This will set the range
 // as occupied and return the allocated range.
 func (s *CidrSet) AllocateNext() (*net.IPNet, error) {
@@ -170,10 +235,103 @@ func (s *CidrSet) AllocateNext() (*net.IPNet, error) {
 	cidrSetAllocations.WithLabelValues(s.label).Inc()
 	cidrSetAllocationTriesPerRequest.WithLabelValues(s.label).Observe(float64(i))
 	cidrSetUsage.WithLabelValues(s.label).Set(float64(s.allocatedCIDRs) / float64(s.maxCIDRs))
+	s.updateFragmentationMetrics()
 
 	return s.indexToCIDRBlock(candidate), nil
 }
 
+// AllocateNextOfSize allocates the next free CIDR range of the mask size,
+// which spans several node CIDRs if it is smaller than the node mask size,
+// aligned on its size. This will set the range as occupied and return the
+// allocated range.
+func (s *CidrSet) AllocateNextOfSize(maskSize int) (*net.IPNet, error) {
+	if maskSize == s.nodeMaskSize {
+		return s.AllocateNext()
+	}
+	if maskSize < s.clusterMaskSize || maskSize > s.nodeMaskSize {
+		return nil, ErrCIDRSetMaskSizeOutOfRange
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	size := 1 << uint(s.nodeMaskSize-maskSize)
+	if s.maxCIDRs-s.allocatedCIDRs < size {
+		return nil, ErrCIDRRangeNoCIDRsRemaining
+	}
+	// maxCIDRs is a multiple of size, so that the candidates stay aligned.
+	candidate := s.nextCandidate &^ (size - 1)
+	var i int
+	for i = 0; i < s.maxCIDRs/size; i++ {
+		if s.rangeFree(candidate, size) {
+			break
+		}
+		candidate = (candidate + size) % s.maxCIDRs
+	}
+	if i == s.maxCIDRs/size {
+		return nil, ErrCIDRRangeNoCIDRsRemaining
+	}
+
+	s.nextCandidate = (candidate + size) % s.maxCIDRs
+	for j := candidate; j < candidate+size; j++ {
+		s.used.SetBit(&s.used, j, 1)
+	}
+	s.allocatedCIDRs += size
+	// Update metrics
+	cidrSetAllocations.WithLabelValues(s.label).Add(float64(size))
+	cidrSetAllocationTriesPerRequest.WithLabelValues(s.label).Observe(float64(i))
+	cidrSetUsage.WithLabelValues(s.label).Set(float64(s.allocatedCIDRs) / float64(s.maxCIDRs))
+	s.updateFragmentationMetrics()
+
+	cidr := s.indexToCIDRBlock(candidate)
+	_, bits := s.clusterCIDR.Mask.Size()
+	cidr.Mask = net.CIDRMask(maskSize, bits)
+	return cidr, nil
+}
+
+// rangeFree tells whether the size node CIDRs from the index are free, it
+// must be called with the lock held.
+func (s *CidrSet) rangeFree(index, size int) bool {
+	for i := index; i < index+size; i++ {
+		if s.used.Bit(i) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeMaskSize returns the mask size of the node CIDRs of the CidrSet.
+func (s *CidrSet) NodeMaskSize() int {
+	return s.nodeMaskSize
+}
+
+// Allocated returns the node CIDRs marked as used, including the ones
+// occupied by larger ranges, in address order.
+func (s *CidrSet) Allocated() []*net.IPNet {
+	s.Lock()
+	defer s.Unlock()
+	cidrs := make([]*net.IPNet, 0, s.allocatedCIDRs)
+	for i := 0; i < s.maxCIDRs && len(cidrs) < s.allocatedCIDRs; i++ {
+		if s.used.Bit(i) != 0 {
+			cidrs = append(cidrs, s.indexToCIDRBlock(i))
+		}
+	}
+	return cidrs
+}
+
+// ClusterCIDR returns the cluster CIDR of the CidrSet.
+func (s *CidrSet) ClusterCIDR() *net.IPNet {
+	return s.clusterCIDR
+}
+
+// AddressUsage returns the number of addresses of the node CIDRs of the
+// cluster CIDR, and of the allocated ones.
+func (s *CidrSet) AddressUsage() (capacity, allocated float64) {
+	s.Lock()
+	defer s.Unlock()
+	_, bits := s.clusterCIDR.Mask.Size()
+	return math.Ldexp(float64(s.maxCIDRs), bits-s.nodeMaskSize), math.Ldexp(float64(s.allocatedCIDRs), bits-s.nodeMaskSize)
+}
+
 func (s *CidrSet) getBeginingAndEndIndices(cidr *net.IPNet) (begin, end int, err error) {
 	if cidr == nil {
 		return -1, -1, fmt.Errorf("error getting indices for cluster cidr %v, cidr is nil", s.clusterCIDR)
@@ -242,6 +400,7 @@ func (s *CidrSet) Release(cidr *net.IPNet) error {
 	}
 
 	cidrSetUsage.WithLabelValues(s.label).Set(float64(s.allocatedCIDRs) / float64(s.maxCIDRs))
+	s.updateFragmentationMetrics()
 	return nil
 }
 
@@ -265,6 +424,7 @@ func (s *CidrSet) Occupy(cidr *net.IPNet) (err error) {
 	}
 
 	cidrSetUsage.WithLabelValues(s.label).Set(float64(s.allocatedCIDRs) / float64(s.maxCIDRs))
+	s.updateFragmentationMetrics()
 	return nil
 }
 
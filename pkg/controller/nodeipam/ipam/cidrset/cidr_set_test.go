@@ -20,6 +20,7 @@ import (
 	"math/big"
 	"net"
 	"reflect"
+	"strconv"
 	"testing"
 
 	"k8s.io/component-base/metrics/testutil"
@@ -970,6 +971,155 @@ func TestCidrSetMetricsDual(t *testing.T) {
 
 }
 
+func TestFragmentationStats(t *testing.T) {
+	_, clusterCIDR, _ := net.ParseCIDR("10.0.0.0/22")
+	// We have 4 free cidrs
+	a, err := NewCIDRSet(clusterCIDR, 24)
+	if err != nil {
+		t.Fatalf("unexpected error creating CidrSet: %v", err)
+	}
+	want := FragmentationStats{LargestFreeBlock: 4, FreeBlocks: map[int]int{24: 4, 23: 2, 22: 1}}
+	if got := a.FragmentationStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected stats of an empty set: got %+v, want %+v", got, want)
+	}
+	expectFragmentationMetrics(t, clusterCIDR.String(), want)
+
+	// Occupy the second and the fourth cidrs, so that no /23 is free.
+	for _, cidr := range []string{"10.0.1.0/24", "10.0.3.0/24"} {
+		_, occupied, _ := net.ParseCIDR(cidr)
+		if err := a.Occupy(occupied); err != nil {
+			t.Fatalf("unexpected error occupying %s: %v", cidr, err)
+		}
+	}
+	want = FragmentationStats{LargestFreeBlock: 1, FreeBlocks: map[int]int{24: 2, 23: 0, 22: 0}}
+	if got := a.FragmentationStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected stats of a fragmented set: got %+v, want %+v", got, want)
+	}
+	expectFragmentationMetrics(t, clusterCIDR.String(), want)
+
+	// Releasing the second cidr frees the first /23.
+	_, released, _ := net.ParseCIDR("10.0.1.0/24")
+	if err := a.Release(released); err != nil {
+		t.Fatalf("unexpected error releasing %v: %v", released, err)
+	}
+	want = FragmentationStats{LargestFreeBlock: 2, FreeBlocks: map[int]int{24: 3, 23: 1, 22: 0}}
+	if got := a.FragmentationStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected stats after release: got %+v, want %+v", got, want)
+	}
+	expectFragmentationMetrics(t, clusterCIDR.String(), want)
+
+	a.Occupy(clusterCIDR)
+	want = FragmentationStats{LargestFreeBlock: 0, FreeBlocks: map[int]int{24: 0, 23: 0, 22: 0}}
+	if got := a.FragmentationStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected stats of a full set: got %+v, want %+v", got, want)
+	}
+	expectFragmentationMetrics(t, clusterCIDR.String(), want)
+}
+
+func TestAllocated(t *testing.T) {
+	_, clusterCIDR, _ := net.ParseCIDR("10.0.0.0/22")
+	a, err := NewCIDRSet(clusterCIDR, 24)
+	if err != nil {
+		t.Fatalf("unexpected error creating CidrSet: %v", err)
+	}
+	if got := a.Allocated(); len(got) != 0 {
+		t.Errorf("got allocated CIDRs %v of an empty set, want none", got)
+	}
+	for _, cidr := range []string{"10.0.3.0/24", "10.0.0.0/23"} {
+		_, occupied, _ := net.ParseCIDR(cidr)
+		if err := a.Occupy(occupied); err != nil {
+			t.Fatalf("unexpected error occupying %s: %v", cidr, err)
+		}
+	}
+	var got []string
+	for _, cidr := range a.Allocated() {
+		got = append(got, cidr.String())
+	}
+	want := []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.3.0/24"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got allocated CIDRs %v, want %v", got, want)
+	}
+}
+
+func TestAllocateNextOfSize(t *testing.T) {
+	_, clusterCIDR, _ := net.ParseCIDR("10.0.0.0/22")
+	a, err := NewCIDRSet(clusterCIDR, 25)
+	if err != nil {
+		t.Fatalf("unexpected error creating CidrSet: %v", err)
+	}
+	for _, maskSize := range []int{21, 26} {
+		if _, err := a.AllocateNextOfSize(maskSize); err != ErrCIDRSetMaskSizeOutOfRange {
+			t.Errorf("AllocateNextOfSize(%d) = %v, want %v", maskSize, err, ErrCIDRSetMaskSizeOutOfRange)
+		}
+	}
+
+	var got []string
+	for _, maskSize := range []int{25, 24, 23, 25} {
+		cidr, err := a.AllocateNextOfSize(maskSize)
+		if err != nil {
+			t.Fatalf("unexpected error allocating a /%d: %v", maskSize, err)
+		}
+		got = append(got, cidr.String())
+	}
+	want := []string{"10.0.0.0/25", "10.0.1.0/24", "10.0.2.0/23", "10.0.0.128/25"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got allocated CIDRs %v, want %v", got, want)
+	}
+	if _, err := a.AllocateNextOfSize(25); err != ErrCIDRRangeNoCIDRsRemaining {
+		t.Errorf("AllocateNextOfSize(25) of a full set = %v, want %v", err, ErrCIDRRangeNoCIDRsRemaining)
+	}
+
+	// A larger range only fits in an aligned free block.
+	_, released, _ := net.ParseCIDR("10.0.0.128/25")
+	if err := a.Release(released); err != nil {
+		t.Fatalf("unexpected error releasing %v: %v", released, err)
+	}
+	if _, err := a.AllocateNextOfSize(24); err != ErrCIDRRangeNoCIDRsRemaining {
+		t.Errorf("AllocateNextOfSize(24) of a set without a free aligned /24 = %v, want %v", err, ErrCIDRRangeNoCIDRsRemaining)
+	}
+	_, released, _ = net.ParseCIDR("10.0.1.0/24")
+	if err := a.Release(released); err != nil {
+		t.Fatalf("unexpected error releasing %v: %v", released, err)
+	}
+	if cidr, err := a.AllocateNextOfSize(24); err != nil || cidr.String() != "10.0.1.0/24" {
+		t.Errorf("AllocateNextOfSize(24) = %v, %v, want 10.0.1.0/24", cidr, err)
+	}
+}
+
+func TestAddressUsage(t *testing.T) {
+	_, clusterCIDR, _ := net.ParseCIDR("10.0.0.0/22")
+	a, err := NewCIDRSet(clusterCIDR, 24)
+	if err != nil {
+		t.Fatalf("unexpected error creating CidrSet: %v", err)
+	}
+	if _, err := a.AllocateNext(); err != nil {
+		t.Fatalf("unexpected error allocating a CIDR: %v", err)
+	}
+	if capacity, allocated := a.AddressUsage(); capacity != 1024 || allocated != 256 {
+		t.Errorf("AddressUsage() = %v, %v, want 1024, 256", capacity, allocated)
+	}
+}
+
+func expectFragmentationMetrics(t *testing.T, label string, want FragmentationStats) {
+	t.Helper()
+	largest, err := testutil.GetGaugeMetricValue(cidrSetLargestFreeBlock.WithLabelValues(label))
+	if err != nil {
+		t.Errorf("failed to get %s value, err: %v", cidrSetLargestFreeBlock.Name, err)
+	}
+	if largest != float64(want.LargestFreeBlock) {
+		t.Errorf("metric %s = %v, want %v", cidrSetLargestFreeBlock.Name, largest, want.LargestFreeBlock)
+	}
+	for maskSize, count := range want.FreeBlocks {
+		got, err := testutil.GetGaugeMetricValue(cidrSetFreeBlocks.WithLabelValues(label, strconv.Itoa(maskSize)))
+		if err != nil {
+			t.Errorf("failed to get %s value, err: %v", cidrSetFreeBlocks.Name, err)
+		}
+		if got != float64(count) {
+			t.Errorf("metric %s{maskSize=%d} = %v, want %v", cidrSetFreeBlocks.Name, maskSize, got, count)
+		}
+	}
+}
+
 // Metrics helpers
 func clearMetrics(labels map[string]string) {
 	cidrSetAllocations.Delete(labels)
@@ -63,6 +63,24 @@ var (
 		},
 		[]string{"clusterCIDR"},
 	)
+	cidrSetLargestFreeBlock = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "cidrset_largest_free_block_cidrs",
+			Help:           "Gauge measuring the size, in node CIDRs, of the largest free aligned block of the cluster CIDR.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"clusterCIDR"},
+	)
+	cidrSetFreeBlocks = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Subsystem:      nodeIpamSubsystem,
+			Name:           "cidrset_free_blocks",
+			Help:           "Gauge measuring the number of free aligned blocks of the cluster CIDR by mask size, i.e. how many CIDRs of that mask size can still be allocated.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"clusterCIDR", "maskSize"},
+	)
 )
 
 var registerMetrics sync.Once
@@ -74,5 +92,7 @@ func registerCidrsetMetrics() {
 		legacyregistry.MustRegister(cidrSetReleases)
 		legacyregistry.MustRegister(cidrSetUsage)
 		legacyregistry.MustRegister(cidrSetAllocationTriesPerRequest)
+		legacyregistry.MustRegister(cidrSetLargestFreeBlock)
+		legacyregistry.MustRegister(cidrSetFreeBlocks)
 	})
 }
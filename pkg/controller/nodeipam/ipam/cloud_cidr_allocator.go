@@ -24,9 +24,15 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"sync"
 	"time"
 
 	networkv1 "github.com/GoogleCloudPlatform/gke-networking-api/apis/network/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	compute "google.golang.org/api/compute/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
@@ -37,6 +43,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	informers "k8s.io/client-go/informers/core/v1"
@@ -58,6 +65,20 @@ import (
 
 const workqueueName = "cloudCIDRAllocator"
 
+// tracerName is the instrumentation scope of the spans of the CIDR
+// allocations, whose GCE API calls are traced by the cloud provider.
+const tracerName = "k8s.io/cloud-provider-gcp/pkg/controller/nodeipam"
+
+const (
+	// instancePrefetchTimeout bounds the listing of the instances at startup.
+	instancePrefetchTimeout = time.Minute
+	// instancePrefetchTTL is how long the instances listed at startup answer
+	// the lookups of the nodes queued meanwhile.
+	instancePrefetchTTL = 5 * time.Minute
+	// instanceLookupTimeout bounds the lookup of the instance of a node.
+	instanceLookupTimeout = time.Minute
+)
+
 // clusterStackType represents the cluster's IP family as per
 // https://kubernetes.io/docs/concepts/cluster-administration/networking/#cluster-network-ipfamilies
 type clusterStackType string
@@ -92,6 +113,25 @@ type cloudCIDRAllocator struct {
 	queue    workqueue.RateLimitingInterface
 
 	stackType clusterStackType
+	// podRanges pins the secondary ranges of the pod CIDRs of the nodes.
+	podRanges PodRangeSelection
+	// leakReconcilePeriod is how often the double allocated pod CIDRs are
+	// flagged, never if 0.
+	leakReconcilePeriod time.Duration
+	// podRangeExpansion adds alias IP ranges to the IPv4 pod CIDRs of the
+	// nodes whose max pods exceed them.
+	podRangeExpansion bool
+	// podRangePreallocationMaskSize is the mask size of the alias IP ranges
+	// added to the instances lacking one before their nodes register, none
+	// if 0.
+	podRangePreallocationMaskSize int
+
+	// prefetchedInstances are the instances listed at startup by
+	// providerID, each of which answers the first lookup of its node until
+	// instancePrefetchTTL after prefetchedAt, guarded by prefetchLock.
+	prefetchLock        sync.Mutex
+	prefetchedInstances map[string]*compute.Instance
+	prefetchedAt        time.Time
 }
 
 var _ CIDRAllocator = (*cloudCIDRAllocator)(nil)
@@ -114,30 +154,27 @@ func NewCloudCIDRAllocator(client clientset.Interface, cloud cloudprovider.Inter
 		return nil, err
 	}
 
-	// Default value for deployments where the primary service CIDR is not defined.
-	stackType := stackIPv4
-
-	// Based on validation performed in startNodeIpamController(), if there are 2 service CIDRs provided,
-	// they are of different family types.
-
-	if isIP4(allocatorParams.ServiceCIDR) && isIP6(allocatorParams.SecondaryServiceCIDR) {
-		stackType = stackIPv4IPv6
-	} else if isIP6(allocatorParams.ServiceCIDR) && isIP4(allocatorParams.SecondaryServiceCIDR) {
-		stackType = stackIPv6IPv4
-	} else if isIP6(allocatorParams.ServiceCIDR) && allocatorParams.SecondaryServiceCIDR == nil {
-		stackType = stackIPv6
-	}
-
 	ca := &cloudCIDRAllocator{
-		client:         client,
-		cloud:          gceCloud,
-		networksLister: nwInformer.Lister(),
-		gnpLister:      gnpInformer.Lister(),
-		nodeLister:     nodeInformer.Lister(),
-		nodesSynced:    nodeInformer.Informer().HasSynced,
-		recorder:       recorder,
-		queue:          workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: workqueueName}),
-		stackType:      stackType,
+		client:              client,
+		cloud:               gceCloud,
+		networksLister:      nwInformer.Lister(),
+		gnpLister:           gnpInformer.Lister(),
+		nodeLister:          nodeInformer.Lister(),
+		nodesSynced:         nodeInformer.Informer().HasSynced,
+		recorder:            recorder,
+		queue:               workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: workqueueName}),
+		stackType:           stackTypeOf(allocatorParams),
+		podRanges:           allocatorParams.PodRangeSelection,
+		leakReconcilePeriod: allocatorParams.LeakReconcilePeriod,
+		podRangeExpansion:   allocatorParams.PodRangeExpansion,
+
+		podRangePreallocationMaskSize: allocatorParams.PodRangePreallocationMaskSize,
+	}
+	if ca.podRangePreallocationMaskSize > 0 && ca.preallocationRangeName() == "" {
+		return nil, fmt.Errorf("the pod range preallocation requires the secondary range of the pod CIDRs, neither the pod range name nor the one of the cloud config is set")
+	}
+	if ca.podRangePreallocationMaskSize > 0 && ca.cloud.NodeInstancePrefix() == "" {
+		return nil, fmt.Errorf("the pod range preallocation requires the node instance prefix of the cloud config, which names the instance groups of the nodes")
 	}
 
 	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -154,6 +191,11 @@ func NewCloudCIDRAllocator(client clientset.Interface, cloud cloudprovider.Inter
 				return ca.AllocateOrOccupyCIDR(newNode)
 			}
 
+			// Process Node whose max pods were raised beyond its pod CIDR.
+			if ca.podRangeExpansion && needsPodRangeExpansion(newNode) && !needsPodRangeExpansion(oldNode) {
+				return ca.AllocateOrOccupyCIDR(newNode)
+			}
+
 			// Process Node for Multi-Network network-status annotation change
 			var oldVal, newVal string
 			if newNode.Annotations != nil {
@@ -235,6 +277,8 @@ func NewCloudCIDRAllocator(client clientset.Interface, cloud cloudprovider.Inter
 
 	// register Cloud CIDR Allocator metrics
 	registerCloudCidrAllocatorMetrics()
+	registerCIDRLeakMetrics()
+	registerAllocationMetrics()
 
 	klog.V(0).Infof("Using cloud CIDR allocator (provider: %v)", cloud.ProviderName())
 	return ca, nil
@@ -253,14 +297,97 @@ func (ca *cloudCIDRAllocator) Run(stopCh <-chan struct{}) {
 	if !cache.WaitForNamedCacheSync("cidrallocator", stopCh, ca.nodesSynced) {
 		return
 	}
+	ca.prefetchInstances(ctx)
 
 	for i := 0; i < cidrUpdateWorkers; i++ {
 		go wait.UntilWithContext(ctx, ca.runWorker, time.Second)
 	}
+	if ca.leakReconcilePeriod > 0 {
+		go wait.Until(ca.reconcileDoubleAllocations, ca.leakReconcilePeriod, stopCh)
+	}
+	go wait.Until(ca.reportPodRangeUsage, podRangeUsagePeriod, stopCh)
+	if ca.podRangePreallocationMaskSize > 0 {
+		go wait.Until(ca.preallocatePodRanges, podRangePreallocationPeriod, stopCh)
+	}
 
 	<-stopCh
 }
 
+// reconcileDoubleAllocations flags the pod CIDRs held by more than one Node.
+// The alias IP ranges of the nodes are released by GCE along with their
+// instances, so there is nothing to release.
+func (ca *cloudCIDRAllocator) reconcileDoubleAllocations() {
+	nodes, err := ca.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list nodes for CIDR leak reconciliation: %v", err)
+		return
+	}
+	reportDoubleAllocations(ca.recorder, nodes)
+}
+
+// reportPodRangeUsage reports the usage of the secondary ranges of the
+// subnet of the cluster by the pod CIDRs of the nodes. The IPv6 pod CIDRs
+// are taken from the IPv6 ranges of the interfaces of the nodes rather than
+// from secondary ranges, so there is nothing to report in IPv6-only
+// clusters.
+func (ca *cloudCIDRAllocator) reportPodRangeUsage() {
+	if ca.stackType == stackIPv6 || ca.cloud.SubnetworkURL() == "" {
+		return
+	}
+	subnet, err := ca.cloud.GetSubnetwork(ca.cloud.Region(), resourceName(ca.cloud.SubnetworkURL()))
+	if err != nil {
+		klog.Errorf("Failed to get the subnetwork for the pod range usage: %v", err)
+		return
+	}
+	nodes, err := ca.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list nodes for the pod range usage: %v", err)
+		return
+	}
+	capacity, allocated := podRangeUsage(subnet, nodes)
+	for name := range capacity {
+		setPodRangeUsage(name, capacity[name], allocated[name])
+	}
+}
+
+// prefetchInstances lists the instances of the nodes at once, so that the
+// allocations of all the nodes queued at startup don't each get their
+// instance. The instances are looked up one by one if the list fails.
+func (ca *cloudCIDRAllocator) prefetchInstances(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, instancePrefetchTimeout)
+	defer cancel()
+	start := time.Now()
+	instances, err := ca.cloud.ListInstanceNetworkInterfaces(ctx)
+	if err != nil {
+		klog.Warningf("Failed to list the instances of the nodes, looking them up one by one: %v", err)
+		return
+	}
+	klog.Infof("Listed %d instances for the CIDR allocation of the nodes in %v", len(instances), time.Since(start))
+	ca.prefetchLock.Lock()
+	defer ca.prefetchLock.Unlock()
+	ca.prefetchedInstances = instances
+	ca.prefetchedAt = time.Now()
+}
+
+// instanceByProviderID returns the instance of the providerID, the
+// prefetched one if it is still fresh and wasn't taken yet. Later lookups,
+// e.g. retries, get the instance with ctx.
+func (ca *cloudCIDRAllocator) instanceByProviderID(ctx context.Context, providerID string) (*compute.Instance, error) {
+	ca.prefetchLock.Lock()
+	if time.Since(ca.prefetchedAt) >= instancePrefetchTTL {
+		ca.prefetchedInstances = nil
+	}
+	instance, ok := ca.prefetchedInstances[providerID]
+	delete(ca.prefetchedInstances, providerID)
+	ca.prefetchLock.Unlock()
+	if ok {
+		return instance, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, instanceLookupTimeout)
+	defer cancel()
+	return ca.cloud.InstanceByProviderIDWithContext(ctx, providerID)
+}
+
 func (ca *cloudCIDRAllocator) AllocateOrOccupyCIDR(node *v1.Node) error {
 	klog.V(4).Infof("Putting node %s into the work queue", node.Name)
 	ca.queue.Add(node.Name)
@@ -281,8 +408,17 @@ func (ca *cloudCIDRAllocator) processNextItem(ctx context.Context) bool {
 	defer ca.queue.Done(key)
 
 	klog.V(3).Infof("Processing %s", key)
-	//TODO: properly enable and pass ctx to updateCIDRAllocation
-	err := ca.updateCIDRAllocation(key.(string))
+	start := time.Now()
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "UpdateCIDRAllocation",
+		trace.WithAttributes(attribute.String("node.name", key.(string))))
+	err := ca.updateCIDRAllocation(ctx, key.(string))
+	if err == nil {
+		observeAllocation(CloudAllocatorType, start)
+	} else {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 	ca.handleErr(err, key)
 	return true
 }
@@ -319,7 +455,8 @@ func (ca *cloudCIDRAllocator) handleErr(err error, key interface{}) {
 
 // updateCIDRAllocation assigns CIDR to Node and sends an update to the API server.
 // Operate on the `node` object if any changes have to be done to it in the API.
-func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
+// The instance of the node is looked up with ctx.
+func (ca *cloudCIDRAllocator) updateCIDRAllocation(ctx context.Context, nodeName string) error {
 	oldNode, err := ca.nodeLister.Get(nodeName)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -333,9 +470,9 @@ func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
 	if node.Spec.ProviderID == "" {
 		return fmt.Errorf("node %s doesn't have providerID", nodeName)
 	}
-	instance, err := ca.cloud.InstanceByProviderID(node.Spec.ProviderID)
+	instance, err := ca.instanceByProviderID(ctx, node.Spec.ProviderID)
 	if err != nil {
-		nodeutil.RecordNodeStatusChange(ca.recorder, node, "CIDRNotAvailable")
+		recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "CIDRNotAvailable")
 		return fmt.Errorf("failed to get instance from provider: %v", err)
 	}
 
@@ -348,7 +485,7 @@ func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
 			len(instance.NetworkInterfaces[0].AliasIpRanges) == 0 &&
 			ca.cloud.GetIPV6Address(instance.NetworkInterfaces[0]) == nil) {
 
-		nodeutil.RecordNodeStatusChange(ca.recorder, node, "CIDRNotAvailable")
+		recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "CIDRNotAvailable")
 		return fmt.Errorf("failed to allocate cidr: Node %v has no ranges from which CIDRs can be allocated", node.Name)
 	}
 
@@ -357,13 +494,17 @@ func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
 
 	// Nodes in clusters WITHOUT multi-networking are expected to have only 1 network-interface
 	// with 1 alias IPv4 range and/or 1 IPv6 address. Multi-network clusters may have 1 interface
-	// with multiple aliases.
+	// with multiple aliases. With pod range expansion, the interface has the alias IPv4 ranges
+	// added to the pod CIDR in its secondary range.
 	if len(instance.NetworkInterfaces) == 1 &&
 		(len(instance.NetworkInterfaces[0].AliasIpRanges) == 1 ||
-			ca.cloud.GetIPV6Address(instance.NetworkInterfaces[0]) != nil) {
+			ca.cloud.GetIPV6Address(instance.NetworkInterfaces[0]) != nil ||
+			ca.podRangeExpansion && sameRangeAliases(instance.NetworkInterfaces[0])) {
 
 		ipv4CIDR := ""
-		if len(instance.NetworkInterfaces[0].AliasIpRanges) > 0 {
+		if name := ca.podRanges.rangeName(node); name != "" {
+			ipv4CIDR = aliasIPRangeByName(instance.NetworkInterfaces[0], name)
+		} else if len(instance.NetworkInterfaces[0].AliasIpRanges) > 0 {
 			ipv4CIDR = instance.NetworkInterfaces[0].AliasIpRanges[0].IpCidrRange
 		}
 
@@ -372,30 +513,37 @@ func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
 			ipv6CIDR = addr.String()
 		}
 
-		switch {
-		case ca.stackType == stackIPv4 && ipv4CIDR != "":
-			cidrStrings = []string{ipv4CIDR}
-		case ca.stackType == stackIPv4IPv6 && ipv4CIDR != "" && ipv6CIDR != "":
-			cidrStrings = []string{ipv4CIDR, ipv6CIDR}
-		case ca.stackType == stackIPv6IPv4 && ipv4CIDR != "" && ipv6CIDR != "":
-			cidrStrings = []string{ipv6CIDR, ipv4CIDR}
-		case ca.stackType == stackIPv6 && ipv6CIDR != "":
-			cidrStrings = []string{ipv6CIDR}
-		default:
-			return fmt.Errorf("failed to allocate cidr: Node %v has no ranges from which CIDRs can be allocated for the cluster stack family %s", node.Name, ca.stackType)
+		cidrStrings, err = ca.podCIDRsForStack(node, ipv4CIDR, ipv6CIDR)
+		if err != nil {
+			return err
 		}
 	} else {
 		// multi-networking enabled clusters
 		hasNodeLabels, defaultSubnet, defaultPodRange := getNodeDefaultLabels(node)
+		if name := ca.podRanges.rangeName(node); !hasNodeLabels && name != "" {
+			// A pinned range is one of the subnet of the first interface,
+			// which is the one of the default network.
+			hasNodeLabels, defaultSubnet, defaultPodRange = true, resourceName(instance.NetworkInterfaces[0].Subnetwork), name
+		}
 		// if there's no node label get the cidrStrings with the old way by comparing the default Network and GNP
 		cidrStrings, err = ca.performMultiNetworkCIDRAllocation(node, instance.NetworkInterfaces, hasNodeLabels)
 		if err != nil {
-			nodeutil.RecordNodeStatusChange(ca.recorder, node, "AnnotationsNotAvailable")
+			recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "AnnotationsNotAvailable")
 			return fmt.Errorf("failed to perform node annotations for multi-networking: %v", err)
 		}
 		if hasNodeLabels {
 			cidrStrings = ca.extractDefaultNwCIDRs(instance.NetworkInterfaces, defaultSubnet, defaultPodRange)
 		}
+		// The default network has the IPv4 alias range and the IPv6 range
+		// of its interface, which are ordered and filtered by the cluster
+		// stack type like the ones of the single interface above.
+		if len(cidrStrings) > 0 {
+			ipv4CIDR, ipv6CIDR := splitCIDRFamilies(cidrStrings)
+			cidrStrings, err = ca.podCIDRsForStack(node, ipv4CIDR, ipv6CIDR)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	// update Node.Spec.PodCIDR(s)
@@ -403,6 +551,12 @@ func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
 		return err
 	}
 
+	if ca.podRangeExpansion && len(instance.NetworkInterfaces) == 1 {
+		if err = ca.expandPodRange(node, instance.NetworkInterfaces[0]); err != nil {
+			return err
+		}
+	}
+
 	if !reflect.DeepEqual(node.Annotations, oldNode.Annotations) {
 		// retain old north interfaces annotation
 		var oldNorthInterfacesAnnotation networkv1.NorthInterfacesAnnotation
@@ -414,7 +568,7 @@ func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
 		}
 
 		if err = utilnode.PatchNodeMultiNetwork(ca.client, node); err != nil {
-			nodeutil.RecordNodeStatusChange(ca.recorder, node, "CIDRAssignmentFailed")
+			recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "CIDRAssignmentFailed")
 			klog.ErrorS(err, "Failed to update the node annotations and capacity for multi-networking", "nodeName", node.Name)
 			return err
 		}
@@ -441,7 +595,7 @@ func (ca *cloudCIDRAllocator) updateCIDRAllocation(nodeName string) error {
 // returns error if cidrStrings is not valid or fails to update the Node object
 func (ca *cloudCIDRAllocator) updateNodePodCIDRWithCidrStrings(oldNode *v1.Node, node *v1.Node, cidrStrings []string) error {
 	if len(cidrStrings) == 0 {
-		nodeutil.RecordNodeStatusChange(ca.recorder, node, "CIDRNotAvailable")
+		recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "CIDRNotAvailable")
 		return fmt.Errorf("failed to allocate cidr: Node %v has no CIDRs", node.Name)
 	}
 	// Can have at most 2 ips (one for v4 and one for v6)
@@ -465,6 +619,61 @@ func (ca *cloudCIDRAllocator) updateNodePodCIDRWithCidrStrings(oldNode *v1.Node,
 	return ca.updateNodeCIDR(node, oldNode)
 }
 
+// stackTypeOf returns the cluster stack type of the allocator parameters,
+// IPv6 in IPv6-only mode and otherwise the one of the service CIDRs.
+func stackTypeOf(allocatorParams CIDRAllocatorParams) clusterStackType {
+	if allocatorParams.IPv6Only {
+		return stackIPv6
+	}
+
+	// Based on validation performed in startNodeIpamController(), if there are 2 service CIDRs provided,
+	// they are of different family types.
+	switch {
+	case isIP4(allocatorParams.ServiceCIDR) && isIP6(allocatorParams.SecondaryServiceCIDR):
+		return stackIPv4IPv6
+	case isIP6(allocatorParams.ServiceCIDR) && isIP4(allocatorParams.SecondaryServiceCIDR):
+		return stackIPv6IPv4
+	case isIP6(allocatorParams.ServiceCIDR) && allocatorParams.SecondaryServiceCIDR == nil:
+		return stackIPv6
+	}
+	// Default value for deployments where the primary service CIDR is not defined.
+	return stackIPv4
+}
+
+// podCIDRsForStack returns the pod CIDRs of the node for the cluster stack
+// type, in the order of its IP families, from the IPv4 alias range and the
+// IPv6 range of the node, either of which may be empty.
+func (ca *cloudCIDRAllocator) podCIDRsForStack(node *v1.Node, ipv4CIDR, ipv6CIDR string) ([]string, error) {
+	switch {
+	case ca.stackType == stackIPv4 && ipv4CIDR != "":
+		return []string{ipv4CIDR}, nil
+	case ca.stackType == stackIPv4IPv6 && ipv4CIDR != "" && ipv6CIDR != "":
+		return []string{ipv4CIDR, ipv6CIDR}, nil
+	case ca.stackType == stackIPv6IPv4 && ipv4CIDR != "" && ipv6CIDR != "":
+		return []string{ipv6CIDR, ipv4CIDR}, nil
+	case ca.stackType == stackIPv6 && ipv6CIDR != "":
+		return []string{ipv6CIDR}, nil
+	}
+	recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "CIDRNotAvailable")
+	return nil, fmt.Errorf("failed to allocate cidr: Node %v has no ranges from which CIDRs can be allocated for the cluster stack family %s", node.Name, ca.stackType)
+}
+
+// splitCIDRFamilies returns the first IPv4 and the first IPv6 CIDR of cidrs,
+// or "" if there is none of the family. The CIDRs which are not valid are
+// returned as IPv4 ones, to be reported when parsed.
+func splitCIDRFamilies(cidrs []string) (ipv4CIDR, ipv6CIDR string) {
+	for _, cidr := range cidrs {
+		if netutils.IsIPv6CIDRString(cidr) {
+			if ipv6CIDR == "" {
+				ipv6CIDR = cidr
+			}
+		} else if ipv4CIDR == "" {
+			ipv4CIDR = cidr
+		}
+	}
+	return ipv4CIDR, ipv6CIDR
+}
+
 func (ca *cloudCIDRAllocator) setNetworkCondition(node *v1.Node) {
 	cond := v1.NodeCondition{
 		Type:               v1.NodeNetworkUnavailable,
@@ -493,7 +702,7 @@ func (ca *cloudCIDRAllocator) updateNodeCIDR(node, oldNode *v1.Node) error {
 	if !reflect.DeepEqual(node.Spec, oldNode.Spec) {
 		err = utilnode.PatchNodeCIDRs(ca.client, types.NodeName(node.Name), node.Spec.PodCIDRs)
 		if err != nil {
-			nodeutil.RecordNodeStatusChange(ca.recorder, node, "CIDRAssignmentFailed")
+			recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "CIDRAssignmentFailed")
 			klog.ErrorS(err, "Failed to update the node PodCIDR after multiple attempts", "nodeName", node.Name, "cidrStrings", node.Spec.PodCIDRs)
 			return err
 		}
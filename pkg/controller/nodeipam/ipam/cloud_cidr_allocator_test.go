@@ -30,6 +30,7 @@ import (
 	networkv1 "github.com/GoogleCloudPlatform/gke-networking-api/apis/network/v1"
 	clSetFake "github.com/GoogleCloudPlatform/gke-networking-api/client/network/clientset/versioned/fake"
 	networkinformers "github.com/GoogleCloudPlatform/gke-networking-api/client/network/informers/externalversions"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/api/compute/v1"
@@ -114,6 +115,7 @@ func TestUpdateCIDRAllocation(t *testing.T) {
 		nodeChanges     func(*v1.Node)
 		gceInstance     []*compute.Instance
 		stackType       *clusterStackType
+		podRanges       PodRangeSelection
 		expectErr       bool
 		expectErrMsg    string
 		expectedUpdate  bool
@@ -290,6 +292,84 @@ func TestUpdateCIDRAllocation(t *testing.T) {
 			},
 			expectedUpdate: true,
 		},
+		{
+			name: "dual stack node with several alias ranges, pinned pod range",
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+						},
+						Spec: v1.NodeSpec{
+							ProviderID: "gce://test-project/us-central1-b/test",
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			gceInstance: []*compute.Instance{
+				{
+					Name: "test",
+					NetworkInterfaces: []*compute.NetworkInterface{
+						{
+							Ipv6Address: "2001:db9::110",
+							AliasIpRanges: []*compute.AliasIpRange{
+								{IpCidrRange: "192.168.1.0/24", SubnetworkRangeName: "pods-a"},
+								{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: "pods-b"},
+							},
+						},
+					},
+				},
+			},
+			podRanges: PodRangeSelection{RangeName: "pods-b"},
+			nodeChanges: func(node *v1.Node) {
+				node.Spec.PodCIDR = "10.11.1.0/24"
+				node.Spec.PodCIDRs = []string{"10.11.1.0/24"}
+				node.Status.Conditions = []v1.NodeCondition{
+					{
+						Type:    "NetworkUnavailable",
+						Status:  "False",
+						Reason:  "RouteCreated",
+						Message: "NodeController create implicit route",
+					},
+				}
+			},
+			expectedUpdate: true,
+		},
+		{
+			name: "want error - dual stack node without the pinned pod range",
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+						},
+						Spec: v1.NodeSpec{
+							ProviderID: "gce://test-project/us-central1-b/test",
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			gceInstance: []*compute.Instance{
+				{
+					Name: "test",
+					NetworkInterfaces: []*compute.NetworkInterface{
+						{
+							Ipv6Address: "2001:db9::110",
+							AliasIpRanges: []*compute.AliasIpRange{
+								{IpCidrRange: "192.168.1.0/24", SubnetworkRangeName: "pods-a"},
+								{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: "pods-b"},
+							},
+						},
+					},
+				},
+			},
+			podRanges:    PodRangeSelection{RangeName: "pods-c"},
+			nodeChanges:  func(node *v1.Node) {},
+			expectErr:    true,
+			expectErrMsg: "failed to allocate cidr",
+		},
 		{
 			name: "empty dual stack node, IPv4IPv6 cluster",
 			fakeNodeHandler: &testutil.FakeNodeHandler{
@@ -633,6 +713,61 @@ func TestUpdateCIDRAllocation(t *testing.T) {
 			expectedUpdate:  true,
 			expectedMetrics: map[string]float64{},
 		},
+		{
+			name: "[mn] default network only, pinned pod range",
+			networks: []*networkv1.Network{
+				network(networkv1.DefaultPodNetworkName, defaultGKENetworkParamsName, false),
+			},
+			gkeNwParams: []*networkv1.GKENetworkParamSet{
+				gkeNetworkParams(defaultGKENetworkParamsName, defaultVPCName, defaultVPCSubnetName, []string{defaultSecondaryRangeA, defaultSecondaryRangeB}),
+			},
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+						},
+						Spec: v1.NodeSpec{
+							ProviderID: "gce://test-project/us-central1-b/test",
+						},
+						Status: v1.NodeStatus{
+							Capacity: v1.ResourceList{},
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			gceInstance: []*compute.Instance{
+				{
+					Name: "test",
+					NetworkInterfaces: []*compute.NetworkInterface{
+						interfaces(defaultVPCName, defaultVPCSubnetName, "80.1.172.1", []*compute.AliasIpRange{
+							{IpCidrRange: "192.168.1.0/24", SubnetworkRangeName: defaultSecondaryRangeA},
+							{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: defaultSecondaryRangeB},
+						}),
+					},
+				},
+			},
+			podRanges: PodRangeSelection{RangeName: defaultSecondaryRangeB},
+			nodeChanges: func(node *v1.Node) {
+				node.Spec.PodCIDR = "10.11.1.0/24"
+				node.Spec.PodCIDRs = []string{"10.11.1.0/24"}
+				node.Status.Conditions = []v1.NodeCondition{
+					{
+						Type:    "NetworkUnavailable",
+						Status:  "False",
+						Reason:  "RouteCreated",
+						Message: "NodeController create implicit route",
+					},
+				}
+				node.Annotations = map[string]string{
+					networkv1.NorthInterfacesAnnotationKey: "[]",
+					networkv1.MultiNetworkAnnotationKey:    "[]",
+				}
+			},
+			expectedUpdate:  true,
+			expectedMetrics: map[string]float64{},
+		},
 		{
 			name: "[mn] default network only, get PodCIDR with node labels",
 			networks: []*networkv1.Network{
@@ -691,6 +826,169 @@ func TestUpdateCIDRAllocation(t *testing.T) {
 			expectedUpdate:  true,
 			expectedMetrics: map[string]float64{},
 		},
+		{
+			name: "[mn] default network with an additional interface, dual stack node, IPv6IPv4 cluster",
+			networks: []*networkv1.Network{
+				network(networkv1.DefaultPodNetworkName, defaultGKENetworkParamsName, false),
+			},
+			gkeNwParams: []*networkv1.GKENetworkParamSet{
+				gkeNetworkParams(defaultGKENetworkParamsName, defaultVPCName, defaultVPCSubnetName, []string{defaultSecondaryRangeA, defaultSecondaryRangeB}),
+			},
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+						},
+						Spec: v1.NodeSpec{
+							ProviderID: "gce://test-project/us-central1-b/test",
+						},
+						Status: v1.NodeStatus{
+							Capacity: v1.ResourceList{},
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			gceInstance: []*compute.Instance{
+				{
+					Name: "test",
+					NetworkInterfaces: []*compute.NetworkInterface{
+						func() *compute.NetworkInterface {
+							inf := interfaces(defaultVPCName, defaultVPCSubnetName, "80.1.172.1", []*compute.AliasIpRange{
+								{IpCidrRange: "192.168.1.0/24", SubnetworkRangeName: defaultSecondaryRangeA},
+								{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: defaultSecondaryRangeB},
+							})
+							inf.Ipv6Address = "2001:db9::110"
+							return inf
+						}(),
+						interfaces(redVPCName, redVPCSubnetName, "10.1.1.1", nil),
+					},
+				},
+			},
+			stackType: &ipv6ipv4Stack,
+			nodeChanges: func(node *v1.Node) {
+				node.Spec.PodCIDR = "2001:db9::/112"
+				node.Spec.PodCIDRs = []string{"2001:db9::/112", "192.168.1.0/24"}
+				node.Status.Conditions = []v1.NodeCondition{
+					{
+						Type:    "NetworkUnavailable",
+						Status:  "False",
+						Reason:  "RouteCreated",
+						Message: "NodeController create implicit route",
+					},
+				}
+				node.Annotations = map[string]string{
+					networkv1.NorthInterfacesAnnotationKey: "[]",
+					networkv1.MultiNetworkAnnotationKey:    "[]",
+				}
+			},
+			expectedUpdate:  true,
+			expectedMetrics: map[string]float64{},
+		},
+		{
+			name: "[mn] default network with an additional interface, dual stack node, single stack ipv4 cluster",
+			networks: []*networkv1.Network{
+				network(networkv1.DefaultPodNetworkName, defaultGKENetworkParamsName, false),
+			},
+			gkeNwParams: []*networkv1.GKENetworkParamSet{
+				gkeNetworkParams(defaultGKENetworkParamsName, defaultVPCName, defaultVPCSubnetName, []string{defaultSecondaryRangeA, defaultSecondaryRangeB}),
+			},
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+						},
+						Spec: v1.NodeSpec{
+							ProviderID: "gce://test-project/us-central1-b/test",
+						},
+						Status: v1.NodeStatus{
+							Capacity: v1.ResourceList{},
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			gceInstance: []*compute.Instance{
+				{
+					Name: "test",
+					NetworkInterfaces: []*compute.NetworkInterface{
+						func() *compute.NetworkInterface {
+							inf := interfaces(defaultVPCName, defaultVPCSubnetName, "80.1.172.1", []*compute.AliasIpRange{
+								{IpCidrRange: "192.168.1.0/24", SubnetworkRangeName: defaultSecondaryRangeA},
+								{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: defaultSecondaryRangeB},
+							})
+							inf.Ipv6Address = "2001:db9::110"
+							return inf
+						}(),
+						interfaces(redVPCName, redVPCSubnetName, "10.1.1.1", nil),
+					},
+				},
+			},
+			nodeChanges: func(node *v1.Node) {
+				node.Spec.PodCIDR = "192.168.1.0/24"
+				node.Spec.PodCIDRs = []string{"192.168.1.0/24"}
+				node.Status.Conditions = []v1.NodeCondition{
+					{
+						Type:    "NetworkUnavailable",
+						Status:  "False",
+						Reason:  "RouteCreated",
+						Message: "NodeController create implicit route",
+					},
+				}
+				node.Annotations = map[string]string{
+					networkv1.NorthInterfacesAnnotationKey: "[]",
+					networkv1.MultiNetworkAnnotationKey:    "[]",
+				}
+			},
+			expectedUpdate:  true,
+			expectedMetrics: map[string]float64{},
+		},
+		{
+			name: "[mn] want error - default network with an additional interface, single stack node, IPv4IPv6 cluster",
+			networks: []*networkv1.Network{
+				network(networkv1.DefaultPodNetworkName, defaultGKENetworkParamsName, false),
+			},
+			gkeNwParams: []*networkv1.GKENetworkParamSet{
+				gkeNetworkParams(defaultGKENetworkParamsName, defaultVPCName, defaultVPCSubnetName, []string{defaultSecondaryRangeA, defaultSecondaryRangeB}),
+			},
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+						},
+						Spec: v1.NodeSpec{
+							ProviderID: "gce://test-project/us-central1-b/test",
+						},
+						Status: v1.NodeStatus{
+							Capacity: v1.ResourceList{},
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			gceInstance: []*compute.Instance{
+				{
+					Name: "test",
+					NetworkInterfaces: []*compute.NetworkInterface{
+						func() *compute.NetworkInterface {
+							inf := interfaces(defaultVPCName, defaultVPCSubnetName, "80.1.172.1", []*compute.AliasIpRange{
+								{IpCidrRange: "192.168.1.0/24", SubnetworkRangeName: defaultSecondaryRangeA},
+								{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: defaultSecondaryRangeB},
+							})
+							return inf
+						}(),
+						interfaces(redVPCName, redVPCSubnetName, "10.1.1.1", nil),
+					},
+				},
+			},
+			stackType:    &ipv4ipv6Stack,
+			nodeChanges:  func(node *v1.Node) {},
+			expectErr:    true,
+			expectErrMsg: "failed to allocate cidr",
+		},
 		{
 			name: "[mn] one additional network along with default network",
 			networks: []*networkv1.Network{
@@ -755,6 +1053,71 @@ func TestUpdateCIDRAllocation(t *testing.T) {
 				redNetworkName: float64(1),
 			},
 		},
+		{
+			name: "[mn] one additional network with multiple pod ranges along with default network",
+			networks: []*networkv1.Network{
+				network(networkv1.DefaultPodNetworkName, defaultGKENetworkParamsName, true),
+				network(redNetworkName, redGKENetworkParamsName, true),
+			},
+			gkeNwParams: []*networkv1.GKENetworkParamSet{
+				gkeNetworkParams(defaultGKENetworkParamsName, defaultVPCName, defaultVPCSubnetName, []string{defaultSecondaryRangeA, defaultSecondaryRangeB}),
+				gkeNetworkParams(redGKENetworkParamsName, redVPCName, redVPCSubnetName, []string{redSecondaryRangeA, redSecondaryRangeB}),
+			},
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+							Annotations: map[string]string{
+								networkv1.NodeNetworkAnnotationKey: fmt.Sprintf("[{\"name\":\"%s\"},{\"name\":\"%s\"}]", networkv1.DefaultPodNetworkName, redNetworkName),
+							},
+						},
+						Spec: v1.NodeSpec{
+							ProviderID: "gce://test-project/us-central1-b/test",
+						},
+						Status: v1.NodeStatus{
+							Capacity: v1.ResourceList{},
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			gceInstance: []*compute.Instance{
+				{
+					Name: "test",
+					NetworkInterfaces: []*compute.NetworkInterface{
+						interfaces(defaultVPCName, defaultVPCSubnetName, "80.1.172.1", []*compute.AliasIpRange{
+							{IpCidrRange: "192.168.1.0/24", SubnetworkRangeName: defaultSecondaryRangeA},
+						}),
+						interfaces(redVPCName, redVPCSubnetName, "10.1.1.1", []*compute.AliasIpRange{
+							{IpCidrRange: "172.11.1.0/24", SubnetworkRangeName: redSecondaryRangeA},
+							{IpCidrRange: "172.12.1.0/28", SubnetworkRangeName: redSecondaryRangeB},
+						}),
+					},
+				},
+			},
+			nodeChanges: func(node *v1.Node) {
+				node.Spec.PodCIDR = "192.168.1.0/24"
+				node.Spec.PodCIDRs = []string{"192.168.1.0/24"}
+				node.Status.Conditions = []v1.NodeCondition{
+					{
+						Type:    "NetworkUnavailable",
+						Status:  "False",
+						Reason:  "RouteCreated",
+						Message: "NodeController create implicit route",
+					},
+				}
+				node.Annotations[networkv1.NorthInterfacesAnnotationKey] = fmt.Sprintf("[{\"network\":\"%s\",\"ipAddress\":\"10.1.1.1\"}]", redNetworkName)
+				node.Annotations[networkv1.MultiNetworkAnnotationKey] = fmt.Sprintf("[{\"name\":\"%s\",\"cidrs\":[\"172.11.1.0/24\",\"172.12.1.0/28\"],\"scope\":\"host-local\"}]", redNetworkName)
+				node.Status.Capacity = map[v1.ResourceName]resource.Quantity{
+					"networking.gke.io.networks/Red-Network.IP": *resource.NewQuantity(136, resource.DecimalSI),
+				}
+			},
+			expectedUpdate: true,
+			expectedMetrics: map[string]float64{
+				redNetworkName: float64(1),
+			},
+		},
 		{
 			name: "[mn] one additional network (PSC aka network attachment) along with default network",
 			networks: []*networkv1.Network{
@@ -1878,10 +2241,11 @@ func TestUpdateCIDRAllocation(t *testing.T) {
 				networksLister: nwInformer.Lister(),
 				gnpLister:      gnpInformer.Lister(),
 				stackType:      stackType,
+				podRanges:      tc.podRanges,
 			}
 
 			// test
-			if err := ca.updateCIDRAllocation("test"); err != nil {
+			if err := ca.updateCIDRAllocation(context.Background(), "test"); err != nil {
 				if tc.expectErr {
 					if tc.expectErrMsg != "" && !strings.Contains(err.Error(), tc.expectErrMsg) {
 						t.Fatalf("received unexpected error message:\nwant: %s\ngot: %v", tc.expectErrMsg, err)
@@ -1982,6 +2346,83 @@ func interfacesWithNetworkAttachment(network, networkAttachment, networkIP strin
 	}
 }
 
+func TestInstanceByProviderIDPrefetched(t *testing.T) {
+	testClusterValues := gce.DefaultTestClusterValues()
+	fakeGCE := gce.NewFakeGCECloud(testClusterValues)
+	providerID := fmt.Sprintf("gce://%s/%s/node0", testClusterValues.ProjectID, testClusterValues.ZoneName)
+	ca := &cloudCIDRAllocator{cloud: fakeGCE}
+
+	// The prefetched instance answers the first lookup only.
+	prefetched := &compute.Instance{Name: "node0"}
+	ca.prefetchedInstances = map[string]*compute.Instance{providerID: prefetched}
+	ca.prefetchedAt = time.Now()
+	if got, err := ca.instanceByProviderID(context.Background(), providerID); err != nil || got != prefetched {
+		t.Errorf("instanceByProviderID() = %v, %v, want the prefetched instance", got, err)
+	}
+	if _, err := ca.instanceByProviderID(context.Background(), providerID); err == nil {
+		t.Errorf("instanceByProviderID() of an instance taken from the prefetched ones and missing from GCE succeeded, want error")
+	}
+
+	// The stale prefetched instances are dropped.
+	ca.prefetchedInstances = map[string]*compute.Instance{providerID: prefetched}
+	ca.prefetchedAt = time.Now().Add(-instancePrefetchTTL)
+	if _, err := ca.instanceByProviderID(context.Background(), providerID); err == nil {
+		t.Errorf("instanceByProviderID() of a stale prefetched instance missing from GCE succeeded, want error")
+	}
+	if ca.prefetchedInstances != nil {
+		t.Errorf("got prefetched instances %v once stale, want none", ca.prefetchedInstances)
+	}
+
+	// The instances which weren't prefetched are looked up.
+	if err := fakeGCE.Compute().Instances().Insert(context.Background(), meta.ZonalKey("node0", testClusterValues.ZoneName), &compute.Instance{Name: "node0"}); err != nil {
+		t.Fatalf("Insert() = %v", err)
+	}
+	if got, err := ca.instanceByProviderID(context.Background(), providerID); err != nil || got.Name != "node0" {
+		t.Errorf("instanceByProviderID() = %v, %v, want instance node0", got, err)
+	}
+
+	// The instances are looked up with the context of the allocation, e.g.
+	// to trace the lookup as part of its span.
+	type ctxKey struct{}
+	var gotValue interface{}
+	fakeGCE.Compute().(*cloud.MockGCE).MockInstances.GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockInstances, options ...cloud.Option) (bool, *compute.Instance, error) {
+		gotValue = ctx.Value(ctxKey{})
+		return false, nil, nil
+	}
+	if _, err := ca.instanceByProviderID(context.WithValue(context.Background(), ctxKey{}, "allocation"), providerID); err != nil {
+		t.Errorf("instanceByProviderID() = %v", err)
+	}
+	if gotValue != "allocation" {
+		t.Errorf("instance looked up with context value %v, want the one of the allocation", gotValue)
+	}
+}
+
+func TestStackTypeOf(t *testing.T) {
+	parse := func(cidr string) *net.IPNet {
+		_, n, _ := net.ParseCIDR(cidr)
+		return n
+	}
+	testCases := []struct {
+		desc   string
+		params CIDRAllocatorParams
+		want   clusterStackType
+	}{
+		{desc: "no service CIDR", want: stackIPv4},
+		{desc: "IPv4 service CIDR", params: CIDRAllocatorParams{ServiceCIDR: parse("10.0.0.0/16")}, want: stackIPv4},
+		{desc: "IPv4 and IPv6 service CIDRs", params: CIDRAllocatorParams{ServiceCIDR: parse("10.0.0.0/16"), SecondaryServiceCIDR: parse("2001:db8::/112")}, want: stackIPv4IPv6},
+		{desc: "IPv6 and IPv4 service CIDRs", params: CIDRAllocatorParams{ServiceCIDR: parse("2001:db8::/112"), SecondaryServiceCIDR: parse("10.0.0.0/16")}, want: stackIPv6IPv4},
+		{desc: "IPv6 service CIDR", params: CIDRAllocatorParams{ServiceCIDR: parse("2001:db8::/112")}, want: stackIPv6},
+		{desc: "IPv6-only without service CIDR", params: CIDRAllocatorParams{IPv6Only: true}, want: stackIPv6},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := stackTypeOf(tc.params); got != tc.want {
+				t.Errorf("stackTypeOf() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestIsIP4_net_nil(t *testing.T) {
 	if isIP4(nil) != false {
 		t.Fatalf("isIP4(nil) = true, want false")
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	netutils "k8s.io/utils/net"
+)
+
+// ClusterCIDRBlock is an additional block of the cluster CIDR of its IP
+// family, which the range allocator allocates node CIDRs from once the
+// cluster CIDR and the blocks before it are exhausted.
+type ClusterCIDRBlock struct {
+	CIDR *net.IPNet
+	// NodeCIDRMaskSize is the mask size of the node CIDRs of the block, the
+	// one of the cluster CIDR of its IP family if 0.
+	NodeCIDRMaskSize int
+}
+
+// ParseClusterCIDRBlocks returns the ClusterCIDRBlocks of the values,
+// formatted as CIDR[:NODE_CIDR_MASK_SIZE], e.g. 10.100.0.0/16:25.
+func ParseClusterCIDRBlocks(values []string) ([]ClusterCIDRBlock, error) {
+	var blocks []ClusterCIDRBlock
+	for _, v := range values {
+		// The mask size of the CIDR has no colons, unlike its IPv6 address.
+		cidr, maskSize := v, ""
+		if slash := strings.LastIndex(v, "/"); slash >= 0 {
+			if i := strings.Index(v[slash:], ":"); i >= 0 {
+				cidr, maskSize = v[:slash+i], v[slash+i+1:]
+			}
+		}
+		_, block, err := netutils.ParseCIDRSloppy(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster CIDR block %q: %v", v, err)
+		}
+		b := ClusterCIDRBlock{CIDR: block}
+		if maskSize != "" {
+			b.NodeCIDRMaskSize, err = strconv.Atoi(maskSize)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cluster CIDR block %q: invalid node CIDR mask size %q", v, maskSize)
+			}
+			ones, bits := block.Mask.Size()
+			if b.NodeCIDRMaskSize < ones || b.NodeCIDRMaskSize > bits {
+				return nil, fmt.Errorf("invalid cluster CIDR block %q: node CIDR mask size %d not in [%d, %d]", v, b.NodeCIDRMaskSize, ones, bits)
+			}
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// cidrsOverlap tells whether the CIDRs have addresses in common.
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
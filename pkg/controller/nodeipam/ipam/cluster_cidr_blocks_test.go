@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseClusterCIDRBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		value        string
+		wantCIDR     string
+		wantMaskSize int
+		wantErr      bool
+	}{
+		{desc: "IPv4", value: "10.100.0.0/16", wantCIDR: "10.100.0.0/16"},
+		{desc: "IPv4 with mask size", value: "10.100.0.0/16:25", wantCIDR: "10.100.0.0/16", wantMaskSize: 25},
+		{desc: "IPv6", value: "fd00:1::/48", wantCIDR: "fd00:1::/48"},
+		{desc: "IPv6 with mask size", value: "fd00:1::/48:64", wantCIDR: "fd00:1::/48", wantMaskSize: 64},
+		{desc: "invalid CIDR", value: "10.100.0.0", wantErr: true},
+		{desc: "invalid mask size", value: "10.100.0.0/16:x", wantErr: true},
+		{desc: "mask size smaller than the block", value: "10.100.0.0/16:15", wantErr: true},
+		{desc: "mask size too big", value: "10.100.0.0/16:33", wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			blocks, err := ParseClusterCIDRBlocks([]string{tc.value})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ParseClusterCIDRBlocks(%q) = %v, want error %t", tc.value, err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := blocks[0].CIDR.String(); got != tc.wantCIDR {
+				t.Errorf("got CIDR %s, want %s", got, tc.wantCIDR)
+			}
+			if got := blocks[0].NodeCIDRMaskSize; got != tc.wantMaskSize {
+				t.Errorf("got node CIDR mask size %d, want %d", got, tc.wantMaskSize)
+			}
+		})
+	}
+}
+
+func TestNewAdditionalCIDRSets(t *testing.T) {
+	parse := func(cidr string) *net.IPNet {
+		_, n, _ := net.ParseCIDR(cidr)
+		return n
+	}
+	clusterCIDRs := []*net.IPNet{parse("10.0.0.0/16"), parse("fd00::/48")}
+	for _, tc := range []struct {
+		desc    string
+		blocks  []ClusterCIDRBlock
+		want    []int
+		wantErr bool
+	}{
+		{desc: "none", want: []int{0, 0}},
+		{desc: "both families", blocks: []ClusterCIDRBlock{{CIDR: parse("fd01::/48")}, {CIDR: parse("10.1.0.0/16")}, {CIDR: parse("10.2.0.0/16"), NodeCIDRMaskSize: 26}}, want: []int{2, 1}},
+		{desc: "overlapping the cluster CIDR", blocks: []ClusterCIDRBlock{{CIDR: parse("10.0.128.0/17")}}, wantErr: true},
+		{desc: "overlapping another block", blocks: []ClusterCIDRBlock{{CIDR: parse("10.1.0.0/16")}, {CIDR: parse("10.0.0.0/8")}}, wantErr: true},
+		{desc: "smaller than its node CIDRs", blocks: []ClusterCIDRBlock{{CIDR: parse("10.1.0.0/25")}}, wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := newAdditionalCIDRSets(CIDRAllocatorParams{
+				ClusterCIDRs:           clusterCIDRs,
+				NodeCIDRMaskSizes:      []int{24, 64},
+				AdditionalClusterCIDRs: tc.blocks,
+			})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("newAdditionalCIDRSets() = %v, want error %t", err, tc.wantErr)
+			}
+			for idx, want := range tc.want {
+				if len(got[idx]) != want {
+					t.Errorf("got %d blocks of cluster CIDR %v, want %d", len(got[idx]), clusterCIDRs[idx], want)
+				}
+			}
+		})
+	}
+
+	_, err := newAdditionalCIDRSets(CIDRAllocatorParams{
+		ClusterCIDRs:           clusterCIDRs[:1],
+		NodeCIDRMaskSizes:      []int{24},
+		AdditionalClusterCIDRs: []ClusterCIDRBlock{{CIDR: parse("fd01::/48")}},
+	})
+	if err == nil {
+		t.Errorf("newAdditionalCIDRSets() of a block without cluster CIDR of its IP family succeeded, want error")
+	}
+}
@@ -0,0 +1,342 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	informers "k8s.io/client-go/informers/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/cloud-provider-gcp/pkg/controllermetrics"
+	nodeutil "k8s.io/cloud-provider-gcp/pkg/util"
+	utilnode "k8s.io/cloud-provider-gcp/pkg/util/node"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+)
+
+const (
+	externalWorkqueueName        = "externalCIDRAllocator"
+	externalReleaseWorkqueueName = "externalCIDRAllocatorRelease"
+)
+
+// defaultExternalIPAMTimeout bounds the requests to the external IPAM
+// service if CIDRAllocatorParams.ExternalIPAMTimeout is 0.
+const defaultExternalIPAMTimeout = 10 * time.Second
+
+// externalCIDRAllocator allocates node CIDRs chosen by an external IPAM
+// service, e.g. the centralized IP management system of an organization, and
+// enforces them onto the alias IP ranges of the instances of the nodes. The
+// external service owns the allocations: the pod CIDRs of the nodes are only
+// released to it along with their nodes, through a queue retrying the failed
+// releases.
+type externalCIDRAllocator struct {
+	client clientset.Interface
+	cloud  *gce.Cloud
+	ipam   externalIPAMService
+	// nodeLister is able to list/get nodes and is populated by the shared informer passed to
+	// NewExternalCIDRAllocator.
+	nodeLister corelisters.NodeLister
+	// nodesSynced returns true if the node shared informer has been synced at least once.
+	nodesSynced cache.InformerSynced
+
+	recorder record.EventRecorder
+	queue    workqueue.RateLimitingInterface
+	// releaseQueue holds the *ExternalIPAMRequests releasing the pod CIDRs
+	// of the deleted nodes.
+	releaseQueue workqueue.RateLimitingInterface
+}
+
+var _ CIDRAllocator = (*externalCIDRAllocator)(nil)
+
+// NewExternalCIDRAllocator creates a new external CIDR allocator.
+func NewExternalCIDRAllocator(client clientset.Interface, cloud cloudprovider.Interface, nodeInformer informers.NodeInformer, allocatorParams CIDRAllocatorParams) (CIDRAllocator, error) {
+	if client == nil {
+		klog.Fatalf("kubeClient is nil when starting NodeController")
+	}
+	gceCloud, ok := cloud.(*gce.Cloud)
+	if !ok {
+		return nil, fmt.Errorf("externalCIDRAllocator does not support %v provider", cloud.ProviderName())
+	}
+	if allocatorParams.ExternalIPAMURL == "" {
+		return nil, fmt.Errorf("the URL of the external IPAM service is required by the %s", ExternalAllocatorType)
+	}
+	ipamService, err := newExternalIPAMService(allocatorParams)
+	if err != nil {
+		return nil, err
+	}
+
+	eventBroadcaster := record.NewBroadcaster()
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "cidrAllocator"})
+	eventBroadcaster.StartStructuredLogging(0)
+	klog.V(0).Infof("Sending events to api server.")
+	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	ea := &externalCIDRAllocator{
+		client:       client,
+		cloud:        gceCloud,
+		ipam:         ipamService,
+		nodeLister:   nodeInformer.Lister(),
+		nodesSynced:  nodeInformer.Informer().HasSynced,
+		recorder:     recorder,
+		queue:        workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: externalWorkqueueName}),
+		releaseQueue: workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: externalReleaseWorkqueueName}),
+	}
+
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: nodeutil.CreateAddNodeHandler(ea.AllocateOrOccupyCIDR),
+		UpdateFunc: nodeutil.CreateUpdateNodeHandler(func(_, newNode *v1.Node) error {
+			return ea.AllocateOrOccupyCIDR(newNode)
+		}),
+		DeleteFunc: nodeutil.CreateDeleteNodeHandler(ea.ReleaseCIDR),
+	})
+	registerAllocationMetrics()
+
+	klog.V(0).Infof("Using external CIDR allocator (service: %v)", allocatorParams.ExternalIPAMURL)
+	return ea, nil
+}
+
+func (ea *externalCIDRAllocator) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+	defer ea.queue.ShutDown()
+	defer ea.releaseQueue.ShutDown()
+
+	klog.Infof("Starting external CIDR allocator")
+	defer klog.Infof("Shutting down external CIDR allocator")
+
+	if !cache.WaitForNamedCacheSync("cidrallocator", stopCh, ea.nodesSynced) {
+		return
+	}
+	for i := 0; i < cidrUpdateWorkers; i++ {
+		go wait.UntilWithContext(ctx, ea.runWorker, time.Second)
+	}
+	go wait.UntilWithContext(ctx, ea.runReleaseWorker, time.Second)
+
+	<-stopCh
+}
+
+// AllocateOrOccupyCIDR queues the node for allocation unless it already has
+// its pod CIDRs, which the external IPAM service accounts for.
+func (ea *externalCIDRAllocator) AllocateOrOccupyCIDR(node *v1.Node) error {
+	if node == nil || node.Spec.PodCIDR != "" {
+		return nil
+	}
+	klog.V(4).Infof("Putting node %s into the work queue", node.Name)
+	ea.queue.Add(node.Name)
+	return nil
+}
+
+// ReleaseCIDR queues the release of the pod CIDRs of the deleted node to the
+// external IPAM service. The alias IP ranges are released by GCE along with
+// the instance.
+func (ea *externalCIDRAllocator) ReleaseCIDR(node *v1.Node) error {
+	if node == nil || len(node.Spec.PodCIDRs) == 0 {
+		return nil
+	}
+	klog.V(4).Infof("Putting the release of node %s into the work queue", node.Name)
+	ea.releaseQueue.Add(externalIPAMRequest(node))
+	return nil
+}
+
+func (ea *externalCIDRAllocator) runReleaseWorker(ctx context.Context) {
+	for ea.processNextRelease(ctx) {
+	}
+}
+
+func (ea *externalCIDRAllocator) processNextRelease(ctx context.Context) bool {
+	item, quit := ea.releaseQueue.Get()
+	if quit {
+		return false
+	}
+	defer ea.releaseQueue.Done(item)
+
+	req := item.(*ExternalIPAMRequest)
+	err := ea.ipam.release(ctx, req)
+	if err == nil {
+		ea.releaseQueue.Forget(item)
+		return true
+	}
+	klog.Errorf("Error releasing the pod CIDRs %v of node %q: %v", req.PodCIDRs, req.Node, err)
+	if ea.releaseQueue.NumRequeues(item) < updateMaxRetries {
+		ea.releaseQueue.AddRateLimited(item)
+		return true
+	}
+	ea.releaseQueue.Forget(item)
+	utilruntime.HandleError(err)
+	klog.Errorf("Exceeded retry count releasing the pod CIDRs %v of node %q, dropping from queue", req.PodCIDRs, req.Node)
+	controllermetrics.WorkqueueDroppedObjects.WithLabelValues(externalReleaseWorkqueueName).Inc()
+	return true
+}
+
+func (ea *externalCIDRAllocator) runWorker(ctx context.Context) {
+	for ea.processNextItem(ctx) {
+	}
+}
+
+func (ea *externalCIDRAllocator) processNextItem(ctx context.Context) bool {
+	key, quit := ea.queue.Get()
+	if quit {
+		return false
+	}
+	defer ea.queue.Done(key)
+
+	start := time.Now()
+	err := ea.updateCIDRAllocation(ctx, key.(string))
+	if err == nil {
+		observeAllocation(ExternalAllocatorType, start)
+		ea.queue.Forget(key)
+		return true
+	}
+	klog.Errorf("Error updating CIDR for %q: %v", key, err)
+	if ea.queue.NumRequeues(key) < updateMaxRetries {
+		ea.queue.AddRateLimited(key)
+		return true
+	}
+	ea.queue.Forget(key)
+	utilruntime.HandleError(err)
+	klog.Errorf("Exceeded retry count for %q, dropping from queue", key)
+	controllermetrics.WorkqueueDroppedObjects.WithLabelValues(externalWorkqueueName).Inc()
+	return true
+}
+
+// updateCIDRAllocation asks the external IPAM service for the pod CIDRs of
+// the node, adds the IPv4 one to the alias IP ranges of its instance and sets
+// them on the node.
+func (ea *externalCIDRAllocator) updateCIDRAllocation(ctx context.Context, nodeName string) error {
+	node, err := ea.nodeLister.Get(nodeName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil // node no longer available, skip processing
+		}
+		return err
+	}
+	if node.Spec.PodCIDR != "" {
+		return nil
+	}
+	if node.Spec.ProviderID == "" {
+		return fmt.Errorf("node %s doesn't have providerID", nodeName)
+	}
+
+	resp, err := ea.ipam.allocate(ctx, externalIPAMRequest(node))
+	if err != nil {
+		recordAllocationFailure(ea.recorder, node, ExternalAllocatorType, "CIDRNotAvailable")
+		return err
+	}
+	cidrs, err := netutils.ParseCIDRs(resp.PodCIDRs)
+	if err != nil || len(cidrs) == 0 || len(cidrs) > 2 {
+		recordAllocationFailure(ea.recorder, node, ExternalAllocatorType, "CIDRNotAvailable")
+		return fmt.Errorf("invalid pod CIDRs %v of node %s returned by the external IPAM service: %v", resp.PodCIDRs, nodeName, err)
+	}
+	if len(cidrs) > 1 {
+		if dualStack, _ := netutils.IsDualStackCIDRs(cidrs); !dualStack {
+			recordAllocationFailure(ea.recorder, node, ExternalAllocatorType, "CIDRNotAvailable")
+			return fmt.Errorf("pod CIDRs %v of node %s returned by the external IPAM service are not dual stack", resp.PodCIDRs, nodeName)
+		}
+	}
+
+	podCIDRs := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		podCIDRs = append(podCIDRs, cidr.String())
+	}
+	if err := ea.enforceAliasRanges(node, podCIDRs, resp.RangeName); err != nil {
+		recordAllocationFailure(ea.recorder, node, ExternalAllocatorType, "CIDRAssignmentFailed")
+		return err
+	}
+	if err := utilnode.PatchNodeCIDRs(ea.client, types.NodeName(nodeName), podCIDRs); err != nil {
+		recordAllocationFailure(ea.recorder, node, ExternalAllocatorType, "CIDRAssignmentFailed")
+		return err
+	}
+	klog.InfoS("Set the node PodCIDRs", "nodeName", nodeName, "cidrStrings", podCIDRs)
+	return utilnode.SetNodeCondition(ea.client, types.NodeName(nodeName), v1.NodeCondition{
+		Type:               v1.NodeNetworkUnavailable,
+		Status:             v1.ConditionFalse,
+		Reason:             "RouteCreated",
+		Message:            "NodeController create implicit route",
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// enforceAliasRanges adds the IPv4 pod CIDR to the alias IP ranges of the
+// instance of the node from the named secondary range, unless it is already
+// there, and checks that the IPv6 one is the range of its interface, which GCE
+// assigns.
+func (ea *externalCIDRAllocator) enforceAliasRanges(node *v1.Node, podCIDRs []string, rangeName string) error {
+	instance, err := ea.cloud.InstanceByProviderID(node.Spec.ProviderID)
+	if err != nil {
+		return fmt.Errorf("failed to get instance from provider: %v", err)
+	}
+	if len(instance.NetworkInterfaces) == 0 {
+		return fmt.Errorf("instance of node %s has no network interfaces", node.Name)
+	}
+	nic := instance.NetworkInterfaces[0]
+
+	ipv4CIDR, ipv6CIDR := splitCIDRFamilies(podCIDRs)
+	if ipv6CIDR != "" {
+		if addr := ea.cloud.GetIPV6Address(nic); addr == nil || addr.String() != ipv6CIDR {
+			return fmt.Errorf("IPv6 pod CIDR %s of node %s returned by the external IPAM service is not the range %v of its interface", ipv6CIDR, node.Name, addr)
+		}
+	}
+	if ipv4CIDR == "" {
+		return nil
+	}
+	var aliases []string
+	for _, r := range nic.AliasIpRanges {
+		if r.IpCidrRange == ipv4CIDR {
+			return nil
+		}
+		aliases = append(aliases, r.IpCidrRange)
+	}
+	// Adding the alias replaces the existing ones of the interface.
+	if len(aliases) > 0 {
+		return fmt.Errorf("instance of node %s has alias IP ranges %v instead of the pod CIDR %s returned by the external IPAM service", node.Name, aliases, ipv4CIDR)
+	}
+	_, alias, _ := netutils.ParseCIDRSloppy(ipv4CIDR)
+	if rangeName == "" {
+		rangeName = ea.cloud.SecondaryRangeName()
+	}
+	klog.InfoS("Adding the pod CIDR to the alias IP ranges of the node", "nodeName", node.Name, "cidr", ipv4CIDR, "rangeName", rangeName)
+	return ea.cloud.AddAliasFromRangeToInstanceByProviderID(node.Spec.ProviderID, alias, rangeName)
+}
+
+// externalIPAMRequest returns the request of the node to the external IPAM
+// service.
+func externalIPAMRequest(node *v1.Node) *ExternalIPAMRequest {
+	return &ExternalIPAMRequest{
+		Node:       node.Name,
+		ProviderID: node.Spec.ProviderID,
+		Labels:     node.Labels,
+		PodCIDRs:   node.Spec.PodCIDRs,
+	}
+}
@@ -0,0 +1,330 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/cloud-provider-gcp/pkg/controller/testutil"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+)
+
+func TestExternalUpdateCIDRAllocation(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		status       int
+		resp         ExternalIPAMResponse
+		aliases      []*compute.AliasIpRange
+		wantPodCIDRs []string
+		wantAlias    string
+		wantErr      bool
+	}{
+		{
+			desc:         "alias added",
+			status:       http.StatusOK,
+			resp:         ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0/24"}, RangeName: "pods"},
+			wantPodCIDRs: []string{"10.8.0.0/24"},
+			wantAlias:    "10.8.0.0/24 pods",
+		},
+		{
+			desc:         "alias already there",
+			status:       http.StatusOK,
+			resp:         ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0/24"}},
+			aliases:      []*compute.AliasIpRange{{IpCidrRange: "10.8.0.0/24", SubnetworkRangeName: "pods"}},
+			wantPodCIDRs: []string{"10.8.0.0/24"},
+		},
+		{
+			desc:    "other alias",
+			status:  http.StatusOK,
+			resp:    ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0/24"}},
+			aliases: []*compute.AliasIpRange{{IpCidrRange: "10.9.0.0/24", SubnetworkRangeName: "pods"}},
+			wantErr: true,
+		},
+		{
+			desc:    "IPv6 pod CIDR not of the interface",
+			status:  http.StatusOK,
+			resp:    ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0/24", "2001:db8::/112"}},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid pod CIDR",
+			status:  http.StatusOK,
+			resp:    ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0"}},
+			wantErr: true,
+		},
+		{
+			desc:    "service error",
+			status:  http.StatusServiceUnavailable,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var gotReq ExternalIPAMRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				w.WriteHeader(tc.status)
+				json.NewEncoder(w).Encode(tc.resp)
+			}))
+			defer server.Close()
+
+			ctx := context.Background()
+			testClusterValues := gce.DefaultTestClusterValues()
+			fakeGCE := gce.NewFakeGCECloud(testClusterValues)
+			if err := fakeGCE.Compute().Instances().Insert(ctx, meta.ZonalKey("test", testClusterValues.ZoneName), &compute.Instance{
+				Name:              "test",
+				Zone:              testClusterValues.ZoneName,
+				NetworkInterfaces: []*compute.NetworkInterface{{Name: "nic0", AliasIpRanges: tc.aliases}},
+			}); err != nil {
+				t.Fatalf("error setting up the test for fakeGCE: %v", err)
+			}
+			var gotAlias string
+			fakeGCE.Compute().(*cloud.MockGCE).MockBetaInstances.UpdateNetworkInterfaceHook = func(_ context.Context, _ *meta.Key, _ string, iface *computebeta.NetworkInterface, _ *cloud.MockBetaInstances, _ ...cloud.Option) error {
+				gotAlias = iface.AliasIpRanges[0].IpCidrRange + " " + iface.AliasIpRanges[0].SubnetworkRangeName
+				return nil
+			}
+
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"pool": "a"}},
+				Spec:       v1.NodeSpec{ProviderID: "gce://test-project/us-central1-b/test"},
+			}
+			fakeNodeHandler := &testutil.FakeNodeHandler{Existing: []*v1.Node{node}, Clientset: fake.NewSimpleClientset()}
+			ea := &externalCIDRAllocator{
+				client:     fakeNodeHandler,
+				cloud:      fakeGCE,
+				ipam:       &externalIPAMClient{url: server.URL, client: server.Client()},
+				nodeLister: getFakeNodeInformer(fakeNodeHandler).Lister(),
+				recorder:   testutil.NewFakeRecorder(),
+			}
+			err := ea.updateCIDRAllocation(ctx, "test")
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("updateCIDRAllocation() = %v, want error %t", err, tc.wantErr)
+			}
+
+			wantReq := ExternalIPAMRequest{Operation: ExternalIPAMAllocate, Node: "test", ProviderID: node.Spec.ProviderID, Labels: node.Labels}
+			if !reflect.DeepEqual(gotReq, wantReq) {
+				t.Errorf("got request %+v, want %+v", gotReq, wantReq)
+			}
+			if gotAlias != tc.wantAlias {
+				t.Errorf("got alias %q, want %q", gotAlias, tc.wantAlias)
+			}
+			var gotPodCIDRs []string
+			if updated := fakeNodeHandler.GetUpdatedNodesCopy(); len(updated) > 0 {
+				gotPodCIDRs = updated[0].Spec.PodCIDRs
+			}
+			if !reflect.DeepEqual(gotPodCIDRs, tc.wantPodCIDRs) {
+				t.Errorf("got pod CIDRs %v, want %v", gotPodCIDRs, tc.wantPodCIDRs)
+			}
+		})
+	}
+}
+
+func TestExternalReleaseCIDR(t *testing.T) {
+	var gotReqs []ExternalIPAMRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ExternalIPAMRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		gotReqs = append(gotReqs, req)
+		if len(gotReqs) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	ea := &externalCIDRAllocator{
+		ipam:         &externalIPAMClient{url: server.URL, client: server.Client()},
+		releaseQueue: workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(0, 0, 0)),
+	}
+	defer ea.releaseQueue.ShutDown()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec:       v1.NodeSpec{ProviderID: "gce://test-project/us-central1-b/test", PodCIDR: "10.8.0.0/24", PodCIDRs: []string{"10.8.0.0/24"}},
+	}
+	if err := ea.ReleaseCIDR(node); err != nil {
+		t.Fatalf("ReleaseCIDR() = %v", err)
+	}
+	if len(gotReqs) != 0 {
+		t.Fatalf("got requests %+v before processing the queue", gotReqs)
+	}
+
+	// The failed release is retried.
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		ea.processNextRelease(ctx)
+	}
+	wantReq := ExternalIPAMRequest{Operation: ExternalIPAMRelease, Node: "test", ProviderID: node.Spec.ProviderID, PodCIDRs: node.Spec.PodCIDRs}
+	if want := []ExternalIPAMRequest{wantReq, wantReq}; !reflect.DeepEqual(gotReqs, want) {
+		t.Errorf("got requests %+v, want %+v", gotReqs, want)
+	}
+	if n := ea.releaseQueue.Len(); n != 0 {
+		t.Errorf("got %d releases queued, want 0", n)
+	}
+}
+
+func TestExternalIPAMServiceHTTPS(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0/24"}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	svc, err := newExternalIPAMService(CIDRAllocatorParams{ExternalIPAMURL: server.URL, ExternalIPAMCAFile: caFile, ExternalIPAMTokenFile: tokenFile})
+	if err != nil {
+		t.Fatalf("newExternalIPAMService() = %v", err)
+	}
+	resp, err := svc.allocate(context.Background(), &ExternalIPAMRequest{Node: "test"})
+	if err != nil {
+		t.Fatalf("allocate() = %v", err)
+	}
+	if want := []string{"10.8.0.0/24"}; !reflect.DeepEqual(resp.PodCIDRs, want) {
+		t.Errorf("got pod CIDRs %v, want %v", resp.PodCIDRs, want)
+	}
+	if want := "Bearer secret"; gotAuth != want {
+		t.Errorf("got authorization %q, want %q", gotAuth, want)
+	}
+
+	// The service is not trusted without its CA.
+	svc, err = newExternalIPAMService(CIDRAllocatorParams{ExternalIPAMURL: server.URL})
+	if err != nil {
+		t.Fatalf("newExternalIPAMService() = %v", err)
+	}
+	if _, err := svc.allocate(context.Background(), &ExternalIPAMRequest{Node: "test"}); err == nil {
+		t.Errorf("allocate() succeeded with an untrusted service")
+	}
+}
+
+func TestExternalIPAMServiceTokenRequiresTLS(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"http://127.0.0.1:8080/ipam", "grpc://127.0.0.1:8080"} {
+		if _, err := newExternalIPAMService(CIDRAllocatorParams{ExternalIPAMURL: url, ExternalIPAMTokenFile: tokenFile}); err == nil {
+			t.Errorf("newExternalIPAMService(%q) with a token succeeded, want error", url)
+		}
+	}
+}
+
+func TestExternalIPAMServiceResponseTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"podCIDRs": ["10.8.0.0/24"], "rangeName": "`))
+		w.Write(bytes.Repeat([]byte("a"), externalIPAMMaxResponseBytes))
+		w.Write([]byte(`"}`))
+	}))
+	defer server.Close()
+
+	svc, err := newExternalIPAMService(CIDRAllocatorParams{ExternalIPAMURL: server.URL})
+	if err != nil {
+		t.Fatalf("newExternalIPAMService() = %v", err)
+	}
+	if _, err := svc.allocate(context.Background(), &ExternalIPAMRequest{Node: "test"}); err == nil {
+		t.Errorf("allocate() with a response over %d bytes succeeded, want error", externalIPAMMaxResponseBytes)
+	}
+}
+
+func TestExternalIPAMServiceGRPC(t *testing.T) {
+	var gotReqs []ExternalIPAMRequest
+	handler := func(resp *ExternalIPAMResponse) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+		return func(_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := &structpb.Struct{}
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			var req ExternalIPAMRequest
+			if err := fromStruct(in, &req); err != nil {
+				return nil, err
+			}
+			gotReqs = append(gotReqs, req)
+			if resp == nil {
+				return &structpb.Struct{}, nil
+			}
+			return toStruct(resp)
+		}
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: ExternalIPAMGRPCService,
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: ExternalIPAMAllocate, Handler: handler(&ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0/24"}, RangeName: "pods"})},
+			{MethodName: ExternalIPAMRelease, Handler: handler(nil)},
+		},
+	}, struct{}{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+
+	svc, err := newExternalIPAMService(CIDRAllocatorParams{ExternalIPAMURL: "grpc://" + lis.Addr().String()})
+	if err != nil {
+		t.Fatalf("newExternalIPAMService() = %v", err)
+	}
+	ctx := context.Background()
+	resp, err := svc.allocate(ctx, &ExternalIPAMRequest{Node: "test", Labels: map[string]string{"pool": "a"}})
+	if err != nil {
+		t.Fatalf("allocate() = %v", err)
+	}
+	if want := (&ExternalIPAMResponse{PodCIDRs: []string{"10.8.0.0/24"}, RangeName: "pods"}); !reflect.DeepEqual(resp, want) {
+		t.Errorf("got response %+v, want %+v", resp, want)
+	}
+	if err := svc.release(ctx, &ExternalIPAMRequest{Node: "test", PodCIDRs: []string{"10.8.0.0/24"}}); err != nil {
+		t.Fatalf("release() = %v", err)
+	}
+	want := []ExternalIPAMRequest{
+		{Operation: ExternalIPAMAllocate, Node: "test", Labels: map[string]string{"pool": "a"}},
+		{Operation: ExternalIPAMRelease, Node: "test", PodCIDRs: []string{"10.8.0.0/24"}},
+	}
+	if !reflect.DeepEqual(gotReqs, want) {
+		t.Errorf("got requests %+v, want %+v", gotReqs, want)
+	}
+}
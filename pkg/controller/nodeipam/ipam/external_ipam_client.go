@@ -0,0 +1,329 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Operations of the ExternalIPAMRequests.
+const (
+	// ExternalIPAMAllocate asks for the pod CIDRs of a node. The service must
+	// return the same pod CIDRs for the same node until they are released, as
+	// the allocation of a node is retried on failures.
+	ExternalIPAMAllocate = "Allocate"
+	// ExternalIPAMRelease releases the pod CIDRs of a deleted node. The
+	// release of a node is retried on failures, so releasing pod CIDRs
+	// already released must succeed.
+	ExternalIPAMRelease = "Release"
+)
+
+// externalIPAMMaxResponseBytes bounds the size of the responses read from the
+// external IPAM service.
+const externalIPAMMaxResponseBytes = 64 * 1024
+
+// ExternalIPAMGRPCService is the gRPC service of the external IPAM services
+// with a grpc or grpcs URL. Its Allocate and Release methods take and return
+// a google.protobuf.Struct with the fields of the ExternalIPAMRequest and
+// ExternalIPAMResponse.
+const ExternalIPAMGRPCService = "cloudprovidergcp.ipam.v1.ExternalIPAM"
+
+// ExternalIPAMRequest is the JSON body posted to the external IPAM service.
+type ExternalIPAMRequest struct {
+	// Operation is ExternalIPAMAllocate or ExternalIPAMRelease.
+	Operation  string            `json:"operation"`
+	Node       string            `json:"node"`
+	ProviderID string            `json:"providerID"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// PodCIDRs are the pod CIDRs of the node to release.
+	PodCIDRs []string `json:"podCIDRs,omitempty"`
+}
+
+// ExternalIPAMResponse is the JSON body the external IPAM service answers an
+// ExternalIPAMAllocate request with.
+type ExternalIPAMResponse struct {
+	// PodCIDRs are the pod CIDRs of the node, at most one of each IP family.
+	PodCIDRs []string `json:"podCIDRs"`
+	// RangeName is the secondary range of the subnet of the node the IPv4
+	// pod CIDR is taken from, the one of the cloud config if empty.
+	RangeName string `json:"rangeName,omitempty"`
+}
+
+// externalIPAMService is the client of the external IPAM service.
+type externalIPAMService interface {
+	// allocate returns the pod CIDRs of the node chosen by the service.
+	allocate(ctx context.Context, req *ExternalIPAMRequest) (*ExternalIPAMResponse, error)
+	// release releases the pod CIDRs of the node.
+	release(ctx context.Context, req *ExternalIPAMRequest) error
+}
+
+// newExternalIPAMService returns the client of the external IPAM service of
+// the params: an HTTP one for http and https URLs, a gRPC one for grpc and
+// grpcs URLs. The bearer token is only sent over https and grpcs, so that it
+// is not sent in cleartext.
+func newExternalIPAMService(params CIDRAllocatorParams) (externalIPAMService, error) {
+	u, err := url.Parse(params.ExternalIPAMURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL of the external IPAM service %q: %v", params.ExternalIPAMURL, err)
+	}
+	timeout := params.ExternalIPAMTimeout
+	if timeout == 0 {
+		timeout = defaultExternalIPAMTimeout
+	}
+	var tlsConfig *tls.Config
+	if u.Scheme == "https" || u.Scheme == "grpcs" {
+		if tlsConfig, err = externalIPAMTLSConfig(params); err != nil {
+			return nil, err
+		}
+	}
+	token := externalIPAMToken(params.ExternalIPAMTokenFile)
+	if token != nil && (u.Scheme == "http" || u.Scheme == "grpc") {
+		return nil, fmt.Errorf("the token of the external IPAM service requires an https or grpcs URL, got %q", params.ExternalIPAMURL)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return &externalIPAMClient{
+			url:   u.String(),
+			token: token,
+			client: &http.Client{
+				Timeout:   timeout,
+				Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+			},
+		}, nil
+	case "grpc", "grpcs":
+		creds := insecure.NewCredentials()
+		if tlsConfig != nil {
+			creds = credentials.NewTLS(tlsConfig)
+		}
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+		if token != nil {
+			opts = append(opts, grpc.WithPerRPCCredentials(externalIPAMTokenCredentials(token)))
+		}
+		conn, err := grpc.NewClient(u.Host, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the external IPAM service %q: %v", params.ExternalIPAMURL, err)
+		}
+		return &externalIPAMGRPCClient{conn: conn, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme of the URL of the external IPAM service %q", params.ExternalIPAMURL)
+	}
+}
+
+// externalIPAMTLSConfig returns the TLS config verifying the external IPAM
+// service with the CA of the params, the system roots if unset, and
+// authenticating with the client certificate of the params, if set.
+func externalIPAMTLSConfig(params CIDRAllocatorParams) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if params.ExternalIPAMCAFile != "" {
+		pem, err := os.ReadFile(params.ExternalIPAMCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA of the external IPAM service: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in the CA of the external IPAM service %s", params.ExternalIPAMCAFile)
+		}
+	}
+	if params.ExternalIPAMClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(params.ExternalIPAMClientCertFile, params.ExternalIPAMClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate of the external IPAM service: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// externalIPAMToken returns the bearer token of the requests to the external
+// IPAM service, read from the file at each request to pick up the rotated
+// tokens, or nil if file is empty.
+func externalIPAMToken(file string) func() (string, error) {
+	if file == "" {
+		return nil
+	}
+	return func() (string, error) {
+		token, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the token of the external IPAM service: %v", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+}
+
+// externalIPAMClient posts the ExternalIPAMRequests to the external IPAM
+// service at url.
+type externalIPAMClient struct {
+	url    string
+	client *http.Client
+	// token returns the bearer token of the requests, unauthenticated if nil.
+	token func() (string, error)
+}
+
+// allocate returns the pod CIDRs of the node chosen by the external IPAM
+// service.
+func (c *externalIPAMClient) allocate(ctx context.Context, req *ExternalIPAMRequest) (*ExternalIPAMResponse, error) {
+	req.Operation = ExternalIPAMAllocate
+	resp := &ExternalIPAMResponse{}
+	if err := c.post(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// release releases the pod CIDRs of the node.
+func (c *externalIPAMClient) release(ctx context.Context, req *ExternalIPAMRequest) error {
+	req.Operation = ExternalIPAMRelease
+	return c.post(ctx, req, nil)
+}
+
+// post posts the request and decodes the response into out, unless nil.
+func (c *externalIPAMClient) post(ctx context.Context, req *ExternalIPAMRequest, out interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != nil {
+		token, err := c.token()
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to %s the pod CIDRs of node %s with the external IPAM service: %v", strings.ToLower(req.Operation), req.Node, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to %s the pod CIDRs of node %s with the external IPAM service: %s: %s", strings.ToLower(req.Operation), req.Node, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, externalIPAMMaxResponseBytes)).Decode(out); err != nil {
+		return fmt.Errorf("invalid response of the external IPAM service for node %s: %v", req.Node, err)
+	}
+	return nil
+}
+
+// externalIPAMGRPCClient calls the ExternalIPAMGRPCService of the external
+// IPAM service.
+type externalIPAMGRPCClient struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+}
+
+// allocate returns the pod CIDRs of the node chosen by the external IPAM
+// service.
+func (c *externalIPAMGRPCClient) allocate(ctx context.Context, req *ExternalIPAMRequest) (*ExternalIPAMResponse, error) {
+	req.Operation = ExternalIPAMAllocate
+	resp := &ExternalIPAMResponse{}
+	if err := c.invoke(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// release releases the pod CIDRs of the node.
+func (c *externalIPAMGRPCClient) release(ctx context.Context, req *ExternalIPAMRequest) error {
+	req.Operation = ExternalIPAMRelease
+	return c.invoke(ctx, req, nil)
+}
+
+// invoke calls the method of the operation of the request and decodes the
+// response into out, unless nil.
+func (c *externalIPAMGRPCClient) invoke(ctx context.Context, req *ExternalIPAMRequest, out interface{}) error {
+	in, err := toStruct(req)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp := &structpb.Struct{}
+	if err := c.conn.Invoke(ctx, "/"+ExternalIPAMGRPCService+"/"+req.Operation, in, resp); err != nil {
+		return fmt.Errorf("failed to %s the pod CIDRs of node %s with the external IPAM service: %v", strings.ToLower(req.Operation), req.Node, err)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := fromStruct(resp, out); err != nil {
+		return fmt.Errorf("invalid response of the external IPAM service for node %s: %v", req.Node, err)
+	}
+	return nil
+}
+
+// toStruct converts the JSON fields of v to a Struct.
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(m)
+}
+
+// fromStruct decodes the Struct into the JSON fields of out.
+func fromStruct(s *structpb.Struct, out interface{}) error {
+	b, err := json.Marshal(s.AsMap())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// externalIPAMTokenCredentials sends the bearer token in the metadata of the
+// gRPC calls.
+type externalIPAMTokenCredentials func() (string, error)
+
+func (t externalIPAMTokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token, err := t()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity only sends the token over TLS.
+func (externalIPAMTokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
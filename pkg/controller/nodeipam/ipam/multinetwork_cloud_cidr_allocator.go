@@ -2,7 +2,9 @@ package ipam
 
 import (
 	"fmt"
+	"math"
 	"net"
+	"slices"
 	"strings"
 
 	networkv1 "github.com/GoogleCloudPlatform/gke-networking-api/apis/network/v1"
@@ -116,29 +118,40 @@ func (ca *cloudCIDRAllocator) performMultiNetworkCIDRAllocation(node *v1.Node, i
 
 			// Each secondary range in a subnet corresponds to a pod-network. AliasIPRanges list on a node interface consists of IP ranges that belong to multiple secondary ranges (pod-networks).
 			// Match the secondary range names of interface and GKENetworkParams and set the right IpCidrRange for current network.
+			// An additional network gets the alias ranges of all its secondary ranges, in the order of the
+			// GKENetworkParams, while the default network only gets the first one since it ends up in Node.Spec.PodCIDRs.
+			var cidrs []string
 			for _, podRangeName := range podRangeNames {
 				ipRange, ok := rangeNameAliasIPMap[podRangeName]
 				if !ok {
 					continue
 				}
 				klog.V(2).InfoS("found an allocatable alias range for the interface on network", "nodeName", node.Name, "networkName", network.Name, "rangeName", podRangeName, "aliasRange", ipRange.IpCidrRange)
-				processedNetworks[network.Name] = struct{}{}
-				// for defaultNwCIDRs, if there're no NodeLabels keep this,
-				// otherwise get the CIDR with labels
-				if networkv1.IsDefaultNetwork(network.Name) && !hasNodeLabels {
-					defaultNwCIDRs = append(defaultNwCIDRs, ipRange.IpCidrRange)
-					ipv6Addr := ca.cloud.GetIPV6Address(inf)
-					if ipv6Addr != nil {
-						defaultNwCIDRs = append(defaultNwCIDRs, ipv6Addr.String())
-					}
+				if !slices.Contains(cidrs, ipRange.IpCidrRange) {
+					cidrs = append(cidrs, ipRange.IpCidrRange)
 				}
-				if !networkv1.IsDefaultNetwork(network.Name) {
-					northInterfaces = append(northInterfaces, networkv1.NorthInterface{Network: network.Name, IpAddress: inf.NetworkIP})
-					if _, ok := upStatusNetworks[network.Name]; ok {
-						additionalNodeNetworks = append(additionalNodeNetworks, networkv1.NodeNetwork{Name: network.Name, Scope: "host-local", Cidrs: []string{ipRange.IpCidrRange}})
-					}
+				if networkv1.IsDefaultNetwork(network.Name) {
+					break
+				}
+			}
+			if len(cidrs) == 0 {
+				continue
+			}
+			processedNetworks[network.Name] = struct{}{}
+			// for defaultNwCIDRs, if there're no NodeLabels keep this,
+			// otherwise get the CIDR with labels
+			if networkv1.IsDefaultNetwork(network.Name) && !hasNodeLabels {
+				defaultNwCIDRs = append(defaultNwCIDRs, cidrs[0])
+				ipv6Addr := ca.cloud.GetIPV6Address(inf)
+				if ipv6Addr != nil {
+					defaultNwCIDRs = append(defaultNwCIDRs, ipv6Addr.String())
+				}
+			}
+			if !networkv1.IsDefaultNetwork(network.Name) {
+				northInterfaces = append(northInterfaces, networkv1.NorthInterface{Network: network.Name, IpAddress: inf.NetworkIP})
+				if _, ok := upStatusNetworks[network.Name]; ok {
+					additionalNodeNetworks = append(additionalNodeNetworks, networkv1.NodeNetwork{Name: network.Name, Scope: "host-local", Cidrs: cidrs})
 				}
-				break
 			}
 		}
 	}
@@ -235,21 +248,30 @@ func resourceName(name string) string {
 	return parts[len(parts)-1]
 }
 
+// getNodeCapacity returns the number of IPs of the network on the node, summed
+// over all its CIDRs.
 func getNodeCapacity(nw networkv1.NodeNetwork) (int64, error) {
 	if len(nw.Cidrs) < 1 {
 		return -1, fmt.Errorf("network %s is missing CIDRs", nw.Name)
 	}
-	_, ipNet, err := net.ParseCIDR(nw.Cidrs[0])
-	if err != nil {
-		return -1, err
-	}
-	var ipCount int64 = 1
-	size := netutils.RangeSize(ipNet)
-	if size > 1 {
-		// The number of IPs supported are halved and returned for overprovisioning purposes.
-		ipCount = size >> 1
+	var total int64
+	for _, cidr := range nw.Cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return -1, err
+		}
+		var ipCount int64 = 1
+		size := netutils.RangeSize(ipNet)
+		if size > 1 {
+			// The number of IPs supported are halved and returned for overprovisioning purposes.
+			ipCount = size >> 1
+		}
+		if total > math.MaxInt64-ipCount {
+			return math.MaxInt64, nil
+		}
+		total += ipCount
 	}
-	return ipCount, nil
+	return total, nil
 }
 
 func getUpNetworks(node *v1.Node) (map[string]struct{}, error) {
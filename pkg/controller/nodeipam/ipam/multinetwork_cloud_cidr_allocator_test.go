@@ -2,6 +2,7 @@ package ipam
 
 import (
 	"fmt"
+	"math"
 	"testing"
 
 	networkv1 "github.com/GoogleCloudPlatform/gke-networking-api/apis/network/v1"
@@ -330,6 +331,28 @@ func TestGetNodeCapacity(t *testing.T) {
 			},
 			want: 4611686018427387903,
 		},
+		{
+			desc: "multiple v4 cidrs",
+			input: networkv1.NodeNetwork{
+				Cidrs: []string{"2.2.2.0/24", "3.3.3.0/30"},
+			},
+			want: 130,
+		},
+		{
+			desc: "incorrect additional cidr",
+			input: networkv1.NodeNetwork{
+				Cidrs: []string{"2.2.2.0/24", "3000.3.3.0/30"},
+			},
+			want:      -1,
+			expectErr: true,
+		},
+		{
+			desc: "multiple 2 v6 cidrs overflowing",
+			input: networkv1.NodeNetwork{
+				Cidrs: []string{"200:12::/2", "4000:12::/2", "8000:12::/2"},
+			},
+			want: math.MaxInt64,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
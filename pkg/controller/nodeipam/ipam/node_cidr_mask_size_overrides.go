@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NodeCIDRMaskSizeOverride overrides the mask sizes of the node CIDRs
+// allocated by the range allocator to the nodes matching Selector, e.g. the
+// nodes of a node pool. MaskSizes are the ones of the cluster CIDRs, in their
+// order.
+type NodeCIDRMaskSizeOverride struct {
+	Selector  labels.Selector
+	MaskSizes []int
+}
+
+// ParseNodeCIDRMaskSizeOverrides returns the NodeCIDRMaskSizeOverrides of
+// the values, formatted as SELECTOR:MASK_SIZE[,MASK_SIZE], e.g.
+// cloud.google.com/gke-nodepool=pool-1:23 or, in dual-stack clusters,
+// cloud.google.com/gke-nodepool=pool-1:23,64.
+func ParseNodeCIDRMaskSizeOverrides(values []string) ([]NodeCIDRMaskSizeOverride, error) {
+	var overrides []NodeCIDRMaskSizeOverride
+	for _, v := range values {
+		// Label selectors have no colons.
+		i := strings.LastIndex(v, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid node CIDR mask size override %q: want SELECTOR:MASK_SIZE[,MASK_SIZE]", v)
+		}
+		selector, err := labels.Parse(v[:i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid node CIDR mask size override %q: %v", v, err)
+		}
+		if selector.Empty() {
+			return nil, fmt.Errorf("invalid node CIDR mask size override %q: empty selector", v)
+		}
+		o := NodeCIDRMaskSizeOverride{Selector: selector}
+		for _, s := range strings.Split(v[i+1:], ",") {
+			maskSize, err := strconv.Atoi(s)
+			if err != nil || maskSize <= 0 || maskSize > 128 {
+				return nil, fmt.Errorf("invalid node CIDR mask size override %q: invalid mask size %q", v, s)
+			}
+			o.MaskSizes = append(o.MaskSizes, maskSize)
+		}
+		if len(o.MaskSizes) > 2 {
+			return nil, fmt.Errorf("invalid node CIDR mask size override %q: more than 2 mask sizes", v)
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// nodeCIDRMaskSizes returns the mask sizes of the node CIDRs of the node of
+// the first override matching it, or nil if none does.
+func nodeCIDRMaskSizes(overrides []NodeCIDRMaskSizeOverride, node *v1.Node) []int {
+	for _, o := range overrides {
+		if o.Selector.Matches(labels.Set(node.Labels)) {
+			return o.MaskSizes
+		}
+	}
+	return nil
+}
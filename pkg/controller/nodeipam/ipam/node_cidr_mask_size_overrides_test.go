@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestParseNodeCIDRMaskSizeOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		value         string
+		wantSelector  string
+		wantMaskSizes []int
+		wantErr       bool
+	}{
+		{desc: "single stack", value: "cloud.google.com/gke-nodepool=pool-1:23", wantSelector: "cloud.google.com/gke-nodepool=pool-1", wantMaskSizes: []int{23}},
+		{desc: "dual stack", value: "cloud.google.com/gke-nodepool in (pool-1,pool-2):23,64", wantSelector: "cloud.google.com/gke-nodepool in (pool-1,pool-2)", wantMaskSizes: []int{23, 64}},
+		{desc: "no mask size", value: "cloud.google.com/gke-nodepool=pool-1", wantErr: true},
+		{desc: "empty selector", value: ":23", wantErr: true},
+		{desc: "invalid selector", value: "a=(b:23", wantErr: true},
+		{desc: "invalid mask size", value: "pool=pool-1:x", wantErr: true},
+		{desc: "mask size too big", value: "pool=pool-1:129", wantErr: true},
+		{desc: "too many mask sizes", value: "pool=pool-1:23,64,64", wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			overrides, err := ParseNodeCIDRMaskSizeOverrides([]string{tc.value})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ParseNodeCIDRMaskSizeOverrides(%q) = %v, want error %t", tc.value, err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := overrides[0].Selector.String(); got != tc.wantSelector {
+				t.Errorf("got selector %q, want %q", got, tc.wantSelector)
+			}
+			if got := overrides[0].MaskSizes; !reflect.DeepEqual(got, tc.wantMaskSizes) {
+				t.Errorf("got mask sizes %v, want %v", got, tc.wantMaskSizes)
+			}
+		})
+	}
+}
+
+func TestNodeCIDRMaskSizes(t *testing.T) {
+	overrides, err := ParseNodeCIDRMaskSizeOverrides([]string{"pool=pool-1:23", "pool:25"})
+	if err != nil {
+		t.Fatalf("ParseNodeCIDRMaskSizeOverrides() = %v", err)
+	}
+	for _, tc := range []struct {
+		labels map[string]string
+		want   []int
+	}{
+		{labels: map[string]string{"pool": "pool-1"}, want: []int{23}},
+		{labels: map[string]string{"pool": "pool-2"}, want: []int{25}},
+		{labels: nil, want: nil},
+	} {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node0", Labels: tc.labels}}
+		if got := nodeCIDRMaskSizes(overrides, node); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("nodeCIDRMaskSizes() of a node with labels %v = %v, want %v", tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestValidateNodeCIDRMaskSizeOverrides(t *testing.T) {
+	_, clusterCIDR, _ := net.ParseCIDR("10.0.0.0/16")
+	for _, tc := range []struct {
+		desc    string
+		value   string
+		wantErr bool
+	}{
+		{desc: "larger node CIDRs", value: "pool=pool-1:22"},
+		{desc: "same node CIDRs", value: "pool=pool-1:24"},
+		{desc: "smaller node CIDRs", value: "pool=pool-1:25", wantErr: true},
+		{desc: "larger than the cluster CIDR", value: "pool=pool-1:15", wantErr: true},
+		{desc: "mask size of each cluster CIDR", value: "pool=pool-1:22,64", wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			overrides, err := ParseNodeCIDRMaskSizeOverrides([]string{tc.value})
+			if err != nil {
+				t.Fatalf("ParseNodeCIDRMaskSizeOverrides(%q) = %v", tc.value, err)
+			}
+			err = validateNodeCIDRMaskSizeOverrides(CIDRAllocatorParams{
+				ClusterCIDRs:              []*net.IPNet{clusterCIDR},
+				NodeCIDRMaskSizes:         []int{24},
+				NodeCIDRMaskSizeOverrides: overrides,
+			})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("validateNodeCIDRMaskSizeOverrides() = %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCoveredBy(t *testing.T) {
+	cidrs := sets.NewString("10.0.2.0/23")
+	for cidr, want := range map[string]bool{
+		"10.0.2.0/23": true,
+		"10.0.3.0/24": true,
+		"10.0.1.0/24": false,
+		"10.0.0.0/22": false,
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		if got := coveredBy(cidrs, n); got != want {
+			t.Errorf("coveredBy(%s) = %t, want %t", cidr, got, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	nodeutil "k8s.io/cloud-provider-gcp/pkg/util"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+)
+
+// AdditionalPodCIDRsAnnotationKey is the annotation of the nodes listing the
+// alias IP ranges added to their IPv4 pod CIDR by the pod range expansion,
+// comma separated. Node.Spec.PodCIDRs holds at most one CIDR of each IP family
+// and cannot be changed once set, so the CNI takes the additional pod CIDRs of
+// a node from the annotation.
+const AdditionalPodCIDRsAnnotationKey = "cloud.google.com/additional-pod-cidrs"
+
+// podAddressesPerPod is the number of pod addresses of a node for each pod of
+// its max pods, so that the addresses of deleted pods are not reused right
+// away, as in the pod CIDRs sized by GKE.
+const podAddressesPerPod = 2
+
+// additionalPodCIDRs returns the CIDRs of the AdditionalPodCIDRsAnnotationKey
+// annotation of the node.
+func additionalPodCIDRs(node *v1.Node) []string {
+	val := node.Annotations[AdditionalPodCIDRsAnnotationKey]
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, ",")
+}
+
+// podAddressShortfall returns the number of IPv4 pod addresses the max pods
+// of the node need beyond the ones of the cidrs, 0 if none.
+func podAddressShortfall(node *v1.Node, cidrs []string) float64 {
+	needed := float64(podAddressesPerPod * node.Status.Capacity.Pods().Value())
+	for _, cidr := range cidrs {
+		_, podCIDR, err := netutils.ParseCIDRSloppy(cidr)
+		if err != nil || netutils.IsIPv6CIDR(podCIDR) {
+			continue
+		}
+		needed -= cidrAddresses(podCIDR)
+	}
+	return math.Max(needed, 0)
+}
+
+// needsPodRangeExpansion tells whether the max pods of the node exceed its
+// IPv4 pod CIDR and the additional ones already recorded.
+func needsPodRangeExpansion(node *v1.Node) bool {
+	ipv4CIDR, _ := splitCIDRFamilies(node.Spec.PodCIDRs)
+	if ipv4CIDR == "" {
+		return false
+	}
+	return podAddressShortfall(node, append([]string{ipv4CIDR}, additionalPodCIDRs(node)...)) > 0
+}
+
+// expansionMaskSize returns the mask size of the smallest IPv4 range holding
+// the addresses.
+func expansionMaskSize(addresses float64) int {
+	return 32 - int(math.Ceil(math.Log2(addresses)))
+}
+
+// sameRangeAliases tells whether the alias IP ranges of the interface are all
+// of the same secondary range, i.e. a pod CIDR and its expansions.
+func sameRangeAliases(nic *compute.NetworkInterface) bool {
+	for _, r := range nic.AliasIpRanges {
+		if r.SubnetworkRangeName != nic.AliasIpRanges[0].SubnetworkRangeName {
+			return false
+		}
+	}
+	return len(nic.AliasIpRanges) > 0
+}
+
+// additionalAliasRanges returns the alias IP ranges of the interface which
+// are in the secondary range of the pod CIDR, besides the pod CIDR, along with
+// the name of the range.
+func additionalAliasRanges(nic *compute.NetworkInterface, podCIDR string) (cidrs []string, rangeName string) {
+	for _, r := range nic.AliasIpRanges {
+		if r.IpCidrRange == podCIDR {
+			rangeName = r.SubnetworkRangeName
+		}
+	}
+	for _, r := range nic.AliasIpRanges {
+		if r.IpCidrRange != podCIDR && r.SubnetworkRangeName == rangeName {
+			cidrs = append(cidrs, r.IpCidrRange)
+		}
+	}
+	return cidrs, rangeName
+}
+
+// expandPodRange records the alias IP ranges of the interface of the node
+// added to its IPv4 pod CIDR, and adds another one from the secondary range of
+// the pod CIDR if they fall short of the max pods of the node. The node is
+// queued again to record the range GCE allocated.
+func (ca *cloudCIDRAllocator) expandPodRange(node *v1.Node, nic *compute.NetworkInterface) error {
+	podCIDR, _ := splitCIDRFamilies(node.Spec.PodCIDRs)
+	if podCIDR == "" {
+		return nil
+	}
+	additional, rangeName := additionalAliasRanges(nic, podCIDR)
+	if val := strings.Join(additional, ","); val != node.Annotations[AdditionalPodCIDRsAnnotationKey] {
+		if err := ca.patchAdditionalPodCIDRs(node.Name, val); err != nil {
+			return err
+		}
+		klog.InfoS("Set the node additional pod CIDRs", "nodeName", node.Name, "cidrStrings", additional)
+	}
+
+	shortfall := podAddressShortfall(node, append([]string{podCIDR}, additional...))
+	if shortfall == 0 {
+		return nil
+	}
+	maskSize := expansionMaskSize(shortfall)
+	if err := ca.cloud.ExpandAliasIPRangesByProviderID(node.Spec.ProviderID, rangeName, maskSize); err != nil {
+		recordAllocationFailure(ca.recorder, node, CloudAllocatorType, "PodRangeExpansionFailed")
+		return fmt.Errorf("failed to add a /%d alias IP range to node %s: %v", maskSize, node.Name, err)
+	}
+	klog.InfoS("Added an alias IP range to the node pod CIDR", "nodeName", node.Name, "maskSize", maskSize, "rangeName", rangeName)
+	nodeutil.RecordNodeStatusChange(ca.recorder, node, "PodRangeExpanded")
+	ca.queue.Add(node.Name)
+	return nil
+}
+
+// patchAdditionalPodCIDRs sets the AdditionalPodCIDRsAnnotationKey annotation
+// of the node, or removes it if val is empty.
+func (ca *cloudCIDRAllocator) patchAdditionalPodCIDRs(nodeName, val string) error {
+	var annotation interface{}
+	if val != "" {
+		annotation = val
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{AdditionalPodCIDRsAnnotationKey: annotation},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := ca.client.CoreV1().Nodes().Patch(context.TODO(), nodeName, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to patch the additional pod CIDRs of node %s: %v", nodeName, err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/cloud-provider-gcp/pkg/controller/testutil"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+)
+
+func podRangeExpansionNode(maxPods int64, podCIDRs []string, additional string) *v1.Node {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: map[string]string{}},
+		Spec:       v1.NodeSpec{ProviderID: "gce://test-project/us-central1-b/test", PodCIDRs: podCIDRs},
+		Status: v1.NodeStatus{
+			Capacity: v1.ResourceList{v1.ResourcePods: *resource.NewQuantity(maxPods, resource.DecimalSI)},
+		},
+	}
+	if len(podCIDRs) > 0 {
+		node.Spec.PodCIDR = podCIDRs[0]
+	}
+	if additional != "" {
+		node.Annotations[AdditionalPodCIDRsAnnotationKey] = additional
+	}
+	return node
+}
+
+func TestNeedsPodRangeExpansion(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		node *v1.Node
+		want bool
+	}{
+		{desc: "fits", node: podRangeExpansionNode(110, []string{"10.0.0.0/24"}, ""), want: false},
+		{desc: "max pods raised", node: podRangeExpansionNode(180, []string{"10.0.0.0/24"}, ""), want: true},
+		{desc: "expanded", node: podRangeExpansionNode(180, []string{"10.0.0.0/24"}, "10.0.8.0/25"), want: false},
+		{desc: "IPv6 pod CIDR not counted", node: podRangeExpansionNode(180, []string{"10.0.0.0/24", "2001:db8::/64"}, ""), want: true},
+		{desc: "no IPv4 pod CIDR", node: podRangeExpansionNode(180, []string{"2001:db8::/112"}, ""), want: false},
+		{desc: "no pod CIDR", node: podRangeExpansionNode(180, nil, ""), want: false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := needsPodRangeExpansion(tc.node); got != tc.want {
+				t.Errorf("needsPodRangeExpansion() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExpansionMaskSize(t *testing.T) {
+	for addresses, want := range map[float64]int{1: 32, 100: 25, 128: 25, 129: 24, 256: 24} {
+		if got := expansionMaskSize(addresses); got != want {
+			t.Errorf("expansionMaskSize(%v) = %d, want %d", addresses, got, want)
+		}
+	}
+}
+
+func TestAdditionalAliasRanges(t *testing.T) {
+	nic := &compute.NetworkInterface{
+		AliasIpRanges: []*compute.AliasIpRange{
+			{IpCidrRange: "10.0.0.0/24", SubnetworkRangeName: "pods"},
+			{IpCidrRange: "10.1.0.0/24", SubnetworkRangeName: "other"},
+			{IpCidrRange: "10.0.8.0/25", SubnetworkRangeName: "pods"},
+		},
+	}
+	cidrs, rangeName := additionalAliasRanges(nic, "10.0.0.0/24")
+	if want := []string{"10.0.8.0/25"}; !reflect.DeepEqual(cidrs, want) || rangeName != "pods" {
+		t.Errorf("additionalAliasRanges() = %v, %q, want %v, %q", cidrs, rangeName, want, "pods")
+	}
+	if sameRangeAliases(nic) {
+		t.Errorf("sameRangeAliases() of aliases of several ranges = true, want false")
+	}
+	nic.AliasIpRanges = append(nic.AliasIpRanges[:1], nic.AliasIpRanges[2])
+	if !sameRangeAliases(nic) {
+		t.Errorf("sameRangeAliases() of aliases of one range = false, want true")
+	}
+}
+
+func TestExpandPodRange(t *testing.T) {
+	for _, tc := range []struct {
+		desc           string
+		node           *v1.Node
+		aliases        []*compute.AliasIpRange
+		wantAnnotation string
+		wantExpansion  string
+	}{
+		{
+			desc:    "fits",
+			node:    podRangeExpansionNode(110, []string{"10.0.0.0/24"}, ""),
+			aliases: []*compute.AliasIpRange{{IpCidrRange: "10.0.0.0/24", SubnetworkRangeName: "pods"}},
+		},
+		{
+			desc:          "max pods raised",
+			node:          podRangeExpansionNode(180, []string{"10.0.0.0/24"}, ""),
+			aliases:       []*compute.AliasIpRange{{IpCidrRange: "10.0.0.0/24", SubnetworkRangeName: "pods"}},
+			wantExpansion: "/25",
+		},
+		{
+			desc: "expansion allocated",
+			node: podRangeExpansionNode(180, []string{"10.0.0.0/24"}, ""),
+			aliases: []*compute.AliasIpRange{
+				{IpCidrRange: "10.0.0.0/24", SubnetworkRangeName: "pods"},
+				{IpCidrRange: "10.0.8.0/25", SubnetworkRangeName: "pods"},
+			},
+			wantAnnotation: "10.0.8.0/25",
+		},
+		{
+			desc: "expansion allocated but too small",
+			node: podRangeExpansionNode(256, []string{"10.0.0.0/24"}, "10.0.8.0/25"),
+			aliases: []*compute.AliasIpRange{
+				{IpCidrRange: "10.0.0.0/24", SubnetworkRangeName: "pods"},
+				{IpCidrRange: "10.0.8.0/25", SubnetworkRangeName: "pods"},
+			},
+			wantAnnotation: "10.0.8.0/25",
+			wantExpansion:  "/25",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			testClusterValues := gce.DefaultTestClusterValues()
+			fakeGCE := gce.NewFakeGCECloud(testClusterValues)
+			nic := &compute.NetworkInterface{Name: "nic0", AliasIpRanges: tc.aliases}
+			if err := fakeGCE.Compute().Instances().Insert(ctx, meta.ZonalKey("test", testClusterValues.ZoneName), &compute.Instance{
+				Name:              "test",
+				Zone:              testClusterValues.ZoneName,
+				NetworkInterfaces: []*compute.NetworkInterface{nic},
+			}); err != nil {
+				t.Fatalf("error setting up the test for fakeGCE: %v", err)
+			}
+			var gotExpansion string
+			fakeGCE.Compute().(*cloud.MockGCE).MockBetaInstances.UpdateNetworkInterfaceHook = func(_ context.Context, _ *meta.Key, _ string, iface *computebeta.NetworkInterface, _ *cloud.MockBetaInstances, _ ...cloud.Option) error {
+				gotExpansion = iface.AliasIpRanges[len(iface.AliasIpRanges)-1].IpCidrRange
+				return nil
+			}
+
+			fakeNodeHandler := &testutil.FakeNodeHandler{Existing: []*v1.Node{tc.node}, Clientset: fake.NewSimpleClientset()}
+			ca := &cloudCIDRAllocator{
+				client:   fakeNodeHandler,
+				cloud:    fakeGCE,
+				recorder: testutil.NewFakeRecorder(),
+				queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+			}
+			defer ca.queue.ShutDown()
+			if err := ca.expandPodRange(tc.node, nic); err != nil {
+				t.Fatalf("expandPodRange() = %v", err)
+			}
+
+			gotAnnotation := tc.node.Annotations[AdditionalPodCIDRsAnnotationKey]
+			if updated := fakeNodeHandler.GetUpdatedNodesCopy(); len(updated) > 0 {
+				gotAnnotation = updated[0].Annotations[AdditionalPodCIDRsAnnotationKey]
+			}
+			if gotAnnotation != tc.wantAnnotation {
+				t.Errorf("got additional pod CIDRs %q, want %q", gotAnnotation, tc.wantAnnotation)
+			}
+			if gotExpansion != tc.wantExpansion {
+				t.Errorf("got expansion %q, want %q", gotExpansion, tc.wantExpansion)
+			}
+			if gotQueued, wantQueued := ca.queue.Len() == 1, tc.wantExpansion != ""; gotQueued != wantQueued {
+				t.Errorf("got node queued %t, want %t", gotQueued, wantQueued)
+			}
+		})
+	}
+}
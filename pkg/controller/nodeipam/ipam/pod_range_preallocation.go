@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+)
+
+// podRangePreallocationPeriod is how often the instances are listed for the
+// ones lacking an alias IP range. Each listing is an aggregated list of the
+// project plus a list of the node instance groups of each zone, so it is kept
+// well above the time an instance takes to boot and register its node.
+var podRangePreallocationPeriod = 2 * time.Minute
+
+// podRangePreallocationTimeout bounds a listing of the instances and the
+// alias IP ranges added to them.
+const podRangePreallocationTimeout = time.Minute
+
+// preallocationRangeName returns the secondary range the pod ranges are
+// preallocated from: the pinned one of the nodes, or the one of the cloud
+// config. Node labels are not known before the Nodes register, so the pod
+// range overrides do not apply.
+func (ca *cloudCIDRAllocator) preallocationRangeName() string {
+	if ca.podRanges.RangeName != "" {
+		return ca.podRanges.RangeName
+	}
+	return ca.cloud.SecondaryRangeName()
+}
+
+// needsPodRangePreallocation tells whether the instance has a single network
+// interface without alias IP ranges, i.e. one that the cloud allocator could
+// not take the pod CIDR of its node from.
+func needsPodRangePreallocation(instance *compute.Instance) bool {
+	return len(instance.NetworkInterfaces) == 1 && len(instance.NetworkInterfaces[0].AliasIpRanges) == 0
+}
+
+// preallocatePodRanges adds an alias IP range of podRangePreallocationMaskSize
+// from the secondary range of the pod CIDRs to the instances of the nodes
+// lacking one, as soon as the instances are listed, so that the pod CIDR of a
+// node is programmed by the time it registers and its CNI configuration is
+// not held up by the allocation. Only the members of the node instance groups
+// of the cluster are considered, never the other instances of the project.
+// The Nodes of the instances which already registered are queued to take
+// their pod CIDR.
+func (ca *cloudCIDRAllocator) preallocatePodRanges() {
+	ctx, cancel := context.WithTimeout(context.Background(), podRangePreallocationTimeout)
+	defer cancel()
+	instances, err := ca.cloud.ListNodeInstanceGroupInstanceNetworkInterfaces(ctx)
+	if err != nil {
+		klog.Errorf("Failed to list the instances for the pod range preallocation: %v", err)
+		return
+	}
+	ca.preallocateInstancePodRanges(ctx, instances)
+}
+
+// preallocateInstancePodRanges adds the alias IP ranges to the instances,
+// by providerID, lacking one.
+func (ca *cloudCIDRAllocator) preallocateInstancePodRanges(ctx context.Context, instances map[string]*compute.Instance) {
+	nodes, err := ca.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list nodes for the pod range preallocation: %v", err)
+		return
+	}
+	nodeNames := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		nodeNames[node.Spec.ProviderID] = node.Name
+	}
+
+	rangeName := ca.preallocationRangeName()
+	for providerID, instance := range instances {
+		if ctx.Err() != nil {
+			return
+		}
+		if !needsPodRangePreallocation(instance) {
+			continue
+		}
+		if err := ca.cloud.ExpandAliasIPRangesByProviderID(providerID, rangeName, ca.podRangePreallocationMaskSize); err != nil {
+			klog.Errorf("Failed to preallocate a /%d alias IP range to instance %s: %v", ca.podRangePreallocationMaskSize, providerID, err)
+			continue
+		}
+		klog.InfoS("Preallocated an alias IP range to the instance", "providerID", providerID, "maskSize", ca.podRangePreallocationMaskSize, "rangeName", rangeName)
+		if name, ok := nodeNames[providerID]; ok {
+			ca.queue.Add(name)
+		}
+	}
+}
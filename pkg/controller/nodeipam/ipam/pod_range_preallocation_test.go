@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/cloud-provider-gcp/pkg/controller/testutil"
+	"k8s.io/cloud-provider-gcp/providers/gce"
+)
+
+func TestPreallocateInstancePodRanges(t *testing.T) {
+	ctx := context.Background()
+	testClusterValues := gce.DefaultTestClusterValues()
+	fakeGCE := gce.NewFakeGCECloud(testClusterValues)
+	providerID := func(name string) string {
+		return fmt.Sprintf("gce://%s/%s/%s", testClusterValues.ProjectID, testClusterValues.ZoneName, name)
+	}
+
+	instances := map[string]*compute.Instance{}
+	for name, nics := range map[string][]*compute.NetworkInterface{
+		// Instances without alias IP ranges, of a registered node or not.
+		"registered": {{Name: "nic0"}},
+		"joining":    {{Name: "nic0"}},
+		// Instances which already have their pod CIDR or several interfaces.
+		"allocated":     {{Name: "nic0", AliasIpRanges: []*compute.AliasIpRange{{IpCidrRange: "10.0.0.0/24", SubnetworkRangeName: "pods"}}}},
+		"multi-network": {{Name: "nic0"}, {Name: "nic1"}},
+	} {
+		instance := &compute.Instance{Name: name, Zone: testClusterValues.ZoneName, NetworkInterfaces: nics}
+		if err := fakeGCE.Compute().Instances().Insert(ctx, meta.ZonalKey(name, testClusterValues.ZoneName), instance); err != nil {
+			t.Fatalf("error setting up the test for fakeGCE: %v", err)
+		}
+		instances[providerID(name)] = instance
+	}
+	var gotAliases []string
+	fakeGCE.Compute().(*cloud.MockGCE).MockBetaInstances.UpdateNetworkInterfaceHook = func(_ context.Context, key *meta.Key, _ string, iface *computebeta.NetworkInterface, _ *cloud.MockBetaInstances, _ ...cloud.Option) error {
+		r := iface.AliasIpRanges[len(iface.AliasIpRanges)-1]
+		gotAliases = append(gotAliases, key.Name+" "+r.IpCidrRange+" "+r.SubnetworkRangeName)
+		return nil
+	}
+
+	fakeNodeHandler := &testutil.FakeNodeHandler{
+		Existing: []*v1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "registered-node"},
+			Spec:       v1.NodeSpec{ProviderID: providerID("registered")},
+		}},
+		Clientset: fake.NewSimpleClientset(),
+	}
+	ca := &cloudCIDRAllocator{
+		client:                        fakeNodeHandler,
+		cloud:                         fakeGCE,
+		nodeLister:                    getFakeNodeInformer(fakeNodeHandler).Lister(),
+		queue:                         workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		podRanges:                     PodRangeSelection{RangeName: "pods"},
+		podRangePreallocationMaskSize: 24,
+	}
+	defer ca.queue.ShutDown()
+	ca.preallocateInstancePodRanges(ctx, instances)
+
+	sort.Strings(gotAliases)
+	if want := []string{"joining /24 pods", "registered /24 pods"}; !reflect.DeepEqual(gotAliases, want) {
+		t.Errorf("got preallocated alias IP ranges %v, want %v", gotAliases, want)
+	}
+	// Only the registered node is queued, the other one is queued when it
+	// registers.
+	if ca.queue.Len() != 1 {
+		t.Fatalf("got %d nodes queued, want 1", ca.queue.Len())
+	}
+	if key, _ := ca.queue.Get(); key != "registered-node" {
+		t.Errorf("got node %v queued, want registered-node", key)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"fmt"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilnode "k8s.io/cloud-provider-gcp/pkg/util/node"
+)
+
+// PodRangeOverride pins the secondary range of the pod CIDRs of the nodes
+// matching Selector, e.g. the nodes of a node pool.
+type PodRangeOverride struct {
+	Selector  labels.Selector
+	RangeName string
+}
+
+// PodRangeSelection pins which secondary range of the node subnet the cloud
+// CIDR allocator takes the pod CIDRs of the nodes from, by name. The range of
+// a node is, in order of precedence, the one of its node pool pod range
+// label, the one of the first override matching the node, or RangeName. The
+// first alias IP range of the node is taken if none is set.
+type PodRangeSelection struct {
+	RangeName string
+	Overrides []PodRangeOverride
+}
+
+// ParsePodRangeSelection returns the PodRangeSelection of the default range
+// name and the overrides, formatted as SELECTOR:RANGE_NAME, e.g.
+// cloud.google.com/gke-nodepool=pool-1:pods-1.
+func ParsePodRangeSelection(rangeName string, overrides []string) (PodRangeSelection, error) {
+	s := PodRangeSelection{RangeName: rangeName}
+	if rangeName != "" {
+		if errs := validation.IsDNS1035Label(rangeName); len(errs) != 0 {
+			return PodRangeSelection{}, fmt.Errorf("invalid pod range name %q: %s", rangeName, strings.Join(errs, ", "))
+		}
+	}
+	for _, o := range overrides {
+		// Neither label selectors nor range names have colons.
+		i := strings.LastIndex(o, ":")
+		if i < 0 {
+			return PodRangeSelection{}, fmt.Errorf("invalid pod range override %q: want SELECTOR:RANGE_NAME", o)
+		}
+		selector, err := labels.Parse(o[:i])
+		if err != nil {
+			return PodRangeSelection{}, fmt.Errorf("invalid pod range override %q: %v", o, err)
+		}
+		if selector.Empty() {
+			return PodRangeSelection{}, fmt.Errorf("invalid pod range override %q: empty selector", o)
+		}
+		name := o[i+1:]
+		if errs := validation.IsDNS1035Label(name); len(errs) != 0 {
+			return PodRangeSelection{}, fmt.Errorf("invalid pod range override %q: invalid range name %q: %s", o, name, strings.Join(errs, ", "))
+		}
+		s.Overrides = append(s.Overrides, PodRangeOverride{Selector: selector, RangeName: name})
+	}
+	return s, nil
+}
+
+// rangeName returns the name of the secondary range of the pod CIDRs of the
+// node, or "" if it is not pinned.
+func (s PodRangeSelection) rangeName(node *v1.Node) string {
+	if name := node.Labels[utilnode.NodePoolPodRangeLabelPrefix]; name != "" {
+		return name
+	}
+	for _, o := range s.Overrides {
+		if o.Selector.Matches(labels.Set(node.Labels)) {
+			return o.RangeName
+		}
+	}
+	return s.RangeName
+}
+
+// aliasIPRangeByName returns the alias IP range of the interface from the
+// secondary range of the name, or "" if it has none.
+func aliasIPRangeByName(inf *compute.NetworkInterface, name string) string {
+	for _, r := range inf.AliasIpRanges {
+		if r.SubnetworkRangeName == name {
+			return r.IpCidrRange
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnode "k8s.io/cloud-provider-gcp/pkg/util/node"
+)
+
+func TestParsePodRangeSelection(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		rangeName string
+		overrides []string
+		wantErr   bool
+	}{
+		{desc: "empty"},
+		{desc: "range name", rangeName: "pods"},
+		{desc: "invalid range name", rangeName: "Pods_1", wantErr: true},
+		{desc: "overrides", rangeName: "pods", overrides: []string{"cloud.google.com/gke-nodepool=pool-1:pods-1", "pool in (a,b):pods-2"}},
+		{desc: "override without range name", overrides: []string{"cloud.google.com/gke-nodepool=pool-1"}, wantErr: true},
+		{desc: "override with empty selector", overrides: []string{":pods-1"}, wantErr: true},
+		{desc: "override with invalid selector", overrides: []string{"pool in (a:pods-1"}, wantErr: true},
+		{desc: "override with invalid range name", overrides: []string{"pool=a:Pods_1"}, wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			s, err := ParsePodRangeSelection(tc.rangeName, tc.overrides)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ParsePodRangeSelection(%q, %q) = %v, want error %t", tc.rangeName, tc.overrides, err, tc.wantErr)
+			}
+			if err == nil && len(s.Overrides) != len(tc.overrides) {
+				t.Errorf("got %d overrides, want %d", len(s.Overrides), len(tc.overrides))
+			}
+		})
+	}
+}
+
+func TestPodRangeSelectionRangeName(t *testing.T) {
+	s, err := ParsePodRangeSelection("pods", []string{"pool=a:pods-a", "pool in (a,b):pods-b"})
+	if err != nil {
+		t.Fatalf("ParsePodRangeSelection() = %v", err)
+	}
+	for _, tc := range []struct {
+		desc   string
+		labels map[string]string
+		want   string
+	}{
+		{desc: "no labels", want: "pods"},
+		{desc: "first override", labels: map[string]string{"pool": "a"}, want: "pods-a"},
+		{desc: "second override", labels: map[string]string{"pool": "b"}, want: "pods-b"},
+		{desc: "no matching override", labels: map[string]string{"pool": "c"}, want: "pods"},
+		{desc: "node pool label", labels: map[string]string{"pool": "a", utilnode.NodePoolPodRangeLabelPrefix: "np-pods"}, want: "np-pods"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n0", Labels: tc.labels}}
+			if got := s.rangeName(node); got != tc.want {
+				t.Errorf("rangeName() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+	if got := (PodRangeSelection{}).rangeName(&v1.Node{}); got != "" {
+		t.Errorf("rangeName() of an empty selection = %q, want none", got)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
@@ -28,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	informers "k8s.io/client-go/informers/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -38,6 +40,7 @@ import (
 	"k8s.io/cloud-provider-gcp/pkg/controller/nodeipam/ipam/cidrset"
 	nodeutil "k8s.io/cloud-provider-gcp/pkg/util"
 	utilnode "k8s.io/cloud-provider-gcp/pkg/util/node"
+	netutils "k8s.io/utils/net"
 )
 
 // cidrs are reserved, then node resource is patched with them
@@ -45,6 +48,8 @@ import (
 type nodeReservedCIDRs struct {
 	allocatedCIDRs []*net.IPNet
 	nodeName       string
+	// allocatedAt is when the CIDRs were allocated.
+	allocatedAt time.Time
 }
 
 type rangeAllocator struct {
@@ -53,6 +58,13 @@ type rangeAllocator struct {
 	clusterCIDRs []*net.IPNet
 	// for each entry in clusterCIDRs we maintain a list of what is used and what is not
 	cidrSets []*cidrset.CidrSet
+	// additionalCIDRSets are the cidrSets of the additional blocks of each
+	// entry in clusterCIDRs, allocated from in order once its cidrSet is
+	// exhausted.
+	additionalCIDRSets [][]*cidrset.CidrSet
+	// nodeCIDRMaskSizeOverrides override the mask sizes of the node CIDRs
+	// of the nodes matching them.
+	nodeCIDRMaskSizeOverrides []NodeCIDRMaskSizeOverride
 	// nodeLister is able to list/get nodes and is populated by the shared informer passed to controller
 	nodeLister corelisters.NodeLister
 	// nodesSynced returns true if the node shared informer has been synced at least once.
@@ -64,6 +76,18 @@ type rangeAllocator struct {
 	// Keep a set of nodes that are currently being processed to avoid races in CIDR allocation
 	lock              sync.Mutex
 	nodesInProcessing sets.String
+	// pendingCIDRs are the CIDRs allocated to nodes which are not assigned
+	// to them yet, guarded by lock.
+	pendingCIDRs sets.String
+
+	// reservedCIDRs are the service CIDRs occupied in the cidrSets.
+	reservedCIDRs []*net.IPNet
+	// leakReconcilePeriod is how often the leaked CIDRs are released, never
+	// if 0.
+	leakReconcilePeriod time.Duration
+	// suspectedLeaks are the CIDRs held by no node as of the last leak
+	// reconciliation.
+	suspectedLeaks sets.String
 }
 
 // NewCIDRRangeAllocator returns a CIDRAllocator to allocate CIDRs for node (one from each of clusterCIDRs)
@@ -82,6 +106,14 @@ func NewCIDRRangeAllocator(client clientset.Interface, nodeInformer informers.No
 	klog.V(0).Infof("Sending events to api server.")
 	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: client.CoreV1().Events("")})
 
+	if allocatorParams.IPv6Only {
+		for _, cidr := range allocatorParams.ClusterCIDRs {
+			if !netutils.IsIPv6CIDR(cidr) {
+				return nil, fmt.Errorf("cluster CIDR %v is not IPv6 in an IPv6-only cluster", cidr)
+			}
+		}
+	}
+
 	// create a cidrSet for each cidr we operate on
 	// cidrSet are mapped to clusterCIDR by index
 	cidrSets := make([]*cidrset.CidrSet, len(allocatorParams.ClusterCIDRs))
@@ -92,17 +124,31 @@ func NewCIDRRangeAllocator(client clientset.Interface, nodeInformer informers.No
 		}
 		cidrSets[idx] = cidrSet
 	}
+	additionalCIDRSets, err := newAdditionalCIDRSets(allocatorParams)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateNodeCIDRMaskSizeOverrides(allocatorParams); err != nil {
+		return nil, err
+	}
 
 	ra := &rangeAllocator{
-		client:                client,
-		clusterCIDRs:          allocatorParams.ClusterCIDRs,
-		cidrSets:              cidrSets,
-		nodeLister:            nodeInformer.Lister(),
-		nodesSynced:           nodeInformer.Informer().HasSynced,
-		nodeCIDRUpdateChannel: make(chan nodeReservedCIDRs, cidrUpdateQueueSize),
-		recorder:              recorder,
-		nodesInProcessing:     sets.NewString(),
+		client:                    client,
+		clusterCIDRs:              allocatorParams.ClusterCIDRs,
+		cidrSets:                  cidrSets,
+		additionalCIDRSets:        additionalCIDRSets,
+		nodeCIDRMaskSizeOverrides: allocatorParams.NodeCIDRMaskSizeOverrides,
+		nodeLister:                nodeInformer.Lister(),
+		nodesSynced:               nodeInformer.Informer().HasSynced,
+		nodeCIDRUpdateChannel:     make(chan nodeReservedCIDRs, cidrUpdateQueueSize),
+		recorder:                  recorder,
+		nodesInProcessing:         sets.NewString(),
+		pendingCIDRs:              sets.NewString(),
+		leakReconcilePeriod:       allocatorParams.LeakReconcilePeriod,
+		suspectedLeaks:            sets.NewString(),
 	}
+	registerCIDRLeakMetrics()
+	registerAllocationMetrics()
 
 	if allocatorParams.ServiceCIDR != nil {
 		ra.filterOutServiceRange(allocatorParams.ServiceCIDR)
@@ -179,6 +225,10 @@ func (r *rangeAllocator) Run(stopCh <-chan struct{}) {
 	for i := 0; i < cidrUpdateWorkers; i++ {
 		go r.worker(stopCh)
 	}
+	if r.leakReconcilePeriod > 0 {
+		go wait.Until(r.reconcileLeakedCIDRs, r.leakReconcilePeriod, stopCh)
+	}
+	go wait.Until(r.reportPodRangeUsage, podRangeUsagePeriod, stopCh)
 
 	<-stopCh
 }
@@ -194,7 +244,9 @@ func (r *rangeAllocator) worker(stopChan <-chan struct{}) {
 			if err := r.updateCIDRsAllocation(workItem); err != nil {
 				// Requeue the failed node for update again.
 				r.nodeCIDRUpdateChannel <- workItem
+				continue
 			}
+			r.setPending(workItem.allocatedCIDRs, false)
 		case <-stopChan:
 			return
 		}
@@ -217,6 +269,129 @@ func (r *rangeAllocator) removeNodeFromProcessing(nodeName string) {
 	r.nodesInProcessing.Delete(nodeName)
 }
 
+// reportPodRangeUsage reports the usage of the cluster CIDRs.
+func (r *rangeAllocator) reportPodRangeUsage() {
+	for _, cidrSet := range r.allCIDRSets() {
+		capacity, allocated := cidrSet.AddressUsage()
+		setPodRangeUsage(cidrSet.ClusterCIDR().String(), capacity, allocated)
+	}
+}
+
+// allocateNext allocates a node CIDR of the mask size, the one of the
+// cidrSet if 0, from the idx-th cluster CIDR, or from the first of its
+// additional blocks which isn't exhausted and whose node CIDRs are not
+// larger.
+func (r *rangeAllocator) allocateNext(idx, maskSize int) (*net.IPNet, error) {
+	var podCIDR *net.IPNet
+	var err error
+	for _, cidrSet := range append([]*cidrset.CidrSet{r.cidrSets[idx]}, r.additionalCIDRSets[idx]...) {
+		if maskSize == 0 {
+			podCIDR, err = cidrSet.AllocateNext()
+		} else {
+			podCIDR, err = cidrSet.AllocateNextOfSize(maskSize)
+		}
+		if err != cidrset.ErrCIDRRangeNoCIDRsRemaining && err != cidrset.ErrCIDRSetMaskSizeOutOfRange {
+			break
+		}
+	}
+	return podCIDR, err
+}
+
+// validateNodeCIDRMaskSizeOverrides checks that the overrides have a mask
+// size for each cluster CIDR, which is not smaller than the cluster CIDR nor
+// larger than its node CIDR mask size: a node CIDR of the override spans one
+// or more node CIDRs of the cidrSet.
+func validateNodeCIDRMaskSizeOverrides(params CIDRAllocatorParams) error {
+	for _, o := range params.NodeCIDRMaskSizeOverrides {
+		if len(o.MaskSizes) != len(params.ClusterCIDRs) {
+			return fmt.Errorf("node CIDR mask size override %v has %d mask sizes, want one for each of the %d cluster CIDRs", o.Selector, len(o.MaskSizes), len(params.ClusterCIDRs))
+		}
+		for idx, maskSize := range o.MaskSizes {
+			ones, _ := params.ClusterCIDRs[idx].Mask.Size()
+			if maskSize < ones || maskSize > params.NodeCIDRMaskSizes[idx] {
+				return fmt.Errorf("node CIDR mask size override %v: mask size %d of cluster CIDR %v not in [%d, %d]", o.Selector, maskSize, params.ClusterCIDRs[idx], ones, params.NodeCIDRMaskSizes[idx])
+			}
+		}
+	}
+	return nil
+}
+
+// cidrSetOf returns the cidrSet of the idx-th cluster CIDR or of its
+// additional block which contains the node CIDR. The one of the cluster CIDR
+// is returned if none does, to report the CIDR as out of range.
+func (r *rangeAllocator) cidrSetOf(idx int, cidr *net.IPNet) *cidrset.CidrSet {
+	for _, cidrSet := range r.additionalCIDRSets[idx] {
+		if cidrSet.ClusterCIDR().Contains(cidr.IP) {
+			return cidrSet
+		}
+	}
+	return r.cidrSets[idx]
+}
+
+// allCIDRSets returns the cidrSets of the cluster CIDRs and of their
+// additional blocks.
+func (r *rangeAllocator) allCIDRSets() []*cidrset.CidrSet {
+	all := append([]*cidrset.CidrSet{}, r.cidrSets...)
+	for _, cidrSets := range r.additionalCIDRSets {
+		all = append(all, cidrSets...)
+	}
+	return all
+}
+
+// newAdditionalCIDRSets returns the cidrSets of the additional cluster CIDR
+// blocks of the params by index of the cluster CIDR of their IP family.
+func newAdditionalCIDRSets(params CIDRAllocatorParams) ([][]*cidrset.CidrSet, error) {
+	additional := make([][]*cidrset.CidrSet, len(params.ClusterCIDRs))
+	for i, block := range params.AdditionalClusterCIDRs {
+		idx := -1
+		for j, cidr := range params.ClusterCIDRs {
+			if netutils.IsIPv6CIDR(cidr) == netutils.IsIPv6CIDR(block.CIDR) {
+				idx = j
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("cluster CIDR block %v has no cluster CIDR of its IP family", block.CIDR)
+		}
+		for _, cidr := range params.ClusterCIDRs {
+			if cidrsOverlap(cidr, block.CIDR) {
+				return nil, fmt.Errorf("cluster CIDR block %v overlaps with cluster CIDR %v", block.CIDR, cidr)
+			}
+		}
+		for _, other := range params.AdditionalClusterCIDRs[:i] {
+			if cidrsOverlap(other.CIDR, block.CIDR) {
+				return nil, fmt.Errorf("cluster CIDR block %v overlaps with cluster CIDR block %v", block.CIDR, other.CIDR)
+			}
+		}
+		maskSize := block.NodeCIDRMaskSize
+		if maskSize == 0 {
+			maskSize = params.NodeCIDRMaskSizes[idx]
+		}
+		if ones, _ := block.CIDR.Mask.Size(); ones > maskSize {
+			return nil, fmt.Errorf("cluster CIDR block %v is smaller than its node CIDRs of mask size %d", block.CIDR, maskSize)
+		}
+		cidrSet, err := cidrset.NewCIDRSet(block.CIDR, maskSize)
+		if err != nil {
+			return nil, fmt.Errorf("cluster CIDR block %v: %v", block.CIDR, err)
+		}
+		additional[idx] = append(additional[idx], cidrSet)
+	}
+	return additional, nil
+}
+
+// setPending marks the CIDRs as pending assignment or not.
+func (r *rangeAllocator) setPending(cidrs []*net.IPNet, pending bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, cidr := range cidrs {
+		if pending {
+			r.pendingCIDRs.Insert(cidr.String())
+		} else {
+			r.pendingCIDRs.Delete(cidr.String())
+		}
+	}
+}
+
 // marks node.PodCIDRs[...] as used in allocator's tracked cidrSet
 func (r *rangeAllocator) occupyCIDRs(node *v1.Node) error {
 	defer r.removeNodeFromProcessing(node.Name)
@@ -235,7 +410,7 @@ func (r *rangeAllocator) occupyCIDRs(node *v1.Node) error {
 			return fmt.Errorf("node:%s has an allocated cidr: %v at index:%v that does not exist in cluster cidrs configuration", node.Name, cidr, idx)
 		}
 
-		if err := r.cidrSets[idx].Occupy(podCIDR); err != nil {
+		if err := r.cidrSetOf(idx, podCIDR).Occupy(podCIDR); err != nil {
 			return fmt.Errorf("failed to mark cidr[%v] at idx [%v] as occupied for node: %v: %v", podCIDR, idx, node.Name, err)
 		}
 	}
@@ -261,19 +436,26 @@ func (r *rangeAllocator) AllocateOrOccupyCIDR(node *v1.Node) error {
 	allocated := nodeReservedCIDRs{
 		nodeName:       node.Name,
 		allocatedCIDRs: make([]*net.IPNet, len(r.cidrSets)),
+		allocatedAt:    time.Now(),
 	}
 
+	maskSizes := nodeCIDRMaskSizes(r.nodeCIDRMaskSizeOverrides, node)
 	for idx := range r.cidrSets {
-		podCIDR, err := r.cidrSets[idx].AllocateNext()
+		maskSize := 0
+		if maskSizes != nil {
+			maskSize = maskSizes[idx]
+		}
+		podCIDR, err := r.allocateNext(idx, maskSize)
 		if err != nil {
 			r.removeNodeFromProcessing(node.Name)
-			nodeutil.RecordNodeStatusChange(r.recorder, node, "CIDRNotAvailable")
+			recordAllocationFailure(r.recorder, node, RangeAllocatorType, "CIDRNotAvailable")
 			return fmt.Errorf("failed to allocate cidr from cluster cidr at idx:%v: %v", idx, err)
 		}
 		allocated.allocatedCIDRs[idx] = podCIDR
 	}
 
 	//queue the assignment
+	r.setPending(allocated.allocatedCIDRs, true)
 	klog.V(4).Infof("Putting node %s with CIDR %v into the work queue", node.Name, allocated.allocatedCIDRs)
 	r.nodeCIDRUpdateChannel <- allocated
 	return nil
@@ -299,7 +481,7 @@ func (r *rangeAllocator) ReleaseCIDR(node *v1.Node) error {
 		}
 
 		klog.V(4).Infof("release CIDR %s for node:%v", cidr, node.Name)
-		if err = r.cidrSets[idx].Release(podCIDR); err != nil {
+		if err = r.cidrSetOf(idx, podCIDR).Release(podCIDR); err != nil {
 			return fmt.Errorf("error when releasing CIDR %v: %v", cidr, err)
 		}
 	}
@@ -325,6 +507,17 @@ func (r *rangeAllocator) filterOutServiceRange(serviceCIDR *net.IPNet) {
 			klog.Errorf("Error filtering out service cidr out cluster cidr:%v (index:%v) %v: %v", cidr, idx, serviceCIDR, err)
 		}
 	}
+	for _, cidrSets := range r.additionalCIDRSets {
+		for _, cidrSet := range cidrSets {
+			if !cidrsOverlap(cidrSet.ClusterCIDR(), serviceCIDR) {
+				continue
+			}
+			if err := cidrSet.Occupy(serviceCIDR); err != nil {
+				klog.Errorf("Error filtering out service cidr out cluster cidr block:%v %v: %v", cidrSet.ClusterCIDR(), serviceCIDR, err)
+			}
+		}
+	}
+	r.reservedCIDRs = append(r.reservedCIDRs, serviceCIDR)
 }
 
 // updateCIDRsAllocation assigns CIDR to Node and sends an update to the API server.
@@ -360,7 +553,7 @@ func (r *rangeAllocator) updateCIDRsAllocation(data nodeReservedCIDRs) error {
 	if len(node.Spec.PodCIDRs) != 0 {
 		klog.Errorf("Node %v already has a CIDR allocated %v. Releasing the new one.", node.Name, node.Spec.PodCIDRs)
 		for idx, cidr := range data.allocatedCIDRs {
-			if releaseErr := r.cidrSets[idx].Release(cidr); releaseErr != nil {
+			if releaseErr := r.cidrSetOf(idx, cidr).Release(cidr); releaseErr != nil {
 				klog.Errorf("Error when releasing CIDR idx:%v value: %v err:%v", idx, cidr, releaseErr)
 			}
 		}
@@ -371,19 +564,20 @@ func (r *rangeAllocator) updateCIDRsAllocation(data nodeReservedCIDRs) error {
 	for i := 0; i < cidrUpdateRetries; i++ {
 		if err = utilnode.PatchNodeCIDRs(r.client, types.NodeName(node.Name), cidrsString); err == nil {
 			klog.Infof("Set node %v PodCIDR to %v", node.Name, cidrsString)
+			observeAllocation(RangeAllocatorType, data.allocatedAt)
 			return nil
 		}
 	}
 	// failed release back to the pool
 	klog.Errorf("Failed to update node %v PodCIDR to %v after multiple attempts: %v", node.Name, cidrsString, err)
-	nodeutil.RecordNodeStatusChange(r.recorder, node, "CIDRAssignmentFailed")
+	recordAllocationFailure(r.recorder, node, RangeAllocatorType, "CIDRAssignmentFailed")
 	// We accept the fact that we may leak CIDRs here. This is safer than releasing
 	// them in case when we don't know if request went through.
 	// NodeController restart will return all falsely allocated CIDRs to the pool.
 	if !apierrors.IsServerTimeout(err) {
 		klog.Errorf("CIDR assignment for node %v failed: %v. Releasing allocated CIDR", node.Name, err)
 		for idx, cidr := range data.allocatedCIDRs {
-			if releaseErr := r.cidrSets[idx].Release(cidr); releaseErr != nil {
+			if releaseErr := r.cidrSetOf(idx, cidr).Release(cidr); releaseErr != nil {
 				klog.Errorf("Error releasing allocated CIDR for node %v: %v", node.Name, releaseErr)
 			}
 		}
@@ -297,6 +297,51 @@ func TestOccupyPreExistingCIDR(t *testing.T) {
 			expectedAllocatedCIDR: nil,
 			ctrlCreateFail:        true,
 		},
+		{
+			description: "success, IPv6-only",
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "node0",
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			allocatorParams: CIDRAllocatorParams{
+				ClusterCIDRs: func() []*net.IPNet {
+					_, clusterCIDRv6, _ := net.ParseCIDR("ace:cab:deca::/48")
+					return []*net.IPNet{clusterCIDRv6}
+				}(),
+				NodeCIDRMaskSizes: []int{64},
+				IPv6Only:          true,
+			},
+			ctrlCreateFail: false,
+		},
+		{
+			description: "fail, IPv4 cluster CIDR in an IPv6-only cluster",
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "node0",
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			allocatorParams: CIDRAllocatorParams{
+				ClusterCIDRs: func() []*net.IPNet {
+					_, clusterCIDRv4, _ := net.ParseCIDR("10.10.0.0/16")
+					_, clusterCIDRv6, _ := net.ParseCIDR("ace:cab:deca::/48")
+					return []*net.IPNet{clusterCIDRv4, clusterCIDRv6}
+				}(),
+				NodeCIDRMaskSizes: []int{24, 64},
+				IPv6Only:          true,
+			},
+			ctrlCreateFail: true,
+		},
 	}
 
 	// test function
@@ -411,6 +456,72 @@ func TestAllocateOrOccupyCIDRSuccess(t *testing.T) {
 				0: "127.123.234.76/30",
 			},
 		},
+		{
+			description: "Allocate from the additional cluster CIDR blocks once the cluster CIDR is exhausted",
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "node0",
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			allocatorParams: CIDRAllocatorParams{
+				ClusterCIDRs: func() []*net.IPNet {
+					_, clusterCIDR, _ := net.ParseCIDR("127.123.234.0/29")
+					return []*net.IPNet{clusterCIDR}
+				}(),
+				ServiceCIDR:          nil,
+				SecondaryServiceCIDR: nil,
+				NodeCIDRMaskSizes:    []int{30},
+				AdditionalClusterCIDRs: func() []ClusterCIDRBlock {
+					_, full, _ := net.ParseCIDR("127.123.235.0/30")
+					_, block, _ := net.ParseCIDR("127.124.0.0/24")
+					return []ClusterCIDRBlock{{CIDR: full}, {CIDR: block, NodeCIDRMaskSize: 28}}
+				}(),
+			},
+			allocatedCIDRs: map[int][]string{
+				0: {"127.123.234.0/30", "127.123.234.4/30", "127.123.235.0/30"},
+			},
+			expectedAllocatedCIDR: map[int]string{
+				0: "127.124.0.0/28",
+			},
+		},
+		{
+			description: "Allocate a larger aligned CIDR to the nodes matching a node CIDR mask size override",
+			fakeNodeHandler: &testutil.FakeNodeHandler{
+				Existing: []*v1.Node{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:   "node0",
+							Labels: map[string]string{"cloud.google.com/gke-nodepool": "high-density"},
+						},
+					},
+				},
+				Clientset: fake.NewSimpleClientset(),
+			},
+			allocatorParams: CIDRAllocatorParams{
+				ClusterCIDRs: func() []*net.IPNet {
+					_, clusterCIDR, _ := net.ParseCIDR("127.123.234.0/24")
+					return []*net.IPNet{clusterCIDR}
+				}(),
+				ServiceCIDR:          nil,
+				SecondaryServiceCIDR: nil,
+				NodeCIDRMaskSizes:    []int{30},
+				NodeCIDRMaskSizeOverrides: func() []NodeCIDRMaskSizeOverride {
+					overrides, _ := ParseNodeCIDRMaskSizeOverrides([]string{"cloud.google.com/gke-nodepool=high-density:28"})
+					return overrides
+				}(),
+			},
+			allocatedCIDRs: map[int][]string{
+				0: {"127.123.234.4/30"},
+			},
+			expectedAllocatedCIDR: map[int]string{
+				0: "127.123.234.16/28",
+			},
+		},
 		{
 			description: "Dualstack CIDRs v4,v6",
 			fakeNodeHandler: &testutil.FakeNodeHandler{
@@ -560,7 +671,7 @@ func TestAllocateOrOccupyCIDRSuccess(t *testing.T) {
 				if err != nil {
 					t.Fatalf("%v: unexpected error when parsing CIDR %v: %v", tc.description, allocated, err)
 				}
-				if err = rangeAllocator.cidrSets[idx].Occupy(cidr); err != nil {
+				if err = rangeAllocator.cidrSetOf(idx, cidr).Occupy(cidr); err != nil {
 					t.Fatalf("%v: unexpected error when occupying CIDR %v: %v", tc.description, allocated, err)
 				}
 			}
@@ -71,6 +71,8 @@ type Controller struct {
 // This method returns an error if it is unable to initialize the CIDR bitmap with
 // podCIDRs it has already allocated to nodes. Since we don't allow podCIDR changes
 // currently, this should be handled as a fatal error.
+// The CIDRs and mask sizes of allocatorParams are the ones of the other
+// arguments, its other fields are passed to the CIDR allocator as is.
 func NewNodeIpamController(
 	nodeInformer coreinformers.NodeInformer,
 	cloud cloudprovider.Interface,
@@ -81,7 +83,8 @@ func NewNodeIpamController(
 	serviceCIDR *net.IPNet,
 	secondaryServiceCIDR *net.IPNet,
 	nodeCIDRMaskSizes []int,
-	allocatorType ipam.CIDRAllocatorType) (*Controller, error) {
+	allocatorType ipam.CIDRAllocatorType,
+	allocatorParams ipam.CIDRAllocatorParams) (*Controller, error) {
 
 	if kubeClient == nil {
 		klog.Fatalf("kubeClient is nil when starting Controller")
@@ -96,8 +99,8 @@ func NewNodeIpamController(
 			Interface: kubeClient.CoreV1().Events(""),
 		})
 
-	// Cloud CIDR allocator does not rely on clusterCIDR or nodeCIDRMaskSize for allocation.
-	if allocatorType != ipam.CloudAllocatorType {
+	// Cloud and external CIDR allocators do not rely on clusterCIDR or nodeCIDRMaskSize for allocation.
+	if allocatorType != ipam.CloudAllocatorType && allocatorType != ipam.ExternalAllocatorType {
 		if len(clusterCIDRs) == 0 {
 			klog.Fatal("Controller: Must specify --cluster-cidr if --allocate-node-cidrs is set")
 		}
@@ -126,12 +129,10 @@ func NewNodeIpamController(
 	} else {
 		var err error
 
-		allocatorParams := ipam.CIDRAllocatorParams{
-			ClusterCIDRs:         clusterCIDRs,
-			ServiceCIDR:          ic.serviceCIDR,
-			SecondaryServiceCIDR: ic.secondaryServiceCIDR,
-			NodeCIDRMaskSizes:    nodeCIDRMaskSizes,
-		}
+		allocatorParams.ClusterCIDRs = clusterCIDRs
+		allocatorParams.ServiceCIDR = ic.serviceCIDR
+		allocatorParams.SecondaryServiceCIDR = ic.secondaryServiceCIDR
+		allocatorParams.NodeCIDRMaskSizes = nodeCIDRMaskSizes
 
 		ic.cidrAllocator, err = ipam.New(kubeClient, cloud, nodeInformer, nwInformer, gnpInformer, ic.allocatorType, allocatorParams)
 		if err != nil {
@@ -17,6 +17,7 @@ limitations under the License.
 package credentialconfig
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -28,6 +29,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/klog/v2"
 )
@@ -55,6 +57,9 @@ type DockerConfigEntry struct {
 	Password string
 	Email    string
 	Provider DockerConfigProvider
+	// Expiry is the time at which the credentials expire, if known.
+	// It is not serialized.
+	Expiry time.Time
 }
 
 var (
@@ -189,8 +194,8 @@ func (he *HTTPError) Error() string {
 }
 
 // ReadURL read contents from given url
-func ReadURL(url string, client *http.Client, header *http.Header) (body []byte, err error) {
-	req, err := http.NewRequest("GET", url, nil)
+func ReadURL(ctx context.Context, url string, client *http.Client, header *http.Header) (body []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -225,8 +230,8 @@ func ReadURL(url string, client *http.Client, header *http.Header) (body []byte,
 }
 
 // ReadDockerConfigFileFromURL read a docker config file from the given url
-func ReadDockerConfigFileFromURL(url string, client *http.Client, header *http.Header) (cfg DockerConfig, err error) {
-	if contents, err := ReadURL(url, client, header); err == nil {
+func ReadDockerConfigFileFromURL(ctx context.Context, url string, client *http.Client, header *http.Header) (cfg DockerConfig, err error) {
+	if contents, err := ReadURL(ctx, url, client, header); err == nil {
 		return ReadDockerConfigFileFromBytes(contents)
 	}
 
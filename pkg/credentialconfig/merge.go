@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialconfig
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// NamedDockerConfigProvider is a DockerConfigProvider with the name of the
+// credential source it reads, used to report conflicts.
+type NamedDockerConfigProvider struct {
+	Name     string
+	Provider DockerConfigProvider
+}
+
+// CredentialConflict reports a registry for which several sources provided
+// credentials of different users.
+type CredentialConflict struct {
+	Registry string `json:"registry"`
+	// Sources are the sources that provided credentials for the registry, in
+	// precedence order.
+	Sources []string `json:"sources"`
+	// Selected is the source whose credentials are used.
+	Selected string `json:"selected"`
+}
+
+// MergingDockerConfigProvider implements DockerConfigProvider by merging the
+// DockerConfigs of several providers in precedence order.
+type MergingDockerConfigProvider struct {
+	// Providers are the credential sources, from the highest precedence to
+	// the lowest.
+	Providers []NamedDockerConfigProvider
+
+	mu        sync.Mutex
+	conflicts []CredentialConflict
+}
+
+// Enabled implements DockerConfigProvider. The provider is enabled if any of
+// its providers is.
+func (m *MergingDockerConfigProvider) Enabled(ctx context.Context) bool {
+	for _, p := range m.Providers {
+		if p.Provider.Enabled(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+// Provide implements DockerConfigProvider.
+func (m *MergingDockerConfigProvider) Provide(ctx context.Context, image string) DockerConfig {
+	var configs []NamedDockerConfig
+	for _, p := range m.Providers {
+		if !p.Provider.Enabled(ctx) {
+			continue
+		}
+		configs = append(configs, NamedDockerConfig{Name: p.Name, Config: p.Provider.Provide(ctx, image)})
+	}
+	cfg, conflicts := MergeDockerConfigs(configs)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conflicts = conflicts
+	return cfg
+}
+
+// Conflicts returns the conflicts found by the last call to Provide.
+func (m *MergingDockerConfigProvider) Conflicts() []CredentialConflict {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conflicts
+}
+
+// NamedDockerConfig is the DockerConfig provided by a named credential source.
+type NamedDockerConfig struct {
+	Name   string
+	Config DockerConfig
+}
+
+// MergeDockerConfigs merges the configs, given from the highest precedence to
+// the lowest, into a single entry per registry. Registry keys that only differ
+// by their scheme or a trailing slash, e.g. "https://gcr.io/" and "gcr.io",
+// are the same registry.
+//
+// Credentials of the same user that only differ by their secret are treated
+// as a key rotation: the one expiring last is used, or the one with the
+// highest precedence if their expiry is not known. Credentials of different
+// users are a conflict: the one with the highest precedence is used, and the
+// conflict is logged and returned.
+func MergeDockerConfigs(configs []NamedDockerConfig) (DockerConfig, []CredentialConflict) {
+	type candidate struct {
+		source string
+		key    string
+		entry  DockerConfigEntry
+	}
+	candidates := map[string][]candidate{}
+	for _, c := range configs {
+		// Sort the keys so that the same registry given twice by a source
+		// resolves the same way every time.
+		keys := make([]string, 0, len(c.Config))
+		for key := range c.Config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			registry := normalizeRegistry(key)
+			candidates[registry] = append(candidates[registry], candidate{source: c.Name, key: key, entry: c.Config[key]})
+		}
+	}
+
+	merged := DockerConfig{}
+	var conflicts []CredentialConflict
+	for registry, cs := range candidates {
+		selected := cs[0]
+		conflicting := false
+		for _, c := range cs[1:] {
+			switch {
+			case c.entry.Username != selected.entry.Username:
+				conflicting = true
+			case c.entry.Password != selected.entry.Password && c.entry.Expiry.After(selected.entry.Expiry):
+				klog.V(2).Infof("Using the rotated credentials of registry %s from %s, which expire after the ones from %s", registry, c.source, selected.source)
+				selected = c
+			}
+		}
+		merged[selected.key] = selected.entry
+		if conflicting {
+			conflict := CredentialConflict{Registry: registry, Selected: selected.source}
+			for _, c := range cs {
+				conflict.Sources = append(conflict.Sources, c.source)
+			}
+			klog.Warningf("Conflicting credentials of different users for registry %s from %v, using the ones from %s", registry, conflict.Sources, selected.source)
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Registry < conflicts[j].Registry })
+	return merged, conflicts
+}
+
+// normalizeRegistry returns the registry of a DockerConfig key, without its
+// scheme and trailing slash.
+func normalizeRegistry(key string) string {
+	registry := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	return strings.TrimSuffix(registry, "/")
+}
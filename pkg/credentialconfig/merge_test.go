@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialconfig
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type staticProvider struct {
+	enabled bool
+	config  DockerConfig
+}
+
+func (s *staticProvider) Enabled(ctx context.Context) bool {
+	return s.enabled
+}
+
+func (s *staticProvider) Provide(ctx context.Context, image string) DockerConfig {
+	return s.config
+}
+
+func TestMergeDockerConfigs(t *testing.T) {
+	now := time.Now()
+	configs := []NamedDockerConfig{
+		{Name: "dockercfg", Config: DockerConfig{
+			"https://registry.example.com/": {Username: "alice", Password: "a"},
+			"rotated.example.com":           {Username: "_token", Password: "old", Expiry: now},
+			"only-first.example.com":        {Username: "carol", Password: "c"},
+		}},
+		{Name: "gcr", Config: DockerConfig{
+			"registry.example.com":    {Username: "bob", Password: "b"},
+			"rotated.example.com":     {Username: "_token", Password: "new", Expiry: now.Add(time.Hour)},
+			"only-second.example.com": {Username: "dave", Password: "d"},
+		}},
+	}
+
+	merged, conflicts := MergeDockerConfigs(configs)
+
+	want := DockerConfig{
+		"https://registry.example.com/": {Username: "alice", Password: "a"},
+		"rotated.example.com":           {Username: "_token", Password: "new", Expiry: now.Add(time.Hour)},
+		"only-first.example.com":        {Username: "carol", Password: "c"},
+		"only-second.example.com":       {Username: "dave", Password: "d"},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("got merged config %+v, want %+v", merged, want)
+	}
+	wantConflicts := []CredentialConflict{{Registry: "registry.example.com", Sources: []string{"dockercfg", "gcr"}, Selected: "dockercfg"}}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("got conflicts %+v, want %+v", conflicts, wantConflicts)
+	}
+}
+
+func TestMergeDockerConfigsIsDeterministic(t *testing.T) {
+	configs := []NamedDockerConfig{{Name: "dockercfg", Config: DockerConfig{
+		"gcr.io":          {Username: "alice", Password: "a"},
+		"https://gcr.io":  {Username: "bob", Password: "b"},
+		"https://gcr.io/": {Username: "carol", Password: "c"},
+	}}}
+	for i := 0; i < 20; i++ {
+		merged, conflicts := MergeDockerConfigs(configs)
+		if want := (DockerConfig{"gcr.io": {Username: "alice", Password: "a"}}); !reflect.DeepEqual(merged, want) {
+			t.Fatalf("got merged config %+v, want %+v", merged, want)
+		}
+		if len(conflicts) != 1 || conflicts[0].Selected != "dockercfg" {
+			t.Fatalf("got conflicts %+v, want one conflict for gcr.io", conflicts)
+		}
+	}
+}
+
+func TestMergingDockerConfigProvider(t *testing.T) {
+	provider := &MergingDockerConfigProvider{Providers: []NamedDockerConfigProvider{
+		{Name: "disabled", Provider: &staticProvider{config: DockerConfig{"gcr.io": {Username: "alice"}}}},
+		{Name: "dockercfg", Provider: &staticProvider{enabled: true, config: DockerConfig{"gcr.io": {Username: "bob"}}}},
+		{Name: "gcr", Provider: &staticProvider{enabled: true, config: DockerConfig{"gcr.io": {Username: "_token"}}}},
+	}}
+	if !provider.Enabled(context.Background()) {
+		t.Fatal("expected the provider to be enabled")
+	}
+
+	cfg := provider.Provide(context.Background(), "gcr.io/project/image")
+
+	if got := cfg["gcr.io"].Username; got != "bob" {
+		t.Errorf("got user %q, want the one of the first enabled source", got)
+	}
+	want := []CredentialConflict{{Registry: "gcr.io", Sources: []string{"dockercfg", "gcr"}, Selected: "dockercfg"}}
+	if got := provider.Conflicts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got conflicts %+v, want %+v", got, want)
+	}
+}
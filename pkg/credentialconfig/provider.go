@@ -17,6 +17,7 @@ limitations under the License.
 package credentialconfig
 
 import (
+	"context"
 	"reflect"
 	"sync"
 	"time"
@@ -28,14 +29,16 @@ import (
 // to materialize 'dockercfg' credentials.
 type DockerConfigProvider interface {
 	// Enabled returns true if the config provider is enabled.
-	// Implementations can be blocking - e.g. metadata server unavailable.
-	Enabled() bool
+	// Implementations can be blocking - e.g. metadata server unavailable -
+	// until ctx is done.
+	Enabled(ctx context.Context) bool
 	// Provide returns docker configuration.
-	// Implementations can be blocking - e.g. metadata server unavailable.
+	// Implementations can be blocking - e.g. metadata server unavailable -
+	// until ctx is done.
 	// The image is passed in as context in the event that the
 	// implementation depends on information in the image name to return
 	// credentials; implementations are safe to ignore the image.
-	Provide(image string) DockerConfig
+	Provide(ctx context.Context, image string) DockerConfig
 }
 
 // CachingDockerConfigProvider implements DockerConfigProvider by composing
@@ -49,32 +52,81 @@ type CachingDockerConfigProvider struct {
 	// If nil, all configs are treated as cacheable.
 	ShouldCache func(DockerConfig) bool
 
+	// RefreshBefore is how long before expiration a call to Provide starts
+	// refreshing the cached DockerConfig asynchronously, so that the first
+	// call after expiration does not pay for the refresh. If zero, the cache
+	// is only refreshed once it has expired.
+	RefreshBefore time.Duration
+
 	// cache fields
 	cacheDockerConfig DockerConfig
 	expiration        time.Time
+	refreshing        bool
+	refreshFailures   int
 	mu                sync.Mutex
 }
 
+// refreshFailureThreshold is the number of consecutive failed asynchronous
+// refreshes after which every further failure is logged as a warning.
+const refreshFailureThreshold = 3
+
 // Enabled implements dockerConfigProvider
-func (d *CachingDockerConfigProvider) Enabled() bool {
-	return d.Provider.Enabled()
+func (d *CachingDockerConfigProvider) Enabled(ctx context.Context) bool {
+	return d.Provider.Enabled(ctx)
 }
 
 // Provide implements dockerConfigProvider
-func (d *CachingDockerConfigProvider) Provide(image string) DockerConfig {
+func (d *CachingDockerConfigProvider) Provide(ctx context.Context, image string) DockerConfig {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	// If the cache hasn't expired, return our cache
-	if time.Now().Before(d.expiration) {
+	// If the cache hasn't expired, return our cache, refreshing it ahead of
+	// its expiration if it is about to expire.
+	now := time.Now()
+	if now.Before(d.expiration) {
+		if d.RefreshBefore > 0 && !d.refreshing && !now.Add(d.RefreshBefore).Before(d.expiration) {
+			d.refreshing = true
+			go d.refreshAhead(context.WithoutCancel(ctx), image)
+		}
 		return d.cacheDockerConfig
 	}
 
 	klog.V(2).Infof("Refreshing cache for provider: %v", reflect.TypeOf(d.Provider).String())
-	config := d.Provider.Provide(image)
-	if d.ShouldCache == nil || d.ShouldCache(config) {
-		d.cacheDockerConfig = config
-		d.expiration = time.Now().Add(d.Lifetime)
-	}
+	config := d.Provider.Provide(ctx, image)
+	d.storeLocked(config)
 	return config
 }
+
+// storeLocked caches config if it is cacheable and returns whether it was
+// cached. d.mu must be held.
+func (d *CachingDockerConfigProvider) storeLocked(config DockerConfig) bool {
+	if d.ShouldCache != nil && !d.ShouldCache(config) {
+		return false
+	}
+	d.cacheDockerConfig = config
+	d.expiration = time.Now().Add(d.Lifetime)
+	return true
+}
+
+// refreshAhead refreshes the cached DockerConfig without holding d.mu, so
+// that callers of Provide keep being served from the cache meanwhile.
+// Repeated failures to obtain a cacheable config are logged.
+func (d *CachingDockerConfigProvider) refreshAhead(ctx context.Context, image string) {
+	klog.V(2).Infof("Refreshing cache ahead of expiration for provider: %v", reflect.TypeOf(d.Provider).String())
+	config := d.Provider.Provide(ctx, image)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refreshing = false
+	if d.storeLocked(config) {
+		if d.refreshFailures >= refreshFailureThreshold {
+			klog.Infof("Refreshing cache for provider %v succeeded after %d failures", reflect.TypeOf(d.Provider).String(), d.refreshFailures)
+		}
+		d.refreshFailures = 0
+		return
+	}
+	d.refreshFailures++
+	if d.refreshFailures >= refreshFailureThreshold {
+		klog.Warningf("Refreshing cache for provider %v failed %d consecutive times", reflect.TypeOf(d.Provider).String(), d.refreshFailures)
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package credentialconfig
 
 import (
+	"context"
+	"sync"
 	"testing"
 	"time"
 )
@@ -26,12 +28,12 @@ type testProvider struct {
 }
 
 // Enabled implements dockerConfigProvider
-func (d *testProvider) Enabled() bool {
+func (d *testProvider) Enabled(ctx context.Context) bool {
 	return true
 }
 
 // Provide implements dockerConfigProvider
-func (d *testProvider) Provide(image string) DockerConfig {
+func (d *testProvider) Provide(ctx context.Context, image string) DockerConfig {
 	d.Count++
 	return DockerConfig{}
 }
@@ -47,33 +49,156 @@ func TestCachingProvider(t *testing.T) {
 	}
 
 	image := "image"
+	ctx := context.Background()
 
 	if provider.Count != 0 {
 		t.Errorf("Unexpected number of Provide calls: %v", provider.Count)
 	}
-	cache.Provide(image)
-	cache.Provide(image)
-	cache.Provide(image)
-	cache.Provide(image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
 	if provider.Count != 1 {
 		t.Errorf("Unexpected number of Provide calls: %v", provider.Count)
 	}
 
 	time.Sleep(cache.Lifetime)
-	cache.Provide(image)
-	cache.Provide(image)
-	cache.Provide(image)
-	cache.Provide(image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
 	if provider.Count != 2 {
 		t.Errorf("Unexpected number of Provide calls: %v", provider.Count)
 	}
 
 	time.Sleep(cache.Lifetime)
-	cache.Provide(image)
-	cache.Provide(image)
-	cache.Provide(image)
-	cache.Provide(image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
 	if provider.Count != 3 {
 		t.Errorf("Unexpected number of Provide calls: %v", provider.Count)
 	}
 }
+
+type refreshTestProvider struct {
+	mu        sync.Mutex
+	count     int
+	cacheable bool
+}
+
+// Enabled implements dockerConfigProvider
+func (d *refreshTestProvider) Enabled(ctx context.Context) bool {
+	return true
+}
+
+// Provide implements dockerConfigProvider
+func (d *refreshTestProvider) Provide(ctx context.Context, image string) DockerConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count++
+	if !d.cacheable {
+		return DockerConfig{}
+	}
+	return DockerConfig{"registry": DockerConfigEntry{Username: "user", Password: "pass"}}
+}
+
+func (d *refreshTestProvider) calls() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count
+}
+
+func (d *refreshTestProvider) setCacheable(cacheable bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cacheable = cacheable
+}
+
+// expireSoon moves the cache within RefreshBefore of its expiration.
+func expireSoon(cache *CachingDockerConfigProvider) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.expiration = time.Now().Add(time.Minute)
+}
+
+// waitForRefresh waits for the asynchronous refresh of cache to complete and
+// returns the number of consecutive refresh failures.
+func waitForRefresh(t *testing.T, cache *CachingDockerConfigProvider) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cache.mu.Lock()
+		failures, refreshing := cache.refreshFailures, cache.refreshing
+		cache.mu.Unlock()
+		if !refreshing {
+			return failures
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the refresh to complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCachingProviderRefreshAhead(t *testing.T) {
+	provider := &refreshTestProvider{cacheable: true}
+	cache := &CachingDockerConfigProvider{
+		Provider:      provider,
+		Lifetime:      time.Hour,
+		RefreshBefore: 5 * time.Minute,
+		ShouldCache: func(cfg DockerConfig) bool {
+			return len(cfg) > 0
+		},
+	}
+
+	image := "image"
+	ctx := context.Background()
+
+	cache.Provide(ctx, image)
+	cache.Provide(ctx, image)
+	if provider.calls() != 1 {
+		t.Errorf("Unexpected number of Provide calls: %v", provider.calls())
+	}
+
+	// Provide serves the cached config and refreshes it asynchronously.
+	expireSoon(cache)
+	if got := cache.Provide(ctx, image); len(got) == 0 {
+		t.Errorf("Expected the cached config to be served, got %v", got)
+	}
+	if failures := waitForRefresh(t, cache); failures != 0 {
+		t.Errorf("Unexpected number of refresh failures: %v", failures)
+	}
+	if provider.calls() != 2 {
+		t.Errorf("Unexpected number of Provide calls: %v", provider.calls())
+	}
+
+	// The refreshed cache is served without calling the provider again.
+	cache.Provide(ctx, image)
+	if provider.calls() != 2 {
+		t.Errorf("Unexpected number of Provide calls: %v", provider.calls())
+	}
+
+	// Failed refreshes keep the cached config and are counted.
+	provider.setCacheable(false)
+	for i := 1; i <= refreshFailureThreshold; i++ {
+		expireSoon(cache)
+		if got := cache.Provide(ctx, image); len(got) == 0 {
+			t.Errorf("Expected the cached config to be served, got %v", got)
+		}
+		if failures := waitForRefresh(t, cache); failures != i {
+			t.Errorf("Unexpected number of refresh failures: got %v, want %v", failures, i)
+		}
+	}
+
+	// A successful refresh resets the failure count.
+	provider.setCacheable(true)
+	expireSoon(cache)
+	cache.Provide(ctx, image)
+	if failures := waitForRefresh(t, cache); failures != 0 {
+		t.Errorf("Unexpected number of refresh failures: %v", failures)
+	}
+	if want := 3 + refreshFailureThreshold; provider.calls() != want {
+		t.Errorf("Unexpected number of Provide calls: got %v, want %v", provider.calls(), want)
+	}
+}
@@ -19,9 +19,11 @@ limitations under the License.
 package csrmetrics
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	capi "k8s.io/api/certificates/v1beta1"
 )
 
 // SigningStatus is a status string of the CSR signing metric.
@@ -33,6 +35,17 @@ type ApprovalStatus string
 // OutboundRPCStatus is a status string of the outbound RPC metric.
 type OutboundRPCStatus string
 
+// Decision is a decision string of the CSR decision metric.
+type Decision string
+
+// DenialReason is a reason string of the CSR decision metric, telling which
+// check denied or quarantined a CSR.
+type DenialReason string
+
+// VerificationStatus is a status string of the attestation verification
+// metric.
+type VerificationStatus string
+
 // Status constants for metrics.
 const (
 	SigningStatusSignError   SigningStatus = "sign_error"
@@ -54,44 +67,183 @@ const (
 	OutboundRPCStatusNotFound OutboundRPCStatus = "not_found"
 	OutboundRPCStatusError    OutboundRPCStatus = "error"
 	OutboundRPCStatusOK       OutboundRPCStatus = "ok"
+
+	DecisionApprove Decision = "approve"
+	DecisionDeny    Decision = "deny"
+	DecisionIgnore  Decision = "ignore"
+	DecisionError   Decision = "error"
+	// DecisionQuarantine holds a suspicious CSR pending, neither approved
+	// nor denied, until an operator overrides it.
+	DecisionQuarantine Decision = "quarantine"
+
+	DenialReasonNone                DenialReason = "none"
+	DenialReasonValidation          DenialReason = "validation"
+	DenialReasonPolicy              DenialReason = "policy"
+	DenialReasonVerificationWebhook DenialReason = "verification_webhook"
+	DenialReasonOverride            DenialReason = "override"
+	DenialReasonUnknownUsername     DenialReason = "unknown_username"
+	DenialReasonInstanceGroup       DenialReason = "instance_group"
+	DenialReasonRepeatSubmission    DenialReason = "repeat_submission"
+
+	VerificationStatusOK     VerificationStatus = "ok"
+	VerificationStatusReject VerificationStatus = "reject"
+	VerificationStatusError  VerificationStatus = "error"
+
+	// signerNameOther is the signer name label of the CSRs of signers not
+	// built into Kubernetes, so that requesters cannot grow the cardinality
+	// of the metrics.
+	signerNameOther = "other"
 )
 
+// MetricType is the type of a metric of the certificates controller.
+type MetricType string
+
+// Types of the metrics.
+const (
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeHistogram MetricType = "histogram"
+)
+
+// Definition describes a metric of the certificates controller, so that
+// operational tooling such as dashboards can be generated from the metrics
+// registered in code.
+type Definition struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels []string
+}
+
 var (
-	signingCount = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "csr_signing_count",
-		Help: "Count of signed CSRs",
-	}, []string{"status", "kind"})
-	signingLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "csr_signing_latencies",
-		Help: "Latency of CSR signer, in seconds",
-	}, []string{"status", "kind"})
-	approvalCount = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "csr_approval_count",
-		Help: "Count of approved, denied and ignored CSRs",
-	}, []string{"status", "kind"})
-	approvalLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "csr_approval_latencies",
-		Help: "Latency of CSR approver, in seconds",
-	}, []string{"status", "kind"})
-	outboundRPCCount = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "outbound_rpc_count",
-		Help: "Count of outbound RPCs to GCE and GKE.",
-	}, []string{"status", "kind"})
-	outboundRPCLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "outbound_rpc_latency",
-		Help: "Latency of outbound RPCs to GCE and GKE, in seconds",
-	}, []string{"status", "kind"})
+	signingCountDefinition = Definition{
+		Name:   "csr_signing_count",
+		Help:   "Count of signed CSRs",
+		Type:   MetricTypeCounter,
+		Labels: []string{"status", "kind"},
+	}
+	signingLatencyDefinition = Definition{
+		Name:   "csr_signing_latencies",
+		Help:   "Latency of CSR signer, in seconds",
+		Type:   MetricTypeHistogram,
+		Labels: []string{"status", "kind"},
+	}
+	approvalCountDefinition = Definition{
+		Name:   "csr_approval_count",
+		Help:   "Count of approved, denied and ignored CSRs",
+		Type:   MetricTypeCounter,
+		Labels: []string{"status", "kind"},
+	}
+	approvalLatencyDefinition = Definition{
+		Name:   "csr_approval_latencies",
+		Help:   "Latency of CSR approver, in seconds",
+		Type:   MetricTypeHistogram,
+		Labels: []string{"status", "kind"},
+	}
+	outboundRPCCountDefinition = Definition{
+		Name:   "outbound_rpc_count",
+		Help:   "Count of outbound RPCs to GCE and GKE.",
+		Type:   MetricTypeCounter,
+		Labels: []string{"status", "kind"},
+	}
+	outboundRPCLatencyDefinition = Definition{
+		Name:   "outbound_rpc_latency",
+		Help:   "Latency of outbound RPCs to GCE and GKE, in seconds",
+		Type:   MetricTypeHistogram,
+		Labels: []string{"status", "kind"},
+	}
+	observedCountDefinition = Definition{
+		Name:   "csr_observed_count",
+		Help:   "Count of pending CSRs observed by the node approver, by signer name",
+		Type:   MetricTypeCounter,
+		Labels: []string{"signer_name"},
+	}
+	decisionCountDefinition = Definition{
+		Name:   "csr_decision_count",
+		Help:   "Count of CSRs approved, denied, quarantined, ignored or failed by the node approver, by signer name and denial or quarantine reason",
+		Type:   MetricTypeCounter,
+		Labels: []string{"decision", "signer_name", "reason"},
+	}
+	dryRunDecisionCountDefinition = Definition{
+		Name:   "csr_dry_run_decision_count",
+		Help:   "Count of CSRs the node approver would have approved, denied, quarantined, ignored or failed in dry-run mode, by signer name and denial reason",
+		Type:   MetricTypeCounter,
+		Labels: []string{"decision", "signer_name", "reason"},
+	}
+	decisionLatencyDefinition = Definition{
+		Name:   "csr_decision_latencies",
+		Help:   "Latency of the decisions of the node approver, in seconds",
+		Type:   MetricTypeHistogram,
+		Labels: []string{"decision", "signer_name"},
+	}
+	attestationVerificationLatencyDefinition = Definition{
+		Name:   "csr_attestation_verification_latencies",
+		Help:   "Latency of the verification of CSRs against their GCE instance, in seconds",
+		Type:   MetricTypeHistogram,
+		Labels: []string{"status", "kind"},
+	}
+	unissuedAtStartupCountDefinition = Definition{
+		Name:   "csr_unissued_at_startup_count",
+		Help:   "Count of approved CSRs found without a certificate at startup, by signing status and whether the issuance was stalled",
+		Type:   MetricTypeCounter,
+		Labels: []string{"status", "stalled"},
+	}
+
+	signingCount           = newCounterVec(signingCountDefinition)
+	signingLatency         = newHistogramVec(signingLatencyDefinition)
+	approvalCount          = newCounterVec(approvalCountDefinition)
+	approvalLatency        = newHistogramVec(approvalLatencyDefinition)
+	outboundRPCCount       = newCounterVec(outboundRPCCountDefinition)
+	outboundRPCLatency     = newHistogramVec(outboundRPCLatencyDefinition)
+	unissuedAtStartupCount = newCounterVec(unissuedAtStartupCountDefinition)
+
+	observedCount                  = newCounterVec(observedCountDefinition)
+	decisionCount                  = newCounterVec(decisionCountDefinition)
+	dryRunDecisionCount            = newCounterVec(dryRunDecisionCountDefinition)
+	decisionLatency                = newHistogramVec(decisionLatencyDefinition)
+	attestationVerificationLatency = newHistogramVec(attestationVerificationLatencyDefinition)
 )
 
+func newCounterVec(d Definition) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: d.Name, Help: d.Help}, d.Labels)
+}
+
+func newHistogramVec(d Definition) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: d.Name, Help: d.Help}, d.Labels)
+}
+
+// registered are the metrics registered with their definitions.
+var registered = []struct {
+	definition Definition
+	collector  prometheus.Collector
+}{
+	{signingCountDefinition, signingCount},
+	{signingLatencyDefinition, signingLatency},
+	{approvalCountDefinition, approvalCount},
+	{approvalLatencyDefinition, approvalLatency},
+	{outboundRPCCountDefinition, outboundRPCCount},
+	{outboundRPCLatencyDefinition, outboundRPCLatency},
+	{unissuedAtStartupCountDefinition, unissuedAtStartupCount},
+	{observedCountDefinition, observedCount},
+	{decisionCountDefinition, decisionCount},
+	{dryRunDecisionCountDefinition, dryRunDecisionCount},
+	{decisionLatencyDefinition, decisionLatency},
+	{attestationVerificationLatencyDefinition, attestationVerificationLatency},
+}
+
 func init() {
-	prometheus.MustRegister(
-		signingCount,
-		signingLatency,
-		approvalCount,
-		approvalLatency,
-		outboundRPCCount,
-		outboundRPCLatency,
-	)
+	for _, m := range registered {
+		prometheus.MustRegister(m.collector)
+	}
+}
+
+// Definitions returns the definitions of the registered metrics, in
+// registration order.
+func Definitions() []Definition {
+	var definitions []Definition
+	for _, m := range registered {
+		definitions = append(definitions, m.definition)
+	}
+	return definitions
 }
 
 // SigningStartRecorder marks the start of a CSR signing operation. Caller is
@@ -126,3 +278,55 @@ func OutboundRPCStartRecorder(kind string) func(status OutboundRPCStatus) {
 		outboundRPCLatency.WithLabelValues(string(status), kind).Observe(time.Since(start).Seconds())
 	}
 }
+
+// RecordUnissuedAtStartup records the signing status of an approved CSR found
+// without a certificate at startup. stalled is whether the CSR was approved
+// long enough ago for its issuance to be considered stalled.
+func RecordUnissuedAtStartup(status SigningStatus, stalled bool) {
+	unissuedAtStartupCount.WithLabelValues(string(status), strconv.FormatBool(stalled)).Inc()
+}
+
+// DecisionStartRecorder records that the node approver observed a pending CSR
+// of the signer name, and marks the start of its decision. Caller is
+// responsible for calling the returned function, which records Prometheus
+// metrics for the decision.
+func DecisionStartRecorder(signerName string) func(decision Decision, reason DenialReason) {
+	signerName = signerNameLabel(signerName)
+	observedCount.WithLabelValues(signerName).Inc()
+	start := time.Now()
+	return func(decision Decision, reason DenialReason) {
+		decisionCount.WithLabelValues(string(decision), signerName, string(reason)).Inc()
+		decisionLatency.WithLabelValues(string(decision), signerName).Observe(time.Since(start).Seconds())
+	}
+}
+
+// DryRunDecisionStartRecorder is DecisionStartRecorder for the node approver
+// in dry-run mode, whose decisions are only recorded, separately from the
+// enforced ones.
+func DryRunDecisionStartRecorder(signerName string) func(decision Decision, reason DenialReason) {
+	signerName = signerNameLabel(signerName)
+	return func(decision Decision, reason DenialReason) {
+		dryRunDecisionCount.WithLabelValues(string(decision), signerName, string(reason)).Inc()
+	}
+}
+
+// AttestationVerificationStartRecorder marks the start of the verification of
+// a CSR against its GCE instance. Caller is responsible for calling the
+// returned function, which records Prometheus metrics for this operation.
+func AttestationVerificationStartRecorder(kind string) func(status VerificationStatus) {
+	start := time.Now()
+	return func(status VerificationStatus) {
+		attestationVerificationLatency.WithLabelValues(string(status), kind).Observe(time.Since(start).Seconds())
+	}
+}
+
+func signerNameLabel(signerName string) string {
+	switch signerName {
+	case capi.KubeAPIServerClientSignerName,
+		capi.KubeAPIServerClientKubeletSignerName,
+		capi.KubeletServingSignerName,
+		capi.LegacyUnknownSignerName:
+		return signerName
+	}
+	return signerNameOther
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csrmetrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDecisionStartRecorder(t *testing.T) {
+	const kubeletServing = "kubernetes.io/kubelet-serving"
+	for _, tc := range []struct {
+		signerName    string
+		wantLabel     string
+		decision      Decision
+		reason        DenialReason
+		wantObserved  float64
+		wantDecisions float64
+	}{
+		{
+			signerName:    kubeletServing,
+			wantLabel:     kubeletServing,
+			decision:      DecisionDeny,
+			reason:        DenialReasonPolicy,
+			wantObserved:  1,
+			wantDecisions: 1,
+		},
+		{
+			signerName:    kubeletServing,
+			wantLabel:     kubeletServing,
+			decision:      DecisionApprove,
+			reason:        DenialReasonNone,
+			wantObserved:  2,
+			wantDecisions: 1,
+		},
+		{
+			signerName:    kubeletServing,
+			wantLabel:     kubeletServing,
+			decision:      DecisionQuarantine,
+			reason:        DenialReasonRepeatSubmission,
+			wantObserved:  3,
+			wantDecisions: 1,
+		},
+		{
+			signerName:    "example.com/custom",
+			wantLabel:     signerNameOther,
+			decision:      DecisionIgnore,
+			reason:        DenialReasonNone,
+			wantObserved:  1,
+			wantDecisions: 1,
+		},
+	} {
+		DecisionStartRecorder(tc.signerName)(tc.decision, tc.reason)
+		if got := testutil.ToFloat64(observedCount.WithLabelValues(tc.wantLabel)); got != tc.wantObserved {
+			t.Errorf("%s: got %v observed CSRs, want %v", tc.signerName, got, tc.wantObserved)
+		}
+		if got := testutil.ToFloat64(decisionCount.WithLabelValues(string(tc.decision), tc.wantLabel, string(tc.reason))); got != tc.wantDecisions {
+			t.Errorf("%s: got %v %s decisions, want %v", tc.signerName, got, tc.decision, tc.wantDecisions)
+		}
+	}
+}
+
+func TestDryRunDecisionStartRecorder(t *testing.T) {
+	const kubeletClient = "kubernetes.io/kube-apiserver-client-kubelet"
+	DryRunDecisionStartRecorder(kubeletClient)(DecisionDeny, DenialReasonValidation)
+	if got := testutil.ToFloat64(dryRunDecisionCount.WithLabelValues(string(DecisionDeny), kubeletClient, string(DenialReasonValidation))); got != 1 {
+		t.Errorf("got %v dry-run deny decisions, want 1", got)
+	}
+	// Dry-run decisions are not enforced ones.
+	if got := testutil.ToFloat64(decisionCount.WithLabelValues(string(DecisionDeny), kubeletClient, string(DenialReasonValidation))); got != 0 {
+		t.Errorf("got %v deny decisions, want 0", got)
+	}
+	if got := testutil.ToFloat64(observedCount.WithLabelValues(kubeletClient)); got != 0 {
+		t.Errorf("got %v observed CSRs, want 0", got)
+	}
+}
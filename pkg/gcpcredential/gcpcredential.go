@@ -17,11 +17,11 @@ limitations under the License.
 package gcpcredential
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"net/http"
-	"os/exec"
-	"runtime"
+	"net/url"
 	"strings"
 	"time"
 
@@ -39,7 +39,6 @@ const (
 	serviceAccounts    = metadataURL + "instance/service-accounts/"
 	metadataScopes     = serviceAccounts + "default/scopes"
 	metadataToken      = serviceAccounts + "default/token"
-	metadataEmail      = serviceAccounts + "default/email"
 	// StorageScopePrefix is the prefix checked by ContainerRegistryProvider.Enabled.
 	StorageScopePrefix       = "https://www.googleapis.com/auth/devstorage"
 	cloudPlatformScopePrefix = "https://www.googleapis.com/auth/cloud-platform"
@@ -82,45 +81,41 @@ type DockerConfigURLKeyProvider struct {
 //	Password: "{access token from metadata}"
 type ContainerRegistryProvider struct {
 	MetadataProvider
+	// ServiceAccount is the email or alias of the instance service account
+	// whose access token is provided. Defaults to "default".
+	ServiceAccount string
+}
+
+// serviceAccountURL returns the metadata URL of the given key of the service
+// account of the provider.
+func (g *ContainerRegistryProvider) serviceAccountURL(key string) string {
+	if g.ServiceAccount == "" {
+		return serviceAccounts + defaultServiceAccount + key
+	}
+	return serviceAccounts + url.PathEscape(g.ServiceAccount) + "/" + key
 }
 
 // Returns true if it finds a local GCE VM.
-// Looks at a product file that is an undocumented API.
+// Looks at the product name of the machine, see productName.
 func onGCEVM() bool {
-	var name string
-
-	if runtime.GOOS == "windows" {
-		data, err := exec.Command("wmic", "computersystem", "get", "model").Output()
-		if err != nil {
-			return false
-		}
-		fields := strings.Split(strings.TrimSpace(string(data)), "\r\n")
-		if len(fields) != 2 {
-			klog.V(2).Infof("Received unexpected value retrieving system model: %q", string(data))
-			return false
-		}
-		name = fields[1]
-	} else {
-		data, err := ioutil.ReadFile(GCEProductNameFile)
-		if err != nil {
-			klog.V(2).Infof("Error while reading product_name: %v", err)
-			return false
-		}
-		name = strings.TrimSpace(string(data))
+	name, err := productName()
+	if err != nil {
+		klog.V(2).Infof("Error while reading the product name: %v", err)
+		return false
 	}
 	return name == "Google" || name == "Google Compute Engine"
 }
 
 // Enabled implements DockerConfigProvider for all of the Google implementations.
-func (g *MetadataProvider) Enabled() bool {
+func (g *MetadataProvider) Enabled(ctx context.Context) bool {
 	return onGCEVM()
 }
 
 // Provide implements DockerConfigProvider
-func (g *DockerConfigKeyProvider) Provide(image string) credentialconfig.DockerConfig {
+func (g *DockerConfigKeyProvider) Provide(ctx context.Context, image string) credentialconfig.DockerConfig {
 	// Read the contents of the google-dockercfg metadata key and
 	// parse them as an alternate .dockercfg
-	if cfg, err := credentialconfig.ReadDockerConfigFileFromURL(DockerConfigKey, g.Client, metadataHeader); err != nil {
+	if cfg, err := credentialconfig.ReadDockerConfigFileFromURL(ctx, DockerConfigKey, g.Client, metadataHeader); err != nil {
 		klog.Errorf("while reading 'google-dockercfg' metadata: %v", err)
 	} else {
 		return cfg
@@ -130,13 +125,13 @@ func (g *DockerConfigKeyProvider) Provide(image string) credentialconfig.DockerC
 }
 
 // Provide implements DockerConfigProvider
-func (g *DockerConfigURLKeyProvider) Provide(image string) credentialconfig.DockerConfig {
+func (g *DockerConfigURLKeyProvider) Provide(ctx context.Context, image string) credentialconfig.DockerConfig {
 	// Read the contents of the google-dockercfg-url key and load a .dockercfg from there
-	if url, err := credentialconfig.ReadURL(DockerConfigURLKey, g.Client, metadataHeader); err != nil {
+	if url, err := credentialconfig.ReadURL(ctx, DockerConfigURLKey, g.Client, metadataHeader); err != nil {
 		klog.Errorf("while reading 'google-dockercfg-url' metadata: %v", err)
 	} else {
 		if strings.HasPrefix(string(url), "http") {
-			if cfg, err := credentialconfig.ReadDockerConfigFileFromURL(string(url), g.Client, nil); err != nil {
+			if cfg, err := credentialconfig.ReadDockerConfigFileFromURL(ctx, string(url), g.Client, nil); err != nil {
 				klog.Errorf("while reading 'google-dockercfg-url'-specified url: %s, %v", string(url), err)
 			} else {
 				return cfg
@@ -151,16 +146,20 @@ func (g *DockerConfigURLKeyProvider) Provide(image string) credentialconfig.Dock
 }
 
 // runWithBackoff runs input function `f` with an exponential backoff.
-// Note that this method can block indefinitely.
-func runWithBackoff(f func() ([]byte, error)) []byte {
+// Note that this method blocks until `f` succeeds or ctx is done.
+func runWithBackoff(ctx context.Context, f func() ([]byte, error)) ([]byte, error) {
 	var backoff = 100 * time.Millisecond
 	const maxBackoff = time.Minute
 	for {
 		value, err := f()
 		if err == nil {
-			return value
+			return value, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
 		}
-		time.Sleep(backoff)
 		backoff = backoff * 2
 		if backoff > maxBackoff {
 			backoff = maxBackoff
@@ -178,15 +177,19 @@ func runWithBackoff(f func() ([]byte, error)) []byte {
 // It is expected that "http://metadata.google.internal./computeMetadata/v1/instance/service-accounts/" will return a `200`
 // and "http://metadata.google.internal./computeMetadata/v1/instance/service-accounts/default/scopes" will also return `200`.
 // More information on metadata service can be found here - https://cloud.google.com/compute/docs/storing-retrieving-metadata
-func (g *ContainerRegistryProvider) Enabled() bool {
+func (g *ContainerRegistryProvider) Enabled(ctx context.Context) bool {
 	// Given that we are on GCE, we should keep retrying until the metadata server responds.
-	value := runWithBackoff(func() ([]byte, error) {
-		value, err := credentialconfig.ReadURL(serviceAccounts, g.Client, metadataHeader)
+	value, err := runWithBackoff(ctx, func() ([]byte, error) {
+		value, err := credentialconfig.ReadURL(ctx, serviceAccounts, g.Client, metadataHeader)
 		if err != nil {
 			klog.V(2).Infof("Failed to Get service accounts from gce metadata server: %v", err)
 		}
 		return value, err
 	})
+	if err != nil {
+		klog.Errorf("Gave up getting service accounts from gce metadata server: %v", err)
+		return false
+	}
 	// We expect the service account to return a list of account directories separated by newlines, e.g.,
 	//   sv-account-name1/
 	//   sv-account-name2/
@@ -203,13 +206,17 @@ func (g *ContainerRegistryProvider) Enabled() bool {
 		return false
 	}
 	url := metadataScopes + "?alt=json"
-	value = runWithBackoff(func() ([]byte, error) {
-		value, err := credentialconfig.ReadURL(url, g.Client, metadataHeader)
+	value, err = runWithBackoff(ctx, func() ([]byte, error) {
+		value, err := credentialconfig.ReadURL(ctx, url, g.Client, metadataHeader)
 		if err != nil {
 			klog.V(2).Infof("Failed to Get scopes in default service account from gce metadata server: %v", err)
 		}
 		return value, err
 	})
+	if err != nil {
+		klog.Errorf("Gave up getting scopes in default service account from gce metadata server: %v", err)
+		return false
+	}
 	var scopes []string
 	if err := json.Unmarshal(value, &scopes); err != nil {
 		klog.Errorf("Failed to unmarshal scopes: %v", err)
@@ -229,19 +236,20 @@ func (g *ContainerRegistryProvider) Enabled() bool {
 // that is returned by GCE metadata.
 type TokenBlob struct {
 	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
 }
 
 // Provide implements DockerConfigProvider
-func (g *ContainerRegistryProvider) Provide(image string) credentialconfig.DockerConfig {
+func (g *ContainerRegistryProvider) Provide(ctx context.Context, image string) credentialconfig.DockerConfig {
 	cfg := credentialconfig.DockerConfig{}
 
-	tokenJSONBlob, err := credentialconfig.ReadURL(metadataToken, g.Client, metadataHeader)
+	tokenJSONBlob, err := credentialconfig.ReadURL(ctx, g.serviceAccountURL("token"), g.Client, metadataHeader)
 	if err != nil {
 		klog.Errorf("while reading access token endpoint: %v", err)
 		return cfg
 	}
 
-	email, err := credentialconfig.ReadURL(metadataEmail, g.Client, metadataHeader)
+	email, err := credentialconfig.ReadURL(ctx, g.serviceAccountURL("email"), g.Client, metadataHeader)
 	if err != nil {
 		klog.Errorf("while reading email endpoint: %v", err)
 		return cfg
@@ -258,6 +266,9 @@ func (g *ContainerRegistryProvider) Provide(image string) credentialconfig.Docke
 		Password: parsedBlob.AccessToken,
 		Email:    string(email),
 	}
+	if parsedBlob.ExpiresIn > 0 {
+		entry.Expiry = time.Now().Add(time.Duration(parsedBlob.ExpiresIn) * time.Second)
+	}
 
 	// Add our entry for each of the supported container registry URLs
 	for _, k := range containerRegistryUrls {
@@ -265,3 +276,26 @@ func (g *ContainerRegistryProvider) Provide(image string) credentialconfig.Docke
 	}
 	return cfg
 }
+
+// CheckMetadataServer returns an error if the metadata server cannot be reached.
+func (g *MetadataProvider) CheckMetadataServer(ctx context.Context) error {
+	_, err := credentialconfig.ReadURL(ctx, metadataURL, g.Client, metadataHeader)
+	return err
+}
+
+// TokenLifetime returns the remaining lifetime of the access token of the
+// default service account served by the metadata server.
+func (g *MetadataProvider) TokenLifetime(ctx context.Context) (time.Duration, error) {
+	tokenJSONBlob, err := credentialconfig.ReadURL(ctx, metadataToken, g.Client, metadataHeader)
+	if err != nil {
+		return 0, err
+	}
+	var parsedBlob TokenBlob
+	if err := json.Unmarshal(tokenJSONBlob, &parsedBlob); err != nil {
+		return 0, fmt.Errorf("while parsing access token: %v", err)
+	}
+	if parsedBlob.AccessToken == "" {
+		return 0, fmt.Errorf("empty access token")
+	}
+	return time.Duration(parsedBlob.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,46 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcpcredential
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// biosKey is the registry key of the SMBIOS system information of the
+// machine, which Windows fills in at boot.
+const biosKey = `HARDWARE\DESCRIPTION\System\BIOS`
+
+// productName returns the product name of the machine from the registry, as
+// the wmic tool used to read it before is deprecated and missing from the
+// recent Windows Server images.
+func productName() (string, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, biosKey, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer key.Close()
+	name, _, err := key.GetStringValue("SystemProductName")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(name), nil
+}
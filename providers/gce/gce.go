@@ -38,6 +38,8 @@ import (
 	computebeta "google.golang.org/api/compute/v0.beta"
 	compute "google.golang.org/api/compute/v1"
 	container "google.golang.org/api/container/v1"
+	networkservicesga "google.golang.org/api/networkservices/v1"
+	networkservicesbeta "google.golang.org/api/networkservices/v1beta1"
 	"google.golang.org/api/option"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
@@ -48,6 +50,7 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
@@ -66,10 +69,20 @@ const (
 	gceAffinityTypeNone = "NONE"
 	// AffinityTypeClientIP - affinity based on Client IP.
 	gceAffinityTypeClientIP = "CLIENT_IP"
+	// AffinityTypeClientIPProto - affinity based on Client IP and protocol.
+	gceAffinityTypeClientIPProto = "CLIENT_IP_PROTO"
+	// AffinityTypeClientIPPortProto - affinity based on Client IP, port and protocol.
+	gceAffinityTypeClientIPPortProto = "CLIENT_IP_PORT_PROTO"
 
 	operationPollInterval           = time.Second
 	maxTargetPoolCreateInstances    = 200
 	maxInstancesPerTargetPoolUpdate = 1000
+	// Cap on the number of instances added to or removed from an instance
+	// group by a single call.
+	maxInstancesPerInstanceGroupUpdate = 500
+	// Cap on the number of zones whose load balancer backends are synced
+	// concurrently.
+	maxConcurrentZoneSyncs = 4
 
 	// HTTP Load Balancer parameters
 	// Configure 8 second period for external health checks.
@@ -92,6 +105,10 @@ var _ cloudprovider.Zones = (*Cloud)(nil)
 var _ cloudprovider.PVLabeler = (*Cloud)(nil)
 var _ cloudprovider.Clusters = (*Cloud)(nil)
 
+// metadataOnGCE reports whether the GCE metadata server is available. It is a
+// variable so tests can run as if on or off GCE.
+var metadataOnGCE = metadata.OnGCE
+
 type StackType string
 
 // NetworkStackDualStack is deprecated, use `clusterStackDualStack` instead.
@@ -133,6 +150,9 @@ type Cloud struct {
 	serviceAlpha     *computealpha.Service
 	containerService *container.Service
 	tpuService       *tpuService
+	// testPermissions tests the IAM permissions of the identity of the
+	// cloud provider, for MissingPermissions.
+	testPermissions  permissionTester
 	client           clientset.Interface
 	clientBuilder    cloudprovider.ControllerClientBuilder
 	eventBroadcaster record.EventBroadcaster
@@ -144,8 +164,12 @@ type Cloud struct {
 	// managedZones will be set to the 1 zone if running a single zone cluster
 	// it will be set to ALL zones in region for any multi-zone cluster
 	// Use GetAllCurrentZones to get only zones that contain nodes
-	managedZones []string
-	networkURL   string
+	// Use getManagedZones to read it, as the zones of the region are
+	// rediscovered every zoneDiscoveryPeriod on multi-zone clusters.
+	managedZones        []string
+	managedZonesLock    sync.RWMutex
+	zoneDiscoveryPeriod time.Duration
+	networkURL          string
 	// unsafeIsLegacyNetwork should be used only via IsLegacyNetwork() accessor,
 	// to ensure it was properly initialized.
 	unsafeIsLegacyNetwork bool
@@ -170,6 +194,10 @@ type Cloud struct {
 	// it is updated by the nodeInformer
 	nodeZones          map[string]sets.String
 	nodeInformerSynced cache.InformerSynced
+	// serviceLister lists the Services referencing the resources shared by
+	// the internal load balancers, nil without informers.
+	serviceLister       corelisters.ServiceLister
+	serviceListerSynced cache.InformerSynced
 	// sharedResourceLock is used to serialize GCE operations that may mutate shared state to
 	// prevent inconsistencies. For example, load balancers manipulation methods will take the
 	// lock to prevent shared resources from being prematurely deleted while the operation is
@@ -194,6 +222,110 @@ type Cloud struct {
 	// stackType indicates whether the cluster is a single stack IPv4, single
 	// stack IPv6 or a dual stack cluster
 	stackType StackType
+
+	// configFile is the config the cloud was created or last reloaded from,
+	// nil if it was not created from a config file.
+	configFile *ConfigFile
+	// tokenSource is the token source used by the compute clients when it can
+	// be replaced by ReloadConfig.
+	tokenSource *reloadableTokenSource
+	// reloadLock serializes ReloadConfig calls.
+	reloadLock sync.Mutex
+	// configLock guards configFile, nodeTags, nodeInstancePrefix and
+	// apiRateLimiters, which can be reloaded.
+	configLock sync.RWMutex
+	// nodeQuarantineEscalationWindow is how long a Node stays quarantined
+	// before its taint is escalated to NoExecute. If zero,
+	// defaultNodeQuarantineEscalationWindow is used.
+	nodeQuarantineEscalationWindow time.Duration
+	// syncHealth tracks the cloud provider calls of the controller sync loops
+	// for health checks.
+	syncHealth syncHealth
+	// diskEncryptionKMSKey is the Cloud KMS key created disks are encrypted
+	// with, if not empty.
+	diskEncryptionKMSKey string
+	// dryRun makes mutations of forwarding rules, firewalls, routes and
+	// target pools logged instead of executed.
+	dryRun bool
+	// apiRateLimiters rate limits the GCE API calls if not nil.
+	apiRateLimiters *apiRateLimiters
+	// apiCircuitBreaker suspends the calls to the API services that exceeded
+	// their rate limit or quota.
+	apiCircuitBreaker apiCircuitBreaker
+	// apiCallHealth tracks the last successful GCE API call, which quarantined
+	// Nodes are only escalated after.
+	apiCallHealth apiCallHealth
+	// operationPoller paces the polls of the operations and caps the
+	// operations in flight.
+	operationPoller *operationPoller
+	// auditInitiators holds the Services the mutations of load balancer
+	// resources are audited for.
+	auditInitiators auditInitiators
+	// routeBatcher batches the route creations and deletions.
+	routeBatcher routeBatcher
+	// routeGC tracks the collections of the orphaned routes.
+	routeGC routeGC
+	// routeQuotaWarningThreshold is the percentage of the routes quota above
+	// which the route creations are warned about.
+	routeQuotaWarningThreshold int
+	routeQuotaCheck            routeQuotaCheck
+	// routePriority is the priority of the routes created, 1000 if zero.
+	routePriority int
+	// routeDescription is appended to the description of the routes
+	// created.
+	routeDescription string
+	// nodeAddressNetworkInterfaces selects and orders the network interfaces
+	// whose addresses are reported for the nodes, all of them if empty.
+	nodeAddressNetworkInterfaces []string
+	// callBudgets holds the reconcile deadlines bounding the GCE API calls
+	// on the resources of the load balancers being synced.
+	callBudgets *callBudgets
+	// syncSpans holds the spans of the load balancer syncs parenting the
+	// spans of the GCE API calls.
+	syncSpans *syncSpans
+	// firewallSourceRanges are the source ranges of the load balancer
+	// firewall rules of the Services not restricting them, instead of
+	// 0.0.0.0/0, if not empty.
+	firewallSourceRanges []string
+	// firewallTargetServiceAccounts are the targets of the load balancer
+	// firewall rules, which target the node tags if empty.
+	firewallTargetServiceAccounts []string
+	// skipFirewallManagement makes the load balancer firewall rules changes
+	// raised as events with the gcloud commands making them instead of
+	// made.
+	skipFirewallManagement bool
+	// firewallCommands are the gcloud commands raised for the firewall
+	// rules when their management is skipped.
+	firewallCommands firewallCommands
+	// lbNamePrefix prefixes the names of the load balancers provisioned
+	// from now on.
+	lbNamePrefix string
+	// healthCheckLogging enables the logging of the health checks of the
+	// load balancers, unless their Service disables it.
+	healthCheckLogging bool
+	// loadBalancerClass is the LoadBalancerClass of the Services whose load
+	// balancers are managed along with the ones without a class.
+	loadBalancerClass string
+	// aliasIPMode is whether the cluster uses alias IP ranges, and so no
+	// routes, or whether it is detected.
+	aliasIPMode string
+	// routesOnce sets once the routesImpl returned by Routes.
+	routesOnce sync.Once
+	routesImpl cloudprovider.Routes
+	// reconcileBudget is the reconcile budget of the load balancer syncs
+	// whose context has no deadline. Their calls are not bounded if zero.
+	reconcileBudget time.Duration
+	// instanceCache caches the instances fetched by the Node syncs.
+	instanceCache instanceCache
+	// instanceLists are the instances listed by zone for the existence
+	// checks of the node lifecycle controller.
+	instanceLists instanceLists
+	// lbDeregistrations queues the nodes to remove from the backends of the
+	// load balancers.
+	lbDeregistrations loadBalancerDeregistrations
+	// intentLog records the audited mutations before they are issued if not
+	// nil.
+	intentLog *intentLog
 }
 
 // ConfigGlobal is the in memory representation of the gce.conf config data
@@ -201,6 +333,18 @@ type Cloud struct {
 type ConfigGlobal struct {
 	TokenURL  string `gcfg:"token-url"`
 	TokenBody string `gcfg:"token-body" datapolicy:"token"`
+	// WorkloadIdentityProvider is the full resource name of the workload
+	// identity pool provider trusting the issuer of WorkloadIdentityTokenFile,
+	// e.g. //iam.googleapis.com/projects/<number>/locations/global/workloadIdentityPools/<pool>/providers/<provider>.
+	// If set, the GCE credentials are obtained by exchanging the token of the
+	// file, e.g. a projected Kubernetes service account token, instead of
+	// from the metadata server or token-url.
+	WorkloadIdentityProvider  string `gcfg:"workload-identity-provider"`
+	WorkloadIdentityTokenFile string `gcfg:"workload-identity-token-file"`
+	// WorkloadIdentityServiceAccount is the email of the service account
+	// impersonated with the federated credentials, empty to grant the roles
+	// to the federated identity directly.
+	WorkloadIdentityServiceAccount string `gcfg:"workload-identity-service-account"`
 	// ProjectID and NetworkProjectID can either be the numeric or string-based
 	// unique identifier that starts with [a-z].
 	ProjectID string `gcfg:"project-id"`
@@ -209,6 +353,16 @@ type ConfigGlobal struct {
 	NetworkName      string `gcfg:"network-name"`
 	SubnetworkName   string `gcfg:"subnetwork-name"`
 	StackType        string `gcfg:"stack-type"`
+	// HostProjectID and ServiceProjectID are the Shared VPC host and service
+	// projects of the cluster, synonyms of NetworkProjectID and ProjectID. If
+	// neither network project is set, the network project is the project of
+	// the network-name or subnetwork-name URL.
+	HostProjectID    string `gcfg:"host-project-id"`
+	ServiceProjectID string `gcfg:"service-project-id"`
+	// HostProjectCredentialsFile is the path of the JSON credentials used for
+	// the API calls to the Shared VPC host project, e.g. to manage its
+	// firewalls and routes, instead of the credentials of the cloud provider.
+	HostProjectCredentialsFile string `gcfg:"host-project-credentials-file"`
 	// DEPRECATED: Do not rely on this value as it may be incorrect.
 	// SecondaryRangeName is the name of the secondary range to allocate IP
 	// aliases. The secondary range must be present on the subnetwork the
@@ -224,6 +378,12 @@ type ConfigGlobal struct {
 	// ContainerAPIEndpoint is the GCE container API endpoint to use. If this is blank,
 	// then the default endpoint is used.
 	ContainerAPIEndpoint string `gcfg:"container-api-endpoint"`
+	// TPUAPIEndpoint is the Cloud TPU API endpoint to use. If this is blank,
+	// then the default endpoint is used.
+	TPUAPIEndpoint string `gcfg:"tpu-api-endpoint"`
+	// NetworkServicesAPIEndpoint is the Network Services API endpoint to use.
+	// If this is blank, then the default endpoint is used.
+	NetworkServicesAPIEndpoint string `gcfg:"networkservices-api-endpoint"`
 	// LocalZone specifies the GCE zone that gce cloud client instance is
 	// located in (i.e. where the controller will be running). If this is
 	// blank, then the local zone will be discovered via the metadata server.
@@ -231,6 +391,117 @@ type ConfigGlobal struct {
 	// Default to none.
 	// For example: MyFeatureFlag
 	AlphaFeatures []string `gcfg:"alpha-features"`
+	// NodeQuarantineEscalationWindow is how long a Node can stay quarantined
+	// by the NodeCloudUnverifiedQuarantine alpha feature before its taint is
+	// escalated to NoExecute, e.g. "30m". Defaults to 30 minutes. The taint is
+	// not escalated while the GCE API is failing.
+	NodeQuarantineEscalationWindow string `gcfg:"node-quarantine-escalation-window"`
+	// DiskEncryptionKMSKey is the Cloud KMS key that persistent disks created
+	// by the cloud provider are encrypted with, in the form
+	// projects/PROJECT/locations/LOCATION/keyRings/RING/cryptoKeys/KEY. The
+	// key must be in the region of the cluster or global. Disks are encrypted
+	// with Google-managed keys if empty.
+	DiskEncryptionKMSKey string `gcfg:"disk-encryption-kms-key"`
+	// RetryPolicy is the policy retrying the failed GCE API requests: none,
+	// the default, exponential or quota-aware.
+	RetryPolicy string `gcfg:"retry-policy"`
+	// RetryPolicyOverrides set the retry policy of the requests to some
+	// resources and verbs, as RESOURCE/VERB=POLICY, e.g.
+	// forwardingRules/insert=none or routes/*=quota-aware. See
+	// NewRetryPolicies for the resource and verb names.
+	RetryPolicyOverrides []string `gcfg:"retry-policy-override"`
+	// RetryMaxAttempts is the maximum number of attempts of the requests
+	// retried by a retry policy. Defaults to 5.
+	RetryMaxAttempts int `gcfg:"retry-max-attempts"`
+	// ReconcileBudget is how long a load balancer sync whose context has
+	// no deadline may take, e.g. "2m". Each GCE API call of the sync may
+	// use at most half of the remaining budget, so that one slow call
+	// cannot consume the whole sync period. Unbounded if empty.
+	ReconcileBudget string `gcfg:"reconcile-budget"`
+	// InstanceCacheTTL is how long the instances fetched by the Node syncs,
+	// for their addresses, type and existence, are cached, e.g. "1m", to
+	// save API quota on large clusters. The instances are then up to this
+	// old. Not cached if empty.
+	InstanceCacheTTL string `gcfg:"instance-cache-ttl"`
+	// FirewallSourceRanges are the CIDRs allowed to reach the load balancers
+	// of the Services which do not set loadBalancerSourceRanges, instead of
+	// 0.0.0.0/0. The health check firewall rules keep allowing the health
+	// check probe ranges.
+	FirewallSourceRanges []string `gcfg:"firewall-source-range"`
+	// FirewallTarget selects what the load balancer firewall rules target:
+	// tags, the default, for the node tags, or service-accounts for
+	// FirewallTargetServiceAccounts.
+	FirewallTarget string `gcfg:"firewall-target"`
+	// FirewallTargetServiceAccounts are the node service accounts targeted
+	// by the load balancer firewall rules with FirewallTarget
+	// service-accounts.
+	FirewallTargetServiceAccounts []string `gcfg:"firewall-target-service-account"`
+	// SkipFirewallManagement makes the cloud provider neither read nor
+	// change the load balancer firewall rules, e.g. in Shared VPC service
+	// projects without the compute.firewalls permissions on the host
+	// project. The changes are raised as LoadBalancerManualChange events on
+	// the Services, with the gcloud commands making them in the network
+	// project.
+	SkipFirewallManagement bool `gcfg:"skip-firewall-management"`
+	// LoadBalancerNamePrefix prefixes the names of the forwarding rules,
+	// target pools, health checks and firewalls of the Service load
+	// balancers, e.g. "prod-eu-", to identify the cluster they belong to.
+	// At most 16 lowercase letters, digits or dashes starting with a
+	// letter. The load balancers keep the prefix they were provisioned
+	// with, if any, when it changes.
+	LoadBalancerNamePrefix string `gcfg:"load-balancer-name-prefix"`
+	// HealthCheckLogging enables the logging of the health check probes of
+	// the internal and NEG backed external load balancers in Cloud Logging.
+	// Services can override it for the health checks they do not share.
+	HealthCheckLogging bool `gcfg:"health-check-logging"`
+	// LoadBalancerClass claims the Services with this spec.loadBalancerClass,
+	// besides the ones without a class, for the load balancers of the
+	// provider. Services of any other class are left to their own
+	// implementation. The service controller of the cloud-controller-manager
+	// syncs the claimed Services like the ones without a class.
+	LoadBalancerClass string `gcfg:"load-balancer-class"`
+	// AliasIPMode is whether the Pod IPs of the cluster are alias IP ranges
+	// of the nodes, routed by the VPC network, in which case the route
+	// controller does not program routes: auto, the default, to detect it
+	// from the network interfaces of the nodes, enabled or disabled.
+	AliasIPMode string `gcfg:"alias-ip-mode"`
+	// RouteQuotaWarningThreshold is the percentage of the routes quota of
+	// the project above which the route creations are raised as
+	// RouteQuotaNearlyExhausted warning events. Defaults to 90.
+	RouteQuotaWarningThreshold int `gcfg:"route-quota-warning-threshold"`
+	// RoutePriority is the priority of the routes created for the Pod
+	// ranges of the nodes, between 1 and 65535, lower values taking
+	// precedence. Defaults to 1000. The existing routes keep their priority.
+	RoutePriority int `gcfg:"route-priority"`
+	// RouteDescription is appended to the description of the routes created
+	// for the Pod ranges of the nodes, e.g. "team=platform cost-center=42",
+	// to identify them in inventory tools. The routes keep being identified
+	// by the provider from the k8s-node-route prefix of their description.
+	RouteDescription string `gcfg:"route-description"`
+	// NodeAddressNetworkInterfaces are the network interfaces of the nodes
+	// whose addresses are reported in their status, in this order, e.g.
+	// nic1 and nic0 on multi-network nodes whose Pod network is on nic1.
+	// The interfaces missing on a node are skipped. All of them, in order,
+	// if empty.
+	NodeAddressNetworkInterfaces []string `gcfg:"node-address-network-interface"`
+	// ZoneDiscoveryPeriod is how often the zones of the region are
+	// rediscovered by the multizone and regional clusters, which manage all
+	// of them, e.g. "10m", so that the zones added to the region are managed
+	// without a restart. Defaults to 10m, 0 to not rediscover them.
+	ZoneDiscoveryPeriod string `gcfg:"zone-discovery-period"`
+	// RateLimitConfigFile is the path of a file with [ratelimit "GROUP"]
+	// sections, which override those of the cloud config.
+	RateLimitConfigFile string `gcfg:"rate-limit-config-file"`
+	// MaxInFlightOperations caps the GCE operations started and not yet
+	// seen done, e.g. the deletions of a load balancer garbage collection,
+	// the further mutations waiting for one of them to complete. Defaults to
+	// 0, not capping them.
+	MaxInFlightOperations int `gcfg:"max-inflight-operations"`
+	// QuotaProjectID is the project the quota and billing of the GCE and IAM
+	// API calls are charged to, sent as their x-goog-user-project header,
+	// e.g. when the credentials are federated or of another project. The
+	// project of the credentials is charged if empty.
+	QuotaProjectID string `gcfg:"quota-project-id"`
 }
 
 // ConfigFile is the struct used to parse the /etc/gce.conf configuration file.
@@ -241,6 +512,10 @@ type ConfigGlobal struct {
 // for more details.
 type ConfigFile struct {
 	Global ConfigGlobal `gcfg:"global"`
+	// RateLimits are the rate limits of the GCE API calls by API group, e.g.
+	// ForwardingRules, set in [ratelimit "ForwardingRules"] sections. The
+	// "default" group applies to the API groups without their own section.
+	RateLimits map[string]*RateLimitConfig `gcfg:"ratelimit"`
 }
 
 // CloudConfig includes all the necessary configuration for creating Cloud
@@ -265,6 +540,71 @@ type CloudConfig struct {
 	UseMetadataServer  bool
 	AlphaFeatureGate   *AlphaFeatureGate
 	StackType          string
+	// HostProjectTokenSource authenticates the API calls to the Shared VPC
+	// host project if not nil, TokenSource otherwise.
+	HostProjectTokenSource oauth2.TokenSource
+	// NodeQuarantineEscalationWindow overrides
+	// defaultNodeQuarantineEscalationWindow if non-zero.
+	NodeQuarantineEscalationWindow time.Duration
+	// DiskEncryptionKMSKey is the Cloud KMS key created disks are encrypted
+	// with, if not empty.
+	DiskEncryptionKMSKey string
+	// RetryPolicies selects the retry policy of the GCE API requests. Failed
+	// requests are not retried if nil.
+	RetryPolicies *RetryPolicies
+	// RateLimits are the rate limits of the GCE API calls keyed by lower
+	// case API group. The calls are not rate limited if nil.
+	RateLimits map[string]*RateLimitConfig
+	// ReconcileBudget bounds the load balancer syncs whose context has no
+	// deadline if non-zero.
+	ReconcileBudget time.Duration
+	// InstanceCacheTTL is how long the instances fetched by the Node syncs
+	// are cached, zero to not cache them.
+	InstanceCacheTTL time.Duration
+	// FirewallSourceRanges replace 0.0.0.0/0 as the source ranges of the
+	// load balancers of the Services not restricting them if not empty.
+	FirewallSourceRanges []string
+	// FirewallTargetServiceAccounts are the targets of the load balancer
+	// firewall rules instead of the node tags if not empty.
+	FirewallTargetServiceAccounts []string
+	// SkipFirewallManagement raises the load balancer firewall rules
+	// changes as events instead of making them.
+	SkipFirewallManagement bool
+	// LoadBalancerNamePrefix prefixes the names of the load balancers
+	// provisioned from now on.
+	LoadBalancerNamePrefix string
+	// HealthCheckLogging enables the logging of the load balancer health
+	// checks.
+	HealthCheckLogging bool
+	// LoadBalancerClass is the LoadBalancerClass of the Services the
+	// provider manages besides the ones without a class.
+	LoadBalancerClass string
+	// AliasIPMode sets whether the cluster uses alias IP ranges, which is
+	// detected with AliasIPModeAuto or if empty.
+	AliasIPMode string
+	// RouteQuotaWarningThreshold is the percentage of the routes quota
+	// above which the route creations are warned about.
+	RouteQuotaWarningThreshold int
+	// RoutePriority is the priority of the routes created from now on.
+	RoutePriority int
+	// RouteDescription is appended to the description of the routes
+	// created from now on.
+	RouteDescription string
+	// NodeAddressNetworkInterfaces selects and orders the network interfaces
+	// whose addresses are reported for the nodes.
+	NodeAddressNetworkInterfaces []string
+	// ZoneDiscoveryPeriod is how often the zones of the region are
+	// rediscovered if ManagedZones is empty, zero to not rediscover them.
+	ZoneDiscoveryPeriod time.Duration
+	// TPUAPIEndpoint and NetworkServicesAPIEndpoint override the endpoints
+	// of the Cloud TPU and Network Services APIs if not empty.
+	TPUAPIEndpoint             string
+	NetworkServicesAPIEndpoint string
+	// MaxInFlightOperations caps the operations in flight if not zero.
+	MaxInFlightOperations int
+	// QuotaProjectID is the project the API calls are charged to if not
+	// empty.
+	QuotaProjectID string
 }
 
 func init() {
@@ -315,7 +655,19 @@ func newGCECloud(config io.Reader) (gceCloud *Cloud, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return CreateGCECloud(cloudConfig)
+	// Allow the token source to be replaced when the config is reloaded.
+	var tokenSource *reloadableTokenSource
+	if cloudConfig.TokenSource != nil {
+		tokenSource = &reloadableTokenSource{source: cloudConfig.TokenSource}
+		cloudConfig.TokenSource = tokenSource
+	}
+	gceCloud, err = CreateGCECloud(cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+	gceCloud.configFile = configFile
+	gceCloud.tokenSource = tokenSource
+	return gceCloud, nil
 }
 
 func readConfig(reader io.Reader) (*ConfigFile, error) {
@@ -332,8 +684,24 @@ func generateCloudConfig(configFile *ConfigFile) (cloudConfig *CloudConfig, err
 	// By default, fetch token from GCE metadata server
 	cloudConfig.TokenSource = google.ComputeTokenSource("")
 	cloudConfig.UseMetadataServer = true
+	// When running outside of GCE, e.g. from a management cluster or a
+	// workstation, there is no metadata server to provide the identity and
+	// location of the controller manager. Fall back to Application Default
+	// Credentials and require the location to be set in the config file.
+	onGCE := true
+	if configFile == nil || configFile.Global.TokenURL == "" {
+		onGCE = metadataOnGCE()
+	}
+	if !onGCE {
+		klog.Infof("GCE metadata server is not available, using Application Default Credentials")
+		cloudConfig.TokenSource = nil
+		cloudConfig.UseMetadataServer = false
+	}
 	cloudConfig.AlphaFeatureGate = NewAlphaFeatureGate([]string{})
 	if configFile != nil {
+		if err := validateAPIEndpoints(&configFile.Global); err != nil {
+			return nil, err
+		}
 		if configFile.Global.APIEndpoint != "" {
 			cloudConfig.APIEndpoint = configFile.Global.APIEndpoint
 		}
@@ -342,6 +710,10 @@ func generateCloudConfig(configFile *ConfigFile) (cloudConfig *CloudConfig, err
 			cloudConfig.ContainerAPIEndpoint = configFile.Global.ContainerAPIEndpoint
 		}
 
+		cloudConfig.TPUAPIEndpoint = configFile.Global.TPUAPIEndpoint
+		cloudConfig.NetworkServicesAPIEndpoint = configFile.Global.NetworkServicesAPIEndpoint
+		cloudConfig.QuotaProjectID = configFile.Global.QuotaProjectID
+
 		if configFile.Global.TokenURL != "" {
 			// if tokenURL is nil, set tokenSource to nil. This will force the OAuth client to fall
 			// back to use DefaultTokenSource. This allows running gceCloud remotely.
@@ -352,6 +724,20 @@ func generateCloudConfig(configFile *ConfigFile) (cloudConfig *CloudConfig, err
 			}
 		}
 
+		if err := validateWorkloadIdentity(&configFile.Global); err != nil {
+			return nil, err
+		}
+		if configFile.Global.WorkloadIdentityProvider != "" {
+			cloudConfig.TokenSource, err = newWorkloadIdentityTokenSource(configFile.Global.WorkloadIdentityProvider, configFile.Global.WorkloadIdentityTokenFile, configFile.Global.WorkloadIdentityServiceAccount, cloudConfig.QuotaProjectID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := resolveSharedVPCProjects(&configFile.Global); err != nil {
+			return nil, err
+		}
+
 		cloudConfig.NodeTags = configFile.Global.NodeTags
 		cloudConfig.NodeInstancePrefix = configFile.Global.NodeInstancePrefix
 		cloudConfig.AlphaFeatureGate = NewAlphaFeatureGate(configFile.Global.AlphaFeatures)
@@ -359,6 +745,9 @@ func generateCloudConfig(configFile *ConfigFile) (cloudConfig *CloudConfig, err
 
 	// retrieve projectID and zone
 	if configFile == nil || configFile.Global.ProjectID == "" || configFile.Global.LocalZone == "" {
+		if !onGCE {
+			return nil, fmt.Errorf("project-id and local-zone must be set in the cloud config when not running on GCE")
+		}
 		cloudConfig.ProjectID, cloudConfig.Zone, err = getProjectAndZone()
 		if err != nil {
 			return nil, err
@@ -402,6 +791,9 @@ func generateCloudConfig(configFile *ConfigFile) (cloudConfig *CloudConfig, err
 			cloudConfig.NetworkName = configFile.Global.NetworkName
 		}
 	} else {
+		if !onGCE {
+			return nil, fmt.Errorf("network-name must be set in the cloud config when not running on GCE")
+		}
 		cloudConfig.NetworkName, err = getNetworkNameViaMetadata()
 		if err != nil {
 			return nil, err
@@ -417,6 +809,19 @@ func generateCloudConfig(configFile *ConfigFile) (cloudConfig *CloudConfig, err
 			cloudConfig.SubnetworkName = configFile.Global.SubnetworkName
 		}
 	}
+	if err := resolveNetworkProject(cloudConfig); err != nil {
+		return nil, err
+	}
+
+	if configFile != nil && configFile.Global.HostProjectCredentialsFile != "" {
+		if cloudConfig.NetworkProjectID == "" || cloudConfig.NetworkProjectID == cloudConfig.ProjectID {
+			return nil, fmt.Errorf("host-project-credentials-file requires a host project distinct from project %q", cloudConfig.ProjectID)
+		}
+		cloudConfig.HostProjectTokenSource, err = loadHostProjectTokenSource(configFile.Global.HostProjectCredentialsFile, cloudConfig.QuotaProjectID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if configFile != nil {
 		cloudConfig.SecondaryRangeName = configFile.Global.SecondaryRangeName
@@ -426,6 +831,98 @@ func generateCloudConfig(configFile *ConfigFile) (cloudConfig *CloudConfig, err
 		cloudConfig.StackType = configFile.Global.StackType
 	}
 
+	if configFile != nil && configFile.Global.NodeQuarantineEscalationWindow != "" {
+		cloudConfig.NodeQuarantineEscalationWindow, err = time.ParseDuration(configFile.Global.NodeQuarantineEscalationWindow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node-quarantine-escalation-window: %v", err)
+		}
+	}
+
+	if configFile != nil && configFile.Global.ReconcileBudget != "" {
+		cloudConfig.ReconcileBudget, err = time.ParseDuration(configFile.Global.ReconcileBudget)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reconcile-budget: %v", err)
+		}
+		if cloudConfig.ReconcileBudget < 0 {
+			return nil, fmt.Errorf("invalid reconcile-budget: %v must not be negative", cloudConfig.ReconcileBudget)
+		}
+	}
+
+	if configFile != nil && configFile.Global.InstanceCacheTTL != "" {
+		cloudConfig.InstanceCacheTTL, err = time.ParseDuration(configFile.Global.InstanceCacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid instance-cache-ttl: %v", err)
+		}
+		if cloudConfig.InstanceCacheTTL < 0 {
+			return nil, fmt.Errorf("invalid instance-cache-ttl: %v must not be negative", cloudConfig.InstanceCacheTTL)
+		}
+	}
+
+	cloudConfig.ZoneDiscoveryPeriod = defaultZoneDiscoveryPeriod
+	if configFile != nil && configFile.Global.ZoneDiscoveryPeriod != "" {
+		cloudConfig.ZoneDiscoveryPeriod, err = time.ParseDuration(configFile.Global.ZoneDiscoveryPeriod)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zone-discovery-period: %v", err)
+		}
+		if cloudConfig.ZoneDiscoveryPeriod < 0 {
+			return nil, fmt.Errorf("invalid zone-discovery-period: %v must not be negative", cloudConfig.ZoneDiscoveryPeriod)
+		}
+	}
+
+	if configFile != nil {
+		cloudConfig.FirewallTargetServiceAccounts, err = parseFirewallPolicy(configFile.Global.FirewallSourceRanges, configFile.Global.FirewallTarget, configFile.Global.FirewallTargetServiceAccounts)
+		if err != nil {
+			return nil, err
+		}
+		cloudConfig.FirewallSourceRanges = configFile.Global.FirewallSourceRanges
+		cloudConfig.SkipFirewallManagement = configFile.Global.SkipFirewallManagement
+		if err := validateLoadBalancerNamePrefix(configFile.Global.LoadBalancerNamePrefix); err != nil {
+			return nil, err
+		}
+		cloudConfig.LoadBalancerNamePrefix = configFile.Global.LoadBalancerNamePrefix
+		cloudConfig.HealthCheckLogging = configFile.Global.HealthCheckLogging
+		cloudConfig.LoadBalancerClass = configFile.Global.LoadBalancerClass
+		if err := validateAliasIPMode(configFile.Global.AliasIPMode); err != nil {
+			return nil, err
+		}
+		cloudConfig.AliasIPMode = configFile.Global.AliasIPMode
+		if err := validateRouteQuotaWarningThreshold(configFile.Global.RouteQuotaWarningThreshold); err != nil {
+			return nil, err
+		}
+		cloudConfig.RouteQuotaWarningThreshold = configFile.Global.RouteQuotaWarningThreshold
+		if err := validateRoutePriority(configFile.Global.RoutePriority); err != nil {
+			return nil, err
+		}
+		cloudConfig.RoutePriority = configFile.Global.RoutePriority
+		cloudConfig.RouteDescription = configFile.Global.RouteDescription
+		if err := validateNodeAddressNetworkInterfaces(configFile.Global.NodeAddressNetworkInterfaces); err != nil {
+			return nil, err
+		}
+		cloudConfig.NodeAddressNetworkInterfaces = configFile.Global.NodeAddressNetworkInterfaces
+		if err := validateMaxInFlightOperations(configFile.Global.MaxInFlightOperations); err != nil {
+			return nil, err
+		}
+		cloudConfig.MaxInFlightOperations = configFile.Global.MaxInFlightOperations
+	}
+
+	if configFile != nil && configFile.Global.DiskEncryptionKMSKey != "" {
+		if err := validateKMSKeyName(configFile.Global.DiskEncryptionKMSKey, cloudConfig.Region); err != nil {
+			return nil, fmt.Errorf("invalid disk-encryption-kms-key: %v", err)
+		}
+		cloudConfig.DiskEncryptionKMSKey = configFile.Global.DiskEncryptionKMSKey
+	}
+
+	if configFile != nil {
+		cloudConfig.RetryPolicies, err = parseRetryPolicies(configFile.Global.RetryPolicy, configFile.Global.RetryPolicyOverrides, configFile.Global.RetryMaxAttempts)
+		if err != nil {
+			return nil, err
+		}
+		cloudConfig.RateLimits, err = loadRateLimits(configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return cloudConfig, err
 }
 
@@ -447,19 +944,36 @@ func CreateGCECloud(config *CloudConfig) (*Cloud, error) {
 		config.NetworkProjectID = config.ProjectID
 	}
 
-	service, err := compute.NewService(context.Background(), option.WithTokenSource(config.TokenSource))
+	budgets := &callBudgets{}
+	spans := &syncSpans{}
+	computeClient, err := newComputeHTTPClient(config.TokenSource, config.QuotaProjectID, config.RetryPolicies, budgets, spans)
+	if err != nil {
+		return nil, err
+	}
+	var hostTransport *hostProjectTransport
+	if config.HostProjectTokenSource != nil {
+		hostClient, err := newComputeHTTPClient(config.HostProjectTokenSource, config.QuotaProjectID, config.RetryPolicies, budgets, spans)
+		if err != nil {
+			return nil, err
+		}
+		hostTransport = &hostProjectTransport{base: computeClient.Transport, host: hostClient.Transport, projects: []string{config.NetworkProjectID}}
+		computeClient.Transport = hostTransport
+	}
+	computeClientOption := option.WithHTTPClient(computeClient)
+
+	service, err := compute.NewService(context.Background(), computeClientOption)
 	if err != nil {
 		return nil, err
 	}
 	service.UserAgent = userAgent
 
-	serviceBeta, err := computebeta.NewService(context.Background(), option.WithTokenSource(config.TokenSource))
+	serviceBeta, err := computebeta.NewService(context.Background(), computeClientOption)
 	if err != nil {
 		return nil, err
 	}
 	serviceBeta.UserAgent = userAgent
 
-	serviceAlpha, err := computealpha.NewService(context.Background(), option.WithTokenSource(config.TokenSource))
+	serviceAlpha, err := computealpha.NewService(context.Background(), computeClientOption)
 	if err != nil {
 		return nil, err
 	}
@@ -477,7 +991,7 @@ func CreateGCECloud(config *CloudConfig) (*Cloud, error) {
 		}
 	}
 
-	containerService, err := container.NewService(context.Background(), option.WithTokenSource(config.TokenSource))
+	containerService, err := container.NewService(context.Background(), option.WithTokenSource(config.TokenSource), option.WithQuotaProject(config.QuotaProjectID))
 	if err != nil {
 		return nil, err
 	}
@@ -486,14 +1000,38 @@ func CreateGCECloud(config *CloudConfig) (*Cloud, error) {
 		containerService.BasePath = config.ContainerAPIEndpoint
 	}
 
-	tpuService, err := newTPUService()
+	tpuService, err := newTPUService(config.TPUAPIEndpoint, option.WithQuotaProject(config.QuotaProjectID))
+	if err != nil {
+		return nil, err
+	}
+
+	networkServicesGA, err := networkservicesga.NewService(context.Background(), computeClientOption)
+	if err != nil {
+		return nil, err
+	}
+	networkServicesGA.UserAgent = userAgent
+	networkServicesBeta, err := networkservicesbeta.NewService(context.Background(), computeClientOption)
 	if err != nil {
 		return nil, err
 	}
+	networkServicesBeta.UserAgent = userAgent
+	if config.NetworkServicesAPIEndpoint != "" {
+		networkServicesGA.BasePath = config.NetworkServicesAPIEndpoint
+		networkServicesBeta.BasePath = config.NetworkServicesAPIEndpoint
+	}
+
+	klog.Infof("Using the API endpoints: compute %q, compute beta %q, compute alpha %q, container %q, tpu %q, networkservices %q",
+		service.BasePath, serviceBeta.BasePath, serviceAlpha.BasePath, containerService.BasePath, tpuService.basePath, networkServicesGA.BasePath)
 
 	// ProjectID and.NetworkProjectID may be project number or name.
 	projID, netProjID := tryConvertToProjectNames(config.ProjectID, config.NetworkProjectID, service)
+	if err := checkNetworkProjectNames(config, netProjID, service); err != nil {
+		return nil, err
+	}
 	onXPN := projID != netProjID
+	if hostTransport != nil && netProjID != config.NetworkProjectID {
+		hostTransport.projects = append(hostTransport.projects, netProjID)
+	}
 
 	var networkURL string
 	var subnetURL string
@@ -520,11 +1058,13 @@ func CreateGCECloud(config *CloudConfig) (*Cloud, error) {
 	// the provider is initialized also for Kubelets (and there can be thousands
 	// of them) we defer to lazy initialization here.
 
+	var zoneDiscoveryPeriod time.Duration
 	if len(config.ManagedZones) == 0 {
 		config.ManagedZones, err = getZonesForRegion(service, config.ProjectID, config.Region)
 		if err != nil {
 			return nil, err
 		}
+		zoneDiscoveryPeriod = config.ZoneDiscoveryPeriod
 	}
 	if len(config.ManagedZones) > 1 {
 		klog.Infof("managing multiple zones: %v", config.ManagedZones)
@@ -559,14 +1099,37 @@ func CreateGCECloud(config *CloudConfig) (*Cloud, error) {
 		projectsBasePath:         getProjectsBasePath(service.BasePath),
 		stackType:                StackType(config.StackType),
 	}
+	gce.nodeQuarantineEscalationWindow = config.NodeQuarantineEscalationWindow
+	gce.diskEncryptionKMSKey = config.DiskEncryptionKMSKey
+	gce.apiRateLimiters = newAPIRateLimiters(config.RateLimits)
+	gce.operationPoller = newOperationPoller(config.MaxInFlightOperations)
+	gce.callBudgets = budgets
+	gce.syncSpans = spans
+	gce.reconcileBudget = config.ReconcileBudget
+	gce.instanceCache.ttl = config.InstanceCacheTTL
+	gce.firewallSourceRanges = config.FirewallSourceRanges
+	gce.firewallTargetServiceAccounts = config.FirewallTargetServiceAccounts
+	gce.skipFirewallManagement = config.SkipFirewallManagement
+	gce.lbNamePrefix = config.LoadBalancerNamePrefix
+	gce.healthCheckLogging = config.HealthCheckLogging
+	gce.loadBalancerClass = config.LoadBalancerClass
+	gce.aliasIPMode = config.AliasIPMode
+	gce.routeQuotaWarningThreshold = config.RouteQuotaWarningThreshold
+	gce.routePriority = config.RoutePriority
+	gce.routeDescription = config.RouteDescription
+	gce.nodeAddressNetworkInterfaces = config.NodeAddressNetworkInterfaces
+	gce.zoneDiscoveryPeriod = zoneDiscoveryPeriod
+	gce.testPermissions = newPermissionTester(computeClient, userAgent)
 
 	gce.manager = &gceServiceManager{gce}
 	gce.s = &cloud.Service{
-		GA:            service,
-		Alpha:         serviceAlpha,
-		Beta:          serviceBeta,
-		ProjectRouter: &gceProjectRouter{gce},
-		RateLimiter:   &gceRateLimiter{gce},
+		GA:                  service,
+		Alpha:               serviceAlpha,
+		Beta:                serviceBeta,
+		NetworkServicesGA:   networkServicesGA.Projects.Locations,
+		NetworkServicesBeta: networkServicesBeta.Projects.Locations,
+		ProjectRouter:       &gceProjectRouter{gce},
+		RateLimiter:         newInstrumentedRateLimiter(&gceRateLimiter{gce}),
 	}
 	gce.c = cloud.NewGCE(gce.s)
 
@@ -612,12 +1175,13 @@ func (g *Cloud) initializeSubnetworkURLAndIsLegacyNetwork() {
 	g.unsafeIsLegacyNetwork = isLegacyNetwork
 }
 
-// SetRateLimiter adds a custom cloud.RateLimiter implementation.
+// SetRateLimiter adds a custom cloud.RateLimiter implementation. The GCE API
+// call metrics are still recorded.
 // WARNING: Calling this could have unexpected behavior if you have in-flight
 // requests. It is best to use this immediately after creating a Cloud.
 func (g *Cloud) SetRateLimiter(rl cloud.RateLimiter) {
 	if rl != nil {
-		g.s.RateLimiter = rl
+		g.s.RateLimiter = newInstrumentedRateLimiter(rl)
 	}
 }
 
@@ -684,6 +1248,9 @@ func (g *Cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder,
 
 	go g.watchClusterID(stop)
 	go g.metricsCollector.Run(stop)
+	go g.runLoadBalancerGC(stop)
+	go g.runZoneDiscovery(stop)
+	go g.runLoadBalancerDeregistrations(stop)
 }
 
 // LoadBalancer returns an implementation of LoadBalancer for Google Compute Engine.
@@ -712,9 +1279,10 @@ func (g *Cloud) Clusters() (cloudprovider.Clusters, bool) {
 	return g, true
 }
 
-// Routes returns an implementation of Routes for Google Compute Engine.
+// Routes returns an implementation of Routes for Google Compute Engine,
+// which does not program routes if the cluster uses alias IP ranges.
 func (g *Cloud) Routes() (cloudprovider.Routes, bool) {
-	return g, true
+	return g.routes(), true
 }
 
 // ProviderName returns the cloud provider ID.
@@ -763,13 +1331,25 @@ func (g *Cloud) SubnetworkURL() string {
 	return g.unsafeSubnetworkURL
 }
 
+// SecondaryRangeName returns the secondary range of the subnetwork the alias
+// IP ranges of the nodes are added from.
+func (g *Cloud) SecondaryRangeName() string {
+	return g.secondaryRangeName
+}
+
+// NodeInstancePrefix returns the node instance prefix of the cloud config.
+func (g *Cloud) NodeInstancePrefix() string {
+	return g.getNodeInstancePrefix()
+}
+
 // IsLegacyNetwork returns true if the cluster is still running a legacy network configuration.
 func (g *Cloud) IsLegacyNetwork() bool {
 	g.subnetworkURLAndIsLegacyNetworkInitializer.Do(g.initializeSubnetworkURLAndIsLegacyNetwork)
 	return g.unsafeIsLegacyNetwork
 }
 
-// SetInformers sets up the zone handlers we need watching for node changes.
+// SetInformers sets up the zone handlers we need watching for node changes,
+// and the lister of the Services sharing internal load balancer resources.
 func (g *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 	klog.Infof("Setting up informers for Cloud")
 	nodeInformer := informerFactory.Core().V1().Nodes().Informer()
@@ -781,6 +1361,9 @@ func (g *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 		UpdateFunc: func(prev, obj interface{}) {
 			prevNode := prev.(*v1.Node)
 			newNode := obj.(*v1.Node)
+			if excludedFromLoadBalancers(newNode) && !excludedFromLoadBalancers(prevNode) {
+				g.maybeDeregisterNode(newNode)
+			}
 			if getZone(newNode) == getZone(prevNode) {
 				return
 			}
@@ -803,9 +1386,14 @@ func (g *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 				}
 			}
 			g.updateNodeZones(node, nil)
+			g.maybeDeregisterNode(node)
 		},
 	})
 	g.nodeInformerSynced = nodeInformer.HasSynced
+
+	serviceInformer := informerFactory.Core().V1().Services()
+	g.serviceLister = serviceInformer.Lister()
+	g.serviceListerSynced = serviceInformer.Informer().HasSynced
 }
 
 func (g *Cloud) updateNodeZones(prevNode, newNode *v1.Node) {
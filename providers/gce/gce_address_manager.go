@@ -39,6 +39,8 @@ type addressManager struct {
 	region      string
 	subnetURL   string
 	tryRelease  bool
+	// purpose is the purpose of the address, if it must have one.
+	purpose string
 }
 
 func newAddressManager(svc CloudAddressService, serviceName, region, subnetURL, name, targetIP string, addressType cloud.LbScheme) *addressManager {
@@ -128,6 +130,7 @@ func (am *addressManager) ensureAddressReservation() (string, error) {
 		Address:     am.targetIP,
 		AddressType: string(am.addressType),
 		Subnetwork:  am.subnetURL,
+		Purpose:     am.purpose,
 	}
 
 	reserveErr := am.svc.ReserveRegionAddress(newAddr, am.region)
@@ -189,6 +192,9 @@ func (am *addressManager) validateAddress(addr *compute.Address) error {
 	if addr.AddressType != string(am.addressType) {
 		return fmt.Errorf("address %q does not have the expected address type %q, actual: %q", addr.Name, am.addressType, addr.AddressType)
 	}
+	if am.purpose != "" && addr.Purpose != am.purpose {
+		return fmt.Errorf("address %q does not have the expected purpose %q, actual: %q", addr.Name, am.purpose, addr.Purpose)
+	}
 
 	return nil
 }
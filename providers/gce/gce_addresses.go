@@ -48,8 +48,12 @@ func (g *Cloud) ReserveGlobalAddress(addr *compute.Address) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "global address", meta.GlobalKey(addr.Name), addr) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "global address", meta.GlobalKey(addr.Name), addr)
 	mc := newAddressMetricContext("reserve", "")
-	return mc.Observe(g.c.GlobalAddresses().Insert(ctx, meta.GlobalKey(addr.Name), addr))
+	return mc.Observe(audit(g.c.GlobalAddresses().Insert(ctx, meta.GlobalKey(addr.Name), addr)))
 }
 
 // DeleteGlobalAddress deletes a global address by name.
@@ -57,8 +61,12 @@ func (g *Cloud) DeleteGlobalAddress(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "global address", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "global address", meta.GlobalKey(name), nil)
 	mc := newAddressMetricContext("delete", "")
-	return mc.Observe(g.c.GlobalAddresses().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.GlobalAddresses().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // GetGlobalAddress returns the global address by name.
@@ -76,8 +84,12 @@ func (g *Cloud) ReserveRegionAddress(addr *compute.Address, region string) error
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "address", meta.RegionalKey(addr.Name, region), addr) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "address", meta.RegionalKey(addr.Name, region), addr)
 	mc := newAddressMetricContext("reserve", region)
-	return mc.Observe(g.c.Addresses().Insert(ctx, meta.RegionalKey(addr.Name, region), addr))
+	return mc.Observe(audit(g.c.Addresses().Insert(ctx, meta.RegionalKey(addr.Name, region), addr)))
 }
 
 // ReserveBetaRegionAddress creates a beta region address
@@ -85,8 +97,12 @@ func (g *Cloud) ReserveBetaRegionAddress(addr *computebeta.Address, region strin
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "address", meta.RegionalKey(addr.Name, region), addr) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "address", meta.RegionalKey(addr.Name, region), addr)
 	mc := newAddressMetricContext("reserve", region)
-	return mc.Observe(g.c.BetaAddresses().Insert(ctx, meta.RegionalKey(addr.Name, region), addr))
+	return mc.Observe(audit(g.c.BetaAddresses().Insert(ctx, meta.RegionalKey(addr.Name, region), addr)))
 }
 
 // DeleteRegionAddress deletes a region address by name.
@@ -94,8 +110,12 @@ func (g *Cloud) DeleteRegionAddress(name, region string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "address", meta.RegionalKey(name, region), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "address", meta.RegionalKey(name, region), nil)
 	mc := newAddressMetricContext("delete", region)
-	return mc.Observe(g.c.Addresses().Delete(ctx, meta.RegionalKey(name, region)))
+	return mc.Observe(audit(g.c.Addresses().Delete(ctx, meta.RegionalKey(name, region))))
 }
 
 // GetRegionAddress returns the region address by name
@@ -0,0 +1,175 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// The fields of the instances and forwarding rules read by the syncs, which
+// only need a few of them, to cut the size of the responses in projects of
+// thousands of instances.
+const (
+	// instanceHostFields are the fields of the gceInstances of the hosts of
+	// the load balancers.
+	instanceHostFields = "name,id,disks,machineType"
+	// instanceNameFields are the fields of the instances only checked for
+	// existence.
+	instanceNameFields = "name"
+	// instanceTagsFields are the fields of the instances read for their
+	// network tags.
+	instanceTagsFields = "name,tags"
+	// instanceAliasFields are the fields of the instances read for their
+	// alias IP ranges.
+	instanceAliasFields = "name,networkInterfaces"
+	// forwardingRuleOwnerFields are the fields of the forwarding rules read
+	// for the Service owning them.
+	forwardingRuleOwnerFields = "name,description"
+)
+
+// listZoneInstances lists the instances of the zones matching the filter,
+// with only the fields, by zone. The instances of several zones are read by a
+// single aggregated list of the project filtered by zone rather than a list
+// per zone. As g.c neither masks fields nor lists across zones, the calls are
+// made with the service, project router and rate limiter of g.c instead. The
+// clouds without a compute service to call, e.g. the mock clouds of the
+// tests, list each zone with g.c without a field mask.
+func (g *Cloud) listZoneInstances(ctx context.Context, zones []string, f *filter.F, fields string) (map[string][]*compute.Instance, error) {
+	instances := map[string][]*compute.Instance{}
+	if g.s == nil {
+		for _, zone := range zones {
+			mc := newInstancesMetricContext("list", zone)
+			list, err := g.c.Instances().List(ctx, zone, f)
+			if err != nil {
+				return nil, mc.Observe(err)
+			}
+			mc.Observe(nil)
+			instances[zone] = list
+		}
+		return instances, nil
+	}
+
+	switch len(zones) {
+	case 0:
+		return instances, nil
+	case 1:
+		zone := zones[0]
+		mc := newInstancesMetricContext("list", zone)
+		projectID, observe, err := g.rateLimitCall(ctx, "Instances", "List")
+		if err != nil {
+			return nil, mc.Observe(err)
+		}
+		call := g.s.GA.Instances.List(projectID, zone).Filter(f.String()).Fields(googleapi.Field(fmt.Sprintf("items(%s),nextPageToken", fields)))
+		err = call.Pages(ctx, func(page *compute.InstanceList) error {
+			instances[zone] = append(instances[zone], page.Items...)
+			return nil
+		})
+		observe(err)
+		if err != nil {
+			return nil, mc.Observe(err)
+		}
+		return instances, mc.Observe(nil)
+	}
+
+	mc := newInstancesMetricContext("aggregated_list", "")
+	managed := sets.NewString(zones...)
+	projectID, observe, err := g.rateLimitCall(ctx, "Instances", "AggregatedList")
+	if err != nil {
+		return nil, mc.Observe(err)
+	}
+	call := g.s.GA.Instances.AggregatedList(projectID).Filter(zonesFilter(zones, f).String()).Fields(googleapi.Field(fmt.Sprintf("items/*/instances(%s),nextPageToken", fields)))
+	err = call.Pages(ctx, func(page *compute.InstanceAggregatedList) error {
+		for scope, scoped := range page.Items {
+			zone, ok := strings.CutPrefix(scope, "zones/")
+			if !ok || !managed.Has(zone) {
+				continue
+			}
+			instances[zone] = append(instances[zone], scoped.Instances...)
+		}
+		return nil
+	})
+	observe(err)
+	if err != nil {
+		return nil, mc.Observe(err)
+	}
+	return instances, mc.Observe(nil)
+}
+
+// listRegionForwardingRules lists the forwarding rules of the region matching
+// the filter, with only the fields, with the service of g.c like
+// listZoneInstances. The clouds without a compute service to call list them
+// with g.c without a field mask.
+func (g *Cloud) listRegionForwardingRules(ctx context.Context, region string, f *filter.F, fields string) ([]*compute.ForwardingRule, error) {
+	if g.s == nil {
+		return g.c.ForwardingRules().List(ctx, region, f)
+	}
+	mc := newForwardingRuleMetricContext("list", region)
+	projectID, observe, err := g.rateLimitCall(ctx, "ForwardingRules", "List")
+	if err != nil {
+		return nil, mc.Observe(err)
+	}
+	var rules []*compute.ForwardingRule
+	call := g.s.GA.ForwardingRules.List(projectID, region).Filter(f.String()).Fields(googleapi.Field(fmt.Sprintf("items(%s),nextPageToken", fields)))
+	err = call.Pages(ctx, func(page *compute.ForwardingRuleList) error {
+		rules = append(rules, page.Items...)
+		return nil
+	})
+	observe(err)
+	if err != nil {
+		return nil, mc.Observe(err)
+	}
+	return rules, mc.Observe(nil)
+}
+
+// rateLimitCall makes a call made with the compute service of g.c rather than
+// with g.c wait for the rate limiter of the calls of g.c, and returns the
+// project to call, routed like the calls of g.c, and the function reporting
+// the outcome of the call to the rate limiter.
+func (g *Cloud) rateLimitCall(ctx context.Context, service, operation string) (string, func(error), error) {
+	projectID := g.s.ProjectRouter.ProjectID(ctx, meta.VersionGA, service)
+	key := &cloud.RateLimitKey{ProjectID: projectID, Operation: operation, Version: meta.VersionGA, Service: service}
+	if err := g.s.RateLimiter.Accept(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return projectID, func(err error) { g.s.RateLimiter.Observe(ctx, err, key) }, nil
+}
+
+// zonesFilter returns the filter f of the instances restricted to the zones,
+// so that aggregated lists leave out the instances of the other zones.
+func zonesFilter(zones []string, f *filter.F) *filter.F {
+	patterns := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		patterns = append(patterns, ".*/zones/"+zone)
+	}
+	zf := filter.Regexp("zone", strings.Join(patterns, "|"))
+	if f == filter.None {
+		return zf
+	}
+	return zf.And(f)
+}
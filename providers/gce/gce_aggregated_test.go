@@ -0,0 +1,142 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+// serveCompute makes the cloud call the compute API at a server answering
+// the requests with handler, and returns the requests it received.
+func serveCompute(t *testing.T, g *Cloud, handler http.HandlerFunc) *[]*http.Request {
+	t.Helper()
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	service, err := ga.NewService(context.Background(), option.WithEndpoint(server.URL+"/compute/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	g.service = service
+	g.s = &cloud.Service{GA: service, ProjectRouter: &gceProjectRouter{g}, RateLimiter: &cloud.NopRateLimiter{}}
+	return &requests
+}
+
+func TestListZoneInstances(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	zones := []string{vals.ZoneName, vals.SecondaryZoneName}
+	f := filter.Regexp("name", "gke-.*")
+
+	t.Run("aggregated list", func(t *testing.T) {
+		g, err := fakeGCECloud(vals)
+		require.NoError(t, err)
+		requests := serveCompute(t, g, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("pageToken") == "" {
+				fmt.Fprintf(w, `{"items": {"zones/%s": {"instances": [{"name": "gke-node-1"}]}}, "nextPageToken": "next"}`, vals.ZoneName)
+				return
+			}
+			fmt.Fprintf(w, `{"items": {"zones/%s": {"instances": [{"name": "gke-node-2"}]}, "zones/other-zone": {"instances": [{"name": "gke-node-3"}]}}}`, vals.SecondaryZoneName)
+		})
+
+		instances, err := g.listZoneInstances(context.Background(), zones, f, instanceTagsFields)
+		require.NoError(t, err)
+		// The instances of the other zones are left out.
+		require.Len(t, instances, 2)
+		require.Len(t, instances[vals.ZoneName], 1)
+		assert.Equal(t, "gke-node-1", instances[vals.ZoneName][0].Name)
+		require.Len(t, instances[vals.SecondaryZoneName], 1)
+		assert.Equal(t, "gke-node-2", instances[vals.SecondaryZoneName][0].Name)
+
+		// The zones are listed with a field mask in a single aggregated
+		// list filtered by zone, page by page.
+		require.Len(t, *requests, 2)
+		for _, r := range *requests {
+			assert.Equal(t, "/compute/v1/projects/"+vals.ProjectID+"/aggregated/instances", r.URL.Path)
+			assert.Equal(t, "items/*/instances(name,tags),nextPageToken", r.URL.Query().Get("fields"))
+			assert.Equal(t, "(zone eq .*/zones/"+vals.ZoneName+"|.*/zones/"+vals.SecondaryZoneName+") (name eq gke-.*)", r.URL.Query().Get("filter"))
+		}
+	})
+
+	t.Run("single zone", func(t *testing.T) {
+		g, err := fakeGCECloud(vals)
+		require.NoError(t, err)
+		requests := serveCompute(t, g, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"items": [{"name": "gke-node-1"}]}`)
+		})
+
+		instances, err := g.listZoneInstances(context.Background(), zones[:1], f, instanceNameFields)
+		require.NoError(t, err)
+		require.Len(t, instances[vals.ZoneName], 1)
+		require.Len(t, *requests, 1)
+		r := (*requests)[0]
+		assert.Equal(t, "/compute/v1/projects/"+vals.ProjectID+"/zones/"+vals.ZoneName+"/instances", r.URL.Path)
+		assert.Equal(t, "items(name),nextPageToken", r.URL.Query().Get("fields"))
+	})
+
+	t.Run("mock", func(t *testing.T) {
+		g, err := fakeGCECloud(vals)
+		require.NoError(t, err)
+		for _, instance := range []struct{ name, zone string }{
+			{"gke-node-1", vals.ZoneName},
+			{"gke-node-2", vals.SecondaryZoneName},
+			{"other-node", vals.ZoneName},
+		} {
+			require.NoError(t, g.c.Instances().Insert(context.Background(), meta.ZonalKey(instance.name, instance.zone), &ga.Instance{Name: instance.name}))
+		}
+
+		instances, err := g.listZoneInstances(context.Background(), zones, f, instanceNameFields)
+		require.NoError(t, err)
+		require.Len(t, instances[vals.ZoneName], 1)
+		assert.Equal(t, "gke-node-1", instances[vals.ZoneName][0].Name)
+		require.Len(t, instances[vals.SecondaryZoneName], 1)
+	})
+}
+
+func TestListRegionForwardingRules(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	g, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	requests := serveCompute(t, g, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items": [{"name": "k8s-a1234", "description": "{}"}]}`)
+	})
+
+	rules, err := g.listRegionForwardingRules(context.Background(), vals.Region, filter.Regexp("name", "k8s-.*"), forwardingRuleOwnerFields)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "k8s-a1234", rules[0].Name)
+	require.Len(t, *requests, 1)
+	r := (*requests)[0]
+	assert.Equal(t, "/compute/v1/projects/"+vals.ProjectID+"/regions/"+vals.Region+"/forwardingRules", r.URL.Path)
+	assert.Equal(t, "items(name,description),nextPageToken", r.URL.Query().Get("fields"))
+	assert.Equal(t, "name eq k8s-.*", r.URL.Query().Get("filter"))
+}
@@ -27,6 +27,66 @@ const (
 	// AlphaFeatureSkipIGsManagement enabled L4 Regional Backend Services and
 	// disables instance group management in service controller
 	AlphaFeatureSkipIGsManagement = "SkipIGsManagement"
+
+	// AlphaFeatureL4LBSyncStatusAnnotation mirrors the result of the last L4
+	// load balancer sync into the networking.gke.io/load-balancer-sync-status
+	// Service annotation.
+	AlphaFeatureL4LBSyncStatusAnnotation = "L4LBSyncStatusAnnotation"
+
+	// AlphaFeatureL4LBChecksum records a checksum of the desired state of L4
+	// load balancers in the networking.gke.io/load-balancer-checksum Service
+	// annotation, and skips the syncs that would not change it.
+	AlphaFeatureL4LBChecksum = "L4LBChecksum"
+
+	// AlphaFeatureMigrateDeprecatedAnnotations rewrites deprecated Service
+	// annotations to their replacements instead of only emitting warning events.
+	AlphaFeatureMigrateDeprecatedAnnotations = "MigrateDeprecatedAnnotations"
+
+	// AlphaFeatureNodeCloudUnverifiedQuarantine taints and annotates Nodes
+	// whose instance existence check fails with an error other than not
+	// found, instead of only logging the error.
+	AlphaFeatureNodeCloudUnverifiedQuarantine = "NodeCloudUnverifiedQuarantine"
+
+	// AlphaFeatureTrafficDistribution honors spec.trafficDistribution
+	// PreferClose on internal LoadBalancer Services by enabling the zonal
+	// affinity of their backend service, with the alpha compute API.
+	AlphaFeatureTrafficDistribution = "TrafficDistribution"
+
+	// AlphaFeatureILBSharedResources shares the health checks of internal
+	// LoadBalancer Services with the same health check parameters, and
+	// replaces their health check firewalls with a single cluster-scoped one,
+	// deleting the shared resources once no Service references them.
+	AlphaFeatureILBSharedResources = "ILBSharedResources"
+
+	// AlphaFeatureMixedProtocolLB lets internal and target pool based
+	// external LoadBalancer Services mix TCP and UDP ports, serving the ports
+	// of the protocol other than the one of their first port with a companion
+	// forwarding rule on the same IP address.
+	AlphaFeatureMixedProtocolLB = "MixedProtocolLoadBalancers"
+
+	// AlphaFeatureLoadBalancerGC attaches a finalizer to target pool and NEG
+	// based external LoadBalancer Services, and periodically deletes the
+	// forwarding rules, target pools, internal backend services and health
+	// checks, and firewalls of the load balancers of the cluster whose Service
+	// no longer exists.
+	AlphaFeatureLoadBalancerGC = "LoadBalancerGarbageCollection"
+
+	// AlphaFeatureRouteGC makes the route controller sync loop periodically
+	// delete the routes of the cluster whose target instance or Node no
+	// longer exists.
+	AlphaFeatureRouteGC = "RouteGarbageCollection"
+
+	// AlphaFeatureExternalManagedLB lets external LoadBalancer Services opt
+	// in, with the networking.gke.io/external-load-balancer-backends
+	// annotation, to an EXTERNAL_MANAGED regional backend service fronted by
+	// Gateway managed resources.
+	AlphaFeatureExternalManagedLB = "ExternalManagedLoadBalancers"
+
+	// AlphaFeatureDeletePreemptedNodes reports the instances of Nodes which
+	// were preempted by GCE as gone, so that the cloud node lifecycle
+	// controller deletes their Node instead of leaving it NotReady until the
+	// instance is restarted or recreated.
+	AlphaFeatureDeletePreemptedNodes = "DeletePreemptedNodes"
 )
 
 // AlphaFeatureGate contains a mapping of alpha features to whether they are enabled
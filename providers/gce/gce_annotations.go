@@ -26,6 +26,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"k8s.io/api/core/v1"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
 )
 
 // LoadBalancerType defines a specific type for holding load balancer types (eg. Internal)
@@ -59,11 +60,41 @@ const (
 	// created in.
 	ServiceAnnotationILBAllowGlobalAccess = "networking.gke.io/internal-load-balancer-allow-global-access"
 
+	// ServiceAnnotationILBAllPorts is annotated on an internal LoadBalancer
+	// Service with "true" to forward all the ports of its IP address to the
+	// nodes, instead of only the Service ports. The forwarding rule of a
+	// Service with more ports than it can list does so anyway.
+	ServiceAnnotationILBAllPorts = "networking.gke.io/internal-load-balancer-all-ports"
+
 	// ServiceAnnotationILBSubnet is annotated on a service with the name of the subnetwork
 	// the ILB IP Address should be assigned from. By default, this is the subnetwork that the
 	// cluster is created in.
 	ServiceAnnotationILBSubnet = "networking.gke.io/internal-load-balancer-subnet"
 
+	// ServiceAnnotationPSCServiceAttachment is annotated on an internal
+	// LoadBalancer Service with "true" to publish its load balancer with a
+	// Private Service Connect service attachment, whose URI is reported in
+	// the PSCServiceAttachmentReady condition of the Service.
+	ServiceAnnotationPSCServiceAttachment = "networking.gke.io/psc-service-attachment"
+
+	// ServiceAnnotationPSCNATSubnets is the comma separated names of the
+	// PRIVATE_SERVICE_CONNECT subnetworks of the region the connections to
+	// the service attachment of the Service are translated from. It is
+	// required by ServiceAnnotationPSCServiceAttachment.
+	ServiceAnnotationPSCNATSubnets = "networking.gke.io/psc-nat-subnets"
+
+	// ServiceAnnotationPSCConsumerProjects is the comma separated IDs or
+	// numbers of the only projects accepted to connect to the service
+	// attachment of the Service. The connections of all the projects are
+	// accepted if it is not set.
+	ServiceAnnotationPSCConsumerProjects = "networking.gke.io/psc-consumer-projects"
+
+	// ServiceAnnotationLoadBalancerIPAddressName is annotated on a service with
+	// the name of the regional address the load balancer IP should be taken
+	// from, instead of a literal IP in spec.loadBalancerIP. The address is
+	// reserved if it does not exist and is never released by the controller.
+	ServiceAnnotationLoadBalancerIPAddressName = "networking.gke.io/load-balancer-ip-address-name"
+
 	// NetworkTierAnnotationKey is annotated on a Service object to indicate which
 	// network tier a GCP LB should use. The valid values are "Standard" and
 	// "Premium" (default).
@@ -75,12 +106,177 @@ const (
 	// NetworkTierAnnotationPremium is an annotation to indicate the Service is on the Premium network tier
 	NetworkTierAnnotationPremium = cloud.NetworkTierPremium
 
+	// ServiceAnnotationExternalLBBackends is annotated on an external
+	// LoadBalancer Service with "NEG" to back its load balancer with a regional
+	// backend service and zonal GCE_VM_IP network endpoint groups of the nodes,
+	// instead of a target pool. It is only honored when the NEGBackedNetLB
+	// feature gate is enabled.
+	ServiceAnnotationExternalLBBackends = "networking.gke.io/external-load-balancer-backends"
+
+	// ExternalLBBackendsNEG is the value of the
+	// ServiceAnnotationExternalLBBackends annotation that selects NEG backends.
+	ExternalLBBackendsNEG = "NEG"
+
+	// ServiceAnnotationBackendServiceMigration is annotated on an external
+	// LoadBalancer Service with "true" to migrate its target pool based load
+	// balancer to a regional backend service with NEG backends, keeping its
+	// IP address. The backend service is created before the forwarding rule
+	// is switched to it, and the progress is reported with events. The
+	// annotation must be kept, or replaced with the
+	// ServiceAnnotationExternalLBBackends one, once migrated. It is only
+	// honored when the NEGBackedNetLB feature gate is enabled.
+	ServiceAnnotationBackendServiceMigration = "networking.gke.io/migrate-to-backend-service"
+
+	// ExternalLBBackendsExternalManaged is the value of the
+	// ServiceAnnotationExternalLBBackends annotation that backs the Service
+	// with an EXTERNAL_MANAGED regional backend service and zonal
+	// GCE_VM_IP_PORT network endpoint groups of the nodes on its node port,
+	// for a regional external proxy load balancer whose frontend is managed
+	// by a Gateway. It is only honored when the ExternalManagedLoadBalancers
+	// alpha feature is enabled.
+	ExternalLBBackendsExternalManaged = "EXTERNAL_MANAGED"
+
+	// ServiceAnnotationExternalManagedForwardingRule is annotated on a
+	// LoadBalancer Service with EXTERNAL_MANAGED backends with the name of the
+	// Gateway managed regional forwarding rule in front of its backend
+	// service, whose IP address is reported in the Service status.
+	ServiceAnnotationExternalManagedForwardingRule = "networking.gke.io/external-managed-forwarding-rule"
+
+	// ServiceAnnotationWeightedLoadBalancing is annotated on an external
+	// LoadBalancer Service with NEG backends and externalTrafficPolicy Local
+	// with "pods-per-node" to weigh the traffic to each node by the number of
+	// its serving endpoints, as reported by its health check.
+	ServiceAnnotationWeightedLoadBalancing = "networking.gke.io/weighted-load-balancing"
+
+	// WeightedLoadBalancingPodsPerNode is the value of the
+	// ServiceAnnotationWeightedLoadBalancing annotation that weighs the nodes
+	// by their number of serving endpoints.
+	WeightedLoadBalancingPodsPerNode = "pods-per-node"
+
 	// RBSAnnotationKey is annotated on a Service object to indicate
 	// opt-in mode for RBS NetLB
 	RBSAnnotationKey = "cloud.google.com/l4-rbs"
 
 	// RBSEnabled is an annotation to indicate the Service is opt-in for RBS
 	RBSEnabled = "enabled"
+
+	// ServiceAnnotationLoadBalancerSyncStatus is set by the controller on a
+	// Service to the result ("Success" or "Error") of the last load balancer
+	// sync. It is only set when the L4LBSyncStatusAnnotation alpha feature is
+	// enabled.
+	ServiceAnnotationLoadBalancerSyncStatus = "networking.gke.io/load-balancer-sync-status"
+
+	// ServiceAnnotationLoadBalancerChecksum is set by the controller on a
+	// Service to the checksum of the Service spec, annotations and nodes the
+	// load balancer was last synced with. It is only set when the
+	// L4LBChecksum alpha feature is enabled.
+	ServiceAnnotationLoadBalancerChecksum = "networking.gke.io/load-balancer-checksum"
+
+	// ServiceAnnotationLoadBalancerNamePrefix is set by the controller on a
+	// Service to the load-balancer-name-prefix of the cloud config its load
+	// balancer resources are named with, so that they keep their names when
+	// the prefix changes.
+	ServiceAnnotationLoadBalancerNamePrefix = "networking.gke.io/load-balancer-name-prefix"
+
+	// ServiceAnnotationBackendServicePrefix is the prefix of the Service
+	// annotations that configure the backend service of an internal or a NEG
+	// backed external load balancer. Only the annotations below are accepted
+	// with this prefix.
+	ServiceAnnotationBackendServicePrefix = "networking.gke.io/backend-service-"
+
+	// ServiceAnnotationBackendServiceLoggingSampleRate is annotated on an
+	// internal LoadBalancer Service to enable connection logging on its
+	// backend service, with the given sample rate between 0.0 and 1.0.
+	ServiceAnnotationBackendServiceLoggingSampleRate = "networking.gke.io/backend-service-logging-sample-rate"
+
+	// ServiceAnnotationBackendServiceDescription is annotated on an internal
+	// LoadBalancer Service to add a custom description to its backend service.
+	ServiceAnnotationBackendServiceDescription = "networking.gke.io/backend-service-description"
+
+	// ServiceAnnotationBackendServiceSessionAffinity is annotated on a
+	// LoadBalancer Service to set the session affinity of its backend service
+	// to one of NONE, CLIENT_IP, CLIENT_IP_PROTO or CLIENT_IP_PORT_PROTO. It
+	// takes precedence over spec.sessionAffinity.
+	ServiceAnnotationBackendServiceSessionAffinity = "networking.gke.io/backend-service-session-affinity"
+
+	// ServiceAnnotationBackendServiceSessionAffinityTimeout is annotated on a
+	// LoadBalancer Service with session affinity to set the idle timeout in
+	// seconds of the connection tracking entries of its backend service.
+	ServiceAnnotationBackendServiceSessionAffinityTimeout = "networking.gke.io/backend-service-session-affinity-timeout"
+
+	// ServiceAnnotationBackendServiceConnectionDrainingTimeout is annotated on
+	// a LoadBalancer Service to set how long in seconds its backend service
+	// keeps the existing connections to a removed backend, e.g. a node being
+	// upgraded, between 0 and 3600.
+	ServiceAnnotationBackendServiceConnectionDrainingTimeout = "networking.gke.io/backend-service-connection-draining-timeout"
+
+	// ServiceAnnotationBackendServiceTimeout is annotated on a LoadBalancer
+	// Service to set the timeout in seconds of its backend service, between 1
+	// and 86400, for long-running requests not to be cut at the default 30s.
+	ServiceAnnotationBackendServiceTimeout = "networking.gke.io/backend-service-timeout"
+
+	// ServiceAnnotationBackendServiceSecurityPolicy is annotated on an
+	// external LoadBalancer Service backed by a backend service, e.g. a NEG
+	// backed one, with the name of an existing Cloud Armor security policy of
+	// the region of the cluster, e.g. a network edge security policy, to
+	// attach it to its backend service. An empty value detaches the security
+	// policy, while without the annotation the security policy of the backend
+	// service is left as is.
+	ServiceAnnotationBackendServiceSecurityPolicy = "networking.gke.io/backend-service-security-policy"
+
+	// ServiceAnnotationHealthCheckPrefix is the prefix of the Service
+	// annotations that tune the health check of the load balancer of a
+	// Service with externalTrafficPolicy Cluster, which then gets its own
+	// health check instead of sharing the nodes health check. Only the
+	// annotations below are accepted with this prefix, and only the request
+	// path and proxy header ones with externalTrafficPolicy Local.
+	ServiceAnnotationHealthCheckPrefix = "networking.gke.io/health-check-"
+
+	// ServiceAnnotationHealthCheckInterval is the number of seconds between
+	// two health checks of a node.
+	ServiceAnnotationHealthCheckInterval = "networking.gke.io/health-check-interval"
+
+	// ServiceAnnotationHealthCheckTimeout is the number of seconds a health
+	// check waits for a response, at most the interval.
+	ServiceAnnotationHealthCheckTimeout = "networking.gke.io/health-check-timeout"
+
+	// ServiceAnnotationHealthCheckHealthyThreshold is the number of
+	// consecutive successful health checks marking a node healthy.
+	ServiceAnnotationHealthCheckHealthyThreshold = "networking.gke.io/health-check-healthy-threshold"
+
+	// ServiceAnnotationHealthCheckUnhealthyThreshold is the number of
+	// consecutive failed health checks marking a node unhealthy.
+	ServiceAnnotationHealthCheckUnhealthyThreshold = "networking.gke.io/health-check-unhealthy-threshold"
+
+	// ServiceAnnotationHealthCheckRequestPath is the path health checks
+	// request on the nodes health check port, or on the healthCheckNodePort
+	// of a Service with externalTrafficPolicy Local.
+	ServiceAnnotationHealthCheckRequestPath = "networking.gke.io/health-check-request-path"
+
+	// ServiceAnnotationHealthCheckProxyHeader is the proxy header, NONE or
+	// PROXY_V1, health checks send before their request, for the health
+	// check servers of the nodes expecting the PROXY protocol. The legacy
+	// health checks of target pools do not support it.
+	ServiceAnnotationHealthCheckProxyHeader = "networking.gke.io/health-check-proxy-header"
+
+	// ServiceAnnotationHealthCheckLogging is annotated on an internal or a NEG
+	// backed external LoadBalancer Service with "true" or "false" to enable or
+	// disable the logging of the probes of its health check, overriding the
+	// health-check-logging cloud config. It is ignored if the health check is
+	// shared with other Services.
+	ServiceAnnotationHealthCheckLogging = "networking.gke.io/enable-health-check-logging"
+
+	// ServiceAnnotationLoadBalancerDrainDelay is annotated on a LoadBalancer
+	// Service with a duration, e.g. "5m", to keep its load balancer that long
+	// after the Service type is changed to ClusterIP or NodePort, so that
+	// clients can migrate before their connections are cut. The load balancer
+	// of a deleted Service is deleted without delay.
+	ServiceAnnotationLoadBalancerDrainDelay = "networking.gke.io/load-balancer-drain-delay"
+
+	// ServiceAnnotationLoadBalancerDrainStart is set by the controller on a
+	// Service draining its load balancer to the RFC 3339 time the drain
+	// started, and removed if its type is changed back to LoadBalancer.
+	ServiceAnnotationLoadBalancerDrainStart = "networking.gke.io/load-balancer-drain-start"
 )
 
 // GetLoadBalancerAnnotationType returns the type of GCP load balancer which should be assembled.
@@ -147,6 +343,8 @@ type ILBOptions struct {
 	AllowGlobalAccess bool
 	// SubnetName indicates which subnet the LoadBalancer VIPs should be assigned from
 	SubnetName string
+	// AllPorts indicates whether the LoadBalancer forwards all ports
+	AllPorts bool
 }
 
 // GetLoadBalancerAnnotationAllowGlobalAccess returns if global access is enabled
@@ -155,6 +353,56 @@ func GetLoadBalancerAnnotationAllowGlobalAccess(service *v1.Service) bool {
 	return service.Annotations[ServiceAnnotationILBAllowGlobalAccess] == "true"
 }
 
+// GetLoadBalancerAnnotationAllPorts returns if the internal load balancer
+// of the given service forwards all ports.
+func GetLoadBalancerAnnotationAllPorts(service *v1.Service) bool {
+	return service.Annotations[ServiceAnnotationILBAllPorts] == "true"
+}
+
+// GetLoadBalancerAnnotationIPAddressName returns the name of the address the
+// LoadBalancer IP should be taken from, if any.
+func GetLoadBalancerAnnotationIPAddressName(service *v1.Service) string {
+	return service.Annotations[ServiceAnnotationLoadBalancerIPAddressName]
+}
+
+// GetLoadBalancerAnnotationNEGBackends returns whether the external load
+// balancer of the Service is requested to use NEG backends.
+func GetLoadBalancerAnnotationNEGBackends(service *v1.Service) bool {
+	return service.Annotations[ServiceAnnotationExternalLBBackends] == ExternalLBBackendsNEG
+}
+
+// GetLoadBalancerAnnotationBackendServiceMigration returns whether the
+// target pool based load balancer of the Service is requested to be migrated
+// to a backend service.
+func GetLoadBalancerAnnotationBackendServiceMigration(service *v1.Service) bool {
+	return service.Annotations[ServiceAnnotationBackendServiceMigration] == "true"
+}
+
+// GetLoadBalancerAnnotationExternalManagedBackends returns whether the
+// external load balancer of the Service is requested to be a Gateway fronted
+// one with an EXTERNAL_MANAGED backend service.
+func GetLoadBalancerAnnotationExternalManagedBackends(service *v1.Service) bool {
+	return service.Annotations[ServiceAnnotationExternalLBBackends] == ExternalLBBackendsExternalManaged
+}
+
+// getWeightedLoadBalancing returns whether the load balancer of the Service
+// weighs its nodes by their number of serving endpoints, and an error if the
+// annotation has an invalid value or the Service does not route traffic to
+// local endpoints only.
+func getWeightedLoadBalancing(service *v1.Service) (bool, error) {
+	value, ok := service.Annotations[ServiceAnnotationWeightedLoadBalancing]
+	if !ok {
+		return false, nil
+	}
+	if value != WeightedLoadBalancingPodsPerNode {
+		return false, fmt.Errorf("invalid value %q of annotation %q, must be %q", value, ServiceAnnotationWeightedLoadBalancing, WeightedLoadBalancingPodsPerNode)
+	}
+	if !servicehelpers.RequestsOnlyLocalTraffic(service) {
+		return false, fmt.Errorf("annotation %q requires externalTrafficPolicy %s", ServiceAnnotationWeightedLoadBalancing, v1.ServiceExternalTrafficPolicyLocal)
+	}
+	return true, nil
+}
+
 // GetLoadBalancerAnnotationSubnet returns the configured subnet to assign LoadBalancer IP from.
 func GetLoadBalancerAnnotationSubnet(service *v1.Service) string {
 	if val, exists := service.Annotations[ServiceAnnotationILBSubnet]; exists {
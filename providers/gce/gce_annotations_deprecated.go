@@ -0,0 +1,140 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	servicehelper "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+)
+
+// deprecatedAnnotationReason is the reason of the warning events emitted for
+// objects using deprecated annotations.
+const deprecatedAnnotationReason = "DeprecatedAnnotation"
+
+// deprecatedAnnotation describes an annotation that was renamed.
+type deprecatedAnnotation struct {
+	// key is the deprecated annotation key.
+	key string
+	// replacement is the annotation key that should be used instead.
+	replacement string
+	// replacementValues maps deprecated values to the values expected by the
+	// replacement annotation. Values not listed are migrated unchanged.
+	replacementValues map[string]string
+}
+
+// replacementValue returns the value the replacement annotation should have
+// for the given value of the deprecated annotation.
+func (d deprecatedAnnotation) replacementValue(value string) string {
+	if v, ok := d.replacementValues[value]; ok {
+		return v
+	}
+	return value
+}
+
+// deprecatedServiceAnnotations lists the Service annotations that were
+// renamed. Entries must never be removed while the deprecated key is still
+// honored by the provider.
+var deprecatedServiceAnnotations = []deprecatedAnnotation{
+	{
+		key:               deprecatedServiceAnnotationLoadBalancerType,
+		replacement:       ServiceAnnotationLoadBalancerType,
+		replacementValues: map[string]string{string(deprecatedTypeInternalLowerCase): string(LBTypeInternal)},
+	},
+	{
+		key:         deprecatedServiceAnnotationILBBackendShare,
+		replacement: ServiceAnnotationILBBackendShare,
+	},
+}
+
+// findDeprecatedAnnotations returns the entries of the registry that are used
+// in annotations, sorted by key.
+func findDeprecatedAnnotations(registry []deprecatedAnnotation, annotations map[string]string) []deprecatedAnnotation {
+	var found []deprecatedAnnotation
+	for _, d := range registry {
+		if _, ok := annotations[d.key]; ok {
+			found = append(found, d)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].key < found[j].key })
+	return found
+}
+
+// warnDeprecatedAnnotations emits a warning event on obj for every deprecated
+// annotation it uses, naming the replacement.
+func (g *Cloud) warnDeprecatedAnnotations(obj runtime.Object, annotations map[string]string, deprecated []deprecatedAnnotation) {
+	if g.eventRecorder == nil {
+		return
+	}
+	for _, d := range deprecated {
+		msg := fmt.Sprintf("Annotation %q is deprecated, use %q instead", d.key, d.replacement)
+		if value := annotations[d.key]; value != d.replacementValue(value) {
+			msg = fmt.Sprintf("Annotation %q is deprecated, use %q with value %q instead", d.key, d.replacement, d.replacementValue(value))
+		}
+		g.eventRecorder.Event(obj, v1.EventTypeWarning, deprecatedAnnotationReason, msg)
+	}
+}
+
+// migrateDeprecatedAnnotations returns a copy of annotations in which the
+// deprecated annotations are replaced. When both the deprecated and the
+// replacement annotation are set, the replacement already takes precedence
+// and is kept as is.
+func migrateDeprecatedAnnotations(annotations map[string]string, deprecated []deprecatedAnnotation) map[string]string {
+	migrated := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		migrated[k] = v
+	}
+	for _, d := range deprecated {
+		if _, ok := migrated[d.replacement]; !ok {
+			migrated[d.replacement] = d.replacementValue(migrated[d.key])
+		}
+		delete(migrated, d.key)
+	}
+	return migrated
+}
+
+// handleDeprecatedServiceAnnotations warns about deprecated annotations on the
+// service and, if the MigrateDeprecatedAnnotations alpha feature is enabled,
+// rewrites them to their replacements.
+func (g *Cloud) handleDeprecatedServiceAnnotations(svc *v1.Service) {
+	// Services of other LoadBalancerClasses are not handled by this provider.
+	if !g.managesLoadBalancerClass(svc) {
+		return
+	}
+	deprecated := findDeprecatedAnnotations(deprecatedServiceAnnotations, svc.Annotations)
+	if len(deprecated) == 0 {
+		return
+	}
+	g.warnDeprecatedAnnotations(svc, svc.Annotations, deprecated)
+	if !g.AlphaFeatureGate.Enabled(AlphaFeatureMigrateDeprecatedAnnotations) {
+		return
+	}
+	updated := svc.DeepCopy()
+	updated.Annotations = migrateDeprecatedAnnotations(svc.Annotations, deprecated)
+	if _, err := servicehelper.PatchService(g.client.CoreV1(), svc, updated); err != nil {
+		klog.Warningf("Failed to migrate deprecated annotations on service %s/%s: %v", svc.Namespace, svc.Name, err)
+		return
+	}
+	klog.Infof("Migrated deprecated annotations on service %s/%s", svc.Namespace, svc.Name)
+}
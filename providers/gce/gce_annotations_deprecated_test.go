@@ -0,0 +1,116 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestHandleDeprecatedServiceAnnotations(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc            string
+		migrate         bool
+		annotations     map[string]string
+		wantEvents      []string
+		wantAnnotations map[string]string
+	}{
+		{
+			desc:            "no deprecated annotations",
+			annotations:     map[string]string{ServiceAnnotationLoadBalancerType: string(LBTypeInternal)},
+			wantAnnotations: map[string]string{ServiceAnnotationLoadBalancerType: string(LBTypeInternal)},
+		},
+		{
+			desc: "warn only",
+			annotations: map[string]string{
+				deprecatedServiceAnnotationLoadBalancerType: string(deprecatedTypeInternalLowerCase),
+				deprecatedServiceAnnotationILBBackendShare:  "true",
+			},
+			wantEvents: []string{
+				`Warning DeprecatedAnnotation Annotation "cloud.google.com/load-balancer-backend-share" is deprecated, use "alpha.cloud.google.com/load-balancer-backend-share" instead`,
+				`Warning DeprecatedAnnotation Annotation "cloud.google.com/load-balancer-type" is deprecated, use "networking.gke.io/load-balancer-type" with value "Internal" instead`,
+			},
+			wantAnnotations: map[string]string{
+				deprecatedServiceAnnotationLoadBalancerType: string(deprecatedTypeInternalLowerCase),
+				deprecatedServiceAnnotationILBBackendShare:  "true",
+			},
+		},
+		{
+			desc:        "migrate",
+			migrate:     true,
+			annotations: map[string]string{deprecatedServiceAnnotationLoadBalancerType: string(deprecatedTypeInternalLowerCase)},
+			wantEvents: []string{
+				`Warning DeprecatedAnnotation Annotation "cloud.google.com/load-balancer-type" is deprecated, use "networking.gke.io/load-balancer-type" with value "Internal" instead`,
+			},
+			wantAnnotations: map[string]string{ServiceAnnotationLoadBalancerType: string(LBTypeInternal)},
+		},
+		{
+			desc:    "migrate keeps existing replacement",
+			migrate: true,
+			annotations: map[string]string{
+				deprecatedServiceAnnotationILBBackendShare: "true",
+				ServiceAnnotationILBBackendShare:           "false",
+			},
+			wantEvents: []string{
+				`Warning DeprecatedAnnotation Annotation "cloud.google.com/load-balancer-backend-share" is deprecated, use "alpha.cloud.google.com/load-balancer-backend-share" instead`,
+			},
+			wantAnnotations: map[string]string{ServiceAnnotationILBBackendShare: "false"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			vals := DefaultTestClusterValues()
+			gce, err := fakeGCECloud(vals)
+			require.NoError(t, err)
+			recorder := record.NewFakeRecorder(10)
+			gce.eventRecorder = recorder
+			if tc.migrate {
+				gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureMigrateDeprecatedAnnotations})
+			}
+
+			svc := fakeLoadbalancerService("")
+			svc.Annotations = tc.annotations
+			svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			gce.handleDeprecatedServiceAnnotations(svc)
+
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			assert.Equal(t, tc.wantEvents, events)
+
+			svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantAnnotations, svc.Annotations)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/googleapi"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	apiCallLabels = []string{
+		"service",   // GCE API service, e.g. ForwardingRules.
+		"operation", // API method, e.g. Insert.
+		"version",   // API version.
+	}
+
+	apiCallCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_gce_api_calls_total",
+			Help:           "Number of GCE API calls by service, operation, version and HTTP status code",
+			StabilityLevel: metrics.ALPHA,
+		},
+		append(apiCallLabels, "code"),
+	)
+	apiCallDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_gce_api_call_duration_seconds",
+			Help:           "Latency of GCE API calls, including waiting for the completion of the operations they start",
+			Buckets:        metrics.ExponentialBuckets(0.01, 2, 15),
+			StabilityLevel: metrics.ALPHA,
+		},
+		apiCallLabels,
+	)
+	apiCallQuotaExceededCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_gce_api_quota_exceeded_total",
+			Help:           "Number of GCE API calls that failed because a rate limit or quota was exceeded",
+			StabilityLevel: metrics.ALPHA,
+		},
+		apiCallLabels,
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(apiCallCount, apiCallDuration, apiCallQuotaExceededCount)
+}
+
+// quotaExceededReasons are the googleapi error reasons of the calls rejected
+// because a rate limit or quota was exceeded.
+var quotaExceededReasons = []string{"rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded"}
+
+// instrumentedRateLimiter wraps a cloud.RateLimiter to record metrics for
+// every GCE API call made through the cloud.Cloud client. The rate limiter is
+// used as the instrumentation point as it is called before and after every
+// call.
+type instrumentedRateLimiter struct {
+	cloud.RateLimiter
+
+	mu sync.Mutex
+	// starts holds the start times of the in-flight calls.
+	starts map[apiCall]*apiCallStarts
+}
+
+// apiCall identifies the calls by their context and the value of their key:
+// the operation polls pass a new key to each Accept and to Observe.
+type apiCall struct {
+	ctx context.Context
+	key cloud.RateLimitKey
+}
+
+// apiCallStarts are the start times of the in-flight calls of an apiCall,
+// oldest first.
+type apiCallStarts struct {
+	times []time.Time
+	// stop stops the deletion of the starts once the context of the calls
+	// is done, which ends the operation polls without an Observe.
+	stop func() bool
+}
+
+// operationsService is the service of the operation polls.
+const operationsService = "Operations"
+
+func newInstrumentedRateLimiter(rl cloud.RateLimiter) *instrumentedRateLimiter {
+	return &instrumentedRateLimiter{RateLimiter: rl, starts: map[apiCall]*apiCallStarts{}}
+}
+
+// Accept blocks until the wrapped rate limiter accepts the call, and starts
+// its latency measurement. The polls of an operation are measured from the
+// first one.
+func (l *instrumentedRateLimiter) Accept(ctx context.Context, key *cloud.RateLimitKey) error {
+	if err := l.RateLimiter.Accept(ctx, key); err != nil {
+		return err
+	}
+	call := apiCall{ctx: ctx, key: *key}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	starts, ok := l.starts[call]
+	if !ok {
+		starts = &apiCallStarts{stop: func() bool { return false }}
+		if ctx.Done() != nil {
+			starts.stop = context.AfterFunc(ctx, func() { l.forget(call, starts) })
+		}
+		l.starts[call] = starts
+	} else if key.Service == operationsService {
+		return nil
+	}
+	starts.times = append(starts.times, time.Now())
+	return nil
+}
+
+// Observe records the metrics of the call and passes its result to the
+// wrapped rate limiter.
+func (l *instrumentedRateLimiter) Observe(ctx context.Context, err error, key *cloud.RateLimitKey) {
+	if start, ok := l.popStart(apiCall{ctx: ctx, key: *key}); ok {
+		observeAPICall(key, start, err)
+	}
+	l.RateLimiter.Observe(ctx, err, key)
+}
+
+// popStart removes and returns the oldest start time of the call.
+func (l *instrumentedRateLimiter) popStart(call apiCall) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	starts, ok := l.starts[call]
+	if !ok {
+		return time.Time{}, false
+	}
+	start := starts.times[0]
+	starts.times = starts.times[1:]
+	if len(starts.times) == 0 {
+		starts.stop()
+		delete(l.starts, call)
+	}
+	return start, true
+}
+
+// forget deletes the starts of the call if they are still in flight.
+func (l *instrumentedRateLimiter) forget(call apiCall, starts *apiCallStarts) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.starts[call] == starts {
+		delete(l.starts, call)
+	}
+}
+
+func observeAPICall(key *cloud.RateLimitKey, start time.Time, err error) {
+	labels := []string{key.Service, key.Operation, string(key.Version)}
+	apiCallDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	apiCallCount.WithLabelValues(append(labels, apiCallCode(err))...).Inc()
+	if isQuotaExceededError(err) {
+		apiCallQuotaExceededCount.WithLabelValues(labels...).Inc()
+	}
+}
+
+// apiCallCode returns the HTTP status code of the call result, or "error" if
+// the call failed without a response from the API.
+func apiCallCode(err error) string {
+	if err == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.Code)
+	}
+	return "error"
+}
+
+// isQuotaExceededError returns true if the call was rejected because a rate
+// limit or quota was exceeded.
+func isQuotaExceededError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	for _, e := range apiErr.Errors {
+		for _, reason := range quotaExceededReasons {
+			if e.Reason == reason {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestInstrumentedRateLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/projects/test-project/global/firewalls/fw":
+			json.NewEncoder(w).Encode(&compute.Firewall{Name: "fw"})
+		case "/projects/test-project/global/firewalls/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "not found", "errors": [{"reason": "notFound"}]}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": {"code": 403, "message": "quota", "errors": [{"reason": "rateLimitExceeded"}]}}`))
+		}
+	}))
+	defer server.Close()
+	service, err := compute.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+	c := cloud.NewGCE(&cloud.Service{
+		GA:            service,
+		ProjectRouter: &cloud.SingleProjectRouter{ID: "test-project"},
+		RateLimiter:   newInstrumentedRateLimiter(&cloud.NopRateLimiter{}),
+	})
+
+	before := map[string]float64{}
+	for _, code := range []string{"200", "404", "403"} {
+		before[code], err = testutil.GetCounterMetricValue(apiCallCount.WithLabelValues("Firewalls", "Get", "ga", code))
+		require.NoError(t, err)
+	}
+	quotaBefore, err := testutil.GetCounterMetricValue(apiCallQuotaExceededCount.WithLabelValues("Firewalls", "Get", "ga"))
+	require.NoError(t, err)
+	durationsBefore, err := testutil.GetHistogramMetricCount(apiCallDuration.WithLabelValues("Firewalls", "Get", "ga"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = c.Firewalls().Get(ctx, meta.GlobalKey("fw"))
+	require.NoError(t, err)
+	_, err = c.Firewalls().Get(ctx, meta.GlobalKey("missing"))
+	require.Error(t, err)
+	_, err = c.Firewalls().Get(ctx, meta.GlobalKey("throttled"))
+	require.Error(t, err)
+
+	for code, want := range map[string]float64{"200": 1, "404": 1, "403": 1} {
+		count, err := testutil.GetCounterMetricValue(apiCallCount.WithLabelValues("Firewalls", "Get", "ga", code))
+		require.NoError(t, err)
+		assert.Equal(t, want, count-before[code], "calls with code %s", code)
+	}
+	quota, err := testutil.GetCounterMetricValue(apiCallQuotaExceededCount.WithLabelValues("Firewalls", "Get", "ga"))
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), quota-quotaBefore)
+	durations, err := testutil.GetHistogramMetricCount(apiCallDuration.WithLabelValues("Firewalls", "Get", "ga"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), durations-durationsBefore)
+}
+
+func TestInstrumentedRateLimiterOperationPolls(t *testing.T) {
+	l := newInstrumentedRateLimiter(&cloud.NopRateLimiter{})
+	pollKey := func() *cloud.RateLimitKey {
+		return &cloud.RateLimitKey{ProjectID: "test-project", Operation: "Get", Service: operationsService, Version: meta.VersionGA}
+	}
+	before, err := testutil.GetHistogramMetricCount(apiCallDuration.WithLabelValues(operationsService, "Get", "ga"))
+	require.NoError(t, err)
+
+	// Each poll uses a new key, only the last one is observed.
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Accept(ctx, pollKey()))
+	}
+	l.Observe(ctx, nil, pollKey())
+	assert.Empty(t, l.starts)
+	after, err := testutil.GetHistogramMetricCount(apiCallDuration.WithLabelValues(operationsService, "Get", "ga"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), after-before)
+
+	// The polls ended by the cancellation of their context are forgotten.
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, l.Accept(cancelCtx, pollKey()))
+	cancel()
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.starts) == 0
+	}, wait.ForeverTestTimeout, 10*time.Millisecond)
+}
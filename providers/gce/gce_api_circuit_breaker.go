@@ -0,0 +1,217 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/googleapi"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// apiCircuitBaseBackoff is how long the circuit of an API service stays
+	// open after its first call rejected because a rate limit was exceeded.
+	// It doubles on every further rejection, up to apiCircuitMaxBackoff.
+	apiCircuitBaseBackoff = 5 * time.Second
+	apiCircuitMaxBackoff  = 5 * time.Minute
+	// apiCircuitJitter is the maximum fraction of the backoff added to it, so
+	// that the callers blocked by an open circuit do not all retry at once.
+	apiCircuitJitter = 0.5
+
+	// degradedCloudAPIReason is the reason of the events emitted when the
+	// circuit of an API service opens.
+	degradedCloudAPIReason = "DegradedCloudAPI"
+	// recoveredCloudAPIReason is the reason of the events emitted when the
+	// circuit of an API service closes.
+	recoveredCloudAPIReason = "RecoveredCloudAPI"
+)
+
+var apiCircuitOpen = metrics.NewGaugeVec(
+	&metrics.GaugeOpts{
+		Name:           "cloudprovider_gce_api_circuit_open",
+		Help:           "Whether the mutating calls to a GCE API service are rejected without being made, because the service exceeded its rate limit",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"service"},
+)
+
+func init() {
+	legacyregistry.MustRegister(apiCircuitOpen)
+}
+
+// apiCircuit is the state of the circuit of an API service.
+type apiCircuit struct {
+	// trips is the number of consecutive calls rejected because a rate
+	// limit was exceeded, zero if the circuit is closed.
+	trips     int
+	openUntil time.Time
+}
+
+// apiCircuitBreaker stops making the calls to the GCE API services, e.g.
+// ForwardingRules, that exceeded their rate limit for a jittered exponential
+// backoff, so that the controllers retrying them do not make the situation
+// worse. Once the backoff elapsed calls are made again, the first successful
+// call closes the circuit. Exceeded quotas do not open the circuit, as
+// backing off does not free them, and the reads and deletions are always
+// made, as they are needed to observe and to free the resources. Its zero
+// value is ready to use.
+type apiCircuitBreaker struct {
+	mu       sync.Mutex
+	circuits map[string]*apiCircuit
+}
+
+// apiCircuitOpenError is the error of the calls rejected by an open circuit.
+type apiCircuitOpenError struct {
+	service string
+	until   time.Time
+}
+
+func (e *apiCircuitOpenError) Error() string {
+	return fmt.Sprintf("GCE API %s calls suspended until %v after exceeding a rate limit", e.service, e.until.Format(time.RFC3339))
+}
+
+// rateLimitExceededReasons are the googleapi error reasons of the calls
+// rejected because a rate limit was exceeded.
+var rateLimitExceededReasons = []string{"rateLimitExceeded", "userRateLimitExceeded"}
+
+// isRateLimitExceededError returns true if the call was rejected because a
+// rate limit, rather than a quota, was exceeded.
+func isRateLimitExceededError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	for _, e := range apiErr.Errors {
+		for _, reason := range rateLimitExceededReasons {
+			if e.Reason == reason {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bypassesAPICircuit returns whether the calls of the operation are made
+// regardless of the circuit of their API service, i.e. reads and deletions.
+func bypassesAPICircuit(operation string) bool {
+	return operation == "Delete" || operation == "AggregatedList" || strings.HasPrefix(operation, "Get") || strings.HasPrefix(operation, "List")
+}
+
+// accept returns an error if the circuit of the API service is open and the
+// operation does not bypass it.
+func (b *apiCircuitBreaker) accept(service, operation string, now time.Time) error {
+	if bypassesAPICircuit(operation) {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit, ok := b.circuits[service]
+	if !ok || !now.Before(circuit.openUntil) {
+		return nil
+	}
+	return &apiCircuitOpenError{service: service, until: circuit.openUntil}
+}
+
+// observe updates the circuit of the API service with the result of a call of
+// the operation. It returns whether the circuit opened, i.e. this is the first
+// rejection since the last successful call, and whether it closed. The calls
+// bypassing the circuit do not update it, as their rate limits are not those
+// of the calls it suspends.
+func (b *apiCircuitBreaker) observe(service, operation string, err error, now time.Time) (opened, closed bool, until time.Time) {
+	if bypassesAPICircuit(operation) {
+		return false, false, time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	circuit, ok := b.circuits[service]
+	if !isRateLimitExceededError(err) {
+		if !ok || err != nil {
+			return false, false, time.Time{}
+		}
+		delete(b.circuits, service)
+		return false, true, time.Time{}
+	}
+	if !ok {
+		if b.circuits == nil {
+			b.circuits = map[string]*apiCircuit{}
+		}
+		circuit = &apiCircuit{}
+		b.circuits[service] = circuit
+	}
+	circuit.trips++
+	backoff := apiCircuitMaxBackoff
+	if circuit.trips <= 16 && apiCircuitBaseBackoff<<(circuit.trips-1) < apiCircuitMaxBackoff {
+		backoff = apiCircuitBaseBackoff << (circuit.trips - 1)
+	}
+	circuit.openUntil = now.Add(wait.Jitter(backoff, apiCircuitJitter))
+	return circuit.trips == 1, false, circuit.openUntil
+}
+
+// acceptAPICall returns an error if the call of key is suspended.
+func (g *Cloud) acceptAPICall(key *cloud.RateLimitKey) error {
+	return g.apiCircuitBreaker.accept(key.Service, key.Operation, time.Now())
+}
+
+// observeAPICallResult opens or closes the circuit of the API service of key
+// depending on the result of a call, and reports the transitions with a
+// metric, a log and an event. Successful calls are recorded in the
+// apiCallHealth too.
+func (g *Cloud) observeAPICallResult(key *cloud.RateLimitKey, err error) {
+	g.apiCallHealth.observe(err, time.Now())
+	opened, closed, until := g.apiCircuitBreaker.observe(key.Service, key.Operation, err, time.Now())
+	switch {
+	case opened:
+		apiCircuitOpen.WithLabelValues(key.Service).Set(1)
+		msg := fmt.Sprintf("GCE API %s exceeded a rate limit, suspending its mutating calls until %v: %v", key.Service, until.Format(time.RFC3339), err)
+		klog.Warning(msg)
+		g.recordCloudAPIEvent(v1.EventTypeWarning, degradedCloudAPIReason, msg)
+	case closed:
+		apiCircuitOpen.WithLabelValues(key.Service).Set(0)
+		msg := fmt.Sprintf("GCE API %s calls succeed again", key.Service)
+		klog.Info(msg)
+		g.recordCloudAPIEvent(v1.EventTypeNormal, recoveredCloudAPIReason, msg)
+	}
+}
+
+// recordCloudAPIEvent records an event about the GCE API. The calls are not
+// made on behalf of a given object, so the event is recorded on the cloud
+// provider itself.
+func (g *Cloud) recordCloudAPIEvent(eventType, reason, msg string) {
+	if g.eventRecorder == nil {
+		return
+	}
+	ref := &v1.ObjectReference{Kind: "CloudProvider", Namespace: metav1.NamespaceSystem, Name: ProviderName}
+	g.eventRecorder.Event(ref, eventType, reason, msg)
+}
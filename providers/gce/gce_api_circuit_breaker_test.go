@@ -0,0 +1,129 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestAPICircuitBreaker(t *testing.T) {
+	rateLimitErr := &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}
+	notFoundErr := &googleapi.Error{Code: http.StatusNotFound}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &apiCircuitBreaker{}
+
+	assert.NoError(t, b.accept("Firewalls", "Insert", now))
+	opened, closed, until := b.observe("Firewalls", "Insert", rateLimitErr, now)
+	assert.True(t, opened)
+	assert.False(t, closed)
+	assert.False(t, until.Before(now.Add(apiCircuitBaseBackoff)))
+	assert.True(t, until.Before(now.Add(apiCircuitBaseBackoff*3/2+time.Nanosecond)))
+	assert.Error(t, b.accept("Firewalls", "Insert", now))
+	// Other API services are not affected.
+	assert.NoError(t, b.accept("ForwardingRules", "Insert", now))
+	// Nor are the reads and deletions, which do not close the circuit either.
+	for _, op := range []string{"Get", "List", "AggregatedList", "GetHealth", "Delete"} {
+		assert.NoError(t, b.accept("Firewalls", op, now), op)
+		_, closed, _ = b.observe("Firewalls", op, nil, now)
+		assert.False(t, closed, op)
+	}
+	assert.Error(t, b.accept("Firewalls", "Insert", now))
+
+	// Calls are made again once the backoff elapsed, the backoff doubles if
+	// they are still rejected.
+	now = until
+	require.NoError(t, b.accept("Firewalls", "Insert", now))
+	opened, closed, until = b.observe("Firewalls", "Insert", rateLimitErr, now)
+	assert.False(t, opened)
+	assert.False(t, closed)
+	assert.False(t, until.Before(now.Add(2*apiCircuitBaseBackoff)))
+	assert.Error(t, b.accept("Firewalls", "Insert", now))
+
+	// Other errors, including exceeded quotas, neither open nor close the
+	// circuit.
+	quotaErr := &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}
+	opened, closed, _ = b.observe("ForwardingRules", "Insert", quotaErr, now)
+	assert.False(t, opened)
+	assert.False(t, closed)
+	assert.NoError(t, b.accept("ForwardingRules", "Insert", now))
+	now = until
+	opened, closed, _ = b.observe("Firewalls", "Insert", notFoundErr, now)
+	assert.False(t, opened)
+	assert.False(t, closed)
+
+	opened, closed, _ = b.observe("Firewalls", "Insert", nil, now)
+	assert.False(t, opened)
+	assert.True(t, closed)
+	assert.NoError(t, b.accept("Firewalls", "Insert", now))
+
+	// The backoff is reset once closed.
+	_, _, until = b.observe("Firewalls", "Insert", rateLimitErr, now)
+	assert.True(t, until.Before(now.Add(apiCircuitBaseBackoff*3/2+time.Nanosecond)))
+}
+
+func TestAPICircuitBreakerMaxBackoff(t *testing.T) {
+	rateLimitErr := &googleapi.Error{Code: http.StatusTooManyRequests}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &apiCircuitBreaker{}
+	var until time.Time
+	for i := 0; i < 100; i++ {
+		_, _, until = b.observe("Firewalls", "Insert", rateLimitErr, now)
+	}
+	assert.False(t, until.Before(now.Add(apiCircuitMaxBackoff)))
+	assert.True(t, until.Before(now.Add(apiCircuitMaxBackoff*3/2+time.Nanosecond)))
+}
+
+func TestGCERateLimiterCircuitBreaker(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	gce.eventRecorder = recorder
+	rl := &gceRateLimiter{gce}
+	key := &cloud.RateLimitKey{Service: "TargetPools", Operation: "Insert", Version: "ga"}
+	ctx := context.Background()
+
+	require.NoError(t, rl.Accept(ctx, key))
+	rl.Observe(ctx, &googleapi.Error{Code: http.StatusTooManyRequests}, key)
+	assert.Error(t, rl.Accept(ctx, key))
+	open, err := testutil.GetGaugeMetricValue(apiCircuitOpen.WithLabelValues("TargetPools"))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, open)
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Warning "+degradedCloudAPIReason), "unexpected event %q", event)
+
+	rl.Observe(ctx, nil, key)
+	assert.NoError(t, rl.Accept(ctx, key))
+	open, err = testutil.GetGaugeMetricValue(apiCircuitOpen.WithLabelValues("TargetPools"))
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, open)
+	event = <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Normal "+recoveredCloudAPIReason), "unexpected event %q", event)
+}
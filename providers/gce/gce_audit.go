@@ -0,0 +1,266 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/googleapi"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// mutationAuditedReason is the reason of the events recorded on the
+	// object a GCE resource was mutated for.
+	mutationAuditedReason = "GCEResourceMutated"
+	// mutationAuditFailedReason is the reason of the events recorded on the
+	// object a GCE resource mutation failed for.
+	mutationAuditFailedReason = "GCEResourceMutationFailed"
+)
+
+// auditedResources maps the resources passed to auditMutation to their
+// compute API collection and service.
+var auditedResources = map[string]struct{ collection, service string }{
+	"address":                {"addresses", "Addresses"},
+	"backend service":        {"backendServices", "BackendServices"},
+	"firewall":               {"firewalls", "Firewalls"},
+	"forwarding rule":        {"forwardingRules", "ForwardingRules"},
+	"global address":         {"addresses", "GlobalAddresses"},
+	"global forwarding rule": {"forwardingRules", "GlobalForwardingRules"},
+	"health check":           {"healthChecks", "HealthChecks"},
+	"HTTP health check":      {"httpHealthChecks", "HttpHealthChecks"},
+	"HTTPS health check":     {"httpsHealthChecks", "HttpsHealthChecks"},
+	"instance group":         {"instanceGroups", "InstanceGroups"},
+	"network endpoint group": {"networkEndpointGroups", "NetworkEndpointGroups"},
+	"region backend service": {"backendServices", "RegionBackendServices"},
+	"region health check":    {"healthChecks", "RegionHealthChecks"},
+	"route":                  {"routes", "Routes"},
+	"security policy":        {"securityPolicies", "SecurityPolicies"},
+	"service attachment":     {"serviceAttachments", "ServiceAttachments"},
+	"SSL certificate":        {"sslCertificates", "SslCertificates"},
+	"target HTTP proxy":      {"targetHttpProxies", "TargetHttpProxies"},
+	"target HTTPS proxy":     {"targetHttpsProxies", "TargetHttpsProxies"},
+	"target pool":            {"targetPools", "TargetPools"},
+	"URL map":                {"urlMaps", "UrlMaps"},
+}
+
+// mutationAudit is the audit record of a mutating GCE API call.
+type mutationAudit struct {
+	operation   string
+	resource    string
+	resourceURL string
+	// fields are the top-level fields of the resource or request sent with
+	// the call.
+	fields []string
+	// initiator is the object the call is made for, if known.
+	initiator *v1.ObjectReference
+
+	mu sync.Mutex
+	// operationID is the name of the GCE operation started by the call, set
+	// by auditTransport.
+	operationID string
+}
+
+type auditContextKey struct{}
+
+type auditInitiatorContextKey struct{}
+
+// withAuditInitiator returns a context attributing the GCE resource
+// mutations made with it to the object.
+func withAuditInitiator(ctx context.Context, initiator *v1.ObjectReference) context.Context {
+	return context.WithValue(ctx, auditInitiatorContextKey{}, initiator)
+}
+
+// auditInitiators holds the Services whose load balancer is being synced by
+// load balancer name, to attribute the mutations of the load balancer
+// resources, which are named after it, to them.
+type auditInitiators struct {
+	mu       sync.Mutex
+	services map[string]*v1.ObjectReference
+}
+
+// auditMutationsFor attributes the mutations of the resources of the load
+// balancer of the Service to it until the returned function is called.
+func (g *Cloud) auditMutationsFor(svc *v1.Service) func() {
+	name := g.loadBalancerName(svc)
+	ref := &v1.ObjectReference{Kind: "Service", APIVersion: "v1", Namespace: svc.Namespace, Name: svc.Name, UID: svc.UID}
+	a := &g.auditInitiators
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.services == nil {
+		a.services = map[string]*v1.ObjectReference{}
+	}
+	a.services[name] = ref
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.services[name] == ref {
+			delete(a.services, name)
+		}
+	}
+}
+
+// initiator returns the Service whose load balancer owns the named resource.
+func (a *auditInitiators) initiator(resourceName string) *v1.ObjectReference {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for name, ref := range a.services {
+		if strings.Contains(resourceName, name) {
+			return ref
+		}
+	}
+	return nil
+}
+
+// auditMutation starts the audit of a mutating call on the resource with the
+// given key. obj is the resource or request sent with the call, if any. The
+// call must be made with the returned context, and its error passed to the
+// returned function, which records the audit with a structured log and, if
+// the object the call was made for is known, an event on it. If the intent log
+// is enabled, the call is recorded to it first.
+func (g *Cloud) auditMutation(ctx context.Context, operation, resource string, key *meta.Key, obj interface{}) (context.Context, func(error) error) {
+	a := &mutationAudit{operation: operation, resource: resource, fields: auditedFields(obj)}
+	if r, ok := auditedResources[resource]; ok {
+		projectID := (&gceProjectRouter{g}).ProjectID(ctx, meta.VersionGA, r.service)
+		a.resourceURL = cloud.SelfLink(meta.VersionGA, projectID, r.collection, key)
+	} else {
+		a.resourceURL = key.String()
+	}
+	if initiator, ok := ctx.Value(auditInitiatorContextKey{}).(*v1.ObjectReference); ok {
+		a.initiator = initiator
+	} else {
+		a.initiator = g.auditInitiators.initiator(key.Name)
+	}
+	acknowledge := g.withIntent(a)
+	return context.WithValue(ctx, auditContextKey{}, a), func(err error) error {
+		acknowledge(err)
+		g.recordMutationAudit(a, err)
+		return withOperationID(a, err)
+	}
+}
+
+// withOperationID adds the name of the GCE operation started by the audited
+// call to the message of its error, if the operation failed, so that it is
+// reported with the error.
+func withOperationID(a *mutationAudit, err error) error {
+	a.mu.Lock()
+	operationID := a.operationID
+	a.mu.Unlock()
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok || operationID == "" || strings.Contains(apiErr.Message, operationID) {
+		return err
+	}
+	apiErr.Message += " (operation " + operationID + ")"
+	return err
+}
+
+func (g *Cloud) recordMutationAudit(a *mutationAudit, err error) {
+	a.mu.Lock()
+	operationID := a.operationID
+	a.mu.Unlock()
+	var initiatorKind string
+	var initiator klog.ObjectRef
+	if a.initiator != nil {
+		initiatorKind = a.initiator.Kind
+		initiator = klog.KRef(a.initiator.Namespace, a.initiator.Name)
+	}
+	klog.InfoS("Audit: GCE resource mutation", "operation", a.operation, "resource", a.resource,
+		"resourceURL", a.resourceURL, "fields", a.fields, "operationID", operationID,
+		"initiatorKind", initiatorKind, "initiator", initiator, "err", err)
+
+	if a.initiator == nil || g.eventRecorder == nil {
+		return
+	}
+	msg := a.operation + " " + a.resource + " " + a.resourceURL
+	if operationID != "" {
+		msg += " (operation " + operationID + ")"
+	}
+	if len(a.fields) > 0 {
+		msg += ", fields: " + strings.Join(a.fields, ", ")
+	}
+	if err != nil {
+		g.eventRecorder.Eventf(a.initiator, v1.EventTypeWarning, mutationAuditFailedReason, "Failed to %s: %v", msg, err)
+		return
+	}
+	g.eventRecorder.Eventf(a.initiator, v1.EventTypeNormal, mutationAuditedReason, "Called %s", msg)
+}
+
+// auditedFields returns the sorted top-level fields of the JSON encoding of
+// obj, which is what a mutation sets or changes.
+func auditedFields(obj interface{}) []string {
+	if obj == nil {
+		return nil
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// auditTransport records the name of the operations started by the audited
+// mutating GCE API calls in their audit.
+type auditTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	a, ok := req.Context().Value(auditContextKey{}).(*mutationAudit)
+	if err != nil || !ok || req.Method == http.MethodGet || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var op struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(body, &op) == nil && strings.HasSuffix(op.Kind, "#operation") {
+		a.mu.Lock()
+		a.operationID = op.Name
+		a.mu.Unlock()
+	}
+	return resp, nil
+}
@@ -0,0 +1,168 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAuditMutationInitiator(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	gce.eventRecorder = recorder
+
+	svc := fakeLoadbalancerService("")
+	svc.UID = types.UID("f0ca7b2d-8f5c-4e15-9d8e-5ac3fb1c1b4e")
+	fwName := MakeFirewallName(gce.GetLoadBalancerName(context.TODO(), "", svc))
+	done := gce.auditMutationsFor(svc)
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: fwName, SourceRanges: []string{"0.0.0.0/0"}}))
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Normal "+mutationAuditedReason), "unexpected event %q", event)
+	assert.Contains(t, event, "projects/"+vals.ProjectID+"/global/firewalls/"+fwName)
+	assert.Contains(t, event, "fields: name, sourceRanges")
+
+	// Mutations of other resources are not attributed to the Service.
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "other"}))
+	assert.Empty(t, recorder.Events)
+
+	// Nor are the mutations made once its load balancer is synced.
+	done()
+	require.NoError(t, gce.DeleteFirewall(fwName))
+	assert.Empty(t, recorder.Events)
+
+	// Failed mutations are recorded too.
+	done = gce.auditMutationsFor(svc)
+	defer done()
+	require.Error(t, gce.DeleteFirewall(fwName))
+	require.Len(t, recorder.Events, 1)
+	event = <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Warning "+mutationAuditFailedReason), "unexpected event %q", event)
+}
+
+func TestAuditMutationLoadBalancerResources(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	gce.eventRecorder = recorder
+
+	svc := fakeLoadbalancerService("")
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	done := gce.auditMutationsFor(svc)
+	defer done()
+	require.NoError(t, gce.ReserveRegionAddress(&compute.Address{Name: lbName}, vals.Region))
+	require.NoError(t, gce.CreateHealthCheck(&compute.HealthCheck{Name: lbName}))
+	require.NoError(t, gce.CreateRegionBackendService(&compute.BackendService{Name: lbName}, vals.Region))
+	require.NoError(t, gce.DeleteRegionBackendService(lbName, vals.Region))
+	for _, want := range []string{
+		"insert address https://www.googleapis.com/compute/v1/projects/" + vals.ProjectID + "/regions/" + vals.Region + "/addresses/" + lbName,
+		"insert health check https://www.googleapis.com/compute/v1/projects/" + vals.ProjectID + "/global/healthChecks/" + lbName,
+		"insert region backend service https://www.googleapis.com/compute/v1/projects/" + vals.ProjectID + "/regions/" + vals.Region + "/backendServices/" + lbName,
+		"delete region backend service https://www.googleapis.com/compute/v1/projects/" + vals.ProjectID + "/regions/" + vals.Region + "/backendServices/" + lbName,
+	} {
+		require.NotEmpty(t, recorder.Events)
+		event := <-recorder.Events
+		assert.True(t, strings.HasPrefix(event, "Normal "+mutationAuditedReason), "unexpected event %q", event)
+		assert.Contains(t, event, want)
+	}
+	assert.Empty(t, recorder.Events)
+}
+
+func TestAuditMutationContextInitiator(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	gce.eventRecorder = recorder
+
+	ctx := withAuditInitiator(context.Background(), nodeReference("node-1"))
+	_, audit := gce.auditMutation(ctx, "delete", "route", meta.GlobalKey("route-1"), nil)
+	require.NoError(t, audit(nil))
+	require.Len(t, recorder.Events, 1)
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Normal "+mutationAuditedReason), "unexpected event %q", event)
+	assert.Contains(t, event, "/global/routes/route-1")
+}
+
+func TestAuditTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"kind": "compute#firewall", "name": "fw"}`))
+			return
+		}
+		w.Write([]byte(`{"kind": "compute#operation", "name": "operation-1234"}`))
+	}))
+	defer server.Close()
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	client := &http.Client{Transport: &auditTransport{base: http.DefaultTransport}}
+
+	for _, tc := range []struct {
+		method string
+		want   string
+	}{
+		{method: http.MethodPost, want: "operation-1234"},
+		{method: http.MethodGet, want: ""},
+	} {
+		ctx, _ := gce.auditMutation(context.Background(), "insert", "firewall", meta.GlobalKey("fw"), nil)
+		req, err := http.NewRequestWithContext(ctx, tc.method, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.NotEmpty(t, body, "response body must remain readable")
+		assert.Equal(t, tc.want, ctx.Value(auditContextKey{}).(*mutationAudit).operationID, "method %s", tc.method)
+	}
+}
+
+func TestAuditMutationOperationID(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+
+	ctx, done := gce.auditMutation(context.Background(), "insert", "firewall", meta.GlobalKey("fw"), nil)
+	a := ctx.Value(auditContextKey{}).(*mutationAudit)
+	a.operationID = "operation-1234"
+	err = done(&googleapi.Error{Code: http.StatusForbidden, Message: "QUOTA_EXCEEDED - Quota 'FIREWALLS' exceeded."})
+	apiErr, ok := err.(*googleapi.Error)
+	require.True(t, ok, "the error must remain a googleapi.Error, got %T", err)
+	assert.Equal(t, "QUOTA_EXCEEDED - Quota 'FIREWALLS' exceeded. (operation operation-1234)", apiErr.Message)
+
+	d, ok := parseCloudError(err)
+	require.True(t, ok)
+	assert.Equal(t, "operation-1234", d.Operation)
+}
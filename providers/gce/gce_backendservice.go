@@ -73,8 +73,12 @@ func (g *Cloud) UpdateGlobalBackendService(bg *compute.BackendService) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "backend service", meta.GlobalKey(bg.Name), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "backend service", meta.GlobalKey(bg.Name), bg)
 	mc := newBackendServiceMetricContext("update", "")
-	return mc.Observe(g.c.BackendServices().Update(ctx, meta.GlobalKey(bg.Name), bg))
+	return mc.Observe(audit(g.c.BackendServices().Update(ctx, meta.GlobalKey(bg.Name), bg)))
 }
 
 // UpdateBetaGlobalBackendService applies the given beta BackendService as an
@@ -83,8 +87,12 @@ func (g *Cloud) UpdateBetaGlobalBackendService(bg *computebeta.BackendService) e
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "backend service", meta.GlobalKey(bg.Name), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "backend service", meta.GlobalKey(bg.Name), bg)
 	mc := newBackendServiceMetricContextWithVersion("update", "", computeBetaVersion)
-	return mc.Observe(g.c.BetaBackendServices().Update(ctx, meta.GlobalKey(bg.Name), bg))
+	return mc.Observe(audit(g.c.BetaBackendServices().Update(ctx, meta.GlobalKey(bg.Name), bg)))
 }
 
 // UpdateAlphaGlobalBackendService applies the given alpha BackendService as an
@@ -93,8 +101,12 @@ func (g *Cloud) UpdateAlphaGlobalBackendService(bg *computealpha.BackendService)
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "backend service", meta.GlobalKey(bg.Name), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "backend service", meta.GlobalKey(bg.Name), bg)
 	mc := newBackendServiceMetricContextWithVersion("update", "", computeAlphaVersion)
-	return mc.Observe(g.c.AlphaBackendServices().Update(ctx, meta.GlobalKey(bg.Name), bg))
+	return mc.Observe(audit(g.c.AlphaBackendServices().Update(ctx, meta.GlobalKey(bg.Name), bg)))
 }
 
 // DeleteGlobalBackendService deletes the given BackendService by name.
@@ -102,8 +114,12 @@ func (g *Cloud) DeleteGlobalBackendService(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "backend service", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "backend service", meta.GlobalKey(name), nil)
 	mc := newBackendServiceMetricContext("delete", "")
-	return mc.Observe(g.c.BackendServices().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.BackendServices().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // CreateGlobalBackendService creates the given BackendService.
@@ -111,8 +127,12 @@ func (g *Cloud) CreateGlobalBackendService(bg *compute.BackendService) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "backend service", meta.GlobalKey(bg.Name), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "backend service", meta.GlobalKey(bg.Name), bg)
 	mc := newBackendServiceMetricContext("create", "")
-	return mc.Observe(g.c.BackendServices().Insert(ctx, meta.GlobalKey(bg.Name), bg))
+	return mc.Observe(audit(g.c.BackendServices().Insert(ctx, meta.GlobalKey(bg.Name), bg)))
 }
 
 // CreateBetaGlobalBackendService creates the given beta BackendService.
@@ -120,8 +140,12 @@ func (g *Cloud) CreateBetaGlobalBackendService(bg *computebeta.BackendService) e
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "backend service", meta.GlobalKey(bg.Name), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "backend service", meta.GlobalKey(bg.Name), bg)
 	mc := newBackendServiceMetricContextWithVersion("create", "", computeBetaVersion)
-	return mc.Observe(g.c.BetaBackendServices().Insert(ctx, meta.GlobalKey(bg.Name), bg))
+	return mc.Observe(audit(g.c.BetaBackendServices().Insert(ctx, meta.GlobalKey(bg.Name), bg)))
 }
 
 // CreateAlphaGlobalBackendService creates the given alpha BackendService.
@@ -129,8 +153,12 @@ func (g *Cloud) CreateAlphaGlobalBackendService(bg *computealpha.BackendService)
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "backend service", meta.GlobalKey(bg.Name), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "backend service", meta.GlobalKey(bg.Name), bg)
 	mc := newBackendServiceMetricContextWithVersion("create", "", computeAlphaVersion)
-	return mc.Observe(g.c.AlphaBackendServices().Insert(ctx, meta.GlobalKey(bg.Name), bg))
+	return mc.Observe(audit(g.c.AlphaBackendServices().Insert(ctx, meta.GlobalKey(bg.Name), bg)))
 }
 
 // ListGlobalBackendServices lists all backend services in the project.
@@ -166,14 +194,42 @@ func (g *Cloud) GetRegionBackendService(name, region string) (*compute.BackendSe
 	return v, mc.Observe(err)
 }
 
+// GetAlphaRegionBackendService retrieves an alpha backend by name.
+func (g *Cloud) GetAlphaRegionBackendService(name, region string) (*computealpha.BackendService, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	mc := newBackendServiceMetricContextWithVersion("get", region, computeAlphaVersion)
+	v, err := g.c.AlphaRegionBackendServices().Get(ctx, meta.RegionalKey(name, region))
+	return v, mc.Observe(err)
+}
+
+// UpdateAlphaRegionBackendService applies the given alpha BackendService as an
+// update to an existing service.
+func (g *Cloud) UpdateAlphaRegionBackendService(bg *computealpha.BackendService, region string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	if g.skipMutation("update", "region backend service", meta.RegionalKey(bg.Name, region), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "region backend service", meta.RegionalKey(bg.Name, region), bg)
+	mc := newBackendServiceMetricContextWithVersion("update", region, computeAlphaVersion)
+	return mc.Observe(audit(g.c.AlphaRegionBackendServices().Update(ctx, meta.RegionalKey(bg.Name, region), bg)))
+}
+
 // UpdateRegionBackendService applies the given BackendService as an update to
 // an existing service.
 func (g *Cloud) UpdateRegionBackendService(bg *compute.BackendService, region string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "region backend service", meta.RegionalKey(bg.Name, region), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "region backend service", meta.RegionalKey(bg.Name, region), bg)
 	mc := newBackendServiceMetricContext("update", region)
-	return mc.Observe(g.c.RegionBackendServices().Update(ctx, meta.RegionalKey(bg.Name, region), bg))
+	return mc.Observe(audit(g.c.RegionBackendServices().Update(ctx, meta.RegionalKey(bg.Name, region), bg)))
 }
 
 // DeleteRegionBackendService deletes the given BackendService by name.
@@ -181,8 +237,12 @@ func (g *Cloud) DeleteRegionBackendService(name, region string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "region backend service", meta.RegionalKey(name, region), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "region backend service", meta.RegionalKey(name, region), nil)
 	mc := newBackendServiceMetricContext("delete", region)
-	return mc.Observe(g.c.RegionBackendServices().Delete(ctx, meta.RegionalKey(name, region)))
+	return mc.Observe(audit(g.c.RegionBackendServices().Delete(ctx, meta.RegionalKey(name, region))))
 }
 
 // CreateRegionBackendService creates the given BackendService.
@@ -190,8 +250,12 @@ func (g *Cloud) CreateRegionBackendService(bg *compute.BackendService, region st
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "region backend service", meta.RegionalKey(bg.Name, region), bg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "region backend service", meta.RegionalKey(bg.Name, region), bg)
 	mc := newBackendServiceMetricContext("create", region)
-	return mc.Observe(g.c.RegionBackendServices().Insert(ctx, meta.RegionalKey(bg.Name, region), bg))
+	return mc.Observe(audit(g.c.RegionBackendServices().Insert(ctx, meta.RegionalKey(bg.Name, region), bg)))
 }
 
 // ListRegionBackendServices lists all backend services in the project.
@@ -217,14 +281,37 @@ func (g *Cloud) GetRegionalBackendServiceHealth(name, region string, instanceGro
 	return v, mc.Observe(err)
 }
 
+// SetSecurityPolicyForRegionBackendService attaches the security policy with
+// the given link to the regional BackendService identified by the given
+// name, or detaches its security policy if the link is empty.
+func (g *Cloud) SetSecurityPolicyForRegionBackendService(name, region, securityPolicyLink string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	mc := newBackendServiceMetricContext("set_security_policy", region)
+	bs := &compute.BackendService{Name: name, SecurityPolicy: securityPolicyLink}
+	if securityPolicyLink == "" {
+		bs.NullFields = []string{"SecurityPolicy"}
+	}
+	if g.skipMutation("patch", "region backend service", meta.RegionalKey(name, region), bs) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "patch", "region backend service", meta.RegionalKey(name, region), bs)
+	return mc.Observe(audit(g.c.RegionBackendServices().Patch(ctx, meta.RegionalKey(name, region), bs)))
+}
+
 // SetSecurityPolicyForBetaGlobalBackendService sets the given
 // SecurityPolicyReference for the BackendService identified by the given name.
 func (g *Cloud) SetSecurityPolicyForBetaGlobalBackendService(backendServiceName string, securityPolicyReference *computebeta.SecurityPolicyReference) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("set security policy of", "backend service", meta.GlobalKey(backendServiceName), securityPolicyReference) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "set security policy of", "backend service", meta.GlobalKey(backendServiceName), securityPolicyReference)
 	mc := newBackendServiceMetricContextWithVersion("set_security_policy", "", computeBetaVersion)
-	return mc.Observe(g.c.BetaBackendServices().SetSecurityPolicy(ctx, meta.GlobalKey(backendServiceName), securityPolicyReference))
+	return mc.Observe(audit(g.c.BetaBackendServices().SetSecurityPolicy(ctx, meta.GlobalKey(backendServiceName), securityPolicyReference)))
 }
 
 // SetSecurityPolicyForAlphaGlobalBackendService sets the given
@@ -233,6 +320,10 @@ func (g *Cloud) SetSecurityPolicyForAlphaGlobalBackendService(backendServiceName
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("set security policy of", "backend service", meta.GlobalKey(backendServiceName), securityPolicyReference) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "set security policy of", "backend service", meta.GlobalKey(backendServiceName), securityPolicyReference)
 	mc := newBackendServiceMetricContextWithVersion("set_security_policy", "", computeAlphaVersion)
-	return mc.Observe(g.c.AlphaBackendServices().SetSecurityPolicy(ctx, meta.GlobalKey(backendServiceName), securityPolicyReference))
+	return mc.Observe(audit(g.c.AlphaBackendServices().SetSecurityPolicy(ctx, meta.GlobalKey(backendServiceName), securityPolicyReference)))
 }
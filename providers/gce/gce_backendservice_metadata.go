@@ -0,0 +1,274 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maxBackendServiceCustomDescriptionLength leaves room for the service name
+// in the backend service description, which is limited to 2048 characters.
+const maxBackendServiceCustomDescriptionLength = 1024
+
+// maxBackendServiceIdleTimeoutSec is the highest connection tracking idle
+// timeout passthrough load balancers accept with any session affinity.
+const maxBackendServiceIdleTimeoutSec = 600
+
+// maxBackendServiceDrainingTimeoutSec is the highest connection draining
+// timeout of backend services.
+const maxBackendServiceDrainingTimeoutSec = 3600
+
+// maxBackendServiceTimeoutSec is the highest backend service timeout set
+// with an annotation.
+const maxBackendServiceTimeoutSec = 86400
+
+// defaultBackendServiceTimeoutSec is the timeout of backend services that
+// do not set one.
+const defaultBackendServiceTimeoutSec = 30
+
+// securityPolicyNameRegexp matches the names of security policies.
+var securityPolicyNameRegexp = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+const (
+	// localityLBPolicyMaglev is the default locality load balancing policy of
+	// passthrough load balancer backend services.
+	localityLBPolicyMaglev = "MAGLEV"
+	// localityLBPolicyWeightedMaglev weighs the backends of a passthrough
+	// load balancer by the weight reported by their HTTP health check.
+	localityLBPolicyWeightedMaglev = "WEIGHTED_MAGLEV"
+)
+
+// backendServiceMetadata is the backend service configuration set with
+// Service annotations.
+type backendServiceMetadata struct {
+	// logConfig is nil if the connection logging config is not managed.
+	logConfig   *compute.BackendServiceLogConfig
+	description string
+	// sessionAffinity is empty if the one of the Service spec applies.
+	sessionAffinity string
+	// connectionTracking is nil if the connection tracking policy is not
+	// managed.
+	connectionTracking *compute.BackendServiceConnectionTrackingPolicy
+	// connectionDraining is nil if the connection draining timeout is not
+	// managed.
+	connectionDraining *compute.ConnectionDraining
+	// timeoutSec is 0 if the backend service timeout is not managed.
+	timeoutSec int64
+	// localityLBPolicy is empty if the locality load balancing policy is not
+	// managed.
+	localityLBPolicy string
+	// securityPolicy is the name of the security policy, empty to detach it,
+	// or nil if the security policy is not managed.
+	securityPolicy *string
+}
+
+// gceSessionAffinity returns the session affinity of the backend service of a
+// Service with the given spec affinity.
+func (md *backendServiceMetadata) gceSessionAffinity(affinityType v1.ServiceAffinity) string {
+	if md.sessionAffinity != "" {
+		return md.sessionAffinity
+	}
+	return translateAffinityType(affinityType)
+}
+
+// backendServiceMetadataAnnotations is the allow-list of Service annotations
+// configuring backend service metadata, with the parsers validating them.
+// Only fields that are supported by passthrough load balancer backend
+// services are allowed.
+var backendServiceMetadataAnnotations = map[string]func(value string, md *backendServiceMetadata) error{
+	ServiceAnnotationBackendServiceLoggingSampleRate: func(value string, md *backendServiceMetadata) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return fmt.Errorf("must be a number between 0.0 and 1.0")
+		}
+		md.logConfig = &compute.BackendServiceLogConfig{Enable: true, SampleRate: rate}
+		return nil
+	},
+	ServiceAnnotationBackendServiceDescription: func(value string, md *backendServiceMetadata) error {
+		if len(value) > maxBackendServiceCustomDescriptionLength {
+			return fmt.Errorf("must be at most %d characters", maxBackendServiceCustomDescriptionLength)
+		}
+		if strings.IndexFunc(value, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+			return fmt.Errorf("must only contain printable characters")
+		}
+		md.description = value
+		return nil
+	},
+	ServiceAnnotationBackendServiceSessionAffinity: func(value string, md *backendServiceMetadata) error {
+		switch value {
+		case gceAffinityTypeNone, gceAffinityTypeClientIP, gceAffinityTypeClientIPProto, gceAffinityTypeClientIPPortProto:
+		default:
+			return fmt.Errorf("must be one of %s, %s, %s or %s", gceAffinityTypeNone, gceAffinityTypeClientIP, gceAffinityTypeClientIPProto, gceAffinityTypeClientIPPortProto)
+		}
+		md.sessionAffinity = value
+		return nil
+	},
+	ServiceAnnotationBackendServiceSessionAffinityTimeout: func(value string, md *backendServiceMetadata) error {
+		timeout, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || timeout < 1 || timeout > maxBackendServiceIdleTimeoutSec {
+			return fmt.Errorf("must be a number of seconds between 1 and %d", maxBackendServiceIdleTimeoutSec)
+		}
+		md.connectionTracking = &compute.BackendServiceConnectionTrackingPolicy{IdleTimeoutSec: timeout}
+		return nil
+	},
+	ServiceAnnotationBackendServiceConnectionDrainingTimeout: func(value string, md *backendServiceMetadata) error {
+		timeout, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || timeout < 0 || timeout > maxBackendServiceDrainingTimeoutSec {
+			return fmt.Errorf("must be a number of seconds between 0 and %d", maxBackendServiceDrainingTimeoutSec)
+		}
+		md.connectionDraining = &compute.ConnectionDraining{DrainingTimeoutSec: timeout}
+		return nil
+	},
+	ServiceAnnotationBackendServiceTimeout: func(value string, md *backendServiceMetadata) error {
+		timeout, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || timeout < 1 || timeout > maxBackendServiceTimeoutSec {
+			return fmt.Errorf("must be a number of seconds between 1 and %d", maxBackendServiceTimeoutSec)
+		}
+		md.timeoutSec = timeout
+		return nil
+	},
+	ServiceAnnotationBackendServiceSecurityPolicy: func(value string, md *backendServiceMetadata) error {
+		if value != "" && !securityPolicyNameRegexp.MatchString(value) {
+			return fmt.Errorf("must be the name of a security policy")
+		}
+		md.securityPolicy = &value
+		return nil
+	},
+}
+
+// getBackendServiceMetadata returns the backend service metadata set with
+// the annotations of the service, and an error if an annotation is not in
+// the allow-list, has an invalid value, or the backend service is shared
+// with other services.
+func getBackendServiceMetadata(svc *v1.Service, sharedBackend bool) (*backendServiceMetadata, error) {
+	md := &backendServiceMetadata{}
+	var keys []string
+	for key := range svc.Annotations {
+		if strings.HasPrefix(key, ServiceAnnotationBackendServicePrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parse, ok := backendServiceMetadataAnnotations[key]
+		if !ok {
+			return nil, fmt.Errorf("unsupported backend service annotation %q", key)
+		}
+		if sharedBackend {
+			return nil, fmt.Errorf("annotation %q is not supported with shared backend services", key)
+		}
+		if err := parse(svc.Annotations[key], md); err != nil {
+			return nil, fmt.Errorf("invalid value %q of annotation %q: %v", svc.Annotations[key], key, err)
+		}
+	}
+	if md.connectionTracking != nil && md.gceSessionAffinity(svc.Spec.SessionAffinity) == gceAffinityTypeNone {
+		return nil, fmt.Errorf("annotation %q requires a session affinity", ServiceAnnotationBackendServiceSessionAffinityTimeout)
+	}
+	return md, nil
+}
+
+type backendServiceDescription struct {
+	ServiceName string `json:"kubernetes.io/service-name"`
+	Description string `json:"networking.gke.io/description,omitempty"`
+}
+
+// makeBackendServiceDescriptionWithMetadata returns the description of the
+// backend service of the service, including its custom description.
+func makeBackendServiceDescriptionWithMetadata(nm types.NamespacedName, shared bool, md *backendServiceMetadata) (string, error) {
+	if shared || md.description == "" {
+		return makeBackendServiceDescription(nm, shared), nil
+	}
+	out, err := json.Marshal(&backendServiceDescription{ServiceName: nm.String(), Description: md.description})
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// backendServiceLogConfigEqual returns true if a and b both disable
+// connection logging, or both enable it with the same sample rate.
+func backendServiceLogConfigEqual(a, b *compute.BackendServiceLogConfig) bool {
+	aEnabled := a != nil && a.Enable
+	bEnabled := b != nil && b.Enable
+	if !aEnabled || !bEnabled {
+		return aEnabled == bEnabled
+	}
+	return a.SampleRate == b.SampleRate
+}
+
+// backendServiceConnectionTrackingEqual returns true if a and b have the same
+// connection tracking idle timeout, unset being the default one.
+func backendServiceConnectionTrackingEqual(a, b *compute.BackendServiceConnectionTrackingPolicy) bool {
+	var aTimeout, bTimeout int64
+	if a != nil {
+		aTimeout = a.IdleTimeoutSec
+	}
+	if b != nil {
+		bTimeout = b.IdleTimeoutSec
+	}
+	return aTimeout == bTimeout
+}
+
+// backendServiceConnectionDrainingEqual returns true if a and b have the same
+// connection draining timeout, unset being no draining.
+func backendServiceConnectionDrainingEqual(a, b *compute.ConnectionDraining) bool {
+	var aTimeout, bTimeout int64
+	if a != nil {
+		aTimeout = a.DrainingTimeoutSec
+	}
+	if b != nil {
+		bTimeout = b.DrainingTimeoutSec
+	}
+	return aTimeout == bTimeout
+}
+
+// backendServiceTimeoutEqual returns true if a and b are the same backend
+// service timeout, unset being the default one.
+func backendServiceTimeoutEqual(a, b int64) bool {
+	if a == 0 {
+		a = defaultBackendServiceTimeoutSec
+	}
+	if b == 0 {
+		b = defaultBackendServiceTimeoutSec
+	}
+	return a == b
+}
+
+// backendServiceLocalityLBPolicyEqual returns true if a and b are the same
+// locality load balancing policy, unset being MAGLEV.
+func backendServiceLocalityLBPolicyEqual(a, b string) bool {
+	if a == "" {
+		a = localityLBPolicyMaglev
+	}
+	if b == "" {
+		b = localityLBPolicyMaglev
+	}
+	return a == b
+}
@@ -0,0 +1,331 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetBackendServiceMetadata(t *testing.T) {
+	for _, tc := range []struct {
+		desc            string
+		annotations     map[string]string
+		shared          bool
+		wantErr         bool
+		wantLogConfig   *compute.BackendServiceLogConfig
+		wantDesc        string
+		wantAffinity    string
+		wantIdleTimeout int64
+		wantDraining    *compute.ConnectionDraining
+		wantTimeout     int64
+		wantPolicy      *string
+	}{
+		{
+			desc: "no annotations",
+		},
+		{
+			desc: "logging and description",
+			annotations: map[string]string{
+				ServiceAnnotationBackendServiceLoggingSampleRate: "0.5",
+				ServiceAnnotationBackendServiceDescription:       "payments frontend",
+			},
+			wantLogConfig: &compute.BackendServiceLogConfig{Enable: true, SampleRate: 0.5},
+			wantDesc:      "payments frontend",
+		},
+		{
+			desc:        "sample rate out of range",
+			annotations: map[string]string{ServiceAnnotationBackendServiceLoggingSampleRate: "2"},
+			wantErr:     true,
+		},
+		{
+			desc:        "description too long",
+			annotations: map[string]string{ServiceAnnotationBackendServiceDescription: strings.Repeat("a", maxBackendServiceCustomDescriptionLength+1)},
+			wantErr:     true,
+		},
+		{
+			desc: "session affinity and timeout",
+			annotations: map[string]string{
+				ServiceAnnotationBackendServiceSessionAffinity:        gceAffinityTypeClientIPProto,
+				ServiceAnnotationBackendServiceSessionAffinityTimeout: "300",
+			},
+			wantAffinity:    gceAffinityTypeClientIPProto,
+			wantIdleTimeout: 300,
+		},
+		{
+			desc:        "unsupported session affinity",
+			annotations: map[string]string{ServiceAnnotationBackendServiceSessionAffinity: "GENERATED_COOKIE"},
+			wantErr:     true,
+		},
+		{
+			desc: "session affinity timeout out of range",
+			annotations: map[string]string{
+				ServiceAnnotationBackendServiceSessionAffinity:        gceAffinityTypeClientIP,
+				ServiceAnnotationBackendServiceSessionAffinityTimeout: "601",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "session affinity timeout without session affinity",
+			annotations: map[string]string{
+				ServiceAnnotationBackendServiceSessionAffinity:        gceAffinityTypeNone,
+				ServiceAnnotationBackendServiceSessionAffinityTimeout: "300",
+			},
+			wantErr: true,
+		},
+		{
+			desc:         "connection draining timeout",
+			annotations:  map[string]string{ServiceAnnotationBackendServiceConnectionDrainingTimeout: "0"},
+			wantDraining: &compute.ConnectionDraining{DrainingTimeoutSec: 0},
+		},
+		{
+			desc:        "connection draining timeout out of range",
+			annotations: map[string]string{ServiceAnnotationBackendServiceConnectionDrainingTimeout: "3601"},
+			wantErr:     true,
+		},
+		{
+			desc:        "timeout",
+			annotations: map[string]string{ServiceAnnotationBackendServiceTimeout: "3600"},
+			wantTimeout: 3600,
+		},
+		{
+			desc:        "timeout out of range",
+			annotations: map[string]string{ServiceAnnotationBackendServiceTimeout: "0"},
+			wantErr:     true,
+		},
+		{
+			desc:        "security policy",
+			annotations: map[string]string{ServiceAnnotationBackendServiceSecurityPolicy: "edge-policy"},
+			wantPolicy:  func() *string { s := "edge-policy"; return &s }(),
+		},
+		{
+			desc:        "security policy detached",
+			annotations: map[string]string{ServiceAnnotationBackendServiceSecurityPolicy: ""},
+			wantPolicy:  func() *string { s := ""; return &s }(),
+		},
+		{
+			desc:        "invalid security policy name",
+			annotations: map[string]string{ServiceAnnotationBackendServiceSecurityPolicy: "Edge_Policy"},
+			wantErr:     true,
+		},
+		{
+			desc:        "annotation not in allow-list",
+			annotations: map[string]string{ServiceAnnotationBackendServicePrefix + "custom-request-headers": "X-Client-Region:{client_region}"},
+			wantErr:     true,
+		},
+		{
+			desc:        "shared backend service",
+			annotations: map[string]string{ServiceAnnotationBackendServiceDescription: "payments frontend"},
+			shared:      true,
+			wantErr:     true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := fakeLoadbalancerService(string(LBTypeInternal))
+			for k, v := range tc.annotations {
+				svc.Annotations[k] = v
+			}
+			md, err := getBackendServiceMetadata(svc, tc.shared)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantLogConfig, md.logConfig)
+			assert.Equal(t, tc.wantDesc, md.description)
+			assert.Equal(t, tc.wantAffinity, md.sessionAffinity)
+			assert.Equal(t, tc.wantDraining, md.connectionDraining)
+			assert.Equal(t, tc.wantTimeout, md.timeoutSec)
+			assert.Equal(t, tc.wantPolicy, md.securityPolicy)
+			if tc.wantIdleTimeout == 0 {
+				assert.Nil(t, md.connectionTracking)
+			} else {
+				assert.Equal(t, tc.wantIdleTimeout, md.connectionTracking.IdleTimeoutSec)
+			}
+		})
+	}
+}
+
+func TestEnsureInternalLoadBalancerBackendServiceMetadata(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationBackendServiceLoggingSampleRate] = "0.25"
+	svc.Annotations[ServiceAnnotationBackendServiceDescription] = "payments frontend"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bsName := makeBackendServiceName(lbName, vals.ClusterID, false, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
+	bs, err := gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, &compute.BackendServiceLogConfig{Enable: true, SampleRate: 0.25}, bs.LogConfig)
+	assert.Equal(t, `{"kubernetes.io/service-name":"`+svc.Namespace+`/`+svc.Name+`","networking.gke.io/description":"payments frontend"}`, bs.Description)
+
+	// Without the annotation, a logging config set out of band is kept.
+	delete(svc.Annotations, ServiceAnnotationBackendServiceLoggingSampleRate)
+	bs.LogConfig = &compute.BackendServiceLogConfig{Enable: true, SampleRate: 1}
+	require.NoError(t, gce.UpdateRegionBackendService(bs, gce.region))
+	existingFwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, &compute.BackendServiceLogConfig{Enable: true, SampleRate: 1}, bs.LogConfig)
+}
+
+func TestEnsureInternalLoadBalancerSecurityPolicy(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationBackendServiceSecurityPolicy] = "edge-policy"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	assert.ErrorContains(t, err, ServiceAnnotationBackendServiceSecurityPolicy)
+}
+
+func TestEnsureInternalLoadBalancerSessionAffinity(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Spec.SessionAffinity = v1.ServiceAffinityClientIP
+	svc.Annotations[ServiceAnnotationBackendServiceSessionAffinityTimeout] = "120"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bsName := makeBackendServiceName(lbName, vals.ClusterID, false, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
+	bs, err := gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, gceAffinityTypeClientIP, bs.SessionAffinity)
+	require.NotNil(t, bs.ConnectionTrackingPolicy)
+	assert.Equal(t, int64(120), bs.ConnectionTrackingPolicy.IdleTimeoutSec)
+
+	// The annotation takes precedence over the spec.
+	svc.Annotations[ServiceAnnotationBackendServiceSessionAffinity] = gceAffinityTypeClientIPPortProto
+	existingFwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, gceAffinityTypeClientIPPortProto, bs.SessionAffinity)
+	assert.Equal(t, int64(120), bs.ConnectionTrackingPolicy.IdleTimeoutSec)
+}
+
+func TestEnsureInternalLoadBalancerConnectionDraining(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationBackendServiceConnectionDrainingTimeout] = "900"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bsName := makeBackendServiceName(lbName, vals.ClusterID, false, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
+	bs, err := gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	require.NotNil(t, bs.ConnectionDraining)
+	assert.Equal(t, int64(900), bs.ConnectionDraining.DrainingTimeoutSec)
+
+	// Without the annotation, the draining timeout of the backend service is kept.
+	delete(svc.Annotations, ServiceAnnotationBackendServiceConnectionDrainingTimeout)
+	existingFwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, int64(900), bs.ConnectionDraining.DrainingTimeoutSec)
+}
+
+func TestEnsureInternalLoadBalancerBackendServiceTimeout(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationBackendServiceTimeout] = "600"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bsName := makeBackendServiceName(lbName, vals.ClusterID, false, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
+	bs, err := gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), bs.TimeoutSec)
+
+	existingFwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	svc.Annotations[ServiceAnnotationBackendServiceTimeout] = "1800"
+	_, err = createInternalLoadBalancer(gce, svc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1800), bs.TimeoutSec)
+
+	// Without the annotation, the timeout of the backend service is kept.
+	delete(svc.Annotations, ServiceAnnotationBackendServiceTimeout)
+	_, err = createInternalLoadBalancer(gce, svc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1800), bs.TimeoutSec)
+}
@@ -0,0 +1,209 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// callBudgetShare is the share of the remaining reconcile budget of a
+	// load balancer a single GCE API call for it may use, so that one slow
+	// call leaves time for the rest of the sync.
+	callBudgetShare = 0.5
+	// minCallBudget is the deadline of the GCE API calls whose share of the
+	// remaining reconcile budget would be shorter, if the budget allows.
+	minCallBudget = 5 * time.Second
+	// minRecreateBudget is the remaining reconcile budget a load balancer
+	// must have to delete a resource that is recreated right after, so that
+	// the sync does not run out of budget in between.
+	minRecreateBudget = 2 * minCallBudget
+)
+
+// callBudgets holds the reconcile deadlines of the load balancers being
+// synced by load balancer name, to bound the GCE API calls on their
+// resources, whose names are derived from it by loadBalancerResourceNames.
+type callBudgets struct {
+	mu        sync.Mutex
+	deadlines map[string]time.Time
+}
+
+// boundCallsFor bounds the GCE API calls on the resources of the load
+// balancer of the Service by the reconcile budget of ctx until the returned
+// function is called. The budget ends at the deadline of ctx or, if ctx has
+// none, after the configured reconcile budget. The calls are not bounded if
+// neither is set.
+func (g *Cloud) boundCallsFor(ctx context.Context, svc *v1.Service) func() {
+	deadline, ok := ctx.Deadline()
+	if !ok && g.reconcileBudget > 0 {
+		deadline, ok = time.Now().Add(g.reconcileBudget), true
+	}
+	b := g.callBudgets
+	if !ok || b == nil {
+		return func() {}
+	}
+	name := g.loadBalancerName(svc)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.deadlines == nil {
+		b.deadlines = map[string]time.Time{}
+	}
+	b.deadlines[name] = deadline
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.deadlines[name].Equal(deadline) {
+			delete(b.deadlines, name)
+		}
+	}
+}
+
+// callDeadline returns the deadline of a GCE API call made at now on the
+// resource URL and the load balancer it belongs to, if it is being synced.
+func (b *callBudgets) callDeadline(resourceURL string, now time.Time) (time.Time, string, bool) {
+	remaining, name, ok := b.remaining(resourceURL, now)
+	if !ok {
+		return time.Time{}, "", false
+	}
+	budget := time.Duration(float64(remaining) * callBudgetShare)
+	if budget < minCallBudget {
+		budget = minCallBudget
+	}
+	if budget > remaining {
+		budget = remaining
+	}
+	return now.Add(budget), name, true
+}
+
+// remaining returns the rest at now of the reconcile budget of the load
+// balancer being synced the resource URL belongs to, and its name.
+func (b *callBudgets) remaining(resourceURL string, now time.Time) (time.Duration, string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.deadlines) == 0 {
+		return 0, "", false
+	}
+	// The name of the resource is the last segment of its URL, or the one
+	// before the custom method, e.g. addInstances.
+	segments := strings.Split(strings.Trim(resourceURL, "/"), "/")
+	for i := len(segments) - 1; i >= 0 && i >= len(segments)-2; i-- {
+		for name, deadline := range b.deadlines {
+			if slices.Contains(loadBalancerResourceNames(name), segments[i]) {
+				return deadline.Sub(now), name, true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// loadBalancerResourceNames returns the names of the resources of the load
+// balancer that are derived from its name: the forwarding rules, target
+// pools, backend services and health checks, their IPv6 and mixed protocol
+// companions, and their firewalls.
+func loadBalancerResourceNames(loadBalancerName string) []string {
+	bases := []string{
+		loadBalancerName,
+		loadBalancerName + ipv6Suffix,
+		mixedProtocolName(loadBalancerName, v1.ProtocolTCP),
+		mixedProtocolName(loadBalancerName, v1.ProtocolUDP),
+	}
+	names := make([]string, 0, 4*len(bases))
+	for _, base := range bases {
+		names = append(names,
+			base,
+			MakeFirewallName(base),
+			makeHealthCheckFirewallName(base, "", false),
+			MakeHealthCheckFirewallName("", base, false),
+		)
+	}
+	return names
+}
+
+// checkRecreateBudget returns an error if the load balancer the resource
+// belongs to is being synced and the rest of its reconcile budget may not
+// allow both deleting the resource and creating it again, to keep the sync
+// from stopping in between, which would leave the load balancer without the
+// resource until the next sync.
+func (g *Cloud) checkRecreateBudget(resourceName string) error {
+	if g.callBudgets == nil {
+		return nil
+	}
+	remaining, lbName, ok := g.callBudgets.remaining(resourceName, time.Now())
+	if !ok || remaining >= minRecreateBudget {
+		return nil
+	}
+	return fmt.Errorf("only %v left of the reconcile budget of load balancer %s, not enough to delete and recreate %s", remaining.Round(time.Second), lbName, resourceName)
+}
+
+// budgetTransport bounds the GCE API requests on the resources of the load
+// balancers being synced by their share of the remaining reconcile budget.
+// The operations polled for audited mutations are bounded as the mutated
+// resource.
+type budgetTransport struct {
+	base    http.RoundTripper
+	budgets *callBudgets
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resourceName := req.URL.Path
+	if a, ok := req.Context().Value(auditContextKey{}).(*mutationAudit); ok {
+		resourceName = a.resourceURL
+	}
+	deadline, lbName, ok := t.budgets.callDeadline(resourceName, time.Now())
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithDeadline(req.Context(), deadline)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && req.Context().Err() == nil {
+			return nil, fmt.Errorf("GCE API request exceeded its share of the reconcile budget of load balancer %s: %w", lbName, err)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose cancels the context of a request when its response body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer.
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,146 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestCallBudgetDeadline(t *testing.T) {
+	now := time.Now()
+	b := &callBudgets{deadlines: map[string]time.Time{"a1234": now.Add(time.Minute)}}
+
+	deadline, lbName, ok := b.callDeadline("/compute/v1/projects/p/regions/r/forwardingRules/a1234", now)
+	require.True(t, ok)
+	assert.Equal(t, "a1234", lbName)
+	assert.Equal(t, now.Add(30*time.Second), deadline)
+
+	b.deadlines["a1234"] = now.Add(6 * time.Second)
+	deadline, _, _ = b.callDeadline("k8s-fw-a1234", now)
+	assert.Equal(t, now.Add(minCallBudget), deadline, "short budgets must allow the minimum call deadline")
+
+	b.deadlines["a1234"] = now.Add(time.Second)
+	deadline, _, _ = b.callDeadline("a1234", now)
+	assert.Equal(t, now.Add(time.Second), deadline, "calls must not outlive the budget")
+
+	_, _, ok = b.callDeadline("/compute/v1/projects/p/global/firewalls/other", now)
+	assert.False(t, ok)
+
+	// The names are matched exactly, not by substring.
+	for _, url := range []string{
+		"/compute/v1/projects/p/regions/r/forwardingRules/a12345",
+		"/compute/v1/projects/p/regions/r/forwardingRules/xa1234",
+		"/compute/v1/projects/p/global/firewalls/k8s-fw-a1234-other",
+	} {
+		_, _, ok = b.callDeadline(url, now)
+		assert.False(t, ok, url)
+	}
+	for _, url := range []string{
+		"/compute/v1/projects/p/regions/r/targetPools/a1234/addInstance",
+		"/compute/v1/projects/p/regions/r/forwardingRules/a1234-ipv6",
+		"/compute/v1/projects/p/regions/r/forwardingRules/a1234-udp",
+		"/compute/v1/projects/p/global/firewalls/k8s-a1234-http-hc",
+		"/compute/v1/projects/p/global/firewalls/a1234-hc",
+	} {
+		_, _, ok = b.callDeadline(url, now)
+		assert.True(t, ok, url)
+	}
+}
+
+func TestCheckRecreateBudget(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	gce.callBudgets = &callBudgets{deadlines: map[string]time.Time{"a1234": time.Now().Add(time.Minute)}}
+
+	assert.NoError(t, gce.checkRecreateBudget("a1234"))
+	assert.NoError(t, gce.checkRecreateBudget("other"), "load balancers not being synced are not bounded")
+
+	gce.callBudgets.deadlines["a1234"] = time.Now().Add(minRecreateBudget - time.Second)
+	assert.Error(t, gce.checkRecreateBudget("a1234"))
+	assert.Error(t, gce.checkRecreateBudget("a1234-ipv6"))
+}
+
+func TestBoundCallsFor(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	gce.callBudgets = &callBudgets{}
+	// The budgets are kept by the name of the load balancer, prefix included.
+	gce.lbNamePrefix = "prod-"
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default", UID: "uid-1"}}
+	name := "prod-" + cloudprovider.DefaultLoadBalancerName(svc)
+
+	// Without a context deadline nor reconcile budget, calls are unbounded.
+	done := gce.boundCallsFor(context.Background(), svc)
+	assert.Empty(t, gce.callBudgets.deadlines)
+	done()
+
+	gce.reconcileBudget = time.Minute
+	done = gce.boundCallsFor(context.Background(), svc)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), gce.callBudgets.deadlines[name], time.Second)
+	done()
+	assert.Empty(t, gce.callBudgets.deadlines)
+
+	deadline := time.Now().Add(10 * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	done = gce.boundCallsFor(ctx, svc)
+	assert.Equal(t, deadline, gce.callBudgets.deadlines[name], "the context deadline must take precedence")
+	done()
+	assert.Empty(t, gce.callBudgets.deadlines)
+}
+
+func TestBudgetTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	budgets := &callBudgets{deadlines: map[string]time.Time{"a1234": time.Now().Add(100 * time.Millisecond)}}
+	client := &http.Client{Transport: &budgetTransport{base: http.DefaultTransport, budgets: budgets}}
+
+	start := time.Now()
+	_, err := client.Get(server.URL + "/compute/v1/projects/p/global/firewalls/k8s-fw-a1234")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reconcile budget of load balancer a1234")
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// The requests on other resources are not bounded.
+	budgets.deadlines["a1234"] = time.Now().Add(-time.Second)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer fast.Close()
+	resp, err := client.Get(fast.URL + "/compute/v1/projects/p/global/firewalls/other")
+	require.NoError(t, err)
+	resp.Body.Close()
+}
@@ -46,8 +46,12 @@ func (g *Cloud) CreateSslCertificate(sslCerts *compute.SslCertificate) (*compute
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "SSL certificate", meta.GlobalKey(sslCerts.Name), sslCerts) {
+		return sslCerts, nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "SSL certificate", meta.GlobalKey(sslCerts.Name), sslCerts)
 	mc := newCertMetricContext("create")
-	err := g.c.SslCertificates().Insert(ctx, meta.GlobalKey(sslCerts.Name), sslCerts)
+	err := audit(g.c.SslCertificates().Insert(ctx, meta.GlobalKey(sslCerts.Name), sslCerts))
 	if err != nil {
 		return nil, mc.Observe(err)
 	}
@@ -59,8 +63,12 @@ func (g *Cloud) DeleteSslCertificate(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "SSL certificate", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "SSL certificate", meta.GlobalKey(name), nil)
 	mc := newCertMetricContext("delete")
-	return mc.Observe(g.c.SslCertificates().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.SslCertificates().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // ListSslCertificates lists all SslCertificates in the project.
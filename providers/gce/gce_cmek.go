@@ -0,0 +1,53 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"regexp"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+var kmsKeyNameRegexp = regexp.MustCompile(`^projects/[^/]+/locations/([^/]+)/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// validateKMSKeyName checks that key is a Cloud KMS crypto key name usable to
+// encrypt resources in region. Whether the key exists and the Compute Engine
+// service agent may use it is checked by GCE when the resource is created, the
+// error is surfaced as the error of the disk creation.
+func validateKMSKeyName(key, region string) error {
+	match := kmsKeyNameRegexp.FindStringSubmatch(key)
+	if match == nil {
+		return fmt.Errorf("%q is not of the form projects/PROJECT/locations/LOCATION/keyRings/RING/cryptoKeys/KEY", key)
+	}
+	if location := match[1]; location != "global" && location != region {
+		return fmt.Errorf("key location %q must be %q or global", location, region)
+	}
+	return nil
+}
+
+// diskEncryptionKey returns the encryption key of the disks created by the
+// cloud provider, or nil if they are encrypted with Google-managed keys.
+func (g *Cloud) diskEncryptionKey() *compute.CustomerEncryptionKey {
+	if g.diskEncryptionKMSKey == "" {
+		return nil
+	}
+	return &compute.CustomerEncryptionKey{KmsKeyName: g.diskEncryptionKMSKey}
+}
@@ -0,0 +1,78 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestValidateKMSKeyName(t *testing.T) {
+	for _, tc := range []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "projects/p/locations/us-central1/keyRings/r/cryptoKeys/k"},
+		{key: "projects/p/locations/global/keyRings/r/cryptoKeys/k"},
+		{key: "projects/p/locations/europe-west1/keyRings/r/cryptoKeys/k", wantErr: true},
+		{key: "projects/p/locations/us-central1/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", wantErr: true},
+		{key: "my-key", wantErr: true},
+	} {
+		err := validateKMSKeyName(tc.key, "us-central1")
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("validateKMSKeyName(%q) = %v, want error: %t", tc.key, err, tc.wantErr)
+		}
+	}
+}
+
+func TestCreateDiskWithEncryptionKey(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	key := "projects/kms-project/locations/" + vals.Region + "/keyRings/ring/cryptoKeys/key"
+	gce.diskEncryptionKMSKey = key
+	manager := &gceServiceManager{gce}
+
+	_, err = manager.CreateDiskOnCloudProvider("zonal-disk", 10, "", DiskTypeStandard, vals.ZoneName)
+	require.NoError(t, err)
+	disk, err := gce.c.Disks().Get(context.TODO(), meta.ZonalKey("zonal-disk", vals.ZoneName))
+	require.NoError(t, err)
+	require.NotNil(t, disk.DiskEncryptionKey)
+	assert.Equal(t, key, disk.DiskEncryptionKey.KmsKeyName)
+
+	_, err = manager.CreateRegionalDiskOnCloudProvider("regional-disk", 10, "", DiskTypeStandard, sets.NewString(vals.ZoneName, vals.SecondaryZoneName))
+	require.NoError(t, err)
+	regionalDisk, err := gce.c.RegionDisks().Get(context.TODO(), meta.RegionalKey("regional-disk", vals.Region))
+	require.NoError(t, err)
+	require.NotNil(t, regionalDisk.DiskEncryptionKey)
+	assert.Equal(t, key, regionalDisk.DiskEncryptionKey.KmsKeyName)
+
+	gce.diskEncryptionKMSKey = ""
+	_, err = manager.CreateDiskOnCloudProvider("unencrypted-disk", 10, "", DiskTypeStandard, vals.ZoneName)
+	require.NoError(t, err)
+	disk, err = gce.c.Disks().Get(context.TODO(), meta.ZonalKey("unencrypted-disk", vals.ZoneName))
+	require.NoError(t, err)
+	assert.Nil(t, disk.DiskEncryptionKey)
+}
@@ -0,0 +1,144 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"k8s.io/klog/v2"
+)
+
+// reloadableTokenSource is an oauth2.TokenSource whose underlying source can
+// be replaced when the config is reloaded. Tokens already cached by the
+// compute clients are used until they expire.
+type reloadableTokenSource struct {
+	mu     sync.RWMutex
+	source oauth2.TokenSource
+}
+
+// Token implements oauth2.TokenSource.
+func (r *reloadableTokenSource) Token() (*oauth2.Token, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.source.Token()
+}
+
+func (r *reloadableTokenSource) set(source oauth2.TokenSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.source = source
+}
+
+// reloadableConfig returns a copy of the config with the fields that can be
+// changed by ReloadConfig cleared.
+func reloadableConfig(global ConfigGlobal) ConfigGlobal {
+	global.TokenURL = ""
+	global.TokenBody = ""
+	global.NodeTags = nil
+	global.NodeInstancePrefix = ""
+	global.RateLimitConfigFile = ""
+	return global
+}
+
+// ReloadConfig applies a modified cloud config without restarting. Only the
+// token-url, token-body, node-tags, node-instance-prefix and
+// rate-limit-config-file fields and the ratelimit sections can be changed;
+// any other change, or an invalid config, is rejected and the current config
+// is kept. The rate limiters are only replaced if the rate limits changed, so
+// that a reload does not refill their buckets.
+func (g *Cloud) ReloadConfig(config io.Reader) error {
+	g.reloadLock.Lock()
+	defer g.reloadLock.Unlock()
+
+	if g.configFile == nil {
+		return fmt.Errorf("cloud was not created from a config file")
+	}
+	configFile, err := readConfig(config)
+	if err != nil {
+		return err
+	}
+	current := g.configFile.Global
+	if !reflect.DeepEqual(reloadableConfig(current), reloadableConfig(configFile.Global)) {
+		return fmt.Errorf("only token-url, token-body, node-tags, node-instance-prefix, rate-limit-config-file and the rate limits can be changed without restarting")
+	}
+	cloudConfig, err := generateCloudConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	tokenChanged := current.TokenURL != configFile.Global.TokenURL || current.TokenBody != configFile.Global.TokenBody
+	if tokenChanged {
+		if g.tokenSource == nil || cloudConfig.TokenSource == nil {
+			return fmt.Errorf("switching to or from Application Default Credentials requires a restart")
+		}
+		// Make sure the new token source works before switching to it.
+		if _, err := cloudConfig.TokenSource.Token(); err != nil {
+			return fmt.Errorf("failed to get a token with the new token-url: %v", err)
+		}
+	}
+
+	if tokenChanged {
+		g.tokenSource.set(cloudConfig.TokenSource)
+	}
+	g.configLock.Lock()
+	g.nodeTags = cloudConfig.NodeTags
+	g.nodeInstancePrefix = cloudConfig.NodeInstancePrefix
+	if !reflect.DeepEqual(g.apiRateLimiters.rateLimits(), cloudConfig.RateLimits) {
+		g.apiRateLimiters = newAPIRateLimiters(cloudConfig.RateLimits)
+	}
+	g.configFile = configFile
+	g.configLock.Unlock()
+	klog.Infof("Reloaded GCE provider config %+v", configFile)
+	return nil
+}
+
+// getConfigFile returns the config the cloud was created or last reloaded
+// from, nil if it was not created from a config file.
+func (g *Cloud) getConfigFile() *ConfigFile {
+	g.configLock.RLock()
+	defer g.configLock.RUnlock()
+	return g.configFile
+}
+
+// getAPIRateLimiters returns the rate limiters of the GCE API calls from the
+// cloud config, nil if there are no rate limits.
+func (g *Cloud) getAPIRateLimiters() *apiRateLimiters {
+	g.configLock.RLock()
+	defer g.configLock.RUnlock()
+	return g.apiRateLimiters
+}
+
+// getNodeTags returns the node tags from the cloud config.
+func (g *Cloud) getNodeTags() []string {
+	g.configLock.RLock()
+	defer g.configLock.RUnlock()
+	return g.nodeTags
+}
+
+// getNodeInstancePrefix returns the node instance prefix from the cloud config.
+func (g *Cloud) getNodeInstancePrefix() string {
+	g.configLock.RLock()
+	defer g.configLock.RUnlock()
+	return g.nodeInstancePrefix
+}
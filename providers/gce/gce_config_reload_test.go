@@ -0,0 +1,191 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReloadConfig(t *testing.T) {
+	const initialConfig = `[Global]
+token-url = my-token-url
+project-id = my-project
+network-name = my-network
+local-zone = us-central1-b
+node-tags = my-node-tag1
+node-instance-prefix = my-prefix
+`
+	testCases := []struct {
+		desc           string
+		config         string
+		wantErr        bool
+		wantNodeTags   []string
+		wantNodePrefix string
+	}{
+		{
+			desc: "node tags and prefix",
+			config: `[Global]
+token-url = my-token-url
+project-id = my-project
+network-name = my-network
+local-zone = us-central1-b
+node-tags = my-node-tag2
+node-tags = my-node-tag3
+node-instance-prefix = my-new-prefix
+`,
+			wantNodeTags:   []string{"my-node-tag2", "my-node-tag3"},
+			wantNodePrefix: "my-new-prefix",
+		},
+		{
+			desc: "project change requires restart",
+			config: `[Global]
+token-url = my-token-url
+project-id = my-other-project
+network-name = my-network
+local-zone = us-central1-b
+node-tags = my-node-tag2
+`,
+			wantErr:        true,
+			wantNodeTags:   []string{"my-node-tag1"},
+			wantNodePrefix: "my-prefix",
+		},
+		{
+			desc: "token source is not reloadable",
+			config: `[Global]
+token-url = my-other-token-url
+project-id = my-project
+network-name = my-network
+local-zone = us-central1-b
+node-tags = my-node-tag2
+`,
+			wantErr:        true,
+			wantNodeTags:   []string{"my-node-tag1"},
+			wantNodePrefix: "my-prefix",
+		},
+		{
+			desc:           "malformed config",
+			config:         "[Global\nnode-tags = my-node-tag2\n",
+			wantErr:        true,
+			wantNodeTags:   []string{"my-node-tag1"},
+			wantNodePrefix: "my-prefix",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			gce, err := fakeGCECloud(DefaultTestClusterValues())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			gce.configFile, err = readConfig(strings.NewReader(initialConfig))
+			if err != nil {
+				t.Fatalf("Unexpected config parsing error %v", err)
+			}
+			gce.nodeTags = gce.configFile.Global.NodeTags
+			gce.nodeInstancePrefix = gce.configFile.Global.NodeInstancePrefix
+
+			err = gce.ReloadConfig(strings.NewReader(tc.config))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ReloadConfig() got error %v, want error %t", err, tc.wantErr)
+			}
+			if got := gce.getNodeTags(); !reflect.DeepEqual(got, tc.wantNodeTags) {
+				t.Errorf("Got node tags %v, want %v", got, tc.wantNodeTags)
+			}
+			if got := gce.getNodeInstancePrefix(); got != tc.wantNodePrefix {
+				t.Errorf("Got node instance prefix %q, want %q", got, tc.wantNodePrefix)
+			}
+		})
+	}
+}
+
+func TestReloadConfigRateLimits(t *testing.T) {
+	const global = `[Global]
+token-url = my-token-url
+project-id = my-project
+network-name = my-network
+local-zone = us-central1-b
+`
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gce.configFile, err = readConfig(strings.NewReader(global + `[ratelimit "ForwardingRules"]
+read-qps = 5
+mutate-qps = 1
+`))
+	if err != nil {
+		t.Fatalf("Unexpected config parsing error %v", err)
+	}
+	cloudConfig, err := generateCloudConfig(gce.configFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gce.apiRateLimiters = newAPIRateLimiters(cloudConfig.RateLimits)
+
+	// A changed rate limit replaces the rate limiters.
+	if err := gce.ReloadConfig(strings.NewReader(global + `[ratelimit "ForwardingRules"]
+read-qps = 10
+mutate-qps = 2
+`)); err != nil {
+		t.Fatalf("ReloadConfig() = %v", err)
+	}
+	limiters := gce.getAPIRateLimiters()
+	if limiters == nil {
+		t.Fatalf("Got no rate limiters after reload")
+	}
+	forwardingRules := limiters.limiters["forwardingrules"]
+	if got := forwardingRules[0].QPS(); got != 10 {
+		t.Errorf("Got read QPS %v, want 10", got)
+	}
+	if got := forwardingRules[1].QPS(); got != 2 {
+		t.Errorf("Got mutate QPS %v, want 2", got)
+	}
+
+	// Unchanged rate limits keep the rate limiters.
+	if err := gce.ReloadConfig(strings.NewReader(global + `node-tags = my-node-tag
+[ratelimit "ForwardingRules"]
+read-qps = 10
+mutate-qps = 2
+`)); err != nil {
+		t.Fatalf("ReloadConfig() = %v", err)
+	}
+	if got := gce.getAPIRateLimiters(); got != limiters {
+		t.Errorf("Rate limiters were replaced although the rate limits did not change")
+	}
+
+	// Removing the rate limits removes the rate limiters.
+	if err := gce.ReloadConfig(strings.NewReader(global)); err != nil {
+		t.Fatalf("ReloadConfig() = %v", err)
+	}
+	if got := gce.getAPIRateLimiters(); got != nil {
+		t.Errorf("Got rate limiters %+v, want none", got)
+	}
+
+	// An invalid rate limit is rejected and the current ones are kept.
+	if err := gce.ReloadConfig(strings.NewReader(global + `[ratelimit "ForwardingRules"]
+read-qps = -1
+`)); err == nil {
+		t.Errorf("ReloadConfig() of a negative QPS succeeded, want error")
+	}
+	if got := gce.getAPIRateLimiters(); got != nil {
+		t.Errorf("Got rate limiters %+v, want none", got)
+	}
+}
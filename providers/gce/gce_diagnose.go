@@ -0,0 +1,221 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/option"
+)
+
+// maxTestedPermissions is the maximum number of permissions tested by a
+// single testIamPermissions call.
+const maxTestedPermissions = 100
+
+// permissionTester returns the permissions, among the given ones, that the
+// identity of the cloud provider has on the project.
+type permissionTester func(ctx context.Context, project string, permissions []string) ([]string, error)
+
+// newPermissionTester returns a permissionTester calling the Cloud Resource
+// Manager API with the client.
+func newPermissionTester(client *http.Client, userAgent string) permissionTester {
+	return func(ctx context.Context, project string, permissions []string) ([]string, error) {
+		s, err := cloudresourcemanager.NewService(ctx, option.WithHTTPClient(client))
+		if err != nil {
+			return nil, err
+		}
+		s.UserAgent = userAgent
+		var granted []string
+		for len(permissions) > 0 {
+			batch := permissions
+			if len(batch) > maxTestedPermissions {
+				batch = batch[:maxTestedPermissions]
+			}
+			permissions = permissions[len(batch):]
+			resp, err := s.Projects.TestIamPermissions(project, &cloudresourcemanager.TestIamPermissionsRequest{Permissions: batch}).Context(ctx).Do()
+			if err != nil {
+				return nil, err
+			}
+			granted = append(granted, resp.Permissions...)
+		}
+		return granted, nil
+	}
+}
+
+// MissingPermissions returns the permissions, among the given ones, that the
+// identity of the cloud provider lacks on the project.
+func (g *Cloud) MissingPermissions(ctx context.Context, project string, permissions []string) ([]string, error) {
+	if g.testPermissions == nil {
+		return nil, fmt.Errorf("testing IAM permissions is not supported")
+	}
+	granted, err := g.testPermissions(ctx, project, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to test the IAM permissions on project %q: %w", project, err)
+	}
+	has := map[string]bool{}
+	for _, p := range granted {
+		has[p] = true
+	}
+	var missing []string
+	for _, p := range permissions {
+		if !has[p] {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+// ConfigDiagnostic is the outcome of checking a field of the cloud config
+// against the live project and network.
+type ConfigDiagnostic struct {
+	// Field is the cloud config field checked, e.g. network-name.
+	Field string
+	// Err is the problem found, nil if the field is valid.
+	Err error
+	// Remediation tells how to fix the problem.
+	Remediation string
+}
+
+// ValidateConfig parses the cloud config and checks the values of its
+// fields, without checking them against GCE.
+func ValidateConfig(config io.Reader) error {
+	configFile, err := readConfig(config)
+	if err != nil {
+		return err
+	}
+	_, err = generateCloudConfig(configFile)
+	return err
+}
+
+// DiagnoseConfig checks the credentials, project, network, subnetwork,
+// secondary range, zone and node tags of the cloud config against their live
+// state in GCE.
+func (g *Cloud) DiagnoseConfig(ctx context.Context) []ConfigDiagnostic {
+	var diags []ConfigDiagnostic
+	check := func(field string, err error, remediation string) {
+		d := ConfigDiagnostic{Field: field}
+		if err != nil {
+			d.Err = err
+			d.Remediation = remediation
+		}
+		diags = append(diags, d)
+	}
+
+	// Application Default Credentials are only exercised by the API calls.
+	if g.tokenSource != nil {
+		_, err := g.tokenSource.Token()
+		check("credentials", err, "Check token-url and token-body, or the workload-identity fields, or that the metadata server provides the credentials of a service account.")
+	}
+
+	_, err := g.c.Projects().Get(ctx, g.projectID)
+	check("project-id", err, fmt.Sprintf("Set project-id to an existing project which the identity of the cloud controller manager can read, instead of %q.", g.projectID))
+
+	if g.networkURL == "" {
+		check("network-name", fmt.Errorf("no network configured"), "Set network-name to the network of the nodes.")
+	} else {
+		_, err := g.getResourceByURL(ctx, g.networkURL, func(key *meta.Key) error {
+			_, err := g.c.Networks().Get(ctx, key)
+			return err
+		})
+		check("network-name", err, fmt.Sprintf("Set network-name to an existing network of project %q, or network-project-id to the project of the network.", g.networkProjectID))
+	}
+
+	subnetURL := g.SubnetworkURL()
+	if subnetURL == "" {
+		// Legacy and custom networks without a configured subnetwork.
+		if g.secondaryRangeName != "" {
+			check("subnetwork-name", fmt.Errorf("no subnetwork configured for secondary range %q", g.secondaryRangeName), "Set subnetwork-name to the subnetwork of the nodes.")
+		}
+	} else {
+		var ranges []string
+		key, err := g.getResourceByURL(ctx, subnetURL, func(key *meta.Key) error {
+			subnet, err := g.c.Subnetworks().Get(ctx, key)
+			if err == nil {
+				for _, r := range subnet.SecondaryIpRanges {
+					ranges = append(ranges, r.RangeName)
+				}
+			}
+			return err
+		})
+		if err == nil && key.Region != g.region {
+			err = fmt.Errorf("subnetwork %q is in region %q, not in region %q", key.Name, key.Region, g.region)
+		}
+		check("subnetwork-name", err, fmt.Sprintf("Set subnetwork-name to an existing subnetwork of the network in region %q.", g.region))
+		if err == nil && g.secondaryRangeName != "" {
+			var rangeErr error
+			if !slices.Contains(ranges, g.secondaryRangeName) {
+				rangeErr = fmt.Errorf("subnetwork %q has no secondary range %q, only %v", key.Name, g.secondaryRangeName, ranges)
+			}
+			check("secondary-range-name", rangeErr, fmt.Sprintf("Add the secondary range %q to subnetwork %q, or set secondary-range-name to one of its ranges.", g.secondaryRangeName, key.Name))
+		}
+	}
+
+	if len(g.getManagedZones()) == 0 {
+		check("local-zone", fmt.Errorf("region %q has no zones", g.region), "Set local-zone to a zone of the region of the cluster.")
+	}
+	if g.localZone != "" {
+		z, err := g.c.Zones().Get(ctx, meta.GlobalKey(g.localZone))
+		if err == nil && lastComponent(z.Region) != g.region {
+			err = fmt.Errorf("zone %q is in region %q, not in region %q", g.localZone, lastComponent(z.Region), g.region)
+		}
+		check("local-zone", err, fmt.Sprintf("Set local-zone to an existing zone of region %q.", g.region))
+	}
+
+	if tags := g.getNodeTags(); len(tags) > 0 {
+		check("node-tags", g.checkNodeTags(ctx, tags), fmt.Sprintf("Set node-tags to network tags of the nodes, or add %v to the instance template of the nodes.", tags))
+	}
+	return diags
+}
+
+// checkNodeTags returns an error unless an instance of the managed zones has
+// all the tags.
+func (g *Cloud) checkNodeTags(ctx context.Context, tags []string) error {
+	zones := g.getManagedZones()
+	instances, err := g.listZoneInstances(ctx, zones, filter.None, instanceTagsFields)
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		for _, inst := range instances[zone] {
+			if inst.Tags != nil && !slices.ContainsFunc(tags, func(tag string) bool { return !slices.Contains(inst.Tags.Items, tag) }) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no instance of zones %v has tags %v", zones, tags)
+}
+
+// getResourceByURL gets the resource of the URL with get, and returns its
+// key.
+func (g *Cloud) getResourceByURL(ctx context.Context, url string, get func(*meta.Key) error) (*meta.Key, error) {
+	id, err := cloud.ParseResourceURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return id.Key, get(id.Key)
+}
@@ -0,0 +1,234 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestMissingPermissions(t *testing.T) {
+	gce := NewFakeGCECloud(DefaultTestClusterValues())
+	ctx := context.Background()
+
+	_, err := gce.MissingPermissions(ctx, "test-project", []string{"compute.routes.list"})
+	assert.Error(t, err, "testing permissions is not supported by the fake cloud")
+
+	var testedProject string
+	gce.testPermissions = func(ctx context.Context, project string, permissions []string) ([]string, error) {
+		testedProject = project
+		return []string{"compute.routes.list"}, nil
+	}
+	missing, err := gce.MissingPermissions(ctx, "network-project", []string{"compute.routes.create", "compute.routes.list", "compute.routes.delete"})
+	require.NoError(t, err)
+	assert.Equal(t, "network-project", testedProject)
+	assert.Equal(t, []string{"compute.routes.create", "compute.routes.delete"}, missing)
+
+	gce.testPermissions = func(ctx context.Context, project string, permissions []string) ([]string, error) {
+		return nil, errors.New("permission denied")
+	}
+	_, err = gce.MissingPermissions(ctx, "test-project", []string{"compute.routes.list"})
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestDiagnoseConfig(t *testing.T) {
+	const (
+		networkURL = "https://www.googleapis.com/compute/v1/projects/test-project/global/networks/default"
+		subnetURL  = "https://www.googleapis.com/compute/v1/projects/test-project/regions/us-central1/subnetworks/default"
+	)
+	for _, tc := range []struct {
+		desc               string
+		networkURL         string
+		subnetURL          string
+		secondaryRangeName string
+		localZone          string
+		nodeTags           []string
+		tokenErr           error
+		// failed are the fields failing the checks.
+		failed []string
+	}{
+		{
+			desc:               "valid config",
+			networkURL:         networkURL,
+			subnetURL:          subnetURL,
+			secondaryRangeName: "pods",
+			nodeTags:           []string{"node-tag"},
+		},
+		{
+			desc:       "credentials failing",
+			networkURL: networkURL,
+			tokenErr:   errors.New("token-url unreachable"),
+			failed:     []string{"credentials"},
+		},
+		{
+			desc:       "node tags on no instance",
+			networkURL: networkURL,
+			nodeTags:   []string{"node-tag", "other-tag"},
+			failed:     []string{"node-tags"},
+		},
+		{
+			desc:   "no network",
+			failed: []string{"network-name"},
+		},
+		{
+			desc:       "missing network",
+			networkURL: "https://www.googleapis.com/compute/v1/projects/test-project/global/networks/missing",
+			failed:     []string{"network-name"},
+		},
+		{
+			desc:       "missing subnetwork",
+			networkURL: networkURL,
+			subnetURL:  "https://www.googleapis.com/compute/v1/projects/test-project/regions/us-central1/subnetworks/missing",
+			failed:     []string{"subnetwork-name"},
+		},
+		{
+			desc:       "subnetwork in another region",
+			networkURL: networkURL,
+			subnetURL:  "https://www.googleapis.com/compute/v1/projects/test-project/regions/europe-west1/subnetworks/default",
+			failed:     []string{"subnetwork-name"},
+		},
+		{
+			desc:               "missing secondary range",
+			networkURL:         networkURL,
+			subnetURL:          subnetURL,
+			secondaryRangeName: "services",
+			failed:             []string{"secondary-range-name"},
+		},
+		{
+			desc:       "local zone in another region",
+			networkURL: networkURL,
+			subnetURL:  subnetURL,
+			localZone:  "europe-west1-b",
+			failed:     []string{"local-zone"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			vals := DefaultTestClusterValues()
+			vals.NetworkURL = tc.networkURL
+			vals.SubnetworkURL = tc.subnetURL
+			gce := NewFakeGCECloud(vals)
+			gce.secondaryRangeName = tc.secondaryRangeName
+			if tc.localZone != "" {
+				gce.localZone = tc.localZone
+			}
+			gce.nodeTags = tc.nodeTags
+			gce.tokenSource = &reloadableTokenSource{source: fakeTokenSource{err: tc.tokenErr}}
+			mockGCE := gce.c.(*cloud.MockGCE)
+			mockGCE.MockProjects.Objects[*meta.GlobalKey(vals.ProjectID)] = &cloud.MockProjectsObj{Obj: &compute.Project{Name: vals.ProjectID}}
+			mockGCE.MockNetworks.Objects[*meta.GlobalKey("default")] = &cloud.MockNetworksObj{Obj: &compute.Network{Name: "default"}}
+			for _, region := range []string{vals.Region, "europe-west1"} {
+				mockGCE.MockSubnetworks.Objects[*meta.RegionalKey("default", region)] = &cloud.MockSubnetworksObj{Obj: &compute.Subnetwork{
+					Name:              "default",
+					SecondaryIpRanges: []*compute.SubnetworkSecondaryRange{{RangeName: "pods"}},
+				}}
+			}
+			for zone, region := range map[string]string{vals.ZoneName: vals.Region, "europe-west1-b": "europe-west1"} {
+				mockGCE.MockZones.Objects[*meta.GlobalKey(zone)] = &cloud.MockZonesObj{Obj: &compute.Zone{
+					Name:   zone,
+					Region: "https://www.googleapis.com/compute/v1/projects/" + vals.ProjectID + "/regions/" + region,
+				}}
+			}
+
+			mockGCE.MockInstances.Objects[*meta.ZonalKey("node-1", vals.ZoneName)] = &cloud.MockInstancesObj{Obj: &compute.Instance{
+				Name: "node-1",
+				Tags: &compute.Tags{Items: []string{"node-tag"}},
+			}}
+
+			var failed []string
+			for _, d := range gce.DiagnoseConfig(context.Background()) {
+				if d.Err != nil {
+					assert.NotEmpty(t, d.Remediation, "remediation of %s", d.Field)
+					failed = append(failed, d.Field)
+				}
+			}
+			assert.Equal(t, tc.failed, failed)
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	onGCE := metadataOnGCE
+	defer func() { metadataOnGCE = onGCE }()
+	metadataOnGCE = func() bool { return false }
+
+	for _, tc := range []struct {
+		desc    string
+		config  string
+		wantErr bool
+	}{
+		{
+			desc: "valid config",
+			config: `[global]
+project-id = my-project
+network-name = my-network
+local-zone = us-central1-a
+`,
+		},
+		{
+			desc:    "syntax error",
+			config:  "[global\nproject-id = my-project\n",
+			wantErr: true,
+		},
+		{
+			desc: "invalid value",
+			config: `[global]
+project-id = my-project
+network-name = my-network
+local-zone = us-central1-a
+reconcile-budget = forever
+`,
+			wantErr: true,
+		},
+		{
+			desc: "missing location off GCE",
+			config: `[global]
+project-id = my-project
+`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := ValidateConfig(strings.NewReader(tc.config))
+			if tc.wantErr != (err != nil) {
+				t.Errorf("ValidateConfig() = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+type fakeTokenSource struct {
+	err error
+}
+
+func (ts fakeTokenSource) Token() (*oauth2.Token, error) {
+	if ts.err != nil {
+		return nil, ts.err
+	}
+	return &oauth2.Token{AccessToken: "token"}, nil
+}
@@ -131,10 +131,11 @@ func (manager *gceServiceManager) CreateDiskOnCloudProvider(
 	}
 
 	diskToCreateV1 := &compute.Disk{
-		Name:        name,
-		SizeGb:      sizeGb,
-		Description: tagsStr,
-		Type:        diskTypeURI,
+		Name:              name,
+		SizeGb:            sizeGb,
+		Description:       tagsStr,
+		Type:              diskTypeURI,
+		DiskEncryptionKey: manager.gce.diskEncryptionKey(),
 	}
 
 	ctx, cancel := cloud.ContextWithCallTimeout()
@@ -146,6 +147,9 @@ func (manager *gceServiceManager) CreateDiskOnCloudProvider(
 		Type:     diskTypeURI,
 		SizeGb:   sizeGb,
 	}
+	if manager.gce.skipMutation("insert", "disk", meta.ZonalKey(name, zone), diskToCreateV1) {
+		return disk, nil
+	}
 	return disk, manager.gce.c.Disks().Insert(ctx, meta.ZonalKey(name, zone), diskToCreateV1)
 }
 
@@ -168,11 +172,12 @@ func (manager *gceServiceManager) CreateRegionalDiskOnCloudProvider(
 	}
 
 	diskToCreate := &compute.Disk{
-		Name:         name,
-		SizeGb:       sizeGb,
-		Description:  tagsStr,
-		Type:         diskTypeURI,
-		ReplicaZones: fullyQualifiedReplicaZones,
+		Name:              name,
+		SizeGb:            sizeGb,
+		Description:       tagsStr,
+		Type:              diskTypeURI,
+		ReplicaZones:      fullyQualifiedReplicaZones,
+		DiskEncryptionKey: manager.gce.diskEncryptionKey(),
 	}
 
 	ctx, cancel := cloud.ContextWithCallTimeout()
@@ -185,6 +190,9 @@ func (manager *gceServiceManager) CreateRegionalDiskOnCloudProvider(
 		Type:     diskTypeURI,
 		SizeGb:   sizeGb,
 	}
+	if manager.gce.skipMutation("insert", "regional disk", meta.RegionalKey(name, manager.gce.region), diskToCreate) {
+		return disk, nil
+	}
 	return disk, manager.gce.c.RegionDisks().Insert(ctx, meta.RegionalKey(name, manager.gce.region), diskToCreate)
 }
 
@@ -208,6 +216,9 @@ func (manager *gceServiceManager) AttachDiskOnCloudProvider(
 
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
+	if manager.gce.skipMutation("attach disk to", "instance", meta.ZonalKey(instanceName, instanceZone), attachedDiskV1) {
+		return nil
+	}
 	return manager.gce.c.Instances().AttachDisk(ctx, meta.ZonalKey(instanceName, instanceZone), attachedDiskV1)
 }
 
@@ -217,6 +228,9 @@ func (manager *gceServiceManager) DetachDiskOnCloudProvider(
 	devicePath string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
+	if manager.gce.skipMutation("detach disk from", "instance", meta.ZonalKey(instanceName, instanceZone), devicePath) {
+		return nil
+	}
 	return manager.gce.c.Instances().DetachDisk(ctx, meta.ZonalKey(instanceName, instanceZone), devicePath)
 }
 
@@ -288,6 +302,9 @@ func (manager *gceServiceManager) DeleteDiskOnCloudProvider(
 	diskName string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
+	if manager.gce.skipMutation("delete", "disk", meta.ZonalKey(diskName, zone), nil) {
+		return nil
+	}
 	return manager.gce.c.Disks().Delete(ctx, meta.ZonalKey(diskName, zone))
 }
 
@@ -296,6 +313,9 @@ func (manager *gceServiceManager) DeleteRegionalDiskOnCloudProvider(
 
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
+	if manager.gce.skipMutation("delete", "regional disk", meta.RegionalKey(diskName, manager.gce.region), nil) {
+		return nil
+	}
 	return manager.gce.c.RegionDisks().Delete(ctx, meta.RegionalKey(diskName, manager.gce.region))
 }
 
@@ -413,6 +433,9 @@ func (manager *gceServiceManager) ResizeDiskOnCloudProvider(disk *Disk, sizeGb i
 
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
+	if manager.gce.skipMutation("resize", "disk", meta.ZonalKey(disk.Name, zone), resizeServiceRequest) {
+		return nil
+	}
 	return manager.gce.c.Disks().Resize(ctx, meta.ZonalKey(disk.Name, zone), resizeServiceRequest)
 }
 
@@ -424,6 +447,9 @@ func (manager *gceServiceManager) RegionalResizeDiskOnCloudProvider(disk *Disk,
 
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
+	if manager.gce.skipMutation("resize", "regional disk", meta.RegionalKey(disk.Name, disk.Region), resizeServiceRequest) {
+		return nil
+	}
 	return manager.gce.c.RegionDisks().Resize(ctx, meta.RegionalKey(disk.Name, disk.Region), resizeServiceRequest)
 }
 
@@ -949,7 +975,8 @@ func (g *Cloud) GetDiskByNameUnknownZone(diskName string) (*Disk, error) {
 	// on create)
 
 	var found *Disk
-	for _, zone := range g.managedZones {
+	zones := g.getManagedZones()
+	for _, zone := range zones {
 		disk, err := g.findDiskByName(diskName, zone)
 		if err != nil {
 			return nil, err
@@ -978,7 +1005,7 @@ func (g *Cloud) GetDiskByNameUnknownZone(diskName string) (*Disk, error) {
 		return found, nil
 	}
 	klog.Warningf("GCE persistent disk %q not found in managed zones (%s)",
-		diskName, strings.Join(g.managedZones, ","))
+		diskName, strings.Join(zones, ","))
 
 	return nil, cloudprovider.DiskNotFound
 }
@@ -0,0 +1,56 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"encoding/json"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"k8s.io/klog/v2"
+)
+
+// SetDryRun enables or disables the dry-run mode. In dry-run mode, every
+// mutation of a GCE resource, which all go through skipMutation, is logged
+// instead of being executed, to preview the changes the cloud provider would
+// make in an existing project. Reads are still executed, so controllers may
+// fail later on when they look up a resource they would have created.
+func (g *Cloud) SetDryRun(dryRun bool) {
+	g.dryRun = dryRun
+}
+
+// skipMutation logs and returns true if the operation on the resource with
+// the given key must not be executed because of the dry-run mode. obj is the
+// resource or request sent with the operation, if any.
+func (g *Cloud) skipMutation(operation, resource string, key *meta.Key, obj interface{}) bool {
+	if !g.dryRun {
+		return false
+	}
+	if obj == nil {
+		klog.Infof("Dry run: would %s %s %v", operation, resource, key)
+		return true
+	}
+	body, err := json.Marshal(obj)
+	if err != nil {
+		klog.Infof("Dry run: would %s %s %v: %+v", operation, resource, key, obj)
+		return true
+	}
+	klog.Infof("Dry run: would %s %s %v: %s", operation, resource, key, body)
+	return true
+}
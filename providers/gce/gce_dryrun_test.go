@@ -0,0 +1,75 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestDryRun(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.SetDryRun(true)
+
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "fw"}))
+	_, err = gce.GetFirewall("fw")
+	assert.True(t, isHTTPErrorCode(err, http.StatusNotFound), "firewall created in dry-run mode: %v", err)
+
+	require.NoError(t, gce.CreateTargetPool(&compute.TargetPool{Name: "tp"}, vals.Region))
+	_, err = gce.GetTargetPool("tp", vals.Region)
+	assert.True(t, isHTTPErrorCode(err, http.StatusNotFound), "target pool created in dry-run mode: %v", err)
+
+	require.NoError(t, gce.CreateRegionForwardingRule(&compute.ForwardingRule{Name: "fr"}, vals.Region))
+	_, err = gce.GetRegionForwardingRule("fr", vals.Region)
+	assert.True(t, isHTTPErrorCode(err, http.StatusNotFound), "forwarding rule created in dry-run mode: %v", err)
+
+	require.NoError(t, gce.ReserveRegionAddress(&compute.Address{Name: "addr"}, vals.Region))
+	_, err = gce.GetRegionAddress("addr", vals.Region)
+	assert.True(t, isHTTPErrorCode(err, http.StatusNotFound), "address created in dry-run mode: %v", err)
+
+	require.NoError(t, gce.CreateHealthCheck(&compute.HealthCheck{Name: "hc"}))
+	_, err = gce.GetHealthCheck("hc")
+	assert.True(t, isHTTPErrorCode(err, http.StatusNotFound), "health check created in dry-run mode: %v", err)
+
+	require.NoError(t, gce.CreateRegionBackendService(&compute.BackendService{Name: "bs"}, vals.Region))
+	_, err = gce.GetRegionBackendService("bs", vals.Region)
+	assert.True(t, isHTTPErrorCode(err, http.StatusNotFound), "backend service created in dry-run mode: %v", err)
+
+	require.NoError(t, gce.CreateInstanceGroup(&compute.InstanceGroup{Name: "ig"}, vals.ZoneName))
+	_, err = gce.GetInstanceGroup("ig", vals.ZoneName)
+	assert.True(t, isHTTPErrorCode(err, http.StatusNotFound), "instance group created in dry-run mode: %v", err)
+
+	gce.SetDryRun(false)
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "fw"}))
+	gce.SetDryRun(true)
+	require.NoError(t, gce.DeleteFirewall("fw"))
+	_, err = gce.GetFirewall("fw")
+	assert.NoError(t, err, "firewall deleted in dry-run mode")
+
+	require.NoError(t, gce.DeleteRoute(context.TODO(), vals.ClusterName, &cloudprovider.Route{Name: "route"}))
+}
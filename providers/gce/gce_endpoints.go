@@ -0,0 +1,60 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// validateAPIEndpoints checks the base URLs overriding the endpoints of the
+// API families, e.g. for Private Google Access, regional endpoints, staging
+// environments or emulators, and adds the missing trailing slashes, which the
+// API clients resolve the paths of the methods against.
+func validateAPIEndpoints(global *ConfigGlobal) error {
+	for _, endpoint := range []struct {
+		field string
+		value *string
+	}{
+		{"api-endpoint", &global.APIEndpoint},
+		{"container-api-endpoint", &global.ContainerAPIEndpoint},
+		{"tpu-api-endpoint", &global.TPUAPIEndpoint},
+		{"networkservices-api-endpoint", &global.NetworkServicesAPIEndpoint},
+	} {
+		if *endpoint.value == "" {
+			continue
+		}
+		u, err := url.Parse(*endpoint.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", endpoint.field, *endpoint.value, err)
+		}
+		if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid %s %q: must be an absolute http or https URL", endpoint.field, *endpoint.value)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid %s %q: must not have a query or a fragment", endpoint.field, *endpoint.value)
+		}
+		if !strings.HasSuffix(*endpoint.value, "/") {
+			*endpoint.value += "/"
+		}
+	}
+	return nil
+}
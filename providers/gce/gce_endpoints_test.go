@@ -0,0 +1,94 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"testing"
+)
+
+func TestValidateAPIEndpoints(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{
+			desc: "default",
+		},
+		{
+			desc:     "regional endpoint",
+			endpoint: "https://compute.us-central1.rep.googleapis.com/compute/v1/",
+			want:     "https://compute.us-central1.rep.googleapis.com/compute/v1/",
+		},
+		{
+			desc:     "missing trailing slash",
+			endpoint: "https://www.googleapis.com/compute/v1",
+			want:     "https://www.googleapis.com/compute/v1/",
+		},
+		{
+			desc:     "emulator",
+			endpoint: "http://localhost:8080/compute/v1/",
+			want:     "http://localhost:8080/compute/v1/",
+		},
+		{
+			desc:     "relative URL",
+			endpoint: "compute/v1/",
+			wantErr:  true,
+		},
+		{
+			desc:     "unsupported scheme",
+			endpoint: "ftp://www.googleapis.com/compute/v1/",
+			wantErr:  true,
+		},
+		{
+			desc:     "query",
+			endpoint: "https://www.googleapis.com/compute/v1/?alt=json",
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			global := &ConfigGlobal{
+				APIEndpoint:                tc.endpoint,
+				ContainerAPIEndpoint:       tc.endpoint,
+				TPUAPIEndpoint:             tc.endpoint,
+				NetworkServicesAPIEndpoint: tc.endpoint,
+			}
+			err := validateAPIEndpoints(global)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validateAPIEndpoints() = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			for field, got := range map[string]string{
+				"api-endpoint":                 global.APIEndpoint,
+				"container-api-endpoint":       global.ContainerAPIEndpoint,
+				"tpu-api-endpoint":             global.TPUAPIEndpoint,
+				"networkservices-api-endpoint": global.NetworkServicesAPIEndpoint,
+			} {
+				if got != tc.want {
+					t.Errorf("%s = %q, want %q", field, got, tc.want)
+				}
+			}
+		})
+	}
+}
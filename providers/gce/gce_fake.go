@@ -21,10 +21,14 @@ package gce
 
 import (
 	"context"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	computealpha "google.golang.org/api/compute/v0.alpha"
+	computebeta "google.golang.org/api/compute/v0.beta"
 	compute "google.golang.org/api/compute/v1"
 	option "google.golang.org/api/option"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -41,6 +45,9 @@ type TestClusterValues struct {
 	NetworkURL        string
 	SubnetworkURL     string
 	StackType         StackType
+	// ManagedZones are the zones managed by the cloud, only the zone of
+	// ZoneName if empty.
+	ManagedZones []string
 }
 
 // DefaultTestClusterValues Creates a reasonable set of default cluster values
@@ -90,11 +97,51 @@ func NewFakeGCECloud(vals TestClusterValues) *Cloud {
 		unsafeSubnetworkURL: vals.SubnetworkURL,
 		stackType:           vals.StackType,
 	}
+	if len(vals.ManagedZones) > 0 {
+		gce.managedZones = vals.ManagedZones
+	}
 	c := cloud.NewMockGCE(&gceProjectRouter{gce})
 	gce.c = c
 	return gce
 }
 
+// NewFakeGCECloudWithEndpoint constructs a GCE Cloud from the cluster values
+// which calls the compute API at the root URL endpoint, e.g. the one of a
+// fake API server, without authentication, unlike NewFakeGCECloud whose
+// calls are answered by a mock.
+func NewFakeGCECloudWithEndpoint(vals TestClusterValues, endpoint string) (*Cloud, error) {
+	ctx := context.Background()
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	service, err := compute.NewService(ctx, option.WithEndpoint(endpoint+"/compute/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		return nil, err
+	}
+	serviceBeta, err := computebeta.NewService(ctx, option.WithEndpoint(endpoint+"/compute/beta/"), option.WithoutAuthentication())
+	if err != nil {
+		return nil, err
+	}
+	serviceAlpha, err := computealpha.NewService(ctx, option.WithEndpoint(endpoint+"/compute/alpha/"), option.WithoutAuthentication())
+	if err != nil {
+		return nil, err
+	}
+	gce := NewFakeGCECloud(vals)
+	gce.service = service
+	gce.serviceBeta = serviceBeta
+	gce.serviceAlpha = serviceAlpha
+	gce.projectsBasePath = getProjectsBasePath(service.BasePath)
+	gce.nodeZones = map[string]sets.String{}
+	gce.manager = &gceServiceManager{gce}
+	gce.s = &cloud.Service{
+		GA:            service,
+		Alpha:         serviceAlpha,
+		Beta:          serviceBeta,
+		ProjectRouter: &gceProjectRouter{gce},
+		RateLimiter:   newInstrumentedRateLimiter(&cloud.NopRateLimiter{}),
+	}
+	gce.c = cloud.NewGCE(gce.s)
+	return gce, nil
+}
+
 // UpdateFakeGCECloud updates the fake GCE cloud with the specified values. Currently only the onXPN value is updated.
 func UpdateFakeGCECloud(g *Cloud, vals TestClusterValues) {
 	g.onXPN = vals.OnXPN
@@ -0,0 +1,99 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"sync"
+
+	"k8s.io/component-base/featuregate"
+)
+
+// Feature gates of the GCE cloud provider. Unlike the alpha features set with
+// alpha-features in the cloud config, these are toggled per cluster with the
+// --feature-gates flag of the cloud-controller-manager, and go through the
+// usual alpha, beta and GA stages.
+const (
+	// NEGBackedNetLB lets external LoadBalancer Services opt in, with the
+	// networking.gke.io/external-load-balancer-backends annotation, to
+	// regional backend services backed by zonal NEGs instead of target pools.
+	NEGBackedNetLB featuregate.Feature = "NEGBackedNetLB"
+
+	// DualStackLoadBalancers provisions IPv4 and IPv6 forwarding rules for
+	// dual-stack LoadBalancer Services.
+	DualStackLoadBalancers featuregate.Feature = "DualStackLoadBalancers"
+
+	// RouteConflictDetection refuses to create a Node route when a route that
+	// is not owned by the cluster already programs an equal or more specific
+	// part of its destination range.
+	RouteConflictDetection featuregate.Feature = "RouteConflictDetection"
+
+	// FastLoadBalancerDeregistration removes the instance of a Node from the
+	// backends of the load balancers as soon as the Node is deleted or
+	// labeled with node.kubernetes.io/exclude-from-external-load-balancers.
+	FastLoadBalancerDeregistration featuregate.Feature = "FastLoadBalancerDeregistration"
+
+	// ComputeHTTP2KeepAlive keeps the HTTP/2 connections to the GCE API alive
+	// with pings, so that the ones dropped while idle are replaced before a
+	// call is sent over them.
+	ComputeHTTP2KeepAlive featuregate.Feature = "ComputeHTTP2KeepAlive"
+)
+
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	NEGBackedNetLB:                 {Default: false, PreRelease: featuregate.Alpha},
+	DualStackLoadBalancers:         {Default: false, PreRelease: featuregate.Alpha},
+	RouteConflictDetection:         {Default: false, PreRelease: featuregate.Alpha},
+	FastLoadBalancerDeregistration: {Default: false, PreRelease: featuregate.Alpha},
+	ComputeHTTP2KeepAlive:          {Default: false, PreRelease: featuregate.Alpha},
+}
+
+var (
+	featureGateLock sync.RWMutex
+	featureGate     = newFeatureGate()
+)
+
+func newFeatureGate() featuregate.FeatureGate {
+	gate := featuregate.NewFeatureGate()
+	if err := gate.Add(defaultFeatureGates); err != nil {
+		panic(err)
+	}
+	return gate
+}
+
+// AddFeatureGates registers the feature gates of the GCE cloud provider with
+// gate, so that they can be set with its --feature-gates flag.
+func AddFeatureGates(gate featuregate.MutableFeatureGate) error {
+	return gate.Add(defaultFeatureGates)
+}
+
+// SetFeatureGate sets the feature gate the GCE cloud provider reads its
+// features from. gate must have the features registered with AddFeatureGates.
+// Until it is called, all features have their default value.
+func SetFeatureGate(gate featuregate.FeatureGate) {
+	featureGateLock.Lock()
+	defer featureGateLock.Unlock()
+	featureGate = gate
+}
+
+// featureEnabled returns true if the feature is enabled.
+func featureEnabled(feature featuregate.Feature) bool {
+	featureGateLock.RLock()
+	defer featureGateLock.RUnlock()
+	return featureGate.Enabled(feature)
+}
@@ -0,0 +1,54 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"testing"
+
+	"k8s.io/component-base/featuregate"
+)
+
+func TestFeatureGates(t *testing.T) {
+	for feature := range defaultFeatureGates {
+		if featureEnabled(feature) {
+			t.Errorf("Feature %q is enabled by default, want disabled", feature)
+		}
+	}
+
+	gate := featuregate.NewFeatureGate()
+	if err := AddFeatureGates(gate); err != nil {
+		t.Fatalf("AddFeatureGates() = %v", err)
+	}
+	if err := gate.Set("NEGBackedNetLB=true"); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if err := gate.Set("UnknownFeature=true"); err == nil {
+		t.Errorf("Set() of an unknown feature succeeded, want error")
+	}
+
+	SetFeatureGate(gate)
+	defer SetFeatureGate(newFeatureGate())
+	if !featureEnabled(NEGBackedNetLB) {
+		t.Errorf("Feature %q is disabled, want enabled", NEGBackedNetLB)
+	}
+	if featureEnabled(DualStackLoadBalancers) {
+		t.Errorf("Feature %q is enabled, want disabled", DualStackLoadBalancers)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	compute "google.golang.org/api/compute/v1"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 )
 
@@ -40,13 +41,27 @@ func (g *Cloud) GetFirewall(name string) (*compute.Firewall, error) {
 	return v, mc.Observe(err)
 }
 
+// ListFirewalls lists all Firewalls in the project.
+func (g *Cloud) ListFirewalls() ([]*compute.Firewall, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	mc := newFirewallMetricContext("list")
+	v, err := g.c.Firewalls().List(ctx, filter.None)
+	return v, mc.Observe(err)
+}
+
 // CreateFirewall creates the passed firewall
 func (g *Cloud) CreateFirewall(f *compute.Firewall) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "firewall", meta.GlobalKey(f.Name), f) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "firewall", meta.GlobalKey(f.Name), f)
 	mc := newFirewallMetricContext("create")
-	return mc.Observe(g.c.Firewalls().Insert(ctx, meta.GlobalKey(f.Name), f))
+	return mc.Observe(audit(g.c.Firewalls().Insert(ctx, meta.GlobalKey(f.Name), f)))
 }
 
 // DeleteFirewall deletes the given firewall rule.
@@ -54,8 +69,12 @@ func (g *Cloud) DeleteFirewall(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "firewall", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "firewall", meta.GlobalKey(name), nil)
 	mc := newFirewallMetricContext("delete")
-	return mc.Observe(g.c.Firewalls().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.Firewalls().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // UpdateFirewall applies the given firewall as an update to an existing service.
@@ -63,8 +82,12 @@ func (g *Cloud) UpdateFirewall(f *compute.Firewall) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "firewall", meta.GlobalKey(f.Name), f) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "firewall", meta.GlobalKey(f.Name), f)
 	mc := newFirewallMetricContext("update")
-	return mc.Observe(g.c.Firewalls().Update(ctx, meta.GlobalKey(f.Name), f))
+	return mc.Observe(audit(g.c.Firewalls().Update(ctx, meta.GlobalKey(f.Name), f)))
 }
 
 // PatchFirewall applies the given firewall as an update to an existing service.
@@ -72,6 +95,10 @@ func (g *Cloud) PatchFirewall(f *compute.Firewall) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("patch", "firewall", meta.GlobalKey(f.Name), f) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "patch", "firewall", meta.GlobalKey(f.Name), f)
 	mc := newFirewallMetricContext("Patch")
-	return mc.Observe(g.c.Firewalls().Patch(ctx, meta.GlobalKey(f.Name), f))
+	return mc.Observe(audit(g.c.Firewalls().Patch(ctx, meta.GlobalKey(f.Name), f)))
 }
@@ -0,0 +1,165 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// FirewallTargetTags makes the load balancer firewall rules target the
+	// node tags. It is the default.
+	FirewallTargetTags = "tags"
+	// FirewallTargetServiceAccounts makes the load balancer firewall rules
+	// target the configured service accounts of the nodes.
+	FirewallTargetServiceAccounts = "service-accounts"
+)
+
+// parseFirewallPolicy validates the firewall-source-range,
+// firewall-target and firewall-target-service-account cloud config values.
+// It returns the target service accounts, which are empty if the firewall
+// rules target the node tags.
+func parseFirewallPolicy(sourceRanges []string, target string, serviceAccounts []string) ([]string, error) {
+	if _, err := utilnet.ParseIPNets(sourceRanges...); err != nil {
+		return nil, fmt.Errorf("invalid firewall-source-range: %v", err)
+	}
+	switch target {
+	case "", FirewallTargetTags:
+		if len(serviceAccounts) > 0 {
+			return nil, fmt.Errorf("firewall-target-service-account requires firewall-target %s", FirewallTargetServiceAccounts)
+		}
+		return nil, nil
+	case FirewallTargetServiceAccounts:
+		if len(serviceAccounts) == 0 {
+			return nil, fmt.Errorf("firewall-target %s requires at least one firewall-target-service-account", FirewallTargetServiceAccounts)
+		}
+		return serviceAccounts, nil
+	default:
+		return nil, fmt.Errorf("invalid firewall-target %q, must be %s or %s", target, FirewallTargetTags, FirewallTargetServiceAccounts)
+	}
+}
+
+// loadBalancerSourceRanges returns the source ranges allowed to reach the
+// load balancer of the Service. The Services which do not restrict them are
+// reachable from the configured firewall source ranges, or from anywhere if
+// there are none.
+func (g *Cloud) loadBalancerSourceRanges(svc *v1.Service) (utilnet.IPNetSet, error) {
+	if len(g.firewallSourceRanges) > 0 && len(svc.Spec.LoadBalancerSourceRanges) == 0 &&
+		strings.TrimSpace(svc.Annotations[v1.AnnotationLoadBalancerSourceRangesKey]) == "" {
+		return utilnet.ParseIPNets(g.firewallSourceRanges...)
+	}
+	return servicehelpers.GetLoadBalancerSourceRanges(svc)
+}
+
+// setFirewallTargets sets the targets of the load balancer firewall rule:
+// the configured service accounts, or else the node tags returned by
+// nodeTags.
+func (g *Cloud) setFirewallTargets(fw *compute.Firewall, nodeTags func() ([]string, error)) error {
+	if len(g.firewallTargetServiceAccounts) > 0 {
+		fw.TargetServiceAccounts = g.firewallTargetServiceAccounts
+		return nil
+	}
+	tags, err := nodeTags()
+	if err != nil {
+		return err
+	}
+	fw.TargetTags = tags
+	return nil
+}
+
+// firewallTargetsNeedUpdate returns whether the targets of the existing load
+// balancer firewall rule are not of the configured kind or service accounts.
+func (g *Cloud) firewallTargetsNeedUpdate(fw *compute.Firewall) bool {
+	if len(g.firewallTargetServiceAccounts) > 0 {
+		return len(fw.TargetTags) > 0 || !equalStringSets(fw.TargetServiceAccounts, g.firewallTargetServiceAccounts)
+	}
+	return len(fw.TargetServiceAccounts) > 0
+}
+
+// clearOtherFirewallTargets makes a patch of the firewall rule clear the kind
+// of targets it does not set, since a rule cannot have both.
+func clearOtherFirewallTargets(fw *compute.Firewall) {
+	if len(fw.TargetServiceAccounts) > 0 {
+		fw.NullFields = append(fw.NullFields, "TargetTags")
+	} else {
+		fw.NullFields = append(fw.NullFields, "TargetServiceAccounts")
+	}
+}
+
+// skipFirewallChange returns whether the management of the load balancer
+// firewall rules is skipped, in which case it raises an event on the Service
+// with the gcloud command making the change of the firewall rule in the
+// network project instead. As the firewall rules cannot be read, the command
+// is raised again only once it changes.
+func (g *Cloud) skipFirewallChange(svc *v1.Service, fwName, cmd string) bool {
+	if !g.skipFirewallManagement {
+		return false
+	}
+	if !g.firewallCommands.changed(svc, fwName, cmd) {
+		klog.V(4).Infof("Skipping firewall change for service %s/%s, already raised: %s", svc.Namespace, svc.Name, cmd)
+		return true
+	}
+	klog.V(2).Infof("Skipping firewall change for service %s/%s, raising event: %s", svc.Namespace, svc.Name, cmd)
+	g.raiseFirewallChangeNeededEvent(svc, cmd)
+	return true
+}
+
+// firewallCommands are the gcloud commands last raised for the firewall rules
+// of the Services when the management of the firewall rules is skipped. Its
+// zero value is ready to use.
+type firewallCommands struct {
+	mu        sync.Mutex
+	byService map[types.UID]map[string]string
+}
+
+// changed records cmd as the last command raised for the firewall rule of
+// the Service, and returns whether it differs from the previous one.
+func (c *firewallCommands) changed(svc *v1.Service, fwName, cmd string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byService[svc.UID][fwName] == cmd {
+		return false
+	}
+	if c.byService == nil {
+		c.byService = map[types.UID]map[string]string{}
+	}
+	if c.byService[svc.UID] == nil {
+		c.byService[svc.UID] = map[string]string{}
+	}
+	c.byService[svc.UID][fwName] = cmd
+	return true
+}
+
+// forget drops the commands raised for the Service, once its load balancer
+// is deleted.
+func (c *firewallCommands) forget(svc *v1.Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.byService, svc.UID)
+}
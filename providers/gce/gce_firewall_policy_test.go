@@ -0,0 +1,208 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseFirewallPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		desc            string
+		sourceRanges    []string
+		target          string
+		serviceAccounts []string
+		want            []string
+		wantErr         string
+	}{
+		{desc: "defaults"},
+		{desc: "tags", sourceRanges: []string{"10.0.0.0/8"}, target: FirewallTargetTags},
+		{desc: "service accounts", target: FirewallTargetServiceAccounts, serviceAccounts: []string{"nodes@p.iam.gserviceaccount.com"}, want: []string{"nodes@p.iam.gserviceaccount.com"}},
+		{desc: "invalid source range", sourceRanges: []string{"10.0.0.0"}, wantErr: "invalid firewall-source-range"},
+		{desc: "invalid target", target: "labels", wantErr: "invalid firewall-target"},
+		{desc: "service accounts missing", target: FirewallTargetServiceAccounts, wantErr: "requires at least one"},
+		{desc: "service accounts with tags", serviceAccounts: []string{"nodes@p.iam.gserviceaccount.com"}, wantErr: "requires firewall-target"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseFirewallPolicy(tc.sourceRanges, tc.target, tc.serviceAccounts)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLoadBalancerSourceRanges(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	svc := fakeLoadbalancerService("")
+
+	ranges, err := gce.loadBalancerSourceRanges(svc)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0.0.0.0/0"}, ranges.StringSlice())
+
+	gce.firewallSourceRanges = []string{"10.0.0.0/8", "192.168.0.0/16"}
+	ranges, err = gce.loadBalancerSourceRanges(svc)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10.0.0.0/8", "192.168.0.0/16"}, ranges.StringSlice())
+
+	// The ranges of the Service take precedence.
+	svc.Annotations[v1.AnnotationLoadBalancerSourceRangesKey] = "172.16.0.0/12"
+	ranges, err = gce.loadBalancerSourceRanges(svc)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"172.16.0.0/12"}, ranges.StringSlice())
+}
+
+func TestFirewallTargetServiceAccounts(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	nodeNames := []string{"test-node-1"}
+	_, err = createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+	gce.firewallSourceRanges = []string{"10.0.0.0/8"}
+	gce.firewallTargetServiceAccounts = []string{"nodes@p.iam.gserviceaccount.com"}
+
+	svc := fakeLoadbalancerService("")
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	fw, err := gce.GetFirewall(MakeFirewallName(gce.GetLoadBalancerName(nil, "", svc)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8"}, fw.SourceRanges)
+	assert.Equal(t, []string{"nodes@p.iam.gserviceaccount.com"}, fw.TargetServiceAccounts)
+	assert.Empty(t, fw.TargetTags)
+
+	// Switching back to the node tags replaces the service accounts.
+	gce.firewallTargetServiceAccounts = nil
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	fw, err = gce.GetFirewall(MakeFirewallName(gce.GetLoadBalancerName(nil, "", svc)))
+	require.NoError(t, err)
+	assert.Empty(t, fw.TargetServiceAccounts)
+	assert.NotEmpty(t, fw.TargetTags)
+	assert.Contains(t, fw.NullFields, "TargetServiceAccounts")
+}
+
+func TestInternalFirewallTargetServiceAccounts(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.firewallTargetServiceAccounts = []string{"nodes@p.iam.gserviceaccount.com"}
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	err = gce.ensureInternalFirewall(svc, "fw", "", "", []string{"10.0.0.0/8"}, []string{"80"}, v1.ProtocolTCP, nodes, "")
+	require.NoError(t, err)
+	fw, err := gce.GetFirewall("fw")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nodes@p.iam.gserviceaccount.com"}, fw.TargetServiceAccounts)
+	assert.Empty(t, fw.TargetTags)
+}
+
+func TestFirewallToGcloudArgsServiceAccounts(t *testing.T) {
+	fw := &compute.Firewall{
+		Description:           "desc",
+		TargetServiceAccounts: []string{"b@p.iam.gserviceaccount.com", "a@p.iam.gserviceaccount.com"},
+		SourceRanges:          []string{"10.0.0.0/8"},
+		Allowed:               []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{"80"}}},
+	}
+	assert.Equal(t, `--description "desc" --allow tcp:80 --source-ranges 10.0.0.0/8 --target-service-accounts a@p.iam.gserviceaccount.com,b@p.iam.gserviceaccount.com --project my-project`, firewallToGcloudArgs(fw, "my-project"))
+}
+
+func TestSkipFirewallManagement(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.skipFirewallManagement = true
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+	c := gce.c.(*cloud.MockGCE)
+	c.MockFirewalls.GetHook = mock.GetFirewallsUnauthorizedErrHook
+	c.MockFirewalls.InsertHook = mock.InsertFirewallsUnauthorizedErrHook
+	c.MockFirewalls.PatchHook = mock.UpdateFirewallsUnauthorizedErrHook
+	c.MockFirewalls.DeleteHook = mock.DeleteFirewallsUnauthorizedErrHook
+	nodeNames := []string{"test-node-1"}
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+
+	external := fakeLoadbalancerService("")
+	external.Name, external.UID = "external", "external"
+	_, err = createExternalLoadBalancer(gce, external, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	internal := fakeLoadbalancerService(string(LBTypeInternal))
+	internal.Name, internal.UID = "internal", "internal"
+	internal, err = gce.client.CoreV1().Services(internal.Namespace).Create(context.TODO(), internal, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, internal, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	externalFw := MakeFirewallName(gce.GetLoadBalancerName(context.TODO(), "", external))
+	internalFw := MakeFirewallName(gce.GetLoadBalancerName(context.TODO(), "", internal))
+	events := firewallEvents(recorder)
+	assert.Contains(t, events, "gcloud compute firewall-rules create "+externalFw+" ")
+	assert.Contains(t, events, "gcloud compute firewall-rules create "+internalFw+" ")
+
+	// The commands are only raised again once they change.
+	_, err = gce.EnsureLoadBalancer(context.TODO(), vals.ClusterName, internal, nodes)
+	require.NoError(t, err)
+	assert.NotContains(t, firewallEvents(recorder), "gcloud compute firewall-rules create "+internalFw+" ")
+	internal.Spec.LoadBalancerSourceRanges = []string{"10.0.0.0/8"}
+	_, err = gce.EnsureLoadBalancer(context.TODO(), vals.ClusterName, internal, nodes)
+	require.NoError(t, err)
+	events = firewallEvents(recorder)
+	assert.Contains(t, events, "gcloud compute firewall-rules create "+internalFw+" ")
+	assert.Contains(t, events, "--source-ranges 10.0.0.0/8")
+
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.TODO(), vals.ClusterName, external))
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.TODO(), vals.ClusterName, internal))
+	events = firewallEvents(recorder)
+	assert.Contains(t, events, "gcloud compute firewall-rules delete "+externalFw+" --project "+gce.NetworkProjectID())
+	assert.Contains(t, events, "gcloud compute firewall-rules delete "+internalFw+" --project "+gce.NetworkProjectID())
+}
+
+// firewallEvents returns the recorded events with the firewall changes to
+// make manually.
+func firewallEvents(recorder *record.FakeRecorder) string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.Contains(event, eventReasonManualChange) {
+				events = append(events, event)
+			}
+		default:
+			return strings.Join(events, "\n")
+		}
+	}
+}
@@ -40,8 +40,12 @@ func (g *Cloud) CreateGlobalForwardingRule(rule *compute.ForwardingRule) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "global forwarding rule", meta.GlobalKey(rule.Name), rule) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "global forwarding rule", meta.GlobalKey(rule.Name), rule)
 	mc := newForwardingRuleMetricContext("create", "")
-	return mc.Observe(g.c.GlobalForwardingRules().Insert(ctx, meta.GlobalKey(rule.Name), rule))
+	return mc.Observe(audit(g.c.GlobalForwardingRules().Insert(ctx, meta.GlobalKey(rule.Name), rule)))
 }
 
 // SetProxyForGlobalForwardingRule links the given TargetHttp(s)Proxy with the given GlobalForwardingRule.
@@ -50,9 +54,13 @@ func (g *Cloud) SetProxyForGlobalForwardingRule(forwardingRuleName, targetProxyL
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
-	mc := newForwardingRuleMetricContext("set_proxy", "")
 	target := &compute.TargetReference{Target: targetProxyLink}
-	return mc.Observe(g.c.GlobalForwardingRules().SetTarget(ctx, meta.GlobalKey(forwardingRuleName), target))
+	if g.skipMutation("set target of", "global forwarding rule", meta.GlobalKey(forwardingRuleName), target) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "set target of", "global forwarding rule", meta.GlobalKey(forwardingRuleName), target)
+	mc := newForwardingRuleMetricContext("set_proxy", "")
+	return mc.Observe(audit(g.c.GlobalForwardingRules().SetTarget(ctx, meta.GlobalKey(forwardingRuleName), target)))
 }
 
 // DeleteGlobalForwardingRule deletes the GlobalForwardingRule by name.
@@ -60,8 +68,12 @@ func (g *Cloud) DeleteGlobalForwardingRule(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "global forwarding rule", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "global forwarding rule", meta.GlobalKey(name), nil)
 	mc := newForwardingRuleMetricContext("delete", "")
-	return mc.Observe(g.c.GlobalForwardingRules().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.GlobalForwardingRules().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // GetGlobalForwardingRule returns the GlobalForwardingRule by name.
@@ -150,8 +162,12 @@ func (g *Cloud) CreateRegionForwardingRule(rule *compute.ForwardingRule, region
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "forwarding rule", meta.RegionalKey(rule.Name, region), rule) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "forwarding rule", meta.RegionalKey(rule.Name, region), rule)
 	mc := newForwardingRuleMetricContext("create", region)
-	return mc.Observe(g.c.ForwardingRules().Insert(ctx, meta.RegionalKey(rule.Name, region), rule))
+	return mc.Observe(audit(g.c.ForwardingRules().Insert(ctx, meta.RegionalKey(rule.Name, region), rule)))
 }
 
 // CreateAlphaRegionForwardingRule creates and returns an Alpha
@@ -160,8 +176,12 @@ func (g *Cloud) CreateAlphaRegionForwardingRule(rule *computealpha.ForwardingRul
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "forwarding rule", meta.RegionalKey(rule.Name, region), rule) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "forwarding rule", meta.RegionalKey(rule.Name, region), rule)
 	mc := newForwardingRuleMetricContextWithVersion("create", region, computeAlphaVersion)
-	return mc.Observe(g.c.AlphaForwardingRules().Insert(ctx, meta.RegionalKey(rule.Name, region), rule))
+	return mc.Observe(audit(g.c.AlphaForwardingRules().Insert(ctx, meta.RegionalKey(rule.Name, region), rule)))
 }
 
 // CreateBetaRegionForwardingRule creates and returns a Beta
@@ -170,8 +190,12 @@ func (g *Cloud) CreateBetaRegionForwardingRule(rule *computebeta.ForwardingRule,
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "forwarding rule", meta.RegionalKey(rule.Name, region), rule) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "forwarding rule", meta.RegionalKey(rule.Name, region), rule)
 	mc := newForwardingRuleMetricContextWithVersion("create", region, computeBetaVersion)
-	return mc.Observe(g.c.BetaForwardingRules().Insert(ctx, meta.RegionalKey(rule.Name, region), rule))
+	return mc.Observe(audit(g.c.BetaForwardingRules().Insert(ctx, meta.RegionalKey(rule.Name, region), rule)))
 }
 
 // DeleteRegionForwardingRule deletes the RegionalForwardingRule by name & region.
@@ -179,8 +203,12 @@ func (g *Cloud) DeleteRegionForwardingRule(name, region string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "forwarding rule", meta.RegionalKey(name, region), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "forwarding rule", meta.RegionalKey(name, region), nil)
 	mc := newForwardingRuleMetricContext("delete", region)
-	return mc.Observe(g.c.ForwardingRules().Delete(ctx, meta.RegionalKey(name, region)))
+	return mc.Observe(audit(g.c.ForwardingRules().Delete(ctx, meta.RegionalKey(name, region))))
 }
 
 func (g *Cloud) getNetworkTierFromForwardingRule(name, region string) (string, error) {
@@ -0,0 +1,233 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+)
+
+const (
+	// maxHealthCheckSeconds is the highest health check interval and timeout.
+	maxHealthCheckSeconds = 300
+	// maxHealthCheckThreshold is the highest healthy and unhealthy threshold.
+	maxHealthCheckThreshold = 10
+
+	healthCheckProxyHeaderNone    = "NONE"
+	healthCheckProxyHeaderProxyV1 = "PROXY_V1"
+)
+
+// healthCheckParams are the health check parameters set with Service
+// annotations. The ones not set are the defaults.
+type healthCheckParams struct {
+	checkIntervalSec   int64
+	timeoutSec         int64
+	healthyThreshold   int64
+	unhealthyThreshold int64
+	requestPath        string
+	// proxyHeader is the proxy header of the health checks, empty if not
+	// set.
+	proxyHeader string
+}
+
+// healthCheckParamsAnnotations is the allow-list of Service annotations
+// setting health check parameters, with the parsers validating them.
+var healthCheckParamsAnnotations = map[string]func(value string, p *healthCheckParams) error{
+	ServiceAnnotationHealthCheckInterval: func(value string, p *healthCheckParams) error {
+		return parseHealthCheckInt(value, maxHealthCheckSeconds, &p.checkIntervalSec)
+	},
+	ServiceAnnotationHealthCheckTimeout: func(value string, p *healthCheckParams) error {
+		return parseHealthCheckInt(value, maxHealthCheckSeconds, &p.timeoutSec)
+	},
+	ServiceAnnotationHealthCheckHealthyThreshold: func(value string, p *healthCheckParams) error {
+		return parseHealthCheckInt(value, maxHealthCheckThreshold, &p.healthyThreshold)
+	},
+	ServiceAnnotationHealthCheckUnhealthyThreshold: func(value string, p *healthCheckParams) error {
+		return parseHealthCheckInt(value, maxHealthCheckThreshold, &p.unhealthyThreshold)
+	},
+	ServiceAnnotationHealthCheckRequestPath: func(value string, p *healthCheckParams) error {
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("must start with /")
+		}
+		if strings.IndexFunc(value, func(r rune) bool { return !unicode.IsPrint(r) || unicode.IsSpace(r) }) >= 0 {
+			return fmt.Errorf("must only contain printable characters other than spaces")
+		}
+		p.requestPath = value
+		return nil
+	},
+	ServiceAnnotationHealthCheckProxyHeader: func(value string, p *healthCheckParams) error {
+		if value != healthCheckProxyHeaderNone && value != healthCheckProxyHeaderProxyV1 {
+			return fmt.Errorf("must be %s or %s", healthCheckProxyHeaderNone, healthCheckProxyHeaderProxyV1)
+		}
+		p.proxyHeader = value
+		return nil
+	},
+}
+
+// localTrafficHealthCheckAnnotations are the health check parameters
+// annotations accepted on Services with externalTrafficPolicy Local, whose
+// health checks request the healthCheckNodePort served by kube-proxy or its
+// replacement.
+var localTrafficHealthCheckAnnotations = sets.NewString(ServiceAnnotationHealthCheckRequestPath, ServiceAnnotationHealthCheckProxyHeader)
+
+func parseHealthCheckInt(value string, max int64, out *int64) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 1 || n > max {
+		return fmt.Errorf("must be a number between 1 and %d", max)
+	}
+	*out = n
+	return nil
+}
+
+// hasHealthCheckParams returns whether the Service sets health check
+// parameters with annotations, valid or not.
+func hasHealthCheckParams(svc *v1.Service) bool {
+	for key := range svc.Annotations {
+		if strings.HasPrefix(key, ServiceAnnotationHealthCheckPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesNodesHealthCheck returns whether the load balancer of the Service
+// shares the nodes health check with the other load balancers.
+func usesNodesHealthCheck(svc *v1.Service) bool {
+	return !servicehelpers.RequestsOnlyLocalTraffic(svc) && !hasHealthCheckParams(svc)
+}
+
+// getHealthCheckParams returns the health check parameters set with the
+// annotations of the service, nil if there are none, and an error if an
+// annotation is not in the allow-list, has an invalid value, or is not
+// supported with the externalTrafficPolicy Local of the Service.
+func getHealthCheckParams(svc *v1.Service) (*healthCheckParams, error) {
+	if !hasHealthCheckParams(svc) {
+		return nil, nil
+	}
+	p := &healthCheckParams{
+		checkIntervalSec:   gceHcCheckIntervalSeconds,
+		timeoutSec:         gceHcTimeoutSeconds,
+		healthyThreshold:   gceHcHealthyThreshold,
+		unhealthyThreshold: gceHcUnhealthyThreshold,
+		requestPath:        GetNodesHealthCheckPath(),
+	}
+	var keys []string
+	for key := range svc.Annotations {
+		if strings.HasPrefix(key, ServiceAnnotationHealthCheckPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parse, ok := healthCheckParamsAnnotations[key]
+		if !ok {
+			return nil, fmt.Errorf("unsupported health check annotation %q", key)
+		}
+		if servicehelpers.RequestsOnlyLocalTraffic(svc) && !localTrafficHealthCheckAnnotations.Has(key) {
+			return nil, fmt.Errorf("annotation %q is only supported with externalTrafficPolicy %s", key, v1.ServiceExternalTrafficPolicyTypeCluster)
+		}
+		if err := parse(svc.Annotations[key], p); err != nil {
+			return nil, fmt.Errorf("invalid value %q of annotation %q: %v", svc.Annotations[key], key, err)
+		}
+	}
+	if p.timeoutSec > p.checkIntervalSec {
+		return nil, fmt.Errorf("health check timeout %ds must not be greater than the interval %ds", p.timeoutSec, p.checkIntervalSec)
+	}
+	return p, nil
+}
+
+// serviceHealthCheckLogging returns whether the probes of the health check of the
+// load balancer of the Service are logged, and an error if the Service
+// annotation has an invalid value. The annotation is ignored if the health
+// check is shared.
+func (g *Cloud) serviceHealthCheckLogging(svc *v1.Service, shared bool) (bool, error) {
+	value, ok := svc.Annotations[ServiceAnnotationHealthCheckLogging]
+	if !ok {
+		return g.healthCheckLogging, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q of annotation %q, must be true or false", value, ServiceAnnotationHealthCheckLogging)
+	}
+	if shared {
+		if enabled != g.healthCheckLogging {
+			g.eventRecorder.Event(svc, v1.EventTypeWarning, "HealthCheckLoggingIgnored", "The health check logging can not be set on a health check shared with other Services.")
+		}
+		return g.healthCheckLogging, nil
+	}
+	return enabled, nil
+}
+
+// healthCheckLoggingEnabled returns whether the probes of hc are logged.
+func healthCheckLoggingEnabled(hc *compute.HealthCheck) bool {
+	return hc.LogConfig != nil && hc.LogConfig.Enable
+}
+
+// applyToHealthCheck sets the parameters of hc.
+func (p *healthCheckParams) applyToHealthCheck(hc *compute.HealthCheck) {
+	hc.CheckIntervalSec = p.checkIntervalSec
+	hc.TimeoutSec = p.timeoutSec
+	hc.HealthyThreshold = p.healthyThreshold
+	hc.UnhealthyThreshold = p.unhealthyThreshold
+	if hc.HttpHealthCheck != nil && p.proxyHeader != "" {
+		hc.HttpHealthCheck.ProxyHeader = p.proxyHeader
+	}
+}
+
+// matchesHealthCheck returns whether hc has the parameters.
+func (p *healthCheckParams) matchesHealthCheck(hc *compute.HealthCheck) bool {
+	return hc.CheckIntervalSec == p.checkIntervalSec &&
+		hc.TimeoutSec == p.timeoutSec &&
+		hc.HealthyThreshold == p.healthyThreshold &&
+		hc.UnhealthyThreshold == p.unhealthyThreshold
+}
+
+// healthCheckProxyHeader returns the proxy header of hc, NONE if not set.
+func healthCheckProxyHeader(hc *compute.HealthCheck) string {
+	if hc.HttpHealthCheck == nil || hc.HttpHealthCheck.ProxyHeader == "" {
+		return healthCheckProxyHeaderNone
+	}
+	return hc.HttpHealthCheck.ProxyHeader
+}
+
+// applyToHTTPHealthCheck sets the parameters of the legacy health check hc.
+func (p *healthCheckParams) applyToHTTPHealthCheck(hc *compute.HttpHealthCheck) {
+	hc.CheckIntervalSec = p.checkIntervalSec
+	hc.TimeoutSec = p.timeoutSec
+	hc.HealthyThreshold = p.healthyThreshold
+	hc.UnhealthyThreshold = p.unhealthyThreshold
+}
+
+// matchesHTTPHealthCheck returns whether the legacy health check hc has the
+// parameters.
+func (p *healthCheckParams) matchesHTTPHealthCheck(hc *compute.HttpHealthCheck) bool {
+	return hc.CheckIntervalSec == p.checkIntervalSec &&
+		hc.TimeoutSec == p.timeoutSec &&
+		hc.HealthyThreshold == p.healthyThreshold &&
+		hc.UnhealthyThreshold == p.unhealthyThreshold
+}
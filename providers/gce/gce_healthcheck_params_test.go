@@ -0,0 +1,355 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestGetHealthCheckParams(t *testing.T) {
+	defaults := healthCheckParams{
+		checkIntervalSec:   gceHcCheckIntervalSeconds,
+		timeoutSec:         gceHcTimeoutSeconds,
+		healthyThreshold:   gceHcHealthyThreshold,
+		unhealthyThreshold: gceHcUnhealthyThreshold,
+		requestPath:        GetNodesHealthCheckPath(),
+	}
+	for _, tc := range []struct {
+		desc         string
+		annotations  map[string]string
+		localTraffic bool
+		want         *healthCheckParams
+		wantErr      bool
+	}{
+		{
+			desc: "no annotations",
+		},
+		{
+			desc: "all parameters",
+			annotations: map[string]string{
+				ServiceAnnotationHealthCheckInterval:           "30",
+				ServiceAnnotationHealthCheckTimeout:            "10",
+				ServiceAnnotationHealthCheckHealthyThreshold:   "2",
+				ServiceAnnotationHealthCheckUnhealthyThreshold: "5",
+				ServiceAnnotationHealthCheckRequestPath:        "/readyz",
+			},
+			want: &healthCheckParams{checkIntervalSec: 30, timeoutSec: 10, healthyThreshold: 2, unhealthyThreshold: 5, requestPath: "/readyz"},
+		},
+		{
+			desc:        "defaults of unset parameters",
+			annotations: map[string]string{ServiceAnnotationHealthCheckUnhealthyThreshold: "10"},
+			want: func() *healthCheckParams {
+				p := defaults
+				p.unhealthyThreshold = 10
+				return &p
+			}(),
+		},
+		{
+			desc:        "interval out of range",
+			annotations: map[string]string{ServiceAnnotationHealthCheckInterval: "0"},
+			wantErr:     true,
+		},
+		{
+			desc:        "timeout greater than the interval",
+			annotations: map[string]string{ServiceAnnotationHealthCheckTimeout: "20"},
+			wantErr:     true,
+		},
+		{
+			desc:        "relative request path",
+			annotations: map[string]string{ServiceAnnotationHealthCheckRequestPath: "readyz"},
+			wantErr:     true,
+		},
+		{
+			desc:        "annotation not in allow-list",
+			annotations: map[string]string{ServiceAnnotationHealthCheckPrefix + "port": "8080"},
+			wantErr:     true,
+		},
+		{
+			desc:        "proxy header",
+			annotations: map[string]string{ServiceAnnotationHealthCheckProxyHeader: "PROXY_V1"},
+			want: func() *healthCheckParams {
+				p := defaults
+				p.proxyHeader = "PROXY_V1"
+				return &p
+			}(),
+		},
+		{
+			desc:        "invalid proxy header",
+			annotations: map[string]string{ServiceAnnotationHealthCheckProxyHeader: "PROXY_V2"},
+			wantErr:     true,
+		},
+		{
+			desc:         "local traffic",
+			annotations:  map[string]string{ServiceAnnotationHealthCheckInterval: "30"},
+			localTraffic: true,
+			wantErr:      true,
+		},
+		{
+			desc: "local traffic request path and proxy header",
+			annotations: map[string]string{
+				ServiceAnnotationHealthCheckRequestPath: "/livez",
+				ServiceAnnotationHealthCheckProxyHeader: "PROXY_V1",
+			},
+			localTraffic: true,
+			want: func() *healthCheckParams {
+				p := defaults
+				p.requestPath = "/livez"
+				p.proxyHeader = "PROXY_V1"
+				return &p
+			}(),
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := fakeLoadbalancerService("")
+			for k, v := range tc.annotations {
+				svc.Annotations[k] = v
+			}
+			if tc.localTraffic {
+				svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+				svc.Spec.HealthCheckNodePort = 30000
+			}
+			p, err := getHealthCheckParams(svc)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, p)
+		})
+	}
+}
+
+func TestEnsureExternalLoadBalancerHealthCheckParams(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.c.(*cloud.MockGCE).MockHttpHealthChecks.UpdateHook = func(ctx context.Context, key *meta.Key, obj *compute.HttpHealthCheck, m *cloud.MockHttpHealthChecks, options ...cloud.Option) error {
+		m.Objects[*key] = &cloud.MockHttpHealthChecksObj{Obj: obj}
+		return nil
+	}
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationHealthCheckInterval] = "4"
+	svc.Annotations[ServiceAnnotationHealthCheckRequestPath] = "/readyz"
+	nodeNames := []string{"test-node-1"}
+
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	hc, err := gce.GetHTTPHealthCheck(lbName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), hc.CheckIntervalSec)
+	assert.Equal(t, "/readyz", hc.RequestPath)
+	assert.Equal(t, int64(GetNodesHealthCheckPort()), hc.Port)
+	tp, err := gce.GetTargetPool(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hc.SelfLink}, tp.HealthChecks)
+	_, err = gce.GetHTTPHealthCheck(MakeNodesHealthCheckName(vals.ClusterID))
+	assert.True(t, isNotFound(err), "nodes health check should not exist, got %v", err)
+
+	// A lower interval than the default is kept as set.
+	svc.Annotations[ServiceAnnotationHealthCheckInterval] = "2"
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	hc, err = gce.GetHTTPHealthCheck(lbName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), hc.CheckIntervalSec)
+}
+
+func TestEnsureInternalLoadBalancerHealthCheckParams(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationHealthCheckUnhealthyThreshold] = "6"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = createInternalLoadBalancer(gce, svc, nil, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	hc, err := gce.GetHealthCheck(lbName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), hc.UnhealthyThreshold)
+	assert.Equal(t, int64(GetNodesHealthCheckPort()), hc.HttpHealthCheck.Port)
+	_, err = gce.GetHealthCheck(makeHealthCheckName(lbName, vals.ClusterID, true))
+	assert.True(t, isNotFound(err), "nodes health check should not exist, got %v", err)
+
+	require.NoError(t, gce.ensureInternalLoadBalancerDeleted(vals.ClusterName, vals.ClusterID, svc))
+	_, err = gce.GetHealthCheck(lbName)
+	assert.True(t, isNotFound(err), "health check should be deleted, got %v", err)
+}
+
+func TestEnsureInternalLoadBalancerLocalTrafficHealthCheckParams(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 30123
+	svc.Annotations[ServiceAnnotationHealthCheckRequestPath] = "/livez"
+	svc.Annotations[ServiceAnnotationHealthCheckProxyHeader] = "PROXY_V1"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = createInternalLoadBalancer(gce, svc, nil, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	hc, err := gce.GetHealthCheck(lbName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30123), hc.HttpHealthCheck.Port)
+	assert.Equal(t, "/livez", hc.HttpHealthCheck.RequestPath)
+	assert.Equal(t, "PROXY_V1", hc.HttpHealthCheck.ProxyHeader)
+
+	// Removing the proxy header annotation resets it.
+	delete(svc.Annotations, ServiceAnnotationHealthCheckProxyHeader)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, fwdRule, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	hc, err = gce.GetHealthCheck(lbName)
+	require.NoError(t, err)
+	assert.Equal(t, healthCheckProxyHeaderNone, healthCheckProxyHeader(hc))
+	assert.Equal(t, "/livez", hc.HttpHealthCheck.RequestPath)
+}
+
+func TestEnsureExternalLoadBalancerLocalTrafficHealthCheckParams(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+	svc := fakeLoadbalancerService("")
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 30123
+	svc.Annotations[ServiceAnnotationHealthCheckRequestPath] = "/livez"
+	svc.Annotations[ServiceAnnotationHealthCheckProxyHeader] = "PROXY_V1"
+
+	_, err = createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	hc, err := gce.GetHTTPHealthCheck(lbName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(30123), hc.Port)
+	assert.Equal(t, "/livez", hc.RequestPath)
+	assert.Contains(t, <-recorder.Events, "HealthCheckProxyHeaderIgnored")
+}
+
+func TestEnsureExternalNEGLoadBalancerHealthCheckParams(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	svc.Annotations[ServiceAnnotationHealthCheckHealthyThreshold] = "3"
+
+	_, err := createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	hc, err := gce.GetRegionHealthCheck(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), hc.HealthyThreshold)
+}
+
+func TestEnsureInternalLoadBalancerHealthCheckLogging(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.healthCheckLogging = true
+
+	// The shared nodes health check follows the cloud config.
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationHealthCheckLogging] = "false"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	hc, err := gce.GetHealthCheck(makeHealthCheckName(lbName, vals.ClusterID, true))
+	require.NoError(t, err)
+	assert.True(t, healthCheckLoggingEnabled(hc))
+
+	// The health check of a Service with local traffic follows its annotation.
+	localSvc := fakeLoadbalancerService(string(LBTypeInternal))
+	localSvc.Name = "local-svc"
+	localSvc.UID = "local-svc-uid"
+	localSvc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyLocal
+	localSvc.Spec.HealthCheckNodePort = 32000
+	localSvc.Annotations[ServiceAnnotationHealthCheckLogging] = "false"
+	localSvc, err = gce.client.CoreV1().Services(localSvc.Namespace).Create(context.TODO(), localSvc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, localSvc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	localLBName := gce.GetLoadBalancerName(context.TODO(), "", localSvc)
+	hc, err = gce.GetHealthCheck(localLBName)
+	require.NoError(t, err)
+	assert.False(t, healthCheckLoggingEnabled(hc))
+
+	// Removing the annotation enables the logging of the existing health check.
+	delete(localSvc.Annotations, ServiceAnnotationHealthCheckLogging)
+	existingFwdRule, err := gce.GetRegionForwardingRule(localLBName, gce.region)
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, localSvc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	hc, err = gce.GetHealthCheck(localLBName)
+	require.NoError(t, err)
+	assert.True(t, healthCheckLoggingEnabled(hc))
+
+	localSvc.Annotations[ServiceAnnotationHealthCheckLogging] = "yes please"
+	_, err = createInternalLoadBalancer(gce, localSvc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	assert.Error(t, err)
+}
+
+func TestEnsureExternalNEGLoadBalancerHealthCheckLogging(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	svc.Annotations[ServiceAnnotationHealthCheckLogging] = "true"
+
+	_, err := createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	hc, err := gce.GetRegionHealthCheck(lbName, gce.region)
+	require.NoError(t, err)
+	assert.True(t, healthCheckLoggingEnabled(hc))
+}
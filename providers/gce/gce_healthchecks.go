@@ -46,6 +46,10 @@ func newHealthcheckMetricContextWithVersion(request, version string) *metricCont
 	return newGenericMetricContext("healthcheck", request, unusedMetricLabel, unusedMetricLabel, version)
 }
 
+func newRegionHealthcheckMetricContext(request, region string) *metricContext {
+	return newGenericMetricContext("healthcheck", request, region, unusedMetricLabel, computeV1Version)
+}
+
 // GetHTTPHealthCheck returns the given HttpHealthCheck by name.
 func (g *Cloud) GetHTTPHealthCheck(name string) (*compute.HttpHealthCheck, error) {
 	ctx, cancel := cloud.ContextWithCallTimeout()
@@ -61,8 +65,12 @@ func (g *Cloud) UpdateHTTPHealthCheck(hc *compute.HttpHealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "HTTP health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "HTTP health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContext("update_legacy")
-	return mc.Observe(g.c.HttpHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.HttpHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // DeleteHTTPHealthCheck deletes the given HttpHealthCheck by name.
@@ -70,8 +78,12 @@ func (g *Cloud) DeleteHTTPHealthCheck(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "HTTP health check", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "HTTP health check", meta.GlobalKey(name), nil)
 	mc := newHealthcheckMetricContext("delete_legacy")
-	return mc.Observe(g.c.HttpHealthChecks().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.HttpHealthChecks().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // CreateHTTPHealthCheck creates the given HttpHealthCheck.
@@ -79,8 +91,12 @@ func (g *Cloud) CreateHTTPHealthCheck(hc *compute.HttpHealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "HTTP health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "HTTP health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContext("create_legacy")
-	return mc.Observe(g.c.HttpHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.HttpHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // ListHTTPHealthChecks lists all HttpHealthChecks in the project.
@@ -110,8 +126,12 @@ func (g *Cloud) UpdateHTTPSHealthCheck(hc *compute.HttpsHealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "HTTPS health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "HTTPS health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContext("update_legacy")
-	return mc.Observe(g.c.HttpsHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.HttpsHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // DeleteHTTPSHealthCheck deletes the given HttpsHealthCheck by name.
@@ -119,8 +139,12 @@ func (g *Cloud) DeleteHTTPSHealthCheck(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "HTTPS health check", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "HTTPS health check", meta.GlobalKey(name), nil)
 	mc := newHealthcheckMetricContext("delete_legacy")
-	return mc.Observe(g.c.HttpsHealthChecks().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.HttpsHealthChecks().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // CreateHTTPSHealthCheck creates the given HttpsHealthCheck.
@@ -128,8 +152,12 @@ func (g *Cloud) CreateHTTPSHealthCheck(hc *compute.HttpsHealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "HTTPS health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "HTTPS health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContext("create_legacy")
-	return mc.Observe(g.c.HttpsHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.HttpsHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // ListHTTPSHealthChecks lists all HttpsHealthChecks in the project.
@@ -179,8 +207,12 @@ func (g *Cloud) UpdateHealthCheck(hc *compute.HealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContext("update")
-	return mc.Observe(g.c.HealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.HealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // UpdateAlphaHealthCheck applies the given alpha HealthCheck as an update.
@@ -188,8 +220,12 @@ func (g *Cloud) UpdateAlphaHealthCheck(hc *computealpha.HealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContextWithVersion("update", computeAlphaVersion)
-	return mc.Observe(g.c.AlphaHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.AlphaHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // UpdateBetaHealthCheck applies the given beta HealthCheck as an update.
@@ -197,8 +233,12 @@ func (g *Cloud) UpdateBetaHealthCheck(hc *computebeta.HealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContextWithVersion("update", computeBetaVersion)
-	return mc.Observe(g.c.BetaHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.BetaHealthChecks().Update(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // DeleteHealthCheck deletes the given HealthCheck by name.
@@ -206,8 +246,12 @@ func (g *Cloud) DeleteHealthCheck(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "health check", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "health check", meta.GlobalKey(name), nil)
 	mc := newHealthcheckMetricContext("delete")
-	return mc.Observe(g.c.HealthChecks().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.HealthChecks().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // CreateHealthCheck creates the given HealthCheck.
@@ -215,8 +259,12 @@ func (g *Cloud) CreateHealthCheck(hc *compute.HealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContext("create")
-	return mc.Observe(g.c.HealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.HealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // CreateAlphaHealthCheck creates the given alpha HealthCheck.
@@ -224,8 +272,12 @@ func (g *Cloud) CreateAlphaHealthCheck(hc *computealpha.HealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContextWithVersion("create", computeAlphaVersion)
-	return mc.Observe(g.c.AlphaHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.AlphaHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // CreateBetaHealthCheck creates the given beta HealthCheck.
@@ -233,8 +285,12 @@ func (g *Cloud) CreateBetaHealthCheck(hc *computebeta.HealthCheck) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "health check", meta.GlobalKey(hc.Name), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "health check", meta.GlobalKey(hc.Name), hc)
 	mc := newHealthcheckMetricContextWithVersion("create", computeBetaVersion)
-	return mc.Observe(g.c.BetaHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc))
+	return mc.Observe(audit(g.c.BetaHealthChecks().Insert(ctx, meta.GlobalKey(hc.Name), hc)))
 }
 
 // ListHealthChecks lists all HealthCheck in the project.
@@ -247,6 +303,57 @@ func (g *Cloud) ListHealthChecks() ([]*compute.HealthCheck, error) {
 	return v, mc.Observe(err)
 }
 
+// Region HealthCheck
+
+// GetRegionHealthCheck returns the given regional HealthCheck by name.
+func (g *Cloud) GetRegionHealthCheck(name, region string) (*compute.HealthCheck, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	mc := newRegionHealthcheckMetricContext("get", region)
+	v, err := g.c.RegionHealthChecks().Get(ctx, meta.RegionalKey(name, region))
+	return v, mc.Observe(err)
+}
+
+// UpdateRegionHealthCheck applies the given regional HealthCheck as an update.
+func (g *Cloud) UpdateRegionHealthCheck(hc *compute.HealthCheck, region string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	if g.skipMutation("update", "region health check", meta.RegionalKey(hc.Name, region), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "region health check", meta.RegionalKey(hc.Name, region), hc)
+	mc := newRegionHealthcheckMetricContext("update", region)
+	return mc.Observe(audit(g.c.RegionHealthChecks().Update(ctx, meta.RegionalKey(hc.Name, region), hc)))
+}
+
+// DeleteRegionHealthCheck deletes the given regional HealthCheck by name.
+func (g *Cloud) DeleteRegionHealthCheck(name, region string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	if g.skipMutation("delete", "region health check", meta.RegionalKey(name, region), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "region health check", meta.RegionalKey(name, region), nil)
+	mc := newRegionHealthcheckMetricContext("delete", region)
+	return mc.Observe(audit(g.c.RegionHealthChecks().Delete(ctx, meta.RegionalKey(name, region))))
+}
+
+// CreateRegionHealthCheck creates the given regional HealthCheck.
+func (g *Cloud) CreateRegionHealthCheck(hc *compute.HealthCheck, region string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	if g.skipMutation("insert", "region health check", meta.RegionalKey(hc.Name, region), hc) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "region health check", meta.RegionalKey(hc.Name, region), hc)
+	mc := newRegionHealthcheckMetricContext("create", region)
+	return mc.Observe(audit(g.c.RegionHealthChecks().Insert(ctx, meta.RegionalKey(hc.Name, region), hc)))
+}
+
 // GetNodesHealthCheckPort returns the health check port used by the GCE load
 // balancers (l4) for performing health checks on nodes.
 func GetNodesHealthCheckPort() int32 {
@@ -37,8 +37,12 @@ func (g *Cloud) CreateInstanceGroup(ig *compute.InstanceGroup, zone string) erro
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "instance group", meta.ZonalKey(ig.Name, zone), ig) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "instance group", meta.ZonalKey(ig.Name, zone), ig)
 	mc := newInstanceGroupMetricContext("create", zone)
-	return mc.Observe(g.c.InstanceGroups().Insert(ctx, meta.ZonalKey(ig.Name, zone), ig))
+	return mc.Observe(audit(g.c.InstanceGroups().Insert(ctx, meta.ZonalKey(ig.Name, zone), ig)))
 }
 
 // DeleteInstanceGroup deletes an instance group.
@@ -46,8 +50,12 @@ func (g *Cloud) DeleteInstanceGroup(name string, zone string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "instance group", meta.ZonalKey(name, zone), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "instance group", meta.ZonalKey(name, zone), nil)
 	mc := newInstanceGroupMetricContext("delete", zone)
-	return mc.Observe(g.c.InstanceGroups().Delete(ctx, meta.ZonalKey(name, zone)))
+	return mc.Observe(audit(g.c.InstanceGroups().Delete(ctx, meta.ZonalKey(name, zone))))
 }
 
 // FilterInstanceGroupsByName lists all InstanceGroups in the project and
@@ -97,7 +105,11 @@ func (g *Cloud) AddInstancesToInstanceGroup(name string, zone string, instanceRe
 	req := &compute.InstanceGroupsAddInstancesRequest{
 		Instances: instanceRefs,
 	}
-	return mc.Observe(g.c.InstanceGroups().AddInstances(ctx, meta.ZonalKey(name, zone), req))
+	if g.skipMutation("add instances to", "instance group", meta.ZonalKey(name, zone), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "add instances to", "instance group", meta.ZonalKey(name, zone), req)
+	return mc.Observe(audit(g.c.InstanceGroups().AddInstances(ctx, meta.ZonalKey(name, zone), req)))
 }
 
 // RemoveInstancesFromInstanceGroup removes the given instances from
@@ -114,7 +126,11 @@ func (g *Cloud) RemoveInstancesFromInstanceGroup(name string, zone string, insta
 	req := &compute.InstanceGroupsRemoveInstancesRequest{
 		Instances: instanceRefs,
 	}
-	return mc.Observe(g.c.InstanceGroups().RemoveInstances(ctx, meta.ZonalKey(name, zone), req))
+	if g.skipMutation("remove instances from", "instance group", meta.ZonalKey(name, zone), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "remove instances from", "instance group", meta.ZonalKey(name, zone), req)
+	return mc.Observe(audit(g.c.InstanceGroups().RemoveInstances(ctx, meta.ZonalKey(name, zone), req)))
 }
 
 // SetNamedPortsOfInstanceGroup sets the list of named ports on a given instance group
@@ -124,7 +140,11 @@ func (g *Cloud) SetNamedPortsOfInstanceGroup(igName, zone string, namedPorts []*
 
 	mc := newInstanceGroupMetricContext("set_namedports", zone)
 	req := &compute.InstanceGroupsSetNamedPortsRequest{NamedPorts: namedPorts}
-	return mc.Observe(g.c.InstanceGroups().SetNamedPorts(ctx, meta.ZonalKey(igName, zone), req))
+	if g.skipMutation("set named ports of", "instance group", meta.ZonalKey(igName, zone), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "set named ports of", "instance group", meta.ZonalKey(igName, zone), req)
+	return mc.Observe(audit(g.c.InstanceGroups().SetNamedPorts(ctx, meta.ZonalKey(igName, zone), req)))
 }
 
 // GetInstanceGroup returns an instance group by name.
@@ -24,10 +24,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
+	"go.opentelemetry.io/otel/attribute"
 	computebeta "google.golang.org/api/compute/v0.beta"
 	compute "google.golang.org/api/compute/v1"
 	"k8s.io/klog/v2"
@@ -49,6 +51,11 @@ const (
 	networkInterfaceIPV6          = "instance/network-interfaces/%s/ipv6s"
 	networkInterfaceAccessConfigs = "instance/network-interfaces/%s/access-configs"
 	networkInterfaceExternalIP    = "instance/network-interfaces/%s/access-configs/%s/external-ip"
+
+	// NodeLabelOmitExternalIP is set to "true" on the Nodes, e.g. of a node
+	// pool, whose ExternalIP addresses must not be reported even if their
+	// instance has one, such as a temporary external IP used for bootstrapping.
+	NodeLabelOmitExternalIP = "cloud.google.com/omit-external-ip"
 )
 
 func newInstancesMetricContext(request, zone string) *metricContext {
@@ -138,14 +145,16 @@ func (g *Cloud) NodeAddresses(ctx context.Context, nodeName types.NodeName) ([]v
 				return nil, fmt.Errorf("couldn't get network interfaces: %v", err)
 			}
 
-			nicsArr := strings.Split(nics, "/\n")
+			var nicsArr []string
+			for _, nic := range strings.Split(nics, "/\n") {
+				if nic != "" {
+					nicsArr = append(nicsArr, nic)
+				}
+			}
 			nodeAddresses := []v1.NodeAddress{}
 
-			for _, nic := range nicsArr {
-
-				if nic == "" {
-					continue
-				}
+			for _, i := range g.nodeAddressNICs(len(nicsArr), func(i int) string { return "nic" + nicsArr[i] }) {
+				nic := nicsArr[i]
 
 				internalIP, err := metadata.Get(fmt.Sprintf(networkInterfaceIP, nic))
 				if err != nil {
@@ -222,7 +231,7 @@ func (g *Cloud) NodeAddresses(ctx context.Context, nodeName types.NodeName) ([]v
 		return nil, fmt.Errorf("couldn't get instance details: %v", err)
 	}
 
-	instance, err := g.c.Instances().Get(timeoutCtx, meta.ZonalKey(canonicalizeInstanceName(instanceObj.Name), instanceObj.Zone))
+	instance, err := g.getInstance(timeoutCtx, meta.ZonalKey(canonicalizeInstanceName(instanceObj.Name), instanceObj.Zone))
 	if err != nil {
 		return nil, fmt.Errorf("error while querying for instance: %v", err)
 	}
@@ -241,7 +250,7 @@ func (g *Cloud) NodeAddressesByProviderID(ctx context.Context, providerID string
 		return []v1.NodeAddress{}, err
 	}
 
-	instance, err := g.c.Instances().Get(timeoutCtx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
+	instance, err := g.getInstance(timeoutCtx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
 	if err != nil {
 		return []v1.NodeAddress{}, fmt.Errorf("error while querying for providerID %q: %v", providerID, err)
 	}
@@ -283,7 +292,14 @@ func (g *Cloud) nodeAddressesFromInstance(instance *compute.Instance) ([]v1.Node
 		return nil, fmt.Errorf("could not find network interfaces for instanceID %q", instance.Id)
 	}
 	nodeAddresses := []v1.NodeAddress{}
-	for _, nic := range instance.NetworkInterfaces {
+	nicName := func(i int) string {
+		if name := instance.NetworkInterfaces[i].Name; name != "" {
+			return name
+		}
+		return fmt.Sprintf("nic%d", i)
+	}
+	for _, i := range g.nodeAddressNICs(len(instance.NetworkInterfaces), nicName) {
+		nic := instance.NetworkInterfaces[i]
 		if nic.NetworkIP != "" {
 			nodeAddresses = append(nodeAddresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: nic.NetworkIP})
 		}
@@ -295,8 +311,84 @@ func (g *Cloud) nodeAddressesFromInstance(instance *compute.Instance) ([]v1.Node
 			nodeAddresses = append(nodeAddresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ipv6Addr})
 		}
 	}
+	nodeAddresses = g.orderAddresses(nodeAddresses)
+	if dnsName := g.instanceInternalDNSName(instance); dnsName != "" {
+		nodeAddresses = append(nodeAddresses, v1.NodeAddress{Type: v1.NodeInternalDNS, Address: dnsName})
+	}
 
-	return g.orderAddresses(nodeAddresses), nil
+	return nodeAddresses, nil
+}
+
+// instanceInternalDNSName returns the internal DNS name of the instance, as
+// its metadata server reports it: its custom hostname if it has one, else its
+// zonal DNS name INSTANCE.ZONE.c.PROJECT.internal, where the project ID of
+// domain-scoped projects DOMAIN:PROJECT is written PROJECT.DOMAIN.
+func (g *Cloud) instanceInternalDNSName(instance *compute.Instance) string {
+	if instance.Hostname != "" {
+		return instance.Hostname
+	}
+	zone := lastComponent(instance.Zone)
+	if instance.Name == "" || zone == "" {
+		return ""
+	}
+	project := g.projectID
+	if domain, name, ok := strings.Cut(project, ":"); ok {
+		project = name + "." + domain
+	}
+	return fmt.Sprintf("%s.%s.c.%s.internal", instance.Name, zone, project)
+}
+
+// nicNameRegexp matches the names of the network interfaces of instances.
+var nicNameRegexp = regexp.MustCompile(`^nic[0-9]+$`)
+
+// nodeAddressNICs returns the indexes of the count network interfaces whose
+// addresses are reported, named by name: all of them in order unless the
+// node-address-network-interface list of the cloud config selects and orders
+// them, e.g. nic1 then nic0 on nodes whose Pod network is on nic1.
+func (g *Cloud) nodeAddressNICs(count int, name func(int) string) []int {
+	var indexes []int
+	if len(g.nodeAddressNetworkInterfaces) == 0 {
+		for i := 0; i < count; i++ {
+			indexes = append(indexes, i)
+		}
+		return indexes
+	}
+	for _, want := range g.nodeAddressNetworkInterfaces {
+		for i := 0; i < count; i++ {
+			if name(i) == want {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// validateNodeAddressNetworkInterfaces validates the
+// node-address-network-interface list of the cloud config.
+func validateNodeAddressNetworkInterfaces(names []string) error {
+	seen := sets.NewString()
+	for _, name := range names {
+		if !nicNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid node-address-network-interface %q, must be a network interface name such as nic0", name)
+		}
+		if seen.Has(name) {
+			return fmt.Errorf("duplicate node-address-network-interface %q", name)
+		}
+		seen.Insert(name)
+	}
+	return nil
+}
+
+// withoutExternalIPs returns the addresses that are not of type ExternalIP.
+func withoutExternalIPs(addresses []v1.NodeAddress) []v1.NodeAddress {
+	var filtered []v1.NodeAddress
+	for _, address := range addresses {
+		if address.Type != v1.NodeExternalIP {
+			filtered = append(filtered, address)
+		}
+	}
+	return filtered
 }
 
 func getIPV6AddressFromInterface(nic *compute.NetworkInterface) string {
@@ -325,6 +417,17 @@ func (g *Cloud) InstanceTypeByProviderID(ctx context.Context, providerID string)
 // InstanceExistsByProviderID returns true if the instance with the given provider id still exists and is running.
 // If false is returned with no error, the instance will be immediately deleted by the cloud controller manager.
 func (g *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID string) (bool, error) {
+	// The instances of the cluster project are checked against the list of
+	// their zone, and only looked up if they are not in it.
+	if project, zone, name, err := splitProviderID(providerID); err == nil && project == g.projectID {
+		listed, err := g.instanceListed(zone, canonicalizeInstanceName(name))
+		if err != nil {
+			klog.V(4).Infof("Failed to list the instances of zone %s, looking up %s: %v", zone, providerID, err)
+		} else if listed {
+			return true, nil
+		}
+	}
+
 	_, err := g.instanceByProviderID(providerID)
 	if err != nil {
 		if err == cloudprovider.InstanceNotFound {
@@ -339,30 +442,53 @@ func (g *Cloud) InstanceExistsByProviderID(ctx context.Context, providerID strin
 // InstanceExists returns true if the instance with the given provider id still exists and is running.
 // If false is returned with no error, the instance will be immediately deleted by the cloud controller manager.
 func (g *Cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
-	providerID := node.Spec.ProviderID
-	if providerID == "" {
-		var err error
-		if providerID, err = cloudprovider.GetInstanceProviderID(ctx, g, types.NodeName(node.Name)); err != nil {
-			if err == cloudprovider.InstanceNotFound {
-				return false, nil
-			}
-			return false, err
+	ctx, endSpan := startSpan(ctx, "InstanceExists", attribute.String("node.name", node.Name))
+	exists, err := g.instanceExists(ctx, node)
+	endSpan(err)
+	g.syncHealth.record(SyncLoopNodeLifecycle, err)
+	if g.AlphaFeatureGate.Enabled(AlphaFeatureNodeCloudUnverifiedQuarantine) && (exists || err != nil) {
+		g.updateNodeQuarantine(ctx, node, err)
+	}
+	return exists, err
+}
+
+func (g *Cloud) instanceExists(ctx context.Context, node *v1.Node) (bool, error) {
+	providerID, err := g.nodeProviderID(ctx, node)
+	if err != nil {
+		if err == cloudprovider.InstanceNotFound {
+			return false, nil
 		}
+		return false, err
 	}
-	return g.InstanceExistsByProviderID(ctx, providerID)
+	exists, err := g.InstanceExistsByProviderID(ctx, providerID)
+	if err != nil || !exists || !g.AlphaFeatureGate.Enabled(AlphaFeatureDeletePreemptedNodes) {
+		return exists, err
+	}
+	return !g.nodeInstancePreempted(ctx, node, providerID), nil
 }
 
 // InstanceMetadata returns metadata of the specified instance.
 func (g *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
+	ctx, endSpan := startSpan(ctx, "InstanceMetadata", attribute.String("node.name", node.Name))
+	md, err := g.instanceMetadata(ctx, node)
+	endSpan(err)
+	g.syncHealth.record(SyncLoopNode, err)
+	// The node lifecycle controller only checks the existence of the
+	// instances of NotReady Nodes, so the quarantine of the Nodes which got
+	// Ready again is lifted once their instance is seen here.
+	if err == nil && g.AlphaFeatureGate.Enabled(AlphaFeatureNodeCloudUnverifiedQuarantine) {
+		g.updateNodeQuarantine(ctx, node, nil)
+	}
+	return md, err
+}
+
+func (g *Cloud) instanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
 	timeoutCtx, cancel := context.WithTimeout(ctx, 1*time.Hour)
 	defer cancel()
 
-	providerID := node.Spec.ProviderID
-	if providerID == "" {
-		var err error
-		if providerID, err = cloudprovider.GetInstanceProviderID(ctx, g, types.NodeName(node.Name)); err != nil {
-			return nil, err
-		}
+	providerID, err := g.nodeProviderID(ctx, node)
+	if err != nil {
+		return nil, err
 	}
 
 	_, zone, name, err := splitProviderID(providerID)
@@ -377,7 +503,7 @@ func (g *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprov
 
 	var addresses []v1.NodeAddress
 	var instanceType string
-	instance, err := g.c.Instances().Get(timeoutCtx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
+	instance, err := g.getInstance(timeoutCtx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
 	if err != nil {
 		return nil, fmt.Errorf("error while querying for providerID %q: %v", providerID, err)
 	}
@@ -386,6 +512,9 @@ func (g *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprov
 	if err != nil {
 		return nil, err
 	}
+	if node.Labels[NodeLabelOmitExternalIP] == "true" {
+		addresses = withoutExternalIPs(addresses)
+	}
 
 	instanceType = lastComponent(instance.MachineType)
 
@@ -473,6 +602,9 @@ func (g *Cloud) AddSSHKeyToAllInstances(ctx context.Context, user string, keyDat
 				})
 		}
 
+		if g.skipMutation("set common instance metadata of", "project", meta.GlobalKey(g.projectID), project.CommonInstanceMetadata) {
+			return true, nil
+		}
 		mc := newInstancesMetricContext("add_ssh_key", "")
 		err = g.c.Projects().SetCommonInstanceMetadata(ctx, g.projectID, project.CommonInstanceMetadata)
 		mc.Observe(err)
@@ -517,13 +649,13 @@ func (g *Cloud) GetAllZonesFromCloudProvider() (sets.String, error) {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	instances, err := g.listZoneInstances(ctx, g.getManagedZones(), filter.None, instanceNameFields)
+	if err != nil {
+		return sets.NewString(), err
+	}
 	zones := sets.NewString()
-	for _, zone := range g.managedZones {
-		instances, err := g.c.Instances().List(ctx, zone, filter.None)
-		if err != nil {
-			return sets.NewString(), err
-		}
-		if len(instances) > 0 {
+	for zone, list := range instances {
+		if len(list) > 0 {
 			zones.Insert(zone)
 		}
 	}
@@ -535,6 +667,9 @@ func (g *Cloud) InsertInstance(project string, zone string, i *compute.Instance)
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "instance", meta.ZonalKey(i.Name, zone), i) {
+		return nil
+	}
 	mc := newInstancesMetricContext("create", zone)
 	return mc.Observe(g.c.Instances().Insert(ctx, meta.ZonalKey(i.Name, zone), i))
 }
@@ -562,18 +697,25 @@ func (g *Cloud) DeleteInstance(project, zone, name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "instance", meta.ZonalKey(name, zone), nil) {
+		return nil
+	}
 	return g.c.Instances().Delete(ctx, meta.ZonalKey(name, zone))
 }
 
 // CurrentNodeName returns the name of the node we are currently running on
-// On most clouds (e.g. GCE) this is the hostname, so we provide the hostname
+// On most clouds (e.g. GCE) this is the hostname, so we provide the hostname,
+// lowercased like the kubelet does for the uppercase hostnames of Windows
+// Server nodes.
 func (g *Cloud) CurrentNodeName(ctx context.Context, hostname string) (types.NodeName, error) {
-	return types.NodeName(hostname), nil
+	return types.NodeName(strings.ToLower(hostname)), nil
 }
 
 // AliasRangesByProviderID returns a list of CIDR ranges that are assigned to the
 // `node` for allocation to pods. Returns a list of the form
-// "<ip>/<netmask>".
+// "<ip>/<netmask>". The ranges are read from the instance, so Linux and
+// Windows Server nodes are handled alike; configuring the ranges on the
+// network adapter of Windows nodes is left to the node.
 func (g *Cloud) AliasRangesByProviderID(providerID string) (cidrs []string, err error) {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
@@ -601,6 +743,95 @@ func (g *Cloud) AliasRangesByProviderID(providerID string) (cidrs []string, err
 	return
 }
 
+// instanceNetworkInterfacesFields is the field mask of the instances listed
+// by ListInstanceNetworkInterfaces.
+const instanceNetworkInterfacesFields = "items/*/instances(name,zone,networkInterfaces),nextPageToken"
+
+// ListInstanceNetworkInterfaces returns the instances of the managed zones
+// named with the node instance prefix by providerID, with only their name,
+// zone and network interfaces. They are read by a single aggregated list of
+// the project, which is much cheaper than getting each of them in projects of
+// many instances, with the service of g.c like listZoneInstances.
+func (g *Cloud) ListInstanceNetworkInterfaces(ctx context.Context) (map[string]*compute.Instance, error) {
+	mc := newInstancesMetricContext("aggregated_list", "")
+	zones := sets.NewString(g.getManagedZones()...)
+	f := filter.None
+	if prefix := g.getNodeInstancePrefix(); prefix != "" {
+		f = filter.Regexp("name", prefix+".*")
+	}
+	projectID, observe, err := g.rateLimitCall(ctx, "Instances", "AggregatedList")
+	if err != nil {
+		return nil, mc.Observe(err)
+	}
+	call := g.s.GA.Instances.AggregatedList(projectID).Filter(zonesFilter(zones.List(), f).String()).Fields(instanceNetworkInterfacesFields).ReturnPartialSuccess(true)
+	instances := map[string]*compute.Instance{}
+	err = call.Pages(ctx, func(page *compute.InstanceAggregatedList) error {
+		for _, scoped := range page.Items {
+			for _, instance := range scoped.Instances {
+				zone := lastComponent(instance.Zone)
+				if !zones.Has(zone) {
+					continue
+				}
+				instances[fmt.Sprintf("%s://%s/%s/%s", ProviderName, g.projectID, zone, instance.Name)] = instance
+			}
+		}
+		return nil
+	})
+	observe(err)
+	if err != nil {
+		return nil, mc.Observe(err)
+	}
+	return instances, mc.Observe(nil)
+}
+
+// ListNodeInstanceGroupInstanceNetworkInterfaces returns the instances of
+// ListInstanceNetworkInterfaces which are members of the instance groups of
+// the managed zones named with the node instance prefix, i.e. the instance
+// groups of the nodes of the cluster, so that instances of other clusters or
+// workloads sharing the project are left out. The node instance prefix is
+// required.
+func (g *Cloud) ListNodeInstanceGroupInstanceNetworkInterfaces(ctx context.Context) (map[string]*compute.Instance, error) {
+	prefix := g.getNodeInstancePrefix()
+	if prefix == "" {
+		return nil, fmt.Errorf("the node instance prefix of the cloud config is not set")
+	}
+	members := sets.NewString()
+	for _, zone := range g.getManagedZones() {
+		mc := newInstanceGroupMetricContext("list", zone)
+		groups, err := g.c.InstanceGroups().List(ctx, zone, filter.Regexp("name", prefix+".*"))
+		if mc.Observe(err) != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			mc := newInstanceGroupMetricContext("list_instances", zone)
+			req := &compute.InstanceGroupsListInstancesRequest{InstanceState: allInstances}
+			instances, err := g.c.InstanceGroups().ListInstances(ctx, meta.ZonalKey(group.Name, zone), req, filter.None)
+			if mc.Observe(err) != nil {
+				return nil, err
+			}
+			for _, instance := range instances {
+				members.Insert(hostURLToComparablePath(instance.Instance))
+			}
+		}
+	}
+
+	instances, err := g.ListInstanceNetworkInterfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for providerID := range instances {
+		_, zone, name, err := splitProviderID(providerID)
+		if err != nil {
+			return nil, err
+		}
+		host := &gceInstance{Zone: zone, Name: name}
+		if !members.Has(host.makeComparableHostPath()) {
+			delete(instances, providerID)
+		}
+	}
+	return instances, nil
+}
+
 // GetIPV6Address fetches the IPv6 addressses associated with a network interface.
 func (g *Cloud) GetIPV6Address(networkInterface *compute.NetworkInterface) *net.IPNet {
 	ipv6Addr := getIPV6AddressFromInterface(networkInterface)
@@ -620,6 +851,12 @@ func (g *Cloud) GetIPV6Address(networkInterface *compute.NetworkInterface) *net.
 // AddAliasToInstanceByProviderID adds an alias to the given instance from the named
 // secondary range.
 func (g *Cloud) AddAliasToInstanceByProviderID(providerID string, alias *net.IPNet) error {
+	return g.AddAliasFromRangeToInstanceByProviderID(providerID, alias, g.secondaryRangeName)
+}
+
+// AddAliasFromRangeToInstanceByProviderID adds an alias to the given instance
+// from the given secondary range, e.g. one chosen by an external IPAM service.
+func (g *Cloud) AddAliasFromRangeToInstanceByProviderID(providerID string, alias *net.IPNet, rangeName string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
@@ -647,11 +884,58 @@ func (g *Cloud) AddAliasToInstanceByProviderID(providerID string, alias *net.IPN
 	iface.Fingerprint = instance.NetworkInterfaces[0].Fingerprint
 	iface.AliasIpRanges = append(iface.AliasIpRanges, &computebeta.AliasIpRange{
 		IpCidrRange:         alias.String(),
-		SubnetworkRangeName: g.secondaryRangeName,
+		SubnetworkRangeName: rangeName,
 	})
 
+	key := meta.ZonalKey(instance.Name, lastComponent(instance.Zone))
+	if g.skipMutation("update network interface of", "instance", key, iface) {
+		return nil
+	}
 	mc := newInstancesMetricContext("add_alias", zone)
-	err = g.c.BetaInstances().UpdateNetworkInterface(ctx, meta.ZonalKey(instance.Name, lastComponent(instance.Zone)), iface.Name, iface)
+	err = g.c.BetaInstances().UpdateNetworkInterface(ctx, key, iface.Name, iface)
+	g.invalidateInstance(key)
+	return mc.Observe(err)
+}
+
+// ExpandAliasIPRangesByProviderID appends an alias IP range of the mask size,
+// which GCE allocates from the named secondary range, to the alias IP ranges
+// of the first network interface of the given instance.
+func (g *Cloud) ExpandAliasIPRangesByProviderID(providerID, rangeName string, maskSize int) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	_, zone, name, err := splitProviderID(providerID)
+	if err != nil {
+		return err
+	}
+
+	instance, err := g.c.BetaInstances().Get(ctx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
+	if err != nil {
+		return err
+	}
+	if len(instance.NetworkInterfaces) == 0 {
+		return fmt.Errorf("instance %q has no network interfaces", providerID)
+	}
+
+	// The alias IP ranges of the interface are replaced by the ones of the
+	// update, which must keep the existing ones.
+	nic := instance.NetworkInterfaces[0]
+	iface := &computebeta.NetworkInterface{}
+	iface.Name = nic.Name
+	iface.Fingerprint = nic.Fingerprint
+	iface.AliasIpRanges = append(iface.AliasIpRanges, nic.AliasIpRanges...)
+	iface.AliasIpRanges = append(iface.AliasIpRanges, &computebeta.AliasIpRange{
+		IpCidrRange:         fmt.Sprintf("/%d", maskSize),
+		SubnetworkRangeName: rangeName,
+	})
+
+	key := meta.ZonalKey(instance.Name, lastComponent(instance.Zone))
+	if g.skipMutation("update network interface of", "instance", key, iface) {
+		return nil
+	}
+	mc := newInstancesMetricContext("expand_alias", zone)
+	err = g.c.BetaInstances().UpdateNetworkInterface(ctx, key, iface.Name, iface)
+	g.invalidateInstance(key)
 	return mc.Observe(err)
 }
 
@@ -681,25 +965,27 @@ func (g *Cloud) getFoundInstanceByNames(names []string) ([]*gceInstance, error)
 	found := map[string]*gceInstance{}
 	remaining := len(names)
 
-	nodeInstancePrefix := g.nodeInstancePrefix
+	configuredPrefix := g.getNodeInstancePrefix()
+	nodeInstancePrefix := configuredPrefix
 	for _, name := range names {
 		name = canonicalizeInstanceName(name)
-		if !strings.HasPrefix(name, g.nodeInstancePrefix) {
-			klog.Warningf("Instance %q does not conform to prefix %q, removing filter", name, g.nodeInstancePrefix)
+		if !strings.HasPrefix(name, configuredPrefix) {
+			klog.Warningf("Instance %q does not conform to prefix %q, removing filter", name, configuredPrefix)
 			nodeInstancePrefix = ""
 		}
 		found[name] = nil
 	}
 
-	for _, zone := range g.managedZones {
+	zones := g.getManagedZones()
+	instancesByZone, err := g.listZoneInstances(ctx, zones, filter.Regexp("name", nodeInstancePrefix+".*"), instanceHostFields)
+	if err != nil {
+		return nil, err
+	}
+	for _, zone := range zones {
 		if remaining == 0 {
 			break
 		}
-		instances, err := g.c.Instances().List(ctx, zone, filter.Regexp("name", nodeInstancePrefix+".*"))
-		if err != nil {
-			return nil, err
-		}
-		for _, inst := range instances {
+		for _, inst := range instancesByZone[zone] {
 			if remaining == 0 {
 				break
 			}
@@ -740,7 +1026,7 @@ func (g *Cloud) getFoundInstanceByNames(names []string) ([]*gceInstance, error)
 // Gets the named instance, returning cloudprovider.InstanceNotFound if the instance is not found
 func (g *Cloud) getInstanceByName(name string) (*gceInstance, error) {
 	// Avoid changing behaviour when not managing multiple zones
-	for _, zone := range g.managedZones {
+	for _, zone := range g.getManagedZones() {
 		instance, err := g.getInstanceFromProjectInZoneByName(g.projectID, zone, name)
 		if err != nil {
 			if isHTTPErrorCode(err, http.StatusNotFound) {
@@ -761,7 +1047,7 @@ func (g *Cloud) getInstanceFromProjectInZoneByName(project, zone, name string) (
 
 	name = canonicalizeInstanceName(name)
 	mc := newInstancesMetricContext("get", zone)
-	res, err := g.c.Instances().Get(ctx, meta.ZonalKey(name, zone))
+	res, err := g.getInstance(ctx, meta.ZonalKey(name, zone))
 	mc.Observe(err)
 	if err != nil {
 		return nil, err
@@ -825,10 +1111,11 @@ func (g *Cloud) computeHostTags(hosts []*gceInstance) ([]string, error) {
 
 	// TODO: We could store the tags in gceInstance, so we could have already fetched it
 	hostNamesByZone := make(map[string]map[string]bool) // map of zones -> map of names -> bool (for easy lookup)
-	nodeInstancePrefix := g.nodeInstancePrefix
+	configuredPrefix := g.getNodeInstancePrefix()
+	nodeInstancePrefix := configuredPrefix
 	for _, host := range hosts {
-		if !strings.HasPrefix(host.Name, g.nodeInstancePrefix) {
-			klog.Warningf("instance %v does not conform to prefix '%s', ignoring filter", host, g.nodeInstancePrefix)
+		if !strings.HasPrefix(host.Name, configuredPrefix) {
+			klog.Warningf("instance %v does not conform to prefix '%s', ignoring filter", host, configuredPrefix)
 			nodeInstancePrefix = ""
 		}
 
@@ -846,12 +1133,12 @@ func (g *Cloud) computeHostTags(hosts []*gceInstance) ([]string, error) {
 	if nodeInstancePrefix != "" {
 		filt = filter.Regexp("name", nodeInstancePrefix+".*")
 	}
+	instancesByZone, err := g.listZoneInstances(ctx, sets.StringKeySet(hostNamesByZone).List(), filt, instanceTagsFields)
+	if err != nil {
+		return nil, err
+	}
 	for zone, hostNames := range hostNamesByZone {
-		instances, err := g.c.Instances().List(ctx, zone, filt)
-		if err != nil {
-			return nil, err
-		}
-		for _, instance := range instances {
+		for _, instance := range instancesByZone[zone] {
 			if !hostNames[instance.Name] {
 				continue
 			}
@@ -879,8 +1166,8 @@ func (g *Cloud) computeHostTags(hosts []*gceInstance) ([]string, error) {
 // of hostnames has not changed, a cached set of nodetags are returned.
 func (g *Cloud) GetNodeTags(nodeNames []string) ([]string, error) {
 	// If nodeTags were specified through configuration, use them
-	if len(g.nodeTags) > 0 {
-		return g.nodeTags, nil
+	if nodeTags := g.getNodeTags(); len(nodeTags) > 0 {
+		return nodeTags, nil
 	}
 
 	g.computeNodeTagLock.Lock()
@@ -914,13 +1201,18 @@ func (g *Cloud) GetNodeTags(nodeNames []string) ([]string, error) {
 func (g *Cloud) InstanceByProviderID(providerID string) (res *compute.Instance, err error) {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
+	return g.InstanceByProviderIDWithContext(ctx, providerID)
+}
 
+// InstanceByProviderIDWithContext is InstanceByProviderID making the call with
+// ctx, e.g. to trace it as part of the span of ctx.
+func (g *Cloud) InstanceByProviderIDWithContext(ctx context.Context, providerID string) (*compute.Instance, error) {
 	_, zone, name, err := splitProviderID(providerID)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err = g.c.Instances().Get(ctx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
+	res, err := g.c.Instances().Get(ctx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,116 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var instanceCacheRequests = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Name:           "cloudprovider_gce_instance_cache_requests_total",
+		Help:           "Number of instance lookups served by the instance cache, by result: hit or miss",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"result"},
+)
+
+// init registers the instance cache metric.
+func init() {
+	legacyregistry.MustRegister(instanceCacheRequests)
+}
+
+type instanceCacheEntry struct {
+	instance *compute.Instance
+	expires  time.Time
+}
+
+// instanceCache is a read-through cache of the instances fetched by the
+// Node syncs, which otherwise get every instance on every sync. Its zero
+// value caches nothing.
+type instanceCache struct {
+	mu sync.Mutex
+	// ttl is how long the instances are cached, zero to disable the cache.
+	ttl     time.Duration
+	entries map[meta.Key]*instanceCacheEntry
+	// lastSweep is when the expired entries were last evicted, so that the
+	// instances deleted without being looked up again are not kept.
+	lastSweep time.Time
+}
+
+// getInstance gets the instance of key, from the instance cache if it has
+// been fetched less than the instance-cache-ttl ago. The instance returned
+// may be shared with other callers, so it must not be modified. An instance
+// not found is evicted from the cache.
+func (g *Cloud) getInstance(ctx context.Context, key *meta.Key) (*compute.Instance, error) {
+	c := &g.instanceCache
+	if c.ttl == 0 {
+		return g.c.Instances().Get(ctx, key)
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[*key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		instanceCacheRequests.WithLabelValues("hit").Inc()
+		return entry.instance, nil
+	}
+	instanceCacheRequests.WithLabelValues("miss").Inc()
+
+	instance, err := g.c.Instances().Get(ctx, key)
+	if err != nil {
+		if isNotFound(err) {
+			g.invalidateInstance(key)
+		}
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.entries == nil {
+		c.entries = map[meta.Key]*instanceCacheEntry{}
+	}
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.entries[*key] = &instanceCacheEntry{instance: instance, expires: now.Add(c.ttl)}
+	return instance, nil
+}
+
+// invalidateInstance evicts the instance of key from the instance cache,
+// e.g. after changing it.
+func (g *Cloud) invalidateInstance(key *meta.Key) {
+	c := &g.instanceCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, *key)
+}
@@ -0,0 +1,89 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestInstanceCache(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	key := meta.ZonalKey("node-1", vals.ZoneName)
+	instance := &compute.Instance{
+		Name:              "node-1",
+		Zone:              vals.ZoneName,
+		NetworkInterfaces: []*compute.NetworkInterface{{NetworkIP: "10.1.1.1"}},
+	}
+	require.NoError(t, gce.c.Instances().Insert(context.TODO(), key, instance))
+	var gets int
+	gce.c.(*cloud.MockGCE).MockInstances.GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockInstances, options ...cloud.Option) (bool, *compute.Instance, error) {
+		gets++
+		return false, nil, nil
+	}
+	providerID := "gce://" + vals.ProjectID + "/" + vals.ZoneName + "/node-1"
+
+	// Not cached by default.
+	for i := 0; i < 2; i++ {
+		_, err = gce.NodeAddressesByProviderID(context.TODO(), providerID)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, gets)
+
+	gets = 0
+	gce.instanceCache.ttl = time.Minute
+	for i := 0; i < 3; i++ {
+		_, err = gce.NodeAddressesByProviderID(context.TODO(), providerID)
+		require.NoError(t, err)
+		exists, err := gce.InstanceExistsByProviderID(context.TODO(), providerID)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+	assert.Equal(t, 1, gets)
+
+	// Invalidated instances are fetched again.
+	gce.invalidateInstance(key)
+	_, err = gce.NodeAddresses(context.TODO(), types.NodeName("node-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, gets)
+
+	// Expired instances are fetched again.
+	gce.instanceCache.entries[*key].expires = time.Now().Add(-time.Second)
+	_, err = gce.NodeAddressesByProviderID(context.TODO(), providerID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, gets)
+
+	// Instances not found are evicted.
+	gce.instanceCache.entries[*key].expires = time.Now().Add(-time.Second)
+	require.NoError(t, gce.c.Instances().Delete(context.TODO(), key))
+	_, err = gce.NodeAddressesByProviderID(context.TODO(), providerID)
+	assert.Error(t, err)
+	assert.NotContains(t, gce.instanceCache.entries, *key)
+}
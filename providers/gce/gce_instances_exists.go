@@ -0,0 +1,81 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// instanceListTTL is how long the instances listed for the existence checks
+// of a zone answer the following ones, which covers a sweep of the node
+// lifecycle controller over the NotReady Nodes.
+const instanceListTTL = 10 * time.Second
+
+type zoneInstanceList struct {
+	names    sets.String
+	listedAt time.Time
+}
+
+// instanceLists are the instances listed for the existence checks, by zone.
+// Its zero value is ready to use.
+type instanceLists struct {
+	mu    sync.Mutex
+	zones map[string]*zoneInstanceList
+}
+
+// instanceListed returns whether the named instance of the project of the
+// cluster was in the list of the instances of its zone, which is taken once
+// per instanceListTTL, so that the existence checks of the Nodes of a zone
+// cost a single API call. The instances created after the list are not in
+// it, so that an instance not listed must be looked up to tell whether it
+// exists.
+func (g *Cloud) instanceListed(zone, name string) (bool, error) {
+	l := &g.instanceLists
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if list, ok := l.zones[zone]; ok && time.Since(list.listedAt) < instanceListTTL {
+		return list.names.Has(name), nil
+	}
+
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	f := filter.None
+	if prefix := g.getNodeInstancePrefix(); prefix != "" {
+		f = filter.Regexp("name", prefix+".*")
+	}
+	instances, err := g.listZoneInstances(ctx, []string{zone}, f, instanceNameFields)
+	if err != nil {
+		return false, err
+	}
+	list := &zoneInstanceList{names: sets.NewString(), listedAt: time.Now()}
+	for _, instance := range instances[zone] {
+		list.names.Insert(instance.Name)
+	}
+	if l.zones == nil {
+		l.zones = map[string]*zoneInstanceList{}
+	}
+	l.zones[zone] = list
+	return list.names.Has(name), nil
+}
@@ -0,0 +1,88 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	instanceStatusTerminated = "TERMINATED"
+	spotProvisioningModel    = "SPOT"
+
+	nodePreemptedReason = "NodePreempted"
+)
+
+var preemptedNodeCount = metrics.NewCounter(
+	&metrics.CounterOpts{
+		Name:           "cloudprovider_gce_preempted_nodes_total",
+		Help:           "Number of Nodes reported gone because their instance was preempted",
+		StabilityLevel: metrics.ALPHA,
+	},
+)
+
+// init registers the preempted node metric.
+func init() {
+	legacyregistry.MustRegister(preemptedNodeCount)
+}
+
+// instancePreempted returns whether the instance is a Spot or Preemptible
+// one stopped by GCE. Standard instances are never preempted, so that a
+// stopped standard instance is not deleted, as its Node comes back once it
+// is started again.
+func instancePreempted(instance *compute.Instance) bool {
+	if instance.Status != instanceStatusTerminated || instance.Scheduling == nil {
+		return false
+	}
+	return instance.Scheduling.Preemptible || instance.Scheduling.ProvisioningModel == spotProvisioningModel
+}
+
+// nodeInstancePreempted returns whether the instance of the node, known to
+// exist, was preempted, recording a NodePreempted event on the node if so.
+// The errors getting the instance are not reported, the instance being
+// assumed not preempted then.
+func (g *Cloud) nodeInstancePreempted(ctx context.Context, node *v1.Node, providerID string) bool {
+	_, zone, name, err := splitProviderID(providerID)
+	if err != nil {
+		return false
+	}
+	instance, err := g.getInstance(ctx, meta.ZonalKey(canonicalizeInstanceName(name), zone))
+	if err != nil {
+		klog.V(4).Infof("Failed to get instance %s to check whether it was preempted: %v", providerID, err)
+		return false
+	}
+	if !instancePreempted(instance) {
+		return false
+	}
+
+	preemptedNodeCount.Inc()
+	klog.Infof("Instance %s of node %q was preempted, reporting it gone", providerID, node.Name)
+	if g.eventRecorder != nil {
+		g.eventRecorder.Eventf(node, v1.EventTypeNormal, nodePreemptedReason, "Instance %s was preempted, deleting the node", providerID)
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// providerIDProjectRegexp matches project IDs, optionally scoped by a
+	// domain, and project numbers.
+	providerIDProjectRegexp = regexp.MustCompile(`^(([a-z0-9][-a-z0-9.]*[a-z0-9]:)?[a-z][-a-z0-9]*[a-z0-9]|[0-9]+)$`)
+	// providerIDZoneRegexp matches zone names, e.g. us-central1-b, or the
+	// zones whose suffix is longer or has digits.
+	providerIDZoneRegexp = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+-[a-z0-9]+$`)
+	// providerIDInstanceRegexp matches instance names, RFC 1035 labels.
+	providerIDInstanceRegexp = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+)
+
+const (
+	providerIDRepairedReason = "ProviderIDRepaired"
+	invalidProviderIDReason  = "InvalidProviderID"
+)
+
+// parseProviderID parses a providerID gce://PROJECT/ZONE/INSTANCE like
+// splitProviderID, and validates its project, zone and instance name.
+func parseProviderID(providerID string) (project, zone, instance string, err error) {
+	rest, ok := strings.CutPrefix(providerID, ProviderName+"://")
+	if !ok {
+		return "", "", "", fmt.Errorf("providerID %q does not start with %s://", providerID, ProviderName)
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("providerID %q is not %s://PROJECT/ZONE/INSTANCE", providerID, ProviderName)
+	}
+	project, zone, instance = parts[0], parts[1], parts[2]
+	switch {
+	case !providerIDProjectRegexp.MatchString(project):
+		return "", "", "", fmt.Errorf("providerID %q has an invalid project %q", providerID, project)
+	case !providerIDZoneRegexp.MatchString(zone):
+		return "", "", "", fmt.Errorf("providerID %q has an invalid zone %q", providerID, zone)
+	case !providerIDInstanceRegexp.MatchString(instance):
+		return "", "", "", fmt.Errorf("providerID %q has an invalid instance name %q", providerID, instance)
+	}
+	return project, zone, instance, nil
+}
+
+// nodeProviderID returns the providerID of the node. A missing or malformed
+// providerID is derived from the instance named after the node in the
+// managed zones instead of failing the lookups of the node for good: a
+// missing one is set on the Node, while a malformed one, which cannot be
+// changed, is reported with an InvalidProviderID event. The node of a
+// malformed providerID is not reported gone if no instance is named after
+// it.
+func (g *Cloud) nodeProviderID(ctx context.Context, node *v1.Node) (string, error) {
+	providerID := node.Spec.ProviderID
+	var parseErr error
+	if providerID != "" {
+		if _, _, _, parseErr = parseProviderID(providerID); parseErr == nil {
+			return providerID, nil
+		}
+	}
+
+	derived, err := cloudprovider.GetInstanceProviderID(ctx, g, types.NodeName(node.Name))
+	if err != nil {
+		if parseErr != nil && errors.Is(err, cloudprovider.InstanceNotFound) {
+			return "", parseErr
+		}
+		return "", err
+	}
+	if parseErr != nil {
+		msg := fmt.Sprintf("Using providerID %s of the instance named after the node: %v", derived, parseErr)
+		klog.Warningf("Node %q: %s", node.Name, msg)
+		if g.eventRecorder != nil {
+			g.eventRecorder.Event(node, v1.EventTypeWarning, invalidProviderIDReason, msg)
+		}
+		return derived, nil
+	}
+	g.repairNodeProviderID(ctx, node, derived)
+	return derived, nil
+}
+
+// repairNodeProviderID sets the missing providerID of the node.
+func (g *Cloud) repairNodeProviderID(ctx context.Context, node *v1.Node, providerID string) {
+	if g.client == nil {
+		return
+	}
+	updated := node.DeepCopy()
+	updated.Spec.ProviderID = providerID
+	if err := g.patchNode(ctx, node, updated); err != nil {
+		klog.Warningf("Failed to set the providerID of node %q to %s: %v", node.Name, providerID, err)
+		return
+	}
+	klog.Infof("Set the missing providerID of node %q to %s", node.Name, providerID)
+	if g.eventRecorder != nil {
+		g.eventRecorder.Eventf(node, v1.EventTypeNormal, providerIDRepairedReason, "Set the missing providerID to %s", providerID)
+	}
+}
@@ -0,0 +1,204 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// NodeCloudUnverifiedTaintKey is the key of the taint set on Nodes whose
+	// instance could not be verified to exist because of cloud errors.
+	NodeCloudUnverifiedTaintKey = "cloud.google.com/cloud-unverified"
+
+	// NodeCloudUnverifiedSinceAnnotationKey is annotated on quarantined Nodes
+	// with the RFC3339 time of the first failed instance existence check.
+	NodeCloudUnverifiedSinceAnnotationKey = "cloud.google.com/cloud-unverified-since"
+
+	// defaultNodeQuarantineEscalationWindow is how long a Node stays
+	// quarantined with a NoSchedule taint before it is escalated to NoExecute.
+	defaultNodeQuarantineEscalationWindow = 30 * time.Minute
+
+	// apiCallHealthWindow is how recent the last successful GCE API call must
+	// be for the GCE API to be considered available.
+	apiCallHealthWindow = time.Minute
+)
+
+// apiCallHealth records when a GCE API call last succeeded. Its zero value is
+// ready to use.
+type apiCallHealth struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+}
+
+// observe records the result of a GCE API call.
+func (h *apiCallHealth) observe(err error, now time.Time) {
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSuccess = now
+}
+
+// available returns whether a GCE API call succeeded within
+// apiCallHealthWindow.
+func (h *apiCallHealth) available(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return now.Sub(h.lastSuccess) < apiCallHealthWindow
+}
+
+// isAPIOutageError returns whether err tells the GCE API is failing rather
+// than that it is denying the call for the instance: a server error, a rate
+// limit or quota exceeded, a call suspended by the circuit breaker, or no
+// answer at all.
+func isAPIOutageError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= http.StatusInternalServerError || isQuotaExceededError(err)
+	}
+	var circuitErr *apiCircuitOpenError
+	var netErr net.Error
+	return errors.As(err, &circuitErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// updateNodeQuarantine quarantines the node if checking whether its instance
+// exists failed with err, and lifts the quarantine once the instance is seen
+// again, by the check or by a lookup of its metadata. Errors other than the
+// instance not being found, such as permission, quota or partial outage
+// errors, are ambiguous: the node is tainted NoSchedule and annotated instead
+// of being deleted. If the node stays quarantined for longer than the
+// escalation window, the taint is escalated to NoExecute, unless the GCE API
+// is failing: err is an outage error or no GCE API call succeeded lately, so
+// that an outage never evicts the pods of all the nodes. A NoExecute taint is
+// kept until the quarantine is lifted.
+func (g *Cloud) updateNodeQuarantine(ctx context.Context, node *v1.Node, err error) {
+	updated := node.DeepCopy()
+	if err == nil {
+		if _, ok := node.Annotations[NodeCloudUnverifiedSinceAnnotationKey]; !ok && findNodeCloudUnverifiedTaint(node) == nil {
+			return
+		}
+		delete(updated.Annotations, NodeCloudUnverifiedSinceAnnotationKey)
+		updated.Spec.Taints = withoutNodeCloudUnverifiedTaint(node.Spec.Taints)
+		if patchErr := g.patchNode(ctx, node, updated); patchErr != nil {
+			klog.Warningf("Failed to lift cloud-unverified quarantine of node %q: %v", node.Name, patchErr)
+			return
+		}
+		klog.Infof("Lifted cloud-unverified quarantine of node %q", node.Name)
+		return
+	}
+
+	now := time.Now()
+	since := now
+	if value, ok := node.Annotations[NodeCloudUnverifiedSinceAnnotationKey]; ok {
+		if t, parseErr := time.Parse(time.RFC3339, value); parseErr == nil {
+			since = t
+		}
+	}
+	effect := v1.TaintEffectNoSchedule
+	window := g.nodeQuarantineEscalationWindow
+	if window == 0 {
+		window = defaultNodeQuarantineEscalationWindow
+	}
+	existing := findNodeCloudUnverifiedTaint(node)
+	switch {
+	case existing != nil && existing.Effect == v1.TaintEffectNoExecute:
+		effect = v1.TaintEffectNoExecute
+	case now.Sub(since) < window:
+	case isAPIOutageError(err) || !g.apiCallHealth.available(now):
+		klog.V(2).Infof("Not escalating the cloud-unverified quarantine of node %q while the GCE API is failing: %v", node.Name, err)
+	default:
+		effect = v1.TaintEffectNoExecute
+	}
+
+	if existing != nil && existing.Effect == effect && node.Annotations[NodeCloudUnverifiedSinceAnnotationKey] != "" {
+		return
+	}
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[NodeCloudUnverifiedSinceAnnotationKey] = since.UTC().Format(time.RFC3339)
+	updated.Spec.Taints = append(withoutNodeCloudUnverifiedTaint(node.Spec.Taints), v1.Taint{
+		Key:       NodeCloudUnverifiedTaintKey,
+		Effect:    effect,
+		TimeAdded: &metav1.Time{Time: now},
+	})
+	if patchErr := g.patchNode(ctx, node, updated); patchErr != nil {
+		klog.Warningf("Failed to quarantine node %q as cloud-unverified: %v", node.Name, patchErr)
+		return
+	}
+	msg := fmt.Sprintf("Could not verify that the instance of the node exists, quarantining it with a %s taint: %v", effect, err)
+	klog.Warningf("Node %q: %s", node.Name, msg)
+	if g.eventRecorder != nil {
+		g.eventRecorder.Event(node, v1.EventTypeWarning, "CloudUnverified", msg)
+	}
+}
+
+func findNodeCloudUnverifiedTaint(node *v1.Node) *v1.Taint {
+	for i := range node.Spec.Taints {
+		if node.Spec.Taints[i].Key == NodeCloudUnverifiedTaintKey {
+			return &node.Spec.Taints[i]
+		}
+	}
+	return nil
+}
+
+func withoutNodeCloudUnverifiedTaint(taints []v1.Taint) []v1.Taint {
+	var result []v1.Taint
+	for _, taint := range taints {
+		if taint.Key != NodeCloudUnverifiedTaintKey {
+			result = append(result, taint)
+		}
+	}
+	return result
+}
+
+// patchNode patches the node with the difference between node and updated.
+func (g *Cloud) patchNode(ctx context.Context, node, updated *v1.Node) error {
+	oldData, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	newData, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, v1.Node{})
+	if err != nil {
+		return err
+	}
+	_, err = g.client.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
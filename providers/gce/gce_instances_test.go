@@ -22,17 +22,24 @@ package gce
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	computebeta "google.golang.org/api/compute/v0.beta"
 	ga "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
 )
 
 func TestInstanceExists(t *testing.T) {
@@ -73,6 +80,279 @@ func TestInstanceExists(t *testing.T) {
 	}
 }
 
+func TestInstanceExistsQuarantine(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureNodeCloudUnverifiedQuarantine})
+	gce.nodeQuarantineEscalationWindow = time.Hour
+
+	nodeName := "test-node-1"
+	_, err = createAndInsertNodes(gce, []string{nodeName}, vals.ZoneName)
+	require.NoError(t, err)
+	node, err := gce.client.CoreV1().Nodes().Create(context.TODO(), &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Spec: v1.NodeSpec{
+			ProviderID: fmt.Sprintf("gce://%s/%s/%s", vals.ProjectID, vals.ZoneName, nodeName),
+			Taints:     []v1.Taint{{Key: "other", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	getNode := func() *v1.Node {
+		node, err := gce.client.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+		require.NoError(t, err)
+		return node
+	}
+
+	// An ambiguous error quarantines the node instead of reporting it gone.
+	mockGCE := gce.c.(*cloud.MockGCE)
+	listErr := error(&googleapi.Error{Code: http.StatusForbidden})
+	mockGCE.MockInstances.ListError = &listErr
+	mockGCE.MockInstances.GetError[*meta.ZonalKey(nodeName, vals.ZoneName)] = &googleapi.Error{Code: http.StatusForbidden}
+	exist, err := gce.InstanceExists(context.TODO(), node)
+	assert.Error(t, err)
+	assert.False(t, exist)
+	node = getNode()
+	assert.Contains(t, node.Annotations, NodeCloudUnverifiedSinceAnnotationKey)
+	require.NotNil(t, findNodeCloudUnverifiedTaint(node))
+	assert.Equal(t, v1.TaintEffectNoSchedule, findNodeCloudUnverifiedTaint(node).Effect)
+	assert.Len(t, node.Spec.Taints, 2)
+
+	// The taint is not escalated past the window while no GCE API call
+	// succeeds.
+	node.Annotations[NodeCloudUnverifiedSinceAnnotationKey] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	node, err = gce.client.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	_, err = gce.InstanceExists(context.TODO(), node)
+	assert.Error(t, err)
+	node = getNode()
+	require.NotNil(t, findNodeCloudUnverifiedTaint(node))
+	assert.Equal(t, v1.TaintEffectNoSchedule, findNodeCloudUnverifiedTaint(node).Effect)
+
+	// Nor while the check of the node fails with an outage error, even though
+	// other GCE API calls succeed.
+	gce.apiCallHealth.observe(nil, time.Now())
+	listErr = &googleapi.Error{Code: http.StatusServiceUnavailable}
+	mockGCE.MockInstances.GetError[*meta.ZonalKey(nodeName, vals.ZoneName)] = &googleapi.Error{Code: http.StatusServiceUnavailable}
+	_, err = gce.InstanceExists(context.TODO(), node)
+	assert.Error(t, err)
+	node = getNode()
+	assert.Equal(t, v1.TaintEffectNoSchedule, findNodeCloudUnverifiedTaint(node).Effect)
+
+	// The taint is escalated once the node stays quarantined past the window
+	// while the GCE API is available.
+	listErr = &googleapi.Error{Code: http.StatusForbidden}
+	mockGCE.MockInstances.GetError[*meta.ZonalKey(nodeName, vals.ZoneName)] = &googleapi.Error{Code: http.StatusForbidden}
+	_, err = gce.InstanceExists(context.TODO(), node)
+	assert.Error(t, err)
+	node = getNode()
+	require.NotNil(t, findNodeCloudUnverifiedTaint(node))
+	assert.Equal(t, v1.TaintEffectNoExecute, findNodeCloudUnverifiedTaint(node).Effect)
+
+	// The quarantine is lifted once the instance is verified again.
+	mockGCE.MockInstances.ListError = nil
+	delete(mockGCE.MockInstances.GetError, *meta.ZonalKey(nodeName, vals.ZoneName))
+	exist, err = gce.InstanceExists(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.True(t, exist)
+	node = getNode()
+	assert.NotContains(t, node.Annotations, NodeCloudUnverifiedSinceAnnotationKey)
+	assert.Nil(t, findNodeCloudUnverifiedTaint(node))
+	assert.Equal(t, []v1.Taint{{Key: "other", Effect: v1.TaintEffectNoSchedule}}, node.Spec.Taints)
+
+	// The existence of the instances of Ready nodes is not checked, their
+	// quarantine is lifted once their instance metadata is read.
+	gce.instanceLists.zones = nil
+	mockGCE.MockInstances.ListError = &listErr
+	mockGCE.MockInstances.GetError[*meta.ZonalKey(nodeName, vals.ZoneName)] = &googleapi.Error{Code: http.StatusForbidden}
+	_, err = gce.InstanceExists(context.TODO(), node)
+	assert.Error(t, err)
+	node = getNode()
+	require.NotNil(t, findNodeCloudUnverifiedTaint(node))
+	delete(mockGCE.MockInstances.GetError, *meta.ZonalKey(nodeName, vals.ZoneName))
+	mockGCE.MockInstances.GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockInstances, options ...cloud.Option) (bool, *ga.Instance, error) {
+		return true, &ga.Instance{Name: nodeName, Zone: vals.ZoneName, NetworkInterfaces: []*ga.NetworkInterface{{NetworkIP: "10.1.1.1"}}}, nil
+	}
+	_, err = gce.InstanceMetadata(context.TODO(), node)
+	assert.NoError(t, err)
+	node = getNode()
+	assert.NotContains(t, node.Annotations, NodeCloudUnverifiedSinceAnnotationKey)
+	assert.Nil(t, findNodeCloudUnverifiedTaint(node))
+}
+
+func TestIsAPIOutageError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: true},
+		{err: &googleapi.Error{Code: http.StatusTooManyRequests}, want: true},
+		{err: &apiCircuitOpenError{service: "Instances"}, want: true},
+		{err: fmt.Errorf("get: %w", context.DeadlineExceeded), want: true},
+		{err: &googleapi.Error{Code: http.StatusForbidden}, want: false},
+		{err: fmt.Errorf("invalid providerID"), want: false},
+	} {
+		assert.Equal(t, tc.want, isAPIOutageError(tc.err), "%v", tc.err)
+	}
+}
+
+func TestInstanceExistsByProviderIDBatched(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	nodeNames := []string{"node-1", "node-2", "node-3"}
+	_, err = createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+	mockGCE := gce.c.(*cloud.MockGCE)
+	var lists, gets int
+	mockGCE.MockInstances.ListHook = func(ctx context.Context, zone string, fl *filter.F, m *cloud.MockInstances, options ...cloud.Option) (bool, []*ga.Instance, error) {
+		lists++
+		return false, nil, nil
+	}
+	mockGCE.MockInstances.GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockInstances, options ...cloud.Option) (bool, *ga.Instance, error) {
+		gets++
+		return false, nil, nil
+	}
+	providerID := func(name string) string {
+		return fmt.Sprintf("gce://%s/%s/%s", vals.ProjectID, vals.ZoneName, name)
+	}
+
+	// The instances of a zone are listed once for all the checks.
+	for _, name := range nodeNames {
+		exists, err := gce.InstanceExistsByProviderID(context.TODO(), providerID(name))
+		require.NoError(t, err)
+		assert.True(t, exists, name)
+	}
+	assert.Equal(t, 1, lists)
+	assert.Zero(t, gets)
+
+	// The instances not listed are looked up.
+	exists, err := gce.InstanceExistsByProviderID(context.TODO(), providerID("missing-node"))
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = createAndInsertNodes(gce, []string{"new-node"}, vals.ZoneName)
+	require.NoError(t, err)
+	// createAndInsertNodes gets the instances it inserts.
+	gets = 1
+	exists, err = gce.InstanceExistsByProviderID(context.TODO(), providerID("new-node"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, 1, lists)
+	assert.Equal(t, 2, gets)
+}
+
+func TestParseProviderID(t *testing.T) {
+	for providerID, wantErr := range map[string]bool{
+		"gce://test-project/us-central1-b/node-1":             false,
+		"gce://example.com:test-project/us-central1-b/node-1": false,
+		"gce://123456789/us-central1-b/node-1":                false,
+		"gce://test-project/us-central1-ai1a/node-1":          false,
+		"": true,
+		"aws://test-project/us-central1-b/node-1":       true,
+		"gce://test-project/node-1":                     true,
+		"gce:///us-central1-b/node-1":                   true,
+		"gce://Test-Project/us-central1-b/node-1":       true,
+		"gce://test-project/us-central1/node-1":         true,
+		"gce://test-project/us-central1-b/Node_1":       true,
+		"gce://test-project/us-central1-b/node-1/extra": true,
+	} {
+		_, _, _, err := parseProviderID(providerID)
+		assert.Equal(t, wantErr, err != nil, "%q: %v", providerID, err)
+	}
+}
+
+func TestInstanceExistsRepairsProviderID(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+	for _, name := range []string{"node-1", "node-2"} {
+		instance := &ga.Instance{Name: name, Zone: vals.ZoneName, NetworkInterfaces: []*ga.NetworkInterface{{NetworkIP: "10.1.1.1"}}}
+		require.NoError(t, gce.c.Instances().Insert(context.TODO(), meta.ZonalKey(name, vals.ZoneName), instance))
+	}
+	wantProviderID := fmt.Sprintf("gce://%s/%s/node-1", vals.ProjectID, vals.ZoneName)
+
+	// A missing providerID is set on the Node.
+	node, err := gce.client.CoreV1().Nodes().Create(context.TODO(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	exists, err := gce.InstanceExists(context.TODO(), node)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	node, err = gce.client.CoreV1().Nodes().Get(context.TODO(), "node-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, wantProviderID, node.Spec.ProviderID)
+	assert.Contains(t, <-recorder.Events, providerIDRepairedReason)
+
+	// A malformed providerID is replaced by the derived one for the lookups.
+	node = &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}, Spec: v1.NodeSpec{ProviderID: "gce://node-2"}}
+	md, err := gce.InstanceMetadata(context.TODO(), node)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("gce://%s/%s/node-2", vals.ProjectID, vals.ZoneName), md.ProviderID)
+	assert.Contains(t, <-recorder.Events, invalidProviderIDReason)
+
+	// A node with a malformed providerID is not reported gone.
+	node = &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-3"}, Spec: v1.NodeSpec{ProviderID: "gce://node-3"}}
+	_, err = gce.InstanceExists(context.TODO(), node)
+	assert.Error(t, err)
+
+	// A node without providerID nor instance is.
+	node = &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-3"}}
+	exists, err = gce.InstanceExists(context.TODO(), node)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestInstanceExistsPreempted(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+	instances := map[string]*ga.Instance{
+		"spot-node":        {Status: "TERMINATED", Scheduling: &ga.Scheduling{ProvisioningModel: "SPOT"}},
+		"preemptible-node": {Status: "TERMINATED", Scheduling: &ga.Scheduling{Preemptible: true}},
+		"running-spot":     {Status: "RUNNING", Scheduling: &ga.Scheduling{ProvisioningModel: "SPOT"}},
+		"stopped-node":     {Status: "TERMINATED", Scheduling: &ga.Scheduling{ProvisioningModel: "STANDARD"}},
+	}
+	for name, instance := range instances {
+		instance.Name = name
+		instance.Zone = vals.ZoneName
+		require.NoError(t, gce.c.Instances().Insert(context.TODO(), meta.ZonalKey(name, vals.ZoneName), instance))
+	}
+	node := func(name string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1.NodeSpec{ProviderID: fmt.Sprintf("gce://%s/%s/%s", vals.ProjectID, vals.ZoneName, name)},
+		}
+	}
+
+	// The preempted instances exist unless the feature is enabled.
+	exists, err := gce.InstanceExists(context.TODO(), node("spot-node"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureDeletePreemptedNodes})
+	for name, want := range map[string]bool{
+		"spot-node":        false,
+		"preemptible-node": false,
+		"running-spot":     true,
+		"stopped-node":     true,
+	} {
+		exists, err := gce.InstanceExists(context.TODO(), node(name))
+		require.NoError(t, err)
+		assert.Equal(t, want, exists, name)
+	}
+	assert.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, nodePreemptedReason)
+
+	// The instances which cannot be checked are not reported gone.
+	gce.c.(*cloud.MockGCE).MockInstances.GetError[*meta.ZonalKey("spot-node", vals.ZoneName)] = &googleapi.Error{Code: http.StatusForbidden}
+	exists, err = gce.InstanceExists(context.TODO(), node("spot-node"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
 func TestNodeAddresses(t *testing.T) {
 	gce, err := fakeGCECloud(DefaultTestClusterValues())
 	require.NoError(t, err)
@@ -188,6 +468,7 @@ func TestNodeAddresses(t *testing.T) {
 			wantAddrs: []v1.NodeAddress{
 				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
 				{Type: v1.NodeInternalIP, Address: "2001:2d00::0:1"},
+				{Type: v1.NodeInternalDNS, Address: "n1.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -197,6 +478,7 @@ func TestNodeAddresses(t *testing.T) {
 			wantAddrs: []v1.NodeAddress{
 				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
 				{Type: v1.NodeInternalIP, Address: "2001:2d00::0:1"},
+				{Type: v1.NodeInternalDNS, Address: "n1.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -206,6 +488,7 @@ func TestNodeAddresses(t *testing.T) {
 			wantAddrs: []v1.NodeAddress{
 				{Type: v1.NodeInternalIP, Address: "2001:2d00::0:1"},
 				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
+				{Type: v1.NodeInternalDNS, Address: "n1.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -216,6 +499,7 @@ func TestNodeAddresses(t *testing.T) {
 				{Type: v1.NodeInternalIP, Address: "10.1.1.2"},
 				{Type: v1.NodeExternalIP, Address: "20.1.1.2"},
 				{Type: v1.NodeInternalIP, Address: "2001:1900::0:2"},
+				{Type: v1.NodeInternalDNS, Address: "n2.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -226,6 +510,7 @@ func TestNodeAddresses(t *testing.T) {
 				{Type: v1.NodeInternalIP, Address: "10.1.1.2"},
 				{Type: v1.NodeExternalIP, Address: "20.1.1.2"},
 				{Type: v1.NodeInternalIP, Address: "2001:1900::0:2"},
+				{Type: v1.NodeInternalDNS, Address: "n2.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -236,6 +521,7 @@ func TestNodeAddresses(t *testing.T) {
 				{Type: v1.NodeInternalIP, Address: "2001:1900::0:2"},
 				{Type: v1.NodeInternalIP, Address: "10.1.1.2"},
 				{Type: v1.NodeExternalIP, Address: "20.1.1.2"},
+				{Type: v1.NodeInternalDNS, Address: "n2.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -281,6 +567,7 @@ func TestNodeAddresses(t *testing.T) {
 			wantAddrs: []v1.NodeAddress{
 				{Type: v1.NodeInternalIP, Address: "10.1.1.5"},
 				{Type: v1.NodeExternalIP, Address: "20.1.1.5"},
+				{Type: v1.NodeInternalDNS, Address: "n5.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -289,6 +576,7 @@ func TestNodeAddresses(t *testing.T) {
 			stackType: clusterStackIPV6,
 			wantAddrs: []v1.NodeAddress{
 				{Type: v1.NodeInternalIP, Address: "2001:2d00::0:1"},
+				{Type: v1.NodeInternalDNS, Address: "n6.us-central1-b.c.test-project.internal"},
 			},
 		},
 		{
@@ -297,6 +585,7 @@ func TestNodeAddresses(t *testing.T) {
 			stackType: clusterStackIPV6,
 			wantAddrs: []v1.NodeAddress{
 				{Type: v1.NodeInternalIP, Address: "2001:1900::0:2"},
+				{Type: v1.NodeInternalDNS, Address: "n7.us-central1-b.c.test-project.internal"},
 			},
 		},
 	}
@@ -317,6 +606,77 @@ func TestNodeAddresses(t *testing.T) {
 	}
 }
 
+func TestNodeAddressesNetworkInterfaces(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	instance := &ga.Instance{
+		NetworkInterfaces: []*ga.NetworkInterface{
+			{Name: "nic0", NetworkIP: "10.1.1.1", AccessConfigs: []*ga.AccessConfig{{NatIP: "20.1.1.1"}}},
+			{Name: "nic1", NetworkIP: "10.2.1.1"},
+			{Name: "nic2", NetworkIP: "10.3.1.1"},
+		},
+	}
+
+	for _, tc := range []struct {
+		desc       string
+		interfaces []string
+		wantAddrs  []v1.NodeAddress
+	}{
+		{
+			desc: "all interfaces by default",
+			wantAddrs: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
+				{Type: v1.NodeExternalIP, Address: "20.1.1.1"},
+				{Type: v1.NodeInternalIP, Address: "10.2.1.1"},
+				{Type: v1.NodeInternalIP, Address: "10.3.1.1"},
+			},
+		},
+		{
+			desc:       "selected and ordered interfaces",
+			interfaces: []string{"nic2", "nic0"},
+			wantAddrs: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "10.3.1.1"},
+				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
+				{Type: v1.NodeExternalIP, Address: "20.1.1.1"},
+			},
+		},
+		{
+			desc:       "missing interfaces are skipped",
+			interfaces: []string{"nic3", "nic1"},
+			wantAddrs: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "10.2.1.1"},
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			gce.nodeAddressNetworkInterfaces = tc.interfaces
+			addrs, err := gce.nodeAddressesFromInstance(instance)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantAddrs, addrs)
+		})
+	}
+}
+
+func TestInstanceInternalDNSName(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+
+	instance := &ga.Instance{Name: "n1", Zone: "https://www.googleapis.com/compute/v1/projects/test-project/zones/us-central1-b"}
+	assert.Equal(t, "n1.us-central1-b.c.test-project.internal", gce.instanceInternalDNSName(instance))
+	gce.projectID = "example.com:test-project"
+	assert.Equal(t, "n1.us-central1-b.c.test-project.example.com.internal", gce.instanceInternalDNSName(instance))
+	instance.Hostname = "n1.example.com"
+	assert.Equal(t, "n1.example.com", gce.instanceInternalDNSName(instance))
+	assert.Empty(t, gce.instanceInternalDNSName(&ga.Instance{}))
+}
+
+func TestValidateNodeAddressNetworkInterfaces(t *testing.T) {
+	assert.NoError(t, validateNodeAddressNetworkInterfaces(nil))
+	assert.NoError(t, validateNodeAddressNetworkInterfaces([]string{"nic1", "nic0"}))
+	assert.Error(t, validateNodeAddressNetworkInterfaces([]string{"eth0"}))
+	assert.Error(t, validateNodeAddressNetworkInterfaces([]string{"nic0", "nic0"}))
+}
+
 func TestAliasRangesByProviderID(t *testing.T) {
 	gce, err := fakeGCECloud(DefaultTestClusterValues())
 	require.NoError(t, err)
@@ -445,6 +805,108 @@ func TestAliasRangesByProviderID(t *testing.T) {
 	}
 }
 
+func TestExpandAliasIPRangesByProviderID(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	mockGCE := gce.c.(*cloud.MockGCE)
+	key := meta.ZonalKey("n1", vals.ZoneName)
+	err = mockGCE.BetaInstances().Insert(context.Background(), key, &computebeta.Instance{
+		Name: "n1",
+		Zone: vals.ZoneName,
+		NetworkInterfaces: []*computebeta.NetworkInterface{
+			{
+				Name:          "nic0",
+				Fingerprint:   "fp",
+				AliasIpRanges: []*computebeta.AliasIpRange{{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: "pods"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	var got *computebeta.NetworkInterface
+	mockGCE.MockBetaInstances.UpdateNetworkInterfaceHook = func(ctx context.Context, k *meta.Key, name string, iface *computebeta.NetworkInterface, m *cloud.MockBetaInstances, options ...cloud.Option) error {
+		assert.Equal(t, key, k)
+		assert.Equal(t, "nic0", name)
+		got = iface
+		return nil
+	}
+
+	require.NoError(t, gce.ExpandAliasIPRangesByProviderID("gce://p1/"+vals.ZoneName+"/n1", "pods", 25))
+	assert.Equal(t, &computebeta.NetworkInterface{
+		Name:        "nic0",
+		Fingerprint: "fp",
+		AliasIpRanges: []*computebeta.AliasIpRange{
+			{IpCidrRange: "10.11.1.0/24", SubnetworkRangeName: "pods"},
+			{IpCidrRange: "/25", SubnetworkRangeName: "pods"},
+		},
+	}, got)
+
+	assert.Error(t, gce.ExpandAliasIPRangesByProviderID("gce://p1/"+vals.ZoneName+"/missing", "pods", 25))
+}
+
+func TestListInstanceNetworkInterfaces(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.nodeInstancePrefix = "gke-"
+	requests := serveCompute(t, gce, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprintf(w, `{"items": {"zones/%s": {"instances": [{"name": "gke-node-1", "zone": "zones/%s", "networkInterfaces": [{"aliasIpRanges": [{"ipCidrRange": "10.0.0.0/24"}]}]}]}}, "nextPageToken": "next"}`, vals.ZoneName, vals.ZoneName)
+			return
+		}
+		fmt.Fprintf(w, `{"items": {"zones/%s": {"instances": [{"name": "gke-node-2", "zone": "zones/%s"}]}, "zones/other-zone": {"instances": [{"name": "gke-node-3", "zone": "zones/other-zone"}]}}}`, vals.ZoneName, vals.ZoneName)
+	})
+
+	instances, err := gce.ListInstanceNetworkInterfaces(context.Background())
+	require.NoError(t, err)
+	providerID := func(name string) string {
+		return fmt.Sprintf("gce://%s/%s/%s", vals.ProjectID, vals.ZoneName, name)
+	}
+	// The instances of the zones which are not managed are left out.
+	require.Len(t, instances, 2)
+	assert.Equal(t, "10.0.0.0/24", instances[providerID("gke-node-1")].NetworkInterfaces[0].AliasIpRanges[0].IpCidrRange)
+	assert.Contains(t, instances, providerID("gke-node-2"))
+
+	// The instances are listed with a field mask in a single aggregated
+	// list of the managed zones, page by page.
+	require.Len(t, *requests, 2)
+	for _, r := range *requests {
+		assert.Equal(t, "/compute/v1/projects/"+vals.ProjectID+"/aggregated/instances", r.URL.Path)
+		assert.Equal(t, instanceNetworkInterfacesFields, r.URL.Query().Get("fields"))
+		assert.Equal(t, "(zone eq .*/zones/"+vals.ZoneName+") (name eq gke-.*)", r.URL.Query().Get("filter"))
+	}
+}
+
+func TestListNodeInstanceGroupInstanceNetworkInterfaces(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Without a node instance prefix, the instances of the cluster are not
+	// known.
+	_, err = gce.ListNodeInstanceGroupInstanceNetworkInterfaces(ctx)
+	require.Error(t, err)
+
+	gce.nodeInstancePrefix = "gke-"
+	serveCompute(t, gce, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"items": {"zones/%s": {"instances": [{"name": "gke-node-1", "zone": "zones/%[1]s"}, {"name": "gke-other-1", "zone": "zones/%[1]s"}]}}}`, vals.ZoneName)
+	})
+	require.NoError(t, gce.CreateInstanceGroup(&ga.InstanceGroup{Name: "gke-pool-1-grp"}, vals.ZoneName))
+	require.NoError(t, gce.AddInstancesToInstanceGroup("gke-pool-1-grp", vals.ZoneName, gce.ToInstanceReferences(vals.ZoneName, []string{"gke-node-1"})))
+	// The instance groups which are not named with the prefix are not the
+	// ones of the nodes.
+	require.NoError(t, gce.CreateInstanceGroup(&ga.InstanceGroup{Name: "other-grp"}, vals.ZoneName))
+	require.NoError(t, gce.AddInstancesToInstanceGroup("other-grp", vals.ZoneName, gce.ToInstanceReferences(vals.ZoneName, []string{"gke-other-1"})))
+
+	instances, err := gce.ListNodeInstanceGroupInstanceNetworkInterfaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Contains(t, instances, fmt.Sprintf("gce://%s/%s/gke-node-1", vals.ProjectID, vals.ZoneName))
+}
+
 func TestInstanceByProviderID(t *testing.T) {
 	gce, err := fakeGCECloud(DefaultTestClusterValues())
 	require.NoError(t, err)
@@ -557,3 +1019,131 @@ func TestGetZone(t *testing.T) {
 		}
 	}
 }
+
+func TestInstanceMetadataOmitExternalIP(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+
+	instance := &ga.Instance{
+		Name:        "n1",
+		Zone:        "us-central1-b",
+		MachineType: "zones/us-central1-b/machineTypes/e2-medium",
+		NetworkInterfaces: []*ga.NetworkInterface{
+			{
+				NetworkIP: "10.1.1.1",
+				AccessConfigs: []*ga.AccessConfig{
+					{NatIP: "20.1.1.1"},
+				},
+			},
+		},
+	}
+	mockGCE := gce.c.(*cloud.MockGCE)
+	mockGCE.Instances().(*cloud.MockInstances).GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockInstances, options ...cloud.Option) (bool, *ga.Instance, error) {
+		return true, instance, nil
+	}
+
+	testcases := []struct {
+		name      string
+		labels    map[string]string
+		wantAddrs []v1.NodeAddress
+	}{
+		{
+			name: "no label",
+			wantAddrs: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
+				{Type: v1.NodeExternalIP, Address: "20.1.1.1"},
+				{Type: v1.NodeInternalDNS, Address: "n1.us-central1-b.c.test-project.internal"},
+			},
+		},
+		{
+			name:   "omit external IP",
+			labels: map[string]string{NodeLabelOmitExternalIP: "true"},
+			wantAddrs: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
+				{Type: v1.NodeInternalDNS, Address: "n1.us-central1-b.c.test-project.internal"},
+			},
+		},
+		{
+			name:   "label set to false",
+			labels: map[string]string{NodeLabelOmitExternalIP: "false"},
+			wantAddrs: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "10.1.1.1"},
+				{Type: v1.NodeExternalIP, Address: "20.1.1.1"},
+				{Type: v1.NodeInternalDNS, Address: "n1.us-central1-b.c.test-project.internal"},
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "n1", Labels: tc.labels},
+				Spec:       v1.NodeSpec{ProviderID: "gce://project/us-central1-b/n1"},
+			}
+			md, err := gce.InstanceMetadata(context.TODO(), node)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantAddrs, md.NodeAddresses)
+		})
+	}
+}
+
+func TestMixedOSClusterInstances(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for _, instance := range []*ga.Instance{
+		{
+			Name: "linux-node-1",
+			Zone: vals.ZoneName,
+			NetworkInterfaces: []*ga.NetworkInterface{
+				{NetworkIP: "10.1.1.1", AliasIpRanges: []*ga.AliasIpRange{{IpCidrRange: "10.11.1.0/24"}}},
+			},
+		},
+		{
+			Name: "win-node-1",
+			Zone: vals.ZoneName,
+			NetworkInterfaces: []*ga.NetworkInterface{
+				{NetworkIP: "10.1.1.2", AliasIpRanges: []*ga.AliasIpRange{{IpCidrRange: "10.11.2.0/24"}}},
+			},
+		},
+	} {
+		require.NoError(t, gce.c.Instances().Insert(ctx, meta.ZonalKey(instance.Name, vals.ZoneName), instance))
+	}
+
+	for _, tc := range []struct {
+		hostname  string
+		nodeName  types.NodeName
+		address   string
+		aliasCIDR string
+	}{
+		{hostname: "linux-node-1", nodeName: "linux-node-1", address: "10.1.1.1", aliasCIDR: "10.11.1.0/24"},
+		// Windows Server nodes report their hostname in uppercase.
+		{hostname: "WIN-NODE-1", nodeName: "win-node-1", address: "10.1.1.2", aliasCIDR: "10.11.2.0/24"},
+	} {
+		t.Run(tc.hostname, func(t *testing.T) {
+			nodeName, err := gce.CurrentNodeName(ctx, tc.hostname)
+			require.NoError(t, err)
+			assert.Equal(t, tc.nodeName, nodeName)
+
+			providerID, err := gce.InstanceID(ctx, types.NodeName(tc.hostname+".c.test-project.internal"))
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%s/%s/%s", vals.ProjectID, vals.ZoneName, tc.nodeName), providerID)
+			providerID = ProviderName + "://" + providerID
+
+			addresses, err := gce.NodeAddressesByProviderID(ctx, providerID)
+			require.NoError(t, err)
+			assert.Contains(t, addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: tc.address})
+			cidrs, err := gce.AliasRangesByProviderID(providerID)
+			require.NoError(t, err)
+			assert.Equal(t, []string{tc.aliasCIDR}, cidrs)
+
+			// Routes target the instance whatever the case of the hostname.
+			route := &cloudprovider.Route{TargetNode: types.NodeName(tc.hostname), DestinationCIDR: tc.aliasCIDR}
+			require.NoError(t, gce.CreateRoute(ctx, "my-cluster", string(tc.nodeName), route))
+			r, err := gce.c.Routes().Get(ctx, meta.GlobalKey("my-cluster-"+string(tc.nodeName)))
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("zones/%s/instances/%s", vals.ZoneName, tc.nodeName), r.NextHopInstance)
+		})
+	}
+}
@@ -0,0 +1,333 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// intentApplied is the outcome of an unacknowledged intent whose
+	// mutation is found to have been applied.
+	intentApplied = "applied"
+	// intentNotApplied is the outcome of an unacknowledged intent whose
+	// mutation is found not to have been applied.
+	intentNotApplied = "not applied"
+	// intentUnknown is the outcome of an unacknowledged intent whose effect
+	// can't be told from the existence of the resource.
+	intentUnknown = "unknown"
+
+	// intentLogCompactionThreshold is the number of records the intent log
+	// holds before it is compacted to its unacknowledged intents.
+	intentLogCompactionThreshold = 1000
+)
+
+// intentRecord is a line of the intent log. An intent is written before a
+// mutating GCE API call is issued, and acknowledged by a record with the same
+// ID and Done set once the call returned.
+type intentRecord struct {
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	Done        bool      `json:"done,omitempty"`
+	Operation   string    `json:"operation,omitempty"`
+	Resource    string    `json:"resource,omitempty"`
+	ResourceURL string    `json:"resourceURL,omitempty"`
+	OperationID string    `json:"operationID,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// intentLog is a local write-ahead log of the mutating GCE API calls.
+type intentLog struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	lastID uint64
+	// pending are the unacknowledged intents, which are kept when the log
+	// is compacted.
+	pending map[uint64]intentRecord
+	// records is the number of records in the log, compacted once it
+	// reaches compactAfter.
+	records      int
+	compactAfter int
+}
+
+// EnableIntentLog makes the audited mutations of the load balancer resources
+// and routes recorded to the intent log at path before they are issued, and
+// acknowledged once they return. The intents left unacknowledged by a previous
+// run, e.g. because it crashed, are reconciled first: whether their mutation
+// was applied is told from the existence of the resource and logged, and the
+// log is truncated. The log is then compacted to its unacknowledged intents
+// whenever it grows past intentLogCompactionThreshold records.
+func (g *Cloud) EnableIntentLog(path string) error {
+	pending, err := readUnacknowledgedIntents(path)
+	if err != nil {
+		return err
+	}
+	for _, intent := range pending {
+		outcome, err := g.reconcileIntent(intent)
+		klog.InfoS("Reconciled unacknowledged GCE resource mutation", "id", intent.ID, "time", intent.Time,
+			"operation", intent.Operation, "resource", intent.Resource, "resourceURL", intent.ResourceURL,
+			"outcome", outcome, "err", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	g.intentLog = &intentLog{path: path, file: f, pending: map[uint64]intentRecord{}, compactAfter: intentLogCompactionThreshold}
+	return nil
+}
+
+// readUnacknowledgedIntents returns the intents of the log at path that have
+// no acknowledgement, in the order they were written. A missing log has none.
+func readUnacknowledgedIntents(path string) ([]intentRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var order []uint64
+	intents := map[uint64]intentRecord{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r intentRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// The last line is torn if the process crashed while writing it.
+			klog.Warningf("Ignoring invalid intent log record %q: %v", scanner.Text(), err)
+			continue
+		}
+		if r.Done {
+			delete(intents, r.ID)
+			continue
+		}
+		order = append(order, r.ID)
+		intents[r.ID] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	var pending []intentRecord
+	for _, id := range order {
+		if r, ok := intents[id]; ok {
+			pending = append(pending, r)
+		}
+	}
+	return pending, nil
+}
+
+// reconcileIntent tells whether the mutation of an unacknowledged intent was
+// applied from the existence of its resource.
+func (g *Cloud) reconcileIntent(intent intentRecord) (string, error) {
+	id, err := cloud.ParseResourceURL(intent.ResourceURL)
+	if err != nil {
+		return intentUnknown, err
+	}
+	exists, err := g.intentResourceExists(intent.Resource, id.Key)
+	if err != nil {
+		return intentUnknown, err
+	}
+	switch {
+	case intent.Operation == "insert" && exists, intent.Operation == "delete" && !exists:
+		return intentApplied, nil
+	case intent.Operation == "insert", intent.Operation == "delete":
+		return intentNotApplied, nil
+	default:
+		return intentUnknown, nil
+	}
+}
+
+// intentResourceExists returns whether the resource with the given key
+// exists. It handles every resource of auditedResources, whose mutations
+// are all recorded to the intent log.
+func (g *Cloud) intentResourceExists(resource string, key *meta.Key) (bool, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	var err error
+	switch resource {
+	case "address":
+		_, err = g.c.Addresses().Get(ctx, key)
+	case "backend service":
+		_, err = g.c.BackendServices().Get(ctx, key)
+	case "firewall":
+		_, err = g.c.Firewalls().Get(ctx, key)
+	case "forwarding rule":
+		_, err = g.c.ForwardingRules().Get(ctx, key)
+	case "global address":
+		_, err = g.c.GlobalAddresses().Get(ctx, key)
+	case "global forwarding rule":
+		_, err = g.c.GlobalForwardingRules().Get(ctx, key)
+	case "health check":
+		_, err = g.c.HealthChecks().Get(ctx, key)
+	case "HTTP health check":
+		_, err = g.c.HttpHealthChecks().Get(ctx, key)
+	case "HTTPS health check":
+		_, err = g.c.HttpsHealthChecks().Get(ctx, key)
+	case "instance group":
+		_, err = g.c.InstanceGroups().Get(ctx, key)
+	case "network endpoint group":
+		_, err = g.c.NetworkEndpointGroups().Get(ctx, key)
+	case "region backend service":
+		_, err = g.c.RegionBackendServices().Get(ctx, key)
+	case "region health check":
+		_, err = g.c.RegionHealthChecks().Get(ctx, key)
+	case "route":
+		_, err = g.c.Routes().Get(ctx, key)
+	case "security policy":
+		_, err = g.c.BetaSecurityPolicies().Get(ctx, key)
+	case "service attachment":
+		_, err = g.c.ServiceAttachments().Get(ctx, key)
+	case "SSL certificate":
+		_, err = g.c.SslCertificates().Get(ctx, key)
+	case "target HTTP proxy":
+		_, err = g.c.TargetHttpProxies().Get(ctx, key)
+	case "target HTTPS proxy":
+		_, err = g.c.TargetHttpsProxies().Get(ctx, key)
+	case "target pool":
+		_, err = g.c.TargetPools().Get(ctx, key)
+	case "URL map":
+		_, err = g.c.UrlMaps().Get(ctx, key)
+	default:
+		return false, fmt.Errorf("unsupported resource %q", resource)
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// recordIntent writes the intent of the audited mutation to the log and
+// returns its ID. Failing to write the intent does not prevent the mutation.
+func (l *intentLog) recordIntent(a *mutationAudit) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	r := intentRecord{ID: l.lastID, Time: time.Now(), Operation: a.operation, Resource: a.resource, ResourceURL: a.resourceURL}
+	l.pending[r.ID] = r
+	l.write(r)
+	return l.lastID
+}
+
+// acknowledge writes the acknowledgement of the intent with the given ID,
+// once its mutation returned with err.
+func (l *intentLog) acknowledge(id uint64, a *mutationAudit, err error) {
+	a.mu.Lock()
+	r := intentRecord{ID: id, Time: time.Now(), Done: true, OperationID: a.operationID}
+	a.mu.Unlock()
+	if err != nil {
+		r.Error = err.Error()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.pending, id)
+	l.write(r)
+	if l.records >= l.compactAfter {
+		if err := l.compact(); err != nil {
+			klog.Errorf("Failed to compact intent log %s: %v", l.path, err)
+			// Retry once as many records are written again.
+			l.records = 0
+		}
+	}
+}
+
+// write appends the record to the log and syncs it to disk. It must be called
+// with l.mu held.
+func (l *intentLog) write(r intentRecord) {
+	err := writeIntentRecord(l.file, r)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		klog.Errorf("Failed to write intent log record %+v: %v", r, err)
+	}
+	l.records++
+}
+
+// compact replaces the log with one holding only its unacknowledged intents,
+// so that it does not grow without bound. The new log is written aside and
+// renamed over the log, so that a crash while compacting leaves either of
+// them. It must be called with l.mu held.
+func (l *intentLog) compact() error {
+	tmp := l.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	ids := make([]uint64, 0, len(l.pending))
+	for id := range l.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if err = writeIntentRecord(f, l.pending[id]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, l.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	l.file.Close()
+	l.file = f
+	l.records = len(ids)
+	return nil
+}
+
+// writeIntentRecord appends the record to f as a line.
+func writeIntentRecord(f *os.File, r intentRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// withIntent records the intent of the audited mutation, if the intent log is
+// enabled, and returns the function acknowledging it.
+func (g *Cloud) withIntent(a *mutationAudit) func(error) {
+	if g.intentLog == nil {
+		return func(error) {}
+	}
+	id := g.intentLog.recordIntent(a)
+	return func(err error) {
+		g.intentLog.acknowledge(id, a, err)
+	}
+}
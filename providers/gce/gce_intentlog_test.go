@@ -0,0 +1,194 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+)
+
+func readIntentLog(t *testing.T, path string) []intentRecord {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var records []intentRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r intentRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func writeIntentLog(t *testing.T, path string, records ...intentRecord) {
+	var lines []string
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		require.NoError(t, err)
+		lines = append(lines, string(line))
+	}
+	// A torn last line, as left by a crash while writing it.
+	lines = append(lines, `{"id":9,"ti`)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600))
+}
+
+func TestIntentLogRecordsMutations(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "intents.log")
+	require.NoError(t, gce.EnableIntentLog(path))
+
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "fw"}))
+	assert.Error(t, gce.DeleteFirewall("missing"))
+
+	records := readIntentLog(t, path)
+	require.Len(t, records, 4)
+	assert.Equal(t, intentRecord{ID: 1, Operation: "insert", Resource: "firewall", ResourceURL: records[0].ResourceURL}, withoutTime(records[0]))
+	assert.True(t, strings.HasSuffix(records[0].ResourceURL, "/global/firewalls/fw"), records[0].ResourceURL)
+	assert.Equal(t, intentRecord{ID: 1, Done: true}, withoutTime(records[1]))
+	assert.Equal(t, uint64(2), records[2].ID)
+	assert.Equal(t, "delete", records[2].Operation)
+	assert.True(t, records[3].Done)
+	assert.NotEmpty(t, records[3].Error)
+}
+
+func TestIntentLogCompaction(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "intents.log")
+	require.NoError(t, gce.EnableIntentLog(path))
+	gce.intentLog.compactAfter = 3
+
+	// An intent still unacknowledged when the log is compacted is kept.
+	pending := gce.intentLog.recordIntent(&mutationAudit{operation: "insert", resource: "firewall", resourceURL: "pending"})
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "fw"}))
+	records := readIntentLog(t, path)
+	require.Len(t, records, 1)
+	assert.Equal(t, pending, records[0].ID)
+	assert.False(t, records[0].Done)
+
+	// Records keep being appended to the compacted log.
+	gce.intentLog.compactAfter = intentLogCompactionThreshold
+	require.NoError(t, gce.DeleteFirewall("fw"))
+	records = readIntentLog(t, path)
+	require.Len(t, records, 3)
+	assert.Equal(t, "delete", records[1].Operation)
+	assert.True(t, records[2].Done)
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err), "the compacted log was not renamed: %v", err)
+}
+
+func TestIntentLogNotRecordedInDryRun(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "intents.log")
+	require.NoError(t, gce.EnableIntentLog(path))
+	gce.SetDryRun(true)
+
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "fw"}))
+
+	assert.Empty(t, readIntentLog(t, path))
+}
+
+func TestEnableIntentLogReconcilesUnacknowledgedIntents(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "created"}))
+	require.NoError(t, gce.CreateFirewall(&compute.Firewall{Name: "kept"}))
+	firewallURL := func(name string) string {
+		return cloud.SelfLink(meta.VersionGA, gce.projectID, "firewalls", meta.GlobalKey(name))
+	}
+	path := filepath.Join(t.TempDir(), "intents.log")
+	writeIntentLog(t, path,
+		intentRecord{ID: 1, Operation: "insert", Resource: "firewall", ResourceURL: firewallURL("acknowledged")},
+		intentRecord{ID: 1, Done: true},
+		intentRecord{ID: 2, Operation: "insert", Resource: "firewall", ResourceURL: firewallURL("created")},
+		intentRecord{ID: 3, Operation: "insert", Resource: "firewall", ResourceURL: firewallURL("not-created")},
+		intentRecord{ID: 4, Operation: "delete", Resource: "firewall", ResourceURL: firewallURL("kept")},
+		intentRecord{ID: 5, Operation: "patch", Resource: "firewall", ResourceURL: firewallURL("kept")},
+	)
+
+	pending, err := readUnacknowledgedIntents(path)
+	require.NoError(t, err)
+	var outcomes []string
+	for _, intent := range pending {
+		outcome, err := gce.reconcileIntent(intent)
+		require.NoError(t, err)
+		outcomes = append(outcomes, outcome)
+	}
+	assert.Equal(t, []string{intentApplied, intentNotApplied, intentNotApplied, intentUnknown}, outcomes)
+
+	require.NoError(t, gce.EnableIntentLog(path))
+	assert.Empty(t, readIntentLog(t, path))
+}
+
+func TestReconcileIntentAuditedResources(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	regional := map[string]bool{
+		"address":                true,
+		"forwarding rule":        true,
+		"region backend service": true,
+		"region health check":    true,
+		"service attachment":     true,
+		"target pool":            true,
+	}
+	zonal := map[string]bool{
+		"instance group":         true,
+		"network endpoint group": true,
+	}
+	for resource, r := range auditedResources {
+		key := meta.GlobalKey("not-created")
+		switch {
+		case regional[resource]:
+			key = meta.RegionalKey("not-created", vals.Region)
+		case zonal[resource]:
+			key = meta.ZonalKey("not-created", vals.ZoneName)
+		}
+		intent := intentRecord{ID: 1, Operation: "insert", Resource: resource, ResourceURL: cloud.SelfLink(meta.VersionGA, gce.projectID, r.collection, key)}
+		outcome, err := gce.reconcileIntent(intent)
+		assert.NoError(t, err, resource)
+		assert.Equal(t, intentNotApplied, outcome, resource)
+	}
+}
+
+func TestReadUnacknowledgedIntentsMissingLog(t *testing.T) {
+	pending, err := readUnacknowledgedIntents(filepath.Join(t.TempDir(), "intents.log"))
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func withoutTime(r intentRecord) intentRecord {
+	r.Time = time.Time{}
+	return r
+}
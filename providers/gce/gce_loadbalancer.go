@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -110,32 +111,79 @@ func (g *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, svc *v1
 	fwd, err := g.GetRegionForwardingRule(loadBalancerName, g.region)
 	if err == nil {
 		status := &v1.LoadBalancerStatus{}
-		status.Ingress = []v1.LoadBalancerIngress{{IP: fwd.IPAddress}}
+		status.Ingress = []v1.LoadBalancerIngress{{IP: fwd.IPAddress, IPMode: loadBalancerIPMode(fwd.LoadBalancingScheme)}}
 
 		return status, true, nil
 	}
 	// Checking for finalizer is more accurate because controller restart could happen in the middle of resource
 	// deletion. So even though forwarding rule was deleted, cleanup might not have been complete.
-	if hasFinalizer(svc, ILBFinalizerV1) {
+	if hasFinalizer(svc, ILBFinalizerV1) || hasFinalizer(svc, NetLBFinalizerV1) {
 		return &v1.LoadBalancerStatus{}, true, nil
 	}
 	return nil, false, ignoreNotFound(err)
 }
 
+// managesLoadBalancerClass returns whether the load balancer of the Service
+// is managed by this provider, i.e. the Service has no LoadBalancerClass or
+// the class claimed by the load-balancer-class config option.
+func (g *Cloud) managesLoadBalancerClass(svc *v1.Service) bool {
+	if svc.Spec.LoadBalancerClass == nil {
+		return true
+	}
+	return g.loadBalancerClass != "" && *svc.Spec.LoadBalancerClass == g.loadBalancerClass
+}
+
+// LoadBalancerClass returns the LoadBalancerClass claimed by the
+// load-balancer-class config option, or "" if none is.
+func (g *Cloud) LoadBalancerClass() string {
+	return g.loadBalancerClass
+}
+
 // GetLoadBalancerName is an implementation of LoadBalancer.GetLoadBalancerName.
 func (g *Cloud) GetLoadBalancerName(ctx context.Context, clusterName string, svc *v1.Service) string {
-	// TODO: replace DefaultLoadBalancerName to generate more meaningful loadbalancer names.
-	return cloudprovider.DefaultLoadBalancerName(svc)
+	return g.loadBalancerName(svc)
 }
 
 // EnsureLoadBalancer is an implementation of LoadBalancer.EnsureLoadBalancer.
 func (g *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, svc *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
-	// GCE load balancers do not support services with LoadBalancerClass set. LoadBalancerClass can't be updated for an existing load balancer, so here we don't need to clean any resources.
+	g.handleDeprecatedServiceAnnotations(svc)
+	// Stop draining the load balancer if the Service type was changed back.
+	if err := g.resetLoadBalancerDrain(svc); err != nil {
+		return nil, err
+	}
+	if g.l4LBUnchanged(svc, nodes, l4LBSyncOperationEnsure) {
+		return svc.Status.LoadBalancer.DeepCopy(), nil
+	}
+	defer g.auditMutationsFor(svc)()
+	defer g.boundCallsFor(ctx, svc)()
+	ctx, endSpan := g.traceLoadBalancerSync(ctx, "EnsureLoadBalancer", svc)
+	if err := g.ensureLoadBalancerNamePrefixAnnotation(svc); err != nil {
+		endSpan(err)
+		return nil, err
+	}
+	start := time.Now()
+	status, err := g.ensureLoadBalancer(ctx, clusterName, svc, nodes)
+	endSpan(err)
+	g.observeL4LBSync(svc, l4LBSyncOperationEnsure, start, err)
+	g.syncHealth.record(SyncLoopService, err)
+	if err == nil {
+		g.ensureL4LBChecksumAnnotation(svc, nodes)
+	} else {
+		g.recordCloudErrorEvent(svc, "EnsureLoadBalancer", err)
+	}
+	return status, err
+}
+
+func (g *Cloud) ensureLoadBalancer(ctx context.Context, clusterName string, svc *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	// GCE load balancers only support services without LoadBalancerClass or with the class claimed by the provider. LoadBalancerClass can't be updated for an existing load balancer, so here we don't need to clean any resources.
 	// Check API documentation for .Spec.LoadBalancerClass for details on when this field is allowed to be changed.
-	if svc.Spec.LoadBalancerClass != nil {
-		klog.Infof("Ignoring service %s/%s using load balancer class %s, it is not supported by this controller.", svc.Namespace, svc.Name, svc.Spec.LoadBalancerClass)
+	if !g.managesLoadBalancerClass(svc) {
+		klog.Infof("Ignoring service %s/%s using load balancer class %s, it is not supported by this controller.", svc.Namespace, svc.Name, *svc.Spec.LoadBalancerClass)
 		return nil, cloudprovider.ImplementedElsewhere
 	}
+	if err := validateLoadBalancerNamePrefixAnnotation(svc); err != nil {
+		return nil, err
+	}
 
 	loadBalancerName := g.GetLoadBalancerName(ctx, clusterName, svc)
 	desiredScheme := getSvcScheme(svc)
@@ -144,10 +192,10 @@ func (g *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, svc
 		return nil, err
 	}
 
-	// Services with multiples protocols are not supported by this controller, warn the users and sets
-	// the corresponding Service Status Condition.
+	// Services with multiples protocols are only supported by some load balancers, warn the users and sets
+	// the corresponding Service Status Condition otherwise.
 	// https://github.com/kubernetes/enhancements/tree/master/keps/sig-network/1435-mixed-protocol-lb
-	if err := checkMixedProtocol(svc.Spec.Ports); err != nil {
+	if err := checkMixedProtocol(svc.Spec.Ports); err != nil && !g.mixedProtocolSupported(svc) {
 		if hasLoadBalancerPortsError(svc) {
 			return nil, err
 		}
@@ -200,6 +248,14 @@ func (g *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, svc
 	case cloud.SchemeInternal:
 		status, err = g.ensureInternalLoadBalancer(clusterName, clusterID, svc, existingFwdRule, nodes)
 	default:
+		if _, ipv6 := serviceIPFamilies(svc); ipv6 && featureEnabled(DualStackLoadBalancers) {
+			if requiresDualStack(svc) {
+				err := fmt.Errorf("ipFamilyPolicy %s is only supported by internal LoadBalancer Services", v1.IPFamilyPolicyRequireDualStack)
+				g.eventRecorder.Event(svc, v1.EventTypeWarning, "IPv6LoadBalancerNotSupported", err.Error())
+				return nil, err
+			}
+			g.eventRecorder.Event(svc, v1.EventTypeWarning, "IPv6LoadBalancerNotSupported", "IPv6 is only supported by internal LoadBalancer Services, the load balancer only serves IPv4.")
+		}
 		status, err = g.ensureExternalLoadBalancer(clusterName, clusterID, svc, existingFwdRule, nodes)
 	}
 	if err != nil {
@@ -212,12 +268,36 @@ func (g *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, svc
 
 // UpdateLoadBalancer is an implementation of LoadBalancer.UpdateLoadBalancer.
 func (g *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, svc *v1.Service, nodes []*v1.Node) error {
-	// GCE load balancers do not support services with LoadBalancerClass set. LoadBalancerClass can't be updated for an existing load balancer, so here we don't need to clean any resources.
+	g.handleDeprecatedServiceAnnotations(svc)
+	if g.l4LBUnchanged(svc, nodes, l4LBSyncOperationUpdate) {
+		return nil
+	}
+	defer g.auditMutationsFor(svc)()
+	defer g.boundCallsFor(ctx, svc)()
+	ctx, endSpan := g.traceLoadBalancerSync(ctx, "UpdateLoadBalancer", svc)
+	start := time.Now()
+	err := g.updateLoadBalancer(ctx, clusterName, svc, nodes)
+	endSpan(err)
+	g.observeL4LBSync(svc, l4LBSyncOperationUpdate, start, err)
+	g.syncHealth.record(SyncLoopService, err)
+	if err == nil {
+		g.ensureL4LBChecksumAnnotation(svc, nodes)
+	} else {
+		g.recordCloudErrorEvent(svc, "UpdateLoadBalancer", err)
+	}
+	return err
+}
+
+func (g *Cloud) updateLoadBalancer(ctx context.Context, clusterName string, svc *v1.Service, nodes []*v1.Node) error {
+	// GCE load balancers only support services without LoadBalancerClass or with the class claimed by the provider. LoadBalancerClass can't be updated for an existing load balancer, so here we don't need to clean any resources.
 	// Check API documentation for .Spec.LoadBalancerClass for details on when this field is allowed to be changed.
-	if svc.Spec.LoadBalancerClass != nil {
-		klog.Infof("Ignoring service %s/%s using load balancer class %s, it is not supported by this controller.", svc.Namespace, svc.Name, svc.Spec.LoadBalancerClass)
+	if !g.managesLoadBalancerClass(svc) {
+		klog.Infof("Ignoring service %s/%s using load balancer class %s, it is not supported by this controller.", svc.Namespace, svc.Name, *svc.Spec.LoadBalancerClass)
 		return cloudprovider.ImplementedElsewhere
 	}
+	if err := validateLoadBalancerNamePrefixAnnotation(svc); err != nil {
+		return err
+	}
 
 	loadBalancerName := g.GetLoadBalancerName(ctx, clusterName, svc)
 	scheme := getSvcScheme(svc)
@@ -226,10 +306,10 @@ func (g *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, svc
 		return err
 	}
 
-	// Services with multiples protocols are not supported by this controller, warn the users and sets
-	// the corresponding Service Status Condition, but keep processing the Update to not break upgrades.
+	// Services with multiples protocols are only supported by some load balancers, warn the users and sets
+	// the corresponding Service Status Condition otherwise, but keep processing the Update to not break upgrades.
 	// https://github.com/kubernetes/enhancements/tree/master/keps/sig-network/1435-mixed-protocol-lb
-	if err := checkMixedProtocol(svc.Spec.Ports); err != nil && !hasLoadBalancerPortsError(svc) {
+	if err := checkMixedProtocol(svc.Spec.Ports); err != nil && !hasLoadBalancerPortsError(svc) && !g.mixedProtocolSupported(svc) {
 		klog.Warningf("Ignoring update for service %s/%s using different ports protocols", svc.Namespace, svc.Name)
 		g.eventRecorder.Event(svc, v1.EventTypeWarning, v1.LoadBalancerPortsErrorReason, "LoadBalancer with multiple protocols are not supported.")
 		svcApplyStatus := corev1apply.ServiceStatus().WithConditions(
@@ -259,6 +339,31 @@ func (g *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, svc
 
 // EnsureLoadBalancerDeleted is an implementation of LoadBalancer.EnsureLoadBalancerDeleted.
 func (g *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, svc *v1.Service) error {
+	defer g.auditMutationsFor(svc)()
+	defer g.boundCallsFor(ctx, svc)()
+	ctx, endSpan := g.traceLoadBalancerSync(ctx, "EnsureLoadBalancerDeleted", svc)
+	start := time.Now()
+	err := g.ensureLoadBalancerDeleted(ctx, clusterName, svc)
+	endSpan(err)
+	g.observeL4LBSync(svc, l4LBSyncOperationDelete, start, err)
+	g.syncHealth.record(SyncLoopService, err)
+	if err != nil {
+		g.recordCloudErrorEvent(svc, "EnsureLoadBalancerDeleted", err)
+		return err
+	}
+	g.firewallCommands.forget(svc)
+	return nil
+}
+
+func (g *Cloud) ensureLoadBalancerDeleted(ctx context.Context, clusterName string, svc *v1.Service) error {
+	// Services of other classes never got a load balancer from this controller.
+	if !g.managesLoadBalancerClass(svc) {
+		klog.Infof("Ignoring service %s/%s using load balancer class %s, it is not supported by this controller.", svc.Namespace, svc.Name, *svc.Spec.LoadBalancerClass)
+		return cloudprovider.ImplementedElsewhere
+	}
+	if err := g.checkLoadBalancerDrained(svc, time.Now()); err != nil {
+		return err
+	}
 	loadBalancerName := g.GetLoadBalancerName(ctx, clusterName, svc)
 	scheme := getSvcScheme(svc)
 	clusterID, err := g.ClusterID.GetID()
@@ -278,6 +383,19 @@ func (g *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName strin
 	return err
 }
 
+// loadBalancerIPMode returns the ipMode to report in the Service status for a
+// load balancer with the given scheme. Passthrough load balancers deliver
+// packets with the load balancer IP as destination, while proxy-based (managed)
+// load balancers terminate connections and deliver them from the proxies.
+func loadBalancerIPMode(scheme string) *v1.LoadBalancerIPMode {
+	ipMode := v1.LoadBalancerIPModeVIP
+	switch strings.ToUpper(scheme) {
+	case "EXTERNAL_MANAGED", "INTERNAL_MANAGED":
+		ipMode = v1.LoadBalancerIPModeProxy
+	}
+	return &ipMode
+}
+
 func getSvcScheme(svc *v1.Service) cloud.LbScheme {
 	if t := GetLoadBalancerAnnotationType(svc); t == LBTypeInternal {
 		return cloud.SchemeInternal
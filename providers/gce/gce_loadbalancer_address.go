@@ -0,0 +1,172 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	netutils "k8s.io/utils/net"
+)
+
+// requestedLoadBalancerIP returns the IP address requested for the load
+// balancer of svc: the IP of the address named by the
+// ServiceAnnotationLoadBalancerIPAddressName annotation, or
+// svc.Spec.LoadBalancerIP. The named address is reserved in the region of the
+// cluster if it does not exist. It is treated as owned by the user, so it is
+// never released by the controller, even if it was reserved by it.
+func (g *Cloud) requestedLoadBalancerIP(svc *v1.Service, scheme cloud.LbScheme, subnetworkURL string, netTier cloud.NetworkTier) (string, error) {
+	name := GetLoadBalancerAnnotationIPAddressName(svc)
+	if name == "" {
+		return svc.Spec.LoadBalancerIP, nil
+	}
+	addr, err := g.GetRegionAddress(name, g.region)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+	if addr == nil {
+		if addr, err = g.reserveNamedLoadBalancerAddress(svc, name, scheme, subnetworkURL, netTier); err != nil {
+			return "", err
+		}
+	}
+	if addr.AddressType != "" && addr.AddressType != string(scheme) {
+		return "", fmt.Errorf("address %q named by annotation %s has type %s, expected %s", name, ServiceAnnotationLoadBalancerIPAddressName, addr.AddressType, scheme)
+	}
+	if scheme == cloud.SchemeInternal && addr.Subnetwork != "" && getNameFromLink(addr.Subnetwork) != getNameFromLink(subnetworkURL) {
+		return "", fmt.Errorf("address %q named by annotation %s is in subnetwork %q, expected %q", name, ServiceAnnotationLoadBalancerIPAddressName, getNameFromLink(addr.Subnetwork), getNameFromLink(subnetworkURL))
+	}
+	if svc.Spec.LoadBalancerIP != "" && svc.Spec.LoadBalancerIP != addr.Address {
+		return "", fmt.Errorf("address %q named by annotation %s has IP %q, but spec.loadBalancerIP is %q", name, ServiceAnnotationLoadBalancerIPAddressName, addr.Address, svc.Spec.LoadBalancerIP)
+	}
+	return addr.Address, nil
+}
+
+// reserveNamedLoadBalancerAddress reserves the regional address name for the
+// load balancer of svc. Global addresses cannot be used by the regional
+// forwarding rules of L4 load balancers, so a global address with that name
+// is reported as an error instead of being shadowed by a regional one.
+func (g *Cloud) reserveNamedLoadBalancerAddress(svc *v1.Service, name string, scheme cloud.LbScheme, subnetworkURL string, netTier cloud.NetworkTier) (*compute.Address, error) {
+	if _, err := g.GetGlobalAddress(name); err == nil {
+		return nil, fmt.Errorf("address %q named by annotation %s is global, L4 load balancers require a regional address", name, ServiceAnnotationLoadBalancerIPAddressName)
+	} else if !isNotFound(err) {
+		return nil, err
+	}
+	addr := &compute.Address{
+		Name:        name,
+		Description: fmt.Sprintf(`{"kubernetes.io/service-name":"%s/%s"}`, svc.Namespace, svc.Name),
+		AddressType: string(scheme),
+	}
+	if scheme == cloud.SchemeInternal {
+		addr.Subnetwork = subnetworkURL
+	} else {
+		addr.NetworkTier = netTier.ToGCEValue()
+	}
+	klog.Infof("Reserving address %q in region %s for service %s/%s", name, g.region, svc.Namespace, svc.Name)
+	if err := g.ReserveRegionAddress(addr, g.region); err != nil {
+		return nil, fmt.Errorf("failed to reserve address %q named by annotation %s: %w", name, ServiceAnnotationLoadBalancerIPAddressName, err)
+	}
+	return g.GetRegionAddress(name, g.region)
+}
+
+// invalidLoadBalancerIPReason is the reason of the events of the Services
+// whose requested internal load balancer IP cannot be used.
+const invalidLoadBalancerIPReason = "InvalidLoadBalancerIP"
+
+// internalLoadBalancerSubnetPurposes are the purposes of the subnetworks the
+// IP of an internal passthrough load balancer can be allocated from.
+var internalLoadBalancerSubnetPurposes = sets.NewString("", "PRIVATE", "PRIVATE_RFC_1918")
+
+// validateInternalLoadBalancerIP checks that the IP requested for the internal
+// load balancer of svc can be used before its forwarding rule is created:
+// that the subnetwork exists in the region of the cluster with a purpose
+// compatible with internal load balancers, that it contains the IP, and that
+// the IP is free, reserved but not used by another resource, or reserved to
+// be shared by load balancers with purpose SHARED_LOADBALANCER_VIP. A warning
+// event is recorded on svc if it cannot be used.
+func (g *Cloud) validateInternalLoadBalancerIP(svc *v1.Service, loadBalancerName, ip, subnetworkURL string) error {
+	if ip == "" || subnetworkURL == "" || g.IsLegacyNetwork() {
+		return nil
+	}
+	err := g.internalLoadBalancerIPError(loadBalancerName, ip, subnetworkURL)
+	if err != nil {
+		g.eventRecorder.Event(svc, v1.EventTypeWarning, invalidLoadBalancerIPReason, err.Error())
+	}
+	return err
+}
+
+func (g *Cloud) internalLoadBalancerIPError(loadBalancerName, ip, subnetworkURL string) error {
+	id, err := cloud.ParseResourceURL(subnetworkURL)
+	if err != nil {
+		return fmt.Errorf("invalid subnetwork %q for load balancer IP %s: %v", subnetworkURL, ip, err)
+	}
+	if id.Key.Region != g.region {
+		return fmt.Errorf("subnetwork %q of load balancer IP %s is in region %s, expected %s", id.Key.Name, ip, id.Key.Region, g.region)
+	}
+	subnet, err := g.GetSubnetwork(g.region, id.Key.Name)
+	if isNotFound(err) {
+		return fmt.Errorf("subnetwork %q of load balancer IP %s does not exist in region %s", id.Key.Name, ip, g.region)
+	}
+	if isForbidden(err) {
+		// The subnetwork may belong to a host project the controller cannot
+		// read, leave the validation to GCE.
+		klog.V(2).Infof("Not validating load balancer IP %s against subnetwork %q: %v", ip, id.Key.Name, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !internalLoadBalancerSubnetPurposes.Has(subnet.Purpose) {
+		return fmt.Errorf("subnetwork %q of load balancer IP %s has purpose %s, internal load balancers require a subnetwork of purpose PRIVATE", subnet.Name, ip, subnet.Purpose)
+	}
+	_, cidr, err := netutils.ParseCIDRSloppy(subnet.IpCidrRange)
+	if err != nil {
+		return fmt.Errorf("invalid range %q of subnetwork %q: %v", subnet.IpCidrRange, subnet.Name, err)
+	}
+	if parsed := netutils.ParseIPSloppy(ip); parsed == nil || !cidr.Contains(parsed) {
+		return fmt.Errorf("load balancer IP %s is not in the range %s of subnetwork %q", ip, subnet.IpCidrRange, subnet.Name)
+	}
+
+	addr, err := g.GetRegionAddressByIP(g.region, ip)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if addr.AddressType != "" && addr.AddressType != string(cloud.SchemeInternal) {
+		return fmt.Errorf("load balancer IP %s is reserved by address %q of type %s, expected %s", ip, addr.Name, addr.AddressType, cloud.SchemeInternal)
+	}
+	if addr.Purpose == sharedLoadBalancerVIPPurpose {
+		// The forwarding rules of several load balancers share the address,
+		// GCE rejects the ones whose ports overlap.
+		return nil
+	}
+	for _, user := range addr.Users {
+		if !strings.HasPrefix(getNameFromLink(user), loadBalancerName) {
+			return fmt.Errorf("load balancer IP %s of address %q is already used by %s", ip, addr.Name, user)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExternalLoadBalancerIPAddressName(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationLoadBalancerIPAddressName] = "my-address"
+	status, err := createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	addr, err := gce.GetRegionAddress("my-address", vals.Region)
+	require.NoError(t, err, "the named address should be reserved")
+	assert.Equal(t, string(cloud.SchemeExternal), addr.AddressType)
+	require.NotEmpty(t, status.Ingress)
+	assert.Equal(t, addr.Address, status.Ingress[0].IP)
+
+	err = gce.ensureExternalLoadBalancerDeleted(vals.ClusterName, vals.ClusterID, svc)
+	require.NoError(t, err)
+	_, err = gce.GetRegionAddress("my-address", vals.Region)
+	assert.NoError(t, err, "the named address should not be released")
+}
+
+func TestInternalLoadBalancerIPAddressName(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	err = gce.ReserveRegionAddress(&compute.Address{
+		Name:        "my-address",
+		Address:     "10.0.0.10",
+		AddressType: string(cloud.SchemeInternal),
+		Subnetwork:  gce.SubnetworkURL(),
+	}, vals.Region)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationLoadBalancerIPAddressName] = "my-address"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	status, err := createInternalLoadBalancer(gce, svc, nil, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	require.NotEmpty(t, status.Ingress)
+	assert.Equal(t, "10.0.0.10", status.Ingress[0].IP)
+
+	err = gce.ensureInternalLoadBalancerDeleted(vals.ClusterName, vals.ClusterID, svc)
+	require.NoError(t, err)
+	_, err = gce.GetRegionAddress("my-address", vals.Region)
+	assert.NoError(t, err, "the named address should not be released")
+}
+
+func TestRequestedLoadBalancerIPErrors(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	require.NoError(t, gce.ReserveGlobalAddress(&compute.Address{Name: "global-address"}))
+	require.NoError(t, gce.ReserveRegionAddress(&compute.Address{Name: "internal-address", Address: "10.0.0.20", AddressType: string(cloud.SchemeInternal)}, vals.Region))
+	require.NoError(t, gce.ReserveRegionAddress(&compute.Address{Name: "external-address", Address: "1.2.3.4", AddressType: string(cloud.SchemeExternal)}, vals.Region))
+
+	for _, tc := range []struct {
+		desc           string
+		addressName    string
+		loadBalancerIP string
+	}{
+		{desc: "global address", addressName: "global-address"},
+		{desc: "address type mismatch", addressName: "internal-address"},
+		{desc: "spec.loadBalancerIP mismatch", addressName: "external-address", loadBalancerIP: "5.6.7.8"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := fakeLoadbalancerService("")
+			svc.Annotations[ServiceAnnotationLoadBalancerIPAddressName] = tc.addressName
+			svc.Spec.LoadBalancerIP = tc.loadBalancerIP
+			_, err := gce.requestedLoadBalancerIP(svc, cloud.SchemeExternal, "", cloud.NetworkTierDefault)
+			assert.Error(t, err)
+		})
+	}
+
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationLoadBalancerIPAddressName] = "external-address"
+	ip, err := gce.requestedLoadBalancerIP(svc, cloud.SchemeExternal, "", cloud.NetworkTierDefault)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", ip)
+}
@@ -0,0 +1,149 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/pkg/version"
+	servicehelper "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+var l4LBChecksumSkipCount = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Name:           "cloudprovider_gce_l4_lb_checksum_skips_total",
+		Help:           "Number of L4 load balancer syncs skipped because the desired state checksum did not change",
+		StabilityLevel: metrics.ALPHA,
+	},
+	[]string{"operation"}, // ensure or update.
+)
+
+// init registers the L4 load balancer checksum metrics.
+func init() {
+	legacyregistry.MustRegister(l4LBChecksumSkipCount)
+}
+
+// l4LBDesiredState is the input of the L4 load balancer checksum: everything
+// the load balancer resources are derived from, including the cloud config,
+// the features and the version of the controller, so that the load balancers
+// are synced again once they change.
+type l4LBDesiredState struct {
+	Spec          v1.ServiceSpec    `json:"spec"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+	Nodes         []string          `json:"nodes"`
+	Config        *ConfigFile       `json:"config,omitempty"`
+	Features      map[string]bool   `json:"features"`
+	AlphaFeatures map[string]bool   `json:"alphaFeatures,omitempty"`
+	Version       string            `json:"version"`
+}
+
+// l4LBChecksum returns the checksum of the desired state of the load balancer
+// of svc with the given nodes. The annotations set by the controller itself
+// are ignored, so that setting them does not change the checksum.
+func (g *Cloud) l4LBChecksum(svc *v1.Service, nodes []*v1.Node) (string, error) {
+	state := l4LBDesiredState{
+		Spec:     svc.Spec,
+		Nodes:    nodeNames(nodes),
+		Config:   g.getConfigFile(),
+		Features: map[string]bool{},
+		Version:  version.Get().GitVersion,
+	}
+	for feature := range defaultFeatureGates {
+		state.Features[string(feature)] = featureEnabled(feature)
+	}
+	if g.AlphaFeatureGate != nil {
+		state.AlphaFeatures = g.AlphaFeatureGate.features
+	}
+	for k, v := range svc.Annotations {
+		if k == ServiceAnnotationLoadBalancerChecksum || k == ServiceAnnotationLoadBalancerSyncStatus {
+			continue
+		}
+		if state.Annotations == nil {
+			state.Annotations = map[string]string{}
+		}
+		state.Annotations[k] = v
+	}
+	sort.Strings(state.Nodes)
+	out, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// l4LBUnchanged returns whether the load balancer of svc was already synced
+// with the desired state of svc and nodes, in which case the sync can be
+// skipped without reading the GCE resources. Services without a load balancer
+// ingress in their status are always synced, as their load balancer may have
+// been deleted since the checksum was recorded.
+func (g *Cloud) l4LBUnchanged(svc *v1.Service, nodes []*v1.Node, operation string) bool {
+	if !g.AlphaFeatureGate.Enabled(AlphaFeatureL4LBChecksum) || g.dryRun {
+		return false
+	}
+	recorded, ok := svc.Annotations[ServiceAnnotationLoadBalancerChecksum]
+	if !ok || len(svc.Status.LoadBalancer.Ingress) == 0 {
+		return false
+	}
+	checksum, err := g.l4LBChecksum(svc, nodes)
+	if err != nil {
+		klog.Warningf("Failed to compute the load balancer checksum of service %s/%s: %v", svc.Namespace, svc.Name, err)
+		return false
+	}
+	if checksum != recorded {
+		return false
+	}
+	klog.V(4).Infof("Skipping %s of the load balancer of service %s/%s, its desired state did not change (checksum %s)", operation, svc.Namespace, svc.Name, checksum)
+	l4LBChecksumSkipCount.WithLabelValues(operation).Inc()
+	return true
+}
+
+// ensureL4LBChecksumAnnotation records the checksum of the desired state of
+// the load balancer of svc after a successful sync. Changes made to the GCE
+// resources outside of the controller are not repaired until the checksum
+// changes or the annotation is removed.
+func (g *Cloud) ensureL4LBChecksumAnnotation(svc *v1.Service, nodes []*v1.Node) {
+	if !g.AlphaFeatureGate.Enabled(AlphaFeatureL4LBChecksum) || g.dryRun {
+		return
+	}
+	checksum, err := g.l4LBChecksum(svc, nodes)
+	if err != nil {
+		klog.Warningf("Failed to compute the load balancer checksum of service %s/%s: %v", svc.Namespace, svc.Name, err)
+		return
+	}
+	if svc.Annotations[ServiceAnnotationLoadBalancerChecksum] == checksum {
+		return
+	}
+	updated := svc.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[ServiceAnnotationLoadBalancerChecksum] = checksum
+	if _, err := servicehelper.PatchService(g.client.CoreV1(), svc, updated); err != nil {
+		klog.Warningf("Failed to set annotation %q on service %s/%s: %v", ServiceAnnotationLoadBalancerChecksum, svc.Namespace, svc.Name, err)
+	}
+}
@@ -0,0 +1,153 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/featuregate"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestL4LBChecksum(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}},
+	}
+	checksum, err := gce.l4LBChecksum(svc, nodes)
+	require.NoError(t, err)
+
+	reordered, err := gce.l4LBChecksum(svc, []*v1.Node{nodes[1], nodes[0]})
+	require.NoError(t, err)
+	assert.Equal(t, checksum, reordered, "node order should not change the checksum")
+
+	annotated := svc.DeepCopy()
+	annotated.Annotations[ServiceAnnotationLoadBalancerChecksum] = checksum
+	annotated.Annotations[ServiceAnnotationLoadBalancerSyncStatus] = l4LBSyncResultSuccess
+	got, err := gce.l4LBChecksum(annotated, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, checksum, got, "annotations set by the controller should not change the checksum")
+
+	annotated.Annotations[ServiceAnnotationILBAllowGlobalAccess] = "true"
+	got, err = gce.l4LBChecksum(annotated, nodes)
+	require.NoError(t, err)
+	assert.NotEqual(t, checksum, got, "user annotations should change the checksum")
+
+	changed := svc.DeepCopy()
+	changed.Spec.Ports[0].Port++
+	got, err = gce.l4LBChecksum(changed, nodes)
+	require.NoError(t, err)
+	assert.NotEqual(t, checksum, got, "the spec should change the checksum")
+
+	got, err = gce.l4LBChecksum(svc, nodes[:1])
+	require.NoError(t, err)
+	assert.NotEqual(t, checksum, got, "the nodes should change the checksum")
+
+	gce.configFile = &ConfigFile{}
+	gce.configFile.Global.NodeTags = []string{"tag"}
+	got, err = gce.l4LBChecksum(svc, nodes)
+	require.NoError(t, err)
+	assert.NotEqual(t, checksum, got, "the cloud config should change the checksum")
+	gce.configFile = nil
+
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureILBSubsets})
+	got, err = gce.l4LBChecksum(svc, nodes)
+	require.NoError(t, err)
+	assert.NotEqual(t, checksum, got, "the alpha features should change the checksum")
+	gce.AlphaFeatureGate = nil
+
+	gate := featuregate.NewFeatureGate()
+	require.NoError(t, AddFeatureGates(gate))
+	require.NoError(t, gate.Set(string(DualStackLoadBalancers)+"=true"))
+	SetFeatureGate(gate)
+	defer SetFeatureGate(newFeatureGate())
+	got, err = gce.l4LBChecksum(svc, nodes)
+	require.NoError(t, err)
+	assert.NotEqual(t, checksum, got, "the feature gates should change the checksum")
+}
+
+func TestEnsureLoadBalancerSkipsUnchanged(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureL4LBChecksum})
+
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Namespace = "lb-checksum"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	checksum, err := gce.l4LBChecksum(svc, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, checksum, svc.Annotations[ServiceAnnotationLoadBalancerChecksum])
+
+	// Without a load balancer ingress in the status, the load balancer is
+	// synced even though the checksum did not change.
+	gce.c.(*cloud.MockGCE).MockForwardingRules.GetHook = mock.GetForwardingRulesInternalErrHook
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	assert.Error(t, err)
+
+	// Unchanged load balancers are not read from GCE.
+	svc.Status.LoadBalancer = *status
+	got, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, status, got)
+	updateSkipsBefore, err := testutil.GetCounterMetricValue(l4LBChecksumSkipCount.WithLabelValues(l4LBSyncOperationUpdate))
+	require.NoError(t, err)
+	require.NoError(t, gce.UpdateLoadBalancer(context.Background(), vals.ClusterName, svc, nodes))
+	updateSkips, err := testutil.GetCounterMetricValue(l4LBChecksumSkipCount.WithLabelValues(l4LBSyncOperationUpdate))
+	require.NoError(t, err)
+	assert.Equal(t, updateSkipsBefore+1, updateSkips)
+
+	// A change of the node set syncs the load balancer.
+	moreNodes, err := createAndInsertNodes(gce, []string{"test-node-1", "test-node-2"}, vals.ZoneName)
+	require.NoError(t, err)
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, moreNodes)
+	assert.Error(t, err)
+
+	gce.c.(*cloud.MockGCE).MockForwardingRules.GetHook = nil
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, moreNodes)
+	require.NoError(t, err)
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	checksum, err = gce.l4LBChecksum(svc, moreNodes)
+	require.NoError(t, err)
+	assert.Equal(t, checksum, svc.Annotations[ServiceAnnotationLoadBalancerChecksum])
+}
@@ -0,0 +1,256 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"encoding/json"
+	"sync"
+
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// deregistrationWorkqueueName is the name of the queue of the nodes to
+	// remove from the load balancers.
+	deregistrationWorkqueueName = "gce-lb-deregistrations"
+	// deregistrationBatchSize is the maximum number of nodes removed from
+	// the load balancers at once.
+	deregistrationBatchSize = 100
+	// deregistrationMaxRetries is the number of times the removal of a node
+	// is retried before leaving it to the service controller.
+	deregistrationMaxRetries = 5
+)
+
+// loadBalancerDeregistrations queues the nodes to remove from the backends of
+// the load balancers. Its zero value is ready to use.
+type loadBalancerDeregistrations struct {
+	once  sync.Once
+	queue workqueue.RateLimitingInterface
+
+	mu sync.Mutex
+	// nodes are the last versions of the queued nodes by name.
+	nodes map[string]*v1.Node
+}
+
+func (d *loadBalancerDeregistrations) getQueue() workqueue.RateLimitingInterface {
+	d.once.Do(func() {
+		d.queue = workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{Name: deregistrationWorkqueueName})
+	})
+	return d.queue
+}
+
+func (d *loadBalancerDeregistrations) add(node *v1.Node) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.nodes == nil {
+		d.nodes = map[string]*v1.Node{}
+	}
+	d.nodes[node.Name] = node
+	d.getQueue().Add(node.Name)
+}
+
+// excludedFromLoadBalancers returns whether the node is labeled to be left out
+// of the backends of the load balancers.
+func excludedFromLoadBalancers(node *v1.Node) bool {
+	_, ok := node.Labels[v1.LabelNodeExcludeBalancers]
+	return ok
+}
+
+// maybeDeregisterNode queues the removal of the instance of the node, deleted
+// or labeled to be excluded from the load balancers, from their backends while
+// the FastLoadBalancerDeregistration feature is enabled, so that it stops
+// receiving their traffic within seconds rather than once the service
+// controller synced all of them.
+func (g *Cloud) maybeDeregisterNode(node *v1.Node) {
+	if !featureEnabled(FastLoadBalancerDeregistration) {
+		return
+	}
+	g.lbDeregistrations.add(node)
+}
+
+// runLoadBalancerDeregistrations removes the queued nodes from the load
+// balancers in batches, one batch at a time, until stop is closed.
+func (g *Cloud) runLoadBalancerDeregistrations(stop <-chan struct{}) {
+	queue := g.lbDeregistrations.getQueue()
+	go func() {
+		<-stop
+		queue.ShutDown()
+	}()
+	for g.processNextDeregistrations() {
+	}
+}
+
+// processNextDeregistrations removes the next batch of queued nodes from the
+// load balancers, and returns false once the queue is shut down. The nodes of
+// a failed batch are retried with a backoff.
+func (g *Cloud) processNextDeregistrations() bool {
+	d := &g.lbDeregistrations
+	queue := d.getQueue()
+	key, quit := queue.Get()
+	if quit {
+		return false
+	}
+	keys := []interface{}{key}
+	for len(keys) < deregistrationBatchSize && queue.Len() > 0 {
+		key, quit := queue.Get()
+		if quit {
+			break
+		}
+		keys = append(keys, key)
+	}
+	d.mu.Lock()
+	nodes := make([]*v1.Node, 0, len(keys))
+	for _, key := range keys {
+		nodes = append(nodes, d.nodes[key.(string)])
+	}
+	d.mu.Unlock()
+
+	err := g.deregisterNodes(nodes)
+	if err != nil {
+		klog.Errorf("Failed to remove %d nodes from the load balancers: %v", len(nodes), err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, key := range keys {
+		if err != nil && queue.NumRequeues(key) < deregistrationMaxRetries {
+			queue.AddRateLimited(key)
+		} else {
+			queue.Forget(key)
+			// The node may have been queued again meanwhile.
+			if d.nodes[key.(string)] == nodes[i] {
+				delete(d.nodes, key.(string))
+			}
+		}
+		queue.Done(key)
+	}
+	return true
+}
+
+// deregisterNodes removes the instances of the nodes from the target pools of
+// the external load balancers, the instance group of the internal ones and
+// the network endpoint groups of the NEG backed ones. The backends are listed
+// once for all the nodes, and only the load balancers they back are updated.
+// The next sync of the load balancers does not add them back, as the service
+// controller leaves the nodes out of their hosts too.
+func (g *Cloud) deregisterNodes(nodes []*v1.Node) error {
+	// hosts are the names of the instances of the nodes by zone.
+	hosts := map[string]sets.String{}
+	links := sets.NewString()
+	for _, node := range nodes {
+		zone := getZone(node)
+		if zone == emptyZone {
+			continue
+		}
+		host := &gceInstance{Zone: zone, Name: mapNodeNameToInstanceName(types.NodeName(node.Name))}
+		if hosts[zone] == nil {
+			hosts[zone] = sets.NewString()
+		}
+		hosts[zone].Insert(host.Name)
+		links.Insert(host.makeComparableHostPath())
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	var errs []error
+
+	pools, err := g.ListTargetPools(g.region)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, pool := range pools {
+		if !ownedByService(pool.Description) {
+			continue
+		}
+		var refs []*compute.InstanceReference
+		for _, instance := range pool.Instances {
+			if link := hostURLToComparablePath(instance); links.Has(link) {
+				refs = append(refs, &compute.InstanceReference{Instance: link})
+			}
+		}
+		if len(refs) > 0 {
+			klog.Infof("deregisterNodes: removing %d instances from target pool %s", len(refs), pool.Name)
+			errs = append(errs, ignoreNotFound(g.RemoveInstancesFromTargetPool(pool.Name, g.region, refs)))
+		}
+	}
+
+	clusterID, idErr := g.ClusterID.GetID()
+	if idErr != nil {
+		errs = append(errs, idErr)
+	}
+	for _, zone := range sets.StringKeySet(hosts).List() {
+		if idErr == nil {
+			igName := makeInstanceGroupName(clusterID)
+			instances, err := g.ListInstancesInInstanceGroup(igName, zone, allInstances)
+			if err != nil && !isNotFound(err) {
+				errs = append(errs, err)
+			}
+			var names []string
+			for _, instance := range instances {
+				if name := lastComponent(instance.Instance); hosts[zone].Has(name) {
+					names = append(names, name)
+				}
+			}
+			if len(names) > 0 {
+				klog.Infof("deregisterNodes: removing %d instances from instance group %s in zone %s", len(names), igName, zone)
+				errs = append(errs, ignoreNotFound(g.RemoveInstancesFromInstanceGroup(igName, zone, g.ToInstanceReferences(zone, names))))
+			}
+		}
+
+		negs, err := g.ListNetworkEndpointGroup(zone)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, neg := range negs {
+			if !ownedByService(neg.Description) {
+				continue
+			}
+			endpoints, err := g.ListNetworkEndpoints(neg.Name, zone, false)
+			if err != nil {
+				errs = append(errs, ignoreNotFound(err))
+				continue
+			}
+			var toDetach []*computebeta.NetworkEndpoint
+			for _, ep := range endpoints {
+				if ep.NetworkEndpoint != nil && hosts[zone].Has(ep.NetworkEndpoint.Instance) {
+					toDetach = append(toDetach, &computebeta.NetworkEndpoint{Instance: ep.NetworkEndpoint.Instance, Port: ep.NetworkEndpoint.Port})
+				}
+			}
+			if len(toDetach) > 0 {
+				klog.Infof("deregisterNodes: detaching %d endpoints from network endpoint group %s in zone %s", len(toDetach), neg.Name, zone)
+				errs = append(errs, ignoreNotFound(g.DetachNetworkEndpoints(neg.Name, zone, toDetach)))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ownedByService returns whether the description is the one of a resource of
+// the load balancer of a Service.
+func ownedByService(description string) bool {
+	var desc forwardingRuleDescription
+	return json.Unmarshal([]byte(description), &desc) == nil && desc.ServiceName != ""
+}
@@ -0,0 +1,140 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/featuregate"
+)
+
+func TestDeregisterNode(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	endpoints := fakeNEGEndpoints(gce)
+	zone := vals.ZoneName
+	description := makeServiceDescription("default/svc")
+	hostPath := func(name string) string {
+		return (&gceInstance{Zone: zone, Name: name}).makeComparableHostPath()
+	}
+
+	require.NoError(t, gce.CreateTargetPool(&compute.TargetPool{Name: "a1234", Description: description, Instances: []string{hostPath("node-1"), hostPath("node-2")}}, gce.region))
+	// The target pools of the other load balancers are left as is.
+	require.NoError(t, gce.CreateTargetPool(&compute.TargetPool{Name: "other", Instances: []string{hostPath("node-1")}}, gce.region))
+	clusterID, err := gce.ClusterID.GetID()
+	require.NoError(t, err)
+	igName := makeInstanceGroupName(clusterID)
+	require.NoError(t, gce.CreateInstanceGroup(&compute.InstanceGroup{Name: igName}, zone))
+	require.NoError(t, gce.AddInstancesToInstanceGroup(igName, zone, gce.ToInstanceReferences(zone, []string{"node-1", "node-2"})))
+	require.NoError(t, gce.CreateNetworkEndpointGroup(&computebeta.NetworkEndpointGroup{Name: "a1234", Description: description}, zone))
+	require.NoError(t, gce.AttachNetworkEndpoints("a1234", zone, []*computebeta.NetworkEndpoint{{Instance: "node-1"}, {Instance: "node-2"}}))
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{v1.LabelTopologyZone: zone}}}
+	require.NoError(t, gce.deregisterNodes([]*v1.Node{node}))
+
+	pool, err := gce.GetTargetPool("a1234", gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hostPath("node-2")}, pool.Instances)
+	pool, err = gce.GetTargetPool("other", gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hostPath("node-1")}, pool.Instances)
+	instances, err := gce.ListInstancesInInstanceGroup(igName, zone, allInstances)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, "node-2", lastComponent(instances[0].Instance))
+	assert.Equal(t, []string{"node-2"}, endpoints[*meta.ZonalKey("a1234", zone)].List())
+
+	// Deregistering the node again is a no-op.
+	require.NoError(t, gce.deregisterNodes([]*v1.Node{node}))
+}
+
+func TestMaybeDeregisterNodeBatches(t *testing.T) {
+	gate := featuregate.NewFeatureGate()
+	require.NoError(t, AddFeatureGates(gate))
+	require.NoError(t, gate.Set("FastLoadBalancerDeregistration=true"))
+	SetFeatureGate(gate)
+	defer SetFeatureGate(newFeatureGate())
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	zone := vals.ZoneName
+	hostPath := func(name string) string {
+		return (&gceInstance{Zone: zone, Name: name}).makeComparableHostPath()
+	}
+	require.NoError(t, gce.CreateTargetPool(&compute.TargetPool{Name: "a1234", Description: makeServiceDescription("default/svc"), Instances: []string{hostPath("node-1"), hostPath("node-2"), hostPath("node-3")}}, gce.region))
+	mockGCE := gce.c.(*cloud.MockGCE)
+	var lists, removes int
+	mockGCE.MockTargetPools.ListHook = func(context.Context, string, *filter.F, *cloud.MockTargetPools, ...cloud.Option) (bool, []*compute.TargetPool, error) {
+		lists++
+		return false, nil, nil
+	}
+	mockGCE.MockTargetPools.RemoveInstanceHook = func(ctx context.Context, key *meta.Key, req *compute.TargetPoolsRemoveInstanceRequest, m *cloud.MockTargetPools, options ...cloud.Option) error {
+		removes++
+		return mock.RemoveInstanceHook(ctx, key, req, m, options...)
+	}
+
+	// The nodes queued together are removed at once.
+	for _, name := range []string{"node-1", "node-2"} {
+		gce.maybeDeregisterNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{v1.LabelTopologyZone: zone}}})
+	}
+	require.True(t, gce.processNextDeregistrations())
+	assert.Equal(t, 1, lists)
+	assert.Equal(t, 1, removes)
+	pool, err := gce.GetTargetPool("a1234", gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hostPath("node-3")}, pool.Instances)
+	assert.Zero(t, gce.lbDeregistrations.getQueue().Len())
+	assert.Empty(t, gce.lbDeregistrations.nodes)
+
+	// The failed removals are retried.
+	mockGCE.MockTargetPools.RemoveInstanceHook = func(context.Context, *meta.Key, *compute.TargetPoolsRemoveInstanceRequest, *cloud.MockTargetPools, ...cloud.Option) error {
+		return fmt.Errorf("backend error")
+	}
+	gce.maybeDeregisterNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-3", Labels: map[string]string{v1.LabelTopologyZone: zone}}})
+	require.True(t, gce.processNextDeregistrations())
+	assert.Equal(t, 1, gce.lbDeregistrations.getQueue().NumRequeues("node-3"))
+	assert.Contains(t, gce.lbDeregistrations.nodes, "node-3")
+
+	gce.lbDeregistrations.getQueue().ShutDown()
+}
+
+func TestMaybeDeregisterNodeDisabled(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{v1.LabelNodeExcludeBalancers: ""}}}
+	assert.True(t, excludedFromLoadBalancers(node))
+
+	gce.maybeDeregisterNode(node)
+	assert.Empty(t, gce.lbDeregistrations.nodes)
+}
@@ -0,0 +1,93 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cloud-provider/api"
+)
+
+// checkLoadBalancerDrained returns a RetryError while the load balancer of a
+// Service whose type changed from LoadBalancer must be kept, according to its
+// ServiceAnnotationLoadBalancerDrainDelay annotation. The drain start is kept
+// in the ServiceAnnotationLoadBalancerDrainStart annotation of the Service,
+// so that a restart of the controller does not restart the drain.
+func (g *Cloud) checkLoadBalancerDrained(svc *v1.Service, now time.Time) error {
+	value, ok := svc.Annotations[ServiceAnnotationLoadBalancerDrainDelay]
+	if !ok || svc.DeletionTimestamp != nil || svc.Spec.Type == v1.ServiceTypeLoadBalancer {
+		return nil
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		return fmt.Errorf("invalid %s annotation %q, must be a non-negative duration", ServiceAnnotationLoadBalancerDrainDelay, value)
+	}
+	start, err := time.Parse(time.RFC3339, svc.Annotations[ServiceAnnotationLoadBalancerDrainStart])
+	if err != nil {
+		if delay == 0 {
+			return nil
+		}
+		start = now
+		if err := g.patchLoadBalancerDrainStart(svc, start.Format(time.RFC3339)); err != nil {
+			return err
+		}
+		g.eventRecorder.Eventf(svc, v1.EventTypeNormal, "DrainingLoadBalancer", "Keeping the load balancer for %v before deleting it", delay)
+	}
+	end := start.Add(delay)
+	if !now.Before(end) {
+		return nil
+	}
+	return api.NewRetryError(fmt.Sprintf("draining load balancer of service %s/%s until %v", svc.Namespace, svc.Name, end.Format(time.RFC3339)), end.Sub(now))
+}
+
+// resetLoadBalancerDrain removes the drain start of a Service whose type was
+// changed back to LoadBalancer, so that the next type change drains for the
+// whole delay again.
+func (g *Cloud) resetLoadBalancerDrain(svc *v1.Service) error {
+	if _, ok := svc.Annotations[ServiceAnnotationLoadBalancerDrainStart]; !ok {
+		return nil
+	}
+	return g.patchLoadBalancerDrainStart(svc, "")
+}
+
+// patchLoadBalancerDrainStart sets the drain start annotation of the Service,
+// or removes it if start is empty.
+func (g *Cloud) patchLoadBalancerDrainStart(svc *v1.Service, start string) error {
+	var value interface{}
+	if start != "" {
+		value = start
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{ServiceAnnotationLoadBalancerDrainStart: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = g.client.CoreV1().Services(svc.Namespace).Patch(context.TODO(), svc.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
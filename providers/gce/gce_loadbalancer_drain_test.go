@@ -0,0 +1,165 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/cloud-provider/api"
+)
+
+func TestCheckLoadBalancerDrained(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		desc     string
+		svcType  v1.ServiceType
+		delay    string
+		deleted  bool
+		elapsed  []time.Duration
+		wantErrs []bool
+	}{
+		{
+			desc:     "no annotation",
+			svcType:  v1.ServiceTypeClusterIP,
+			elapsed:  []time.Duration{0},
+			wantErrs: []bool{false},
+		},
+		{
+			desc:     "type changed to ClusterIP",
+			svcType:  v1.ServiceTypeClusterIP,
+			delay:    "5m",
+			elapsed:  []time.Duration{0, time.Minute, 5 * time.Minute, 5 * time.Minute},
+			wantErrs: []bool{true, true, false, false},
+		},
+		{
+			desc:     "type changed to NodePort",
+			svcType:  v1.ServiceTypeNodePort,
+			delay:    "1m",
+			elapsed:  []time.Duration{0, 2 * time.Minute},
+			wantErrs: []bool{true, false},
+		},
+		{
+			desc:     "service deleted",
+			svcType:  v1.ServiceTypeLoadBalancer,
+			delay:    "5m",
+			deleted:  true,
+			elapsed:  []time.Duration{0},
+			wantErrs: []bool{false},
+		},
+		{
+			desc:     "zero delay",
+			svcType:  v1.ServiceTypeClusterIP,
+			delay:    "0s",
+			elapsed:  []time.Duration{0},
+			wantErrs: []bool{false},
+		},
+		{
+			desc:     "invalid delay",
+			svcType:  v1.ServiceTypeClusterIP,
+			delay:    "soon",
+			elapsed:  []time.Duration{0},
+			wantErrs: []bool{true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			gce, err := fakeGCECloud(DefaultTestClusterValues())
+			require.NoError(t, err)
+			recorder := record.NewFakeRecorder(10)
+			gce.eventRecorder = recorder
+
+			svc := fakeLoadbalancerService("")
+			svc.Spec.Type = tc.svcType
+			if tc.delay != "" {
+				svc.Annotations[ServiceAnnotationLoadBalancerDrainDelay] = tc.delay
+			}
+			if tc.deleted {
+				svc.DeletionTimestamp = &metav1.Time{Time: now}
+			}
+			svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+			require.NoError(t, err)
+			for i, elapsed := range tc.elapsed {
+				// The controller syncs the Service with the annotations set.
+				svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+				require.NoError(t, err)
+				err := gce.checkLoadBalancerDrained(svc, now.Add(elapsed))
+				assert.Equal(t, tc.wantErrs[i], err != nil, "check %d: got error %v", i, err)
+			}
+		})
+	}
+}
+
+func TestCheckLoadBalancerDrainedRetry(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	gce.eventRecorder = record.NewFakeRecorder(10)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationLoadBalancerDrainDelay] = "5m"
+	svc.Spec.Type = v1.ServiceTypeClusterIP
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	err = gce.checkLoadBalancerDrained(svc, now)
+	var retryErr *api.RetryError
+	require.ErrorAs(t, err, &retryErr)
+	assert.Equal(t, 5*time.Minute, retryErr.RetryAfter())
+
+	// The drain start survives a restart of the controller.
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, now.Format(time.RFC3339), svc.Annotations[ServiceAnnotationLoadBalancerDrainStart])
+	restarted, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	err = restarted.checkLoadBalancerDrained(svc, now.Add(2*time.Minute))
+	require.ErrorAs(t, err, &retryErr)
+	assert.Equal(t, 3*time.Minute, retryErr.RetryAfter())
+}
+
+func TestCheckLoadBalancerDrainedTypeChangedBack(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	gce.eventRecorder = record.NewFakeRecorder(10)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationLoadBalancerDrainDelay] = "5m"
+	svc.Spec.Type = v1.ServiceTypeClusterIP
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Error(t, gce.checkLoadBalancerDrained(svc, now))
+
+	// Changing the type back cancels the drain, so the next type change
+	// drains for the whole delay again.
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NoError(t, gce.resetLoadBalancerDrain(svc))
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, svc.Annotations, ServiceAnnotationLoadBalancerDrainStart)
+	assert.Error(t, gce.checkLoadBalancerDrained(svc, now.Add(5*time.Minute)))
+}
@@ -0,0 +1,204 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// loadBalancerQuotaExceededReason is the reason of the events of the
+	// load balancer syncs failed because a GCE quota was exceeded.
+	loadBalancerQuotaExceededReason = "LoadBalancerQuotaExceeded"
+	// loadBalancerPermissionDeniedReason is the reason of the events of the
+	// load balancer syncs failed because a permission is missing.
+	loadBalancerPermissionDeniedReason = "LoadBalancerPermissionDenied"
+	// loadBalancerCloudErrorReason is the reason of the events of the load
+	// balancer syncs failed because of other GCE API errors.
+	loadBalancerCloudErrorReason = "LoadBalancerCloudError"
+)
+
+var (
+	// cloudErrorOperationRE matches the name of the failed GCE operation
+	// added to the message of the errors of the audited calls.
+	cloudErrorOperationRE = regexp.MustCompile(`\(operation ([^ )]+)\)`)
+	// cloudErrorPermissionRE matches the permission in the message of the
+	// errors of GCE API calls denied for a missing permission.
+	cloudErrorPermissionRE = regexp.MustCompile(`Required '([A-Za-z0-9.]+)' permission`)
+	// cloudErrorQuotaRE matches the quota in the message of the errors of GCE
+	// API calls rejected because a quota was exceeded.
+	cloudErrorQuotaRE = regexp.MustCompile(`Quota '([A-Z0-9_]+)' exceeded`)
+	// cloudErrorCodeRE matches the error code prefixing the message of the
+	// errors of failed GCE operations, e.g. QUOTA_EXCEEDED - ...
+	cloudErrorCodeRE = regexp.MustCompile(`^([A-Z][A-Z0-9_]+) - `)
+)
+
+// cloudErrorDetails are the details of a failed GCE API call or operation
+// reported in the events of the Service whose load balancer failed to sync.
+type cloudErrorDetails struct {
+	// HTTPStatus is the HTTP status code of the error.
+	HTTPStatus int
+	// Reason is the reason of the error, e.g. quotaExceeded or
+	// QUOTA_EXCEEDED for failed operations.
+	Reason string
+	// Operation is the name of the failed GCE operation, if known.
+	Operation string
+	// Quota is the exceeded quota, if any.
+	Quota string
+	// Permission is the missing permission, if any.
+	Permission string
+	// Message is the message of the error.
+	Message string
+}
+
+// parseCloudError returns the details of err if it is, or wraps, a GCE API
+// error.
+func parseCloudError(err error) (*cloudErrorDetails, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return nil, false
+	}
+	d := &cloudErrorDetails{HTTPStatus: apiErr.Code, Message: apiErr.Message}
+	for _, item := range apiErr.Errors {
+		if item.Reason != "" {
+			d.Reason = item.Reason
+			break
+		}
+	}
+	if m := cloudErrorCodeRE.FindStringSubmatch(apiErr.Message); m != nil {
+		if d.Reason == "" {
+			d.Reason = m[1]
+		}
+		d.Message = strings.TrimPrefix(apiErr.Message, m[0])
+	}
+	for _, detail := range apiErr.Details {
+		parseCloudErrorDetail(d, detail)
+	}
+	text := apiErr.Message + " " + apiErr.Body
+	if m := cloudErrorOperationRE.FindStringSubmatch(text); m != nil {
+		d.Operation = m[1]
+	}
+	if m := cloudErrorPermissionRE.FindStringSubmatch(text); d.Permission == "" && m != nil {
+		d.Permission = m[1]
+	}
+	if m := cloudErrorQuotaRE.FindStringSubmatch(text); d.Quota == "" && m != nil {
+		d.Quota = m[1]
+	}
+	return d, true
+}
+
+// parseCloudErrorDetail fills d with the structured detail of a GCE API
+// error: the google.rpc.ErrorInfo and QuotaFailure details, and the
+// QuotaExceededInfo of the compute API.
+func parseCloudErrorDetail(d *cloudErrorDetails, detail interface{}) {
+	m, ok := detail.(map[string]interface{})
+	if !ok {
+		return
+	}
+	typ, _ := m["@type"].(string)
+	switch {
+	case strings.HasSuffix(typ, ".ErrorInfo"):
+		if reason, ok := m["reason"].(string); ok && reason != "" {
+			d.Reason = reason
+		}
+		metadata, _ := m["metadata"].(map[string]interface{})
+		if permission, ok := metadata["permission"].(string); ok {
+			d.Permission = permission
+		}
+		if quota, ok := metadata["quota_limit"].(string); ok {
+			d.Quota = quota
+		}
+	case strings.HasSuffix(typ, ".QuotaFailure"):
+		violations, _ := m["violations"].([]interface{})
+		for _, v := range violations {
+			violation, _ := v.(map[string]interface{})
+			if subject, ok := violation["subject"].(string); ok && subject != "" {
+				d.Quota = subject
+				return
+			}
+		}
+	}
+	if info, ok := m["quotaExceededInfo"].(map[string]interface{}); ok {
+		if metric, ok := info["metricName"].(string); ok {
+			d.Quota = metric
+		}
+	}
+}
+
+// eventReason returns the reason of the event reporting the error.
+func (d *cloudErrorDetails) eventReason() string {
+	switch {
+	case d.Quota != "" || d.HTTPStatus == http.StatusTooManyRequests || isQuotaReason(d.Reason):
+		return loadBalancerQuotaExceededReason
+	case d.Permission != "" || d.HTTPStatus == http.StatusForbidden:
+		return loadBalancerPermissionDeniedReason
+	default:
+		return loadBalancerCloudErrorReason
+	}
+}
+
+// isQuotaReason returns true if reason is the reason of an error of a call
+// or operation rejected because a rate limit or quota was exceeded.
+func isQuotaReason(reason string) bool {
+	if reason == "QUOTA_EXCEEDED" || reason == "RATE_LIMIT_EXCEEDED" {
+		return true
+	}
+	for _, r := range quotaExceededReasons {
+		if reason == r {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the details as the message of an event.
+func (d *cloudErrorDetails) String() string {
+	parts := []string{fmt.Sprintf("HTTP %d", d.HTTPStatus)}
+	if d.Reason != "" {
+		parts = append(parts, "reason "+d.Reason)
+	}
+	if d.Operation != "" {
+		parts = append(parts, "operation "+d.Operation)
+	}
+	if d.Quota != "" {
+		parts = append(parts, "quota "+d.Quota+" exceeded")
+	}
+	if d.Permission != "" {
+		parts = append(parts, "missing permission "+d.Permission)
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(parts, ", "), d.Message)
+}
+
+// recordCloudErrorEvent records a warning event on svc with the details of
+// err if the sync of its load balancer failed because of a GCE API error.
+func (g *Cloud) recordCloudErrorEvent(svc *v1.Service, operation string, err error) {
+	d, ok := parseCloudError(err)
+	if !ok {
+		return
+	}
+	g.eventRecorder.Eventf(svc, v1.EventTypeWarning, d.eventReason(), "%s failed: %s", operation, d)
+}
@@ -0,0 +1,147 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseCloudError(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc       string
+		err        error
+		want       *cloudErrorDetails
+		wantReason string
+	}{
+		{
+			desc: "not a cloud error",
+			err:  fmt.Errorf("no nodes"),
+		},
+		{
+			desc: "missing permission",
+			err: fmt.Errorf("failed to create firewall: %w", &googleapi.Error{
+				Code:    http.StatusForbidden,
+				Message: "Required 'compute.firewalls.create' permission for 'projects/p/global/firewalls/k8s-fw-a1'",
+				Errors:  []googleapi.ErrorItem{{Reason: "forbidden"}},
+			}),
+			want: &cloudErrorDetails{
+				HTTPStatus: http.StatusForbidden,
+				Reason:     "forbidden",
+				Permission: "compute.firewalls.create",
+				Message:    "Required 'compute.firewalls.create' permission for 'projects/p/global/firewalls/k8s-fw-a1'",
+			},
+			wantReason: loadBalancerPermissionDeniedReason,
+		},
+		{
+			desc: "failed operation",
+			err: &googleapi.Error{
+				Code:    http.StatusForbidden,
+				Message: "QUOTA_EXCEEDED - Quota 'FORWARDING_RULES' exceeded. Limit: 15.0 globally. (operation operation-1700000000000-5f1c2a-9b8e7d6c)",
+			},
+			want: &cloudErrorDetails{
+				HTTPStatus: http.StatusForbidden,
+				Reason:     "QUOTA_EXCEEDED",
+				Operation:  "operation-1700000000000-5f1c2a-9b8e7d6c",
+				Quota:      "FORWARDING_RULES",
+				Message:    "Quota 'FORWARDING_RULES' exceeded. Limit: 15.0 globally. (operation operation-1700000000000-5f1c2a-9b8e7d6c)",
+			},
+			wantReason: loadBalancerQuotaExceededReason,
+		},
+		{
+			desc: "structured details",
+			err: &googleapi.Error{
+				Code:    http.StatusForbidden,
+				Message: "Permission denied",
+				Details: []interface{}{
+					map[string]interface{}{
+						"@type":    "type.googleapis.com/google.rpc.ErrorInfo",
+						"reason":   "IAM_PERMISSION_DENIED",
+						"metadata": map[string]interface{}{"permission": "compute.addresses.create"},
+					},
+				},
+			},
+			want: &cloudErrorDetails{
+				HTTPStatus: http.StatusForbidden,
+				Reason:     "IAM_PERMISSION_DENIED",
+				Permission: "compute.addresses.create",
+				Message:    "Permission denied",
+			},
+			wantReason: loadBalancerPermissionDeniedReason,
+		},
+		{
+			desc:       "other error",
+			err:        &googleapi.Error{Code: http.StatusBadRequest, Message: "Invalid value for field 'resource.IPAddress'"},
+			want:       &cloudErrorDetails{HTTPStatus: http.StatusBadRequest, Message: "Invalid value for field 'resource.IPAddress'"},
+			wantReason: loadBalancerCloudErrorReason,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok := parseCloudError(tc.err)
+			assert.Equal(t, tc.want != nil, ok)
+			assert.Equal(t, tc.want, got)
+			if ok {
+				assert.Equal(t, tc.wantReason, got.eventReason())
+			}
+		})
+	}
+}
+
+func TestEnsureLoadBalancerCloudErrorEvent(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	gce.c.(*cloud.MockGCE).MockTargetPools.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.TargetPool, m *cloud.MockTargetPools, options ...cloud.Option) (bool, error) {
+		return true, &googleapi.Error{Code: http.StatusForbidden, Message: "QUOTA_EXCEEDED - Quota 'TARGET_POOLS' exceeded. Limit: 50.0 in region us-central1."}
+	}
+	svc := fakeLoadbalancerService("")
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.Error(t, err)
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	want := "Warning " + loadBalancerQuotaExceededReason + " EnsureLoadBalancer failed: HTTP 403, reason QUOTA_EXCEEDED, quota TARGET_POOLS exceeded: Quota 'TARGET_POOLS' exceeded. Limit: 50.0 in region us-central1."
+	assert.Contains(t, events, want, "events: %s", strings.Join(events, "\n"))
+}
@@ -54,10 +54,48 @@ const (
 // new load balancers and updating existing load balancers, recognizing when
 // each is needed.
 func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string, apiService *v1.Service, existingFwdRule *compute.ForwardingRule, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	if g.usesExternalManagedLB(apiService) {
+		if err := g.addNetLBFinalizer(apiService); err != nil {
+			return nil, err
+		}
+		return g.ensureExternalManagedLoadBalancer(clusterName, clusterID, apiService, existingFwdRule, nodes)
+	}
+	if g.AlphaFeatureGate.Enabled(AlphaFeatureExternalManagedLB) {
+		if err := g.replaceExternalManagedLoadBalancer(apiService, clusterName, clusterID); err != nil {
+			return nil, err
+		}
+	}
+	if g.usesNEGExternalLB(apiService) {
+		if err := g.addNetLBFinalizer(apiService); err != nil {
+			return nil, err
+		}
+		return g.ensureExternalNEGLoadBalancer(clusterName, clusterID, apiService, nodes)
+	}
+	// Replace the NEG backed load balancer of a Service that opted out of NEG
+	// backends. Its forwarding rule would otherwise be mistaken for one of the
+	// L4 RBS controller below.
+	if featureEnabled(NEGBackedNetLB) && !usesL4RBS(apiService, nil) && isNEGExternalLBForwardingRule(existingFwdRule) {
+		if err := g.replaceExternalNEGLoadBalancer(apiService, existingFwdRule, clusterID); err != nil {
+			return nil, err
+		}
+		existingFwdRule = nil
+	}
 	// Skip service handling if it uses Regional Backend Services and handled by other controllers
 	if usesL4RBS(apiService, existingFwdRule) {
 		return nil, cloudprovider.ImplementedElsewhere
 	}
+	if err := g.addNetLBFinalizer(apiService); err != nil {
+		return nil, err
+	}
+	if _, ok := apiService.Annotations[ServiceAnnotationWeightedLoadBalancing]; ok {
+		g.eventRecorder.Event(apiService, v1.EventTypeWarning, "WeightedLoadBalancingIgnored", "Weighted load balancing is only supported by load balancers with NEG backends.")
+	}
+	if _, ok := apiService.Annotations[ServiceAnnotationHealthCheckLogging]; ok {
+		g.eventRecorder.Event(apiService, v1.EventTypeWarning, "HealthCheckLoggingIgnored", "The legacy health checks of target pools do not support logging.")
+	}
+	if _, ok := apiService.Annotations[ServiceAnnotationHealthCheckProxyHeader]; ok {
+		g.eventRecorder.Event(apiService, v1.EventTypeWarning, "HealthCheckProxyHeaderIgnored", "The legacy health checks of target pools do not support proxy headers.")
+	}
 
 	if len(nodes) == 0 {
 		return nil, fmt.Errorf(errStrLbNoHosts)
@@ -71,7 +109,7 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 
 	loadBalancerName := g.GetLoadBalancerName(context.TODO(), clusterName, apiService)
 	requestedIP := apiService.Spec.LoadBalancerIP
-	ports := apiService.Spec.Ports
+	ports, companionPorts := g.loadBalancerPorts(apiService)
 	portStr := []string{}
 	for _, p := range apiService.Spec.Ports {
 		portStr = append(portStr, fmt.Sprintf("%s/%d", p.Protocol, p.Port))
@@ -89,11 +127,24 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 		return nil, err
 	}
 	klog.V(4).Infof("ensureExternalLoadBalancer(%s): Desired network tier %q.", lbRefStr, netTier)
+	requestedIP, err = g.requestedLoadBalancerIP(apiService, cloud.SchemeExternal, "", netTier)
+	if err != nil {
+		return nil, err
+	}
+	hcParams, err := getHealthCheckParams(apiService)
+	if err != nil {
+		return nil, err
+	}
 	// TODO: distinguish between unspecified and specified network tiers annotation properly in forwardingrule creation
 	// Only delete ForwardingRule when network tier annotation is specified, otherwise leave it only to avoid wrongful
 	// deletion against user intention when network tier annotation is not specified.
+	// The forwarding rule must be deleted before it is re-created with the
+	// desired tier, so the sync is retried if the deletion fails.
 	if _, ok := apiService.Annotations[NetworkTierAnnotationKey]; ok {
-		g.deleteWrongNetworkTieredResources(loadBalancerName, lbRefStr, netTier)
+		if err := g.deleteWrongNetworkTieredResources(loadBalancerName, lbRefStr, netTier); err != nil {
+			klog.Errorf("ensureExternalLoadBalancer(%s): Failed to delete the resources with the wrong network tier: %v.", lbRefStr, err)
+			return nil, err
+		}
 	}
 
 	// Check if the forwarding rule exists, and if so, what its IP is.
@@ -132,7 +183,9 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 	isUserOwnedIP := false // if this is set, we never release the IP
 	isSafeToReleaseIP := false
 	defer func() {
-		if isUserOwnedIP {
+		// The forwarding rules of a mixed protocol load balancer can only
+		// share a reserved IP.
+		if isUserOwnedIP || len(companionPorts) > 0 {
 			return
 		}
 		if isSafeToReleaseIP {
@@ -163,7 +216,7 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 		// emphemeral IP used by the fwd rule, or create a new static IP.
 		ipAddr, existed, err := ensureStaticIP(g, loadBalancerName, serviceName.String(), g.region, fwdRuleIP, netTier)
 		if err != nil {
-			return nil, fmt.Errorf("failed to ensure a static IP for load balancer (%s): %v", lbRefStr, err)
+			return nil, fmt.Errorf("failed to ensure a static IP for load balancer (%s): %w", lbRefStr, err)
 		}
 		klog.Infof("ensureExternalLoadBalancer(%s): Ensured IP address %s (tier: %s).", lbRefStr, ipAddr, netTier)
 		// If the IP was not owned by the user, but it already existed, it
@@ -178,7 +231,7 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 	// is because the forwarding rule is used as the indicator that the load
 	// balancer is fully created - it's what getLoadBalancer checks for.
 	// Check if user specified the allow source range
-	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(apiService)
+	sourceRanges, err := g.loadBalancerSourceRanges(apiService)
 	if err != nil {
 		return nil, err
 	}
@@ -220,9 +273,17 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 	var hcToCreate, hcToDelete *compute.HttpHealthCheck
 	hcLocalTrafficExisting, err := g.GetHTTPHealthCheck(loadBalancerName)
 	if err != nil && !isHTTPErrorCode(err, http.StatusNotFound) {
-		return nil, fmt.Errorf("error checking HTTP health check for load balancer (%s): %v", lbRefStr, err)
+		return nil, fmt.Errorf("error checking HTTP health check for load balancer (%s): %w", lbRefStr, err)
 	}
-	if path, healthCheckNodePort := servicehelpers.GetServiceHealthCheckPathPort(apiService); path != "" {
+	path, healthCheckNodePort := servicehelpers.GetServiceHealthCheckPathPort(apiService)
+	if hcParams != nil && path != "" {
+		path = hcParams.requestPath
+	} else if hcParams != nil {
+		// A Service tuning its health check gets its own health check of
+		// the nodes, handled like a local traffic one.
+		path, healthCheckNodePort = hcParams.requestPath, GetNodesHealthCheckPort()
+	}
+	if path != "" {
 		klog.V(4).Infof("ensureExternalLoadBalancer(%s): Service needs local traffic health checks on: %d%s.", lbRefStr, healthCheckNodePort, path)
 		if hcLocalTrafficExisting == nil {
 			// This logic exists to detect a transition for non-OnlyLocal to OnlyLocal service
@@ -252,25 +313,52 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 	// can't delete a target pool that's currently in use by a forwarding rule.
 	// Thus, we have to tear down the forwarding rule if either it or the target
 	// pool needs to be updated.
+	companionDeleted := false
+	if g.AlphaFeatureGate.Enabled(AlphaFeatureMixedProtocolLB) {
+		var keep v1.Protocol
+		if len(companionPorts) > 0 {
+			keep = companionPorts[0].Protocol
+			// The companion forwarding rule also uses the target pool.
+			if tpNeedsRecreation {
+				if err := ignoreNotFound(g.DeleteRegionForwardingRule(mixedProtocolName(loadBalancerName, keep), g.region)); err != nil {
+					return nil, fmt.Errorf("failed to delete existing companion forwarding rule for load balancer (%s) update: %w", lbRefStr, err)
+				}
+			}
+		}
+		if companionDeleted, err = g.ensureExternalMixedProtocolLoadBalancerDeleted(apiService, loadBalancerName, keep); err != nil {
+			return nil, err
+		}
+	}
+	if (fwdRuleExists && (fwdRuleNeedsUpdate || tpNeedsRecreation)) || (tpExists && tpNeedsRecreation) {
+		if err := g.checkRecreateBudget(loadBalancerName); err != nil {
+			return nil, err
+		}
+	}
 	if fwdRuleExists && (fwdRuleNeedsUpdate || tpNeedsRecreation) {
 		// Begin critical section. If we have to delete the forwarding rule,
 		// and something should fail before we recreate it, don't release the
 		// IP.  That way we can come back to it later.
 		isSafeToReleaseIP = false
 		if err := g.DeleteRegionForwardingRule(loadBalancerName, g.region); err != nil && !isNotFound(err) {
-			return nil, fmt.Errorf("failed to delete existing forwarding rule for load balancer (%s) update: %v", lbRefStr, err)
+			return nil, fmt.Errorf("failed to delete existing forwarding rule for load balancer (%s) update: %w", lbRefStr, err)
 		}
 		klog.Infof("ensureExternalLoadBalancer(%s): Deleted forwarding rule.", lbRefStr)
 	}
 
-	if err := g.ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation, apiService, loadBalancerName, clusterID, ipAddressToUse, hosts, hcToCreate, hcToDelete); err != nil {
+	if err := g.ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation, apiService, loadBalancerName, clusterID, ipAddressToUse, hosts, hcToCreate, hcToDelete, hcParams); err != nil {
 		return nil, err
 	}
 
+	if len(companionPorts) > 0 {
+		if err := g.ensureExternalMixedProtocolLoadBalancer(apiService, loadBalancerName, clusterID, ipAddressToUse, companionPorts, sourceRanges, hosts, netTier); err != nil {
+			return nil, fmt.Errorf("failed to ensure the companion forwarding rule for load balancer (%s): %w", lbRefStr, err)
+		}
+	}
+
 	if tpNeedsRecreation || fwdRuleNeedsUpdate {
 		klog.Infof("ensureExternalLoadBalancer(%s): Creating forwarding rule, IP %s (tier: %s).", lbRefStr, ipAddressToUse, netTier)
-		if err := createForwardingRule(g, loadBalancerName, serviceName.String(), g.region, ipAddressToUse, g.targetPoolURL(loadBalancerName), ports, netTier); err != nil {
-			return nil, fmt.Errorf("failed to create forwarding rule for load balancer (%s): %v", lbRefStr, err)
+		if err := createForwardingRule(g, loadBalancerName, serviceName.String(), clusterID, g.region, ipAddressToUse, g.targetPoolURL(loadBalancerName), ports, netTier); err != nil {
+			return nil, fmt.Errorf("failed to create forwarding rule for load balancer (%s): %w", lbRefStr, err)
 		}
 		// End critical section.  It is safe to release the static IP (which
 		// just demotes it to ephemeral) now that it is attached.  In the case
@@ -280,8 +368,13 @@ func (g *Cloud) ensureExternalLoadBalancer(clusterName string, clusterID string,
 		klog.Infof("ensureExternalLoadBalancer(%s): Created forwarding rule, IP %s.", lbRefStr, ipAddressToUse)
 	}
 
+	if companionDeleted {
+		// The IP no longer needs to stay reserved.
+		isSafeToReleaseIP = true
+	}
+
 	status := &v1.LoadBalancerStatus{}
-	status.Ingress = []v1.LoadBalancerIngress{{IP: ipAddressToUse}}
+	status.Ingress = []v1.LoadBalancerIngress{{IP: ipAddressToUse, IPMode: loadBalancerIPMode(string(cloud.SchemeExternal))}}
 
 	return status, nil
 }
@@ -292,6 +385,9 @@ func (g *Cloud) updateExternalLoadBalancer(clusterName string, service *v1.Servi
 	if usesL4RBS(service, nil) {
 		return cloudprovider.ImplementedElsewhere
 	}
+	if g.usesNEGExternalLB(service) || g.usesExternalManagedLB(service) {
+		return g.updateExternalNEGLoadBalancer(clusterName, service, nodes)
+	}
 
 	hosts, err := g.getInstancesByNames(nodeNames(nodes))
 	if err != nil {
@@ -312,6 +408,22 @@ func (g *Cloud) ensureExternalLoadBalancerDeleted(clusterName, clusterID string,
 	loadBalancerName := g.GetLoadBalancerName(context.TODO(), clusterName, service)
 	serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
 	lbRefStr := fmt.Sprintf("%v(%v)", loadBalancerName, serviceName)
+	if err := g.teardownExternalLoadBalancer(clusterID, service, loadBalancerName); err != nil {
+		return err
+	}
+	klog.V(2).Infof("ensureExternalLoadBalancerDeleted(%s): Removing %q finalizer.", lbRefStr, NetLBFinalizerV1)
+	if err := removeFinalizer(service, g.client.CoreV1(), NetLBFinalizerV1); err != nil {
+		klog.Errorf("Failed to remove finalizer '%s' on service %s - %v", NetLBFinalizerV1, serviceName, err)
+		return err
+	}
+	return nil
+}
+
+// teardownExternalLoadBalancer deletes the resources of the external load
+// balancer of the Service.
+func (g *Cloud) teardownExternalLoadBalancer(clusterID string, service *v1.Service, loadBalancerName string) error {
+	serviceName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	lbRefStr := fmt.Sprintf("%v(%v)", loadBalancerName, serviceName)
 
 	var hcNames []string
 	if path, _ := servicehelpers.GetServiceHealthCheckPathPort(service); path != "" {
@@ -337,6 +449,9 @@ func (g *Cloud) ensureExternalLoadBalancerDeleted(clusterName, clusterID string,
 		func() error {
 			klog.Infof("ensureExternalLoadBalancerDeleted(%s): Deleting firewall rule.", lbRefStr)
 			fwName := MakeFirewallName(loadBalancerName)
+			if g.skipFirewallChange(service, fwName, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID())) {
+				return nil
+			}
 			err := ignoreNotFound(g.DeleteFirewall(fwName))
 			if isForbidden(err) && g.OnXPN() {
 				klog.V(4).Infof("ensureExternalLoadBalancerDeleted(%s): Do not have permission to delete firewall rule %v (on XPN). Raising event.", lbRefStr, fwName)
@@ -359,10 +474,22 @@ func (g *Cloud) ensureExternalLoadBalancerDeleted(clusterName, clusterID string,
 			if err := ignoreNotFound(g.DeleteRegionForwardingRule(loadBalancerName, g.region)); err != nil {
 				return err
 			}
+			if g.AlphaFeatureGate.Enabled(AlphaFeatureMixedProtocolLB) {
+				klog.Infof("ensureExternalLoadBalancerDeleted(%s): Deleting companion forwarding rules.", lbRefStr)
+				if _, err := g.ensureExternalMixedProtocolLoadBalancerDeleted(service, loadBalancerName, ""); err != nil {
+					return err
+				}
+			}
 			klog.Infof("ensureExternalLoadBalancerDeleted(%s): Deleting target pool.", lbRefStr)
 			if err := g.DeleteExternalTargetPoolAndChecks(service, loadBalancerName, g.region, clusterID, hcNames...); err != nil {
 				return err
 			}
+			// The Service may have had NEG or EXTERNAL_MANAGED backends,
+			// even if it no longer has the annotation.
+			if featureEnabled(NEGBackedNetLB) || g.AlphaFeatureGate.Enabled(AlphaFeatureExternalManagedLB) {
+				klog.Infof("ensureExternalLoadBalancerDeleted(%s): Deleting NEG backend resources.", lbRefStr)
+				return g.teardownExternalNEGLoadBalancer(service, loadBalancerName, clusterID)
+			}
 			return nil
 		},
 	)
@@ -418,6 +545,9 @@ func (g *Cloud) DeleteExternalTargetPoolAndChecks(service *v1.Service, name, reg
 			// So we should delete the health check firewall as well.
 			fwName := MakeHealthCheckFirewallName(clusterID, hcName, isNodesHealthCheck)
 			klog.Infof("DeleteExternalTargetPoolAndChecks(%v): Deleting health check firewall %v.", lbRefStr, fwName)
+			if g.skipFirewallChange(service, fwName, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID())) {
+				return nil
+			}
 			if err := ignoreNotFound(g.DeleteFirewall(fwName)); err != nil {
 				if isForbidden(err) && g.OnXPN() {
 					klog.V(4).Infof("DeleteExternalTargetPoolAndChecks(%v): Do not have permission to delete firewall rule %v (on XPN). Raising event.", lbRefStr, fwName)
@@ -461,7 +591,7 @@ func verifyUserRequestedIP(s CloudAddressService, region, requestedIP, fwdRuleIP
 		// network tier.
 		netTierStr, err := s.getNetworkTierFromAddress(existingAddress.Name, region)
 		if err != nil {
-			return false, fmt.Errorf("failed to check the network tier of the IP %q: %v", requestedIP, err)
+			return false, fmt.Errorf("failed to check the network tier of the IP %q: %w", requestedIP, err)
 		}
 		netTier := cloud.NetworkTierGCEValueToType(netTierStr)
 		if netTier != desiredNetTier {
@@ -485,7 +615,7 @@ func verifyUserRequestedIP(s CloudAddressService, region, requestedIP, fwdRuleIP
 	return false, fmt.Errorf("requested ip %q is neither static nor assigned to the LB", requestedIP)
 }
 
-func (g *Cloud) ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation bool, svc *v1.Service, loadBalancerName, clusterID, ipAddressToUse string, hosts []*gceInstance, hcToCreate, hcToDelete *compute.HttpHealthCheck) error {
+func (g *Cloud) ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation bool, svc *v1.Service, loadBalancerName, clusterID, ipAddressToUse string, hosts []*gceInstance, hcToCreate, hcToDelete *compute.HttpHealthCheck, hcParams *healthCheckParams) error {
 	serviceName := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
 	lbRefStr := fmt.Sprintf("%v(%v)", loadBalancerName, serviceName)
 
@@ -496,7 +626,7 @@ func (g *Cloud) ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation bool,
 			hcNames = append(hcNames, hcToDelete.Name)
 		}
 		if err := g.DeleteExternalTargetPoolAndChecks(svc, loadBalancerName, g.region, clusterID, hcNames...); err != nil {
-			return fmt.Errorf("failed to delete existing target pool for load balancer (%s) update: %v", lbRefStr, err)
+			return fmt.Errorf("failed to delete existing target pool for load balancer (%s) update: %w", lbRefStr, err)
 		}
 		klog.Infof("ensureTargetPoolAndHealthCheck(%s): Deleted target pool.", lbRefStr)
 	}
@@ -507,8 +637,8 @@ func (g *Cloud) ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation bool,
 		if len(hosts) > maxTargetPoolCreateInstances {
 			createInstances = createInstances[:maxTargetPoolCreateInstances]
 		}
-		if err := g.createTargetPoolAndHealthCheck(svc, loadBalancerName, serviceName.String(), ipAddressToUse, g.region, clusterID, createInstances, hcToCreate); err != nil {
-			return fmt.Errorf("failed to create target pool for load balancer (%s): %v", lbRefStr, err)
+		if err := g.createTargetPoolAndHealthCheck(svc, loadBalancerName, serviceName.String(), ipAddressToUse, g.region, clusterID, createInstances, hcToCreate, hcParams); err != nil {
+			return fmt.Errorf("failed to create target pool for load balancer (%s): %w", lbRefStr, err)
 		}
 		if hcToCreate != nil {
 			klog.Infof("ensureTargetPoolAndHealthCheck(%s): Created health checks %v.", lbRefStr, hcToCreate.Name)
@@ -518,19 +648,19 @@ func (g *Cloud) ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation bool,
 		} else {
 			klog.Infof("ensureTargetPoolAndHealthCheck(%s): Created initial target pool (now updating the remaining %d hosts).", lbRefStr, len(hosts)-maxTargetPoolCreateInstances)
 			if err := g.updateTargetPool(loadBalancerName, hosts); err != nil {
-				return fmt.Errorf("failed to update target pool for load balancer (%s): %v", lbRefStr, err)
+				return fmt.Errorf("failed to update target pool for load balancer (%s): %w", lbRefStr, err)
 			}
 			klog.Infof("ensureTargetPoolAndHealthCheck(%s): Updated target pool (with %d hosts).", lbRefStr, len(hosts)-maxTargetPoolCreateInstances)
 		}
 	} else if tpExists {
 		// Ensure hosts are updated even if there is no other changes required on target pool.
 		if err := g.updateTargetPool(loadBalancerName, hosts); err != nil {
-			return fmt.Errorf("failed to update target pool for load balancer (%s): %v", lbRefStr, err)
+			return fmt.Errorf("failed to update target pool for load balancer (%s): %w", lbRefStr, err)
 		}
 		klog.Infof("ensureTargetPoolAndHealthCheck(%s): Updated target pool (with %d hosts).", lbRefStr, len(hosts))
 		if hcToCreate != nil {
-			if hc, err := g.ensureHTTPHealthCheck(hcToCreate.Name, hcToCreate.RequestPath, int32(hcToCreate.Port)); err != nil || hc == nil {
-				return fmt.Errorf("failed to ensure health check for %v port %d path %v: %v", loadBalancerName, hcToCreate.Port, hcToCreate.RequestPath, err)
+			if hc, err := g.ensureHTTPHealthCheck(hcToCreate.Name, hcToCreate.RequestPath, int32(hcToCreate.Port), hcParams); err != nil || hc == nil {
+				return fmt.Errorf("failed to ensure health check for %v port %d path %v: %w", loadBalancerName, hcToCreate.Port, hcToCreate.RequestPath, err)
 			}
 		}
 	} else {
@@ -540,7 +670,7 @@ func (g *Cloud) ensureTargetPoolAndHealthCheck(tpExists, tpNeedsRecreation bool,
 	return nil
 }
 
-func (g *Cloud) createTargetPoolAndHealthCheck(svc *v1.Service, name, serviceName, ipAddress, region, clusterID string, hosts []*gceInstance, hc *compute.HttpHealthCheck) error {
+func (g *Cloud) createTargetPoolAndHealthCheck(svc *v1.Service, name, serviceName, ipAddress, region, clusterID string, hosts []*gceInstance, hc *compute.HttpHealthCheck, hcParams *healthCheckParams) error {
 	// health check management is coupled with targetPools to prevent leaks. A
 	// target pool is the only thing that requires a health check, so we delete
 	// associated checks on teardown, and ensure checks on setup.
@@ -559,8 +689,8 @@ func (g *Cloud) createTargetPoolAndHealthCheck(svc *v1.Service, name, serviceNam
 		}
 		var err error
 		hcRequestPath, hcPort := hc.RequestPath, hc.Port
-		if hc, err = g.ensureHTTPHealthCheck(hc.Name, hc.RequestPath, int32(hc.Port)); err != nil || hc == nil {
-			return fmt.Errorf("failed to ensure health check for %v port %d path %v: %v", name, hcPort, hcRequestPath, err)
+		if hc, err = g.ensureHTTPHealthCheck(hc.Name, hc.RequestPath, int32(hc.Port), hcParams); err != nil || hc == nil {
+			return fmt.Errorf("failed to ensure health check for %v port %d path %v: %w", name, hcPort, hcRequestPath, err)
 		}
 		hcLinks = append(hcLinks, hc.SelfLink)
 	}
@@ -572,7 +702,7 @@ func (g *Cloud) createTargetPoolAndHealthCheck(svc *v1.Service, name, serviceNam
 	klog.Infof("Creating targetpool %v with %d healthchecks", name, len(hcLinks))
 	pool := &compute.TargetPool{
 		Name:            name,
-		Description:     fmt.Sprintf(`{"kubernetes.io/service-name":"%s"}`, serviceName),
+		Description:     makeClusterServiceDescription(serviceName, clusterID),
 		Instances:       instances,
 		SessionAffinity: translateAffinityType(svc.Spec.SessionAffinity),
 		HealthChecks:    hcLinks,
@@ -706,8 +836,13 @@ func needToUpdateHTTPHealthChecks(hc, newHC *compute.HttpHealthCheck) bool {
 	return false
 }
 
-func (g *Cloud) ensureHTTPHealthCheck(name, path string, port int32) (hc *compute.HttpHealthCheck, err error) {
+// ensureHTTPHealthCheck creates or updates the legacy health check. Its
+// parameters are no smaller than the defaults, or exactly params if not nil.
+func (g *Cloud) ensureHTTPHealthCheck(name, path string, port int32, params *healthCheckParams) (hc *compute.HttpHealthCheck, err error) {
 	newHC := makeHTTPHealthCheck(name, path, port)
+	if params != nil {
+		params.applyToHTTPHealthCheck(newHC)
+	}
 	hc, err = g.GetHTTPHealthCheck(name)
 	if hc == nil || err != nil && isHTTPErrorCode(err, http.StatusNotFound) {
 		klog.Infof("Did not find health check %v, creating port %v path %v", name, port, path)
@@ -724,9 +859,11 @@ func (g *Cloud) ensureHTTPHealthCheck(name, path string, port int32) (hc *comput
 	}
 	// Validate health check fields
 	klog.V(4).Infof("Checking http health check params %s", name)
-	if needToUpdateHTTPHealthChecks(hc, newHC) {
+	if needToUpdateHTTPHealthChecks(hc, newHC) || params != nil && !params.matchesHTTPHealthCheck(hc) {
 		klog.Warningf("Health check %v exists but parameters have drifted - updating...", name)
-		mergeHTTPHealthChecks(hc, newHC)
+		if params == nil {
+			mergeHTTPHealthChecks(hc, newHC)
+		}
 		if err := g.UpdateHTTPHealthCheck(newHC); err != nil {
 			klog.Warningf("Failed to reconcile http health check %v parameters", name)
 			return nil, err
@@ -752,7 +889,7 @@ func (g *Cloud) forwardingRuleNeedsUpdate(name, region string, loadBalancerIP st
 		}
 		// Err on the side of caution in case of errors. Caller should notice the error and retry.
 		// We never want to end up recreating resources because g api flaked.
-		return true, false, "", fmt.Errorf("error getting load balancer's forwarding rule: %v", err)
+		return true, false, "", fmt.Errorf("error getting load balancer's forwarding rule: %w", err)
 	}
 	// If the user asks for a specific static ip through the Service spec,
 	// check that we're actually using it.
@@ -791,7 +928,7 @@ func (g *Cloud) targetPoolNeedsRecreation(name, region string, affinityType v1.S
 		}
 		// Err on the side of caution in case of errors. Caller should notice the error and retry.
 		// We never want to end up recreating resources because g api flaked.
-		return true, false, fmt.Errorf("error getting load balancer's target pool: %v", err)
+		return true, false, fmt.Errorf("error getting load balancer's target pool: %w", err)
 	}
 	// TODO: If the user modifies their Service's session affinity, it *should*
 	// reflect in the associated target pool. However, currently not setting the
@@ -872,12 +1009,16 @@ func translateAffinityType(affinityType v1.ServiceAffinity) string {
 }
 
 func (g *Cloud) firewallNeedsUpdate(name, serviceName, ipAddress string, ports []v1.ServicePort, sourceRanges utilnet.IPNetSet) (exists bool, needsUpdate bool, err error) {
+	if g.skipFirewallManagement {
+		// The firewall cannot be read, the command to create it is raised.
+		return false, true, nil
+	}
 	fw, err := g.GetFirewall(MakeFirewallName(name))
 	if err != nil {
 		if isHTTPErrorCode(err, http.StatusNotFound) {
 			return false, true, nil
 		}
-		return false, false, fmt.Errorf("error getting load balancer's firewall: %v", err)
+		return false, false, fmt.Errorf("error getting load balancer's firewall: %w", err)
 	}
 	if fw.Description != makeFirewallDescription(serviceName, ipAddress) {
 		return true, true, nil
@@ -907,6 +1048,10 @@ func (g *Cloud) firewallNeedsUpdate(name, serviceName, ipAddress string, ports [
 		return true, true, nil
 	}
 
+	if g.firewallTargetsNeedUpdate(fw) {
+		return true, true, nil
+	}
+
 	destinationRanges := []string{ipAddress}
 
 	if !reflect.DeepEqual(destinationRanges, fw.DestinationRanges) {
@@ -926,10 +1071,13 @@ func (g *Cloud) ensureHTTPHealthCheckFirewall(svc *v1.Service, serviceName, ipAd
 	ports := []v1.ServicePort{{Protocol: "tcp", Port: hcPort}}
 
 	fwName := MakeHealthCheckFirewallName(clusterID, hcName, isNodesHealthCheck)
+	if g.skipFirewallManagement {
+		return g.createFirewall(svc, fwName, desc, ipAddress, sourceRanges, ports, hosts)
+	}
 	fw, err := g.GetFirewall(fwName)
 	if err != nil {
 		if !isHTTPErrorCode(err, http.StatusNotFound) {
-			return fmt.Errorf("error getting firewall for health checks: %v", err)
+			return fmt.Errorf("error getting firewall for health checks: %w", err)
 		}
 		klog.Infof("Creating firewall %v for health checks.", fwName)
 		if err := g.createFirewall(svc, fwName, desc, ipAddress, sourceRanges, ports, hosts); err != nil {
@@ -943,7 +1091,8 @@ func (g *Cloud) ensureHTTPHealthCheckFirewall(svc *v1.Service, serviceName, ipAd
 		len(fw.Allowed) != 1 ||
 		fw.Allowed[0].IPProtocol != string(ports[0].Protocol) ||
 		!equalStringSets(fw.Allowed[0].Ports, []string{strconv.Itoa(int(ports[0].Port))}) ||
-		!equalStringSets(fw.SourceRanges, sourceRanges.StringSlice()) {
+		!equalStringSets(fw.SourceRanges, sourceRanges.StringSlice()) ||
+		g.firewallTargetsNeedUpdate(fw) {
 		klog.Warningf("Firewall %v exists but parameters have drifted - updating...", fwName)
 		if err := g.updateFirewall(svc, fwName, desc, ipAddress, sourceRanges, ports, hosts); err != nil {
 			klog.Warningf("Failed to reconcile firewall %v parameters.", fwName)
@@ -954,12 +1103,12 @@ func (g *Cloud) ensureHTTPHealthCheckFirewall(svc *v1.Service, serviceName, ipAd
 	return nil
 }
 
-func createForwardingRule(s CloudForwardingRuleService, name, serviceName, region, ipAddress, target string, ports []v1.ServicePort, netTier cloud.NetworkTier) error {
+func createForwardingRule(s CloudForwardingRuleService, name, serviceName, clusterID, region, ipAddress, target string, ports []v1.ServicePort, netTier cloud.NetworkTier) error {
 	portRange, err := loadBalancerPortRange(ports)
 	if err != nil {
 		return err
 	}
-	desc := makeServiceDescription(serviceName)
+	desc := makeClusterServiceDescription(serviceName, clusterID)
 	ipProtocol := string(ports[0].Protocol)
 
 	rule := &compute.ForwardingRule{
@@ -986,6 +1135,9 @@ func (g *Cloud) createFirewall(svc *v1.Service, name, desc, destinationIP string
 	if err != nil {
 		return err
 	}
+	if g.skipFirewallChange(svc, firewall.Name, FirewallToGCloudCreateCmd(firewall, g.NetworkProjectID())) {
+		return nil
+	}
 	if err = g.CreateFirewall(firewall); err != nil {
 		if isHTTPErrorCode(err, http.StatusConflict) {
 			return nil
@@ -1005,6 +1157,7 @@ func (g *Cloud) updateFirewall(svc *v1.Service, name, desc, destinationIP string
 		return err
 	}
 
+	clearOtherFirewallTargets(firewall)
 	if err = g.PatchFirewall(firewall); err != nil {
 		if isHTTPErrorCode(err, http.StatusConflict) {
 			return nil
@@ -1025,22 +1178,11 @@ func (g *Cloud) firewallObject(name, desc, destinationIP string, sourceRanges ut
 	// 100 ports or port ranges can be used in a firewall rule.
 	_, portRanges, _ := getPortsAndProtocol(ports)
 
-	// If the node tags to be used for this cluster have been predefined in the
-	// provider config, just use them. Otherwise, invoke computeHostTags method to get the tags.
-	hostTags := g.nodeTags
-	if len(hostTags) == 0 {
-		var err error
-		if hostTags, err = g.computeHostTags(hosts); err != nil {
-			return nil, fmt.Errorf("no node tags supplied and also failed to parse the given lists of hosts for tags. Abort creating firewall rule")
-		}
-	}
-
 	firewall := &compute.Firewall{
 		Name:         name,
 		Description:  desc,
 		Network:      g.networkURL,
 		SourceRanges: sourceRanges.StringSlice(),
-		TargetTags:   hostTags,
 		Allowed: []*compute.FirewallAllowed{
 			{
 				// TODO: Make this more generic. Currently this method is only
@@ -1056,6 +1198,21 @@ func (g *Cloud) firewallObject(name, desc, destinationIP string, sourceRanges ut
 	if destinationIP != "" {
 		firewall.DestinationRanges = []string{destinationIP}
 	}
+	// If the node tags to be used for this cluster have been predefined in the
+	// provider config, just use them. Otherwise, invoke computeHostTags method to get the tags.
+	err := g.setFirewallTargets(firewall, func() ([]string, error) {
+		if hostTags := g.getNodeTags(); len(hostTags) > 0 {
+			return hostTags, nil
+		}
+		hostTags, err := g.computeHostTags(hosts)
+		if err != nil {
+			return nil, fmt.Errorf("no node tags supplied and also failed to parse the given lists of hosts for tags. Abort creating firewall rule")
+		}
+		return hostTags, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return firewall, nil
 }
 
@@ -1093,7 +1250,7 @@ func ensureStaticIP(s CloudAddressService, name, serviceName, region, existingIP
 	if existingIP != "" {
 		addr, err := s.GetRegionAddressByIP(region, existingIP)
 		if err != nil {
-			return "", false, fmt.Errorf("error getting static IP address: %v", err)
+			return "", false, fmt.Errorf("error getting static IP address: %w", err)
 		}
 		return addr.Address, existed, nil
 	}
@@ -1101,7 +1258,7 @@ func ensureStaticIP(s CloudAddressService, name, serviceName, region, existingIP
 	// Otherwise, get address by name
 	addr, err := s.GetRegionAddress(name, region)
 	if err != nil {
-		return "", false, fmt.Errorf("error getting static IP address: %v", err)
+		return "", false, fmt.Errorf("error getting static IP address: %w", err)
 	}
 
 	return addr.Address, existed, nil
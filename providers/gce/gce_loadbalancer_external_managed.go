@@ -0,0 +1,190 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// schemeExternalManaged is the load balancing scheme of the backend
+	// services of regional external proxy load balancers.
+	schemeExternalManaged = cloud.LbScheme("EXTERNAL_MANAGED")
+
+	// externalManagedLBMaxConnectionsPerEndpoint caps the connections the
+	// proxies of an EXTERNAL_MANAGED load balancer open to each node.
+	externalManagedLBMaxConnectionsPerEndpoint = 1000
+)
+
+// usesExternalManagedLB returns whether the external load balancer of the
+// Service is a Gateway fronted one, whose EXTERNAL_MANAGED backend service is
+// managed by this controller.
+func (g *Cloud) usesExternalManagedLB(svc *v1.Service) bool {
+	return g.AlphaFeatureGate.Enabled(AlphaFeatureExternalManagedLB) &&
+		GetLoadBalancerAnnotationExternalManagedBackends(svc) &&
+		!usesL4RBS(svc, nil)
+}
+
+// externalManagedLBPort returns the port served by the EXTERNAL_MANAGED load
+// balancer of the Service, and an error unless the Service has a single TCP
+// port with a node port.
+func externalManagedLBPort(svc *v1.Service) (v1.ServicePort, error) {
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Protocol != v1.ProtocolTCP {
+		return v1.ServicePort{}, fmt.Errorf("load balancers with %s backends serve a single TCP port", ExternalLBBackendsExternalManaged)
+	}
+	if svc.Spec.Ports[0].NodePort == 0 {
+		return v1.ServicePort{}, fmt.Errorf("load balancers with %s backends need a node port", ExternalLBBackendsExternalManaged)
+	}
+	return svc.Spec.Ports[0], nil
+}
+
+// ensureExternalManagedLoadBalancer is the implementation of
+// LoadBalancer.EnsureLoadBalancer for external load balancers with
+// EXTERNAL_MANAGED backends. The controller manages a regional health check
+// and its firewall, a GCE_VM_IP_PORT network endpoint group of the nodes on
+// the node port of the Service in each zone, and a regional backend service.
+// The target proxy, forwarding rule and proxy-only subnet firewall in front
+// of the backend service are managed by a Gateway, and the IP address of the
+// forwarding rule named by the ServiceAnnotationExternalManagedForwardingRule
+// annotation is reported in the status. A target pool or NEG based load
+// balancer of the Service is replaced.
+func (g *Cloud) ensureExternalManagedLoadBalancer(clusterName, clusterID string, svc *v1.Service, existingFwdRule *compute.ForwardingRule, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf(errStrLbNoHosts)
+	}
+	port, err := externalManagedLBPort(svc)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := g.getInstancesByNames(nodeNames(nodes))
+	if err != nil {
+		return nil, err
+	}
+
+	loadBalancerName := g.GetLoadBalancerName(context.TODO(), clusterName, svc)
+	serviceName := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
+	lbRefStr := fmt.Sprintf("%v(%v)", loadBalancerName, serviceName)
+	klog.V(2).Infof("ensureExternalManagedLoadBalancer(%s, %v, %v)", lbRefStr, g.region, loggableNodeNames(nodes))
+
+	bsMetadata, err := getBackendServiceMetadata(svc, false)
+	if err != nil {
+		return nil, err
+	}
+	bsDescription, err := makeBackendServiceDescriptionWithMetadata(serviceName, false, bsMetadata)
+	if err != nil {
+		return nil, err
+	}
+	hcParams, err := getHealthCheckParams(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	if existingFwdRule != nil {
+		klog.Infof("ensureExternalManagedLoadBalancer(%s): Replacing the %s load balancer.", lbRefStr, existingFwdRule.LoadBalancingScheme)
+		if err := g.teardownExternalLoadBalancer(clusterID, svc, loadBalancerName); err != nil {
+			return nil, err
+		}
+	}
+
+	hcPath, hcPort := GetNodesHealthCheckPath(), GetNodesHealthCheckPort()
+	if path, port := servicehelpers.GetServiceHealthCheckPathPort(svc); path != "" {
+		hcPath, hcPort = path, port
+	} else if hcParams != nil {
+		hcPath = hcParams.requestPath
+	}
+	hcLogging, err := g.serviceHealthCheckLogging(svc, false)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := g.ensureExternalNEGHealthCheck(loadBalancerName, serviceName, hcPath, hcPort, hcParams, hcLogging)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.ensureHTTPHealthCheckFirewall(svc, serviceName.String(), "", g.region, clusterID, hosts, loadBalancerName, hcPort, false); err != nil {
+		return nil, err
+	}
+
+	negLinks, err := g.ensureExternalNEGs(loadBalancerName, serviceName, hosts, int64(port.NodePort))
+	if err != nil {
+		return nil, err
+	}
+	removedNEGs, err := g.ensureExternalNEGBackendService(loadBalancerName, bsDescription, bsMetadata, svc.Spec.SessionAffinity, schemeExternalManaged, port.Protocol, externalManagedBackends(negLinks), hc.SelfLink)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.deleteExternalNEGs(removedNEGs); err != nil {
+		return nil, err
+	}
+	klog.Infof("ensureExternalManagedLoadBalancer(%s): Ensured backend service.", lbRefStr)
+	return g.externalManagedLBStatus(svc)
+}
+
+// externalManagedLBStatus returns the status of the EXTERNAL_MANAGED load
+// balancer of the Service, with the IP address of the Gateway managed
+// forwarding rule named by its annotation once it exists.
+func (g *Cloud) externalManagedLBStatus(svc *v1.Service) (*v1.LoadBalancerStatus, error) {
+	status := &v1.LoadBalancerStatus{}
+	name := svc.Annotations[ServiceAnnotationExternalManagedForwardingRule]
+	if name == "" {
+		return status, nil
+	}
+	fwdRule, err := g.GetRegionForwardingRule(name, g.region)
+	if isNotFound(err) {
+		klog.V(2).Infof("externalManagedLBStatus(%s/%s): forwarding rule %s does not exist yet", svc.Namespace, svc.Name, name)
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Ingress = []v1.LoadBalancerIngress{{IP: fwdRule.IPAddress, IPMode: loadBalancerIPMode(fwdRule.LoadBalancingScheme)}}
+	return status, nil
+}
+
+// replaceExternalManagedLoadBalancer tears down the EXTERNAL_MANAGED backends
+// of a Service that no longer requests them, so that a target pool or NEG
+// based load balancer is created in their place.
+func (g *Cloud) replaceExternalManagedLoadBalancer(svc *v1.Service, clusterName, clusterID string) error {
+	loadBalancerName := g.GetLoadBalancerName(context.TODO(), clusterName, svc)
+	bs, err := g.GetRegionBackendService(loadBalancerName, g.region)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	if bs.LoadBalancingScheme != string(schemeExternalManaged) {
+		return nil
+	}
+	klog.Infof("replaceExternalManagedLoadBalancer(%v(%s/%s)): Replacing the %s backends.", loadBalancerName, svc.Namespace, svc.Name, schemeExternalManaged)
+	return g.teardownExternalNEGLoadBalancer(svc, loadBalancerName, clusterID)
+}
+
+func externalManagedBackends(negLinks []string) []*compute.Backend {
+	backends := negBackends(negLinks)
+	for _, b := range backends {
+		b.MaxConnectionsPerEndpoint = externalManagedLBMaxConnectionsPerEndpoint
+	}
+	return backends
+}
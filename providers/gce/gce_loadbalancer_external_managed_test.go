@@ -0,0 +1,179 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func fakeExternalManagedLBService() *v1.Service {
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationExternalLBBackends] = ExternalLBBackendsExternalManaged
+	svc.Spec.Ports = []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}}
+	return svc
+}
+
+func TestExternalManagedLBPort(t *testing.T) {
+	t.Parallel()
+
+	svc := fakeExternalManagedLBService()
+	port, err := externalManagedLBPort(svc)
+	require.NoError(t, err)
+	assert.Equal(t, int32(30080), port.NodePort)
+
+	for desc, ports := range map[string][]v1.ServicePort{
+		"udp":          {{Protocol: v1.ProtocolUDP, Port: 53, NodePort: 30053}},
+		"two ports":    {{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}, {Protocol: v1.ProtocolTCP, Port: 443, NodePort: 30443}},
+		"no node port": {{Protocol: v1.ProtocolTCP, Port: 80}},
+	} {
+		svc.Spec.Ports = ports
+		_, err := externalManagedLBPort(svc)
+		assert.Error(t, err, desc)
+	}
+}
+
+func TestEnsureExternalManagedLoadBalancer(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureExternalManagedLB})
+	endpoints := fakeNEGEndpoints(gce)
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeExternalManagedLBService()
+	svc.Annotations[ServiceAnnotationExternalManagedForwardingRule] = "gateway-fr"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	assert.Empty(t, status.Ingress, "the Gateway forwarding rule does not exist yet")
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc)
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, string(schemeExternalManaged), bs.LoadBalancingScheme)
+	assert.Equal(t, "TCP", bs.Protocol)
+	require.Len(t, bs.Backends, 1)
+	assert.Equal(t, int64(externalManagedLBMaxConnectionsPerEndpoint), bs.Backends[0].MaxConnectionsPerEndpoint)
+	neg, err := gce.GetNetworkEndpointGroup(lbName, vals.ZoneName)
+	require.NoError(t, err)
+	assert.Equal(t, neg.SelfLink, bs.Backends[0].Group)
+	assert.Equal(t, gceVMIPPortNEGType, neg.NetworkEndpointType)
+	assert.Equal(t, []string{"test-node-1:30080"}, endpoints[*meta.ZonalKey(lbName, vals.ZoneName)].List())
+	hc, err := gce.GetRegionHealthCheck(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hc.SelfLink}, bs.HealthChecks)
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.True(t, isNotFound(err), "the frontend is left to the Gateway, got %v", err)
+
+	// The IP address of the Gateway forwarding rule is reported once it
+	// exists.
+	require.NoError(t, gce.CreateRegionForwardingRule(&compute.ForwardingRule{
+		Name:                "gateway-fr",
+		IPAddress:           "34.1.2.3",
+		LoadBalancingScheme: string(schemeExternalManaged),
+	}, gce.region))
+	status, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	require.Len(t, status.Ingress, 1)
+	assert.Equal(t, "34.1.2.3", status.Ingress[0].IP)
+	assert.Equal(t, v1.LoadBalancerIPModeProxy, *status.Ingress[0].IPMode)
+
+	// The endpoints follow the node port and the nodes.
+	svc.Spec.Ports[0].NodePort = 30081
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test-node-1:30081"}, endpoints[*meta.ZonalKey(lbName, vals.ZoneName)].List())
+	newNodes, err := createAndInsertNodes(gce, []string{"test-node-2"}, vals.ZoneName)
+	require.NoError(t, err)
+	require.NoError(t, gce.UpdateLoadBalancer(context.Background(), vals.ClusterName, svc, append(nodes, newNodes...)))
+	assert.Equal(t, []string{"test-node-1:30081", "test-node-2:30081"}, endpoints[*meta.ZonalKey(lbName, vals.ZoneName)].List())
+
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svc))
+	_, err = gce.GetRegionBackendService(lbName, gce.region)
+	assert.True(t, isNotFound(err), "backend service should be deleted, got %v", err)
+	_, err = gce.GetNetworkEndpointGroup(lbName, vals.ZoneName)
+	assert.True(t, isNotFound(err), "network endpoint group should be deleted, got %v", err)
+	_, err = gce.GetRegionHealthCheck(lbName, gce.region)
+	assert.True(t, isNotFound(err), "health check should be deleted, got %v", err)
+	_, err = gce.GetRegionForwardingRule("gateway-fr", gce.region)
+	assert.NoError(t, err, "the Gateway forwarding rule should be kept")
+}
+
+func TestExternalManagedLoadBalancerReplacesTargetPool(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureExternalManagedLB})
+	fakeNEGEndpoints(gce)
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	svc.Spec.Ports = []v1.ServicePort{{Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}}
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc)
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	require.NoError(t, err)
+
+	svc.Annotations[ServiceAnnotationExternalLBBackends] = ExternalLBBackendsExternalManaged
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.True(t, isNotFound(err), "forwarding rule should be deleted, got %v", err)
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "target pool should be deleted, got %v", err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName))
+	assert.True(t, isNotFound(err), "firewall should be deleted, got %v", err)
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, string(schemeExternalManaged), bs.LoadBalancingScheme)
+
+	// Opting out replaces the EXTERNAL_MANAGED backends with a target pool.
+	delete(svc.Annotations, ServiceAnnotationExternalLBBackends)
+	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	require.Len(t, status.Ingress, 1)
+	_, err = gce.GetRegionBackendService(lbName, gce.region)
+	assert.True(t, isNotFound(err), "backend service should be deleted, got %v", err)
+	_, err = gce.GetNetworkEndpointGroup(lbName, vals.ZoneName)
+	assert.True(t, isNotFound(err), "network endpoint group should be deleted, got %v", err)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, lbName, getNameFromLink(fwdRule.Target))
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,677 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// negExternalLBConnectionDrainingTimeoutSec is how long the backend
+	// service of a NEG backed external load balancer keeps serving the
+	// established connections of endpoints that are being removed.
+	negExternalLBConnectionDrainingTimeoutSec = 30
+
+	// maxNetworkEndpointsPerBatch is the maximum number of endpoints attached
+	// to or detached from a network endpoint group in a single call.
+	maxNetworkEndpointsPerBatch = 500
+
+	gceVMIPNEGType     = "GCE_VM_IP"
+	gceVMIPPortNEGType = "GCE_VM_IP_PORT"
+)
+
+const (
+	// migratingLoadBalancerReason is the reason of the events reporting the
+	// progress of the migration of a target pool based load balancer to a
+	// backend service.
+	migratingLoadBalancerReason = "MigratingLoadBalancer"
+	// migratedLoadBalancerReason is the reason of the event reporting the
+	// completion of the migration.
+	migratedLoadBalancerReason = "MigratedLoadBalancer"
+)
+
+// usesNEGExternalLB returns whether the external load balancer of the Service
+// is backed by network endpoint groups managed by this controller.
+func (g *Cloud) usesNEGExternalLB(svc *v1.Service) bool {
+	return featureEnabled(NEGBackedNetLB) &&
+		(GetLoadBalancerAnnotationNEGBackends(svc) || GetLoadBalancerAnnotationBackendServiceMigration(svc)) &&
+		!usesL4RBS(svc, nil)
+}
+
+// isNEGExternalLBForwardingRule returns whether the forwarding rule belongs to
+// a NEG backed external load balancer created by this controller, as opposed
+// to one handed over to the L4 RBS controller. The backend service of the
+// former is named after the forwarding rule.
+func isNEGExternalLBForwardingRule(fwdRule *compute.ForwardingRule) bool {
+	return fwdRule != nil && fwdRule.BackendService != "" && getNameFromLink(fwdRule.BackendService) == fwdRule.Name
+}
+
+// ensureExternalNEGLoadBalancer is the implementation of
+// LoadBalancer.EnsureLoadBalancer for external load balancers with NEG
+// backends. They consist of a static IP address, firewall rules for the
+// service and health check traffic, a regional health check, a GCE_VM_IP
+// network endpoint group of the nodes in each zone, a regional backend service
+// and a forwarding rule. A target pool based load balancer of the Service is
+// replaced, keeping its IP address.
+func (g *Cloud) ensureExternalNEGLoadBalancer(clusterName, clusterID string, svc *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf(errStrLbNoHosts)
+	}
+	hosts, err := g.getInstancesByNames(nodeNames(nodes))
+	if err != nil {
+		return nil, err
+	}
+
+	loadBalancerName := g.GetLoadBalancerName(context.TODO(), clusterName, svc)
+	serviceName := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
+	lbRefStr := fmt.Sprintf("%v(%v)", loadBalancerName, serviceName)
+	klog.V(2).Infof("ensureExternalNEGLoadBalancer(%s, %v, %v)", lbRefStr, g.region, loggableNodeNames(nodes))
+
+	netTier, err := g.getServiceNetworkTier(svc)
+	if err != nil {
+		klog.Errorf("ensureExternalNEGLoadBalancer(%s): Failed to get the desired network tier: %v.", lbRefStr, err)
+		return nil, err
+	}
+	bsMetadata, err := getBackendServiceMetadata(svc, false)
+	if err != nil {
+		return nil, err
+	}
+	bsMetadata.localityLBPolicy = localityLBPolicyMaglev
+	if weighted, err := getWeightedLoadBalancing(svc); err != nil {
+		return nil, err
+	} else if weighted {
+		bsMetadata.localityLBPolicy = localityLBPolicyWeightedMaglev
+	}
+	bsDescription, err := makeBackendServiceDescriptionWithMetadata(serviceName, false, bsMetadata)
+	if err != nil {
+		return nil, err
+	}
+	hcParams, err := getHealthCheckParams(svc)
+	if err != nil {
+		return nil, err
+	}
+	requestedIP, err := g.requestedLoadBalancerIP(svc, cloud.SchemeExternal, "", netTier)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := svc.Annotations[NetworkTierAnnotationKey]; ok {
+		if err := g.deleteWrongNetworkTieredResources(loadBalancerName, lbRefStr, netTier); err != nil {
+			klog.Errorf("ensureExternalNEGLoadBalancer(%s): Failed to delete the resources with the wrong network tier: %v.", lbRefStr, err)
+			return nil, err
+		}
+	}
+
+	existingFwdRule, err := g.GetRegionForwardingRule(loadBalancerName, g.region)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	fwdRuleIP := ""
+	if existingFwdRule != nil {
+		fwdRuleIP = existingFwdRule.IPAddress
+	}
+
+	// The IP address is handled as in ensureExternalLoadBalancer: it is
+	// reserved as static while the other resources are replaced, and demoted
+	// to ephemeral once the forwarding rule is created, unless it is owned by
+	// the user.
+	ipAddressToUse := ""
+	isUserOwnedIP := false
+	isSafeToReleaseIP := false
+	defer func() {
+		if isUserOwnedIP {
+			return
+		}
+		if isSafeToReleaseIP {
+			if err := g.DeleteRegionAddress(loadBalancerName, g.region); err != nil && !isNotFound(err) {
+				klog.Errorf("ensureExternalNEGLoadBalancer(%s): Failed to release static IP %s in region %v: %v.", lbRefStr, ipAddressToUse, g.region, err)
+			} else if err == nil {
+				klog.Infof("ensureExternalNEGLoadBalancer(%s): Released static IP %s.", lbRefStr, ipAddressToUse)
+			}
+		} else {
+			klog.Warningf("ensureExternalNEGLoadBalancer(%s): Orphaning static IP %s in region %v: %v.", lbRefStr, ipAddressToUse, g.region, err)
+		}
+	}()
+
+	if requestedIP != "" {
+		isUserOwnedIP, err = verifyUserRequestedIP(g, g.region, requestedIP, fwdRuleIP, lbRefStr, netTier)
+		if err != nil {
+			return nil, err
+		}
+		ipAddressToUse = requestedIP
+	}
+	if !isUserOwnedIP {
+		ipAddr, existed, err := ensureStaticIP(g, loadBalancerName, serviceName.String(), g.region, fwdRuleIP, netTier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to ensure a static IP for load balancer (%s): %w", lbRefStr, err)
+		}
+		klog.Infof("ensureExternalNEGLoadBalancer(%s): Ensured IP address %s (tier: %s).", lbRefStr, ipAddr, netTier)
+		isSafeToReleaseIP = !existed
+		ipAddressToUse = ipAddr
+	}
+
+	// A target pool based load balancer keeps serving until the forwarding
+	// rule is switched to the backend service, once it is ready.
+	migrating := existingFwdRule != nil && existingFwdRule.Target != ""
+	if migrating {
+		klog.Infof("ensureExternalNEGLoadBalancer(%s): Migrating the target pool based load balancer.", lbRefStr)
+		isSafeToReleaseIP = false
+		g.eventRecorder.Eventf(svc, v1.EventTypeNormal, migratingLoadBalancerReason, "Migrating the target pool based load balancer to a backend service, keeping IP %s", ipAddressToUse)
+	}
+
+	sourceRanges, err := g.loadBalancerSourceRanges(svc)
+	if err != nil {
+		return nil, err
+	}
+	ports := svc.Spec.Ports
+	firewallExists, firewallNeedsUpdate, err := g.firewallNeedsUpdate(loadBalancerName, serviceName.String(), ipAddressToUse, ports, sourceRanges)
+	if err != nil {
+		return nil, err
+	}
+	if firewallNeedsUpdate {
+		desc := makeFirewallDescription(serviceName.String(), ipAddressToUse)
+		if firewallExists {
+			err = g.updateFirewall(svc, MakeFirewallName(loadBalancerName), desc, ipAddressToUse, sourceRanges, ports, hosts)
+		} else {
+			err = g.createFirewall(svc, MakeFirewallName(loadBalancerName), desc, ipAddressToUse, sourceRanges, ports, hosts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		klog.Infof("ensureExternalNEGLoadBalancer(%s): Ensured firewall.", lbRefStr)
+	}
+
+	hcPath, hcPort := GetNodesHealthCheckPath(), GetNodesHealthCheckPort()
+	if path, port := servicehelpers.GetServiceHealthCheckPathPort(svc); path != "" {
+		hcPath, hcPort = path, port
+		if hcParams != nil {
+			hcPath = hcParams.requestPath
+		}
+	} else if hcParams != nil {
+		hcPath = hcParams.requestPath
+	}
+	hcLogging, err := g.serviceHealthCheckLogging(svc, false)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := g.ensureExternalNEGHealthCheck(loadBalancerName, serviceName, hcPath, hcPort, hcParams, hcLogging)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.ensureHTTPHealthCheckFirewall(svc, serviceName.String(), ipAddressToUse, g.region, clusterID, hosts, loadBalancerName, hcPort, false); err != nil {
+		return nil, err
+	}
+
+	negLinks, err := g.ensureExternalNEGs(loadBalancerName, serviceName, hosts, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, _, protocol := getPortsAndProtocol(ports)
+	removedNEGs, err := g.ensureExternalNEGBackendService(loadBalancerName, bsDescription, bsMetadata, svc.Spec.SessionAffinity, cloud.SchemeExternal, protocol, negBackends(negLinks), hc.SelfLink)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.deleteExternalNEGs(removedNEGs); err != nil {
+		return nil, err
+	}
+
+	portRange, err := loadBalancerPortRange(ports)
+	if err != nil {
+		return nil, err
+	}
+	expectedFwdRule := &compute.ForwardingRule{
+		Name:                loadBalancerName,
+		Description:         makeServiceDescription(serviceName.String()),
+		IPAddress:           ipAddressToUse,
+		IPProtocol:          string(protocol),
+		PortRange:           portRange,
+		BackendService:      g.getBackendServiceLink(loadBalancerName),
+		LoadBalancingScheme: string(cloud.SchemeExternal),
+		NetworkTier:         netTier.ToGCEValue(),
+	}
+	if existingFwdRule == nil || !negExternalLBForwardingRulesEqual(existingFwdRule, expectedFwdRule) {
+		if migrating {
+			g.eventRecorder.Eventf(svc, v1.EventTypeNormal, migratingLoadBalancerReason, "Switching the forwarding rule to backend service %s", loadBalancerName)
+		}
+		if existingFwdRule != nil {
+			isSafeToReleaseIP = false
+			if err := ignoreNotFound(g.DeleteRegionForwardingRule(loadBalancerName, g.region)); err != nil {
+				return nil, fmt.Errorf("failed to delete existing forwarding rule for load balancer (%s) update: %w", lbRefStr, err)
+			}
+		}
+		klog.Infof("ensureExternalNEGLoadBalancer(%s): Creating forwarding rule, IP %s (tier: %s).", lbRefStr, ipAddressToUse, netTier)
+		if err := g.CreateRegionForwardingRule(expectedFwdRule, g.region); err != nil {
+			return nil, fmt.Errorf("failed to create forwarding rule for load balancer (%s): %w", lbRefStr, err)
+		}
+		isSafeToReleaseIP = true
+	}
+	// The target pool is left over if a previous migration failed once the
+	// forwarding rule was switched.
+	tpExists := migrating
+	if !tpExists {
+		_, err := g.GetTargetPool(loadBalancerName, g.region)
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+		tpExists = err == nil
+	}
+	if tpExists {
+		if err := g.deleteMigratedTargetPool(svc, loadBalancerName, clusterID); err != nil {
+			return nil, err
+		}
+		g.eventRecorder.Eventf(svc, v1.EventTypeNormal, migratedLoadBalancerReason, "Migrated the load balancer to backend service %s", loadBalancerName)
+	}
+
+	status := &v1.LoadBalancerStatus{}
+	status.Ingress = []v1.LoadBalancerIngress{{IP: ipAddressToUse, IPMode: loadBalancerIPMode(string(cloud.SchemeExternal))}}
+	return status, nil
+}
+
+// deleteMigratedTargetPool deletes the target pool and legacy health checks
+// of a load balancer migrated to a backend service, once its forwarding rule
+// was switched. The firewall of the health check of a target pool with local
+// traffic health checks is the one of the backend service health check, so it
+// is kept.
+func (g *Cloud) deleteMigratedTargetPool(svc *v1.Service, loadBalancerName, clusterID string) error {
+	if err := g.DeleteExternalTargetPoolAndChecks(svc, loadBalancerName, g.region, clusterID, MakeNodesHealthCheckName(clusterID)); err != nil {
+		return err
+	}
+	if err := g.DeleteHTTPHealthCheck(loadBalancerName); err != nil && !isNotFoundOrInUse(err) {
+		return err
+	}
+	return nil
+}
+
+// updateExternalNEGLoadBalancer is the implementation of
+// LoadBalancer.UpdateLoadBalancer for external load balancers with NEG or
+// EXTERNAL_MANAGED backends. It syncs the network endpoint groups and the
+// backend service with the nodes.
+func (g *Cloud) updateExternalNEGLoadBalancer(clusterName string, svc *v1.Service, nodes []*v1.Node) error {
+	hosts, err := g.getInstancesByNames(nodeNames(nodes))
+	if err != nil {
+		return err
+	}
+	var port int64
+	if g.usesExternalManagedLB(svc) {
+		svcPort, err := externalManagedLBPort(svc)
+		if err != nil {
+			return err
+		}
+		port = int64(svcPort.NodePort)
+	}
+
+	loadBalancerName := g.GetLoadBalancerName(context.TODO(), clusterName, svc)
+	negLinks, err := g.ensureExternalNEGs(loadBalancerName, types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, hosts, port)
+	if err != nil {
+		return err
+	}
+	bs, err := g.GetRegionBackendService(loadBalancerName, g.region)
+	if err != nil {
+		return err
+	}
+	backends := negBackends(negLinks)
+	if port != 0 {
+		backends = externalManagedBackends(negLinks)
+	}
+	if backendsListEqual(bs.Backends, backends) {
+		return nil
+	}
+	removedNEGs := removedBackendGroups(bs.Backends, backends)
+	bs.Backends = backends
+	klog.V(2).Infof("updateExternalNEGLoadBalancer(%v): updating backend service with %d network endpoint groups", loadBalancerName, len(negLinks))
+	if err := g.UpdateRegionBackendService(bs, g.region); err != nil {
+		return err
+	}
+	return g.deleteExternalNEGs(removedNEGs)
+}
+
+// replaceExternalNEGLoadBalancer tears down the NEG backed load balancer of a
+// Service that no longer requests NEG backends, so that a target pool based
+// one is created in its place. The IP address of the forwarding rule is
+// reserved first and picked up by ensureExternalLoadBalancer.
+func (g *Cloud) replaceExternalNEGLoadBalancer(svc *v1.Service, fwdRule *compute.ForwardingRule, clusterID string) error {
+	serviceName := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
+	klog.Infof("replaceExternalNEGLoadBalancer(%v(%v)): Replacing the NEG backed load balancer.", fwdRule.Name, serviceName)
+	netTier := cloud.NetworkTierGCEValueToType(fwdRule.NetworkTier)
+	if _, _, err := ensureStaticIP(g, fwdRule.Name, serviceName.String(), g.region, fwdRule.IPAddress, netTier); err != nil {
+		return fmt.Errorf("failed to ensure a static IP for load balancer (%v): %w", fwdRule.Name, err)
+	}
+	return g.teardownExternalNEGLoadBalancer(svc, fwdRule.Name, clusterID)
+}
+
+// teardownExternalNEGLoadBalancer deletes the forwarding rule, backend service,
+// network endpoint groups and health check of a NEG backed external load
+// balancer. The IP address and the service traffic firewall are left to the
+// caller.
+func (g *Cloud) teardownExternalNEGLoadBalancer(svc *v1.Service, loadBalancerName, clusterID string) error {
+	if err := ignoreNotFound(g.DeleteRegionForwardingRule(loadBalancerName, g.region)); err != nil {
+		return err
+	}
+	if err := ignoreNotFound(g.DeleteRegionBackendService(loadBalancerName, g.region)); err != nil {
+		return err
+	}
+	// The nodes may have left the zones the groups were created in, so try
+	// all zones of the region.
+	zones, err := g.ListZonesInRegion(g.region)
+	if err != nil {
+		return err
+	}
+	for _, z := range zones {
+		if err := g.DeleteNetworkEndpointGroup(loadBalancerName, z.Name); err != nil && !isNotFoundOrInUse(err) {
+			return err
+		}
+	}
+	if err := ignoreNotFound(g.DeleteRegionHealthCheck(loadBalancerName, g.region)); err != nil {
+		return err
+	}
+	fwName := MakeHealthCheckFirewallName(clusterID, loadBalancerName, false)
+	if g.skipFirewallChange(svc, fwName, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID())) {
+		return nil
+	}
+	if err := ignoreNotFound(g.DeleteFirewall(fwName)); err != nil {
+		if isForbidden(err) && g.OnXPN() {
+			g.raiseFirewallChangeNeededEvent(svc, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID()))
+			return nil
+		}
+		return err
+	}
+	klog.V(2).Infof("teardownExternalNEGLoadBalancer(%v): deleted the NEG backed load balancer resources", loadBalancerName)
+	return nil
+}
+
+// ensureExternalNEGHealthCheck creates or updates the health check of a NEG
+// backed external load balancer. Its parameters are no smaller than the
+// defaults, or exactly params if not nil.
+func (g *Cloud) ensureExternalNEGHealthCheck(name string, svcName types.NamespacedName, path string, port int32, params *healthCheckParams, logging bool) (*compute.HealthCheck, error) {
+	expectedHC := newInternalLBHealthCheck(name, svcName, false, path, port)
+	expectedHC.LogConfig = &compute.HealthCheckLogConfig{Enable: logging}
+	if params != nil {
+		params.applyToHealthCheck(expectedHC)
+	}
+	hc, err := g.GetRegionHealthCheck(name, g.region)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	if hc == nil {
+		klog.V(2).Infof("ensureExternalNEGHealthCheck: creating health check %v with port %v path %v", name, port, path)
+		if err := g.CreateRegionHealthCheck(expectedHC, g.region); err != nil {
+			return nil, err
+		}
+		return g.GetRegionHealthCheck(name, g.region)
+	}
+	if needToUpdateHealthChecks(hc, expectedHC) || params != nil && !params.matchesHealthCheck(hc) {
+		klog.V(2).Infof("ensureExternalNEGHealthCheck: health check %v exists but parameters have drifted - updating...", name)
+		if params == nil {
+			mergeHealthChecks(hc, expectedHC)
+		}
+		if err := g.UpdateRegionHealthCheck(expectedHC, g.region); err != nil {
+			return nil, err
+		}
+		return g.GetRegionHealthCheck(name, g.region)
+	}
+	return hc, nil
+}
+
+// ensureExternalNEGs ensures a GCE_VM_IP network endpoint group with the hosts
+// of each zone, or a GCE_VM_IP_PORT one with the port of the hosts if port is
+// not zero, and returns their links.
+func (g *Cloud) ensureExternalNEGs(name string, svcName types.NamespacedName, hosts []*gceInstance, port int64) ([]string, error) {
+	zonedHosts := map[string][]string{}
+	for _, h := range hosts {
+		zonedHosts[h.Zone] = append(zonedHosts[h.Zone], h.Name)
+	}
+	zones := make([]string, 0, len(zonedHosts))
+	for zone := range zonedHosts {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	// The zones are synced in parallel, each filling its own slot.
+	negLinks := make([]string, len(zones))
+	err := forEachZone(zones, func(i int, zone string) error {
+		negLink, err := g.ensureExternalNEG(name, makeServiceDescription(svcName.String()), zone, zonedHosts[zone], port)
+		if err != nil {
+			return err
+		}
+		negLinks[i] = negLink
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(negLinks)
+	return negLinks, nil
+}
+
+func (g *Cloud) ensureExternalNEG(name, description, zone string, instances []string, port int64) (string, error) {
+	neg, err := g.GetNetworkEndpointGroup(name, zone)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+	negType := gceVMIPNEGType
+	if port != 0 {
+		negType = gceVMIPPortNEGType
+	}
+	if neg == nil {
+		klog.V(2).Infof("ensureExternalNEG(%v, %v): creating %v network endpoint group", name, zone, negType)
+		err := g.CreateNetworkEndpointGroup(&computebeta.NetworkEndpointGroup{
+			Name:                name,
+			Description:         description,
+			NetworkEndpointType: negType,
+			Network:             g.NetworkURL(),
+			Subnetwork:          g.SubnetworkURL(),
+		}, zone)
+		if err != nil && !isHTTPErrorCode(err, http.StatusConflict) {
+			return "", err
+		}
+		if neg, err = g.GetNetworkEndpointGroup(name, zone); err != nil {
+			return "", err
+		}
+	}
+
+	endpoints, err := g.ListNetworkEndpoints(name, zone, false)
+	if err != nil {
+		return "", err
+	}
+	expected := sets.NewString(instances...)
+	existing := sets.NewString()
+	var toDetach []*computebeta.NetworkEndpoint
+	for _, ep := range endpoints {
+		if ep.NetworkEndpoint == nil {
+			continue
+		}
+		if ep.NetworkEndpoint.Port == port && expected.Has(ep.NetworkEndpoint.Instance) {
+			existing.Insert(ep.NetworkEndpoint.Instance)
+			continue
+		}
+		toDetach = append(toDetach, &computebeta.NetworkEndpoint{Instance: ep.NetworkEndpoint.Instance, Port: ep.NetworkEndpoint.Port})
+	}
+	var toAttach []*computebeta.NetworkEndpoint
+	for _, instance := range expected.Difference(existing).List() {
+		toAttach = append(toAttach, &computebeta.NetworkEndpoint{Instance: instance, Port: port})
+	}
+	klog.V(2).Infof("ensureExternalNEG(%v, %v): attaching %d and detaching %d endpoints", name, zone, len(toAttach), len(toDetach))
+	for _, batch := range networkEndpointBatches(toAttach) {
+		if err := g.AttachNetworkEndpoints(name, zone, batch); err != nil {
+			return "", err
+		}
+	}
+	for _, batch := range networkEndpointBatches(toDetach) {
+		if err := g.DetachNetworkEndpoints(name, zone, batch); err != nil {
+			return "", err
+		}
+	}
+	return neg.SelfLink, nil
+}
+
+// ensureExternalNEGBackendService creates or updates the backend service of a
+// NEG backed external load balancer, or of an EXTERNAL_MANAGED one, and
+// returns the links of the network endpoint groups that were removed from it. The connection logging and
+// tracking configs and the timeout of an existing backend service are left
+// as is unless md manages them, and connections are drained for
+// negExternalLBConnectionDrainingTimeoutSec unless md sets another timeout.
+// The locality load balancing policy is always the one of md.
+func (g *Cloud) ensureExternalNEGBackendService(name, description string, md *backendServiceMetadata, affinityType v1.ServiceAffinity, scheme cloud.LbScheme, protocol v1.Protocol, backends []*compute.Backend, hcLink string) ([]string, error) {
+	bs, err := g.GetRegionBackendService(name, g.region)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	expectedBS := &compute.BackendService{
+		Name:                     name,
+		Protocol:                 string(protocol),
+		Description:              description,
+		HealthChecks:             []string{hcLink},
+		Backends:                 backends,
+		SessionAffinity:          md.gceSessionAffinity(affinityType),
+		LoadBalancingScheme:      string(scheme),
+		ConnectionDraining:       md.connectionDraining,
+		LogConfig:                md.logConfig,
+		ConnectionTrackingPolicy: md.connectionTracking,
+		TimeoutSec:               md.timeoutSec,
+		LocalityLbPolicy:         md.localityLBPolicy,
+	}
+	if expectedBS.ConnectionDraining == nil {
+		expectedBS.ConnectionDraining = &compute.ConnectionDraining{DrainingTimeoutSec: negExternalLBConnectionDrainingTimeoutSec}
+	}
+	if bs == nil {
+		klog.V(2).Infof("ensureExternalNEGBackendService: creating backend service %v", name)
+		if err := g.CreateRegionBackendService(expectedBS, g.region); err != nil {
+			return nil, err
+		}
+		return nil, g.ensureBackendServiceSecurityPolicy(name, "", md.securityPolicy)
+	}
+
+	if md.logConfig == nil {
+		expectedBS.LogConfig = bs.LogConfig
+	}
+	if md.connectionTracking == nil {
+		expectedBS.ConnectionTrackingPolicy = bs.ConnectionTrackingPolicy
+	}
+	if md.timeoutSec == 0 {
+		expectedBS.TimeoutSec = bs.TimeoutSec
+	}
+	// The security policy is only changed with its own call.
+	expectedBS.SecurityPolicy = bs.SecurityPolicy
+	if backendSvcEqual(expectedBS, bs) {
+		return nil, g.ensureBackendServiceSecurityPolicy(name, bs.SecurityPolicy, md.securityPolicy)
+	}
+	klog.V(2).Infof("ensureExternalNEGBackendService: updating backend service %v", name)
+	expectedBS.Fingerprint = bs.Fingerprint
+	if err := g.UpdateRegionBackendService(expectedBS, g.region); err != nil {
+		return nil, err
+	}
+	if err := g.ensureBackendServiceSecurityPolicy(name, bs.SecurityPolicy, md.securityPolicy); err != nil {
+		return nil, err
+	}
+	return removedBackendGroups(bs.Backends, backends), nil
+}
+
+// ensureBackendServiceSecurityPolicy attaches the named security policy of
+// the region to the backend service whose security policy link is current,
+// or detaches it if the name is empty. The security policy is left as is if
+// policy is nil.
+func (g *Cloud) ensureBackendServiceSecurityPolicy(name, current string, policy *string) error {
+	if policy == nil {
+		return nil
+	}
+	var link string
+	if *policy != "" {
+		link = cloud.SelfLink(meta.VersionGA, g.ProjectID(), "securityPolicies", meta.RegionalKey(*policy, g.region))
+	}
+	if current == link || current != "" && link != "" && getNameFromLink(current) == *policy {
+		return nil
+	}
+	klog.V(2).Infof("ensureBackendServiceSecurityPolicy: setting the security policy of backend service %v to %q", name, *policy)
+	if err := g.SetSecurityPolicyForRegionBackendService(name, g.region, link); err != nil {
+		return fmt.Errorf("failed to set the security policy of backend service %s to %q: %w", name, *policy, err)
+	}
+	return nil
+}
+
+// deleteExternalNEGs deletes the network endpoint groups that are no longer
+// backends of a NEG backed external load balancer.
+func (g *Cloud) deleteExternalNEGs(negLinks []string) error {
+	for _, link := range negLinks {
+		id, err := cloud.ParseResourceURL(link)
+		if err != nil {
+			return err
+		}
+		klog.V(2).Infof("deleteExternalNEGs: deleting network endpoint group %v in zone %v", id.Key.Name, id.Key.Zone)
+		if err := g.DeleteNetworkEndpointGroup(id.Key.Name, id.Key.Zone); err != nil && !isNotFoundOrInUse(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func negBackends(negLinks []string) (backends []*compute.Backend) {
+	for _, negLink := range negLinks {
+		backends = append(backends, &compute.Backend{
+			Group:         negLink,
+			BalancingMode: "CONNECTION",
+		})
+	}
+	return backends
+}
+
+// removedBackendGroups returns the groups of the backends that are not the
+// group of any of the new backends.
+func removedBackendGroups(backends, newBackends []*compute.Backend) []string {
+	keep := sets.NewString()
+	for _, b := range newBackends {
+		keep.Insert(b.Group)
+	}
+	var removed []string
+	for _, b := range backends {
+		if !keep.Has(b.Group) {
+			removed = append(removed, b.Group)
+		}
+	}
+	return removed
+}
+
+func networkEndpointBatches(endpoints []*computebeta.NetworkEndpoint) [][]*computebeta.NetworkEndpoint {
+	var batches [][]*computebeta.NetworkEndpoint
+	for len(endpoints) > 0 {
+		n := min(len(endpoints), maxNetworkEndpointsPerBatch)
+		batches = append(batches, endpoints[:n])
+		endpoints = endpoints[n:]
+	}
+	return batches
+}
+
+func negExternalLBForwardingRulesEqual(old, new *compute.ForwardingRule) bool {
+	return old.IPAddress == new.IPAddress &&
+		old.IPProtocol == new.IPProtocol &&
+		old.PortRange == new.PortRange &&
+		getNameFromLink(old.BackendService) == getNameFromLink(new.BackendService)
+}
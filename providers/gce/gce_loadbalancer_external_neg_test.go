@@ -0,0 +1,478 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	computebeta "google.golang.org/api/compute/v0.beta"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/featuregate"
+)
+
+// fakeNEGEndpoints makes the mock network endpoint groups keep track of their
+// endpoints, and returns the instances attached to each group, along with
+// their port for GCE_VM_IP_PORT groups, e.g. "node-1:30080".
+func fakeNEGEndpoints(gce *Cloud) map[meta.Key]sets.String {
+	endpoints := map[meta.Key]sets.String{}
+	mockNEGs := gce.c.(*cloud.MockGCE).MockBetaNetworkEndpointGroups
+	mockNEGs.AttachNetworkEndpointsHook = func(_ context.Context, key *meta.Key, req *computebeta.NetworkEndpointGroupsAttachEndpointsRequest, _ *cloud.MockBetaNetworkEndpointGroups, _ ...cloud.Option) error {
+		if endpoints[*key] == nil {
+			endpoints[*key] = sets.NewString()
+		}
+		for _, ep := range req.NetworkEndpoints {
+			endpoints[*key].Insert(fakeNEGEndpoint(ep))
+		}
+		return nil
+	}
+	mockNEGs.DetachNetworkEndpointsHook = func(_ context.Context, key *meta.Key, req *computebeta.NetworkEndpointGroupsDetachEndpointsRequest, _ *cloud.MockBetaNetworkEndpointGroups, _ ...cloud.Option) error {
+		for _, ep := range req.NetworkEndpoints {
+			endpoints[*key].Delete(fakeNEGEndpoint(ep))
+		}
+		return nil
+	}
+	mockNEGs.ListNetworkEndpointsHook = func(_ context.Context, key *meta.Key, _ *computebeta.NetworkEndpointGroupsListEndpointsRequest, _ *filter.F, _ *cloud.MockBetaNetworkEndpointGroups, _ ...cloud.Option) ([]*computebeta.NetworkEndpointWithHealthStatus, error) {
+		var list []*computebeta.NetworkEndpointWithHealthStatus
+		for _, endpoint := range endpoints[*key].List() {
+			instance, port, _ := strings.Cut(endpoint, ":")
+			ep := &computebeta.NetworkEndpoint{Instance: instance}
+			if port != "" {
+				ep.Port, _ = strconv.ParseInt(port, 10, 64)
+			}
+			list = append(list, &computebeta.NetworkEndpointWithHealthStatus{NetworkEndpoint: ep})
+		}
+		return list, nil
+	}
+	return endpoints
+}
+
+func fakeNEGEndpoint(ep *computebeta.NetworkEndpoint) string {
+	if ep.Port == 0 {
+		return ep.Instance
+	}
+	return fmt.Sprintf("%s:%d", ep.Instance, ep.Port)
+}
+
+func fakeNEGExternalLBCloud(t *testing.T, vals TestClusterValues) (*Cloud, map[meta.Key]sets.String) {
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gate := featuregate.NewFeatureGate()
+	require.NoError(t, AddFeatureGates(gate))
+	require.NoError(t, gate.Set("NEGBackedNetLB=true"))
+	SetFeatureGate(gate)
+	t.Cleanup(func() { SetFeatureGate(newFeatureGate()) })
+	return gce, fakeNEGEndpoints(gce)
+}
+
+func fakeNEGExternalLBService() *v1.Service {
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationExternalLBBackends] = ExternalLBBackendsNEG
+	return svc
+}
+
+func TestEnsureExternalNEGLoadBalancer(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, endpoints := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	nodeNames := []string{"test-node-1", "test-node-2"}
+
+	status, err := createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	require.Len(t, status.Ingress, 1)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, status.Ingress[0].IP, fwdRule.IPAddress)
+	assert.Empty(t, fwdRule.Target)
+	assert.Equal(t, lbName, getNameFromLink(fwdRule.BackendService))
+	assert.Equal(t, string(cloud.SchemeExternal), fwdRule.LoadBalancingScheme)
+	assert.Equal(t, "123-123", fwdRule.PortRange)
+
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, string(cloud.SchemeExternal), bs.LoadBalancingScheme)
+	assert.Equal(t, int64(negExternalLBConnectionDrainingTimeoutSec), bs.ConnectionDraining.DrainingTimeoutSec)
+	require.Len(t, bs.Backends, 1)
+	assert.Equal(t, "CONNECTION", bs.Backends[0].BalancingMode)
+
+	hc, err := gce.GetRegionHealthCheck(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hc.SelfLink}, bs.HealthChecks)
+	assert.Equal(t, int64(GetNodesHealthCheckPort()), hc.HttpHealthCheck.Port)
+
+	neg, err := gce.GetNetworkEndpointGroup(lbName, vals.ZoneName)
+	require.NoError(t, err)
+	assert.Equal(t, neg.SelfLink, bs.Backends[0].Group)
+	assert.Equal(t, gceVMIPNEGType, neg.NetworkEndpointType)
+	assert.ElementsMatch(t, nodeNames, endpoints[*meta.ZonalKey(lbName, vals.ZoneName)].List())
+
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "target pool should not exist, got %v", err)
+	_, err = gce.GetFirewall(MakeHealthCheckFirewallName(vals.ClusterID, lbName, false))
+	assert.NoError(t, err)
+}
+
+func TestEnsureExternalNEGLoadBalancerSessionAffinity(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	svc.Annotations[ServiceAnnotationBackendServiceSessionAffinity] = gceAffinityTypeClientIPProto
+	svc.Annotations[ServiceAnnotationBackendServiceSessionAffinityTimeout] = "300"
+
+	_, err := createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, gceAffinityTypeClientIPProto, bs.SessionAffinity)
+	require.NotNil(t, bs.ConnectionTrackingPolicy)
+	assert.Equal(t, int64(300), bs.ConnectionTrackingPolicy.IdleTimeoutSec)
+
+	svc.Annotations[ServiceAnnotationBackendServiceSessionAffinity] = "GENERATED_COOKIE"
+	_, err = createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	assert.Error(t, err)
+}
+
+func TestEnsureExternalNEGLoadBalancerConnectionDraining(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	svc.Annotations[ServiceAnnotationBackendServiceConnectionDrainingTimeout] = "600"
+	nodeNames := []string{"test-node-1"}
+
+	_, err := createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), bs.ConnectionDraining.DrainingTimeoutSec)
+
+	// Without the annotation, the default draining timeout is restored.
+	delete(svc.Annotations, ServiceAnnotationBackendServiceConnectionDrainingTimeout)
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, int64(negExternalLBConnectionDrainingTimeoutSec), bs.ConnectionDraining.DrainingTimeoutSec)
+}
+
+func TestEnsureExternalNEGLoadBalancerSecurityPolicy(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	var patches int
+	gce.c.(*cloud.MockGCE).MockRegionBackendServices.PatchHook = func(ctx context.Context, key *meta.Key, obj *compute.BackendService, m *cloud.MockRegionBackendServices, options ...cloud.Option) error {
+		patches++
+		bs, err := m.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		bs.SecurityPolicy = obj.SecurityPolicy
+		m.Objects[*key] = &cloud.MockRegionBackendServicesObj{Obj: bs}
+		return nil
+	}
+	svc := fakeNEGExternalLBService()
+	svc.Annotations[ServiceAnnotationBackendServiceSecurityPolicy] = "edge-policy"
+	nodeNames := []string{"test-node-1"}
+
+	_, err := createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	wantLink := cloud.SelfLink(meta.VersionGA, vals.ProjectID, "securityPolicies", meta.RegionalKey("edge-policy", gce.region))
+	assert.Equal(t, wantLink, bs.SecurityPolicy)
+	assert.Equal(t, 1, patches)
+
+	// The attached security policy is kept by the updates of the backend
+	// service, and not set again.
+	svc.Annotations[ServiceAnnotationBackendServiceConnectionDrainingTimeout] = "60"
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, wantLink, bs.SecurityPolicy)
+	assert.Equal(t, int64(60), bs.ConnectionDraining.DrainingTimeoutSec)
+	assert.Equal(t, 1, patches)
+
+	// Without the annotation, the security policy is left as is.
+	delete(svc.Annotations, ServiceAnnotationBackendServiceSecurityPolicy)
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, wantLink, bs.SecurityPolicy)
+
+	// An empty value detaches it.
+	svc.Annotations[ServiceAnnotationBackendServiceSecurityPolicy] = ""
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Empty(t, bs.SecurityPolicy)
+	assert.Equal(t, 2, patches)
+}
+
+func TestEnsureExternalNEGLoadBalancerWeighted(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	svc.Annotations[ServiceAnnotationWeightedLoadBalancing] = WeightedLoadBalancingPodsPerNode
+	nodeNames := []string{"test-node-1"}
+
+	// Weights are only reported by the health checks of local traffic.
+	_, err := createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	assert.Error(t, err)
+
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyLocal
+	svc.Spec.HealthCheckNodePort = 32000
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, localityLBPolicyWeightedMaglev, bs.LocalityLbPolicy)
+	hc, err := gce.GetRegionHealthCheck(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP", hc.Type)
+	assert.Equal(t, int64(32000), hc.HttpHealthCheck.Port)
+
+	// Without the annotation, the traffic is no longer weighted.
+	delete(svc.Annotations, ServiceAnnotationWeightedLoadBalancing)
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, localityLBPolicyMaglev, bs.LocalityLbPolicy)
+
+	svc.Annotations[ServiceAnnotationWeightedLoadBalancing] = "pods"
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	assert.Error(t, err)
+}
+
+func TestEnsureExternalLoadBalancerNEGAnnotationWithoutGate(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	svc := fakeNEGExternalLBService()
+	nodeNames := []string{"test-node-1"}
+
+	_, err = createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	assertExternalLbResources(t, gce, svc, vals, nodeNames)
+}
+
+func TestUpdateExternalNEGLoadBalancer(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, endpoints := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+
+	_, err := createExternalLoadBalancer(gce, svc, []string{"test-node-1", "test-node-2"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	// Move a node to another zone.
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+	gce.managedZones = append(gce.managedZones, vals.SecondaryZoneName)
+	secondaryNodes, err := createAndInsertNodes(gce, []string{"test-node-3"}, vals.SecondaryZoneName)
+	require.NoError(t, err)
+	require.NoError(t, gce.updateExternalLoadBalancer(vals.ClusterName, svc, append(nodes, secondaryNodes...)))
+
+	bs, err := gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Len(t, bs.Backends, 2)
+	assert.Equal(t, []string{"test-node-1"}, endpoints[*meta.ZonalKey(lbName, vals.ZoneName)].List())
+	assert.Equal(t, []string{"test-node-3"}, endpoints[*meta.ZonalKey(lbName, vals.SecondaryZoneName)].List())
+
+	// Remove all the nodes of the first zone.
+	require.NoError(t, gce.updateExternalLoadBalancer(vals.ClusterName, svc, secondaryNodes))
+
+	bs, err = gce.GetRegionBackendService(lbName, gce.region)
+	require.NoError(t, err)
+	require.Len(t, bs.Backends, 1)
+	neg, err := gce.GetNetworkEndpointGroup(lbName, vals.SecondaryZoneName)
+	require.NoError(t, err)
+	assert.Equal(t, neg.SelfLink, bs.Backends[0].Group)
+	_, err = gce.GetNetworkEndpointGroup(lbName, vals.ZoneName)
+	assert.True(t, isNotFound(err), "network endpoint group should be deleted, got %v", err)
+}
+
+func TestExternalLoadBalancerSwitchesNEGBackends(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeLoadbalancerService("")
+	nodeNames := []string{"test-node-1"}
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+
+	status, err := createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	ip := status.Ingress[0].IP
+	ensure := func() *v1.LoadBalancerStatus {
+		t.Helper()
+		nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+		require.NoError(t, err)
+		fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+		require.NoError(t, err)
+		status, err := gce.ensureExternalLoadBalancer(vals.ClusterName, vals.ClusterID, svc, fwdRule, nodes)
+		require.NoError(t, err)
+		return status
+	}
+
+	svc.Annotations[ServiceAnnotationExternalLBBackends] = ExternalLBBackendsNEG
+	status = ensure()
+	assert.Equal(t, ip, status.Ingress[0].IP)
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "target pool should be deleted, got %v", err)
+	_, err = gce.GetRegionBackendService(lbName, gce.region)
+	assert.NoError(t, err)
+
+	delete(svc.Annotations, ServiceAnnotationExternalLBBackends)
+	status = ensure()
+	assert.Equal(t, ip, status.Ingress[0].IP)
+	assertExternalLbResources(t, gce, svc, vals, nodeNames)
+	_, err = gce.GetRegionBackendService(lbName, gce.region)
+	assert.True(t, isNotFound(err), "backend service should be deleted, got %v", err)
+	_, err = gce.GetRegionHealthCheck(lbName, gce.region)
+	assert.True(t, isNotFound(err), "health check should be deleted, got %v", err)
+}
+
+func TestExternalLoadBalancerMigratesToBackendService(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+	svc := fakeLoadbalancerService("")
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 32000
+	nodeNames := []string{"test-node-1"}
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+
+	status, err := createExternalLoadBalancer(gce, svc, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	ip := status.Ingress[0].IP
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	// The target pool forwarding rule is only deleted once the backend
+	// service is ready.
+	mockFwdRules := gce.c.(*cloud.MockGCE).MockForwardingRules
+	mockFwdRules.DeleteHook = func(ctx context.Context, key *meta.Key, _ *cloud.MockForwardingRules, _ ...cloud.Option) (bool, error) {
+		bs, err := gce.GetRegionBackendService(key.Name, key.Region)
+		if err != nil || len(bs.Backends) == 0 {
+			return true, fmt.Errorf("forwarding rule deleted before the backend service was ready: %v", err)
+		}
+		return false, nil
+	}
+
+	svc.Annotations[ServiceAnnotationBackendServiceMigration] = "true"
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	status, err = gce.ensureExternalLoadBalancer(vals.ClusterName, vals.ClusterID, svc, fwdRule, nodes)
+	require.NoError(t, err)
+	assert.Equal(t, ip, status.Ingress[0].IP)
+
+	fwdRule, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, ip, fwdRule.IPAddress)
+	assert.Empty(t, fwdRule.Target)
+	assert.Equal(t, lbName, getNameFromLink(fwdRule.BackendService))
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "target pool should be deleted, got %v", err)
+	_, err = gce.GetHTTPHealthCheck(lbName)
+	assert.True(t, isNotFound(err), "legacy health check should be deleted, got %v", err)
+	// The health check firewall is shared with the backend service.
+	_, err = gce.GetFirewall(MakeHealthCheckFirewallName(vals.ClusterID, lbName, false))
+	assert.NoError(t, err)
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.Equal(t, []string{
+		"Normal " + migratingLoadBalancerReason + " Migrating the target pool based load balancer to a backend service, keeping IP " + ip,
+		"Normal " + migratingLoadBalancerReason + " Switching the forwarding rule to backend service " + lbName,
+		"Normal " + migratedLoadBalancerReason + " Migrated the load balancer to backend service " + lbName,
+	}, events)
+
+	// A target pool left over by a failed migration is deleted.
+	require.NoError(t, gce.CreateTargetPool(&compute.TargetPool{Name: lbName}, gce.region))
+	_, err = gce.ensureExternalLoadBalancer(vals.ClusterName, vals.ClusterID, svc, fwdRule, nodes)
+	require.NoError(t, err)
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "target pool should be deleted, got %v", err)
+}
+
+func TestEnsureExternalNEGLoadBalancerDeleted(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, _ := fakeNEGExternalLBCloud(t, vals)
+	svc := fakeNEGExternalLBService()
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+
+	_, err := createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	// The annotation may have been removed together with the LoadBalancer type.
+	delete(svc.Annotations, ServiceAnnotationExternalLBBackends)
+	require.NoError(t, gce.ensureExternalLoadBalancerDeleted(vals.ClusterName, vals.ClusterID, svc))
+
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.True(t, isNotFound(err), "forwarding rule should be deleted, got %v", err)
+	_, err = gce.GetRegionBackendService(lbName, gce.region)
+	assert.True(t, isNotFound(err), "backend service should be deleted, got %v", err)
+	_, err = gce.GetNetworkEndpointGroup(lbName, vals.ZoneName)
+	assert.True(t, isNotFound(err), "network endpoint group should be deleted, got %v", err)
+	_, err = gce.GetRegionHealthCheck(lbName, gce.region)
+	assert.True(t, isNotFound(err), "health check should be deleted, got %v", err)
+	_, err = gce.GetFirewall(MakeHealthCheckFirewallName(vals.ClusterID, lbName, false))
+	assert.True(t, isNotFound(err), "health check firewall should be deleted, got %v", err)
+	_, err = gce.GetRegionAddress(lbName, gce.region)
+	assert.True(t, isNotFound(err), "address should be deleted, got %v", err)
+}
+
+func TestNetworkEndpointBatches(t *testing.T) {
+	t.Parallel()
+
+	endpoints := make([]*computebeta.NetworkEndpoint, 2*maxNetworkEndpointsPerBatch+1)
+	batches := networkEndpointBatches(endpoints)
+	require.Len(t, batches, 3)
+	assert.Len(t, batches[0], maxNetworkEndpointsPerBatch)
+	assert.Len(t, batches[2], 1)
+	assert.Empty(t, networkEndpointBatches(nil))
+}
@@ -191,7 +191,7 @@ func TestCreateForwardingRuleWithTier(t *testing.T) {
 			netTier: cloud.NetworkTierPremium,
 			expectedRule: &compute.ForwardingRule{
 				Name:        "lb-1",
-				Description: `{"kubernetes.io/service-name":"foo-svc"}`,
+				Description: `{"kubernetes.io/service-name":"foo-svc","kubernetes.io/cluster-id":"test-cluster-id"}`,
 				IPAddress:   "1.1.1.1",
 				IPProtocol:  "TCP",
 				PortRange:   "123-123",
@@ -204,7 +204,7 @@ func TestCreateForwardingRuleWithTier(t *testing.T) {
 			netTier: cloud.NetworkTierStandard,
 			expectedRule: &compute.ForwardingRule{
 				Name:        "lb-2",
-				Description: `{"kubernetes.io/service-name":"foo-svc"}`,
+				Description: `{"kubernetes.io/service-name":"foo-svc","kubernetes.io/cluster-id":"test-cluster-id"}`,
 				IPAddress:   "2.2.2.2",
 				IPProtocol:  "TCP",
 				PortRange:   "123-123",
@@ -221,7 +221,7 @@ func TestCreateForwardingRuleWithTier(t *testing.T) {
 			lbName := tc.expectedRule.Name
 			ipAddr := tc.expectedRule.IPAddress
 
-			err = createForwardingRule(s, lbName, serviceName, s.region, ipAddr, target, ports, tc.netTier)
+			err = createForwardingRule(s, lbName, serviceName, vals.ClusterID, s.region, ipAddr, target, ports, tc.netTier)
 			assert.NoError(t, err)
 
 			Rule, err := s.GetRegionForwardingRule(lbName, s.region)
@@ -518,6 +518,7 @@ func TestLoadBalancerWrongTierResourceDeletion(t *testing.T) {
 		gce,
 		lbName,
 		serviceName.String(),
+		vals.ClusterID,
 		gce.region,
 		"",
 		gce.targetPoolURL(lbName),
@@ -548,6 +549,44 @@ func TestLoadBalancerWrongTierResourceDeletion(t *testing.T) {
 	assert.True(t, isNotFound(err))
 }
 
+func TestLoadBalancerWrongTierResourceDeletionFails(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	svc.Annotations = map[string]string{NetworkTierAnnotationKey: "Standard"}
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	serviceName := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
+
+	err = createForwardingRule(
+		gce,
+		lbName,
+		serviceName.String(),
+		vals.ClusterID,
+		gce.region,
+		"",
+		gce.targetPoolURL(lbName),
+		svc.Spec.Ports,
+		cloud.NetworkTierPremium,
+	)
+	require.NoError(t, err)
+	gce.c.(*cloud.MockGCE).MockForwardingRules.DeleteHook = mock.DeleteForwardingRuleErrHook
+
+	_, err = createExternalLoadBalancer(gce, svc, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	assert.Error(t, err, "the load balancer should not be synced while the forwarding rule has the wrong tier")
+
+	tier, err := gce.getNetworkTierFromForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, cloud.NetworkTierPremium.ToGCEValue(), tier)
+	_, err = gce.GetRegionAddress(lbName, gce.region)
+	assert.True(t, isNotFound(err), "no address should be reserved with the desired tier")
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "no target pool should be created")
+}
+
 func TestEnsureExternalLoadBalancerFailsIfInvalidNetworkTier(t *testing.T) {
 	t.Parallel()
 
@@ -1232,7 +1271,7 @@ func TestEnsureTargetPoolAndHealthCheck(t *testing.T) {
 	pool, err = gce.GetTargetPool(lbName, region)
 	require.NoError(t, err)
 	require.Equal(t, tag, pool.CreationTimestamp)
-	err = gce.ensureTargetPoolAndHealthCheck(true, true, svc, lbName, clusterID, ipAddr, hosts, hcToCreate, hcToDelete)
+	err = gce.ensureTargetPoolAndHealthCheck(true, true, svc, lbName, clusterID, ipAddr, hosts, hcToCreate, hcToDelete, nil)
 	assert.NoError(t, err)
 	pool, err = gce.GetTargetPool(lbName, region)
 	require.NoError(t, err)
@@ -1250,14 +1289,14 @@ func TestEnsureTargetPoolAndHealthCheck(t *testing.T) {
 	manyHostNames := nodeNames(manyNodes)
 	manyHosts, err := gce.getInstancesByNames(manyHostNames)
 	require.NoError(t, err)
-	err = gce.ensureTargetPoolAndHealthCheck(true, true, svc, lbName, clusterID, ipAddr, manyHosts, hcToCreate, hcToDelete)
+	err = gce.ensureTargetPoolAndHealthCheck(true, true, svc, lbName, clusterID, ipAddr, manyHosts, hcToCreate, hcToDelete, nil)
 	assert.NoError(t, err)
 
 	pool, err = gce.GetTargetPool(lbName, region)
 	require.NoError(t, err)
 	assert.Equal(t, maxTargetPoolCreateInstances+1, len(pool.Instances))
 
-	err = gce.ensureTargetPoolAndHealthCheck(true, false, svc, lbName, clusterID, ipAddr, hosts, hcToCreate, hcToDelete)
+	err = gce.ensureTargetPoolAndHealthCheck(true, false, svc, lbName, clusterID, ipAddr, hosts, hcToCreate, hcToDelete, nil)
 	assert.NoError(t, err)
 	pool, err = gce.GetTargetPool(lbName, region)
 	require.NoError(t, err)
@@ -1509,7 +1548,7 @@ func TestExternalLoadBalancerEnsureHttpHealthCheck(t *testing.T) {
 					t.Fatalf("gce.CreateHttpHealthCheck(%#v) = %v; want err = nil", existingHC, err)
 				}
 			}
-			if _, err := gce.ensureHTTPHealthCheck(hcName, hcPath, hcPort); err != nil {
+			if _, err := gce.ensureHTTPHealthCheck(hcName, hcPath, hcPort, nil); err != nil {
 				t.Fatalf("gce.ensureHttpHealthCheck(%q, %q, %v) = _, %d; want err = nil", hcName, hcPath, hcPort, err)
 			}
 			if hc, err := gce.GetHTTPHealthCheck(hcName); err != nil {
@@ -0,0 +1,251 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// loadBalancerGCInterval is the interval between two scans of the project
+// for orphaned load balancer resources.
+const loadBalancerGCInterval = 30 * time.Minute
+
+// loadBalancerNameRegexp matches the load balancer names derived from the
+// Service UID by cloudprovider.DefaultLoadBalancerName, after their prefix.
+var loadBalancerNameRegexp = regexp.MustCompile("^([a-z][-a-z0-9]*)?a[0-9a-f]{31}$")
+
+// addNetLBFinalizer attaches NetLBFinalizerV1 to the external LoadBalancer
+// Service if the LoadBalancerGarbageCollection alpha feature is enabled, so
+// that the Service is not deleted before its load balancer.
+func (g *Cloud) addNetLBFinalizer(svc *v1.Service) error {
+	if !g.AlphaFeatureGate.Enabled(AlphaFeatureLoadBalancerGC) {
+		return nil
+	}
+	if err := addFinalizer(svc, g.client.CoreV1(), NetLBFinalizerV1); err != nil {
+		klog.Errorf("Failed to attach finalizer '%s' on service %s/%s - %v", NetLBFinalizerV1, svc.Namespace, svc.Name, err)
+		return err
+	}
+	return nil
+}
+
+// runLoadBalancerGC collects the orphaned load balancer resources every
+// loadBalancerGCInterval while the LoadBalancerGarbageCollection alpha
+// feature is enabled, until stop is closed.
+func (g *Cloud) runLoadBalancerGC(stop <-chan struct{}) {
+	wait.Until(func() {
+		if !g.AlphaFeatureGate.Enabled(AlphaFeatureLoadBalancerGC) {
+			return
+		}
+		if err := g.collectOrphanedLoadBalancers(); err != nil {
+			klog.Errorf("Failed to collect orphaned load balancer resources: %v", err)
+		}
+	}, loadBalancerGCInterval, stop)
+}
+
+// collectOrphanedLoadBalancers deletes the resources of the load balancers of
+// the cluster whose Service no longer exists, e.g. after an etcd restore or a
+// forced deletion of the Service: the forwarding rules and target pools, the
+// backend services and health checks of the internal load balancers, and
+// their firewalls. The resources of the cluster are told apart from the ones
+// of the other clusters of the project by the cluster ID, recorded in the
+// description of the forwarding rules and target pools, and by the instance
+// group of the cluster for the backend services, so nothing is collected
+// without one. The resources are listed before the Services, so that the
+// ones of a Service created in between are not mistaken for orphans.
+func (g *Cloud) collectOrphanedLoadBalancers() error {
+	clusterID, err := g.ClusterID.GetID()
+	if err != nil {
+		return err
+	}
+	if clusterID == "" {
+		klog.V(4).Infof("collectOrphanedLoadBalancers: no cluster ID, skipping")
+		return nil
+	}
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	fwdRules, err := g.listRegionForwardingRules(ctx, g.region, filter.None, forwardingRuleOwnerFields)
+	if err != nil {
+		return err
+	}
+	targetPools, err := g.ListTargetPools(g.region)
+	if err != nil {
+		return err
+	}
+	backendServices, err := g.ListRegionBackendServices(g.region)
+	if err != nil {
+		return err
+	}
+	firewallNames := sets.NewString()
+	if !g.skipFirewallManagement {
+		firewalls, err := g.ListFirewalls()
+		if err != nil {
+			return err
+		}
+		for _, fw := range firewalls {
+			firewallNames.Insert(fw.Name)
+		}
+	}
+	services, err := g.client.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	liveNames := sets.NewString()
+	for i := range services.Items {
+		liveNames.Insert(g.GetLoadBalancerName(ctx, "", &services.Items[i]))
+	}
+
+	// orphanedNames are the names of the orphaned resources, which name their
+	// firewalls.
+	orphanedNames := sets.NewString()
+	var fwdRuleDeletions, backendDeletions, healthCheckDeletions []func(context.Context) error
+	for _, fr := range fwdRules {
+		if orphanedLoadBalancerResource(fr.Name, fr.Description, clusterID, liveNames) {
+			klog.Infof("collectOrphanedLoadBalancers: deleting orphaned forwarding rule %s, %s", fr.Name, fr.Description)
+			orphanedNames.Insert(fr.Name)
+			name := fr.Name
+			fwdRuleDeletions = append(fwdRuleDeletions, func(context.Context) error {
+				return ignoreNotFound(g.DeleteRegionForwardingRule(name, g.region))
+			})
+		}
+	}
+	for _, tp := range targetPools {
+		if orphanedLoadBalancerResource(tp.Name, tp.Description, clusterID, liveNames) {
+			klog.Infof("collectOrphanedLoadBalancers: deleting orphaned target pool %s, %s", tp.Name, tp.Description)
+			orphanedNames.Insert(tp.Name)
+			name := tp.Name
+			backendDeletions = append(backendDeletions, func(context.Context) error {
+				return ignoreNotFound(g.DeleteTargetPool(name, g.region))
+			})
+		}
+	}
+	// The health checks of the orphaned backend services are collected
+	// unless shared, or still used by another backend service.
+	orphanedHealthChecks, usedHealthChecks := sets.NewString(), sets.NewString()
+	igName := makeInstanceGroupName(clusterID)
+	for _, bs := range backendServices {
+		if !backendServiceOfInstanceGroup(bs, igName) || !orphanedLoadBalancerResource(bs.Name, bs.Description, "", liveNames) {
+			for _, hc := range bs.HealthChecks {
+				usedHealthChecks.Insert(lastComponent(hc))
+			}
+			continue
+		}
+		klog.Infof("collectOrphanedLoadBalancers: deleting orphaned backend service %s, %s", bs.Name, bs.Description)
+		orphanedNames.Insert(bs.Name)
+		for _, hc := range bs.HealthChecks {
+			orphanedHealthChecks.Insert(lastComponent(hc))
+		}
+		name := bs.Name
+		backendDeletions = append(backendDeletions, func(context.Context) error {
+			return ignoreNotFound(g.DeleteRegionBackendService(name, g.region))
+		})
+	}
+	var orphanedFirewalls []string
+	for _, hcName := range orphanedHealthChecks.Difference(usedHealthChecks).List() {
+		if strings.HasPrefix(hcName, MakeNodesHealthCheckName(clusterID)) {
+			continue
+		}
+		klog.Infof("collectOrphanedLoadBalancers: deleting orphaned health check %s", hcName)
+		orphanedFirewalls = append(orphanedFirewalls, makeHealthCheckFirewallNameFromHC(hcName))
+		name := hcName
+		healthCheckDeletions = append(healthCheckDeletions, func(context.Context) error {
+			if err := g.DeleteHealthCheck(name); err != nil && !isNotFound(err) && !isInUsedByError(err) {
+				return err
+			}
+			return nil
+		})
+	}
+	for _, name := range orphanedNames.List() {
+		orphanedFirewalls = append(orphanedFirewalls, MakeFirewallName(name))
+	}
+	var firewallDeletions []func(context.Context) error
+	for _, fwName := range orphanedFirewalls {
+		for _, name := range []string{fwName, fwName + ipv6Suffix} {
+			if !firewallNames.Has(name) {
+				continue
+			}
+			klog.Infof("collectOrphanedLoadBalancers: deleting orphaned firewall %s", name)
+			firewallNames.Delete(name)
+			name := name
+			firewallDeletions = append(firewallDeletions, func(context.Context) error {
+				return ignoreNotFound(g.DeleteFirewall(name))
+			})
+		}
+	}
+
+	// The deletions of each kind of resource are waited for together, in the
+	// order of the references between them. The firewalls go first and the
+	// collection stops at the first failure, so that the resources proving
+	// that the remaining ones are orphaned are kept for the next scan.
+	for _, deletions := range [][]func(context.Context) error{firewallDeletions, fwdRuleDeletions, backendDeletions, healthCheckDeletions} {
+		if err := g.runMutations(ctx, deletions...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orphanedLoadBalancerResource returns whether the resource, named after a
+// load balancer, or a companion of one, belongs to a Service whose load
+// balancer name is not in liveNames. Unless clusterID is empty, the resource
+// must also record in its description that it belongs to that cluster.
+func orphanedLoadBalancerResource(name, description, clusterID string, liveNames sets.String) bool {
+	var desc forwardingRuleDescription
+	if err := json.Unmarshal([]byte(description), &desc); err != nil || desc.ServiceName == "" {
+		return false
+	}
+	if clusterID != "" && desc.ClusterID != clusterID {
+		return false
+	}
+	name = strings.TrimSuffix(name, ipv6Suffix)
+	for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP} {
+		name = strings.TrimSuffix(name, mixedProtocolName("", protocol))
+	}
+	if !loadBalancerNameRegexp.MatchString(name) {
+		return false
+	}
+	return !liveNames.Has(name)
+}
+
+// backendServiceOfInstanceGroup returns whether the backends of the backend
+// service are the instance groups named igName.
+func backendServiceOfInstanceGroup(bs *compute.BackendService, igName string) bool {
+	if len(bs.Backends) == 0 {
+		return false
+	}
+	for _, be := range bs.Backends {
+		if lastComponent(be.Group) != igName {
+			return false
+		}
+	}
+	return true
+}
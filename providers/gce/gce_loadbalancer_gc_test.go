@@ -0,0 +1,154 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestExternalLoadBalancerFinalizer(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureLoadBalancerGC})
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, hasFinalizer(svc, NetLBFinalizerV1))
+
+	// The load balancer is reported as existing while the finalizer is
+	// there, even without its forwarding rule.
+	lbName := gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc)
+	require.NoError(t, gce.DeleteRegionForwardingRule(lbName, gce.region))
+	_, exists, err := gce.GetLoadBalancer(context.TODO(), vals.ClusterName, svc)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svc))
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.False(t, hasFinalizer(svc, NetLBFinalizerV1))
+}
+
+func TestCollectOrphanedLoadBalancers(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	nodeNames := []string{"test-node-1"}
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+
+	// newService returns the Service and the name of its load balancer, with
+	// a health check of its own if local.
+	newService := func(name string, uid types.UID, lbType string, local bool) (*v1.Service, string) {
+		svc := fakeLoadbalancerService(lbType)
+		svc.Name, svc.UID = name, uid
+		if local {
+			svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyLocal
+			svc.Spec.HealthCheckNodePort = 32000
+		}
+		svc, err := gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+		require.NoError(t, err)
+		return svc, gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc)
+	}
+	// The load balancers of another cluster sharing the project, with the
+	// same names as the ones of the cluster would have.
+	gce.ClusterID = fakeClusterID("other-cluster-id")
+	otherCluster, otherClusterLBName := newService("other-cluster", "1b6a7c6e-8d1d-4d8e-9b1c-0123456789ab", "", false)
+	otherClusterInternal, otherClusterInternalLBName := newService("other-cluster-internal", "5b6a7c6e-8d1d-4d8e-9b1c-0123456789ab", string(LBTypeInternal), true)
+	gce.ClusterID = fakeClusterID(vals.ClusterID)
+	gce.lbNamePrefix = "c1-"
+	live, liveLBName := newService("live", "2b6a7c6e-8d1d-4d8e-9b1c-0123456789ab", "", false)
+	_, orphanLBName := newService("orphan", "3b6a7c6e-8d1d-4d8e-9b1c-0123456789ab", "", false)
+	_, internalOrphanLBName := newService("internal-orphan", "4b6a7c6e-8d1d-4d8e-9b1c-0123456789ab", string(LBTypeInternal), true)
+	for _, svc := range []*v1.Service{otherCluster, otherClusterInternal} {
+		require.NoError(t, gce.client.CoreV1().Services(svc.Namespace).Delete(context.TODO(), svc.Name, metav1.DeleteOptions{}))
+	}
+	for _, name := range []string{"orphan", "internal-orphan"} {
+		require.NoError(t, gce.client.CoreV1().Services(live.Namespace).Delete(context.TODO(), name, metav1.DeleteOptions{}))
+	}
+
+	require.NoError(t, gce.collectOrphanedLoadBalancers())
+
+	for _, lbName := range []string{otherClusterLBName, liveLBName} {
+		_, err := gce.GetRegionForwardingRule(lbName, gce.region)
+		assert.NoError(t, err, "forwarding rule %s should be kept", lbName)
+		_, err = gce.GetTargetPool(lbName, gce.region)
+		assert.NoError(t, err, "target pool %s should be kept", lbName)
+		_, err = gce.GetFirewall(MakeFirewallName(lbName))
+		assert.NoError(t, err, "firewall of %s should be kept", lbName)
+	}
+	lbName := otherClusterInternalLBName
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.NoError(t, err, "internal forwarding rule of the other cluster should be kept")
+	_, err = gce.GetRegionBackendService(lbName, gce.region)
+	assert.NoError(t, err, "backend service of the other cluster should be kept")
+	_, err = gce.GetHealthCheck(lbName)
+	assert.NoError(t, err, "health check of the other cluster should be kept")
+	_, err = gce.GetFirewall(MakeFirewallName(lbName))
+	assert.NoError(t, err, "internal firewall of the other cluster should be kept")
+
+	lbName = orphanLBName
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.True(t, isNotFound(err), "orphaned forwarding rule should be deleted, err: %v", err)
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "orphaned target pool should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName))
+	assert.True(t, isNotFound(err), "orphaned firewall should be deleted, err: %v", err)
+	lbName = internalOrphanLBName
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.True(t, isNotFound(err), "orphaned internal forwarding rule should be deleted, err: %v", err)
+	_, err = gce.GetRegionBackendService(lbName, gce.region)
+	assert.True(t, isNotFound(err), "orphaned backend service should be deleted, err: %v", err)
+	_, err = gce.GetHealthCheck(lbName)
+	assert.True(t, isNotFound(err), "orphaned health check should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName))
+	assert.True(t, isNotFound(err), "orphaned internal firewall should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(makeHealthCheckFirewallNameFromHC(lbName))
+	assert.True(t, isNotFound(err), "orphaned health check firewall should be deleted, err: %v", err)
+
+	// Nothing is collected without a cluster ID to tell the load balancers
+	// of the cluster apart.
+	gce.ClusterID = fakeClusterID("")
+	require.NoError(t, gce.client.CoreV1().Services(live.Namespace).Delete(context.TODO(), live.Name, metav1.DeleteOptions{}))
+	require.NoError(t, gce.collectOrphanedLoadBalancers())
+	_, err = gce.GetRegionForwardingRule(liveLBName, gce.region)
+	assert.NoError(t, err)
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"github.com/google/go-cmp/cmp"
+	computealpha "google.golang.org/api/compute/v0.alpha"
 	compute "google.golang.org/api/compute/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -52,6 +53,12 @@ const (
 	maxL4ILBPorts = 5
 	// labelGKESubnetworkName is the key of the label that contains the subnet name the node is connected to.
 	labelGKESubnetworkName = "cloud.google.com/gke-node-pool-subnet"
+	// zonalAffinitySpillCrossZone routes the connections of a backend service
+	// with zonal affinity to the zone of the client, spilling over to other
+	// zones when it has no healthy backends.
+	zonalAffinitySpillCrossZone = "ZONAL_AFFINITY_SPILL_CROSS_ZONE"
+	// zonalAffinityDisabled disables the zonal affinity of a backend service.
+	zonalAffinityDisabled = "ZONAL_AFFINITY_DISABLED"
 )
 
 func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v1.Service, existingFwdRule *compute.ForwardingRule, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
@@ -88,7 +95,8 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 		return nil, err
 	}
 
-	ports, _, protocol := getPortsAndProtocol(svc.Spec.Ports)
+	svcPorts, companionPorts := g.loadBalancerPorts(svc)
+	ports, portRanges, protocol := getPortsAndProtocol(svcPorts)
 	if protocol != v1.ProtocolTCP && protocol != v1.ProtocolUDP {
 		return nil, fmt.Errorf("Invalid protocol %s, only TCP and UDP are supported", string(protocol))
 	}
@@ -99,7 +107,27 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 		options = ILBOptions{}
 	}
 
+	wantsIPv6, err := wantsIPv6LoadBalancer(svc)
+	if err != nil {
+		g.eventRecorder.Event(svc, v1.EventTypeWarning, "IPv6LoadBalancerNotSupported", err.Error())
+		return nil, err
+	}
 	sharedBackend := shareBackendService(svc)
+	bsMetadata, err := getBackendServiceMetadata(svc, sharedBackend)
+	if err != nil {
+		return nil, err
+	}
+	if bsMetadata.securityPolicy != nil {
+		return nil, fmt.Errorf("annotation %q is only supported by external load balancers", ServiceAnnotationBackendServiceSecurityPolicy)
+	}
+	hcParams, err := getHealthCheckParams(svc)
+	if err != nil {
+		return nil, err
+	}
+	pscOptions, err := getPSCServiceAttachmentOptions(svc)
+	if err != nil {
+		return nil, err
+	}
 	backendServiceName := makeBackendServiceName(loadBalancerName, clusterID, sharedBackend, scheme, protocol, svc.Spec.SessionAffinity)
 	backendServiceLink := g.getBackendServiceLink(backendServiceName)
 
@@ -124,15 +152,24 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 	defer g.sharedResourceLock.Unlock()
 
 	// Ensure health check exists before creating the backend service. The health check is shared
-	// if externalTrafficPolicy=Cluster.
-	sharedHealthCheck := !servicehelpers.RequestsOnlyLocalTraffic(svc)
-	hcName := makeHealthCheckName(loadBalancerName, clusterID, sharedHealthCheck)
+	// if externalTrafficPolicy=Cluster, unless the Service sets its own health check parameters
+	// and does not share resources.
+	hcName, sharedHealthCheck := internalHealthCheckName(svc, loadBalancerName, clusterID, hcParams, g.AlphaFeatureGate.Enabled(AlphaFeatureILBSharedResources))
 	hcPath, hcPort := GetNodesHealthCheckPath(), GetNodesHealthCheckPort()
-	if !sharedHealthCheck {
+	if servicehelpers.RequestsOnlyLocalTraffic(svc) {
 		// Service requires a special health check, retrieve the OnlyLocal port & path
 		hcPath, hcPort = servicehelpers.GetServiceHealthCheckPathPort(svc)
+		if hcParams != nil {
+			hcPath = hcParams.requestPath
+		}
+	} else if hcParams != nil {
+		hcPath = hcParams.requestPath
+	}
+	hcLogging, err := g.serviceHealthCheckLogging(svc, sharedHealthCheck)
+	if err != nil {
+		return nil, err
 	}
-	hc, err := g.ensureInternalHealthCheck(hcName, nm, sharedHealthCheck, hcPath, hcPort)
+	hc, err := g.ensureInternalHealthCheck(hcName, nm, sharedHealthCheck, hcPath, hcPort, hcParams, hcLogging)
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +184,18 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 	}
 	// Determine IP which will be used for this LB. If no forwarding rule has been established
 	// or specified in the Service spec, then requestedIP = "".
-	ipToUse := ilbIPToUse(svc, existingFwdRule, subnetworkURL)
+	requestedIP, err := g.requestedLoadBalancerIP(svc, cloud.SchemeInternal, subnetworkURL, cloud.NetworkTierDefault)
+	if err != nil {
+		return nil, err
+	}
+	// Validate the requested IP before it is reserved or used, unless the
+	// forwarding rule already has it.
+	if requestedIP != "" && (existingFwdRule == nil || existingFwdRule.IPAddress != requestedIP) {
+		if err := g.validateInternalLoadBalancerIP(svc, loadBalancerName, requestedIP, subnetworkURL); err != nil {
+			return nil, err
+		}
+	}
+	ipToUse := ilbIPToUse(requestedIP, existingFwdRule, subnetworkURL)
 
 	klog.V(2).Infof("ensureInternalLoadBalancer(%v): Using subnet %s for LoadBalancer IP %s", loadBalancerName, options.SubnetName, ipToUse)
 
@@ -155,12 +203,20 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 	// If the network is not a legacy network, use the address manager
 	if !g.IsLegacyNetwork() {
 		addrMgr = newAddressManager(g, nm.String(), g.Region(), subnetworkURL, loadBalancerName, ipToUse, cloud.SchemeInternal)
+		if len(companionPorts) > 0 {
+			// The forwarding rules of a mixed protocol load balancer share
+			// the address, which must stay reserved.
+			addrMgr.purpose = sharedLoadBalancerVIPPurpose
+		}
 		ipToUse, err = addrMgr.HoldAddress()
 		if err != nil {
 			return nil, err
 		}
 		klog.V(2).Infof("ensureInternalLoadBalancer(%v): reserved IP %q for the forwarding rule", loadBalancerName, ipToUse)
 		defer func() {
+			if addrMgr.purpose == sharedLoadBalancerVIPPurpose {
+				return
+			}
 			// Release the address if all resources were created successfully, or if we error out.
 			if err := addrMgr.ReleaseAddress(); err != nil {
 				klog.Errorf("ensureInternalLoadBalancer: failed to release address reservation, possibly causing an orphan: %v", err)
@@ -168,7 +224,7 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 		}()
 	}
 
-	fwdRuleDescription := &forwardingRuleDescription{ServiceName: nm.String()}
+	fwdRuleDescription := &forwardingRuleDescription{ServiceName: nm.String(), ClusterID: clusterID}
 	fwdRuleDescriptionString, err := fwdRuleDescription.marshal()
 	if err != nil {
 		return nil, err
@@ -189,10 +245,7 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 	if options.AllowGlobalAccess {
 		newFwdRule.AllowGlobalAccess = options.AllowGlobalAccess
 	}
-	if len(ports) > maxL4ILBPorts {
-		newFwdRule.Ports = nil
-		newFwdRule.AllPorts = true
-	}
+	newFwdRule.Ports, newFwdRule.PortRange, newFwdRule.AllPorts = internalForwardingRulePorts(ports, portRanges, options.AllPorts)
 
 	fwdRuleDeleted := false
 	if existingFwdRule != nil && !forwardingRulesEqual(existingFwdRule, newFwdRule) {
@@ -203,17 +256,52 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 			frDiff := cmp.Diff(existingFwdRule, newFwdRule)
 			klogV.Infof("ensureInternalLoadBalancer(%v): forwarding rule changed - Existing - %+v\n, New - %+v\n, Diff(-existing, +new) - %s\n. Deleting existing forwarding rule.", loadBalancerName, existingFwdRule, newFwdRule, frDiff)
 		}
+		if err = g.checkRecreateBudget(loadBalancerName); err != nil {
+			return nil, err
+		}
+		// The forwarding rule of a published service attachment cannot be
+		// deleted, and recreating the attachment would disconnect its
+		// consumers and change its URI.
+		if pscOptions != nil {
+			if err = g.checkServiceAttachmentBlocksRecreate(svc, loadBalancerName); err != nil {
+				return nil, err
+			}
+		} else if serviceAttachmentURI(svc) != "" {
+			// The Service is no longer published, the attachment is
+			// deleted anyway.
+			if err = ignoreNotFound(g.DeleteServiceAttachment(loadBalancerName, g.region)); err != nil {
+				return nil, err
+			}
+		}
 		if err = ignoreNotFound(g.DeleteRegionForwardingRule(loadBalancerName, g.region)); err != nil {
 			return nil, err
 		}
+		if featureEnabled(DualStackLoadBalancers) {
+			// The IPv6 forwarding rule also uses the backend service, and is recreated below.
+			if err = ignoreNotFound(g.DeleteRegionForwardingRule(loadBalancerName+ipv6Suffix, g.region)); err != nil {
+				return nil, err
+			}
+		}
 		fwdRuleDeleted = true
 	}
 
-	bsDescription := makeBackendServiceDescription(nm, sharedBackend)
-	err = g.ensureInternalBackendService(backendServiceName, bsDescription, svc.Spec.SessionAffinity, scheme, protocol, igLinks, hc.SelfLink)
+	bsDescription, err := makeBackendServiceDescriptionWithMetadata(nm, sharedBackend, bsMetadata)
 	if err != nil {
 		return nil, err
 	}
+	err = g.ensureInternalBackendService(backendServiceName, bsDescription, bsMetadata, svc.Spec.SessionAffinity, scheme, protocol, igLinks, hc.SelfLink)
+	if err != nil {
+		return nil, err
+	}
+	if g.AlphaFeatureGate.Enabled(AlphaFeatureTrafficDistribution) {
+		if !sharedBackend {
+			if err := g.ensureInternalBackendServiceZonalAffinity(backendServiceName, prefersCloseTraffic(svc)); err != nil {
+				return nil, err
+			}
+		} else if prefersCloseTraffic(svc) {
+			g.eventRecorder.Event(svc, v1.EventTypeWarning, "TrafficDistributionIgnored", "Traffic distribution PreferClose is not supported with shared backend services.")
+		}
+	}
 
 	if fwdRuleDeleted || existingFwdRule == nil {
 		// existing rule has been deleted, pass in nil
@@ -234,9 +322,59 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 		return nil, err
 	}
 
+	if len(companionPorts) > 0 {
+		if err = g.ensureInternalMixedProtocolLoadBalancer(svc, newFwdRule, ipToUse, companionPorts, clusterID, bsDescription, bsMetadata, igLinks, hc.SelfLink, nodes); err != nil {
+			return nil, err
+		}
+		if err = g.ensureInternalMixedProtocolLoadBalancerDeleted(svc, loadBalancerName, clusterID, companionPorts[0].Protocol); err != nil {
+			return nil, err
+		}
+	} else if g.AlphaFeatureGate.Enabled(AlphaFeatureMixedProtocolLB) {
+		if err = g.ensureInternalMixedProtocolLoadBalancerDeleted(svc, loadBalancerName, clusterID, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	ipv6ToUse := ""
+	if wantsIPv6 {
+		if ipv6ToUse, err = g.ensureInternalIPv6LoadBalancer(svc, newFwdRule, hcName, strconv.Itoa(int(hcPort)), nodes); err != nil {
+			if requiresDualStack(svc) {
+				g.eventRecorder.Eventf(svc, v1.EventTypeWarning, "IPv6LoadBalancerFailed", "Failed to provision the IPv6 load balancer required by ipFamilyPolicy %s: %v", v1.IPFamilyPolicyRequireDualStack, err)
+				return nil, err
+			}
+			// PreferDualStack Services fall back to an IPv4 load balancer.
+			klog.Warningf("ensureInternalLoadBalancer(%v): failed to provision the IPv6 load balancer, serving IPv4 only: %v", loadBalancerName, err)
+			g.eventRecorder.Eventf(svc, v1.EventTypeWarning, "IPv6LoadBalancerFallback", "Failed to provision the IPv6 load balancer, the load balancer only serves IPv4: %v", err)
+			if err = g.ensureInternalIPv6LoadBalancerDeleted(svc, loadBalancerName, hcName, sharedHealthCheck); err != nil {
+				return nil, err
+			}
+		}
+	} else if featureEnabled(DualStackLoadBalancers) {
+		if err = g.ensureInternalIPv6LoadBalancerDeleted(svc, loadBalancerName, hcName, sharedHealthCheck); err != nil {
+			return nil, err
+		}
+	}
+
+	if pscOptions != nil {
+		if err = g.ensureInternalServiceAttachment(svc, updatedFwdRule, fwdRuleDescriptionString, pscOptions); err != nil {
+			return nil, err
+		}
+	} else if err = g.ensureInternalServiceAttachmentDeleted(svc, loadBalancerName); err != nil {
+		return nil, err
+	}
+
 	// Delete the previous internal load balancer resources if necessary
 	if existingBackendService != nil {
 		g.clearPreviousInternalResources(svc, loadBalancerName, existingBackendService, backendServiceName, hcName)
+		if !g.AlphaFeatureGate.Enabled(AlphaFeatureILBSharedResources) && len(existingBackendService.HealthChecks) == 1 {
+			// The shared health check was replaced after ILBSharedResources
+			// was disabled.
+			if existingHCName := getNameFromLink(existingBackendService.HealthChecks[0]); existingHCName != hcName && isParamsHealthCheckName(existingHCName, clusterID) {
+				if err := g.releaseSharedInternalHealthCheckFirewall(svc, clusterID); err != nil {
+					klog.Warningf("ensureInternalLoadBalancer(%v): could not release the shared health check firewall: %v", loadBalancerName, err)
+				}
+			}
+		}
 	}
 
 	serviceState.InSuccess = true
@@ -252,7 +390,7 @@ func (g *Cloud) ensureInternalLoadBalancer(clusterName, clusterID string, svc *v
 	klog.V(6).Infof("Internal Loadbalancer for Service %s ensured, updating its state %v in metrics cache", nm, serviceState)
 
 	status := &v1.LoadBalancerStatus{}
-	status.Ingress = []v1.LoadBalancerIngress{{IP: updatedFwdRule.IPAddress}}
+	status.Ingress = loadBalancerIngress(svc, updatedFwdRule.LoadBalancingScheme, updatedFwdRule.IPAddress, ipv6ToUse)
 	return status, nil
 }
 
@@ -349,7 +487,15 @@ func (g *Cloud) updateInternalLoadBalancer(clusterName, clusterID string, svc *v
 	loadBalancerName := g.GetLoadBalancerName(context.TODO(), clusterName, svc)
 	backendServiceName := makeBackendServiceName(loadBalancerName, clusterID, shareBackendService(svc), scheme, protocol, svc.Spec.SessionAffinity)
 	// Ensure the backend service has the proper backend/instance-group links
-	return g.ensureInternalBackendServiceGroups(backendServiceName, igLinks)
+	if err := g.ensureInternalBackendServiceGroups(backendServiceName, igLinks); err != nil {
+		return err
+	}
+	if _, companionPorts := g.loadBalancerPorts(svc); len(companionPorts) > 0 {
+		companionProtocol := companionPorts[0].Protocol
+		companionBSName := makeBackendServiceName(mixedProtocolName(loadBalancerName, companionProtocol), clusterID, shareBackendService(svc), scheme, companionProtocol, svc.Spec.SessionAffinity)
+		return g.ensureInternalBackendServiceGroups(companionBSName, igLinks)
+	}
+	return nil
 }
 
 func (g *Cloud) ensureInternalLoadBalancerDeleted(clusterName, clusterID string, svc *v1.Service) error {
@@ -358,7 +504,10 @@ func (g *Cloud) ensureInternalLoadBalancerDeleted(clusterName, clusterID string,
 	_, _, protocol := getPortsAndProtocol(svc.Spec.Ports)
 	scheme := cloud.SchemeInternal
 	sharedBackend := shareBackendService(svc)
-	sharedHealthCheck := !servicehelpers.RequestsOnlyLocalTraffic(svc)
+	sharedResources := g.AlphaFeatureGate.Enabled(AlphaFeatureILBSharedResources)
+	// Invalid health check parameters are not shared with other Services.
+	hcParams, _ := getHealthCheckParams(svc)
+	hcName, sharedHealthCheck := internalHealthCheckName(svc, loadBalancerName, clusterID, hcParams, sharedResources)
 
 	g.sharedResourceLock.Lock()
 	defer g.sharedResourceLock.Unlock()
@@ -366,10 +515,25 @@ func (g *Cloud) ensureInternalLoadBalancerDeleted(clusterName, clusterID string,
 	klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): attempting delete of region internal address", loadBalancerName)
 	ensureAddressDeleted(g, loadBalancerName, g.region)
 
+	klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): deleting service attachment", loadBalancerName)
+	if err := g.ensureInternalServiceAttachmentDeleted(svc, loadBalancerName); err != nil {
+		return err
+	}
+
 	klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): deleting region internal forwarding rule", loadBalancerName)
 	if err := ignoreNotFound(g.DeleteRegionForwardingRule(loadBalancerName, g.region)); err != nil {
 		return err
 	}
+	if featureEnabled(DualStackLoadBalancers) {
+		if err := g.ensureInternalIPv6LoadBalancerDeleted(svc, loadBalancerName, hcName, sharedHealthCheck); err != nil {
+			return err
+		}
+	}
+	if g.AlphaFeatureGate.Enabled(AlphaFeatureMixedProtocolLB) {
+		if err := g.ensureInternalMixedProtocolLoadBalancerDeleted(svc, loadBalancerName, clusterID, ""); err != nil {
+			return err
+		}
+	}
 
 	backendServiceName := makeBackendServiceName(loadBalancerName, clusterID, sharedBackend, scheme, protocol, svc.Spec.SessionAffinity)
 	klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): deleting region backend service %v", loadBalancerName, backendServiceName)
@@ -377,32 +541,42 @@ func (g *Cloud) ensureInternalLoadBalancerDeleted(clusterName, clusterID string,
 		return err
 	}
 
-	deleteFunc := func(fwName string) error {
-		if err := ignoreNotFound(g.DeleteFirewall(fwName)); err != nil {
-			if isForbidden(err) && g.OnXPN() {
-				klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): could not delete traffic firewall on XPN cluster. Raising event.", loadBalancerName)
-				g.raiseFirewallChangeNeededEvent(svc, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID()))
-				return nil
-			}
-			return err
-		}
-		return nil
-	}
 	fwName := MakeFirewallName(loadBalancerName)
 	klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): deleting firewall %s for traffic",
 		loadBalancerName, fwName)
-	if err := deleteFunc(fwName); err != nil {
+	if err := g.deleteInternalFirewall(svc, fwName); err != nil {
 		return err
 	}
 	klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): deleting legacy name firewall for traffic", loadBalancerName)
-	if err := deleteFunc(loadBalancerName); err != nil {
+	if err := g.deleteInternalFirewall(svc, loadBalancerName); err != nil {
 		return err
 	}
 
-	hcName := makeHealthCheckName(loadBalancerName, clusterID, sharedHealthCheck)
-	klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): deleting health check %v and its firewall", loadBalancerName, hcName)
-	if err := g.teardownInternalHealthCheckAndFirewall(svc, hcName); err != nil {
-		return err
+	if sharedResources {
+		refs, err := g.internalLoadBalancerReferences(svc, true)
+		if err != nil {
+			return err
+		}
+		klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): releasing health check %v and the shared health check firewall", loadBalancerName, hcName)
+		if err := g.teardownSharedInternalHealthCheck(svc, hcName, clusterID, sharedHealthCheck, refs); err != nil {
+			return err
+		}
+	} else {
+		klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): deleting health check %v and its firewall", loadBalancerName, hcName)
+		if err := g.teardownInternalHealthCheckAndFirewall(svc, hcName); err != nil {
+			return err
+		}
+		// The load balancer may still use the health check it shared before
+		// ILBSharedResources was disabled.
+		if paramsHCName, shared := internalHealthCheckName(svc, loadBalancerName, clusterID, hcParams, true); shared && paramsHCName != hcName {
+			klog.V(2).Infof("ensureInternalLoadBalancerDeleted(%v): releasing shared health check %v", loadBalancerName, paramsHCName)
+			if err := g.teardownInternalHealthCheckAndFirewall(svc, paramsHCName); err != nil {
+				return err
+			}
+			if err := g.releaseSharedInternalHealthCheckFirewall(svc, clusterID); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Try deleting instance groups - expect ResourceInuse error if needed by other LBs
@@ -432,7 +606,7 @@ func (g *Cloud) teardownInternalBackendService(bsName string) error {
 			klog.V(2).Infof("teardownInternalBackendService(%v): backend service in use.", bsName)
 			return nil
 		} else {
-			return fmt.Errorf("failed to delete backend service: %v, err: %v", bsName, err)
+			return fmt.Errorf("failed to delete backend service: %v, err: %w", bsName, err)
 		}
 	}
 	klog.V(2).Infof("teardownInternalBackendService(%v): backend service deleted", bsName)
@@ -448,12 +622,15 @@ func (g *Cloud) teardownInternalHealthCheckAndFirewall(svc *v1.Service, hcName s
 			klog.V(2).Infof("teardownInternalHealthCheckAndFirewall(%v): health check in use.", hcName)
 			return nil
 		} else {
-			return fmt.Errorf("failed to delete health check: %v, err: %v", hcName, err)
+			return fmt.Errorf("failed to delete health check: %v, err: %w", hcName, err)
 		}
 	}
 	klog.V(2).Infof("teardownInternalHealthCheckAndFirewall(%v): health check deleted", hcName)
 
 	hcFirewallName := makeHealthCheckFirewallNameFromHC(hcName)
+	if g.skipFirewallChange(svc, hcFirewallName, FirewallToGCloudDeleteCmd(hcFirewallName, g.NetworkProjectID())) {
+		return nil
+	}
 	if err := ignoreNotFound(g.DeleteFirewall(hcFirewallName)); err != nil {
 		if isForbidden(err) && g.OnXPN() {
 			klog.V(2).Infof("teardownInternalHealthCheckAndFirewall(%v): could not delete health check traffic firewall on XPN cluster. Raising Event.", hcName)
@@ -461,19 +638,41 @@ func (g *Cloud) teardownInternalHealthCheckAndFirewall(svc *v1.Service, hcName s
 			return nil
 		}
 
-		return fmt.Errorf("failed to delete health check firewall: %v, err: %v", hcFirewallName, err)
+		return fmt.Errorf("failed to delete health check firewall: %v, err: %w", hcFirewallName, err)
 	}
 	klog.V(2).Infof("teardownInternalHealthCheckAndFirewall(%v): health check firewall deleted", hcFirewallName)
+	if featureEnabled(DualStackLoadBalancers) {
+		return g.deleteInternalFirewall(svc, hcFirewallName+ipv6Suffix)
+	}
 	return nil
 }
 
 func (g *Cloud) ensureInternalFirewall(svc *v1.Service, fwName, fwDesc, destinationIP string, sourceRanges []string, portRanges []string, protocol v1.Protocol, nodes []*v1.Node, legacyFwName string) error {
-	klog.V(2).Infof("ensureInternalFirewall(%v): checking existing firewall", fwName)
-	targetTags, err := g.GetNodeTags(nodeNames(nodes))
-	if err != nil {
+	expectedFirewall := &compute.Firewall{
+		Name:         fwName,
+		Description:  fwDesc,
+		Network:      g.networkURL,
+		SourceRanges: sourceRanges,
+		Allowed: []*compute.FirewallAllowed{
+			{
+				IPProtocol: strings.ToLower(string(protocol)),
+				Ports:      portRanges,
+			},
+		},
+	}
+	if err := g.setFirewallTargets(expectedFirewall, func() ([]string, error) { return g.GetNodeTags(nodeNames(nodes)) }); err != nil {
 		return err
 	}
 
+	if destinationIP != "" {
+		expectedFirewall.DestinationRanges = []string{destinationIP}
+	}
+
+	if g.skipFirewallChange(svc, expectedFirewall.Name, FirewallToGCloudCreateCmd(expectedFirewall, g.NetworkProjectID())) {
+		return nil
+	}
+
+	klog.V(2).Infof("ensureInternalFirewall(%v): checking existing firewall", fwName)
 	existingFirewall, err := g.GetFirewall(fwName)
 	if err != nil && !isNotFound(err) {
 		return err
@@ -502,24 +701,6 @@ func (g *Cloud) ensureInternalFirewall(svc *v1.Service, fwName, fwDesc, destinat
 		}
 	}
 
-	expectedFirewall := &compute.Firewall{
-		Name:         fwName,
-		Description:  fwDesc,
-		Network:      g.networkURL,
-		SourceRanges: sourceRanges,
-		TargetTags:   targetTags,
-		Allowed: []*compute.FirewallAllowed{
-			{
-				IPProtocol: strings.ToLower(string(protocol)),
-				Ports:      portRanges,
-			},
-		},
-	}
-
-	if destinationIP != "" {
-		expectedFirewall.DestinationRanges = []string{destinationIP}
-	}
-
 	if existingFirewall == nil {
 		klog.V(2).Infof("ensureInternalFirewall(%v): creating firewall", fwName)
 		err = g.CreateFirewall(expectedFirewall)
@@ -536,6 +717,7 @@ func (g *Cloud) ensureInternalFirewall(svc *v1.Service, fwName, fwDesc, destinat
 	}
 
 	klog.V(2).Infof("ensureInternalFirewall(%v): updating firewall", fwName)
+	clearOtherFirewallTargets(expectedFirewall)
 	err = g.PatchFirewall(expectedFirewall)
 	if err != nil && isForbidden(err) && g.OnXPN() {
 		klog.V(2).Infof("ensureInternalFirewall(%v): do not have permission to update firewall rule (on XPN). Raising event.", fwName)
@@ -548,8 +730,9 @@ func (g *Cloud) ensureInternalFirewall(svc *v1.Service, fwName, fwDesc, destinat
 func (g *Cloud) ensureInternalFirewalls(loadBalancerName, ipAddress, clusterID string, nm types.NamespacedName, svc *v1.Service, healthCheckPort string, sharedHealthCheck bool, nodes []*v1.Node) error {
 	// First firewall is for ingress traffic
 	fwDesc := makeFirewallDescription(nm.String(), ipAddress)
-	_, portRanges, protocol := getPortsAndProtocol(svc.Spec.Ports)
-	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(svc)
+	ports, _ := g.loadBalancerPorts(svc)
+	_, portRanges, protocol := getPortsAndProtocol(ports)
+	sourceRanges, err := g.loadBalancerSourceRanges(svc)
 	if err != nil {
 		return err
 	}
@@ -559,14 +742,31 @@ func (g *Cloud) ensureInternalFirewalls(loadBalancerName, ipAddress, clusterID s
 	}
 
 	// Second firewall is for health checking nodes / services
+	if g.AlphaFeatureGate.Enabled(AlphaFeatureILBSharedResources) {
+		refs, err := g.internalLoadBalancerReferences(svc, false)
+		if err != nil {
+			return err
+		}
+		if err := g.ensureSharedInternalHealthCheckFirewall(svc, clusterID, refs, nodes); err != nil {
+			return err
+		}
+		// The shared firewall replaces the one of the health check.
+		return g.deleteInternalFirewall(svc, makeHealthCheckFirewallName(loadBalancerName, clusterID, usesNodesHealthCheck(svc)))
+	}
 	fwHCName := makeHealthCheckFirewallName(loadBalancerName, clusterID, sharedHealthCheck)
 	hcSrcRanges := L4LoadBalancerSrcRanges()
 	return g.ensureInternalFirewall(svc, fwHCName, "", "", hcSrcRanges, []string{healthCheckPort}, v1.ProtocolTCP, nodes, "")
 }
 
-func (g *Cloud) ensureInternalHealthCheck(name string, svcName types.NamespacedName, shared bool, path string, port int32) (*compute.HealthCheck, error) {
+// ensureInternalHealthCheck creates or updates the health check. Its
+// parameters are no smaller than the defaults, or exactly params if not nil.
+func (g *Cloud) ensureInternalHealthCheck(name string, svcName types.NamespacedName, shared bool, path string, port int32, params *healthCheckParams, logging bool) (*compute.HealthCheck, error) {
 	klog.V(2).Infof("ensureInternalHealthCheck(%v, %v, %v): checking existing health check", name, path, port)
 	expectedHC := newInternalLBHealthCheck(name, svcName, shared, path, port)
+	expectedHC.LogConfig = &compute.HealthCheckLogConfig{Enable: logging}
+	if params != nil {
+		params.applyToHealthCheck(expectedHC)
+	}
 
 	hc, err := g.GetHealthCheck(name)
 	if err != nil && !isNotFound(err) {
@@ -587,9 +787,11 @@ func (g *Cloud) ensureInternalHealthCheck(name string, svcName types.NamespacedN
 		return hc, nil
 	}
 
-	if needToUpdateHealthChecks(hc, expectedHC) {
+	if needToUpdateHealthChecks(hc, expectedHC) || params != nil && !params.matchesHealthCheck(hc) {
 		klog.V(2).Infof("ensureInternalHealthCheck: health check %v exists but parameters have drifted - updating...", name)
-		mergeHealthChecks(hc, expectedHC)
+		if params == nil {
+			mergeHealthChecks(hc, expectedHC)
+		}
 		if err := g.UpdateHealthCheck(expectedHC); err != nil {
 			klog.Warningf("Failed to reconcile http health check %v parameters", name)
 			return nil, err
@@ -653,18 +855,18 @@ func (g *Cloud) ensureInternalInstanceGroup(name, zone string, nodes []*v1.Node)
 	removeNodes := gceNodes.Difference(kubeNodes).List()
 	addNodes := kubeNodes.Difference(gceNodes).List()
 
-	if len(removeNodes) != 0 {
-		klog.V(2).Infof("ensureInternalInstanceGroup(%v, %v): removing nodes: %v", name, zone, removeNodes)
-		instanceRefs := g.ToInstanceReferences(zone, removeNodes)
+	for _, batch := range instanceBatches(removeNodes, maxInstancesPerInstanceGroupUpdate) {
+		klog.V(2).Infof("ensureInternalInstanceGroup(%v, %v): removing nodes: %v", name, zone, batch)
+		instanceRefs := g.ToInstanceReferences(zone, batch)
 		// Possible we'll receive 404's here if the instance was deleted before getting to this point.
 		if err = g.RemoveInstancesFromInstanceGroup(name, zone, instanceRefs); err != nil && !isNotFound(err) {
 			return "", err
 		}
 	}
 
-	if len(addNodes) != 0 {
-		klog.V(2).Infof("ensureInternalInstanceGroup(%v, %v): adding nodes: %v", name, zone, addNodes)
-		instanceRefs := g.ToInstanceReferences(zone, addNodes)
+	for _, batch := range instanceBatches(addNodes, maxInstancesPerInstanceGroupUpdate) {
+		klog.V(2).Infof("ensureInternalInstanceGroup(%v, %v): adding nodes: %v", name, zone, batch)
+		instanceRefs := g.ToInstanceReferences(zone, batch)
 		if err = g.AddInstancesToInstanceGroup(name, zone, instanceRefs); err != nil {
 			return "", err
 		}
@@ -689,25 +891,39 @@ func (g *Cloud) ensureInternalInstanceGroups(name string, nodes []*v1.Node) ([]s
 
 	zonedNodes := splitNodesByZone(nodes)
 	klog.V(2).Infof("ensureInternalInstanceGroups(%v): %d nodes over %d zones in region %v", name, len(nodes), len(zonedNodes), g.region)
-	var igLinks []string
-	for zone, nodes := range zonedNodes {
+	zones := make([]string, 0, len(zonedNodes))
+	for zone := range zonedNodes {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	// The zones are synced in parallel, each filling its own slot.
+	zoneIGLinks := make([][]string, len(zones))
+	err = forEachZone(zones, func(i int, zone string) error {
 		if g.AlphaFeatureGate.Enabled(AlphaFeatureSkipIGsManagement) {
 			igs, err := g.FilterInstanceGroupsByNamePrefix(name, zone)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			for _, ig := range igs {
-				igLinks = append(igLinks, ig.SelfLink)
-			}
-		} else {
-			igLink, err := g.ensureInternalInstanceGroup(name, zone, nodes)
-			if err != nil {
-				return nil, err
+				zoneIGLinks[i] = append(zoneIGLinks[i], ig.SelfLink)
 			}
-			igLinks = append(igLinks, igLink)
+			return nil
+		}
+		igLink, err := g.ensureInternalInstanceGroup(name, zone, zonedNodes[zone])
+		if err != nil {
+			return err
 		}
+		zoneIGLinks[i] = []string{igLink}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	var igLinks []string
+	for _, links := range zoneIGLinks {
+		igLinks = append(igLinks, links...)
+	}
 	return igLinks, nil
 }
 
@@ -730,22 +946,32 @@ func (g *Cloud) ensureInternalInstanceGroupsDeleted(name string) error {
 	return nil
 }
 
-func (g *Cloud) ensureInternalBackendService(name, description string, affinityType v1.ServiceAffinity, scheme cloud.LbScheme, protocol v1.Protocol, igLinks []string, hcLink string) error {
+// ensureInternalBackendService creates or updates the backend service. The
+// connection logging, tracking and draining configs and the timeout of an
+// existing backend service are left as is unless md manages them.
+func (g *Cloud) ensureInternalBackendService(name, description string, md *backendServiceMetadata, affinityType v1.ServiceAffinity, scheme cloud.LbScheme, protocol v1.Protocol, igLinks []string, hcLink string) error {
 	klog.V(2).Infof("ensureInternalBackendService(%v, %v, %v): checking existing backend service with %d groups", name, scheme, protocol, len(igLinks))
 	bs, err := g.GetRegionBackendService(name, g.region)
 	if err != nil && !isNotFound(err) {
 		return err
 	}
 
+	if md == nil {
+		md = &backendServiceMetadata{}
+	}
 	backends := backendsFromGroupLinks(igLinks)
 	expectedBS := &compute.BackendService{
-		Name:                name,
-		Protocol:            string(protocol),
-		Description:         description,
-		HealthChecks:        []string{hcLink},
-		Backends:            backends,
-		SessionAffinity:     translateAffinityType(affinityType),
-		LoadBalancingScheme: string(scheme),
+		Name:                     name,
+		Protocol:                 string(protocol),
+		Description:              description,
+		HealthChecks:             []string{hcLink},
+		Backends:                 backends,
+		SessionAffinity:          md.gceSessionAffinity(affinityType),
+		LoadBalancingScheme:      string(scheme),
+		LogConfig:                md.logConfig,
+		ConnectionTrackingPolicy: md.connectionTracking,
+		ConnectionDraining:       md.connectionDraining,
+		TimeoutSec:               md.timeoutSec,
 	}
 
 	// Create backend service if none was found
@@ -759,6 +985,19 @@ func (g *Cloud) ensureInternalBackendService(name, description string, affinityT
 		return nil
 	}
 
+	if md.logConfig == nil {
+		expectedBS.LogConfig = bs.LogConfig
+	}
+	if md.connectionTracking == nil {
+		expectedBS.ConnectionTrackingPolicy = bs.ConnectionTrackingPolicy
+	}
+	if md.connectionDraining == nil {
+		expectedBS.ConnectionDraining = bs.ConnectionDraining
+	}
+	if md.timeoutSec == 0 {
+		expectedBS.TimeoutSec = bs.TimeoutSec
+	}
+	expectedBS.LocalityLbPolicy = bs.LocalityLbPolicy
 	if backendSvcEqual(expectedBS, bs) {
 		return nil
 	}
@@ -773,6 +1012,40 @@ func (g *Cloud) ensureInternalBackendService(name, description string, affinityT
 	return nil
 }
 
+// prefersCloseTraffic returns whether the Service prefers its traffic to be
+// routed to topologically close endpoints.
+func prefersCloseTraffic(svc *v1.Service) bool {
+	return svc.Spec.TrafficDistribution != nil && *svc.Spec.TrafficDistribution == v1.ServiceTrafficDistributionPreferClose
+}
+
+// ensureInternalBackendServiceZonalAffinity enables the zonal affinity of the
+// backend service if preferClose, so that connections go to backends in the
+// zone of the client and only spill over to other zones when it has none
+// healthy, and disables it otherwise.
+func (g *Cloud) ensureInternalBackendServiceZonalAffinity(name string, preferClose bool) error {
+	bs, err := g.GetAlphaRegionBackendService(name, g.region)
+	if err != nil {
+		return err
+	}
+	expected := zonalAffinityDisabled
+	if preferClose {
+		expected = zonalAffinitySpillCrossZone
+	}
+	current := zonalAffinityDisabled
+	if p := bs.NetworkPassThroughLbTrafficPolicy; p != nil && p.ZonalAffinity != nil && p.ZonalAffinity.Spillover != "" {
+		current = p.ZonalAffinity.Spillover
+	}
+	if current == expected {
+		return nil
+	}
+	klog.V(2).Infof("ensureInternalBackendServiceZonalAffinity(%v): updating zonal affinity from %v to %v", name, current, expected)
+	if bs.NetworkPassThroughLbTrafficPolicy == nil {
+		bs.NetworkPassThroughLbTrafficPolicy = &computealpha.BackendServiceNetworkPassThroughLbTrafficPolicy{}
+	}
+	bs.NetworkPassThroughLbTrafficPolicy.ZonalAffinity = &computealpha.BackendServiceNetworkPassThroughLbTrafficPolicyZonalAffinity{Spillover: expected}
+	return g.UpdateAlphaRegionBackendService(bs, g.region)
+}
+
 // ensureInternalBackendServiceGroups updates backend services if their list of backend instance groups is incorrect.
 func (g *Cloud) ensureInternalBackendServiceGroups(name string, igLinks []string) error {
 	klog.V(2).Infof("ensureInternalBackendServiceGroups(%v): checking existing backend service's groups", name)
@@ -838,7 +1111,8 @@ func firewallRuleEqual(a, b *compute.Firewall) bool {
 		equalStringSets(a.Allowed[0].Ports, b.Allowed[0].Ports) &&
 		equalStringSets(a.SourceRanges, b.SourceRanges) &&
 		equalStringSets(a.DestinationRanges, b.DestinationRanges) &&
-		equalStringSets(a.TargetTags, b.TargetTags)
+		equalStringSets(a.TargetTags, b.TargetTags) &&
+		equalStringSets(a.TargetServiceAccounts, b.TargetServiceAccounts)
 }
 
 // mergeHealthChecks reconciles HealthCheck configures to be no smaller than
@@ -870,7 +1144,9 @@ func needToUpdateHealthChecks(hc, newHC *compute.HealthCheck) bool {
 		newHC.HttpHealthCheck == nil,
 		hc.HttpHealthCheck.Port != newHC.HttpHealthCheck.Port,
 		hc.HttpHealthCheck.RequestPath != newHC.HttpHealthCheck.RequestPath,
+		healthCheckProxyHeader(hc) != healthCheckProxyHeader(newHC),
 		hc.Description != newHC.Description,
+		healthCheckLoggingEnabled(hc) != healthCheckLoggingEnabled(newHC),
 		hc.CheckIntervalSec < newHC.CheckIntervalSec,
 		hc.TimeoutSec < newHC.TimeoutSec,
 		hc.UnhealthyThreshold < newHC.UnhealthyThreshold,
@@ -907,7 +1183,12 @@ func backendSvcEqual(a, b *compute.BackendService) bool {
 		a.SessionAffinity == b.SessionAffinity &&
 		a.LoadBalancingScheme == b.LoadBalancingScheme &&
 		equalStringSets(a.HealthChecks, b.HealthChecks) &&
-		backendsListEqual(a.Backends, b.Backends)
+		backendsListEqual(a.Backends, b.Backends) &&
+		backendServiceLogConfigEqual(a.LogConfig, b.LogConfig) &&
+		backendServiceConnectionTrackingEqual(a.ConnectionTrackingPolicy, b.ConnectionTrackingPolicy) &&
+		backendServiceConnectionDrainingEqual(a.ConnectionDraining, b.ConnectionDraining) &&
+		backendServiceTimeoutEqual(a.TimeoutSec, b.TimeoutSec) &&
+		backendServiceLocalityLBPolicyEqual(a.LocalityLbPolicy, b.LocalityLbPolicy)
 }
 
 func getPortsAndProtocol(svcPorts []v1.ServicePort) (ports []string, portRanges []string, protocol v1.Protocol) {
@@ -982,11 +1263,11 @@ func getNameFromLink(link string) string {
 }
 
 // ilbIPToUse determines which IP address needs to be used in the ForwardingRule. If an IP has been
-// specified by the user, that is used. If there is an existing ForwardingRule, the ip address from
+// requested by the user, that is used. If there is an existing ForwardingRule, the ip address from
 // that is reused. In case a subnetwork change is requested, the existing ForwardingRule IP is ignored.
-func ilbIPToUse(svc *v1.Service, fwdRule *compute.ForwardingRule, requestedSubnet string) string {
-	if svc.Spec.LoadBalancerIP != "" {
-		return svc.Spec.LoadBalancerIP
+func ilbIPToUse(requestedIP string, fwdRule *compute.ForwardingRule, requestedSubnet string) string {
+	if requestedIP != "" {
+		return requestedIP
 	}
 	if fwdRule == nil {
 		return ""
@@ -1001,12 +1282,32 @@ func ilbIPToUse(svc *v1.Service, fwdRule *compute.ForwardingRule, requestedSubne
 func getILBOptions(svc *v1.Service) ILBOptions {
 	return ILBOptions{AllowGlobalAccess: GetLoadBalancerAnnotationAllowGlobalAccess(svc),
 		SubnetName: GetLoadBalancerAnnotationSubnet(svc),
+		AllPorts:   GetLoadBalancerAnnotationAllPorts(svc),
 	}
 }
 
+// internalForwardingRulePorts returns the ports of the forwarding rule of an
+// internal load balancer serving ports, its port range, or whether it serves
+// all ports. A forwarding rule takes at most maxL4ILBPorts ports, or a single
+// port range if there are more of them and they are contiguous, and serves
+// all ports otherwise or if allPorts is requested.
+func internalForwardingRulePorts(ports, portRanges []string, allPorts bool) ([]string, string, bool) {
+	switch {
+	case allPorts:
+		return nil, "", true
+	case len(ports) <= maxL4ILBPorts:
+		return ports, "", false
+	case len(portRanges) == 1:
+		return nil, portRanges[0], false
+	}
+	return nil, "", true
+}
+
 type forwardingRuleDescription struct {
 	ServiceName string       `json:"kubernetes.io/service-name"`
 	APIVersion  meta.Version `json:"kubernetes.io/api-version,omitempty"`
+	// ClusterID is the ID of the cluster owning the forwarding rule.
+	ClusterID string `json:"kubernetes.io/cluster-id,omitempty"`
 }
 
 // marshal the description as a JSON-encoded string.
@@ -1043,6 +1344,9 @@ func (g *Cloud) ensureInternalForwardingRule(existingFwdRule, newFwdRule *comput
 			klog.V(4).Infof("existingFwdRule == newFwdRule, no updates needed (existingFwdRule == %+v)", existingFwdRule)
 			return nil
 		}
+		if err = g.checkRecreateBudget(existingFwdRule.Name); err != nil {
+			return err
+		}
 		klog.V(2).Infof("ensureInternalLoadBalancer(%v): deleting existing forwarding rule with IP address %v", existingFwdRule.Name, existingFwdRule.IPAddress)
 		if err = ignoreNotFound(g.DeleteRegionForwardingRule(existingFwdRule.Name, g.region)); err != nil {
 			return err
@@ -1072,6 +1376,7 @@ func forwardingRulesEqual(old, new *compute.ForwardingRule) bool {
 		old.IPProtocol == new.IPProtocol &&
 		old.LoadBalancingScheme == new.LoadBalancingScheme &&
 		equalStringSets(old.Ports, new.Ports) &&
+		old.PortRange == new.PortRange &&
 		old.AllPorts == new.AllPorts &&
 		oldResourceID.Equal(newResourceID) &&
 		old.AllowGlobalAccess == new.AllowGlobalAccess &&
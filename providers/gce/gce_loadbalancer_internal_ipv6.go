@@ -0,0 +1,185 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+const (
+	// ipVersionIPv6 is the IP version of IPv6 forwarding rules.
+	ipVersionIPv6 = "IPV6"
+	// ipv6Suffix suffixes the names of the IPv6 resources of a load balancer.
+	ipv6Suffix = "-ipv6"
+)
+
+// L4LoadBalancerIPv6SrcRanges returns the IPv6 ranges of the health checks
+// of the L4 load balancers.
+func L4LoadBalancerIPv6SrcRanges() []string {
+	return []string{"2600:2d00:1:b029::/64"}
+}
+
+// serviceIPFamilies returns whether the Service requests IPv4 and IPv6
+// load balancers. Services without IP families get IPv4 ones.
+func serviceIPFamilies(svc *v1.Service) (ipv4, ipv6 bool) {
+	if len(svc.Spec.IPFamilies) == 0 {
+		return true, false
+	}
+	for _, family := range svc.Spec.IPFamilies {
+		switch family {
+		case v1.IPv4Protocol:
+			ipv4 = true
+		case v1.IPv6Protocol:
+			ipv6 = true
+		}
+	}
+	return ipv4, ipv6
+}
+
+// wantsIPv6LoadBalancer returns whether the IPv6 load balancer resources of
+// the Service should exist, and an error if they are requested without IPv4.
+func wantsIPv6LoadBalancer(svc *v1.Service) (bool, error) {
+	if !featureEnabled(DualStackLoadBalancers) {
+		return false, nil
+	}
+	ipv4, ipv6 := serviceIPFamilies(svc)
+	if ipv6 && !ipv4 {
+		return false, fmt.Errorf("single-stack IPv6 LoadBalancer Services are not supported, use ipFamilyPolicy %s or %s", v1.IPFamilyPolicyPreferDualStack, v1.IPFamilyPolicyRequireDualStack)
+	}
+	return ipv6, nil
+}
+
+// requiresDualStack returns whether the Service requires both an IPv4 and an
+// IPv6 load balancer, rather than falling back to IPv4 if IPv6 fails.
+func requiresDualStack(svc *v1.Service) bool {
+	return svc.Spec.IPFamilyPolicy != nil && *svc.Spec.IPFamilyPolicy == v1.IPFamilyPolicyRequireDualStack
+}
+
+// ipv6SourceRanges returns the IPv6 source ranges allowed to reach the load
+// balancer of the Service: all of them if neither it nor the cluster restrict
+// them.
+func (g *Cloud) ipv6SourceRanges(svc *v1.Service) ([]string, error) {
+	sourceRanges, err := g.loadBalancerSourceRanges(svc)
+	if err != nil {
+		return nil, err
+	}
+	if servicehelpers.IsAllowAll(sourceRanges) {
+		return []string{"::/0"}, nil
+	}
+	var ranges []string
+	for _, r := range sourceRanges.StringSlice() {
+		if utilnet.IsIPv6CIDRString(r) {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges, nil
+}
+
+// ensureInternalIPv6LoadBalancer ensures the IPv6 forwarding rule of the
+// internal load balancer next to the IPv4 one newFwdRule, and its firewalls.
+// It returns the IPv6 address of the load balancer.
+func (g *Cloud) ensureInternalIPv6LoadBalancer(svc *v1.Service, newFwdRule *compute.ForwardingRule, hcName, hcPort string, nodes []*v1.Node) (string, error) {
+	fwdRule := *newFwdRule
+	fwdRule.Name = newFwdRule.Name + ipv6Suffix
+	fwdRule.IPAddress = ""
+	fwdRule.IpVersion = ipVersionIPv6
+
+	existingFwdRule, err := g.GetRegionForwardingRule(fwdRule.Name, g.region)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+	if err := g.ensureInternalForwardingRule(existingFwdRule, &fwdRule); err != nil {
+		return "", err
+	}
+	if existingFwdRule, err = g.GetRegionForwardingRule(fwdRule.Name, g.region); err != nil {
+		return "", err
+	}
+
+	// IPv6 forwarding rules have a /96 range, of which the load balancer
+	// serves the first address.
+	ipRange := existingFwdRule.IPAddress
+	if !strings.Contains(ipRange, "/") {
+		ipRange += "/96"
+	}
+	sourceRanges, err := g.ipv6SourceRanges(svc)
+	if err != nil {
+		return "", err
+	}
+	fwName := MakeFirewallName(newFwdRule.Name) + ipv6Suffix
+	if len(sourceRanges) == 0 {
+		klog.V(2).Infof("ensureInternalIPv6LoadBalancer(%v): no IPv6 source range allowed, deleting firewall %v", newFwdRule.Name, fwName)
+		if err := g.deleteInternalFirewall(svc, fwName); err != nil {
+			return "", err
+		}
+	} else {
+		nm := types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}
+		ports, _ := g.loadBalancerPorts(svc)
+		_, portRanges, protocol := getPortsAndProtocol(ports)
+		if err := g.ensureInternalFirewall(svc, fwName, makeFirewallDescription(nm.String(), ipRange), ipRange, sourceRanges, portRanges, protocol, nodes, ""); err != nil {
+			return "", err
+		}
+	}
+	hcFwName := makeHealthCheckFirewallNameFromHC(hcName) + ipv6Suffix
+	if err := g.ensureInternalFirewall(svc, hcFwName, "", "", L4LoadBalancerIPv6SrcRanges(), []string{hcPort}, v1.ProtocolTCP, nodes, ""); err != nil {
+		return "", err
+	}
+	return strings.SplitN(existingFwdRule.IPAddress, "/", 2)[0], nil
+}
+
+// ensureInternalIPv6LoadBalancerDeleted deletes the IPv6 forwarding rule and
+// firewalls of the internal load balancer, but the health check firewall if
+// the health check is shared.
+func (g *Cloud) ensureInternalIPv6LoadBalancerDeleted(svc *v1.Service, loadBalancerName, hcName string, sharedHealthCheck bool) error {
+	klog.V(2).Infof("ensureInternalIPv6LoadBalancerDeleted(%v): deleting IPv6 forwarding rule and firewalls", loadBalancerName)
+	if err := ignoreNotFound(g.DeleteRegionForwardingRule(loadBalancerName+ipv6Suffix, g.region)); err != nil {
+		return err
+	}
+	if err := g.deleteInternalFirewall(svc, MakeFirewallName(loadBalancerName)+ipv6Suffix); err != nil {
+		return err
+	}
+	if sharedHealthCheck {
+		return nil
+	}
+	return g.deleteInternalFirewall(svc, makeHealthCheckFirewallNameFromHC(hcName)+ipv6Suffix)
+}
+
+// loadBalancerIngress returns the ingress of the load balancer status with
+// the IPv4 and IPv6 addresses, in the order of the IP families of the
+// Service.
+func loadBalancerIngress(svc *v1.Service, scheme, ipv4, ipv6 string) []v1.LoadBalancerIngress {
+	ipMode := loadBalancerIPMode(scheme)
+	ingress := []v1.LoadBalancerIngress{{IP: ipv4, IPMode: ipMode}}
+	if ipv6 == "" {
+		return ingress
+	}
+	ipv6Ingress := v1.LoadBalancerIngress{IP: ipv6, IPMode: ipMode}
+	if len(svc.Spec.IPFamilies) > 0 && svc.Spec.IPFamilies[0] == v1.IPv6Protocol {
+		return append([]v1.LoadBalancerIngress{ipv6Ingress}, ingress...)
+	}
+	return append(ingress, ipv6Ingress)
+}
@@ -0,0 +1,225 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/featuregate"
+)
+
+func enableDualStackLoadBalancers(t *testing.T) {
+	gate := featuregate.NewFeatureGate()
+	require.NoError(t, AddFeatureGates(gate))
+	require.NoError(t, gate.Set("DualStackLoadBalancers=true"))
+	SetFeatureGate(gate)
+	t.Cleanup(func() { SetFeatureGate(newFeatureGate()) })
+}
+
+func TestEnsureInternalLoadBalancerDualStack(t *testing.T) {
+	enableDualStackLoadBalancers(t)
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	// GCE assigns a /96 range to the IPv6 forwarding rules.
+	gce.c.(*cloud.MockGCE).MockForwardingRules.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.ForwardingRule, m *cloud.MockForwardingRules, options ...cloud.Option) (bool, error) {
+		if obj.IpVersion == ipVersionIPv6 {
+			obj.IPAddress = "fd20:1:2:3:0:0:0:0/96"
+		}
+		return mock.InsertFwdRuleHook(ctx, key, obj, m, options...)
+	}
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	policy := v1.IPFamilyPolicyRequireDualStack
+	svc.Spec.IPFamilyPolicy = &policy
+	svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	status, err := createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	require.Len(t, status.Ingress, 2)
+	assert.Equal(t, "fd20:1:2:3:0:0:0:0", status.Ingress[1].IP)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName+ipv6Suffix, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, ipVersionIPv6, fwdRule.IpVersion)
+	assert.Equal(t, []string{"123"}, fwdRule.Ports)
+	fw, err := gce.GetFirewall(MakeFirewallName(lbName) + ipv6Suffix)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"::/0"}, fw.SourceRanges)
+	assert.Equal(t, []string{"fd20:1:2:3:0:0:0:0/96"}, fw.DestinationRanges)
+	hcFw, err := gce.GetFirewall(makeHealthCheckFirewallName(lbName, vals.ClusterID, true) + ipv6Suffix)
+	require.NoError(t, err)
+	assert.Equal(t, L4LoadBalancerIPv6SrcRanges(), hcFw.SourceRanges)
+
+	// Going back to single-stack IPv4 deletes the IPv6 resources.
+	svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv4Protocol}
+	existingFwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	status, err = createInternalLoadBalancer(gce, svc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	assert.Len(t, status.Ingress, 1)
+	_, err = gce.GetRegionForwardingRule(lbName+ipv6Suffix, gce.region)
+	assert.True(t, isNotFound(err), "IPv6 forwarding rule should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName) + ipv6Suffix)
+	assert.True(t, isNotFound(err), "IPv6 firewall should be deleted, err: %v", err)
+
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svc))
+	_, err = gce.GetFirewall(makeHealthCheckFirewallName(lbName, vals.ClusterID, true) + ipv6Suffix)
+	assert.True(t, isNotFound(err), "IPv6 health check firewall should be deleted, err: %v", err)
+}
+
+func TestEnsureInternalLoadBalancerSingleStackIPv6(t *testing.T) {
+	enableDualStackLoadBalancers(t)
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv6Protocol}
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	assert.ErrorContains(t, err, "single-stack IPv6")
+}
+
+func TestEnsureInternalLoadBalancerIPv6Failure(t *testing.T) {
+	enableDualStackLoadBalancers(t)
+
+	for _, tc := range []struct {
+		policy    v1.IPFamilyPolicy
+		wantErr   bool
+		wantEvent string
+	}{
+		{policy: v1.IPFamilyPolicyPreferDualStack, wantEvent: "Warning IPv6LoadBalancerFallback"},
+		{policy: v1.IPFamilyPolicyRequireDualStack, wantErr: true, wantEvent: "Warning IPv6LoadBalancerFailed"},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			vals := DefaultTestClusterValues()
+			gce, err := fakeGCECloud(vals)
+			require.NoError(t, err)
+			recorder := record.NewFakeRecorder(10)
+			gce.eventRecorder = recorder
+			// The subnet has no IPv6 range.
+			gce.c.(*cloud.MockGCE).MockForwardingRules.InsertHook = func(ctx context.Context, key *meta.Key, obj *compute.ForwardingRule, m *cloud.MockForwardingRules, options ...cloud.Option) (bool, error) {
+				if obj.IpVersion == ipVersionIPv6 {
+					return true, &googleapi.Error{Code: http.StatusBadRequest, Message: "the subnetwork has no IPv6 range"}
+				}
+				return mock.InsertFwdRuleHook(ctx, key, obj, m, options...)
+			}
+
+			svc := fakeLoadbalancerService(string(LBTypeInternal))
+			policy := tc.policy
+			svc.Spec.IPFamilyPolicy = &policy
+			svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}
+			svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+			require.NoError(t, err)
+			status, err := createInternalLoadBalancer(gce, svc, nil, []string{"test-node-1"}, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				// The load balancer falls back to IPv4.
+				require.NoError(t, err)
+				assert.Len(t, status.Ingress, 1)
+				lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+				_, err = gce.GetFirewall(MakeFirewallName(lbName) + ipv6Suffix)
+				assert.True(t, isNotFound(err), "IPv6 firewall should not exist, err: %v", err)
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			assert.True(t, slices.ContainsFunc(events, func(e string) bool { return strings.HasPrefix(e, tc.wantEvent) }), "got events %v, want %q", events, tc.wantEvent)
+		})
+	}
+}
+
+func TestEnsureExternalLoadBalancerRequireDualStack(t *testing.T) {
+	enableDualStackLoadBalancers(t)
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(10)
+	gce.eventRecorder = recorder
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	policy := v1.IPFamilyPolicyRequireDualStack
+	svc.Spec.IPFamilyPolicy = &policy
+	svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv4Protocol, v1.IPv6Protocol}
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	assert.ErrorContains(t, err, string(v1.IPFamilyPolicyRequireDualStack))
+	checkEvent(t, recorder, "Warning IPv6LoadBalancerNotSupported", true)
+	_, err = gce.GetRegionForwardingRule(gce.GetLoadBalancerName(context.TODO(), "", svc), gce.region)
+	assert.True(t, isNotFound(err), "forwarding rule should not exist, err: %v", err)
+}
+
+func TestIPv6SourceRanges(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	ranges, err := gce.ipv6SourceRanges(svc)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"::/0"}, ranges)
+
+	svc.Spec.LoadBalancerSourceRanges = []string{"10.0.0.0/8", "fd00::/8"}
+	ranges, err = gce.ipv6SourceRanges(svc)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fd00::/8"}, ranges)
+
+	svc.Spec.LoadBalancerSourceRanges = []string{"10.0.0.0/8"}
+	ranges, err = gce.ipv6SourceRanges(svc)
+	require.NoError(t, err)
+	assert.Empty(t, ranges)
+}
+
+func TestLoadBalancerIngress(t *testing.T) {
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	scheme := string(cloud.SchemeInternal)
+	assert.Len(t, loadBalancerIngress(svc, scheme, "10.0.0.1", ""), 1)
+
+	svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv6Protocol, v1.IPv4Protocol}
+	ingress := loadBalancerIngress(svc, scheme, "10.0.0.1", "fd20::")
+	require.Len(t, ingress, 2)
+	assert.Equal(t, "fd20::", ingress[0].IP)
+	assert.Equal(t, "10.0.0.1", ingress[1].IP)
+}
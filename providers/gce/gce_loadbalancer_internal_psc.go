@@ -0,0 +1,251 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ServiceConditionPSCServiceAttachment is the condition of an internal
+	// LoadBalancer Service published with Private Service Connect, whose
+	// message is the URI of its service attachment.
+	ServiceConditionPSCServiceAttachment = "PSCServiceAttachmentReady"
+	// pscServiceAttachmentReadyReason is the reason of the condition of a
+	// Service whose service attachment is up to date.
+	pscServiceAttachmentReadyReason = "ServiceAttachmentReady"
+	// pscFieldManager owns the condition of the service attachment, apart
+	// from the other conditions of the Service.
+	pscFieldManager = "gce-cloud-controller-psc"
+
+	// pscConnectionPreferenceAutomatic accepts the connections of all the
+	// consumer projects.
+	pscConnectionPreferenceAutomatic = "ACCEPT_AUTOMATIC"
+	// pscConnectionPreferenceManual only accepts the connections of the
+	// consumer projects of the accept list.
+	pscConnectionPreferenceManual = "ACCEPT_MANUAL"
+	// pscConsumerConnectionLimit is the number of endpoints each accepted
+	// consumer project may connect to the service attachment.
+	pscConsumerConnectionLimit = 10
+)
+
+// pscServiceAttachmentOptions are the options of the service attachment
+// publishing an internal load balancer with Private Service Connect.
+type pscServiceAttachmentOptions struct {
+	// natSubnets are the names of the PRIVATE_SERVICE_CONNECT subnetworks
+	// the connections of the consumers are translated from.
+	natSubnets []string
+	// consumerProjects are the only projects accepted to connect, all if
+	// empty.
+	consumerProjects []string
+}
+
+// getPSCServiceAttachmentOptions returns the options of the service
+// attachment of the Service, nil if the Service is not published with
+// Private Service Connect.
+func getPSCServiceAttachmentOptions(svc *v1.Service) (*pscServiceAttachmentOptions, error) {
+	if svc.Annotations[ServiceAnnotationPSCServiceAttachment] != "true" {
+		return nil, nil
+	}
+	opts := &pscServiceAttachmentOptions{
+		natSubnets:       splitAnnotationList(svc.Annotations[ServiceAnnotationPSCNATSubnets]),
+		consumerProjects: splitAnnotationList(svc.Annotations[ServiceAnnotationPSCConsumerProjects]),
+	}
+	if len(opts.natSubnets) == 0 {
+		return nil, fmt.Errorf("annotation %q requires the NAT subnetworks of annotation %q", ServiceAnnotationPSCServiceAttachment, ServiceAnnotationPSCNATSubnets)
+	}
+	return opts, nil
+}
+
+// splitAnnotationList splits the comma separated values of an annotation.
+func splitAnnotationList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// serviceAttachmentURI returns the URI of the service attachment reported
+// in the condition of the Service, empty if it has none.
+func serviceAttachmentURI(svc *v1.Service) string {
+	for _, cond := range svc.Status.Conditions {
+		if cond.Type == ServiceConditionPSCServiceAttachment {
+			return cond.Message
+		}
+	}
+	return ""
+}
+
+// newServiceAttachment returns the service attachment publishing the
+// internal forwarding rule.
+func (g *Cloud) newServiceAttachment(name, description, fwdRuleLink string, opts *pscServiceAttachmentOptions) *compute.ServiceAttachment {
+	sa := &compute.ServiceAttachment{
+		Name:                 name,
+		Description:          description,
+		TargetService:        fwdRuleLink,
+		ConnectionPreference: pscConnectionPreferenceAutomatic,
+	}
+	for _, subnet := range opts.natSubnets {
+		sa.NatSubnets = append(sa.NatSubnets, gceSubnetworkURL("", g.networkProjectID, g.region, subnet))
+	}
+	if len(opts.consumerProjects) > 0 {
+		sa.ConnectionPreference = pscConnectionPreferenceManual
+		for _, project := range opts.consumerProjects {
+			sa.ConsumerAcceptLists = append(sa.ConsumerAcceptLists, &compute.ServiceAttachmentConsumerProjectLimit{
+				ProjectIdOrNum:  project,
+				ConnectionLimit: pscConsumerConnectionLimit,
+			})
+		}
+	}
+	return sa
+}
+
+// serviceAttachmentsEqual tells whether the service attachments have the same
+// NAT subnetworks and consumers, which can be patched.
+func serviceAttachmentsEqual(a, b *compute.ServiceAttachment) bool {
+	names := func(links []string) []string {
+		var names []string
+		for _, link := range links {
+			names = append(names, lastComponent(link))
+		}
+		slices.Sort(names)
+		return names
+	}
+	projects := func(lists []*compute.ServiceAttachmentConsumerProjectLimit) []string {
+		var projects []string
+		for _, l := range lists {
+			projects = append(projects, fmt.Sprintf("%s/%d", l.ProjectIdOrNum, l.ConnectionLimit))
+		}
+		slices.Sort(projects)
+		return projects
+	}
+	return a.ConnectionPreference == b.ConnectionPreference &&
+		slices.Equal(names(a.NatSubnets), names(b.NatSubnets)) &&
+		slices.Equal(projects(a.ConsumerAcceptLists), projects(b.ConsumerAcceptLists))
+}
+
+// ensureInternalServiceAttachment creates or updates the service attachment
+// publishing the internal forwarding rule, and reports its URI in the
+// condition of the Service.
+func (g *Cloud) ensureInternalServiceAttachment(svc *v1.Service, fwdRule *compute.ForwardingRule, description string, opts *pscServiceAttachmentOptions) error {
+	name := fwdRule.Name
+	want := g.newServiceAttachment(name, description, fwdRule.SelfLink, opts)
+	existing, err := g.GetServiceAttachment(name, g.region)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if existing != nil && lastComponent(existing.TargetService) != lastComponent(want.TargetService) {
+		// The target of a service attachment cannot be patched.
+		klog.V(2).Infof("ensureInternalServiceAttachment(%v): recreating service attachment targeting %v", name, existing.TargetService)
+		if err := ignoreNotFound(g.DeleteServiceAttachment(name, g.region)); err != nil {
+			return err
+		}
+		existing = nil
+	}
+	switch {
+	case existing == nil:
+		klog.V(2).Infof("ensureInternalServiceAttachment(%v): creating service attachment", name)
+		if err := g.CreateServiceAttachment(want, g.region); err != nil {
+			return err
+		}
+	case !serviceAttachmentsEqual(existing, want):
+		klog.V(2).Infof("ensureInternalServiceAttachment(%v): updating service attachment", name)
+		want.Fingerprint = existing.Fingerprint
+		if err := g.PatchServiceAttachment(want, g.region); err != nil {
+			return err
+		}
+	}
+	uri := g.serviceAttachmentLink(name)
+	if serviceAttachmentURI(svc) == uri {
+		return nil
+	}
+	g.eventRecorder.Eventf(svc, v1.EventTypeNormal, "ServiceAttachmentReady", "Published with Private Service Connect service attachment %s", uri)
+	return g.applyServiceAttachmentCondition(svc, uri)
+}
+
+// ensureInternalServiceAttachmentDeleted deletes the service attachment of
+// the internal load balancer, if the Service reports one or is published
+// with Private Service Connect, and removes its condition from the Service.
+func (g *Cloud) ensureInternalServiceAttachmentDeleted(svc *v1.Service, name string) error {
+	reported := serviceAttachmentURI(svc) != ""
+	if !reported && svc.Annotations[ServiceAnnotationPSCServiceAttachment] != "true" {
+		return nil
+	}
+	klog.V(2).Infof("ensureInternalServiceAttachmentDeleted(%v): deleting service attachment", name)
+	if err := ignoreNotFound(g.DeleteServiceAttachment(name, g.region)); err != nil {
+		return err
+	}
+	if !reported {
+		return nil
+	}
+	return g.applyServiceAttachmentCondition(svc, "")
+}
+
+// checkServiceAttachmentBlocksRecreate returns an error if the forwarding
+// rule name is published by a service attachment, which must be removed
+// before the forwarding rule can be recreated.
+func (g *Cloud) checkServiceAttachmentBlocksRecreate(svc *v1.Service, name string) error {
+	sa, err := g.GetServiceAttachment(name, g.region)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("The forwarding rule %s must be recreated, but it is published by the service attachment %s. Remove the %s annotation to delete the service attachment first.", name, sa.Name, ServiceAnnotationPSCServiceAttachment)
+	g.eventRecorder.Event(svc, v1.EventTypeWarning, "ServiceAttachmentBlocksUpdate", msg)
+	return fmt.Errorf("forwarding rule %s is published by service attachment %s, not recreating it", name, sa.Name)
+}
+
+// serviceAttachmentLink returns the URI of the service attachment.
+func (g *Cloud) serviceAttachmentLink(name string) string {
+	return g.projectsBasePath + strings.Join([]string{g.projectID, "regions", g.region, "serviceAttachments", name}, "/")
+}
+
+// applyServiceAttachmentCondition sets the condition of the Service to the
+// URI of its service attachment, or removes it if uri is empty.
+func (g *Cloud) applyServiceAttachmentCondition(svc *v1.Service, uri string) error {
+	status := corev1apply.ServiceStatus()
+	if uri != "" {
+		status = status.WithConditions(
+			metav1apply.Condition().
+				WithType(ServiceConditionPSCServiceAttachment).
+				WithStatus(metav1.ConditionTrue).
+				WithReason(pscServiceAttachmentReadyReason).
+				WithMessage(uri).
+				WithLastTransitionTime(metav1.Now()))
+	}
+	svcApply := corev1apply.Service(svc.Name, svc.Namespace).WithStatus(status)
+	_, err := g.client.CoreV1().Services(svc.Namespace).ApplyStatus(context.TODO(), svcApply, metav1.ApplyOptions{FieldManager: pscFieldManager, Force: true})
+	return err
+}
@@ -0,0 +1,181 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnsureInternalLoadBalancerPSCServiceAttachment(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	mockGCE := gce.c.(*cloud.MockGCE)
+	mockGCE.MockServiceAttachments.PatchHook = func(ctx context.Context, key *meta.Key, sa *compute.ServiceAttachment, m *cloud.MockServiceAttachments, options ...cloud.Option) error {
+		m.Objects[*key] = &cloud.MockServiceAttachmentsObj{Obj: sa}
+		return nil
+	}
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationPSCServiceAttachment] = "true"
+	svc.Annotations[ServiceAnnotationPSCNATSubnets] = "psc-nat-1, psc-nat-2"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	key := meta.RegionalKey(lbName, vals.Region)
+
+	ensure := func() {
+		t.Helper()
+		existingFwdRule, err := gce.GetRegionForwardingRule(lbName, vals.Region)
+		if isNotFound(err) {
+			existingFwdRule, err = nil, nil
+		}
+		require.NoError(t, err)
+		_, err = gce.ensureInternalLoadBalancer(vals.ClusterName, vals.ClusterID, svc, existingFwdRule, nodes)
+		require.NoError(t, err)
+		svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+	}
+
+	// The attachment publishes the forwarding rule and is reported in the
+	// status of the Service.
+	ensure()
+	sa, err := mockGCE.ServiceAttachments().Get(context.TODO(), key)
+	require.NoError(t, err)
+	assert.Equal(t, lbName, lastComponent(sa.TargetService))
+	assert.Equal(t, []string{
+		gceSubnetworkURL("", vals.ProjectID, vals.Region, "psc-nat-1"),
+		gceSubnetworkURL("", vals.ProjectID, vals.Region, "psc-nat-2"),
+	}, sa.NatSubnets)
+	assert.Equal(t, pscConnectionPreferenceAutomatic, sa.ConnectionPreference)
+	uri := gce.serviceAttachmentLink(lbName)
+	assert.Equal(t, uri, serviceAttachmentURI(svc))
+
+	// The consumers are patched.
+	svc.Annotations[ServiceAnnotationPSCConsumerProjects] = "consumer-project"
+	ensure()
+	sa, err = mockGCE.ServiceAttachments().Get(context.TODO(), key)
+	require.NoError(t, err)
+	assert.Equal(t, pscConnectionPreferenceManual, sa.ConnectionPreference)
+	require.Len(t, sa.ConsumerAcceptLists, 1)
+	assert.Equal(t, "consumer-project", sa.ConsumerAcceptLists[0].ProjectIdOrNum)
+	assert.Equal(t, uri, serviceAttachmentURI(svc))
+
+	// The forwarding rule published by the attachment is not recreated.
+	svc.Spec.Ports[0].Protocol = v1.ProtocolUDP
+	existingFwdRule, err := gce.GetRegionForwardingRule(lbName, vals.Region)
+	require.NoError(t, err)
+	_, err = gce.ensureInternalLoadBalancer(vals.ClusterName, vals.ClusterID, svc, existingFwdRule, nodes)
+	assert.Error(t, err)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, vals.Region)
+	require.NoError(t, err)
+	assert.Equal(t, existingFwdRule.IPProtocol, fwdRule.IPProtocol)
+	sa, err = mockGCE.ServiceAttachments().Get(context.TODO(), key)
+	require.NoError(t, err)
+	assert.Equal(t, "consumer-project", sa.ConsumerAcceptLists[0].ProjectIdOrNum)
+
+	// The attachment is deleted with the load balancer.
+	require.NoError(t, gce.ensureInternalLoadBalancerDeleted(vals.ClusterName, vals.ClusterID, svc))
+	_, err = mockGCE.ServiceAttachments().Get(context.TODO(), key)
+	assert.True(t, isNotFound(err), "service attachment not deleted: %v", err)
+}
+
+func TestEnsureInternalLoadBalancerPSCServiceAttachmentDisabled(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	key := meta.RegionalKey(lbName, vals.Region)
+	mockGCE := gce.c.(*cloud.MockGCE)
+	require.NoError(t, mockGCE.ServiceAttachments().Insert(context.TODO(), key, &compute.ServiceAttachment{Name: lbName}))
+
+	// The attachment of a Service no longer published is deleted.
+	svc.Status.Conditions = []metav1.Condition{{
+		Type:    ServiceConditionPSCServiceAttachment,
+		Status:  metav1.ConditionTrue,
+		Message: gce.serviceAttachmentLink(lbName),
+	}}
+	_, err = gce.ensureInternalLoadBalancer(vals.ClusterName, vals.ClusterID, svc, nil, nodes)
+	require.NoError(t, err)
+	_, err = mockGCE.ServiceAttachments().Get(context.TODO(), key)
+	assert.True(t, isNotFound(err), "service attachment not deleted: %v", err)
+}
+
+func TestGetPSCServiceAttachmentOptions(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		annotations map[string]string
+		want        *pscServiceAttachmentOptions
+		wantErr     bool
+	}{
+		{
+			desc: "not published",
+		},
+		{
+			desc: "NAT subnets and consumers",
+			annotations: map[string]string{
+				ServiceAnnotationPSCServiceAttachment: "true",
+				ServiceAnnotationPSCNATSubnets:        "nat-1,nat-2",
+				ServiceAnnotationPSCConsumerProjects:  "project-1, 1234",
+			},
+			want: &pscServiceAttachmentOptions{
+				natSubnets:       []string{"nat-1", "nat-2"},
+				consumerProjects: []string{"project-1", "1234"},
+			},
+		},
+		{
+			desc:        "no NAT subnets",
+			annotations: map[string]string{ServiceAnnotationPSCServiceAttachment: "true"},
+			wantErr:     true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			got, err := getPSCServiceAttachmentOptions(svc)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+)
+
+// internalHealthCheckName returns the name of the health check of the
+// internal load balancer of the Service, and whether other load balancers
+// share it. With shared resources, the Services with externalTrafficPolicy
+// Cluster and the same health check parameters share a health check.
+func internalHealthCheckName(svc *v1.Service, loadBalancerName, clusterID string, params *healthCheckParams, sharedResources bool) (string, bool) {
+	// The health checks of Services with externalTrafficPolicy Local request
+	// their own healthCheckNodePort, so they are never shared.
+	if sharedResources && params != nil && !servicehelpers.RequestsOnlyLocalTraffic(svc) {
+		return makeParamsHealthCheckName(clusterID, params), true
+	}
+	shared := usesNodesHealthCheck(svc)
+	return makeHealthCheckName(loadBalancerName, clusterID, shared), shared
+}
+
+// internalLoadBalancerReferences returns the Services with an internal load
+// balancer handled by this controller, which are the references to the
+// shared resources. svc is included with its given spec, unless deleted.
+func (g *Cloud) internalLoadBalancerReferences(svc *v1.Service, deleted bool) ([]*v1.Service, error) {
+	services, err := g.listServices()
+	if err != nil {
+		return nil, err
+	}
+	var refs []*v1.Service
+	for _, ref := range services {
+		if ref.Namespace == svc.Namespace && ref.Name == svc.Name {
+			continue
+		}
+		if ref.Spec.Type != v1.ServiceTypeLoadBalancer || GetLoadBalancerAnnotationType(ref) != LBTypeInternal || !hasFinalizer(ref, ILBFinalizerV1) {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	if !deleted {
+		refs = append(refs, svc)
+	}
+	return refs, nil
+}
+
+// listServices returns the Services of the cluster from the informer cache,
+// or from the API server without informers, as with the fake cloud.
+func (g *Cloud) listServices() ([]*v1.Service, error) {
+	if g.serviceLister == nil {
+		list, err := g.client.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		services := make([]*v1.Service, 0, len(list.Items))
+		for i := range list.Items {
+			services = append(services, &list.Items[i])
+		}
+		return services, nil
+	}
+	if !g.serviceListerSynced() {
+		return nil, fmt.Errorf("services not yet synced")
+	}
+	return g.serviceLister.List(labels.Everything())
+}
+
+// isParamsHealthCheckName returns whether name is the name of a health check
+// shared with ILBSharedResources, from makeParamsHealthCheckName.
+func isParamsHealthCheckName(name, clusterID string) bool {
+	hashed, ok := strings.CutPrefix(name, fmt.Sprintf("k8s-%s-node-", clusterID))
+	if !ok || len(hashed) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(hashed)
+	return err == nil
+}
+
+// releaseSharedInternalHealthCheckFirewall deletes the cluster-scoped health
+// check firewall once no shared health check remains, after
+// ILBSharedResources is disabled. The load balancers not yet synced keep
+// their shared health check, and need the firewall until then.
+func (g *Cloud) releaseSharedInternalHealthCheckFirewall(svc *v1.Service, clusterID string) error {
+	hcs, err := g.ListHealthChecks()
+	if err != nil {
+		return err
+	}
+	for _, hc := range hcs {
+		if isParamsHealthCheckName(hc.Name, clusterID) {
+			klog.V(2).Infof("releaseSharedInternalHealthCheckFirewall(%v): shared health check %v remains", clusterID, hc.Name)
+			return nil
+		}
+	}
+	return g.deleteInternalFirewall(svc, makeSharedInternalHealthCheckFirewallName(clusterID))
+}
+
+// sharedHealthCheckReferenced returns whether one of refs uses the shared
+// health check hcName.
+func sharedHealthCheckReferenced(hcName, clusterID string, refs []*v1.Service) bool {
+	for _, ref := range refs {
+		params, err := getHealthCheckParams(ref)
+		if err != nil {
+			continue
+		}
+		// The load balancer name only names the health checks not shared.
+		if name, shared := internalHealthCheckName(ref, "", clusterID, params, true); shared && name == hcName {
+			return true
+		}
+	}
+	return false
+}
+
+// internalHealthCheckPorts returns the sorted node ports health checked by
+// the internal load balancers of refs.
+func internalHealthCheckPorts(refs []*v1.Service) []string {
+	ports := sets.NewString()
+	for _, ref := range refs {
+		port := GetNodesHealthCheckPort()
+		if servicehelpers.RequestsOnlyLocalTraffic(ref) {
+			_, port = servicehelpers.GetServiceHealthCheckPathPort(ref)
+		}
+		if port != 0 {
+			ports.Insert(strconv.Itoa(int(port)))
+		}
+	}
+	return ports.List()
+}
+
+// ensureSharedInternalHealthCheckFirewall allows the health checks of the
+// internal load balancers of refs with the cluster-scoped firewall, and
+// deletes it if refs is empty. Without nodes, as when deleting a load
+// balancer, only the ports of an existing firewall are updated.
+func (g *Cloud) ensureSharedInternalHealthCheckFirewall(svc *v1.Service, clusterID string, refs []*v1.Service, nodes []*v1.Node) error {
+	fwName := makeSharedInternalHealthCheckFirewallName(clusterID)
+	ports := internalHealthCheckPorts(refs)
+	if len(ports) == 0 {
+		klog.V(2).Infof("ensureSharedInternalHealthCheckFirewall(%v): no internal load balancer references the firewall, deleting it", fwName)
+		return g.deleteInternalFirewall(svc, fwName)
+	}
+	if nodes != nil {
+		return g.ensureInternalFirewall(svc, fwName, "", "", L4LoadBalancerSrcRanges(), ports, v1.ProtocolTCP, nodes, "")
+	}
+
+	if g.skipFirewallManagement {
+		// The ports are in the commands raised for the remaining services.
+		return nil
+	}
+	existingFirewall, err := g.GetFirewall(fwName)
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	expectedFirewall := *existingFirewall
+	expectedFirewall.Allowed = []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: ports}}
+	if firewallRuleEqual(&expectedFirewall, existingFirewall) {
+		return nil
+	}
+	klog.V(2).Infof("ensureSharedInternalHealthCheckFirewall(%v): updating firewall ports to %v", fwName, ports)
+	err = g.PatchFirewall(&expectedFirewall)
+	if err != nil && isForbidden(err) && g.OnXPN() {
+		klog.V(2).Infof("ensureSharedInternalHealthCheckFirewall(%v): do not have permission to update firewall rule (on XPN). Raising event.", fwName)
+		g.raiseFirewallChangeNeededEvent(svc, FirewallToGCloudUpdateCmd(&expectedFirewall, g.NetworkProjectID()))
+		return nil
+	}
+	return err
+}
+
+// teardownSharedInternalHealthCheck deletes the health check of the internal
+// load balancer of the deleted Service unless one of refs shares it, and
+// drops its port from the cluster-scoped health check firewall.
+func (g *Cloud) teardownSharedInternalHealthCheck(svc *v1.Service, hcName, clusterID string, shared bool, refs []*v1.Service) error {
+	if shared && sharedHealthCheckReferenced(hcName, clusterID, refs) {
+		klog.V(2).Infof("teardownSharedInternalHealthCheck(%v): health check still referenced by other services", hcName)
+	} else {
+		err := g.DeleteHealthCheck(hcName)
+		if err != nil && !isNotFound(err) && !isInUsedByError(err) {
+			return fmt.Errorf("failed to delete health check: %v, err: %w", hcName, err)
+		}
+		// The IPv6 health check firewall is not shared with other health checks.
+		if err == nil && featureEnabled(DualStackLoadBalancers) {
+			if err := g.deleteInternalFirewall(svc, makeHealthCheckFirewallNameFromHC(hcName)+ipv6Suffix); err != nil {
+				return err
+			}
+		}
+	}
+	// Delete the firewall the health check had before sharing resources.
+	if err := g.deleteInternalFirewall(svc, makeHealthCheckFirewallNameFromHC(hcName)); err != nil {
+		return err
+	}
+	return g.ensureSharedInternalHealthCheckFirewall(svc, clusterID, refs, nil)
+}
+
+// deleteInternalFirewall deletes the firewall, raising an event instead when
+// lacking the permission on XPN clusters or skipping firewall management.
+func (g *Cloud) deleteInternalFirewall(svc *v1.Service, fwName string) error {
+	if g.skipFirewallChange(svc, fwName, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID())) {
+		return nil
+	}
+	if err := ignoreNotFound(g.DeleteFirewall(fwName)); err != nil {
+		if isForbidden(err) && g.OnXPN() {
+			klog.V(2).Infof("deleteInternalFirewall(%v): could not delete firewall on XPN cluster. Raising event.", fwName)
+			g.raiseFirewallChangeNeededEvent(svc, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID()))
+			return nil
+		}
+		return err
+	}
+	return nil
+}
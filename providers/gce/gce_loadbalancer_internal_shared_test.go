@@ -0,0 +1,213 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestEnsureInternalLoadBalancerSharedResources(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureILBSharedResources})
+
+	var svcs []*v1.Service
+	for _, name := range []string{"svc-a", "svc-b", "svc-local"} {
+		svc := fakeLoadbalancerService(string(LBTypeInternal))
+		svc.Name = name
+		svc.UID = types.UID(name)
+		if name == "svc-local" {
+			svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+			svc.Spec.HealthCheckNodePort = 32000
+		} else {
+			svc.Annotations[ServiceAnnotationHealthCheckInterval] = "10"
+		}
+		svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+		require.NoError(t, err)
+		svcs = append(svcs, svc)
+	}
+
+	params, err := getHealthCheckParams(svcs[0])
+	require.NoError(t, err)
+	hcName := makeParamsHealthCheckName(vals.ClusterID, params)
+	hc, err := gce.GetHealthCheck(hcName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), hc.CheckIntervalSec)
+	for _, svc := range svcs[:2] {
+		_, err = gce.GetHealthCheck(gce.GetLoadBalancerName(context.TODO(), "", svc))
+		assert.True(t, isNotFound(err), "health check of %s should not exist, err: %v", svc.Name, err)
+	}
+
+	fwName := makeSharedInternalHealthCheckFirewallName(vals.ClusterID)
+	fw, err := gce.GetFirewall(fwName)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10256", "32000"}, fw.Allowed[0].Ports)
+	_, err = gce.GetFirewall(makeHealthCheckFirewallName(gce.GetLoadBalancerName(context.TODO(), "", svcs[2]), vals.ClusterID, false))
+	assert.True(t, isNotFound(err), "health check firewall of the Local service should not exist, err: %v", err)
+
+	// Delete the Services as synced by the controller, with the finalizer.
+	for i, svc := range svcs {
+		svcs[i], err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+	}
+
+	// The health check stays while another Service references it.
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svcs[0]))
+	_, err = gce.GetHealthCheck(hcName)
+	assert.NoError(t, err)
+
+	// The port of the Local Service is released.
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svcs[2]))
+	fw, err = gce.GetFirewall(fwName)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10256"}, fw.Allowed[0].Ports)
+
+	// The last reference deletes the shared resources.
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svcs[1]))
+	_, err = gce.GetHealthCheck(hcName)
+	assert.True(t, isNotFound(err), "shared health check should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(fwName)
+	assert.True(t, isNotFound(err), "shared health check firewall should be deleted, err: %v", err)
+}
+
+func TestEnsureInternalLoadBalancerSharedResourcesDisabled(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureILBSharedResources})
+	// The health checks of backend services cannot be deleted.
+	mockGCE := gce.c.(*cloud.MockGCE)
+	mockGCE.MockHealthChecks.DeleteHook = func(ctx context.Context, key *meta.Key, _ *cloud.MockHealthChecks, _ ...cloud.Option) (bool, error) {
+		bss, err := gce.c.RegionBackendServices().List(ctx, vals.Region, filter.None)
+		if err != nil {
+			return true, err
+		}
+		for _, bs := range bss {
+			for _, hc := range bs.HealthChecks {
+				if lastComponent(hc) == key.Name {
+					return true, mock.InUseError
+				}
+			}
+		}
+		return false, nil
+	}
+
+	var svcs []*v1.Service
+	for _, name := range []string{"svc-a", "svc-b"} {
+		svc := fakeLoadbalancerService(string(LBTypeInternal))
+		svc.Name = name
+		svc.UID = types.UID(name)
+		svc.Annotations[ServiceAnnotationHealthCheckInterval] = "10"
+		svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+		require.NoError(t, err)
+		svcs = append(svcs, svc)
+	}
+	params, err := getHealthCheckParams(svcs[0])
+	require.NoError(t, err)
+	hcName := makeParamsHealthCheckName(vals.ClusterID, params)
+	fwName := makeSharedInternalHealthCheckFirewallName(vals.ClusterID)
+
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{})
+	ensure := func(svc *v1.Service) {
+		lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+		fwdRule, err := gce.GetRegionForwardingRule(lbName, vals.Region)
+		require.NoError(t, err)
+		_, err = createInternalLoadBalancer(gce, svc, fwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+		require.NoError(t, err)
+		_, err = gce.GetHealthCheck(makeHealthCheckName(lbName, vals.ClusterID, false))
+		require.NoError(t, err)
+	}
+
+	// The shared resources stay while another load balancer uses them.
+	ensure(svcs[0])
+	_, err = gce.GetHealthCheck(hcName)
+	assert.NoError(t, err)
+	_, err = gce.GetFirewall(fwName)
+	assert.NoError(t, err)
+
+	// The last load balancer releases them.
+	ensure(svcs[1])
+	_, err = gce.GetHealthCheck(hcName)
+	assert.True(t, isNotFound(err), "shared health check should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(fwName)
+	assert.True(t, isNotFound(err), "shared health check firewall should be deleted, err: %v", err)
+}
+
+func TestInternalLoadBalancerReferencesLister(t *testing.T) {
+	t.Parallel()
+
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	var svcs []*v1.Service
+	for _, name := range []string{"svc-a", "svc-b", "svc-c"} {
+		svc := fakeLoadbalancerService(string(LBTypeInternal))
+		svc.Name = name
+		if name != "svc-c" {
+			svc.Finalizers = []string{ILBFinalizerV1}
+		}
+		require.NoError(t, indexer.Add(svc))
+		svcs = append(svcs, svc)
+	}
+	synced := false
+	gce.serviceLister = corelisters.NewServiceLister(indexer)
+	gce.serviceListerSynced = func() bool { return synced }
+
+	_, err = gce.internalLoadBalancerReferences(svcs[0], true)
+	assert.Error(t, err, "references should not be listed before the services are synced")
+
+	synced = true
+	refs, err := gce.internalLoadBalancerReferences(svcs[0], true)
+	require.NoError(t, err)
+	assert.Equal(t, []*v1.Service{svcs[1]}, refs)
+}
+
+func TestMakeParamsHealthCheckName(t *testing.T) {
+	p := &healthCheckParams{checkIntervalSec: 8, timeoutSec: 1, healthyThreshold: 1, unhealthyThreshold: 3, requestPath: "/healthz"}
+	q := *p
+	assert.Equal(t, makeParamsHealthCheckName("cluster", p), makeParamsHealthCheckName("cluster", &q))
+	q.requestPath = "/ready"
+	assert.NotEqual(t, makeParamsHealthCheckName("cluster", p), makeParamsHealthCheckName("cluster", &q))
+}
@@ -25,6 +25,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -76,11 +77,11 @@ func TestEnsureInternalBackendServiceUpdates(t *testing.T) {
 
 	sharedBackend := shareBackendService(svc)
 	bsName := makeBackendServiceName(lbName, vals.ClusterID, sharedBackend, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
-	err = gce.ensureInternalBackendService(bsName, "description", svc.Spec.SessionAffinity, cloud.SchemeInternal, "TCP", igLinks, "")
+	err = gce.ensureInternalBackendService(bsName, "description", nil, svc.Spec.SessionAffinity, cloud.SchemeInternal, "TCP", igLinks, "")
 	require.NoError(t, err)
 
 	// Update the Internal Backend Service with a new ServiceAffinity
-	err = gce.ensureInternalBackendService(bsName, "description", v1.ServiceAffinityNone, cloud.SchemeInternal, "TCP", igLinks, "")
+	err = gce.ensureInternalBackendService(bsName, "description", nil, v1.ServiceAffinityNone, cloud.SchemeInternal, "TCP", igLinks, "")
 	require.NoError(t, err)
 
 	bs, err := gce.GetRegionBackendService(bsName, gce.region)
@@ -124,7 +125,7 @@ func TestEnsureInternalBackendServiceGroups(t *testing.T) {
 			sharedBackend := shareBackendService(svc)
 			bsName := makeBackendServiceName(lbName, vals.ClusterID, sharedBackend, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
 
-			err = gce.ensureInternalBackendService(bsName, "description", svc.Spec.SessionAffinity, cloud.SchemeInternal, "TCP", igLinks, "")
+			err = gce.ensureInternalBackendService(bsName, "description", nil, svc.Spec.SessionAffinity, cloud.SchemeInternal, "TCP", igLinks, "")
 			require.NoError(t, err)
 
 			// Update the BackendService with new InstanceGroups
@@ -171,6 +172,45 @@ func TestEnsureInternalInstanceGroupsLimit(t *testing.T) {
 	assert.Equal(t, maxInstancesPerInstanceGroup, len(instances))
 }
 
+func TestEnsureInternalInstanceGroupsBatchesZones(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+
+	var nodeNames []string
+	for i := 0; i < maxInstancesPerInstanceGroupUpdate+5; i++ {
+		nodeNames = append(nodeNames, fmt.Sprintf("node-%d", i))
+	}
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+	secondaryNodes, err := createAndInsertNodes(gce, []string{"secondary-node"}, vals.SecondaryZoneName)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	addCalls := map[string]int{}
+	c := gce.c.(*cloud.MockGCE)
+	c.MockInstanceGroups.AddInstancesHook = func(ctx context.Context, key *meta.Key, req *compute.InstanceGroupsAddInstancesRequest, m *cloud.MockInstanceGroups, options ...cloud.Option) error {
+		mu.Lock()
+		addCalls[key.Zone]++
+		mu.Unlock()
+		assert.LessOrEqual(t, len(req.Instances), maxInstancesPerInstanceGroupUpdate)
+		return mock.AddInstancesHook(ctx, key, req, m, options...)
+	}
+
+	igName := makeInstanceGroupName(vals.ClusterID)
+	igLinks, err := gce.ensureInternalInstanceGroups(igName, append(nodes, secondaryNodes...))
+	require.NoError(t, err)
+	require.Len(t, igLinks, 2)
+	assert.Equal(t, map[string]int{vals.ZoneName: 2, vals.SecondaryZoneName: 1}, addCalls)
+	for zone, want := range map[string]int{vals.ZoneName: len(nodes), vals.SecondaryZoneName: 1} {
+		instances, err := gce.ListInstancesInInstanceGroup(igName, zone, allInstances)
+		require.NoError(t, err)
+		assert.Len(t, instances, want, "zone %s", zone)
+	}
+}
+
 func TestEnsureMultipleInstanceGroups(t *testing.T) {
 	t.Parallel()
 
@@ -464,7 +504,7 @@ func TestEnsureInternalLoadBalancerWithExistingResources(t *testing.T) {
 	sharedBackend := shareBackendService(svc)
 	bsDescription := makeBackendServiceDescription(nm, sharedBackend)
 	bsName := makeBackendServiceName(lbName, vals.ClusterID, sharedBackend, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
-	err = gce.ensureInternalBackendService(bsName, bsDescription, svc.Spec.SessionAffinity, cloud.SchemeInternal, "TCP", igLinks, existingHC.SelfLink)
+	err = gce.ensureInternalBackendService(bsName, bsDescription, nil, svc.Spec.SessionAffinity, cloud.SchemeInternal, "TCP", igLinks, existingHC.SelfLink)
 	require.NoError(t, err)
 
 	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
@@ -806,13 +846,13 @@ func TestClearPreviousInternalResources(t *testing.T) {
 	c := gce.c.(*cloud.MockGCE)
 	require.NoError(t, err)
 
-	hc1, err := gce.ensureInternalHealthCheck("hc1", nm, false, "healthz", 12345)
+	hc1, err := gce.ensureInternalHealthCheck("hc1", nm, false, "healthz", 12345, nil, false)
 	require.NoError(t, err)
 
-	hc2, err := gce.ensureInternalHealthCheck("hc2", nm, false, "healthz", 12346)
+	hc2, err := gce.ensureInternalHealthCheck("hc2", nm, false, "healthz", 12346, nil, false)
 	require.NoError(t, err)
 
-	err = gce.ensureInternalBackendService(svc.ObjectMeta.Name, "", svc.Spec.SessionAffinity, cloud.SchemeInternal, v1.ProtocolTCP, []string{}, "")
+	err = gce.ensureInternalBackendService(svc.ObjectMeta.Name, "", nil, svc.Spec.SessionAffinity, cloud.SchemeInternal, v1.ProtocolTCP, []string{}, "")
 	require.NoError(t, err)
 	backendSvc, err := gce.GetRegionBackendService(svc.ObjectMeta.Name, gce.region)
 	require.NoError(t, err)
@@ -1757,6 +1797,8 @@ func TestEnsureInternalLoadBalancerCustomSubnet(t *testing.T) {
 
 	// Change service to include the global access annotation and request static ip
 	requestedIP := "4.5.6.7"
+	err = gce.c.Subnetworks().Insert(context.TODO(), meta.RegionalKey("test-subnet", gce.region), &compute.Subnetwork{Name: "test-subnet", IpCidrRange: "4.5.6.0/24"})
+	require.NoError(t, err)
 	svc.Annotations[ServiceAnnotationILBSubnet] = "test-subnet"
 	svc.Spec.LoadBalancerIP = requestedIP
 	status, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
@@ -2189,6 +2231,83 @@ func TestEnsureInternalLoadBalancerAllPorts(t *testing.T) {
 	assertInternalLbResourcesDeleted(t, gce, svc, vals, true)
 }
 
+func TestInternalForwardingRulePorts(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc          string
+		ports         []int
+		allPorts      bool
+		wantPorts     []string
+		wantPortRange string
+		wantAllPorts  bool
+	}{
+		{
+			desc:      "few ports",
+			ports:     []int{80, 81, 443},
+			wantPorts: []string{"80", "81", "443"},
+		},
+		{
+			desc:          "contiguous ports in a port range",
+			ports:         []int{8000, 8001, 8002, 8003, 8004, 8005},
+			wantPortRange: "8000-8005",
+		},
+		{
+			desc:         "too many ports not contiguous",
+			ports:        []int{8000, 8001, 8002, 8003, 8004, 8005, 9000},
+			wantAllPorts: true,
+		},
+		{
+			desc:         "all ports requested",
+			ports:        []int{80},
+			allPorts:     true,
+			wantAllPorts: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var svcPorts []v1.ServicePort
+			for _, p := range tc.ports {
+				svcPorts = append(svcPorts, v1.ServicePort{Port: int32(p), Protocol: v1.ProtocolTCP})
+			}
+			ports, portRanges, _ := getPortsAndProtocol(svcPorts)
+			gotPorts, gotPortRange, gotAllPorts := internalForwardingRulePorts(ports, portRanges, tc.allPorts)
+			assert.Equal(t, tc.wantPorts, gotPorts)
+			assert.Equal(t, tc.wantPortRange, gotPortRange)
+			assert.Equal(t, tc.wantAllPorts, gotAllPorts)
+		})
+	}
+}
+
+func TestEnsureInternalLoadBalancerAllPortsAnnotation(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	nodeNames := []string{"test-node-1"}
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationILBAllPorts] = "true"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.True(t, fwdRule.AllPorts)
+	assert.Empty(t, fwdRule.Ports)
+
+	// Without the annotation, the forwarding rule only serves the Service ports.
+	delete(svc.Annotations, ServiceAnnotationILBAllPorts)
+	_, err = createInternalLoadBalancer(gce, svc, fwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	fwdRule, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.False(t, fwdRule.AllPorts)
+	assert.Equal(t, []string{"123"}, fwdRule.Ports)
+}
+
 func TestSubnetNameFromURL(t *testing.T) {
 	cases := []struct {
 		desc     string
@@ -2233,3 +2352,156 @@ func TestSubnetNameFromURL(t *testing.T) {
 	}
 
 }
+
+func TestEnsureInternalLoadBalancerTrafficDistribution(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureTrafficDistribution})
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	preferClose := v1.ServiceTrafficDistributionPreferClose
+	svc.Spec.TrafficDistribution = &preferClose
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bsName := makeBackendServiceName(lbName, vals.ClusterID, false, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
+	bs, err := gce.GetAlphaRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	require.NotNil(t, bs.NetworkPassThroughLbTrafficPolicy)
+	assert.Equal(t, zonalAffinitySpillCrossZone, bs.NetworkPassThroughLbTrafficPolicy.ZonalAffinity.Spillover)
+
+	// Removing the field disables the zonal affinity.
+	svc.Spec.TrafficDistribution = nil
+	existingFwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, existingFwdRule, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+	bs, err = gce.GetAlphaRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, zonalAffinityDisabled, bs.NetworkPassThroughLbTrafficPolicy.ZonalAffinity.Spillover)
+}
+
+func TestEnsureInternalLoadBalancerTrafficDistributionSharedBackend(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureTrafficDistribution})
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Annotations[ServiceAnnotationILBBackendShare] = "true"
+	preferClose := v1.ServiceTrafficDistributionPreferClose
+	svc.Spec.TrafficDistribution = &preferClose
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = createInternalLoadBalancer(gce, svc, nil, nodeNames, vals.ClusterName, vals.ClusterID, vals.ZoneName)
+	require.NoError(t, err)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+	bsName := makeBackendServiceName(lbName, vals.ClusterID, true, cloud.SchemeInternal, "TCP", svc.Spec.SessionAffinity)
+	bs, err := gce.GetAlphaRegionBackendService(bsName, gce.region)
+	require.NoError(t, err)
+	assert.Nil(t, bs.NetworkPassThroughLbTrafficPolicy)
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "TrafficDistributionIgnored")
+}
+
+func TestEnsureInternalLoadBalancerValidatesRequestedIP(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	nodeNames := []string{"test-node-1"}
+	for _, tc := range []struct {
+		desc    string
+		subnet  *compute.Subnetwork
+		address *compute.Address
+		wantErr string
+	}{
+		{
+			desc:   "free IP",
+			subnet: &compute.Subnetwork{Name: "test-subnet", IpCidrRange: "10.1.0.0/24"},
+		},
+		{
+			desc:    "reserved IP",
+			subnet:  &compute.Subnetwork{Name: "test-subnet", IpCidrRange: "10.1.0.0/24"},
+			address: &compute.Address{Name: "user-address", Address: "10.1.0.10", AddressType: string(cloud.SchemeInternal), Status: "RESERVED"},
+		},
+		{
+			desc:    "missing subnetwork",
+			wantErr: `subnetwork "test-subnet" of load balancer IP 10.1.0.10 does not exist in region us-central1`,
+		},
+		{
+			desc:    "proxy-only subnetwork",
+			subnet:  &compute.Subnetwork{Name: "test-subnet", IpCidrRange: "10.1.0.0/24", Purpose: "REGIONAL_MANAGED_PROXY"},
+			wantErr: `subnetwork "test-subnet" of load balancer IP 10.1.0.10 has purpose REGIONAL_MANAGED_PROXY`,
+		},
+		{
+			desc:    "IP outside of the subnetwork",
+			subnet:  &compute.Subnetwork{Name: "test-subnet", IpCidrRange: "10.2.0.0/24"},
+			wantErr: `load balancer IP 10.1.0.10 is not in the range 10.2.0.0/24 of subnetwork "test-subnet"`,
+		},
+		{
+			desc:    "shared IP used by another forwarding rule",
+			subnet:  &compute.Subnetwork{Name: "test-subnet", IpCidrRange: "10.1.0.0/24"},
+			address: &compute.Address{Name: "user-address", Address: "10.1.0.10", AddressType: string(cloud.SchemeInternal), Purpose: sharedLoadBalancerVIPPurpose, Status: "IN_USE", Users: []string{"projects/test-project/regions/us-central1/forwardingRules/other"}},
+		},
+		{
+			desc:    "IP used by another forwarding rule",
+			subnet:  &compute.Subnetwork{Name: "test-subnet", IpCidrRange: "10.1.0.0/24"},
+			address: &compute.Address{Name: "user-address", Address: "10.1.0.10", AddressType: string(cloud.SchemeInternal), Status: "IN_USE", Users: []string{"projects/test-project/regions/us-central1/forwardingRules/other"}},
+			wantErr: `load balancer IP 10.1.0.10 of address "user-address" is already used by projects/test-project/regions/us-central1/forwardingRules/other`,
+		},
+	} {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			gce, err := fakeGCECloud(vals)
+			require.NoError(t, err)
+			recorder := record.NewFakeRecorder(1024)
+			gce.eventRecorder = recorder
+			nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+			require.NoError(t, err)
+			if tc.subnet != nil {
+				require.NoError(t, gce.c.Subnetworks().Insert(context.TODO(), meta.RegionalKey(tc.subnet.Name, gce.region), tc.subnet))
+			}
+			if tc.address != nil {
+				require.NoError(t, gce.ReserveRegionAddress(tc.address, gce.region))
+			}
+
+			svc := fakeLoadbalancerService(string(LBTypeInternal))
+			svc.Annotations[ServiceAnnotationILBSubnet] = "test-subnet"
+			svc.Spec.LoadBalancerIP = "10.1.0.10"
+			svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+			require.NoError(t, err)
+			status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+			lbName := gce.GetLoadBalancerName(context.TODO(), "", svc)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				require.Len(t, status.Ingress, 1)
+				assert.Equal(t, "10.1.0.10", status.Ingress[0].IP)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+			_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+			assert.True(t, isNotFound(err), "forwarding rule should not be created, err: %v", err)
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			assert.Contains(t, strings.Join(events, "\n"), "Warning "+invalidLoadBalancerIPReason+" "+tc.wantErr)
+		})
+	}
+}
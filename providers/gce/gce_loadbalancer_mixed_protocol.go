@@ -0,0 +1,220 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+)
+
+// sharedLoadBalancerVIPPurpose is the purpose of the internal addresses
+// shared by the forwarding rules of a mixed protocol load balancer.
+const sharedLoadBalancerVIPPurpose = "SHARED_LOADBALANCER_VIP"
+
+// mixedProtocolSupported returns whether the load balancer of the Service
+// can serve ports of both TCP and UDP, with a companion forwarding rule on
+// the same IP address. Load balancers with NEG, EXTERNAL_MANAGED or L4 RBS
+// backends are not supported.
+func (g *Cloud) mixedProtocolSupported(svc *v1.Service) bool {
+	if !g.AlphaFeatureGate.Enabled(AlphaFeatureMixedProtocolLB) {
+		return false
+	}
+	if getSvcScheme(svc) == cloud.SchemeInternal {
+		return true
+	}
+	return !usesL4RBS(svc, nil) && !g.usesNEGExternalLB(svc) && !g.usesExternalManagedLB(svc)
+}
+
+// loadBalancerPorts splits the ports of the Service between the ones with
+// the protocol of its first port, served by its load balancer, and the other
+// ones, served by its companion forwarding rule. companionPorts is empty
+// unless the Service mixes protocols and they are supported.
+func (g *Cloud) loadBalancerPorts(svc *v1.Service) (ports, companionPorts []v1.ServicePort) {
+	if len(svc.Spec.Ports) == 0 || !g.mixedProtocolSupported(svc) {
+		return svc.Spec.Ports, nil
+	}
+	protocol := svc.Spec.Ports[0].Protocol
+	for _, port := range svc.Spec.Ports {
+		if port.Protocol == protocol {
+			ports = append(ports, port)
+		} else {
+			companionPorts = append(companionPorts, port)
+		}
+	}
+	return ports, companionPorts
+}
+
+// mixedProtocolName returns the name of the companion resources of the load
+// balancer serving the ports of protocol.
+func mixedProtocolName(loadBalancerName string, protocol v1.Protocol) string {
+	return loadBalancerName + "-" + strings.ToLower(string(protocol))
+}
+
+// ensureInternalMixedProtocolLoadBalancer ensures the forwarding rule,
+// backend service and firewall serving the companion ports of the internal
+// load balancer newFwdRule on its IP address, with the same backends and
+// health check.
+func (g *Cloud) ensureInternalMixedProtocolLoadBalancer(svc *v1.Service, newFwdRule *compute.ForwardingRule, ipAddress string, companionPorts []v1.ServicePort, clusterID, bsDescription string, bsMetadata *backendServiceMetadata, igLinks []string, hcLink string, nodes []*v1.Node) error {
+	ports, portRanges, protocol := getPortsAndProtocol(companionPorts)
+	if protocol != v1.ProtocolTCP && protocol != v1.ProtocolUDP {
+		return fmt.Errorf("Invalid protocol %s, only TCP and UDP are supported", string(protocol))
+	}
+	name := mixedProtocolName(newFwdRule.Name, protocol)
+	scheme := cloud.SchemeInternal
+	bsName := makeBackendServiceName(name, clusterID, shareBackendService(svc), scheme, protocol, svc.Spec.SessionAffinity)
+	if err := g.ensureInternalBackendService(bsName, bsDescription, bsMetadata, svc.Spec.SessionAffinity, scheme, protocol, igLinks, hcLink); err != nil {
+		return err
+	}
+
+	fwdRule := *newFwdRule
+	fwdRule.Name = name
+	fwdRule.IPAddress = ipAddress
+	fwdRule.BackendService = g.getBackendServiceLink(bsName)
+	fwdRule.IPProtocol = string(protocol)
+	fwdRule.Ports, fwdRule.PortRange, fwdRule.AllPorts = internalForwardingRulePorts(ports, portRanges, getILBOptions(svc).AllPorts)
+	existingFwdRule, err := g.GetRegionForwardingRule(name, g.region)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if err := g.ensureInternalForwardingRule(existingFwdRule, &fwdRule); err != nil {
+		return err
+	}
+
+	nm := types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}
+	sourceRanges, err := g.loadBalancerSourceRanges(svc)
+	if err != nil {
+		return err
+	}
+	return g.ensureInternalFirewall(svc, MakeFirewallName(name), makeFirewallDescription(nm.String(), ipAddress), ipAddress, sourceRanges.StringSlice(), portRanges, protocol, nodes, "")
+}
+
+// ensureInternalMixedProtocolLoadBalancerDeleted deletes the companion
+// forwarding rules of the internal load balancer, but the one serving the
+// ports of keep, along with their backend services and firewalls.
+func (g *Cloud) ensureInternalMixedProtocolLoadBalancerDeleted(svc *v1.Service, loadBalancerName, clusterID string, keep v1.Protocol) error {
+	for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP} {
+		if protocol == keep {
+			continue
+		}
+		name := mixedProtocolName(loadBalancerName, protocol)
+		if _, err := g.GetRegionForwardingRule(name, g.region); err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return err
+		}
+		klog.V(2).Infof("ensureInternalMixedProtocolLoadBalancerDeleted(%v): deleting forwarding rule %v", loadBalancerName, name)
+		if err := ignoreNotFound(g.DeleteRegionForwardingRule(name, g.region)); err != nil {
+			return err
+		}
+		bsName := makeBackendServiceName(name, clusterID, shareBackendService(svc), cloud.SchemeInternal, protocol, svc.Spec.SessionAffinity)
+		if err := g.teardownInternalBackendService(bsName); err != nil {
+			return err
+		}
+		if err := g.deleteInternalFirewall(svc, MakeFirewallName(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureExternalMixedProtocolLoadBalancer ensures the forwarding rule and
+// firewall serving the companion ports of the external load balancer on its
+// IP address, with its target pool. The IP address must stay reserved while
+// it is shared by both forwarding rules.
+func (g *Cloud) ensureExternalMixedProtocolLoadBalancer(svc *v1.Service, loadBalancerName, clusterID, ipAddress string, companionPorts []v1.ServicePort, sourceRanges utilnet.IPNetSet, hosts []*gceInstance, netTier cloud.NetworkTier) error {
+	name := mixedProtocolName(loadBalancerName, companionPorts[0].Protocol)
+	serviceName := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}.String()
+	fwExists, fwNeedsUpdate, err := g.firewallNeedsUpdate(name, serviceName, ipAddress, companionPorts, sourceRanges)
+	if err != nil {
+		return err
+	}
+	if fwNeedsUpdate {
+		desc := makeFirewallDescription(serviceName, ipAddress)
+		if fwExists {
+			err = g.updateFirewall(svc, MakeFirewallName(name), desc, ipAddress, sourceRanges, companionPorts, hosts)
+		} else {
+			err = g.createFirewall(svc, MakeFirewallName(name), desc, ipAddress, sourceRanges, companionPorts, hosts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	exists, needsUpdate, _, err := g.forwardingRuleNeedsUpdate(name, g.region, ipAddress, companionPorts)
+	if err != nil {
+		return err
+	}
+	if exists && needsUpdate {
+		klog.Infof("ensureExternalMixedProtocolLoadBalancer(%s): Deleting forwarding rule %s.", loadBalancerName, name)
+		if err := ignoreNotFound(g.DeleteRegionForwardingRule(name, g.region)); err != nil {
+			return err
+		}
+	}
+	if needsUpdate {
+		klog.Infof("ensureExternalMixedProtocolLoadBalancer(%s): Creating forwarding rule %s, IP %s.", loadBalancerName, name, ipAddress)
+		return createForwardingRule(g, name, serviceName, clusterID, g.region, ipAddress, g.targetPoolURL(loadBalancerName), companionPorts, netTier)
+	}
+	return nil
+}
+
+// ensureExternalMixedProtocolLoadBalancerDeleted deletes the companion
+// forwarding rules of the external load balancer, but the one serving the
+// ports of keep, along with their firewalls. It returns whether any was
+// deleted.
+func (g *Cloud) ensureExternalMixedProtocolLoadBalancerDeleted(svc *v1.Service, loadBalancerName string, keep v1.Protocol) (bool, error) {
+	deleted := false
+	for _, protocol := range []v1.Protocol{v1.ProtocolTCP, v1.ProtocolUDP} {
+		if protocol == keep {
+			continue
+		}
+		name := mixedProtocolName(loadBalancerName, protocol)
+		if _, err := g.GetRegionForwardingRule(name, g.region); err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return deleted, err
+		}
+		klog.Infof("ensureExternalMixedProtocolLoadBalancerDeleted(%s): Deleting forwarding rule %s.", loadBalancerName, name)
+		if err := ignoreNotFound(g.DeleteRegionForwardingRule(name, g.region)); err != nil {
+			return deleted, err
+		}
+		deleted = true
+		fwName := MakeFirewallName(name)
+		if g.skipFirewallChange(svc, fwName, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID())) {
+			continue
+		}
+		if err := ignoreNotFound(g.DeleteFirewall(fwName)); err != nil {
+			if isForbidden(err) && g.OnXPN() {
+				g.raiseFirewallChangeNeededEvent(svc, FirewallToGCloudDeleteCmd(fwName, g.NetworkProjectID()))
+				continue
+			}
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,210 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadBalancerPorts(t *testing.T) {
+	t.Parallel()
+
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Spec.Ports = []v1.ServicePort{
+		{Protocol: v1.ProtocolUDP, Port: 53},
+		{Protocol: v1.ProtocolTCP, Port: 80},
+		{Protocol: v1.ProtocolUDP, Port: 5353},
+	}
+
+	ports, companionPorts := gce.loadBalancerPorts(svc)
+	assert.Equal(t, svc.Spec.Ports, ports)
+	assert.Empty(t, companionPorts)
+
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureMixedProtocolLB})
+	ports, companionPorts = gce.loadBalancerPorts(svc)
+	assert.Equal(t, []v1.ServicePort{svc.Spec.Ports[0], svc.Spec.Ports[2]}, ports)
+	assert.Equal(t, []v1.ServicePort{svc.Spec.Ports[1]}, companionPorts)
+	assert.Equal(t, "a1234-tcp", mixedProtocolName("a1234", companionPorts[0].Protocol))
+
+	// Load balancers with RBS backends are handled by other controllers.
+	rbsSvc := fakeLoadbalancerService("")
+	rbsSvc.Spec.Ports = svc.Spec.Ports
+	rbsSvc.Annotations[RBSAnnotationKey] = RBSEnabled
+	assert.False(t, gce.mixedProtocolSupported(rbsSvc))
+	_, companionPorts = gce.loadBalancerPorts(rbsSvc)
+	assert.Empty(t, companionPorts)
+}
+
+func TestEnsureInternalLoadBalancerMixedProtocols(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureMixedProtocolLB})
+	nodeNames := []string{"test-node-1"}
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService(string(LBTypeInternal))
+	svc.Spec.Ports = []v1.ServicePort{
+		{Protocol: v1.ProtocolTCP, Port: 80},
+		{Protocol: v1.ProtocolUDP, Port: 53},
+	}
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	require.Len(t, status.Ingress, 1)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, "TCP", fwdRule.IPProtocol)
+	assert.Equal(t, []string{"80"}, fwdRule.Ports)
+	udpFwdRule, err := gce.GetRegionForwardingRule(lbName+"-udp", gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, "UDP", udpFwdRule.IPProtocol)
+	assert.Equal(t, []string{"53"}, udpFwdRule.Ports)
+	assert.Equal(t, fwdRule.IPAddress, udpFwdRule.IPAddress)
+	assert.Equal(t, status.Ingress[0].IP, udpFwdRule.IPAddress)
+	bs, err := gce.GetRegionBackendService(getNameFromLink(udpFwdRule.BackendService), gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, "UDP", bs.Protocol)
+	assert.Len(t, bs.Backends, 1)
+	fw, err := gce.GetFirewall(MakeFirewallName(lbName + "-udp"))
+	require.NoError(t, err)
+	require.Len(t, fw.Allowed, 1)
+	assert.Equal(t, "udp", fw.Allowed[0].IPProtocol)
+	assert.Equal(t, []string{"53"}, fw.Allowed[0].Ports)
+	fw, err = gce.GetFirewall(MakeFirewallName(lbName))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"80"}, fw.Allowed[0].Ports)
+	// The forwarding rules share the reserved address.
+	addr, err := gce.GetRegionAddress(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, sharedLoadBalancerVIPPurpose, addr.Purpose)
+	assert.Equal(t, fwdRule.IPAddress, addr.Address)
+
+	// Dropping the UDP ports deletes the companion resources.
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	_, err = gce.GetRegionForwardingRule(lbName+"-udp", gce.region)
+	assert.True(t, isNotFound(err), "companion forwarding rule should be deleted, err: %v", err)
+	_, err = gce.GetRegionBackendService(bs.Name, gce.region)
+	assert.True(t, isNotFound(err), "companion backend service should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName + "-udp"))
+	assert.True(t, isNotFound(err), "companion firewall should be deleted, err: %v", err)
+	_, err = gce.GetRegionAddress(lbName, gce.region)
+	assert.True(t, isNotFound(err), "address should be released, err: %v", err)
+	fwdRule, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, status.Ingress[0].IP, fwdRule.IPAddress)
+
+	// Deleting the load balancer deletes the companion resources.
+	svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Protocol: v1.ProtocolUDP, Port: 53})
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svc))
+	_, err = gce.GetRegionForwardingRule(lbName+"-udp", gce.region)
+	assert.True(t, isNotFound(err), "companion forwarding rule should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName + "-udp"))
+	assert.True(t, isNotFound(err), "companion firewall should be deleted, err: %v", err)
+	_, err = gce.GetRegionAddress(lbName, gce.region)
+	assert.True(t, isNotFound(err), "address should be deleted, err: %v", err)
+}
+
+func TestEnsureExternalLoadBalancerMixedProtocols(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureMixedProtocolLB})
+	nodeNames := []string{"test-node-1"}
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	svc.Spec.Ports = []v1.ServicePort{
+		{Protocol: v1.ProtocolUDP, Port: 53},
+		{Protocol: v1.ProtocolTCP, Port: 80},
+		{Protocol: v1.ProtocolTCP, Port: 443},
+	}
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	require.Len(t, status.Ingress, 1)
+
+	lbName := gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc)
+	fwdRule, err := gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, "UDP", fwdRule.IPProtocol)
+	assert.Equal(t, "53-53", fwdRule.PortRange)
+	tcpFwdRule, err := gce.GetRegionForwardingRule(lbName+"-tcp", gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, "TCP", tcpFwdRule.IPProtocol)
+	assert.Equal(t, "80-443", tcpFwdRule.PortRange)
+	assert.Equal(t, fwdRule.Target, tcpFwdRule.Target)
+	assert.Equal(t, status.Ingress[0].IP, tcpFwdRule.IPAddress)
+	fw, err := gce.GetFirewall(MakeFirewallName(lbName + "-tcp"))
+	require.NoError(t, err)
+	require.Len(t, fw.Allowed, 1)
+	assert.Equal(t, "tcp", fw.Allowed[0].IPProtocol)
+	assert.ElementsMatch(t, []string{"80", "443"}, fw.Allowed[0].Ports)
+	// The forwarding rules share the reserved address.
+	addr, err := gce.GetRegionAddress(lbName, gce.region)
+	require.NoError(t, err)
+	assert.Equal(t, status.Ingress[0].IP, addr.Address)
+
+	// Dropping the TCP ports deletes the companion resources and releases
+	// the address.
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	_, err = gce.GetRegionForwardingRule(lbName+"-tcp", gce.region)
+	assert.True(t, isNotFound(err), "companion forwarding rule should be deleted, err: %v", err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName + "-tcp"))
+	assert.True(t, isNotFound(err), "companion firewall should be deleted, err: %v", err)
+	_, err = gce.GetRegionAddress(lbName, gce.region)
+	assert.True(t, isNotFound(err), "address should be released, err: %v", err)
+
+	// Deleting the load balancer deletes the companion resources.
+	svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Protocol: v1.ProtocolTCP, Port: 80})
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	_, err = gce.GetRegionForwardingRule(lbName+"-tcp", gce.region)
+	require.NoError(t, err)
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svc))
+	_, err = gce.GetRegionForwardingRule(lbName+"-tcp", gce.region)
+	assert.True(t, isNotFound(err), "companion forwarding rule should be deleted, err: %v", err)
+	_, err = gce.GetTargetPool(lbName, gce.region)
+	assert.True(t, isNotFound(err), "target pool should be deleted, err: %v", err)
+}
@@ -23,13 +23,86 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	cloudprovider "k8s.io/cloud-provider"
+	servicehelper "k8s.io/cloud-provider/service/helpers"
 )
 
+// maxLoadBalancerNamePrefixLength keeps the longest load balancer resource
+// name, k8s-fw-{prefix}{load balancer name}-ipv6, within the 63 characters
+// allowed by GCE.
+const maxLoadBalancerNamePrefixLength = 16
+
+var loadBalancerNamePrefixRegexp = regexp.MustCompile(`^[a-z][-a-z0-9]*$`)
+
+// validateLoadBalancerNamePrefix validates the load-balancer-name-prefix
+// cloud config value.
+func validateLoadBalancerNamePrefix(prefix string) error {
+	if !isValidLoadBalancerNamePrefix(prefix) {
+		return fmt.Errorf("invalid load-balancer-name-prefix %q, must be at most %d lowercase letters, digits or dashes starting with a letter", prefix, maxLoadBalancerNamePrefixLength)
+	}
+	return nil
+}
+
+// validateLoadBalancerNamePrefixAnnotation validates the load balancer name
+// prefix the Service was annotated with, if any.
+func validateLoadBalancerNamePrefixAnnotation(svc *v1.Service) error {
+	if prefix, ok := svc.Annotations[ServiceAnnotationLoadBalancerNamePrefix]; ok && !isValidLoadBalancerNamePrefix(prefix) {
+		return fmt.Errorf("invalid annotation %s=%q, must be at most %d lowercase letters, digits or dashes starting with a letter", ServiceAnnotationLoadBalancerNamePrefix, prefix, maxLoadBalancerNamePrefixLength)
+	}
+	return nil
+}
+
+func isValidLoadBalancerNamePrefix(prefix string) bool {
+	return prefix == "" || len(prefix) <= maxLoadBalancerNamePrefixLength && loadBalancerNamePrefixRegexp.MatchString(prefix)
+}
+
+// loadBalancerName returns the name of the load balancer of the Service,
+// which names its forwarding rules, target pools, health checks and
+// firewalls: the default name of the Service after its prefix.
+func (g *Cloud) loadBalancerName(svc *v1.Service) string {
+	return g.loadBalancerNamePrefix(svc) + cloudprovider.DefaultLoadBalancerName(svc)
+}
+
+// loadBalancerNamePrefix returns the prefix of the load balancer name of the
+// Service: the one it was provisioned with, none for the load balancers
+// provisioned before it was recorded, or else the configured one. Invalid
+// annotated prefixes, which the syncs reject, are ignored.
+func (g *Cloud) loadBalancerNamePrefix(svc *v1.Service) string {
+	if prefix, ok := svc.Annotations[ServiceAnnotationLoadBalancerNamePrefix]; ok && isValidLoadBalancerNamePrefix(prefix) {
+		return prefix
+	}
+	if len(svc.Status.LoadBalancer.Ingress) > 0 {
+		return ""
+	}
+	return g.lbNamePrefix
+}
+
+// ensureLoadBalancerNamePrefixAnnotation records the configured load balancer
+// name prefix on the Service before its load balancer is provisioned with it.
+func (g *Cloud) ensureLoadBalancerNamePrefixAnnotation(svc *v1.Service) error {
+	if g.lbNamePrefix == "" || g.dryRun || g.client == nil {
+		return nil
+	}
+	if _, ok := svc.Annotations[ServiceAnnotationLoadBalancerNamePrefix]; ok || len(svc.Status.LoadBalancer.Ingress) > 0 {
+		return nil
+	}
+	updated := svc.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[ServiceAnnotationLoadBalancerNamePrefix] = g.lbNamePrefix
+	if _, err := servicehelper.PatchService(g.client.CoreV1(), svc, updated); err != nil {
+		return fmt.Errorf("failed to set annotation %q on service %s/%s: %v", ServiceAnnotationLoadBalancerNamePrefix, svc.Namespace, svc.Name, err)
+	}
+	return nil
+}
+
 // Internal Load Balancer
 
 // Instance groups remain legacy named to stay consistent with ingress
@@ -73,6 +146,24 @@ func makeHealthCheckName(loadBalancerName, clusterID string, shared bool) string
 	return loadBalancerName
 }
 
+// makeParamsHealthCheckName returns the name of the health check shared by the
+// internal load balancers with the health check parameters p.
+func makeParamsHealthCheckName(clusterID string, p *healthCheckParams) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%d/%d/%d/%d/%s", p.checkIntervalSec, p.timeoutSec, p.healthyThreshold, p.unhealthyThreshold, p.requestPath)
+	if p.proxyHeader != "" {
+		fmt.Fprintf(hash, "/%s", p.proxyHeader)
+	}
+	hashed := hex.EncodeToString(hash.Sum(nil))
+	return fmt.Sprintf("k8s-%s-node-%s", clusterID, hashed[:16])
+}
+
+// makeSharedInternalHealthCheckFirewallName returns the name of the firewall
+// allowing the health checks of all the internal load balancers.
+func makeSharedInternalHealthCheckFirewallName(clusterID string) string {
+	return fmt.Sprintf("k8s-%s-ilb-hc", clusterID)
+}
+
 func makeHealthCheckFirewallNameFromHC(healthCheckName string) string {
 	return healthCheckName + "-hc"
 }
@@ -98,6 +189,16 @@ func makeServiceDescription(serviceName string) string {
 	return fmt.Sprintf(`{"kubernetes.io/service-name":"%s"}`, serviceName)
 }
 
+// makeClusterServiceDescription is used to generate descriptions for the
+// forwarding rules and target pools, which also record the cluster owning
+// them so that they are only ever garbage collected by that cluster.
+func makeClusterServiceDescription(serviceName, clusterID string) string {
+	if clusterID == "" {
+		return makeServiceDescription(serviceName)
+	}
+	return fmt.Sprintf(`{"kubernetes.io/service-name":"%s","kubernetes.io/cluster-id":"%s"}`, serviceName, clusterID)
+}
+
 // MakeNodesHealthCheckName returns name of the health check resource used by
 // the GCE load balancers (l4) for performing health checks on nodes.
 func MakeNodesHealthCheckName(clusterID string) string {
@@ -0,0 +1,160 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	servicehelper "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// L4 load balancer sync operations, used as the "operation" label.
+	l4LBSyncOperationEnsure = "ensure"
+	l4LBSyncOperationUpdate = "update"
+	l4LBSyncOperationDelete = "delete"
+
+	// L4 load balancer sync results, used as the "result" label and as the
+	// value of ServiceAnnotationLoadBalancerSyncStatus.
+	l4LBSyncResultSuccess = "Success"
+	l4LBSyncResultError   = "Error"
+)
+
+var (
+	l4LBSyncMetricLabels = []string{
+		"namespace", // namespace of the Service.
+		"name",      // name of the Service.
+		"operation", // ensure, update or delete.
+	}
+
+	l4LBServiceSyncCount = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cloudprovider_gce_l4_lb_service_sync_total",
+			Help:           "Number of L4 load balancer syncs per Service, partitioned by result",
+			StabilityLevel: metrics.ALPHA,
+		},
+		append(l4LBSyncMetricLabels, "result"),
+	)
+
+	// l4LBServiceSyncDuration is labeled by a short hash of the Service
+	// instead of its namespace and name, so that each Service adds a single
+	// compact label value to the bucket series of the histogram. The hash
+	// does not hide the Service: the counter and gauge above carry its name.
+	l4LBServiceSyncDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "cloudprovider_gce_l4_lb_service_sync_duration_seconds",
+			Help:           "Duration of the L4 load balancer syncs per Service, identified by the first 8 hex digits of the SHA-256 of its namespace/name, partitioned by result",
+			Buckets:        metrics.ExponentialBuckets(0.5, 2, 12),
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"service_hash", "operation", "result"},
+	)
+
+	l4LBServiceLastSyncDuration = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cloudprovider_gce_l4_lb_service_last_sync_duration_seconds",
+			Help:           "Duration of the last L4 load balancer sync per Service",
+			StabilityLevel: metrics.ALPHA,
+		},
+		l4LBSyncMetricLabels,
+	)
+)
+
+// init registers the per-Service L4 load balancer sync metrics.
+func init() {
+	legacyregistry.MustRegister(l4LBServiceSyncCount)
+	legacyregistry.MustRegister(l4LBServiceLastSyncDuration)
+	legacyregistry.MustRegister(l4LBServiceSyncDuration)
+}
+
+// observeL4LBSync records the outcome of an L4 load balancer sync for the
+// given service. Syncs that were handed off to another controller are not
+// recorded.
+func (g *Cloud) observeL4LBSync(svc *v1.Service, operation string, start time.Time, err error) {
+	if errors.Is(err, cloudprovider.ImplementedElsewhere) {
+		return
+	}
+
+	result := l4LBSyncResultSuccess
+	if err != nil {
+		result = l4LBSyncResultError
+	}
+	duration := time.Since(start).Seconds()
+	l4LBServiceSyncCount.WithLabelValues(svc.Namespace, svc.Name, operation, result).Inc()
+	l4LBServiceLastSyncDuration.WithLabelValues(svc.Namespace, svc.Name, operation).Set(duration)
+	l4LBServiceSyncDuration.WithLabelValues(l4LBServiceHash(svc), operation, result).Observe(duration)
+
+	if operation == l4LBSyncOperationDelete {
+		if err == nil {
+			deleteL4LBSyncMetrics(svc)
+		}
+		return
+	}
+	if g.AlphaFeatureGate.Enabled(AlphaFeatureL4LBSyncStatusAnnotation) {
+		g.ensureL4LBSyncStatusAnnotation(svc, result)
+	}
+}
+
+// deleteL4LBSyncMetrics drops all sync metric series for the given service.
+func deleteL4LBSyncMetrics(svc *v1.Service) {
+	hash := l4LBServiceHash(svc)
+	for _, operation := range []string{l4LBSyncOperationEnsure, l4LBSyncOperationUpdate, l4LBSyncOperationDelete} {
+		labels := map[string]string{"namespace": svc.Namespace, "name": svc.Name, "operation": operation}
+		l4LBServiceLastSyncDuration.Delete(labels)
+		for _, result := range []string{l4LBSyncResultSuccess, l4LBSyncResultError} {
+			labels["result"] = result
+			l4LBServiceSyncCount.Delete(labels)
+			l4LBServiceSyncDuration.Delete(map[string]string{"service_hash": hash, "operation": operation, "result": result})
+		}
+	}
+}
+
+// l4LBServiceHash returns the first 8 hex digits of the SHA-256 of the
+// namespace/name of the Service, e.g. as printed by
+// `echo -n default/my-svc | sha256sum | cut -c1-8`.
+func l4LBServiceHash(svc *v1.Service) string {
+	sum := sha256.Sum256([]byte(svc.Namespace + "/" + svc.Name))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// ensureL4LBSyncStatusAnnotation mirrors the result of the last sync into the
+// service annotations. Only the result is mirrored, and only when it changes,
+// since every annotation update triggers another sync of the service.
+func (g *Cloud) ensureL4LBSyncStatusAnnotation(svc *v1.Service, result string) {
+	if svc.Annotations[ServiceAnnotationLoadBalancerSyncStatus] == result {
+		return
+	}
+	updated := svc.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[ServiceAnnotationLoadBalancerSyncStatus] = result
+	if _, err := servicehelper.PatchService(g.client.CoreV1(), svc, updated); err != nil {
+		klog.Warningf("Failed to set annotation %q on service %s/%s: %v", ServiceAnnotationLoadBalancerSyncStatus, svc.Namespace, svc.Name, err)
+	}
+}
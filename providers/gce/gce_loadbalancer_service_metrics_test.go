@@ -0,0 +1,84 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestObserveL4LBSync(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.AlphaFeatureGate = NewAlphaFeatureGate([]string{AlphaFeatureL4LBSyncStatusAnnotation})
+
+	nodeNames := []string{"test-node-1"}
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+
+	apiService := fakeLoadbalancerService(string(LBTypeInternal))
+	apiService.Namespace = "sync-metrics"
+	apiService, err = gce.client.CoreV1().Services(apiService.Namespace).Create(context.TODO(), apiService, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, apiService, nodes)
+	require.NoError(t, err)
+
+	count, err := testutil.GetCounterMetricValue(l4LBServiceSyncCount.WithLabelValues(apiService.Namespace, apiService.Name, l4LBSyncOperationEnsure, l4LBSyncResultSuccess))
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), count)
+	duration, err := testutil.GetGaugeMetricValue(l4LBServiceLastSyncDuration.WithLabelValues(apiService.Namespace, apiService.Name, l4LBSyncOperationEnsure))
+	require.NoError(t, err)
+	assert.Greater(t, duration, float64(0))
+	hash := l4LBServiceHash(apiService)
+	assert.Len(t, hash, 8)
+	syncs, err := testutil.GetHistogramMetricCount(l4LBServiceSyncDuration.WithLabelValues(hash, l4LBSyncOperationEnsure, l4LBSyncResultSuccess))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), syncs)
+
+	apiService, err = gce.client.CoreV1().Services(apiService.Namespace).Get(context.TODO(), apiService.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, l4LBSyncResultSuccess, apiService.Annotations[ServiceAnnotationLoadBalancerSyncStatus])
+
+	err = gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, apiService)
+	require.NoError(t, err)
+
+	count, err = testutil.GetCounterMetricValue(l4LBServiceSyncCount.WithLabelValues(apiService.Namespace, apiService.Name, l4LBSyncOperationEnsure, l4LBSyncResultSuccess))
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), count, "sync metrics should be dropped once the load balancer is deleted")
+	syncs, err = testutil.GetHistogramMetricCount(l4LBServiceSyncDuration.WithLabelValues(hash, l4LBSyncOperationEnsure, l4LBSyncResultSuccess))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), syncs, "sync duration histograms should be dropped once the load balancer is deleted")
+}
+
+func TestL4LBServiceHash(t *testing.T) {
+	svc := fakeLoadbalancerService("")
+	svc.Namespace, svc.Name = "default", "my-svc"
+	// echo -n default/my-svc | sha256sum | cut -c1-8
+	assert.Equal(t, "5a381393", l4LBServiceHash(svc))
+}
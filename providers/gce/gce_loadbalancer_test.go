@@ -73,6 +73,7 @@ func TestEnsureLoadBalancerCreatesExternalLb(t *testing.T) {
 	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, apiService, nodes)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, status.Ingress)
+	assert.Equal(t, v1.LoadBalancerIPModeVIP, *status.Ingress[0].IPMode)
 	assertExternalLbResources(t, gce, apiService, vals, nodeNames)
 }
 
@@ -93,6 +94,7 @@ func TestEnsureLoadBalancerCreatesInternalLb(t *testing.T) {
 	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, apiService, nodes)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, status.Ingress)
+	assert.Equal(t, v1.LoadBalancerIPModeVIP, *status.Ingress[0].IPMode)
 	assertInternalLbResources(t, gce, apiService, vals, nodeNames)
 }
 
@@ -361,6 +363,22 @@ func TestCheckMixedProtocol(t *testing.T) {
 	}
 }
 
+func TestLoadBalancerIPMode(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		scheme string
+		want   v1.LoadBalancerIPMode
+	}{
+		{scheme: "INTERNAL", want: v1.LoadBalancerIPModeVIP},
+		{scheme: "EXTERNAL", want: v1.LoadBalancerIPModeVIP},
+		{scheme: "", want: v1.LoadBalancerIPModeVIP},
+		{scheme: "EXTERNAL_MANAGED", want: v1.LoadBalancerIPModeProxy},
+		{scheme: "INTERNAL_MANAGED", want: v1.LoadBalancerIPModeProxy},
+	} {
+		assert.Equal(t, tc.want, *loadBalancerIPMode(tc.scheme), "scheme %q", tc.scheme)
+	}
+}
+
 func Test_hasLoadBalancerPortsError(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -499,3 +517,117 @@ func TestUpdateLoadBalancerWithLoadBalancerClass(t *testing.T) {
 	err = gce.UpdateLoadBalancer(context.Background(), vals.ClusterName, apiService, nodes)
 	assert.ErrorIs(t, err, cloudprovider.ImplementedElsewhere)
 }
+
+func TestEnsureLoadBalancerClaimedLoadBalancerClass(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.loadBalancerClass = "gce.example.com/l4"
+
+	nodeNames := []string{"test-node-1"}
+	nodes, err := createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+
+	otherClass := "metallb.io/metallb"
+	otherSvc := fakeLoadbalancerService("")
+	otherSvc.Name, otherSvc.UID = "other", "other-uid"
+	otherSvc.Spec.LoadBalancerClass = &otherClass
+	status, err := gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, otherSvc, nodes)
+	assert.ErrorIs(t, err, cloudprovider.ImplementedElsewhere)
+	assert.Empty(t, status)
+	err = gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, otherSvc)
+	assert.ErrorIs(t, err, cloudprovider.ImplementedElsewhere)
+
+	svc := fakeLoadbalancerService("")
+	svc.Spec.LoadBalancerClass = &gce.loadBalancerClass
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	status, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	assert.NotEmpty(t, status.Ingress)
+	lbName := gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc)
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	require.NoError(t, err)
+
+	require.NoError(t, gce.EnsureLoadBalancerDeleted(context.Background(), vals.ClusterName, svc))
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.True(t, isNotFound(err), "forwarding rule should be deleted, err: %v", err)
+}
+
+func TestValidateLoadBalancerNamePrefix(t *testing.T) {
+	t.Parallel()
+
+	for prefix, valid := range map[string]bool{
+		"":                   true,
+		"prod-eu-":           true,
+		"c1":                 true,
+		"1prod":              false,
+		"Prod":               false,
+		"prod_eu":            false,
+		"a-very-long-prefix": false,
+	} {
+		err := validateLoadBalancerNamePrefix(prefix)
+		assert.Equal(t, valid, err == nil, "prefix %q: %v", prefix, err)
+	}
+}
+
+func TestEnsureLoadBalancerInvalidNamePrefixAnnotation(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	svc.Annotations[ServiceAnnotationLoadBalancerNamePrefix] = "Prod_EU-"
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = gce.EnsureLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	assert.ErrorContains(t, err, ServiceAnnotationLoadBalancerNamePrefix)
+	err = gce.UpdateLoadBalancer(context.Background(), vals.ClusterName, svc, nodes)
+	assert.ErrorContains(t, err, ServiceAnnotationLoadBalancerNamePrefix)
+	// The resources are never named with the invalid prefix.
+	assert.Equal(t, cloudprovider.DefaultLoadBalancerName(svc), gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc))
+}
+
+func TestEnsureLoadBalancerNamePrefix(t *testing.T) {
+	t.Parallel()
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.lbNamePrefix = "prod-"
+	nodes, err := createAndInsertNodes(gce, []string{"test-node-1"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	svc := fakeLoadbalancerService("")
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	require.NoError(t, err)
+	lbName := "prod-" + cloudprovider.DefaultLoadBalancerName(svc)
+	assert.Equal(t, lbName, gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc))
+	status, err := gce.EnsureLoadBalancer(context.TODO(), vals.ClusterName, svc, nodes)
+	require.NoError(t, err)
+	_, err = gce.GetRegionForwardingRule(lbName, gce.region)
+	assert.NoError(t, err)
+	_, err = gce.GetFirewall(MakeFirewallName(lbName))
+	assert.NoError(t, err)
+
+	// The prefix is recorded, so that the load balancer keeps its name when
+	// the configured one changes.
+	svc, err = gce.client.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "prod-", svc.Annotations[ServiceAnnotationLoadBalancerNamePrefix])
+	svc.Status.LoadBalancer = *status
+	gce.lbNamePrefix = "staging-"
+	assert.Equal(t, lbName, gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, svc))
+
+	// The load balancers provisioned before a prefix was configured keep
+	// their name.
+	legacy := fakeLoadbalancerService("")
+	legacy.Status.LoadBalancer = *status
+	assert.Equal(t, cloudprovider.DefaultLoadBalancerName(legacy), gce.GetLoadBalancerName(context.TODO(), vals.ClusterName, legacy))
+}
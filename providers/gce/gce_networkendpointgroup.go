@@ -83,8 +83,12 @@ func (g *Cloud) CreateNetworkEndpointGroup(neg *computebeta.NetworkEndpointGroup
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "network endpoint group", meta.ZonalKey(neg.Name, zone), neg) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "network endpoint group", meta.ZonalKey(neg.Name, zone), neg)
 	mc := newNetworkEndpointGroupMetricContext("create", zone)
-	return mc.Observe(g.c.BetaNetworkEndpointGroups().Insert(ctx, meta.ZonalKey(neg.Name, zone), neg))
+	return mc.Observe(audit(g.c.BetaNetworkEndpointGroups().Insert(ctx, meta.ZonalKey(neg.Name, zone), neg)))
 }
 
 // DeleteNetworkEndpointGroup deletes the name endpoint group from the zone
@@ -92,8 +96,12 @@ func (g *Cloud) DeleteNetworkEndpointGroup(name string, zone string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "network endpoint group", meta.ZonalKey(name, zone), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "network endpoint group", meta.ZonalKey(name, zone), nil)
 	mc := newNetworkEndpointGroupMetricContext("delete", zone)
-	return mc.Observe(g.c.BetaNetworkEndpointGroups().Delete(ctx, meta.ZonalKey(name, zone)))
+	return mc.Observe(audit(g.c.BetaNetworkEndpointGroups().Delete(ctx, meta.ZonalKey(name, zone))))
 }
 
 // AttachNetworkEndpoints associates the referenced endpoints with the named endpoint group in the zone
@@ -105,7 +113,11 @@ func (g *Cloud) AttachNetworkEndpoints(name, zone string, endpoints []*computebe
 	req := &computebeta.NetworkEndpointGroupsAttachEndpointsRequest{
 		NetworkEndpoints: endpoints,
 	}
-	return mc.Observe(g.c.BetaNetworkEndpointGroups().AttachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req))
+	if g.skipMutation("attach network endpoints to", "network endpoint group", meta.ZonalKey(name, zone), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "attach network endpoints to", "network endpoint group", meta.ZonalKey(name, zone), req)
+	return mc.Observe(audit(g.c.BetaNetworkEndpointGroups().AttachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req)))
 }
 
 // DetachNetworkEndpoints breaks the association between the referenced endpoints and the named endpoint group in the zone
@@ -117,7 +129,11 @@ func (g *Cloud) DetachNetworkEndpoints(name, zone string, endpoints []*computebe
 	req := &computebeta.NetworkEndpointGroupsDetachEndpointsRequest{
 		NetworkEndpoints: endpoints,
 	}
-	return mc.Observe(g.c.BetaNetworkEndpointGroups().DetachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req))
+	if g.skipMutation("detach network endpoints from", "network endpoint group", meta.ZonalKey(name, zone), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "detach network endpoints from", "network endpoint group", meta.ZonalKey(name, zone), req)
+	return mc.Observe(audit(g.c.BetaNetworkEndpointGroups().DetachNetworkEndpoints(ctx, meta.ZonalKey(name, zone), req)))
 }
 
 // ListNetworkEndpoints returns all the endpoints associated with the endpoint group in zone and optionally their status.
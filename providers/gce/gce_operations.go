@@ -0,0 +1,250 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	// operationPollBaseInterval is the interval between the first two polls
+	// of the operations started with a context. It grows by
+	// operationPollBackoffFactor on every further poll, up to
+	// operationPollMaxInterval, so that the short operations are seen done
+	// quickly and the long ones do not use up the operations.get quota.
+	operationPollBaseInterval  = 500 * time.Millisecond
+	operationPollMaxInterval   = 10 * time.Second
+	operationPollBackoffFactor = 1.5
+)
+
+var operationsInFlight = metrics.NewGauge(
+	&metrics.GaugeOpts{
+		Name:           "cloudprovider_gce_operations_in_flight",
+		Help:           "Number of GCE operations started and not yet seen done",
+		StabilityLevel: metrics.ALPHA,
+	},
+)
+
+func init() {
+	legacyregistry.MustRegister(operationsInFlight)
+}
+
+// validateMaxInFlightOperations checks the max-inflight-operations of the
+// cloud config.
+func validateMaxInFlightOperations(max int) error {
+	if max < 0 {
+		return fmt.Errorf("invalid max-inflight-operations %d, must not be negative", max)
+	}
+	return nil
+}
+
+// startsOperation returns whether a call of the operation starts a GCE
+// operation waited for by polling it. The IAM policy calls and the previews
+// of the mutations are answered directly.
+func startsOperation(operation string) bool {
+	switch operation {
+	case "SetIamPolicy", "TestIamPermissions", "Preview":
+		return false
+	}
+	return isMutation(operation)
+}
+
+// operationPoll is the polling state of the operations started with a
+// context and not yet seen done.
+type operationPoll struct {
+	inFlight int
+	// interval is the interval between the next poll and the one after.
+	interval time.Duration
+	next     time.Time
+	// stop stops the release of the operations when the context is done.
+	stop func() bool
+}
+
+// operationPoller paces the polls of the GCE operations with an exponential
+// backoff, from the first poll of the operations started with a context to
+// the last, rather than at a fixed interval, and caps the operations in
+// flight if slots is not nil. The operations are tracked by the context they
+// are started and waited for with, which the generated mutations of g.c use
+// for both.
+type operationPoller struct {
+	// slots holds a value per operation in flight if not nil, blocking the
+	// start of operations once full.
+	slots chan struct{}
+	// firstPollDelay is the delay of the first poll of the operations. It is
+	// zero when the operations are waited for server-side, as the first
+	// poll does not return before the operation is done or a timeout.
+	firstPollDelay time.Duration
+
+	mu    sync.Mutex
+	polls map[context.Context]*operationPoll
+}
+
+// newOperationPoller returns an operationPoller capping the operations in
+// flight to max, if not zero.
+func newOperationPoller(max int) *operationPoller {
+	p := &operationPoller{}
+	if max > 0 {
+		p.slots = make(chan struct{}, max)
+	}
+	if !cloud.OperationsUseWait {
+		p.firstPollDelay = operationPollBaseInterval
+	}
+	return p
+}
+
+// start waits for a slot for an operation started with ctx, and resets the
+// backoff of its polls unless other operations of ctx are in flight.
+func (p *operationPoller) start(ctx context.Context, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	operationsInFlight.Inc()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	poll, ok := p.polls[ctx]
+	if !ok {
+		poll = &operationPoll{interval: operationPollBaseInterval, next: now.Add(p.firstPollDelay)}
+		if p.polls == nil {
+			p.polls = map[context.Context]*operationPoll{}
+		}
+		p.polls[ctx] = poll
+		// The operations whose polls are abandoned, e.g. on a timeout, are
+		// not seen done.
+		poll.stop = context.AfterFunc(ctx, func() { p.forget(ctx, poll) })
+	}
+	poll.inFlight++
+	return nil
+}
+
+// delay returns how long to wait before the next poll of the operations
+// started with ctx, and schedules the one after with the backoff. The polls
+// of the operations started otherwise, e.g. by a custom rate limiter, are
+// spaced by operationPollInterval.
+func (p *operationPoller) delay(ctx context.Context, now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	poll, ok := p.polls[ctx]
+	if !ok {
+		return operationPollInterval
+	}
+	delay := poll.next.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	poll.next = now.Add(delay + poll.interval)
+	poll.interval = time.Duration(float64(poll.interval) * operationPollBackoffFactor)
+	if poll.interval > operationPollMaxInterval {
+		poll.interval = operationPollMaxInterval
+	}
+	return delay
+}
+
+// wait blocks until the next poll of the operations started with ctx.
+func (p *operationPoller) wait(ctx context.Context) error {
+	delay := p.delay(ctx, time.Now())
+	if delay == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// done releases the slot of an operation started with ctx, seen done or
+// failed to start.
+func (p *operationPoller) done(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	poll, ok := p.polls[ctx]
+	if !ok {
+		return
+	}
+	p.release(1)
+	poll.inFlight--
+	if poll.inFlight == 0 {
+		delete(p.polls, ctx)
+		poll.stop()
+	}
+}
+
+// forget releases the slots of the operations of poll, started with ctx,
+// once ctx is done.
+func (p *operationPoller) forget(ctx context.Context, poll *operationPoll) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.polls[ctx] != poll {
+		return
+	}
+	p.release(poll.inFlight)
+	delete(p.polls, ctx)
+}
+
+// release releases n slots. It is called with p.mu held.
+func (p *operationPoller) release(n int) {
+	operationsInFlight.Add(-float64(n))
+	if p.slots == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		<-p.slots
+	}
+}
+
+// runMutations runs the independent mutations concurrently, each with a
+// context of its own, so that their operations are waited for together
+// rather than one after the other, and returns their aggregated errors. The
+// number of mutations in flight is bounded by the cap on the operations in
+// flight.
+func (g *Cloud) runMutations(ctx context.Context, mutations ...func(context.Context) error) error {
+	errs := make([]error, len(mutations))
+	var wg sync.WaitGroup
+	for i, mutation := range mutations {
+		wg.Add(1)
+		go func(i int, mutation func(context.Context) error) {
+			defer wg.Done()
+			mutationCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			errs[i] = mutation(mutationCtx)
+		}(i, mutation)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
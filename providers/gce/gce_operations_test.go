@@ -0,0 +1,165 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestOperationPollerBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &operationPoller{firstPollDelay: operationPollBaseInterval}
+	ctx := context.Background()
+
+	// The polls of the operations started otherwise are spaced by the
+	// fixed interval.
+	assert.Equal(t, operationPollInterval, p.delay(ctx, now))
+
+	require.NoError(t, p.start(ctx, now))
+	var delays []time.Duration
+	for i := 0; i < 10; i++ {
+		delay := p.delay(ctx, now)
+		delays = append(delays, delay)
+		now = now.Add(delay)
+	}
+	assert.Equal(t, []time.Duration{
+		500 * time.Millisecond,
+		500 * time.Millisecond,
+		750 * time.Millisecond,
+		1125 * time.Millisecond,
+		1687500 * time.Microsecond,
+		2531250 * time.Microsecond,
+		3796875 * time.Microsecond,
+		5695312500 * time.Nanosecond,
+		8542968750 * time.Nanosecond,
+		operationPollMaxInterval,
+	}, delays)
+
+	// The time spent polling counts towards the interval.
+	now = now.Add(operationPollMaxInterval / 2)
+	assert.Equal(t, operationPollMaxInterval/2, p.delay(ctx, now))
+
+	// The backoff is reset once the operation is done.
+	p.done(ctx)
+	require.NoError(t, p.start(ctx, now))
+	assert.Equal(t, operationPollBaseInterval, p.delay(ctx, now))
+	p.done(ctx)
+	assert.Empty(t, p.polls)
+}
+
+func TestOperationPollerMaxInFlight(t *testing.T) {
+	now := time.Now()
+	p := newOperationPoller(2)
+	ctx1 := context.Background()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	require.NoError(t, p.start(ctx1, now))
+	require.NoError(t, p.start(ctx2, now))
+
+	// A third operation waits for a slot.
+	ctx3, cancel3 := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel3()
+	assert.ErrorIs(t, p.start(ctx3, now), context.DeadlineExceeded)
+
+	// The slot of an operation is released once it is done.
+	p.done(ctx1)
+	assert.Len(t, p.slots, 1)
+	require.NoError(t, p.start(ctx1, now))
+
+	// The slots of the operations whose context is done are released.
+	cancel2()
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.polls) == 1 && len(p.slots) == 1
+	}, time.Second, time.Millisecond)
+	p.done(ctx1)
+	assert.Empty(t, p.slots)
+}
+
+func TestGCERateLimiterOperations(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	gce.operationPoller = newOperationPoller(1)
+	gce.operationPollRateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	rl := &gceRateLimiter{gce}
+	insert := &cloud.RateLimitKey{Service: "TargetPools", Operation: "Insert", Version: "ga"}
+	poll := &cloud.RateLimitKey{Service: "Operations", Operation: "Get", Version: "ga"}
+	ctx := context.Background()
+
+	// A failed mutation releases its slot.
+	require.NoError(t, rl.Accept(ctx, insert))
+	rl.Observe(ctx, errors.New("insert failed"), insert)
+	assert.Empty(t, gce.operationPoller.slots)
+
+	// A started mutation holds its slot until a poll sees it done.
+	require.NoError(t, rl.Accept(ctx, insert))
+	rl.Observe(ctx, nil, insert)
+	assert.Len(t, gce.operationPoller.slots, 1)
+	require.NoError(t, rl.Accept(ctx, poll))
+	rl.Observe(ctx, nil, poll)
+	assert.Empty(t, gce.operationPoller.slots)
+
+	// The calls answered directly do not hold a slot.
+	iam := &cloud.RateLimitKey{Service: "Projects", Operation: "TestIamPermissions", Version: "ga"}
+	require.NoError(t, rl.Accept(ctx, iam))
+	assert.Empty(t, gce.operationPoller.slots)
+}
+
+func TestRunMutations(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+
+	// The mutations run concurrently, with contexts of their own.
+	var running atomic.Int32
+	release := make(chan struct{})
+	ctxs := make(chan context.Context, 3)
+	mutation := func(err error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			ctxs <- ctx
+			if running.Add(1) == 3 {
+				close(release)
+			}
+			<-release
+			return err
+		}
+	}
+	err = gce.runMutations(context.Background(), mutation(nil), mutation(errors.New("a")), mutation(errors.New("b")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a")
+	assert.Contains(t, err.Error(), "b")
+	close(ctxs)
+	seen := map[context.Context]bool{}
+	for ctx := range ctxs {
+		assert.False(t, seen[ctx], "Mutations run with the same context")
+		seen[ctx] = true
+	}
+
+	assert.NoError(t, gce.runMutations(context.Background()))
+}
@@ -0,0 +1,58 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// quotaProjectHeader is the header of the API requests naming the project
+// their quota and billing are charged to, instead of the project of the
+// credentials.
+const quotaProjectHeader = "X-Goog-User-Project"
+
+// quotaProjectTransport charges the requests it sends to the quota project.
+type quotaProjectTransport struct {
+	base    http.RoundTripper
+	project string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *quotaProjectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(quotaProjectHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(quotaProjectHeader, t.project)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// withQuotaProject returns a context making the token exchanges of the
+// credentials created with it, e.g. with the Security Token Service and the
+// IAM Service Account Credentials API, charge the quota project if not empty.
+func withQuotaProject(ctx context.Context, project string) context.Context {
+	if project == "" {
+		return ctx
+	}
+	client := &http.Client{Transport: &quotaProjectTransport{base: http.DefaultTransport, project: project}}
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
+}
@@ -0,0 +1,72 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestComputeHTTPClientQuotaProject(t *testing.T) {
+	var quotaProjects []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quotaProjects = append(quotaProjects, r.Header.Get(quotaProjectHeader))
+	}))
+	defer server.Close()
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+
+	for _, quotaProject := range []string{"", "billing-project"} {
+		client, err := newComputeHTTPClient(tokenSource, quotaProject, nil, &callBudgets{}, &syncSpans{})
+		require.NoError(t, err)
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"", "billing-project"}, quotaProjects)
+}
+
+func TestQuotaProjectTransport(t *testing.T) {
+	var quotaProjects []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quotaProjects = append(quotaProjects, r.Header.Get(quotaProjectHeader))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &quotaProjectTransport{base: http.DefaultTransport, project: "billing-project"}}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	// The request is not modified.
+	assert.Empty(t, req.Header.Get(quotaProjectHeader))
+
+	// The quota project of the request is kept.
+	req.Header.Set(quotaProjectHeader, "other-project")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"billing-project", "other-project"}, quotaProjects)
+}
@@ -0,0 +1,160 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	gcfg "gopkg.in/gcfg.v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// defaultRateLimitGroup is the rate limit section applying to the API groups
+// without their own section.
+const defaultRateLimitGroup = "default"
+
+// RateLimitConfig is the rate limit of the calls to a GCE API group, e.g.
+// ForwardingRules, set in a [ratelimit "ForwardingRules"] section of the
+// cloud config. Reads are the Get and List calls, mutations are all the other
+// calls. A zero QPS disables the rate limit.
+type RateLimitConfig struct {
+	ReadQPS     float32 `gcfg:"read-qps"`
+	ReadBurst   int     `gcfg:"read-burst"`
+	MutateQPS   float32 `gcfg:"mutate-qps"`
+	MutateBurst int     `gcfg:"mutate-burst"`
+}
+
+// rateLimitConfigFile is the format of the rate-limit-config-file.
+type rateLimitConfigFile struct {
+	RateLimits map[string]*RateLimitConfig `gcfg:"ratelimit"`
+}
+
+// loadRateLimits returns the rate limits set in the cloud config, overridden
+// by those of the rate-limit-config-file if set, keyed by lower case API
+// group.
+func loadRateLimits(configFile *ConfigFile) (map[string]*RateLimitConfig, error) {
+	rateLimits := map[string]*RateLimitConfig{}
+	for group, limit := range configFile.RateLimits {
+		rateLimits[strings.ToLower(group)] = limit
+	}
+	if path := configFile.Global.RateLimitConfigFile; path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rate-limit-config-file: %v", err)
+		}
+		file := &rateLimitConfigFile{}
+		if err := gcfg.FatalOnly(gcfg.ReadStringInto(file, string(content))); err != nil {
+			return nil, fmt.Errorf("invalid rate-limit-config-file %q: %v", path, err)
+		}
+		for group, limit := range file.RateLimits {
+			rateLimits[strings.ToLower(group)] = limit
+		}
+	}
+	for group, limit := range rateLimits {
+		if limit == nil {
+			delete(rateLimits, group)
+			continue
+		}
+		if limit.ReadQPS < 0 || limit.ReadBurst < 0 || limit.MutateQPS < 0 || limit.MutateBurst < 0 {
+			return nil, fmt.Errorf("invalid rate limit of %q: QPS and burst must not be negative", group)
+		}
+	}
+	if len(rateLimits) == 0 {
+		return nil, nil
+	}
+	return rateLimits, nil
+}
+
+// apiRateLimiters rate limits the GCE API calls by API group and operation
+// type.
+type apiRateLimiters struct {
+	// limiters are keyed by lower case API group, then by whether the
+	// operation is a mutation. A nil limiter means no limit.
+	limiters map[string][2]flowcontrol.RateLimiter
+	// config are the rate limits the limiters were created from.
+	config map[string]*RateLimitConfig
+}
+
+func newAPIRateLimiters(rateLimits map[string]*RateLimitConfig) *apiRateLimiters {
+	if len(rateLimits) == 0 {
+		return nil
+	}
+	l := &apiRateLimiters{limiters: map[string][2]flowcontrol.RateLimiter{}, config: rateLimits}
+	for group, limit := range rateLimits {
+		l.limiters[group] = [2]flowcontrol.RateLimiter{
+			newTokenBucketRateLimiter(limit.ReadQPS, limit.ReadBurst),
+			newTokenBucketRateLimiter(limit.MutateQPS, limit.MutateBurst),
+		}
+	}
+	return l
+}
+
+// rateLimits returns the rate limits l was created from, nil if l is nil.
+func (l *apiRateLimiters) rateLimits() map[string]*RateLimitConfig {
+	if l == nil {
+		return nil
+	}
+	return l.config
+}
+
+// newTokenBucketRateLimiter returns a rate limiter allowing qps calls per
+// second with bursts of burst calls, or nil if qps is zero. burst defaults
+// to qps, rounded up.
+func newTokenBucketRateLimiter(qps float32, burst int) flowcontrol.RateLimiter {
+	if qps == 0 {
+		return nil
+	}
+	if burst == 0 {
+		burst = int(qps)
+		if float32(burst) < qps {
+			burst++
+		}
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+}
+
+// wait blocks until the call identified by key is allowed by the rate limit of
+// its API group, or of the default group if it has none.
+func (l *apiRateLimiters) wait(ctx context.Context, key *cloud.RateLimitKey) error {
+	limiters, ok := l.limiters[strings.ToLower(key.Service)]
+	if !ok {
+		limiters, ok = l.limiters[defaultRateLimitGroup]
+	}
+	if !ok {
+		return nil
+	}
+	limiter := limiters[0]
+	if isMutation(key.Operation) {
+		limiter = limiters[1]
+	}
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
+
+// isMutation returns false if the operation only reads resources.
+func isMutation(operation string) bool {
+	return !strings.HasPrefix(operation, "Get") && !strings.HasPrefix(operation, "List") && operation != "AggregatedList"
+}
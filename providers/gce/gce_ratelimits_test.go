@@ -0,0 +1,99 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRateLimits(t *testing.T) {
+	overrides := filepath.Join(t.TempDir(), "ratelimits.conf")
+	require.NoError(t, os.WriteFile(overrides, []byte(`
+[ratelimit "Firewalls"]
+mutate-qps = 2
+`), 0600))
+	configFile, err := readConfig(strings.NewReader(`
+[global]
+rate-limit-config-file = ` + overrides + `
+
+[ratelimit "default"]
+read-qps = 20
+read-burst = 40
+mutate-qps = 5
+
+[ratelimit "ForwardingRules"]
+mutate-qps = 1
+mutate-burst = 1
+
+[ratelimit "Firewalls"]
+mutate-qps = 10
+`))
+	require.NoError(t, err)
+
+	rateLimits, err := loadRateLimits(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*RateLimitConfig{
+		"default":         {ReadQPS: 20, ReadBurst: 40, MutateQPS: 5},
+		"forwardingrules": {MutateQPS: 1, MutateBurst: 1},
+		"firewalls":       {MutateQPS: 2},
+	}, rateLimits)
+
+	configFile, err = readConfig(strings.NewReader(`
+[ratelimit "Routes"]
+read-qps = -1
+`))
+	require.NoError(t, err)
+	_, err = loadRateLimits(configFile)
+	assert.Error(t, err)
+
+	rateLimits, err = loadRateLimits(&ConfigFile{})
+	require.NoError(t, err)
+	assert.Nil(t, rateLimits)
+}
+
+func TestAPIRateLimiters(t *testing.T) {
+	limiters := newAPIRateLimiters(map[string]*RateLimitConfig{
+		"default":         {ReadQPS: 1, MutateQPS: 1},
+		"forwardingrules": {MutateQPS: 1},
+	})
+	// waitTwice returns the error of the second of two calls in a row,
+	// which exceeds a limit of 1 QPS with a burst of 1.
+	waitTwice := func(service, operation string) error {
+		key := &cloud.RateLimitKey{Service: service, Operation: operation}
+		require.NoError(t, limiters.wait(context.Background(), key))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		return limiters.wait(ctx, key)
+	}
+
+	assert.Error(t, waitTwice("ForwardingRules", "Insert"), "forwarding rule mutations should be rate limited")
+	assert.NoError(t, waitTwice("ForwardingRules", "Get"), "forwarding rule reads should not be rate limited")
+	assert.Error(t, waitTwice("Firewalls", "List"), "the default rate limit should apply to firewalls")
+	assert.Error(t, waitTwice("Firewalls", "Delete"), "the default rate limit should apply to firewalls")
+}
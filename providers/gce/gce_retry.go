@@ -0,0 +1,368 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+	"k8s.io/klog/v2"
+)
+
+// Names of the retry policies that can be set in the cloud config.
+const (
+	RetryPolicyNone        = "none"
+	RetryPolicyExponential = "exponential"
+	RetryPolicyQuotaAware  = "quota-aware"
+
+	// defaultRetryMaxAttempts is the number of attempts of the retry
+	// policies if retry-max-attempts is not set.
+	defaultRetryMaxAttempts = 5
+)
+
+// RetryPolicy decides whether a failed GCE API request is retried.
+type RetryPolicy interface {
+	// Backoff returns how long to wait before retrying a request whose
+	// attempt-th attempt, counting from 1, failed with resp or err, or false
+	// if the request must not be retried. The body of resp can be read, it is
+	// restored for the caller.
+	Backoff(attempt int, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// NoRetryPolicy never retries requests.
+type NoRetryPolicy struct{}
+
+// Backoff implements RetryPolicy.
+func (NoRetryPolicy) Backoff(int, *http.Response, error) (time.Duration, bool) {
+	return 0, false
+}
+
+// ExponentialRetryPolicy retries the requests that failed with a transport
+// error, a server error or a rate limit error with an exponential backoff.
+// Non-idempotent requests, e.g. inserts, are only retried after rate limit
+// errors, since they may have been applied despite the other failures.
+type ExponentialRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Backoff implements RetryPolicy.
+func (p *ExponentialRetryPolicy) Backoff(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+		return 0, false
+	}
+	return exponentialDelay(attempt, p.BaseDelay, p.MaxDelay, resp), true
+}
+
+// QuotaAwareRetryPolicy only retries the requests rejected because a rate
+// limit or quota was exceeded, with a slow exponential backoff so that the
+// retries do not keep the quota exhausted. Server errors are not retried, to
+// not amplify outages.
+type QuotaAwareRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Backoff implements RetryPolicy.
+func (p *QuotaAwareRetryPolicy) Backoff(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || err != nil || !isQuotaExceededError(googleapi.CheckResponse(resp)) {
+		return 0, false
+	}
+	return exponentialDelay(attempt, p.BaseDelay, p.MaxDelay, resp), true
+}
+
+// exponentialDelay returns the delay before the attempt+1-th attempt, or the
+// delay requested by the server with a Retry-After header if longer.
+func exponentialDelay(attempt int, base, max time.Duration, resp *http.Response) time.Duration {
+	delay := base << (attempt - 1)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > delay {
+			delay = time.Duration(seconds) * time.Second
+		}
+	}
+	return delay
+}
+
+// NewRetryPolicy returns the retry policy with the given name, making at most
+// maxAttempts attempts.
+func NewRetryPolicy(name string, maxAttempts int) (RetryPolicy, error) {
+	switch name {
+	case RetryPolicyNone:
+		return NoRetryPolicy{}, nil
+	case RetryPolicyExponential:
+		return &ExponentialRetryPolicy{MaxAttempts: maxAttempts, BaseDelay: time.Second, MaxDelay: 30 * time.Second}, nil
+	case RetryPolicyQuotaAware:
+		return &QuotaAwareRetryPolicy{MaxAttempts: maxAttempts, BaseDelay: 5 * time.Second, MaxDelay: 2 * time.Minute}, nil
+	}
+	return nil, fmt.Errorf("unknown retry policy %q, must be one of %s, %s or %s", name, RetryPolicyNone, RetryPolicyExponential, RetryPolicyQuotaAware)
+}
+
+// RetryPolicies selects the retry policy of GCE API requests by the resource
+// and verb they operate on.
+type RetryPolicies struct {
+	defaultPolicy RetryPolicy
+	overrides     map[string]RetryPolicy
+}
+
+// NewRetryPolicies returns RetryPolicies using defaultPolicy for the requests
+// not matching any of overrides. overrides are keyed by RESOURCE/VERB, where
+// RESOURCE is the collection name in the compute API URLs, e.g.
+// forwardingRules, and VERB is get, list, aggregatedList, insert, update,
+// patch, delete or a custom method such as setTarget. Either can be *.
+func NewRetryPolicies(defaultPolicy RetryPolicy, overrides map[string]RetryPolicy) *RetryPolicies {
+	return &RetryPolicies{defaultPolicy: defaultPolicy, overrides: overrides}
+}
+
+// policy returns the retry policy of the requests to verb resource.
+func (p *RetryPolicies) policy(resource, verb string) RetryPolicy {
+	for _, key := range []string{resource + "/" + verb, resource + "/*", "*/" + verb} {
+		if policy, ok := p.overrides[key]; ok {
+			return policy
+		}
+	}
+	return p.defaultPolicy
+}
+
+// parseRetryPolicies parses the retry-policy and retry-policy-override cloud
+// config values. It returns nil if no retry policy is configured.
+func parseRetryPolicies(defaultName string, overrides []string, maxAttempts int) (*RetryPolicies, error) {
+	if defaultName == "" && len(overrides) == 0 {
+		return nil, nil
+	}
+	if defaultName == "" {
+		defaultName = RetryPolicyNone
+	}
+	if maxAttempts == 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	if maxAttempts < 1 {
+		return nil, fmt.Errorf("retry-max-attempts must be positive, got %d", maxAttempts)
+	}
+	defaultPolicy, err := NewRetryPolicy(defaultName, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	policies := NewRetryPolicies(defaultPolicy, map[string]RetryPolicy{})
+	for _, override := range overrides {
+		key, name, ok := strings.Cut(override, "=")
+		resource, verb, hasVerb := strings.Cut(strings.TrimSpace(key), "/")
+		if !ok || !hasVerb || resource == "" || verb == "" {
+			return nil, fmt.Errorf("invalid retry-policy-override %q, must be RESOURCE/VERB=POLICY", override)
+		}
+		policy, err := NewRetryPolicy(strings.TrimSpace(name), maxAttempts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry-policy-override %q: %v", override, err)
+		}
+		policies.overrides[resource+"/"+verb] = policy
+	}
+	return policies, nil
+}
+
+// newComputeHTTPClient returns an HTTP client authenticated with tokenSource,
+// charging the quota project if not empty, that retries the GCE API requests
+// according to policies, if not nil, bounds them by the reconcile budgets of
+// the load balancers they are made for, records the operations started by
+// the audited mutations and traces them. With the ComputeHTTP2KeepAlive
+// feature, its HTTP/2 connections are kept alive with pings.
+func newComputeHTTPClient(tokenSource oauth2.TokenSource, quotaProject string, policies *RetryPolicies, budgets *callBudgets, spans *syncSpans) (*http.Client, error) {
+	t := newComputeTransport()
+	if featureEnabled(ComputeHTTP2KeepAlive) {
+		if err := keepAliveComputeTransport(t); err != nil {
+			return nil, err
+		}
+	}
+	base := http.RoundTripper(t)
+	if policies != nil {
+		base = &retryTransport{base: base, policies: policies}
+	}
+	transport, err := htransport.NewTransport(context.Background(),
+		&tracingTransport{base: &auditTransport{base: &budgetTransport{base: base, budgets: budgets}}, spans: spans},
+		option.WithTokenSource(tokenSource), option.WithScopes(compute.CloudPlatformScope), option.WithQuotaProject(quotaProject))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// computeMaxIdleConnsPerHost is the number of idle connections to the GCE API
+// kept by the compute client, sized for the concurrent load balancer syncs
+// rather than the default of 2.
+const computeMaxIdleConnsPerHost = 32
+
+// newComputeTransport returns the transport of the compute client. It is not
+// shared with the other clients of the process, so that their settings and
+// connection pool do not affect the GCE API calls.
+func newComputeTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = computeMaxIdleConnsPerHost
+	return t
+}
+
+// retryTransport retries failed GCE API requests according to the retry
+// policy of the resource and verb they operate on.
+type retryTransport struct {
+	base     http.RoundTripper
+	policies *RetryPolicies
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource, verb := computeRequestResourceVerb(req)
+	policy := t.policies.policy(resource, verb)
+	// Requests with a body can only be retried if it can be rewound.
+	if _, ok := policy.(NoRetryPolicy); ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.base.RoundTrip(req)
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		var body []byte
+		if err == nil {
+			// Let the policy read the body while keeping it readable
+			// for the caller.
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		delay, retry := policy.Backoff(attempt, resp, err)
+		if retry && !isIdempotentRequest(req) && !isRejectedResponse(resp, body, err) {
+			// The request may have been applied, e.g. a resource
+			// created, so retrying it could apply it twice.
+			retry = false
+		}
+		if !retry {
+			if resp != nil {
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			return resp, err
+		}
+		if err != nil {
+			klog.V(2).Infof("Retrying GCE API request %s %s in %v after attempt %d failed: %v", resource, verb, delay, attempt, err)
+		} else {
+			klog.V(2).Infof("Retrying GCE API request %s %s in %v after attempt %d failed with status %d", resource, verb, delay, attempt, resp.StatusCode)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// isIdempotentRequest returns whether req can be sent again without changing
+// its effect, i.e. is a get, list or delete, or an update replacing a
+// resource.
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRejectedResponse returns whether the request was rejected by a rate limit
+// or quota before being applied, so that it can be retried even if not
+// idempotent. body is the body of resp, which is restored before being read.
+func isRejectedResponse(resp *http.Response, body []byte, err error) bool {
+	if err != nil {
+		return false
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return isQuotaExceededError(googleapi.CheckResponse(resp))
+}
+
+// computeRequestResourceVerb returns the resource collection, e.g.
+// forwardingRules, and the verb, e.g. insert, of a compute API request.
+func computeRequestResourceVerb(req *http.Request) (string, string) {
+	path := req.URL.Path
+	if i := strings.Index(path, "/projects/"); i >= 0 {
+		path = path[i+len("/projects/"):]
+	}
+	// Drop the project and the location of the resource.
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 0 {
+		parts = parts[1:]
+	}
+	if len(parts) > 0 && parts[0] == "global" {
+		parts = parts[1:]
+	} else if len(parts) > 1 && (parts[0] == "regions" || parts[0] == "zones") {
+		parts = parts[2:]
+	}
+	if len(parts) > 1 && parts[0] == "aggregated" {
+		return parts[1], "aggregatedList"
+	}
+	if len(parts) == 0 {
+		return "projects", verbForMethod(req.Method, true)
+	}
+	if len(parts) >= 3 {
+		return parts[0], parts[len(parts)-1]
+	}
+	return parts[0], verbForMethod(req.Method, len(parts) == 2)
+}
+
+func verbForMethod(method string, named bool) string {
+	switch method {
+	case http.MethodGet:
+		if named {
+			return "get"
+		}
+		return "list"
+	case http.MethodPost:
+		return "insert"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return strings.ToLower(method)
+}
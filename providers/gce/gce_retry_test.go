@@ -0,0 +1,206 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryPolicies(t *testing.T) {
+	policies, err := parseRetryPolicies("", nil, 0)
+	require.NoError(t, err)
+	assert.Nil(t, policies, "no retry policies should be set by default")
+
+	policies, err = parseRetryPolicies(RetryPolicyExponential, []string{"forwardingRules/insert=none", "routes/*=quota-aware", "*/delete = none"}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, &ExponentialRetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}, policies.policy("firewalls", "get"))
+	assert.Equal(t, NoRetryPolicy{}, policies.policy("forwardingRules", "insert"))
+	assert.IsType(t, &ExponentialRetryPolicy{}, policies.policy("forwardingRules", "get"))
+	assert.IsType(t, &QuotaAwareRetryPolicy{}, policies.policy("routes", "delete"), "resource override should take precedence over verb override")
+	assert.Equal(t, NoRetryPolicy{}, policies.policy("firewalls", "delete"))
+
+	policies, err = parseRetryPolicies("", []string{"routes/insert=exponential"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, NoRetryPolicy{}, policies.policy("firewalls", "insert"))
+	assert.Equal(t, &ExponentialRetryPolicy{MaxAttempts: defaultRetryMaxAttempts, BaseDelay: time.Second, MaxDelay: 30 * time.Second}, policies.policy("routes", "insert"))
+
+	for _, tc := range []struct {
+		policy    string
+		overrides []string
+		attempts  int
+	}{
+		{policy: "aggressive"},
+		{policy: RetryPolicyExponential, attempts: -1},
+		{overrides: []string{"routes=none"}},
+		{overrides: []string{"routes/insert"}},
+		{overrides: []string{"routes/insert=forever"}},
+	} {
+		_, err := parseRetryPolicies(tc.policy, tc.overrides, tc.attempts)
+		assert.Error(t, err, "policy %q, overrides %q, attempts %d", tc.policy, tc.overrides, tc.attempts)
+	}
+}
+
+func TestComputeRequestResourceVerb(t *testing.T) {
+	for _, tc := range []struct {
+		method, url    string
+		resource, verb string
+	}{
+		{http.MethodGet, "https://compute.googleapis.com/compute/v1/projects/p/global/firewalls/fw", "firewalls", "get"},
+		{http.MethodGet, "https://compute.googleapis.com/compute/v1/projects/p/global/firewalls", "firewalls", "list"},
+		{http.MethodPost, "https://compute.googleapis.com/compute/v1/projects/p/regions/r/forwardingRules", "forwardingRules", "insert"},
+		{http.MethodDelete, "https://compute.googleapis.com/compute/v1/projects/p/zones/z/instances/i", "instances", "delete"},
+		{http.MethodPatch, "https://compute.googleapis.com/compute/beta/projects/p/global/firewalls/fw", "firewalls", "patch"},
+		{http.MethodPut, "https://compute.googleapis.com/compute/v1/projects/p/regions/r/backendServices/bs", "backendServices", "update"},
+		{http.MethodPost, "https://compute.googleapis.com/compute/v1/projects/p/regions/r/targetPools/tp/addInstance", "targetPools", "addInstance"},
+		{http.MethodGet, "https://compute.googleapis.com/compute/v1/projects/p/aggregated/forwardingRules", "forwardingRules", "aggregatedList"},
+		{http.MethodGet, "https://compute.googleapis.com/compute/v1/projects/p", "projects", "get"},
+	} {
+		req, err := http.NewRequest(tc.method, tc.url, nil)
+		require.NoError(t, err)
+		resource, verb := computeRequestResourceVerb(req)
+		assert.Equal(t, tc.resource+"/"+tc.verb, resource+"/"+verb, "%s %s", tc.method, tc.url)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	quotaExceeded := `{"error": {"code": 403, "message": "quota", "errors": [{"reason": "rateLimitExceeded"}]}}`
+	for _, tc := range []struct {
+		desc         string
+		policy       RetryPolicy
+		method       string
+		failures     int
+		failStatus   int
+		failBody     string
+		wantAttempts int
+		wantStatus   int
+	}{
+		{
+			desc:         "no retries",
+			policy:       NoRetryPolicy{},
+			failures:     1,
+			failStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			desc:         "exponential retries server errors",
+			policy:       &ExponentialRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			method:       http.MethodDelete,
+			failures:     2,
+			failStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 3,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			desc:         "exponential does not retry inserts after server errors",
+			policy:       &ExponentialRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			failures:     1,
+			failStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			desc:         "exponential retries inserts after rate limit errors",
+			policy:       &ExponentialRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			failures:     1,
+			failStatus:   http.StatusTooManyRequests,
+			wantAttempts: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			desc:         "exponential gives up after max attempts",
+			policy:       &ExponentialRetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			method:       http.MethodDelete,
+			failures:     5,
+			failStatus:   http.StatusInternalServerError,
+			wantAttempts: 2,
+			wantStatus:   http.StatusInternalServerError,
+		},
+		{
+			desc:         "exponential does not retry client errors",
+			policy:       &ExponentialRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			failures:     1,
+			failStatus:   http.StatusBadRequest,
+			wantAttempts: 1,
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			desc:         "quota-aware retries quota errors",
+			policy:       &QuotaAwareRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			failures:     1,
+			failStatus:   http.StatusForbidden,
+			failBody:     quotaExceeded,
+			wantAttempts: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			desc:         "quota-aware does not retry server errors",
+			policy:       &QuotaAwareRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			failures:     1,
+			failStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, "request", string(body), "request body should be sent on every attempt")
+				if attempts <= tc.failures {
+					w.WriteHeader(tc.failStatus)
+					w.Write([]byte(tc.failBody))
+					return
+				}
+				w.Write([]byte("response"))
+			}))
+			defer server.Close()
+			transport := &retryTransport{base: http.DefaultTransport, policies: NewRetryPolicies(tc.policy, nil)}
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req, err := http.NewRequest(method, server.URL+"/compute/v1/projects/p/global/firewalls", bytes.NewBufferString("request"))
+			require.NoError(t, err)
+
+			resp, err := transport.RoundTrip(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tc.wantAttempts, attempts)
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, "response", string(body))
+			} else {
+				assert.Equal(t, tc.failBody, string(body), "the body of the last failure should be returned")
+			}
+		})
+	}
+}
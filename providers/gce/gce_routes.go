@@ -24,9 +24,12 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 
@@ -35,22 +38,63 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 )
 
+// defaultRoutePriority is the priority of the routes created for the Pod
+// ranges of the nodes unless route-priority is set.
+const defaultRoutePriority = 1000
+
+// validateRoutePriority validates the route-priority of the cloud config,
+// which defaults to defaultRoutePriority if zero.
+func validateRoutePriority(priority int) error {
+	if priority < 0 || priority > 65535 {
+		return fmt.Errorf("invalid route-priority %d, must be between 1 and 65535", priority)
+	}
+	return nil
+}
+
+// nodeRouteDescription returns the description of the routes created for the
+// Pod ranges of the nodes, k8sNodeRouteTag followed by the route-description
+// of the cloud config, if any.
+func (g *Cloud) nodeRouteDescription() string {
+	if g.routeDescription == "" {
+		return k8sNodeRouteTag
+	}
+	return k8sNodeRouteTag + " " + g.routeDescription
+}
+
+// isNodeRouteDescription returns whether description is the description of a
+// route created for the Pod range of a node, with any route-description.
+func isNodeRouteDescription(description string) bool {
+	return description == k8sNodeRouteTag || strings.HasPrefix(description, k8sNodeRouteTag+" ")
+}
+
 func newRoutesMetricContext(request string) *metricContext {
 	return newGenericMetricContext("routes", request, unusedMetricLabel, unusedMetricLabel, computeV1Version)
 }
 
 // ListRoutes in the cloud environment.
-func (g *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
+func (g *Cloud) ListRoutes(ctx context.Context, clusterName string) (_ []*cloudprovider.Route, err error) {
+	ctx, endSpan := startSpan(ctx, "ListRoutes")
+	defer func() { endSpan(err) }()
 	timeoutCtx, cancel := context.WithTimeout(ctx, 1*time.Hour)
 	defer cancel()
 
 	mc := newRoutesMetricContext("list")
 	prefix := truncateClusterName(clusterName)
-	f := filter.Regexp("name", prefix+"-.*").AndRegexp("network", g.NetworkURL()).AndRegexp("description", k8sNodeRouteTag)
-	routes, err := g.c.Routes().List(timeoutCtx, f)
+	// The filter values are not quoted, so the route-description, which may
+	// contain spaces, is matched by isNodeRouteDescription.
+	f := filter.Regexp("name", prefix+"-.*").AndRegexp("network", g.NetworkURL()).AndRegexp("description", k8sNodeRouteTag+".*")
+	list, err := g.c.Routes().List(timeoutCtx, f)
+	g.syncHealth.record(SyncLoopRoute, err)
 	if err != nil {
 		return nil, mc.Observe(err)
 	}
+	var routes []*compute.Route
+	for _, r := range list {
+		if isNodeRouteDescription(r.Description) {
+			routes = append(routes, r)
+		}
+	}
+	g.maybeCollectOrphanedRoutes(routes)
 	var croutes []*cloudprovider.Route
 	for _, r := range routes {
 		target := path.Base(r.NextHopInstance)
@@ -65,16 +109,46 @@ func (g *Cloud) ListRoutes(ctx context.Context, clusterName string) ([]*cloudpro
 	return croutes, mc.Observe(nil)
 }
 
-// CreateRoute in the cloud environment.
+// CreateRoute in the cloud environment. The routes created and deleted
+// together, as the route controller does for all the Nodes of a cluster, are
+// batched to share the lookups of their conflicts and target instances.
 func (g *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint string, route *cloudprovider.Route) error {
+	ctx, endSpan := startSpan(ctx, "CreateRoute", routeAttributes(route)...)
 	timeoutCtx, cancel := context.WithTimeout(ctx, 1*time.Hour)
 	defer cancel()
 
+	err := g.routeBatcher.submit(&routeRequest{ctx: timeoutCtx, clusterName: clusterName, nameHint: nameHint, route: route}, g.runRouteBatch)
+	endSpan(err)
+	return err
+}
+
+// createRoute creates the route of a batch, whose conflicts and target
+// instance were looked up with lookups.
+func (g *Cloud) createRoute(ctx context.Context, clusterName string, nameHint string, route *cloudprovider.Route, lookups *routeBatchLookups) error {
 	mc := newRoutesMetricContext("create")
+	if lookups.err != nil {
+		return mc.Observe(lookups.err)
+	}
 
-	targetInstance, err := g.getInstanceByName(mapNodeNameToInstanceName(route.TargetNode))
-	if err != nil {
-		return mc.Observe(err)
+	// Refuse to fight over the destination range with another route
+	// programmer. The route controller reports the error as an event and
+	// keeps the NetworkUnavailable condition of the Node set.
+	if featureEnabled(RouteConflictDetection) {
+		conflicts, err := conflictingRoutes(lookups.networkRoutes, clusterName, route.DestinationCIDR)
+		if err != nil {
+			return mc.Observe(err)
+		}
+		if len(conflicts) > 0 {
+			routeConflictCount.Inc()
+			err := routeConflictError(route.DestinationCIDR, conflicts)
+			klog.Errorf("Not creating route for node %q: %v", route.TargetNode, err)
+			return mc.Observe(err)
+		}
+	}
+
+	targetInstance, ok := lookups.instances[canonicalizeInstanceName(mapNodeNameToInstanceName(route.TargetNode))]
+	if !ok {
+		return mc.Observe(cloudprovider.InstanceNotFound)
 	}
 	cr := &compute.Route{
 		// TODO(thockin): generate a unique name for node + route cidr. Don't depend on name hints.
@@ -82,10 +156,17 @@ func (g *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint st
 		DestRange:       route.DestinationCIDR,
 		NextHopInstance: fmt.Sprintf("zones/%s/instances/%s", targetInstance.Zone, targetInstance.Name),
 		Network:         g.NetworkURL(),
-		Priority:        1000,
-		Description:     k8sNodeRouteTag,
+		Priority:        defaultRoutePriority,
+		Description:     g.nodeRouteDescription(),
+	}
+	if g.routePriority != 0 {
+		cr.Priority = int64(g.routePriority)
+	}
+	if g.skipMutation("insert", "route", meta.GlobalKey(cr.Name), cr) {
+		return nil
 	}
-	err = g.c.Routes().Insert(timeoutCtx, meta.GlobalKey(cr.Name), cr)
+	auditCtx, audit := g.auditMutation(withAuditInitiator(ctx, nodeReference(route.TargetNode)), "insert", "route", meta.GlobalKey(cr.Name), cr)
+	err := audit(g.c.Routes().Insert(auditCtx, meta.GlobalKey(cr.Name), cr))
 	if isHTTPErrorCode(err, http.StatusConflict) {
 		klog.Infof("Route %q already exists.", cr.Name)
 		err = nil
@@ -93,13 +174,42 @@ func (g *Cloud) CreateRoute(ctx context.Context, clusterName string, nameHint st
 	return mc.Observe(err)
 }
 
-// DeleteRoute from the cloud environment.
+// DeleteRoute from the cloud environment. The route is deleted in a batch,
+// see CreateRoute.
 func (g *Cloud) DeleteRoute(ctx context.Context, clusterName string, route *cloudprovider.Route) error {
+	ctx, endSpan := startSpan(ctx, "DeleteRoute", routeAttributes(route)...)
 	timeoutCtx, cancel := context.WithTimeout(ctx, 1*time.Hour)
 	defer cancel()
 
+	err := g.routeBatcher.submit(&routeRequest{ctx: timeoutCtx, clusterName: clusterName, route: route, delete: true}, g.runRouteBatch)
+	endSpan(err)
+	return err
+}
+
+// routeAttributes returns the span attributes of the route.
+func routeAttributes(route *cloudprovider.Route) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("node.name", string(route.TargetNode)),
+		attribute.String("route.destination", route.DestinationCIDR),
+	}
+}
+
+// deleteRoute deletes the route of a batch.
+func (g *Cloud) deleteRoute(ctx context.Context, route *cloudprovider.Route) error {
+	if g.skipMutation("delete", "route", meta.GlobalKey(route.Name), nil) {
+		return nil
+	}
+	auditCtx, audit := g.auditMutation(withAuditInitiator(ctx, nodeReference(route.TargetNode)), "delete", "route", meta.GlobalKey(route.Name), nil)
 	mc := newRoutesMetricContext("delete")
-	return mc.Observe(g.c.Routes().Delete(timeoutCtx, meta.GlobalKey(route.Name)))
+	return mc.Observe(audit(g.c.Routes().Delete(auditCtx, meta.GlobalKey(route.Name))))
+}
+
+// nodeReference returns a reference to the Node to record events on.
+func nodeReference(nodeName types.NodeName) *v1.ObjectReference {
+	if nodeName == "" {
+		return nil
+	}
+	return &v1.ObjectReference{Kind: "Node", Name: string(nodeName), UID: types.UID(nodeName)}
 }
 
 func truncateClusterName(clusterName string) string {
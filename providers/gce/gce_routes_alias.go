@@ -0,0 +1,213 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"k8s.io/apimachinery/pkg/util/sets"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// AliasIPModeAuto detects whether the cluster uses alias IP ranges from
+	// the network interfaces of its nodes.
+	AliasIPModeAuto = "auto"
+	// AliasIPModeEnabled declares that the Pod IPs of the cluster are alias
+	// IP ranges of its nodes, so no routes are programmed.
+	AliasIPModeEnabled = "enabled"
+	// AliasIPModeDisabled declares that the cluster uses routes.
+	AliasIPModeDisabled = "disabled"
+)
+
+// validateAliasIPMode validates the alias-ip-mode of the cloud config, which
+// defaults to AliasIPModeAuto if empty.
+func validateAliasIPMode(mode string) error {
+	switch mode {
+	case "", AliasIPModeAuto, AliasIPModeEnabled, AliasIPModeDisabled:
+		return nil
+	default:
+		return fmt.Errorf("invalid alias-ip-mode %q, must be %s, %s or %s", mode, AliasIPModeAuto, AliasIPModeEnabled, AliasIPModeDisabled)
+	}
+}
+
+// usesAliasIPs returns whether the Pod IPs of the cluster are alias IP
+// ranges of its nodes, and whether it is known. With AliasIPModeAuto, it is
+// detected from the instances of the nodes of the cluster, unknown while
+// there are none, and an error if only some of them have alias IP ranges.
+func (g *Cloud) usesAliasIPs() (aliasIPs bool, known bool, err error) {
+	switch g.aliasIPMode {
+	case AliasIPModeEnabled:
+		return true, true, nil
+	case AliasIPModeDisabled:
+		return false, true, nil
+	}
+
+	g.nodeZonesLock.Lock()
+	nodeZones := map[string]sets.String{}
+	for zone, nodes := range g.nodeZones {
+		if nodes.Len() > 0 {
+			nodeZones[zone] = sets.NewString(nodes.UnsortedList()...)
+		}
+	}
+	g.nodeZonesLock.Unlock()
+	if len(nodeZones) == 0 {
+		return false, false, nil
+	}
+
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	f := filter.None
+	if prefix := g.getNodeInstancePrefix(); prefix != "" {
+		f = filter.Regexp("name", prefix+".*")
+	}
+	instances, err := g.listZoneInstances(ctx, sets.StringKeySet(nodeZones).List(), f, instanceAliasFields)
+	if err != nil {
+		return false, false, err
+	}
+	var withAliasIPs, withoutAliasIPs []string
+	for zone, nodes := range nodeZones {
+		for _, instance := range instances[zone] {
+			if !nodes.Has(instance.Name) {
+				continue
+			}
+			if len(instance.NetworkInterfaces) > 0 && len(instance.NetworkInterfaces[0].AliasIpRanges) > 0 {
+				withAliasIPs = append(withAliasIPs, instance.Name)
+			} else {
+				withoutAliasIPs = append(withoutAliasIPs, instance.Name)
+			}
+		}
+	}
+	switch {
+	case len(withAliasIPs) > 0 && len(withoutAliasIPs) > 0:
+		return false, false, fmt.Errorf("nodes %v have alias IP ranges but nodes %v do not, set alias-ip-mode in the cloud config", truncateList(withAliasIPs, 5), truncateList(withoutAliasIPs, 5))
+	case len(withAliasIPs) == 0 && len(withoutAliasIPs) == 0:
+		return false, false, nil
+	}
+	return len(withAliasIPs) > 0, true, nil
+}
+
+// routes returns the Routes implementation of the cluster, which does not
+// program any route if it uses alias IP ranges.
+func (g *Cloud) routes() cloudprovider.Routes {
+	g.routesOnce.Do(func() {
+		switch g.aliasIPMode {
+		case AliasIPModeEnabled:
+			g.routesImpl = &aliasIPRoutes{g}
+		case AliasIPModeDisabled:
+			g.routesImpl = g
+		default:
+			g.routesImpl = &detectedRoutes{g: g}
+		}
+	})
+	return g.routesImpl
+}
+
+// detectedRoutes is the Routes implementation of clusters detecting whether
+// they use alias IP ranges. It detects it again at each call until it is
+// known, and neither programs nor deletes routes meanwhile.
+type detectedRoutes struct {
+	g  *Cloud
+	mu sync.Mutex
+	// routes is the Routes implementation detected, nil until known.
+	routes cloudprovider.Routes
+}
+
+// detect returns the Routes implementation of the cluster.
+func (r *detectedRoutes) detect() (cloudprovider.Routes, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routes != nil {
+		return r.routes, nil
+	}
+	aliasIPs, known, err := r.g.usesAliasIPs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect whether the cluster uses alias IP ranges: %w", err)
+	}
+	if !known {
+		klog.V(2).Infof("No node instance to detect whether the cluster uses alias IP ranges, not programming routes yet")
+		return &aliasIPRoutes{r.g}, nil
+	}
+	if aliasIPs {
+		klog.Infof("The cluster uses alias IP ranges, routes will not be programmed")
+		r.routes = &aliasIPRoutes{r.g}
+	} else {
+		klog.Infof("The cluster does not use alias IP ranges, programming routes")
+		r.routes = r.g
+	}
+	return r.routes, nil
+}
+
+// ListRoutes lists the routes of the detected implementation.
+func (r *detectedRoutes) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
+	routes, err := r.detect()
+	if err != nil {
+		return nil, err
+	}
+	return routes.ListRoutes(ctx, clusterName)
+}
+
+// CreateRoute creates the route with the detected implementation.
+func (r *detectedRoutes) CreateRoute(ctx context.Context, clusterName string, nameHint string, route *cloudprovider.Route) error {
+	routes, err := r.detect()
+	if err != nil {
+		return err
+	}
+	return routes.CreateRoute(ctx, clusterName, nameHint, route)
+}
+
+// DeleteRoute deletes the route with the detected implementation.
+func (r *detectedRoutes) DeleteRoute(ctx context.Context, clusterName string, route *cloudprovider.Route) error {
+	routes, err := r.detect()
+	if err != nil {
+		return err
+	}
+	return routes.DeleteRoute(ctx, clusterName, route)
+}
+
+// aliasIPRoutes is the Routes implementation of clusters using alias IP
+// ranges, which are routed by the VPC network without static routes.
+type aliasIPRoutes struct {
+	g *Cloud
+}
+
+// ListRoutes returns no routes.
+func (r *aliasIPRoutes) ListRoutes(ctx context.Context, clusterName string) ([]*cloudprovider.Route, error) {
+	r.g.syncHealth.record(SyncLoopRoute, nil)
+	return nil, nil
+}
+
+// CreateRoute does not create the route.
+func (r *aliasIPRoutes) CreateRoute(ctx context.Context, clusterName string, nameHint string, route *cloudprovider.Route) error {
+	klog.V(4).Infof("Not creating route to %s for node %s, the cluster uses alias IP ranges", route.DestinationCIDR, route.TargetNode)
+	return nil
+}
+
+// DeleteRoute does not delete the route.
+func (r *aliasIPRoutes) DeleteRoute(ctx context.Context, clusterName string, route *cloudprovider.Route) error {
+	klog.V(4).Infof("Not deleting route %s, the cluster uses alias IP ranges", route.Name)
+	return nil
+}
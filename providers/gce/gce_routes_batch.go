@@ -0,0 +1,155 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"google.golang.org/api/compute/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// routeBatchWindow is how long the first route creation or deletion of
+	// a batch waits for the others, e.g. the ones the route controller
+	// issues for all the Nodes of a cluster after a restart.
+	routeBatchWindow = 100 * time.Millisecond
+	// maxConcurrentRouteOperations bounds the route insertions and deletions
+	// of a batch in flight, whose GCE operations are polled concurrently.
+	maxConcurrentRouteOperations = 32
+)
+
+// routeRequest is a route creation or deletion of a batch.
+type routeRequest struct {
+	ctx         context.Context
+	clusterName string
+	nameHint    string
+	route       *cloudprovider.Route
+	delete      bool
+	// done receives the result of the request.
+	done chan error
+}
+
+// routeBatcher groups the route creations and deletions issued together.
+// The first request of a batch waits routeBatchWindow for the others, then
+// runs the batch while the others wait for their result.
+type routeBatcher struct {
+	mu      sync.Mutex
+	pending []*routeRequest
+}
+
+// submit adds req to the pending batch, runs the batch with run if req is
+// its first request, and returns the result of req.
+func (b *routeBatcher) submit(req *routeRequest, run func([]*routeRequest)) error {
+	req.done = make(chan error, 1)
+	b.mu.Lock()
+	first := len(b.pending) == 0
+	b.pending = append(b.pending, req)
+	b.mu.Unlock()
+
+	if first {
+		time.Sleep(routeBatchWindow)
+		b.mu.Lock()
+		batch := b.pending
+		b.pending = nil
+		b.mu.Unlock()
+		run(batch)
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-req.ctx.Done():
+		return req.ctx.Err()
+	}
+}
+
+// routeBatchLookups are the lookups shared by the route creations of a
+// batch.
+type routeBatchLookups struct {
+	// networkRoutes are the routes of the cluster network, listed if
+	// RouteConflictDetection is enabled.
+	networkRoutes []*compute.Route
+	// instances are the target instances of the routes by name.
+	instances map[string]*gceInstance
+	// err is the error of the lookups, if any.
+	err error
+}
+
+// runRouteBatch looks up the conflicting routes and the target instances of
+// the route creations of the batch at once, then creates and deletes the
+// routes with at most maxConcurrentRouteOperations in flight.
+func (g *Cloud) runRouteBatch(batch []*routeRequest) {
+	var names []string
+	for _, req := range batch {
+		if !req.delete {
+			names = append(names, mapNodeNameToInstanceName(req.route.TargetNode))
+		}
+	}
+	var lookups *routeBatchLookups
+	if len(names) > 0 {
+		g.checkRouteQuota(len(names))
+		lookups = g.lookupRouteTargets(names)
+	}
+	klog.V(2).Infof("Running a batch of %d route creations and %d route deletions", len(names), len(batch)-len(names))
+
+	sem := make(chan struct{}, maxConcurrentRouteOperations)
+	var wg sync.WaitGroup
+	for _, req := range batch {
+		wg.Add(1)
+		go func(req *routeRequest) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if req.delete {
+				req.done <- g.deleteRoute(req.ctx, req.route)
+				return
+			}
+			req.done <- g.createRoute(req.ctx, req.clusterName, req.nameHint, req.route, lookups)
+		}(req)
+	}
+	wg.Wait()
+}
+
+// lookupRouteTargets lists the routes of the cluster network if
+// RouteConflictDetection is enabled, and the named instances.
+func (g *Cloud) lookupRouteTargets(names []string) *routeBatchLookups {
+	lookups := &routeBatchLookups{instances: map[string]*gceInstance{}}
+	if featureEnabled(RouteConflictDetection) {
+		ctx, cancel := cloud.ContextWithCallTimeout()
+		defer cancel()
+		lookups.networkRoutes, lookups.err = g.listNetworkRoutes(ctx)
+		if lookups.err != nil {
+			return lookups
+		}
+	}
+	instances, err := g.getFoundInstanceByNames(names)
+	if err != nil {
+		lookups.err = err
+		return lookups
+	}
+	for _, instance := range instances {
+		lookups.instances[instance.Name] = instance
+	}
+	return lookups
+}
@@ -0,0 +1,93 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"google.golang.org/api/compute/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var routeConflictCount = metrics.NewCounter(
+	&metrics.CounterOpts{
+		Name:           "cloudprovider_gce_route_conflicts_total",
+		Help:           "Number of Node routes not created because a route not owned by the cluster programs the same destination range",
+		StabilityLevel: metrics.ALPHA,
+	},
+)
+
+// init registers the route conflict metric.
+func init() {
+	legacyregistry.MustRegister(routeConflictCount)
+}
+
+// listNetworkRoutes lists all the routes of the cluster network.
+func (g *Cloud) listNetworkRoutes(ctx context.Context) ([]*compute.Route, error) {
+	return g.c.Routes().List(ctx, filter.Regexp("network", g.NetworkURL()))
+}
+
+// conflictingRoutes returns the routes of the cluster network that are not
+// owned by the cluster and send an equal or more specific part of destRange
+// elsewhere, e.g. routes programmed by a CNI or by another cluster using the
+// same pod range. Creating a Node route next to them makes the two programmers
+// fight over the range. Broader routes, such as the default route, and subnet
+// or peering routes are not conflicts.
+func conflictingRoutes(routes []*compute.Route, clusterName, destRange string) ([]*compute.Route, error) {
+	_, destNet, err := net.ParseCIDR(destRange)
+	if err != nil {
+		return nil, err
+	}
+	destOnes, _ := destNet.Mask.Size()
+
+	prefix := truncateClusterName(clusterName) + "-"
+	var conflicts []*compute.Route
+	for _, r := range routes {
+		if strings.HasPrefix(r.Name, prefix) && isNodeRouteDescription(r.Description) {
+			continue
+		}
+		if r.NextHopNetwork != "" || r.NextHopPeering != "" {
+			continue
+		}
+		_, routeNet, err := net.ParseCIDR(r.DestRange)
+		if err != nil {
+			continue
+		}
+		if ones, _ := routeNet.Mask.Size(); ones >= destOnes && destNet.Contains(routeNet.IP) {
+			conflicts = append(conflicts, r)
+		}
+	}
+	return conflicts, nil
+}
+
+// routeConflictError returns the error reported for a Node route whose
+// destination range is already programmed by conflicts.
+func routeConflictError(destRange string, conflicts []*compute.Route) error {
+	var names []string
+	for _, r := range conflicts {
+		names = append(names, fmt.Sprintf("%s (%s)", r.Name, r.DestRange))
+	}
+	return fmt.Errorf("destination range %s is already programmed by routes not owned by this cluster: %s; not creating the route to avoid fighting over it", destRange, strings.Join(names, ", "))
+}
@@ -0,0 +1,139 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	compute "google.golang.org/api/compute/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+// routeGCInterval is the minimum interval between two collections of the
+// orphaned routes of the cluster.
+const routeGCInterval = 10 * time.Minute
+
+// routeGC tracks the collections of orphaned routes started by ListRoutes.
+type routeGC struct {
+	mu      sync.Mutex
+	running bool
+	lastRun time.Time
+}
+
+// maybeCollectOrphanedRoutes collects the orphaned routes among the routes
+// of the cluster in the background while the RouteGarbageCollection alpha
+// feature is enabled, at most every routeGCInterval. It is called with the
+// routes listed by the route controller, so that the collection follows its
+// sync loop.
+func (g *Cloud) maybeCollectOrphanedRoutes(routes []*compute.Route) {
+	if !g.AlphaFeatureGate.Enabled(AlphaFeatureRouteGC) || g.client == nil {
+		return
+	}
+	gc := &g.routeGC
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if gc.running || time.Since(gc.lastRun) < routeGCInterval {
+		return
+	}
+	gc.running, gc.lastRun = true, time.Now()
+	go func() {
+		defer func() {
+			gc.mu.Lock()
+			defer gc.mu.Unlock()
+			gc.running = false
+		}()
+		if err := g.collectOrphanedRoutes(routes); err != nil {
+			klog.Errorf("Failed to collect orphaned routes: %v", err)
+		}
+	}()
+}
+
+// collectOrphanedRoutes deletes the routes of the cluster whose target
+// instance or Node no longer exists, e.g. the routes of the nodes deleted
+// while the controller manager was down, which the route controller does not
+// delete if they are out of the cluster CIDR and which count against the
+// routes quota. The routes are listed before the Nodes and instances, so
+// that the routes of a Node created in between are not mistaken for orphans.
+func (g *Cloud) collectOrphanedRoutes(routes []*compute.Route) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	nodes, err := g.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	nodeNames := sets.NewString()
+	for _, node := range nodes.Items {
+		nodeNames.Insert(mapNodeNameToInstanceName(types.NodeName(node.Name)))
+	}
+	zones := sets.NewString()
+	for _, r := range routes {
+		if zone := routeNextHopZone(r.NextHopInstance); zone != "" {
+			zones.Insert(zone)
+		}
+	}
+	lists, err := g.listZoneInstances(ctx, zones.List(), filter.None, instanceNameFields)
+	if err != nil {
+		return err
+	}
+	instances := map[string]sets.String{}
+	for _, zone := range zones.List() {
+		instances[zone] = sets.NewString()
+		for _, instance := range lists[zone] {
+			instances[zone].Insert(instance.Name)
+		}
+	}
+
+	var deletions []func(context.Context) error
+	for _, r := range routes {
+		zone, target := routeNextHopZone(r.NextHopInstance), path.Base(r.NextHopInstance)
+		if zone == "" || instances[zone].Has(target) && nodeNames.Has(target) {
+			continue
+		}
+		klog.Infof("collectOrphanedRoutes: deleting orphaned route %s to %s of instance %s", r.Name, r.DestRange, r.NextHopInstance)
+		route := &cloudprovider.Route{Name: r.Name, TargetNode: types.NodeName(target), DestinationCIDR: r.DestRange}
+		deletions = append(deletions, func(ctx context.Context) error {
+			return ignoreNotFound(g.deleteRoute(ctx, route))
+		})
+	}
+	return g.runMutations(ctx, deletions...)
+}
+
+// routeNextHopZone returns the zone of the next hop instance of a route,
+// zones/ZONE/instances/NAME or its URL, or "" if it is not an instance.
+func routeNextHopZone(nextHopInstance string) string {
+	parts := strings.Split(nextHopInstance, "/")
+	for i := len(parts) - 4; i >= 0; i-- {
+		if parts[i] == "zones" && parts[i+2] == "instances" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
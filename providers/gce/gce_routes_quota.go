@@ -0,0 +1,110 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultRouteQuotaWarningThreshold is the percentage of the routes
+	// quota of the project above which the route creations are warned about.
+	defaultRouteQuotaWarningThreshold = 90
+	// routeQuotaCheckInterval is the minimum interval between two checks of
+	// the routes quota, so that node scale-ups do not spend API quota.
+	routeQuotaCheckInterval = time.Minute
+	// routeQuotaMetric is the metric of the routes quota of a project.
+	routeQuotaMetric = "ROUTES"
+
+	routeQuotaNearlyExhaustedReason = "RouteQuotaNearlyExhausted"
+	routeQuotaExhaustedReason       = "RouteQuotaExhausted"
+)
+
+// validateRouteQuotaWarningThreshold validates the
+// route-quota-warning-threshold of the cloud config, a percentage which
+// defaults to defaultRouteQuotaWarningThreshold if zero.
+func validateRouteQuotaWarningThreshold(threshold int) error {
+	if threshold < 0 || threshold > 100 {
+		return fmt.Errorf("invalid route-quota-warning-threshold %d, must be a percentage between 1 and 100", threshold)
+	}
+	return nil
+}
+
+// routeQuotaCheck tracks the checks of the routes quota.
+type routeQuotaCheck struct {
+	mu        sync.Mutex
+	lastCheck time.Time
+}
+
+// checkRouteQuota checks, at most every routeQuotaCheckInterval, whether
+// creating the pending routes brings the routes usage of the project above
+// the warning threshold of its quota, and records a warning event if so, so
+// that the quota can be raised before the Pods of new nodes are unreachable.
+// The route creations go on regardless.
+func (g *Cloud) checkRouteQuota(pending int) {
+	c := &g.routeQuotaCheck
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastCheck) < routeQuotaCheckInterval {
+		return
+	}
+	c.lastCheck = time.Now()
+
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	project, err := g.c.Projects().Get(ctx, g.NetworkProjectID())
+	if err != nil {
+		klog.Warningf("Failed to get the routes quota of project %s: %v", g.NetworkProjectID(), err)
+		return
+	}
+	var limit, usage float64
+	found := false
+	for _, quota := range project.Quotas {
+		if quota.Metric == routeQuotaMetric {
+			limit, usage, found = quota.Limit, quota.Usage, true
+			break
+		}
+	}
+	if !found || limit <= 0 {
+		return
+	}
+
+	threshold := g.routeQuotaWarningThreshold
+	if threshold == 0 {
+		threshold = defaultRouteQuotaWarningThreshold
+	}
+	projected := usage + float64(pending)
+	switch {
+	case projected > limit:
+		msg := fmt.Sprintf("Creating %d routes exceeds the routes quota of project %s, %.0f of %.0f routes are used: the Pods of the new nodes will be unreachable until the quota is raised or routes are deleted", pending, g.NetworkProjectID(), usage, limit)
+		klog.Warning(msg)
+		g.recordCloudAPIEvent(v1.EventTypeWarning, routeQuotaExhaustedReason, msg)
+	case projected*100 >= limit*float64(threshold):
+		msg := fmt.Sprintf("Creating %d routes brings the routes usage of project %s to %.0f of %.0f, above the %d%% warning threshold: raise the quota before it is exhausted", pending, g.NetworkProjectID(), projected, limit, threshold)
+		klog.Warning(msg)
+		g.recordCloudAPIEvent(v1.EventTypeWarning, routeQuotaNearlyExhaustedReason, msg)
+	}
+}
@@ -0,0 +1,418 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/component-base/featuregate"
+)
+
+func TestCreateRouteConflict(t *testing.T) {
+	const clusterName = "my-cluster"
+
+	gate := featuregate.NewFeatureGate()
+	require.NoError(t, AddFeatureGates(gate))
+	require.NoError(t, gate.Set("RouteConflictDetection=true"))
+	SetFeatureGate(gate)
+	defer SetFeatureGate(newFeatureGate())
+
+	for _, tc := range []struct {
+		desc         string
+		existing     *compute.Route
+		wantConflict bool
+	}{
+		{
+			desc: "no other routes",
+		},
+		{
+			desc: "same range programmed by another system",
+			existing: &compute.Route{
+				Name:            "cni-route",
+				DestRange:       "10.0.1.0/24",
+				NextHopInstance: "zones/us-central1-b/instances/other",
+			},
+			wantConflict: true,
+		},
+		{
+			desc: "more specific range programmed by another cluster",
+			existing: &compute.Route{
+				Name:            "other-cluster-route",
+				DestRange:       "10.0.1.128/25",
+				NextHopInstance: "zones/us-central1-b/instances/other",
+				Description:     k8sNodeRouteTag,
+			},
+			wantConflict: true,
+		},
+		{
+			desc: "broader range",
+			existing: &compute.Route{
+				Name:           "default-route",
+				DestRange:      "0.0.0.0/0",
+				NextHopGateway: "global/gateways/default-internet-gateway",
+			},
+		},
+		{
+			desc: "stale route of the cluster",
+			existing: &compute.Route{
+				Name:            clusterName + "-old",
+				DestRange:       "10.0.1.0/24",
+				NextHopInstance: "zones/us-central1-b/instances/other",
+				Description:     k8sNodeRouteTag,
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			vals := DefaultTestClusterValues()
+			gce, err := fakeGCECloud(vals)
+			require.NoError(t, err)
+			_, err = createAndInsertNodes(gce, []string{"node-1"}, vals.ZoneName)
+			require.NoError(t, err)
+			if tc.existing != nil {
+				tc.existing.Network = gce.NetworkURL()
+				require.NoError(t, gce.c.Routes().Insert(context.Background(), meta.GlobalKey(tc.existing.Name), tc.existing))
+			}
+
+			route := &cloudprovider.Route{TargetNode: "node-1", DestinationCIDR: "10.0.1.0/24"}
+			err = gce.CreateRoute(context.Background(), clusterName, "node-1", route)
+			if tc.wantConflict {
+				assert.Error(t, err)
+				_, getErr := gce.c.Routes().Get(context.Background(), meta.GlobalKey(clusterName+"-node-1"))
+				assert.Error(t, getErr, "route was created despite the conflict")
+				return
+			}
+			require.NoError(t, err)
+			_, err = gce.c.Routes().Get(context.Background(), meta.GlobalKey(clusterName+"-node-1"))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRoutesAliasIPMode(t *testing.T) {
+	aliasIPInterface := &compute.NetworkInterface{AliasIpRanges: []*compute.AliasIpRange{{IpCidrRange: "10.4.0.0/24"}}}
+	for _, tc := range []struct {
+		desc string
+		mode string
+		// nodes are the network interfaces of the nodes of the cluster.
+		nodes map[string]*compute.NetworkInterface
+		// instances are the network interfaces of the other instances.
+		instances  map[string]*compute.NetworkInterface
+		wantRoutes bool
+		wantErr    bool
+	}{
+		{desc: "enabled", mode: AliasIPModeEnabled},
+		{desc: "disabled", mode: AliasIPModeDisabled, nodes: map[string]*compute.NetworkInterface{"node-1": aliasIPInterface}, wantRoutes: true},
+		{desc: "detected alias IP ranges", mode: AliasIPModeAuto, nodes: map[string]*compute.NetworkInterface{"node-1": aliasIPInterface}},
+		{desc: "detected without mode", nodes: map[string]*compute.NetworkInterface{"node-1": aliasIPInterface}},
+		{desc: "detected routes", mode: AliasIPModeAuto, nodes: map[string]*compute.NetworkInterface{"node-1": {}}, wantRoutes: true},
+		{
+			desc:       "instances not of the cluster ignored",
+			mode:       AliasIPModeAuto,
+			nodes:      map[string]*compute.NetworkInterface{"node-1": {}},
+			instances:  map[string]*compute.NetworkInterface{"a-vm": aliasIPInterface},
+			wantRoutes: true,
+		},
+		{
+			desc:    "nodes disagree",
+			mode:    AliasIPModeAuto,
+			nodes:   map[string]*compute.NetworkInterface{"node-1": {}, "node-2": aliasIPInterface},
+			wantErr: true,
+		},
+		{desc: "no nodes", mode: AliasIPModeAuto, instances: map[string]*compute.NetworkInterface{"a-vm": aliasIPInterface}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			vals := DefaultTestClusterValues()
+			gce, err := fakeGCECloud(vals)
+			require.NoError(t, err)
+			gce.aliasIPMode = tc.mode
+			gce.nodeZones = map[string]sets.String{}
+			for name, iface := range tc.instances {
+				insertAliasIPInstance(t, gce, vals.ZoneName, name, iface)
+			}
+			for name, iface := range tc.nodes {
+				insertAliasIPInstance(t, gce, vals.ZoneName, name, iface)
+				gce.updateNodeZones(nil, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{v1.LabelTopologyZone: vals.ZoneName}}})
+			}
+
+			routes, ok := gce.Routes()
+			require.True(t, ok)
+			if tc.mode == AliasIPModeDisabled {
+				assert.Same(t, gce, routes)
+			}
+			route := &cloudprovider.Route{Name: "my-cluster-node-1", TargetNode: "node-1", DestinationCIDR: "10.4.0.0/24"}
+			err = routes.CreateRoute(context.Background(), "my-cluster", "node-1", route)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_, err = gce.c.Routes().Get(context.Background(), meta.GlobalKey(route.Name))
+			if tc.wantRoutes {
+				assert.NoError(t, err, "route was not created without alias IP ranges")
+				return
+			}
+			assert.Error(t, err, "route was created with alias IP ranges")
+			list, err := routes.ListRoutes(context.Background(), "my-cluster")
+			require.NoError(t, err)
+			assert.Empty(t, list)
+		})
+	}
+}
+
+func TestRoutesAliasIPModeDetectedLater(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	gce.aliasIPMode = AliasIPModeAuto
+	gce.nodeZones = map[string]sets.String{}
+	routes, ok := gce.Routes()
+	require.True(t, ok)
+	route := &cloudprovider.Route{Name: "my-cluster-node-1", TargetNode: "node-1", DestinationCIDR: "10.4.0.0/24"}
+
+	// Failures to list the instances are retried.
+	insertAliasIPInstance(t, gce, vals.ZoneName, "node-1", &compute.NetworkInterface{})
+	gce.updateNodeZones(nil, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{v1.LabelTopologyZone: vals.ZoneName}}})
+	mockGCE := gce.c.(*cloud.MockGCE)
+	listErr := fmt.Errorf("backend error")
+	mockGCE.MockInstances.ListError = &listErr
+	_, err = routes.ListRoutes(context.Background(), "my-cluster")
+	assert.Error(t, err)
+
+	mockGCE.MockInstances.ListError = nil
+	_, err = routes.ListRoutes(context.Background(), "my-cluster")
+	require.NoError(t, err)
+	require.NoError(t, routes.CreateRoute(context.Background(), "my-cluster", "node-1", route))
+	_, err = gce.c.Routes().Get(context.Background(), meta.GlobalKey(route.Name))
+	assert.NoError(t, err, "route was not created once detected")
+}
+
+// insertAliasIPInstance inserts the instance with the network interface.
+func insertAliasIPInstance(t *testing.T, gce *Cloud, zone, name string, iface *compute.NetworkInterface) {
+	t.Helper()
+	require.NoError(t, gce.InsertInstance(gce.ProjectID(), zone, &compute.Instance{
+		Name:              name,
+		Zone:              zone,
+		NetworkInterfaces: []*compute.NetworkInterface{iface},
+	}))
+}
+
+func TestValidateAliasIPMode(t *testing.T) {
+	for _, mode := range []string{"", AliasIPModeAuto, AliasIPModeEnabled, AliasIPModeDisabled} {
+		assert.NoError(t, validateAliasIPMode(mode), mode)
+	}
+	assert.Error(t, validateAliasIPMode("true"))
+}
+
+func TestCreateRoutesBatched(t *testing.T) {
+	const clusterName = "my-cluster"
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	var nodeNames []string
+	for i := 0; i < 50; i++ {
+		nodeNames = append(nodeNames, fmt.Sprintf("node-%d", i))
+	}
+	_, err = createAndInsertNodes(gce, nodeNames, vals.ZoneName)
+	require.NoError(t, err)
+	var instanceGets int32
+	gce.c.(*cloud.MockGCE).MockInstances.GetHook = func(ctx context.Context, key *meta.Key, m *cloud.MockInstances, options ...cloud.Option) (bool, *compute.Instance, error) {
+		atomic.AddInt32(&instanceGets, 1)
+		return false, nil, nil
+	}
+
+	errs := make([]error, len(nodeNames))
+	var wg sync.WaitGroup
+	for i, name := range nodeNames {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			route := &cloudprovider.Route{TargetNode: types.NodeName(name), DestinationCIDR: fmt.Sprintf("10.0.%d.0/24", i)}
+			errs[i] = gce.CreateRoute(context.Background(), clusterName, name, route)
+		}(i, name)
+	}
+	wg.Wait()
+
+	for i, name := range nodeNames {
+		require.NoError(t, errs[i], name)
+		r, err := gce.c.Routes().Get(context.Background(), meta.GlobalKey(clusterName+"-"+name))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("zones/%s/instances/%s", vals.ZoneName, name), r.NextHopInstance)
+	}
+	// The target instances are listed with their batch instead of fetched.
+	assert.Zero(t, atomic.LoadInt32(&instanceGets))
+
+	// The routes of missing instances fail alone.
+	route := &cloudprovider.Route{TargetNode: "missing-node", DestinationCIDR: "10.1.0.0/24"}
+	assert.ErrorIs(t, gce.CreateRoute(context.Background(), clusterName, "missing-node", route), cloudprovider.InstanceNotFound)
+}
+
+func TestCollectOrphanedRoutes(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	_, err = createAndInsertNodes(gce, []string{"live-node", "deleted-node"}, vals.ZoneName)
+	require.NoError(t, err)
+	for _, name := range []string{"live-node", "gone-instance"} {
+		_, err = gce.client.CoreV1().Nodes().Create(context.TODO(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	var routes []*compute.Route
+	for i, target := range []string{"live-node", "deleted-node", "gone-instance"} {
+		r := &compute.Route{
+			Name:            "my-cluster-" + target,
+			DestRange:       fmt.Sprintf("10.0.%d.0/24", i),
+			NextHopInstance: fmt.Sprintf("zones/%s/instances/%s", vals.ZoneName, target),
+			Description:     k8sNodeRouteTag,
+		}
+		require.NoError(t, gce.c.Routes().Insert(context.TODO(), meta.GlobalKey(r.Name), r))
+		routes = append(routes, r)
+	}
+
+	require.NoError(t, gce.collectOrphanedRoutes(routes))
+	_, err = gce.c.Routes().Get(context.TODO(), meta.GlobalKey("my-cluster-live-node"))
+	assert.NoError(t, err)
+	for _, name := range []string{"my-cluster-deleted-node", "my-cluster-gone-instance"} {
+		_, err = gce.c.Routes().Get(context.TODO(), meta.GlobalKey(name))
+		assert.True(t, isNotFound(err), name)
+	}
+}
+
+func TestRouteNextHopZone(t *testing.T) {
+	for nextHop, want := range map[string]string{
+		"zones/us-central1-b/instances/node":                                                  "us-central1-b",
+		"https://www.googleapis.com/compute/v1/projects/p/zones/us-central1-b/instances/node": "us-central1-b",
+		"": "",
+		"global/gateways/default-internet-gateway": "",
+	} {
+		assert.Equal(t, want, routeNextHopZone(nextHop), nextHop)
+	}
+}
+
+func TestCheckRouteQuota(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		usage      float64
+		threshold  int
+		wantReason string
+	}{
+		{desc: "below the threshold", usage: 50},
+		{desc: "above the default threshold", usage: 88, wantReason: routeQuotaNearlyExhaustedReason},
+		{desc: "below a configured threshold", usage: 88, threshold: 95},
+		{desc: "exceeding the quota", usage: 99, wantReason: routeQuotaExhaustedReason},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			vals := DefaultTestClusterValues()
+			gce, err := fakeGCECloud(vals)
+			require.NoError(t, err)
+			recorder := record.NewFakeRecorder(1024)
+			gce.eventRecorder = recorder
+			gce.routeQuotaWarningThreshold = tc.threshold
+			mock := gce.c.(*cloud.MockGCE).MockProjects
+			mock.Objects[*meta.GlobalKey(vals.ProjectID)] = mock.Obj(&compute.Project{
+				Name:   vals.ProjectID,
+				Quotas: []*compute.Quota{{Metric: routeQuotaMetric, Limit: 100, Usage: tc.usage}},
+			})
+
+			gce.checkRouteQuota(2)
+			if tc.wantReason == "" {
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			require.Len(t, recorder.Events, 1)
+			assert.Contains(t, <-recorder.Events, tc.wantReason)
+
+			// The quota is not checked again right away.
+			gce.checkRouteQuota(2)
+			assert.Empty(t, recorder.Events)
+		})
+	}
+}
+
+func TestValidateRouteQuotaWarningThreshold(t *testing.T) {
+	for _, threshold := range []int{0, 1, 90, 100} {
+		assert.NoError(t, validateRouteQuotaWarningThreshold(threshold), threshold)
+	}
+	for _, threshold := range []int{-1, 101} {
+		assert.Error(t, validateRouteQuotaWarningThreshold(threshold), threshold)
+	}
+}
+
+func TestCreateRoutePriorityAndDescription(t *testing.T) {
+	const clusterName = "my-cluster"
+
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	_, err = createAndInsertNodes(gce, []string{"old-node", "new-node"}, vals.ZoneName)
+	require.NoError(t, err)
+
+	route := &cloudprovider.Route{TargetNode: "old-node", DestinationCIDR: "10.0.0.0/24"}
+	require.NoError(t, gce.CreateRoute(context.Background(), clusterName, "old-node", route))
+	gce.routePriority = 900
+	gce.routeDescription = "team=platform"
+	route = &cloudprovider.Route{TargetNode: "new-node", DestinationCIDR: "10.0.1.0/24"}
+	require.NoError(t, gce.CreateRoute(context.Background(), clusterName, "new-node", route))
+
+	r, err := gce.c.Routes().Get(context.Background(), meta.GlobalKey(clusterName+"-old-node"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultRoutePriority), r.Priority)
+	assert.Equal(t, k8sNodeRouteTag, r.Description)
+	r, err = gce.c.Routes().Get(context.Background(), meta.GlobalKey(clusterName+"-new-node"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(900), r.Priority)
+	assert.Equal(t, "k8s-node-route team=platform", r.Description)
+
+	// Both routes are listed, but not the ones of other programmers.
+	other := &compute.Route{Name: clusterName + "-other", DestRange: "10.0.2.0/24", Network: gce.NetworkURL(), Description: k8sNodeRouteTag + "s"}
+	require.NoError(t, gce.c.Routes().Insert(context.Background(), meta.GlobalKey(other.Name), other))
+	list, err := gce.ListRoutes(context.Background(), clusterName)
+	require.NoError(t, err)
+	var names []string
+	for _, r := range list {
+		names = append(names, r.Name)
+	}
+	assert.ElementsMatch(t, []string{clusterName + "-old-node", clusterName + "-new-node"}, names)
+}
+
+func TestValidateRoutePriority(t *testing.T) {
+	for _, priority := range []int{0, 1, 1000, 65535} {
+		assert.NoError(t, validateRoutePriority(priority), priority)
+	}
+	for _, priority := range []int{-1, 65536} {
+		assert.Error(t, validateRoutePriority(priority), priority)
+	}
+}
@@ -56,8 +56,12 @@ func (g *Cloud) CreateBetaSecurityPolicy(sp *computebeta.SecurityPolicy) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "security policy", meta.GlobalKey(sp.Name), sp) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "security policy", meta.GlobalKey(sp.Name), sp)
 	mc := newSecurityPolicyMetricContextWithVersion("create", computeBetaVersion)
-	return mc.Observe(g.c.BetaSecurityPolicies().Insert(ctx, meta.GlobalKey(sp.Name), sp))
+	return mc.Observe(audit(g.c.BetaSecurityPolicies().Insert(ctx, meta.GlobalKey(sp.Name), sp)))
 }
 
 // DeleteBetaSecurityPolicy deletes the given security policy.
@@ -65,8 +69,12 @@ func (g *Cloud) DeleteBetaSecurityPolicy(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "security policy", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "security policy", meta.GlobalKey(name), nil)
 	mc := newSecurityPolicyMetricContextWithVersion("delete", computeBetaVersion)
-	return mc.Observe(g.c.BetaSecurityPolicies().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.BetaSecurityPolicies().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // PatchBetaSecurityPolicy applies the given security policy as a
@@ -75,8 +83,12 @@ func (g *Cloud) PatchBetaSecurityPolicy(sp *computebeta.SecurityPolicy) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("patch", "security policy", meta.GlobalKey(sp.Name), sp) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "patch", "security policy", meta.GlobalKey(sp.Name), sp)
 	mc := newSecurityPolicyMetricContextWithVersion("patch", computeBetaVersion)
-	return mc.Observe(g.c.BetaSecurityPolicies().Patch(ctx, meta.GlobalKey(sp.Name), sp))
+	return mc.Observe(audit(g.c.BetaSecurityPolicies().Patch(ctx, meta.GlobalKey(sp.Name), sp)))
 }
 
 // GetRuleForBetaSecurityPolicy gets rule from a security policy.
@@ -95,8 +107,12 @@ func (g *Cloud) AddRuletoBetaSecurityPolicy(name string, spr *computebeta.Securi
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("add rule to", "security policy", meta.GlobalKey(name), spr) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "add rule to", "security policy", meta.GlobalKey(name), spr)
 	mc := newSecurityPolicyMetricContextWithVersion("add_rule", computeBetaVersion)
-	return mc.Observe(g.c.BetaSecurityPolicies().AddRule(ctx, meta.GlobalKey(name), spr))
+	return mc.Observe(audit(g.c.BetaSecurityPolicies().AddRule(ctx, meta.GlobalKey(name), spr)))
 }
 
 // PatchRuleForBetaSecurityPolicy patches the given security policy
@@ -114,6 +130,10 @@ func (g *Cloud) RemoveRuleFromBetaSecurityPolicy(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("remove rule from", "security policy", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "remove rule from", "security policy", meta.GlobalKey(name), nil)
 	mc := newSecurityPolicyMetricContextWithVersion("remove_rule", computeBetaVersion)
-	return mc.Observe(g.c.BetaSecurityPolicies().RemoveRule(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.BetaSecurityPolicies().RemoveRule(ctx, meta.GlobalKey(name))))
 }
@@ -0,0 +1,86 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func newServiceAttachmentMetricContext(request, region string) *metricContext {
+	return newGenericMetricContext("serviceattachment", request, region, unusedMetricLabel, computeV1Version)
+}
+
+// GetServiceAttachment returns the Private Service Connect service attachment
+// by name & region.
+func (g *Cloud) GetServiceAttachment(name, region string) (*compute.ServiceAttachment, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	mc := newServiceAttachmentMetricContext("get", region)
+	v, err := g.c.ServiceAttachments().Get(ctx, meta.RegionalKey(name, region))
+	return v, mc.Observe(err)
+}
+
+// CreateServiceAttachment creates the Private Service Connect service
+// attachment in the region.
+func (g *Cloud) CreateServiceAttachment(sa *compute.ServiceAttachment, region string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	key := meta.RegionalKey(sa.Name, region)
+	if g.skipMutation("insert", "service attachment", key, sa) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "service attachment", key, sa)
+	mc := newServiceAttachmentMetricContext("create", region)
+	return mc.Observe(audit(g.c.ServiceAttachments().Insert(ctx, key, sa)))
+}
+
+// PatchServiceAttachment patches the Private Service Connect service
+// attachment in the region. The fingerprint of the attachment must be set.
+func (g *Cloud) PatchServiceAttachment(sa *compute.ServiceAttachment, region string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	key := meta.RegionalKey(sa.Name, region)
+	if g.skipMutation("patch", "service attachment", key, sa) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "patch", "service attachment", key, sa)
+	mc := newServiceAttachmentMetricContext("patch", region)
+	return mc.Observe(audit(g.c.ServiceAttachments().Patch(ctx, key, sa)))
+}
+
+// DeleteServiceAttachment deletes the Private Service Connect service
+// attachment by name & region.
+func (g *Cloud) DeleteServiceAttachment(name, region string) error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	key := meta.RegionalKey(name, region)
+	if g.skipMutation("delete", "service attachment", key, nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "service attachment", key, nil)
+	mc := newServiceAttachmentMetricContext("delete", region)
+	return mc.Observe(audit(g.c.ServiceAttachments().Delete(ctx, key)))
+}
@@ -0,0 +1,164 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	compute "google.golang.org/api/compute/v1"
+	"k8s.io/klog/v2"
+)
+
+// resolveSharedVPCProjects merges the Shared VPC host-project-id and
+// service-project-id into network-project-id and project-id, which they are
+// synonyms of.
+func resolveSharedVPCProjects(global *ConfigGlobal) error {
+	merge := func(field *string, name, synonym, value string) error {
+		if value == "" {
+			return nil
+		}
+		if *field != "" && *field != value {
+			return fmt.Errorf("%s %q conflicts with %s %q", synonym, value, name, *field)
+		}
+		*field = value
+		return nil
+	}
+	if err := merge(&global.ProjectID, "project-id", "service-project-id", global.ServiceProjectID); err != nil {
+		return err
+	}
+	return merge(&global.NetworkProjectID, "network-project-id", "host-project-id", global.HostProjectID)
+}
+
+// networkURLs returns the network and subnetwork URLs of the cloud config,
+// by the name of their config field.
+func networkURLs(cloudConfig *CloudConfig) []struct{ name, url string } {
+	return []struct{ name, url string }{
+		{"network-name", cloudConfig.NetworkURL},
+		{"subnetwork-name", cloudConfig.SubnetworkURL},
+	}
+}
+
+// resolveNetworkProject sets the network project of the cloud config to the
+// project of its network and subnetwork URLs if it was not configured, and
+// checks that they all agree otherwise. A project number and a project name
+// cannot be compared before the numbers are converted to names, which
+// checkNetworkProjectNames does.
+func resolveNetworkProject(cloudConfig *CloudConfig) error {
+	for _, u := range networkURLs(cloudConfig) {
+		if u.url == "" {
+			continue
+		}
+		id, err := cloud.ParseResourceURL(u.url)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", u.name, u.url, err)
+		}
+		switch {
+		case cloudConfig.NetworkProjectID == "":
+			// The network is in the project of the cluster unless its URL
+			// says otherwise.
+			if id.ProjectID != cloudConfig.ProjectID {
+				cloudConfig.NetworkProjectID = id.ProjectID
+			}
+		case isProjectNumber(id.ProjectID) != isProjectNumber(cloudConfig.NetworkProjectID):
+			// Checked by checkNetworkProjectNames.
+		case id.ProjectID != cloudConfig.NetworkProjectID:
+			return fmt.Errorf("%s %q is not in the network project %q", u.name, u.url, cloudConfig.NetworkProjectID)
+		}
+	}
+	return nil
+}
+
+// checkNetworkProjectNames checks that the network and subnetwork URLs of the
+// cloud config are in the network project netProjID, once their project
+// numbers are converted to names like it was by tryConvertToProjectNames. The
+// projects whose name could not be retrieved are only warned about.
+func checkNetworkProjectNames(cloudConfig *CloudConfig, netProjID string, service *compute.Service) error {
+	for _, u := range networkURLs(cloudConfig) {
+		if u.url == "" {
+			continue
+		}
+		id, err := cloud.ParseResourceURL(u.url)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", u.name, u.url, err)
+		}
+		project := id.ProjectID
+		if isProjectNumber(project) {
+			name, err := getProjectID(service, project)
+			if err != nil {
+				klog.Warningf("Failed to retrieve project %v of %s %q while checking it is in the network project %v. err %v", project, u.name, u.url, netProjID, err)
+				continue
+			}
+			project = name
+		}
+		if project == netProjID {
+			continue
+		}
+		if isProjectNumber(netProjID) {
+			klog.Warningf("Could not check that %s %q is in the network project %v, whose name could not be retrieved", u.name, u.url, netProjID)
+			continue
+		}
+		return fmt.Errorf("%s %q is not in the network project %q", u.name, u.url, netProjID)
+	}
+	return nil
+}
+
+// loadHostProjectTokenSource returns the token source of the JSON
+// credentials file used for the API calls to the Shared VPC host project. Its
+// token exchanges, if any, are charged to the quota project if not empty.
+func loadHostProjectTokenSource(path, quotaProject string) (oauth2.TokenSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host-project-credentials-file: %v", err)
+	}
+	creds, err := google.CredentialsFromJSON(withQuotaProject(context.Background(), quotaProject), data, compute.CloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host-project-credentials-file %q: %v", path, err)
+	}
+	return creds.TokenSource, nil
+}
+
+// hostProjectTransport sends the GCE API requests for the resources of the
+// Shared VPC host project, e.g. its firewalls, routes and subnetworks, with
+// the host project credentials, and the other requests with the credentials
+// of the cloud provider.
+type hostProjectTransport struct {
+	base http.RoundTripper
+	host http.RoundTripper
+	// projects are the name and number of the host project. They are only
+	// set while the cloud is created, before any concurrent request.
+	projects []string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *hostProjectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, project := range t.projects {
+		if strings.Contains(req.URL.Path, "/projects/"+project+"/") {
+			return t.host.RoundTrip(req)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,221 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+func TestGenerateCloudConfigSharedVPC(t *testing.T) {
+	onGCE := metadataOnGCE
+	defer func() { metadataOnGCE = onGCE }()
+	metadataOnGCE = func() bool { return true }
+
+	credentialsFile := filepath.Join(t.TempDir(), "host-project.json")
+	require.NoError(t, os.WriteFile(credentialsFile, []byte(`{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "token"}`), 0600))
+
+	for _, tc := range []struct {
+		desc          string
+		config        func(*ConfigGlobal)
+		wantErr       bool
+		wantHostCreds bool
+	}{
+		{
+			desc: "service-project-id conflicts with project-id",
+			config: func(c *ConfigGlobal) {
+				c.ServiceProjectID = "other-project"
+			},
+			wantErr: true,
+		},
+		{
+			desc: "host-project-id conflicts with network-project-id",
+			config: func(c *ConfigGlobal) {
+				c.NetworkProjectID = "host-project"
+				c.HostProjectID = "other-project"
+			},
+			wantErr: true,
+		},
+		{
+			desc: "subnetwork URL outside of the host project",
+			config: func(c *ConfigGlobal) {
+				c.HostProjectID = "host-project"
+				c.SubnetworkName = "https://www.googleapis.com/compute/v1/projects/other-project/regions/us-central1/subnetworks/my-subnetwork"
+			},
+			wantErr: true,
+		},
+		{
+			desc: "network and subnetwork URLs in different projects",
+			config: func(c *ConfigGlobal) {
+				c.NetworkName = "https://www.googleapis.com/compute/v1/projects/host-project/global/networks/my-network"
+				c.SubnetworkName = "https://www.googleapis.com/compute/v1/projects/other-project/regions/us-central1/subnetworks/my-subnetwork"
+			},
+			wantErr: true,
+		},
+		{
+			desc: "subnetwork URL by number of the host project",
+			config: func(c *ConfigGlobal) {
+				c.HostProjectID = "host-project"
+				c.SubnetworkName = "https://www.googleapis.com/compute/v1/projects/1234/regions/us-central1/subnetworks/my-subnetwork"
+			},
+		},
+		{
+			desc: "host project credentials",
+			config: func(c *ConfigGlobal) {
+				c.HostProjectID = "host-project"
+				c.HostProjectCredentialsFile = credentialsFile
+			},
+			wantHostCreds: true,
+		},
+		{
+			desc: "host project credentials without host project",
+			config: func(c *ConfigGlobal) {
+				c.HostProjectCredentialsFile = credentialsFile
+			},
+			wantErr: true,
+		},
+		{
+			desc: "missing host project credentials",
+			config: func(c *ConfigGlobal) {
+				c.HostProjectID = "host-project"
+				c.HostProjectCredentialsFile = filepath.Join(t.TempDir(), "missing.json")
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			config := ConfigGlobal{
+				ProjectID:   "project-id",
+				NetworkName: "network-name",
+				LocalZone:   "us-central1-a",
+			}
+			tc.config(&config)
+			cloudConfig, err := generateCloudConfig(&ConfigFile{Global: config})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantHostCreds, cloudConfig.HostProjectTokenSource != nil)
+		})
+	}
+}
+
+func TestCheckNetworkProjectNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/compute/v1/projects/1234":
+			json.NewEncoder(w).Encode(&compute.Project{Name: "host-project"})
+		case "/compute/v1/projects/5678":
+			json.NewEncoder(w).Encode(&compute.Project{Name: "other-project"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	service, err := compute.NewService(context.Background(), option.WithEndpoint(srv.URL+"/compute/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		desc          string
+		subnetworkURL string
+		netProjID     string
+		wantErr       bool
+	}{
+		{
+			desc:          "same project name",
+			subnetworkURL: "https://www.googleapis.com/compute/v1/projects/host-project/regions/us-central1/subnetworks/subnet",
+			netProjID:     "host-project",
+		},
+		{
+			desc:          "number of the network project",
+			subnetworkURL: "https://www.googleapis.com/compute/v1/projects/1234/regions/us-central1/subnetworks/subnet",
+			netProjID:     "host-project",
+		},
+		{
+			desc:          "number of another project",
+			subnetworkURL: "https://www.googleapis.com/compute/v1/projects/5678/regions/us-central1/subnetworks/subnet",
+			netProjID:     "host-project",
+			wantErr:       true,
+		},
+		{
+			desc:          "unknown project number",
+			subnetworkURL: "https://www.googleapis.com/compute/v1/projects/9999/regions/us-central1/subnetworks/subnet",
+			netProjID:     "host-project",
+		},
+		{
+			desc:          "unconverted network project number",
+			subnetworkURL: "https://www.googleapis.com/compute/v1/projects/host-project/regions/us-central1/subnetworks/subnet",
+			netProjID:     "9999",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := checkNetworkProjectNames(&CloudConfig{SubnetworkURL: tc.subnetworkURL}, tc.netProjID, service)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+type recordingTransport struct {
+	paths []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.paths = append(t.paths, req.URL.Path)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestHostProjectTransport(t *testing.T) {
+	base, host := &recordingTransport{}, &recordingTransport{}
+	transport := &hostProjectTransport{base: base, host: host, projects: []string{"1234", "host-project"}}
+	for _, path := range []string{
+		"/compute/v1/projects/host-project/global/firewalls/k8s-fw",
+		"/compute/v1/projects/1234/regions/us-central1/subnetworks/subnet",
+		"/compute/v1/projects/service-project/zones/us-central1-a/instances/node",
+		"/compute/v1/projects/host-project-2/global/routes/route",
+	} {
+		req, err := http.NewRequest(http.MethodGet, "https://compute.googleapis.com"+path, nil)
+		require.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"/compute/v1/projects/host-project/global/firewalls/k8s-fw",
+		"/compute/v1/projects/1234/regions/us-central1/subnetworks/subnet",
+	}, host.paths)
+	assert.Equal(t, []string{
+		"/compute/v1/projects/service-project/zones/us-central1-a/instances/node",
+		"/compute/v1/projects/host-project-2/global/routes/route",
+	}, base.paths)
+}
@@ -0,0 +1,162 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/googleapi"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+const (
+	// SyncLoopRoute is the sync loop of the route controller, which lists the
+	// cluster routes on every reconciliation.
+	SyncLoopRoute = "route"
+	// SyncLoopService is the sync loop of the service controller, which
+	// ensures, updates and deletes load balancers.
+	SyncLoopService = "service"
+	// SyncLoopNode is the sync loop of the cloud node controller, which
+	// periodically fetches the metadata of every Node instance.
+	SyncLoopNode = "node"
+	// SyncLoopNodeLifecycle is the sync loop of the cloud node lifecycle
+	// controller, which checks whether the instances of NotReady Nodes exist.
+	SyncLoopNodeLifecycle = "node-lifecycle"
+
+	// apiReachabilityCacheTTL is how long the result of a GCE API reachability
+	// check is reused, so that frequent probes do not spend API quota.
+	apiReachabilityCacheTTL = 30 * time.Second
+)
+
+// periodicSyncLoops are the sync loops that call the cloud provider on a
+// period, and are stalled if they have not done so for a while.
+var periodicSyncLoops = map[string]bool{
+	SyncLoopRoute: true,
+	SyncLoopNode:  true,
+}
+
+type syncLoopState struct {
+	lastAttempt  time.Time
+	lastSuccess  time.Time
+	failingSince time.Time
+	lastErr      error
+}
+
+// syncHealth tracks the outcome of the cloud provider calls made by the
+// sync loops of the controllers. Its zero value is ready to use.
+type syncHealth struct {
+	mu    sync.Mutex
+	loops map[string]*syncLoopState
+
+	apiCheckTime time.Time
+	apiCheckErr  error
+}
+
+// record records the outcome of a cloud provider call made by loop.
+// Calls handled by another controller are not recorded.
+func (h *syncHealth) record(loop string, err error) {
+	if errors.Is(err, cloudprovider.ImplementedElsewhere) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.loops == nil {
+		h.loops = map[string]*syncLoopState{}
+	}
+	state, ok := h.loops[loop]
+	if !ok {
+		state = &syncLoopState{}
+		h.loops[loop] = state
+	}
+	now := time.Now()
+	state.lastAttempt = now
+	state.lastErr = err
+	switch {
+	case err == nil:
+		state.lastSuccess = now
+		state.failingSince = time.Time{}
+	case isGCEAPIError(err):
+		// The loop syncs but GCE fails the calls, which restarting the
+		// controller does not fix.
+		state.failingSince = time.Time{}
+	case state.failingSince.IsZero():
+		state.failingSince = now
+	}
+}
+
+// isGCEAPIError returns whether err was returned by the GCE API, or by the
+// circuit breaker suspending its calls.
+func isGCEAPIError(err error) bool {
+	var apiErr *googleapi.Error
+	var circuitErr *apiCircuitOpenError
+	return errors.As(err, &apiErr) || errors.As(err, &circuitErr)
+}
+
+// CheckSyncLoop returns an error if the sync loop has only failed for longer
+// than timeout, or, for loops that sync periodically, if it has not synced for
+// longer than timeout. A loop that has not synced yet is healthy, and so is a
+// loop whose calls fail with errors of the GCE API.
+func (g *Cloud) CheckSyncLoop(loop string, timeout time.Duration) error {
+	h := &g.syncHealth
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.loops[loop]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if !state.failingSince.IsZero() && now.Sub(state.failingSince) > timeout {
+		return fmt.Errorf("%s sync failing since %v, last successful sync at %v: %v", loop, state.failingSince.Format(time.RFC3339), formatSyncTime(state.lastSuccess), state.lastErr)
+	}
+	if periodicSyncLoops[loop] && now.Sub(state.lastAttempt) > timeout {
+		return fmt.Errorf("%s sync stalled, last sync attempted at %v", loop, state.lastAttempt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func formatSyncTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// CheckAPIReachable returns an error if the GCE API cannot be reached with the
+// credentials of the cloud provider. The result is cached for a short time.
+func (g *Cloud) CheckAPIReachable(ctx context.Context) error {
+	h := &g.syncHealth
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.apiCheckTime.IsZero() && time.Since(h.apiCheckTime) < apiReachabilityCacheTTL {
+		return h.apiCheckErr
+	}
+	_, err := g.c.Zones().Get(ctx, meta.GlobalKey(g.localZone))
+	if err != nil {
+		err = fmt.Errorf("GCE API unreachable: %w", err)
+	}
+	h.apiCheckTime = time.Now()
+	h.apiCheckErr = err
+	return err
+}
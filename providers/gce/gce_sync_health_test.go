@@ -0,0 +1,94 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+func TestCheckSyncLoop(t *testing.T) {
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	const timeout = time.Minute
+
+	// Loops that have not synced yet are healthy.
+	assert.NoError(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+
+	gce.syncHealth.record(SyncLoopRoute, nil)
+	assert.NoError(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+
+	// Failures are tolerated for the timeout.
+	gce.syncHealth.record(SyncLoopRoute, errors.New("invalid route"))
+	assert.NoError(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+	gce.syncHealth.loops[SyncLoopRoute].failingSince = time.Now().Add(-2 * timeout)
+	assert.Error(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+
+	// A successful sync makes the loop healthy again.
+	gce.syncHealth.record(SyncLoopRoute, nil)
+	assert.NoError(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+
+	// Errors of the GCE API do not fail the loop.
+	gce.syncHealth.loops[SyncLoopRoute].failingSince = time.Now().Add(-2 * timeout)
+	gce.syncHealth.record(SyncLoopRoute, fmt.Errorf("list routes: %w", &googleapi.Error{Code: http.StatusTooManyRequests, Message: "quota exceeded"}))
+	assert.NoError(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+	gce.syncHealth.record(SyncLoopRoute, &apiCircuitOpenError{service: "Routes", until: time.Now().Add(time.Minute)})
+	assert.NoError(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+
+	// Periodic loops are stalled if they stop syncing, others are not.
+	gce.syncHealth.loops[SyncLoopRoute].lastAttempt = time.Now().Add(-2 * timeout)
+	assert.Error(t, gce.CheckSyncLoop(SyncLoopRoute, timeout))
+	gce.syncHealth.record(SyncLoopService, nil)
+	gce.syncHealth.loops[SyncLoopService].lastAttempt = time.Now().Add(-2 * timeout)
+	assert.NoError(t, gce.CheckSyncLoop(SyncLoopService, timeout))
+
+	// Syncs handled by another controller are not recorded.
+	gce.syncHealth.record(SyncLoopService, cloudprovider.ImplementedElsewhere)
+	assert.Nil(t, gce.syncHealth.loops[SyncLoopService].lastErr)
+}
+
+func TestCheckAPIReachable(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	mockGCE := gce.c.(*cloud.MockGCE)
+	key := meta.GlobalKey(vals.ZoneName)
+	mockGCE.MockZones.Objects[*key] = &cloud.MockZonesObj{Obj: &compute.Zone{Name: vals.ZoneName}}
+
+	assert.NoError(t, gce.CheckAPIReachable(context.Background()))
+
+	// The cached result is used until it expires.
+	mockGCE.MockZones.GetError[*key] = errors.New("connection refused")
+	assert.NoError(t, gce.CheckAPIReachable(context.Background()))
+	gce.syncHealth.apiCheckTime = time.Now().Add(-2 * apiReachabilityCacheTTL)
+	assert.Error(t, gce.CheckAPIReachable(context.Background()))
+}
@@ -23,6 +23,7 @@ import (
 	compute "google.golang.org/api/compute/v1"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 )
 
@@ -40,13 +41,27 @@ func (g *Cloud) GetTargetPool(name, region string) (*compute.TargetPool, error)
 	return v, mc.Observe(err)
 }
 
+// ListTargetPools lists all TargetPools in the project & region.
+func (g *Cloud) ListTargetPools(region string) ([]*compute.TargetPool, error) {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+
+	mc := newTargetPoolMetricContext("list", region)
+	v, err := g.c.TargetPools().List(ctx, region, filter.None)
+	return v, mc.Observe(err)
+}
+
 // CreateTargetPool creates the passed TargetPool
 func (g *Cloud) CreateTargetPool(tp *compute.TargetPool, region string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "target pool", meta.RegionalKey(tp.Name, region), tp) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "target pool", meta.RegionalKey(tp.Name, region), tp)
 	mc := newTargetPoolMetricContext("create", region)
-	return mc.Observe(g.c.TargetPools().Insert(ctx, meta.RegionalKey(tp.Name, region), tp))
+	return mc.Observe(audit(g.c.TargetPools().Insert(ctx, meta.RegionalKey(tp.Name, region), tp)))
 }
 
 // DeleteTargetPool deletes TargetPool by name.
@@ -54,8 +69,12 @@ func (g *Cloud) DeleteTargetPool(name, region string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "target pool", meta.RegionalKey(name, region), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "target pool", meta.RegionalKey(name, region), nil)
 	mc := newTargetPoolMetricContext("delete", region)
-	return mc.Observe(g.c.TargetPools().Delete(ctx, meta.RegionalKey(name, region)))
+	return mc.Observe(audit(g.c.TargetPools().Delete(ctx, meta.RegionalKey(name, region))))
 }
 
 // AddInstancesToTargetPool adds instances by link to the TargetPool
@@ -66,8 +85,12 @@ func (g *Cloud) AddInstancesToTargetPool(name, region string, instanceRefs []*co
 	req := &compute.TargetPoolsAddInstanceRequest{
 		Instances: instanceRefs,
 	}
+	if g.skipMutation("add instances to", "target pool", meta.RegionalKey(name, region), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "add instances to", "target pool", meta.RegionalKey(name, region), req)
 	mc := newTargetPoolMetricContext("add_instances", region)
-	return mc.Observe(g.c.TargetPools().AddInstance(ctx, meta.RegionalKey(name, region), req))
+	return mc.Observe(audit(g.c.TargetPools().AddInstance(ctx, meta.RegionalKey(name, region), req)))
 }
 
 // RemoveInstancesFromTargetPool removes instances by link to the TargetPool
@@ -78,6 +101,10 @@ func (g *Cloud) RemoveInstancesFromTargetPool(name, region string, instanceRefs
 	req := &compute.TargetPoolsRemoveInstanceRequest{
 		Instances: instanceRefs,
 	}
+	if g.skipMutation("remove instances from", "target pool", meta.RegionalKey(name, region), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "remove instances from", "target pool", meta.RegionalKey(name, region), req)
 	mc := newTargetPoolMetricContext("remove_instances", region)
-	return mc.Observe(g.c.TargetPools().RemoveInstance(ctx, meta.RegionalKey(name, region), req))
+	return mc.Observe(audit(g.c.TargetPools().RemoveInstance(ctx, meta.RegionalKey(name, region), req)))
 }
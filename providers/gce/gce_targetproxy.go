@@ -46,8 +46,12 @@ func (g *Cloud) CreateTargetHTTPProxy(proxy *compute.TargetHttpProxy) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "target HTTP proxy", meta.GlobalKey(proxy.Name), proxy) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "target HTTP proxy", meta.GlobalKey(proxy.Name), proxy)
 	mc := newTargetProxyMetricContext("create")
-	return mc.Observe(g.c.TargetHttpProxies().Insert(ctx, meta.GlobalKey(proxy.Name), proxy))
+	return mc.Observe(audit(g.c.TargetHttpProxies().Insert(ctx, meta.GlobalKey(proxy.Name), proxy)))
 }
 
 // SetURLMapForTargetHTTPProxy sets the given UrlMap for the given TargetHttpProxy.
@@ -56,8 +60,12 @@ func (g *Cloud) SetURLMapForTargetHTTPProxy(proxy *compute.TargetHttpProxy, urlM
 	defer cancel()
 
 	ref := &compute.UrlMapReference{UrlMap: urlMapLink}
+	if g.skipMutation("set URL map of", "target HTTP proxy", meta.GlobalKey(proxy.Name), ref) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "set URL map of", "target HTTP proxy", meta.GlobalKey(proxy.Name), ref)
 	mc := newTargetProxyMetricContext("set_url_map")
-	return mc.Observe(g.c.TargetHttpProxies().SetUrlMap(ctx, meta.GlobalKey(proxy.Name), ref))
+	return mc.Observe(audit(g.c.TargetHttpProxies().SetUrlMap(ctx, meta.GlobalKey(proxy.Name), ref)))
 }
 
 // DeleteTargetHTTPProxy deletes the TargetHttpProxy by name.
@@ -65,8 +73,12 @@ func (g *Cloud) DeleteTargetHTTPProxy(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "target HTTP proxy", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "target HTTP proxy", meta.GlobalKey(name), nil)
 	mc := newTargetProxyMetricContext("delete")
-	return mc.Observe(g.c.TargetHttpProxies().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.TargetHttpProxies().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // ListTargetHTTPProxies lists all TargetHttpProxies in the project.
@@ -96,8 +108,12 @@ func (g *Cloud) CreateTargetHTTPSProxy(proxy *compute.TargetHttpsProxy) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "target HTTPS proxy", meta.GlobalKey(proxy.Name), proxy) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "target HTTPS proxy", meta.GlobalKey(proxy.Name), proxy)
 	mc := newTargetProxyMetricContext("create")
-	return mc.Observe(g.c.TargetHttpsProxies().Insert(ctx, meta.GlobalKey(proxy.Name), proxy))
+	return mc.Observe(audit(g.c.TargetHttpsProxies().Insert(ctx, meta.GlobalKey(proxy.Name), proxy)))
 }
 
 // SetURLMapForTargetHTTPSProxy sets the given UrlMap for the given TargetHttpsProxy.
@@ -107,7 +123,11 @@ func (g *Cloud) SetURLMapForTargetHTTPSProxy(proxy *compute.TargetHttpsProxy, ur
 
 	mc := newTargetProxyMetricContext("set_url_map")
 	ref := &compute.UrlMapReference{UrlMap: urlMapLink}
-	return mc.Observe(g.c.TargetHttpsProxies().SetUrlMap(ctx, meta.GlobalKey(proxy.Name), ref))
+	if g.skipMutation("set URL map of", "target HTTPS proxy", meta.GlobalKey(proxy.Name), ref) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "set URL map of", "target HTTPS proxy", meta.GlobalKey(proxy.Name), ref)
+	return mc.Observe(audit(g.c.TargetHttpsProxies().SetUrlMap(ctx, meta.GlobalKey(proxy.Name), ref)))
 }
 
 // SetSslCertificateForTargetHTTPSProxy sets the given SslCertificate for the given TargetHttpsProxy.
@@ -119,7 +139,11 @@ func (g *Cloud) SetSslCertificateForTargetHTTPSProxy(proxy *compute.TargetHttpsP
 	req := &compute.TargetHttpsProxiesSetSslCertificatesRequest{
 		SslCertificates: sslCertURLs,
 	}
-	return mc.Observe(g.c.TargetHttpsProxies().SetSslCertificates(ctx, meta.GlobalKey(proxy.Name), req))
+	if g.skipMutation("set SSL certificates of", "target HTTPS proxy", meta.GlobalKey(proxy.Name), req) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "set SSL certificates of", "target HTTPS proxy", meta.GlobalKey(proxy.Name), req)
+	return mc.Observe(audit(g.c.TargetHttpsProxies().SetSslCertificates(ctx, meta.GlobalKey(proxy.Name), req)))
 }
 
 // DeleteTargetHTTPSProxy deletes the TargetHttpsProxy by name.
@@ -127,8 +151,12 @@ func (g *Cloud) DeleteTargetHTTPSProxy(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "target HTTPS proxy", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "target HTTPS proxy", meta.GlobalKey(name), nil)
 	mc := newTargetProxyMetricContext("delete")
-	return mc.Observe(g.c.TargetHttpsProxies().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.TargetHttpsProxies().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // ListTargetHTTPSProxies lists all TargetHttpsProxies in the project.
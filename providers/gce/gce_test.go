@@ -323,6 +323,10 @@ func TestGetZoneByProviderID(t *testing.T) {
 }
 
 func TestGenerateCloudConfigs(t *testing.T) {
+	onGCE := metadataOnGCE
+	defer func() { metadataOnGCE = onGCE }()
+	metadataOnGCE = func() bool { return true }
+
 	configBoilerplate := ConfigGlobal{
 		TokenURL:           "",
 		TokenBody:          "",
@@ -340,22 +344,23 @@ func TestGenerateCloudConfigs(t *testing.T) {
 	}
 
 	cloudBoilerplate := CloudConfig{
-		APIEndpoint:        "",
-		ProjectID:          "project-id",
-		NetworkProjectID:   "",
-		Region:             "us-central1",
-		Zone:               "us-central1-a",
-		ManagedZones:       []string{"us-central1-a"},
-		NetworkName:        "network-name",
-		SubnetworkName:     "",
-		NetworkURL:         "",
-		SubnetworkURL:      "",
-		SecondaryRangeName: "",
-		NodeTags:           []string{"node-tag"},
-		TokenSource:        google.ComputeTokenSource(""),
-		NodeInstancePrefix: "node-prefix",
-		UseMetadataServer:  true,
-		AlphaFeatureGate:   &AlphaFeatureGate{map[string]bool{}},
+		APIEndpoint:         "",
+		ProjectID:           "project-id",
+		NetworkProjectID:    "",
+		Region:              "us-central1",
+		Zone:                "us-central1-a",
+		ManagedZones:        []string{"us-central1-a"},
+		NetworkName:         "network-name",
+		SubnetworkName:      "",
+		NetworkURL:          "",
+		SubnetworkURL:       "",
+		SecondaryRangeName:  "",
+		NodeTags:            []string{"node-tag"},
+		TokenSource:         google.ComputeTokenSource(""),
+		NodeInstancePrefix:  "node-prefix",
+		UseMetadataServer:   true,
+		AlphaFeatureGate:    &AlphaFeatureGate{map[string]bool{}},
+		ZoneDiscoveryPeriod: defaultZoneDiscoveryPeriod,
 	}
 
 	testCases := []struct {
@@ -407,6 +412,23 @@ func TestGenerateCloudConfigs(t *testing.T) {
 				return v
 			},
 		},
+		{
+			name: "Specified API endpoints of the API families",
+			config: func() ConfigGlobal {
+				v := configBoilerplate
+				v.ContainerAPIEndpoint = "https://container-private.p.googleapis.com"
+				v.TPUAPIEndpoint = "https://tpu-private.p.googleapis.com/"
+				v.NetworkServicesAPIEndpoint = "http://localhost:8080/"
+				return v
+			},
+			cloud: func() CloudConfig {
+				v := cloudBoilerplate
+				v.ContainerAPIEndpoint = "https://container-private.p.googleapis.com/"
+				v.TPUAPIEndpoint = "https://tpu-private.p.googleapis.com/"
+				v.NetworkServicesAPIEndpoint = "http://localhost:8080/"
+				return v
+			},
+		},
 		{
 			name: "Network & Subnetwork names",
 			config: func() ConfigGlobal {
@@ -439,6 +461,37 @@ func TestGenerateCloudConfigs(t *testing.T) {
 				return v
 			},
 		},
+		{
+			name: "Shared VPC host and service projects",
+			config: func() ConfigGlobal {
+				v := configBoilerplate
+				v.ProjectID = ""
+				v.ServiceProjectID = "service-project"
+				v.HostProjectID = "host-project"
+				return v
+			},
+			cloud: func() CloudConfig {
+				v := cloudBoilerplate
+				v.ProjectID = "service-project"
+				v.NetworkProjectID = "host-project"
+				return v
+			},
+		},
+		{
+			name: "Shared VPC network URL",
+			config: func() ConfigGlobal {
+				v := configBoilerplate
+				v.NetworkName = "https://www.googleapis.com/compute/v1/projects/host-project/global/networks/my-network"
+				return v
+			},
+			cloud: func() CloudConfig {
+				v := cloudBoilerplate
+				v.NetworkName = ""
+				v.NetworkURL = "https://www.googleapis.com/compute/v1/projects/host-project/global/networks/my-network"
+				v.NetworkProjectID = "host-project"
+				return v
+			},
+		},
 		{
 			name: "Multizone",
 			config: func() ConfigGlobal {
@@ -479,6 +532,58 @@ func TestGenerateCloudConfigs(t *testing.T) {
 				return v
 			},
 		},
+		{
+			name: "Disk Encryption KMS Key",
+			config: func() ConfigGlobal {
+				v := configBoilerplate
+				v.DiskEncryptionKMSKey = "projects/kms-project/locations/us-central1/keyRings/ring/cryptoKeys/key"
+				return v
+			},
+			cloud: func() CloudConfig {
+				v := cloudBoilerplate
+				v.DiskEncryptionKMSKey = "projects/kms-project/locations/us-central1/keyRings/ring/cryptoKeys/key"
+				return v
+			},
+		},
+		{
+			name: "Zone Discovery Disabled",
+			config: func() ConfigGlobal {
+				v := configBoilerplate
+				v.ZoneDiscoveryPeriod = "0"
+				return v
+			},
+			cloud: func() CloudConfig {
+				v := cloudBoilerplate
+				v.ZoneDiscoveryPeriod = 0
+				return v
+			},
+		},
+		{
+			name: "Max In Flight Operations",
+			config: func() ConfigGlobal {
+				v := configBoilerplate
+				v.MaxInFlightOperations = 20
+				return v
+			},
+			cloud: func() CloudConfig {
+				v := cloudBoilerplate
+				v.MaxInFlightOperations = 20
+				return v
+			},
+		},
+		{
+			name: "Quota Project",
+			config: func() ConfigGlobal {
+				v := configBoilerplate
+				v.QuotaProjectID = "billing-project"
+				return v
+			},
+			cloud: func() CloudConfig {
+				v := cloudBoilerplate
+				v.QuotaProjectID = "billing-project"
+				return v
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -496,6 +601,40 @@ func TestGenerateCloudConfigs(t *testing.T) {
 	}
 }
 
+func TestGenerateCloudConfigOffGCE(t *testing.T) {
+	onGCE := metadataOnGCE
+	defer func() { metadataOnGCE = onGCE }()
+	metadataOnGCE = func() bool { return false }
+
+	config := ConfigGlobal{
+		ProjectID:   "project-id",
+		NetworkName: "network-name",
+		LocalZone:   "us-central1-a",
+	}
+	cloudConfig, err := generateCloudConfig(&ConfigFile{Global: config})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cloudConfig.TokenSource != nil {
+		t.Errorf("Got token source %v, want nil to use Application Default Credentials", cloudConfig.TokenSource)
+	}
+	if cloudConfig.UseMetadataServer {
+		t.Errorf("Got UseMetadataServer true, want false")
+	}
+
+	for _, missing := range []func(*ConfigGlobal){
+		func(c *ConfigGlobal) { c.ProjectID = "" },
+		func(c *ConfigGlobal) { c.LocalZone = "" },
+		func(c *ConfigGlobal) { c.NetworkName = "" },
+	} {
+		c := config
+		missing(&c)
+		if _, err := generateCloudConfig(&ConfigFile{Global: c}); err == nil {
+			t.Errorf("Expected error for incomplete config %+v when not running on GCE", c)
+		}
+	}
+}
+
 func TestNewAlphaFeatureGate(t *testing.T) {
 	testCases := []struct {
 		alphaFeatures  []string
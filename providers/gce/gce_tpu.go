@@ -25,22 +25,34 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
 	tpuapi "google.golang.org/api/tpu/v1"
 	"k8s.io/klog/v2"
+)
 
-	"k8s.io/apimachinery/pkg/util/wait"
+// The TPU operations, e.g. the creation of a TPU node, take minutes, so they
+// are polled less often than the GCE operations. These are variables instead
+// of consts to enable testing.
+var (
+	tpuOperationPollBaseInterval = 5 * time.Second
+	tpuOperationPollMaxInterval  = 30 * time.Second
 )
 
 // newTPUService returns a new tpuService using the client to communicate with
-// the Cloud TPU APIs.
-func newTPUService() (*tpuService, error) {
-	s, err := tpuapi.NewService(context.Background())
+// the Cloud TPU APIs at the endpoint, or at the default endpoint if blank.
+func newTPUService(endpoint string, opts ...option.ClientOption) (*tpuService, error) {
+	s, err := tpuapi.NewService(context.Background(), opts...)
 	if err != nil {
 		return nil, err
 	}
+	if endpoint != "" {
+		s.BasePath = endpoint
+	}
 	return &tpuService{
 		projects: tpuapi.NewProjectsService(s),
+		basePath: s.BasePath,
 	}, nil
 }
 
@@ -48,6 +60,8 @@ func newTPUService() (*tpuService, error) {
 // nodes.
 type tpuService struct {
 	projects *tpuapi.ProjectsService
+	// basePath is the endpoint of the Cloud TPU APIs.
+	basePath string
 }
 
 // CreateTPU creates the Cloud TPU node with the specified name in the
@@ -57,6 +71,9 @@ func (g *Cloud) CreateTPU(ctx context.Context, name, zone string, node *tpuapi.N
 	mc := newTPUMetricContext("create", zone)
 	defer mc.Observe(err)
 
+	if g.skipMutation("insert", "TPU", meta.ZonalKey(name, zone), node) {
+		return node, nil
+	}
 	var op *tpuapi.Operation
 	parent := getTPUParentName(g.projectID, zone)
 	op, err = g.tpuService.projects.Locations.Nodes.Create(parent, node).NodeId(name).Do()
@@ -90,6 +107,9 @@ func (g *Cloud) DeleteTPU(ctx context.Context, name, zone string) error {
 	mc := newTPUMetricContext("delete", zone)
 	defer mc.Observe(err)
 
+	if g.skipMutation("delete", "TPU", meta.ZonalKey(name, zone), nil) {
+		return nil
+	}
 	var op *tpuapi.Operation
 	name = getTPUName(g.projectID, zone, name)
 	op, err = g.tpuService.projects.Locations.Nodes.Delete(name).Do()
@@ -151,18 +171,20 @@ func (g *Cloud) ListLocations(ctx context.Context) ([]*tpuapi.Location, error) {
 	return locations, mc.Observe(nil)
 }
 
-// waitForTPUOp checks whether the op is done every 30 seconds before the ctx
-// is cancelled.
+// waitForTPUOp checks whether the op is done with an exponential backoff,
+// from tpuOperationPollBaseInterval up to tpuOperationPollMaxInterval, until
+// the ctx is cancelled. Once the backoff reaches tpuOperationPollMaxInterval,
+// the op keeps being checked at that interval, however long it takes.
 func (g *Cloud) waitForTPUOp(ctx context.Context, op *tpuapi.Operation) (*tpuapi.Operation, error) {
-	if err := wait.PollInfinite(30*time.Second, func() (bool, error) {
-		// Check if context has been cancelled.
+	interval := tpuOperationPollBaseInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
 		select {
 		case <-ctx.Done():
-			klog.V(3).Infof("Context for operation %q has been cancelled: %s", op.Name, ctx.Err())
-			return true, ctx.Err()
-		default:
+			return nil, fmt.Errorf("failed to wait for operation %q: %w", op.Name, ctx.Err())
+		case <-timer.C:
 		}
-
 		klog.V(3).Infof("Waiting for operation %q to complete...", op.Name)
 
 		start := time.Now()
@@ -172,20 +194,22 @@ func (g *Cloud) waitForTPUOp(ctx context.Context, op *tpuapi.Operation) (*tpuapi
 			klog.V(2).Infof("Getting operation %q throttled for %v", op.Name, duration)
 		}
 
-		var err error
-		op, err = g.tpuService.projects.Locations.Operations.Get(op.Name).Do()
+		got, err := g.tpuService.projects.Locations.Operations.Get(op.Name).Do()
 		if err != nil {
-			return true, err
+			return nil, fmt.Errorf("failed to wait for operation %q: %s", op.Name, err)
 		}
+		op = got
 		if op.Done {
 			klog.V(3).Infof("Operation %q has completed", op.Name)
-			return true, nil
+			return op, nil
+		}
+
+		interval = time.Duration(float64(interval) * operationPollBackoffFactor)
+		if interval > tpuOperationPollMaxInterval {
+			interval = tpuOperationPollMaxInterval
 		}
-		return false, nil
-	}); err != nil {
-		return nil, fmt.Errorf("failed to wait for operation %q: %s", op.Name, err)
+		timer.Reset(interval)
 	}
-	return op, nil
 }
 
 // newTPUMetricContext returns a new metricContext used for recording metrics
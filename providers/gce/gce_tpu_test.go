@@ -0,0 +1,72 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	tpuapi "google.golang.org/api/tpu/v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestWaitForTPUOpLongRunning(t *testing.T) {
+	defer func(base, max time.Duration) {
+		tpuOperationPollBaseInterval, tpuOperationPollMaxInterval = base, max
+	}(tpuOperationPollBaseInterval, tpuOperationPollMaxInterval)
+	tpuOperationPollBaseInterval = time.Millisecond
+	tpuOperationPollMaxInterval = 2 * time.Millisecond
+
+	// The operation runs for far more polls than it takes the backoff to
+	// reach its cap.
+	const pollsUntilDone = 50
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		fmt.Fprintf(w, `{"name": "op", "done": %t}`, polls == pollsUntilDone)
+	}))
+	defer server.Close()
+
+	gce, err := fakeGCECloud(DefaultTestClusterValues())
+	require.NoError(t, err)
+	gce.operationPollRateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	gce.tpuService, err = newTPUService(server.URL+"/", option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	op, err := gce.waitForTPUOp(context.Background(), &tpuapi.Operation{Name: "op"})
+	require.NoError(t, err)
+	assert.True(t, op.Done)
+	assert.Equal(t, pollsUntilDone, polls)
+
+	// The wait ends when the ctx is cancelled.
+	polls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = gce.waitForTPUOp(ctx, &tpuapi.Operation{Name: "op"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, polls)
+}
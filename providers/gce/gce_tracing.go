@@ -0,0 +1,173 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+)
+
+// tracerName is the instrumentation scope of the spans of the provider. The
+// spans are exported by the global tracer provider, a no-op unless tracing is
+// enabled.
+const tracerName = "k8s.io/cloud-provider-gcp/providers/gce"
+
+// startSpan starts a span of the sync, a child of the span of ctx if any,
+// and returns the context of the span and a function ending it with the
+// outcome of the sync.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// syncSpans holds the spans of the load balancers being synced by the names
+// of the resources of the load balancers, to parent the spans of the GCE API
+// calls on them, as the calls are not made with the context of the sync.
+type syncSpans struct {
+	mu    sync.Mutex
+	spans map[string]trace.SpanContext
+}
+
+// traceLoadBalancerSync starts the span of a sync of the load balancer of the
+// Service, which parents the spans of the GCE API calls on the resources of
+// the load balancer until the returned function is called with the outcome of
+// the sync.
+func (g *Cloud) traceLoadBalancerSync(ctx context.Context, operation string, svc *v1.Service) (context.Context, func(error)) {
+	name := g.loadBalancerName(svc)
+	ctx, end := startSpan(ctx, operation,
+		attribute.String("service.namespace", svc.Namespace),
+		attribute.String("service.name", svc.Name),
+		attribute.String("gce.load_balancer", name))
+	s := g.syncSpans
+	sc := trace.SpanContextFromContext(ctx)
+	if s == nil || !sc.IsValid() {
+		return ctx, end
+	}
+	resourceNames := loadBalancerResourceNames(name)
+	s.mu.Lock()
+	if s.spans == nil {
+		s.spans = map[string]trace.SpanContext{}
+	}
+	for _, resourceName := range resourceNames {
+		s.spans[resourceName] = sc
+	}
+	s.mu.Unlock()
+	return ctx, func(err error) {
+		s.mu.Lock()
+		for _, resourceName := range resourceNames {
+			if s.spans[resourceName].Equal(sc) {
+				delete(s.spans, resourceName)
+			}
+		}
+		s.mu.Unlock()
+		end(err)
+	}
+}
+
+// parent returns the span of the load balancer sync owning the resource of
+// the path or URL.
+func (s *syncSpans) parent(resourcePath string) (trace.SpanContext, bool) {
+	name := resourceNameOfPath(resourcePath)
+	if name == "" {
+		return trace.SpanContext{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.spans[name]
+	return sc, ok
+}
+
+// resourceNameOfPath returns the name of the resource of a GCE API path or
+// URL, e.g. "a1234" for ".../regions/us-central1/targetPools/a1234/addInstance",
+// or "" for the paths of collections.
+func resourceNameOfPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		switch part {
+		case "global":
+			if i+2 < len(parts) {
+				return parts[i+2]
+			}
+			return ""
+		case "regions", "zones":
+			if i+3 < len(parts) {
+				return parts[i+3]
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// tracingTransport records a span for each GCE API request, retries
+// included, parented by the span of its context or else by the span of the
+// load balancer sync owning the resource. The operations polled for audited
+// mutations are parented as the mutated resource.
+type tracingTransport struct {
+	base  http.RoundTripper
+	spans *syncSpans
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !trace.SpanContextFromContext(ctx).IsValid() && t.spans != nil {
+		resourceName := req.URL.Path
+		if a, ok := ctx.Value(auditContextKey{}).(*mutationAudit); ok {
+			resourceName = a.resourceURL
+		}
+		if sc, ok := t.spans.parent(resourceName); ok {
+			ctx = trace.ContextWithSpanContext(ctx, sc)
+		}
+	}
+	resource, verb := computeRequestResourceVerb(req)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, fmt.Sprintf("GCE %s.%s", resource, verb),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("url.path", req.URL.Path)))
+	defer span.End()
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
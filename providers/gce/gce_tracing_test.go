@@ -0,0 +1,161 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recordingTracerProvider provides the recordingTracer to all the
+// instrumentation scopes.
+type recordingTracerProvider struct {
+	embedded.TracerProvider
+	tracer *recordingTracer
+}
+
+func (p recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer { return p.tracer }
+
+// recordingTracer records the spans started with it.
+type recordingTracer struct {
+	embedded.Tracer
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent := trace.SpanContextFromContext(ctx)
+	id := byte(len(t.spans) + 1)
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		traceID = trace.TraceID{id}
+	}
+	s := &recordingSpan{name: name, parent: parent, sc: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{id},
+		TraceFlags: trace.FlagsSampled,
+	})}
+	t.spans = append(t.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// span returns the recorded span with the name.
+func (t *recordingTracer) span(name string) *recordingSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+type recordingSpan struct {
+	noop.Span
+	name   string
+	parent trace.SpanContext
+	sc     trace.SpanContext
+	status codes.Code
+}
+
+func (s *recordingSpan) SpanContext() trace.SpanContext         { return s.sc }
+func (s *recordingSpan) SetStatus(code codes.Code, desc string) { s.status = code }
+
+type statusTransport int
+
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: int(t), Status: http.StatusText(int(t)), Body: http.NoBody}, nil
+}
+
+func TestTracingTransport(t *testing.T) {
+	tracer := &recordingTracer{}
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTracerProvider(recordingTracerProvider{tracer: tracer})
+
+	g := &Cloud{syncSpans: &syncSpans{}}
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc", UID: "1234"}}
+	lbName := "a1234"
+	transport := &tracingTransport{base: statusTransport(http.StatusNotFound), spans: g.syncSpans}
+	get := func(ctx context.Context, path string) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://compute.googleapis.com/compute/v1/projects/project"+path, nil)
+		require.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		require.NoError(t, err)
+	}
+
+	ctx, end := g.traceLoadBalancerSync(context.Background(), "EnsureLoadBalancer", svc)
+	sync := tracer.span("EnsureLoadBalancer")
+	require.NotNil(t, sync)
+	// The calls on the resources of the load balancer are parented by the
+	// sync, even without its context.
+	get(context.Background(), "/regions/us-central1/forwardingRules/"+lbName)
+	// The calls with the context of a span are parented by it.
+	get(ctx, "/zones/us-central1-a/instances/node-1")
+	get(context.Background(), "/global/firewalls/other")
+	// The resources are matched by their exact names.
+	get(context.Background(), "/global/backendServices/k8s-"+lbName+"-other")
+	end(nil)
+
+	fwdRule := tracer.span("GCE forwardingRules.get")
+	require.NotNil(t, fwdRule)
+	assert.Equal(t, sync.sc, fwdRule.parent)
+	assert.Equal(t, codes.Error, fwdRule.status)
+	instance := tracer.span("GCE instances.get")
+	require.NotNil(t, instance)
+	assert.Equal(t, sync.sc, instance.parent)
+	firewall := tracer.span("GCE firewalls.get")
+	require.NotNil(t, firewall)
+	assert.False(t, firewall.parent.IsValid(), "unrelated call parented by %v", firewall.parent)
+	backendService := tracer.span("GCE backendServices.get")
+	require.NotNil(t, backendService)
+	assert.False(t, backendService.parent.IsValid(), "unrelated call parented by %v", backendService.parent)
+
+	// The calls made after the sync are not parented by it.
+	_, ok := g.syncSpans.parent("/regions/us-central1/forwardingRules/" + lbName)
+	assert.False(t, ok, "span of the sync not removed")
+}
+
+func TestResourceNameOfPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/compute/v1/projects/project/regions/us-central1/forwardingRules/a1234":               "a1234",
+		"/compute/v1/projects/project/regions/us-central1/targetPools/a1234/addInstance":       "a1234",
+		"https://www.googleapis.com/compute/v1/projects/project/global/firewalls/k8s-fw-a1234": "k8s-fw-a1234",
+		"/compute/v1/projects/project/zones/us-central1-a/instances":                           "",
+		"/compute/v1/projects/project/global/firewalls":                                        "",
+	} {
+		assert.Equal(t, want, resourceNameOfPath(path), path)
+	}
+}
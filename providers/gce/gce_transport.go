@@ -0,0 +1,49 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// With the ComputeHTTP2KeepAlive feature, the HTTP/2 connections to the GCE
+// API are pinged once they have received nothing for computePingInterval,
+// and closed if the answer takes longer than computePingTimeout, so that the
+// connections dropped by a NAT or a proxy are replaced before a call is sent
+// over them.
+const (
+	computePingInterval = 30 * time.Second
+	computePingTimeout  = 15 * time.Second
+)
+
+// keepAliveComputeTransport configures t to send the GCE API requests over
+// HTTP/2 connections kept alive with pings.
+func keepAliveComputeTransport(t *http.Transport) error {
+	h2, err := http2.ConfigureTransports(t)
+	if err != nil {
+		return err
+	}
+	h2.ReadIdleTimeout = computePingInterval
+	h2.PingTimeout = computePingTimeout
+	return nil
+}
@@ -46,8 +46,12 @@ func (g *Cloud) CreateURLMap(urlMap *compute.UrlMap) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("insert", "URL map", meta.GlobalKey(urlMap.Name), urlMap) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "insert", "URL map", meta.GlobalKey(urlMap.Name), urlMap)
 	mc := newURLMapMetricContext("create")
-	return mc.Observe(g.c.UrlMaps().Insert(ctx, meta.GlobalKey(urlMap.Name), urlMap))
+	return mc.Observe(audit(g.c.UrlMaps().Insert(ctx, meta.GlobalKey(urlMap.Name), urlMap)))
 }
 
 // UpdateURLMap applies the given UrlMap as an update
@@ -55,8 +59,12 @@ func (g *Cloud) UpdateURLMap(urlMap *compute.UrlMap) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("update", "URL map", meta.GlobalKey(urlMap.Name), urlMap) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "update", "URL map", meta.GlobalKey(urlMap.Name), urlMap)
 	mc := newURLMapMetricContext("update")
-	return mc.Observe(g.c.UrlMaps().Update(ctx, meta.GlobalKey(urlMap.Name), urlMap))
+	return mc.Observe(audit(g.c.UrlMaps().Update(ctx, meta.GlobalKey(urlMap.Name), urlMap)))
 }
 
 // DeleteURLMap deletes a url map by name.
@@ -64,8 +72,12 @@ func (g *Cloud) DeleteURLMap(name string) error {
 	ctx, cancel := cloud.ContextWithCallTimeout()
 	defer cancel()
 
+	if g.skipMutation("delete", "URL map", meta.GlobalKey(name), nil) {
+		return nil
+	}
+	ctx, audit := g.auditMutation(ctx, "delete", "URL map", meta.GlobalKey(name), nil)
 	mc := newURLMapMetricContext("delete")
-	return mc.Observe(g.c.UrlMaps().Delete(ctx, meta.GlobalKey(name)))
+	return mc.Observe(audit(g.c.UrlMaps().Delete(ctx, meta.GlobalKey(name))))
 }
 
 // ListURLMaps lists all UrlMaps in the project.
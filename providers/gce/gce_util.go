@@ -39,15 +39,19 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes/fake"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	servicehelper "k8s.io/cloud-provider/service/helpers"
 	netutils "k8s.io/utils/net"
 )
 
 const (
+	// NetLBFinalizerV1 key is used to identify external LB services whose resources are managed by service controller.
+	NetLBFinalizerV1 = "gke.networking.io/l4-netlb-v1"
 	// NetLBFinalizerV2 is the finalizer used by newer controllers that manage L4 External LoadBalancer services.
 	NetLBFinalizerV2 = "gke.networking.io/l4-netlb-v2"
 )
@@ -78,6 +82,7 @@ func fakeGCECloud(vals TestClusterValues) (*Cloud, error) {
 	mockGCE.MockInstanceGroups.ListInstancesHook = mock.ListInstancesHook
 
 	mockGCE.MockRegionBackendServices.UpdateHook = mock.UpdateRegionBackendServiceHook
+	mockGCE.MockAlphaRegionBackendServices.UpdateHook = mock.UpdateAlphaRegionBackendServiceHook
 	mockGCE.MockHealthChecks.UpdateHook = mock.UpdateHealthCheckHook
 	mockGCE.MockFirewalls.UpdateHook = mock.UpdateFirewallHook
 	mockGCE.MockFirewalls.PatchHook = mock.UpdateFirewallHook
@@ -189,6 +194,11 @@ func firewallToGcloudArgs(fw *compute.Firewall, projectID string) string {
 	allow := strings.Join(allPorts, ",")
 	sort.Strings(fw.SourceRanges)
 	srcRngs := strings.Join(fw.SourceRanges, ",")
+	if len(fw.TargetServiceAccounts) > 0 {
+		sort.Strings(fw.TargetServiceAccounts)
+		targets := strings.Join(fw.TargetServiceAccounts, ",")
+		return fmt.Sprintf("--description %q --allow %v --source-ranges %v --target-service-accounts %v --project %v", fw.Description, allow, srcRngs, targets, projectID)
+	}
 	sort.Strings(fw.TargetTags)
 	targets := strings.Join(fw.TargetTags, ",")
 	return fmt.Sprintf("--description %q --allow %v --source-ranges %v --target-tags %v --project %v", fw.Description, allow, srcRngs, targets, projectID)
@@ -196,13 +206,15 @@ func firewallToGcloudArgs(fw *compute.Firewall, projectID string) string {
 
 // Take a GCE instance 'hostname' and break it down to something that can be fed
 // to the GCE API client library.  Basically this means reducing 'kubernetes-
-// node-2.c.my-proj.internal' to 'kubernetes-node-2' if necessary.
+// node-2.c.my-proj.internal' to 'kubernetes-node-2' if necessary. Instance
+// names are lowercase, while Windows Server nodes report their hostname in
+// uppercase, e.g. 'KUBERNETES-WIN-1', so the name is lowercased too.
 func canonicalizeInstanceName(name string) string {
 	ix := strings.Index(name, ".")
 	if ix != -1 {
 		name = name[:ix]
 	}
-	return name
+	return strings.ToLower(name)
 }
 
 // Returns the last component of a URL, i.e. anything after the last slash
@@ -416,3 +428,28 @@ func usesL4RBS(service *v1.Service, forwardingRule *compute.ForwardingRule) bool
 
 	return false
 }
+
+// forEachZone calls sync for every zone and its index, with at most
+// maxConcurrentZoneSyncs calls running at a time, and returns the errors of
+// all failed calls.
+func forEachZone(zones []string, sync func(i int, zone string) error) error {
+	errs := make([]error, len(zones))
+	workqueue.ParallelizeUntil(context.TODO(), maxConcurrentZoneSyncs, len(zones), func(i int) {
+		errs[i] = sync(i, zones[i])
+	})
+	return utilerrors.Reduce(utilerrors.NewAggregate(errs))
+}
+
+// instanceBatches splits the instances into batches of at most size
+// instances.
+func instanceBatches(instances []string, size int) [][]string {
+	var batches [][]string
+	for len(instances) > size {
+		batches = append(batches, instances[:size])
+		instances = instances[size:]
+	}
+	if len(instances) > 0 {
+		batches = append(batches, instances)
+	}
+	return batches
+}
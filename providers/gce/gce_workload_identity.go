@@ -0,0 +1,97 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	compute "google.golang.org/api/compute/v1"
+)
+
+const (
+	// workloadIdentityProviderPrefix prefixes the full resource names of the
+	// workload identity pool providers.
+	workloadIdentityProviderPrefix = "//iam.googleapis.com/"
+	// jwtTokenType is the type of the federated tokens, e.g. the projected
+	// Kubernetes service account tokens.
+	jwtTokenType = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+var (
+	// stsTokenURL is the Security Token Service endpoint the federated tokens
+	// are exchanged with, replaced in tests.
+	stsTokenURL = "https://sts.googleapis.com/v1/token"
+	// iamCredentialsURL is the IAM Service Account Credentials endpoint used
+	// to impersonate the service account, replaced in tests.
+	iamCredentialsURL = "https://iamcredentials.googleapis.com/v1/"
+)
+
+// validateWorkloadIdentity checks the workload identity fields of the config.
+func validateWorkloadIdentity(global *ConfigGlobal) error {
+	if global.WorkloadIdentityProvider == "" {
+		if global.WorkloadIdentityTokenFile != "" || global.WorkloadIdentityServiceAccount != "" {
+			return fmt.Errorf("workload-identity-token-file and workload-identity-service-account require workload-identity-provider")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(global.WorkloadIdentityProvider, workloadIdentityProviderPrefix) {
+		return fmt.Errorf("invalid workload-identity-provider %q: must be the full resource name of a workload identity pool provider, starting with %q", global.WorkloadIdentityProvider, workloadIdentityProviderPrefix)
+	}
+	if global.WorkloadIdentityTokenFile == "" {
+		return fmt.Errorf("workload-identity-provider requires workload-identity-token-file")
+	}
+	if global.TokenURL != "" {
+		return fmt.Errorf("workload-identity-provider and token-url cannot both be set")
+	}
+	return nil
+}
+
+// newWorkloadIdentityTokenSource returns a token source exchanging the
+// federated token of the file for GCE credentials with the Security Token
+// Service, trusted by the workload identity pool provider. The file is read
+// at each exchange so that rotated tokens are picked up. The credentials
+// impersonate the service account if not empty. The exchanges are charged to
+// the quota project if not empty.
+func newWorkloadIdentityTokenSource(provider, tokenFile, serviceAccount, quotaProject string) (oauth2.TokenSource, error) {
+	config := map[string]interface{}{
+		"type":               "external_account",
+		"audience":           provider,
+		"subject_token_type": jwtTokenType,
+		"token_url":          stsTokenURL,
+		"credential_source":  map[string]string{"file": tokenFile},
+	}
+	if serviceAccount != "" {
+		config["service_account_impersonation_url"] = fmt.Sprintf("%sprojects/-/serviceAccounts/%s:generateAccessToken", iamCredentialsURL, serviceAccount)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := google.CredentialsFromJSON(withQuotaProject(context.Background(), quotaProject), data, compute.CloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workload identity config: %v", err)
+	}
+	return creds.TokenSource, nil
+}
@@ -0,0 +1,159 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWorkloadIdentityProvider = "//iam.googleapis.com/projects/1234/locations/global/workloadIdentityPools/pool/providers/cluster"
+
+func TestWorkloadIdentityTokenSource(t *testing.T) {
+	var exchanged []string
+	var impersonated string
+	var quotaProjects []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quotaProjects = append(quotaProjects, r.Header.Get("X-Goog-User-Project"))
+		switch r.URL.Path {
+		case "/v1/token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, testWorkloadIdentityProvider, r.Form.Get("audience"))
+			assert.Equal(t, jwtTokenType, r.Form.Get("subject_token_type"))
+			exchanged = append(exchanged, r.Form.Get("subject_token"))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":      "federated-token",
+				"issued_token_type": "urn:ietf:params:oauth:token-type:access_token",
+				"token_type":        "Bearer",
+				"expires_in":        3600,
+			})
+		default:
+			impersonated = r.URL.Path
+			assert.Equal(t, "Bearer federated-token", r.Header.Get("Authorization"))
+			json.NewEncoder(w).Encode(map[string]string{
+				"accessToken": "impersonated-token",
+				"expireTime":  time.Now().Add(time.Hour).Format(time.RFC3339),
+			})
+		}
+	}))
+	defer server.Close()
+	defer func(sts, iam string) { stsTokenURL, iamCredentialsURL = sts, iam }(stsTokenURL, iamCredentialsURL)
+	stsTokenURL = server.URL + "/v1/token"
+	iamCredentialsURL = server.URL + "/v1/"
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("ksa-token"), 0600))
+
+	ts, err := newWorkloadIdentityTokenSource(testWorkloadIdentityProvider, tokenFile, "", "")
+	require.NoError(t, err)
+	token, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "federated-token", token.AccessToken)
+	assert.Equal(t, []string{"ksa-token"}, exchanged)
+	assert.Equal(t, []string{""}, quotaProjects)
+
+	// The exchange and the impersonation are charged to the quota project.
+	quotaProjects = nil
+	ts, err = newWorkloadIdentityTokenSource(testWorkloadIdentityProvider, tokenFile, "ccm@project.iam.gserviceaccount.com", "quota-project")
+	require.NoError(t, err)
+	token, err = ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "impersonated-token", token.AccessToken)
+	assert.Equal(t, "/v1/projects/-/serviceAccounts/ccm@project.iam.gserviceaccount.com:generateAccessToken", impersonated)
+	assert.Equal(t, []string{"quota-project", "quota-project"}, quotaProjects)
+}
+
+func TestValidateWorkloadIdentity(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		global  ConfigGlobal
+		wantErr bool
+	}{
+		{
+			desc: "not configured",
+		},
+		{
+			desc: "provider and token file",
+			global: ConfigGlobal{
+				WorkloadIdentityProvider:       testWorkloadIdentityProvider,
+				WorkloadIdentityTokenFile:      "/var/run/secrets/tokens/gcp",
+				WorkloadIdentityServiceAccount: "ccm@project.iam.gserviceaccount.com",
+			},
+		},
+		{
+			desc:    "token file without provider",
+			global:  ConfigGlobal{WorkloadIdentityTokenFile: "/var/run/secrets/tokens/gcp"},
+			wantErr: true,
+		},
+		{
+			desc:    "provider without token file",
+			global:  ConfigGlobal{WorkloadIdentityProvider: testWorkloadIdentityProvider},
+			wantErr: true,
+		},
+		{
+			desc: "provider not a resource name",
+			global: ConfigGlobal{
+				WorkloadIdentityProvider:  "projects/1234/locations/global/workloadIdentityPools/pool/providers/cluster",
+				WorkloadIdentityTokenFile: "/var/run/secrets/tokens/gcp",
+			},
+			wantErr: true,
+		},
+		{
+			desc: "token url",
+			global: ConfigGlobal{
+				TokenURL:                  "https://example.com/token",
+				WorkloadIdentityProvider:  testWorkloadIdentityProvider,
+				WorkloadIdentityTokenFile: "/var/run/secrets/tokens/gcp",
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateWorkloadIdentity(&tc.global)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("validateWorkloadIdentity() = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateCloudConfigWorkloadIdentity(t *testing.T) {
+	onGCE := metadataOnGCE
+	defer func() { metadataOnGCE = onGCE }()
+	metadataOnGCE = func() bool { return false }
+
+	cloudConfig, err := generateCloudConfig(&ConfigFile{Global: ConfigGlobal{
+		ProjectID:                 "project-id",
+		NetworkName:               "network-name",
+		LocalZone:                 "us-central1-a",
+		WorkloadIdentityProvider:  testWorkloadIdentityProvider,
+		WorkloadIdentityTokenFile: "/var/run/secrets/tokens/gcp",
+	}})
+	require.NoError(t, err)
+	assert.NotNil(t, cloudConfig.TokenSource, "workload identity token source not used off GCE")
+}
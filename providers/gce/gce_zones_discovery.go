@@ -0,0 +1,100 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultZoneDiscoveryPeriod is how often the zones of the region are
+	// rediscovered by default.
+	defaultZoneDiscoveryPeriod = 10 * time.Minute
+
+	managedZonesChangedReason = "ManagedZonesChanged"
+)
+
+// getManagedZones returns the zones managed by the cluster. The slice
+// returned must not be modified.
+func (g *Cloud) getManagedZones() []string {
+	g.managedZonesLock.RLock()
+	defer g.managedZonesLock.RUnlock()
+	return g.managedZones
+}
+
+// runZoneDiscovery rediscovers the zones of the region every
+// zoneDiscoveryPeriod, until stop is closed. It returns right away if the
+// managed zones were configured rather than discovered.
+func (g *Cloud) runZoneDiscovery(stop <-chan struct{}) {
+	if g.zoneDiscoveryPeriod == 0 {
+		return
+	}
+	wait.Until(func() {
+		if err := g.discoverZones(); err != nil {
+			klog.Errorf("Failed to discover the zones of region %s: %v", g.region, err)
+		}
+	}, g.zoneDiscoveryPeriod, stop)
+}
+
+// discoverZones adds the zones of the region which are not managed yet to
+// the managed zones, e.g. after a zone is added to the region, so that the
+// instances, instance groups and disks of their nodes are found. The zones
+// no longer listed are kept, as they may still have instances.
+func (g *Cloud) discoverZones() error {
+	ctx, cancel := cloud.ContextWithCallTimeout()
+	defer cancel()
+	mc := newZonesMetricContext("list", g.region)
+	zones, err := g.c.Zones().List(ctx, filter.None)
+	if mc.Observe(err) != nil {
+		return err
+	}
+
+	g.managedZonesLock.Lock()
+	defer g.managedZonesLock.Unlock()
+	managed := sets.NewString(g.managedZones...)
+	var added []string
+	for _, zone := range zones {
+		if lastComponent(zone.Region) != g.region || managed.Has(zone.Name) {
+			continue
+		}
+		added = append(added, zone.Name)
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	// The slice is replaced rather than appended to, as it may be in use by
+	// the callers of getManagedZones.
+	managedZones := make([]string, 0, len(g.managedZones)+len(added))
+	g.managedZones = append(append(managedZones, g.managedZones...), added...)
+
+	msg := fmt.Sprintf("Managing the zones %s added to region %s", strings.Join(added, ", "), g.region)
+	klog.Info(msg)
+	g.recordCloudAPIEvent(v1.EventTypeNormal, managedZonesChangedReason, msg)
+	return nil
+}
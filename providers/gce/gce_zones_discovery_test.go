@@ -0,0 +1,71 @@
+//go:build !providerless
+// +build !providerless
+
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDiscoverZones(t *testing.T) {
+	vals := DefaultTestClusterValues()
+	gce, err := fakeGCECloud(vals)
+	require.NoError(t, err)
+	recorder := record.NewFakeRecorder(1024)
+	gce.eventRecorder = recorder
+	mockGCE := gce.c.(*cloud.MockGCE)
+	addZone := func(name, region string) {
+		mockGCE.MockZones.Objects[*meta.GlobalKey(name)] = &cloud.MockZonesObj{Obj: &compute.Zone{
+			Name:   name,
+			Region: "https://www.googleapis.com/compute/v1/projects/" + vals.ProjectID + "/regions/" + region,
+		}}
+	}
+	addZone(vals.ZoneName, vals.Region)
+	addZone(vals.SecondaryZoneName, vals.Region)
+	addZone("europe-west1-b", "europe-west1")
+
+	// The zones added to the region are managed.
+	require.NoError(t, gce.discoverZones())
+	assert.Equal(t, []string{vals.ZoneName, vals.SecondaryZoneName}, gce.getManagedZones())
+	assert.Contains(t, <-recorder.Events, managedZonesChangedReason)
+
+	// Nothing changes until another zone is added.
+	require.NoError(t, gce.discoverZones())
+	assert.Equal(t, []string{vals.ZoneName, vals.SecondaryZoneName}, gce.getManagedZones())
+	assert.Empty(t, recorder.Events)
+
+	// The zones no longer listed are kept.
+	delete(mockGCE.MockZones.Objects, *meta.GlobalKey(vals.SecondaryZoneName))
+	require.NoError(t, gce.discoverZones())
+	assert.Equal(t, []string{vals.ZoneName, vals.SecondaryZoneName}, gce.getManagedZones())
+
+	// The managed zones are kept on errors.
+	listErr := errors.New("connection refused")
+	mockGCE.MockZones.ListError = &listErr
+	assert.Error(t, gce.discoverZones())
+	assert.Equal(t, []string{vals.ZoneName, vals.SecondaryZoneName}, gce.getManagedZones())
+}
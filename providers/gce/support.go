@@ -21,6 +21,7 @@ package gce
 
 import (
 	"context"
+	"time"
 
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
 	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
@@ -46,13 +47,28 @@ type gceRateLimiter struct {
 	gce *Cloud
 }
 
-// Accept blocks until the operation can be performed.
+// Accept blocks until the operation can be performed, according to the
+// rate limits set in the cloud config.
 //
 // TODO: the current cloud provider policy doesn't seem to be correct as it
 // only rate limits the polling operations, but not the /submission/ of
 // operations.
 func (l *gceRateLimiter) Accept(ctx context.Context, key *cloud.RateLimitKey) error {
+	if err := l.gce.acceptAPICall(key); err != nil {
+		return err
+	}
+	if limiters := l.gce.getAPIRateLimiters(); limiters != nil {
+		if err := limiters.wait(ctx, key); err != nil {
+			return err
+		}
+	}
 	if key.Operation == "Get" && key.Service == "Operations" {
+		if l.gce.operationPoller != nil {
+			if err := l.gce.operationPoller.wait(ctx); err != nil {
+				return err
+			}
+			return (&cloud.AcceptRateLimiter{Acceptor: l.gce.operationPollRateLimiter}).Accept(ctx, key)
+		}
 		// Wait a minimum amount of time regardless of rate limiter.
 		rl := &cloud.MinimumRateLimiter{
 			// Convert flowcontrol.RateLimiter into cloud.RateLimiter
@@ -63,11 +79,24 @@ func (l *gceRateLimiter) Accept(ctx context.Context, key *cloud.RateLimitKey) er
 		}
 		return rl.Accept(ctx, key)
 	}
+	if startsOperation(key.Operation) && l.gce.operationPoller != nil {
+		return l.gce.operationPoller.start(ctx, time.Now())
+	}
 	return nil
 }
 
-// Observe is a no-op func to satisfy cloud.RateLimiter
-func (*gceRateLimiter) Observe(context.Context, error, *cloud.RateLimitKey) {}
+// Observe suspends the mutating calls to an API service that exceeded its
+// rate limit, and resumes them once a call succeeds. It also releases the
+// operations in flight seen done by a poll or failed to start.
+func (l *gceRateLimiter) Observe(ctx context.Context, err error, key *cloud.RateLimitKey) {
+	l.gce.observeAPICallResult(key, err)
+	if l.gce.operationPoller == nil {
+		return
+	}
+	if key.Operation == "Get" && key.Service == "Operations" || startsOperation(key.Operation) && err != nil {
+		l.gce.operationPoller.done(ctx)
+	}
+}
 
 // CreateGCECloudWithCloud is a helper function to create an instance of Cloud with the
 // given Cloud interface implementation. Typical usage is to use cloud.NewMockGCE to get a
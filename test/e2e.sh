@@ -10,6 +10,11 @@ cd "${REPO_ROOT}"
 
 source "${REPO_ROOT}"/test/boskos.sh
 
+ZONE="${KUBE_GCE_ZONE:-us-central1-b}"
+# E2E_RUN_ID labels the GCE resources created by the e2e tests, for the
+# janitor to delete the ones leaked by this run only.
+E2E_RUN_ID="${E2E_RUN_ID:-$(date +%Y%m%d%H%M%S)-$$}"
+
 build(){
 	bazel build //release:release-tars
 }
@@ -22,6 +27,16 @@ up() {
 
 test(){
 	kubectl get all --all-namespaces
+	(cd "${REPO_ROOT}"/test/e2e && go test -v -timeout 2h ./ -args \
+		--provider=gce \
+		--gce-project="${PROJECT}" \
+		--gce-zone="${ZONE}" \
+		--e2e-run-id="${E2E_RUN_ID}" \
+		--report-dir="${ARTIFACTS}")
+}
+
+janitor(){
+	(cd "${REPO_ROOT}"/test/e2e && go run ./cmd/janitor --project="${PROJECT}" --region="${ZONE%-*}" --run-id="${E2E_RUN_ID}")
 }
 
 dumplogs(){
@@ -41,6 +56,7 @@ cleanup(){
 	fi
         dumplogs || true
 	down
+	janitor || true
 	cleanup_boskos
 	exit "${STATUS}"
 }
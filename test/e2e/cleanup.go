@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package e2e
+
+import (
+	"context"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cloud-provider-gcp/tests/e2e/janitor"
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+// e2eRunID labels the GCE resources created by the tests, so that the janitor
+// deletes the ones leaked by the run. It defaults to the random ID of the run.
+var e2eRunID string
+
+// Once all the tests are done, the GCE resources they leaked are deleted:
+// the ones labeled with the run, and the load balancer resources of the
+// Services of the deleted namespaces of the tests.
+var _ = ginkgo.SynchronizedAfterSuite(func() {}, func(ctx context.Context) {
+	gceCloud, err := GetGCECloud()
+	if err != nil {
+		framework.Logf("Skipping the cleanup of the leaked GCE resources: %v", err)
+		return
+	}
+	cs, err := framework.LoadClientset()
+	if err != nil {
+		framework.Logf("Skipping the cleanup of the leaked GCE resources: %v", err)
+		return
+	}
+	j := &janitor.Janitor{
+		Cloud: gceCloud,
+		RunID: e2eRunID,
+		Leaked: func(serviceName string) bool {
+			namespace, _, _ := strings.Cut(serviceName, "/")
+			_, err := cs.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+			return apierrors.IsNotFound(err)
+		},
+	}
+	if err := j.Clean(ctx); err != nil {
+		framework.Logf("Failed to delete the leaked GCE resources: %v", err)
+	}
+})
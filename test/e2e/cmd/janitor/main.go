@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The janitor command deletes the GCE resources leaked by an e2e run in a
+// project once its cluster is torn down: the resources labeled by the e2e
+// tests with the ID of the run. The load balancer resources of the Services
+// are not labeled, and are left to the cleanup of the e2e tests, which can
+// tell the ones of their deleted namespaces apart from the ones of other
+// clusters of the project.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	gcecloud "k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/cloud-provider-gcp/tests/e2e/janitor"
+	"k8s.io/klog/v2"
+)
+
+func main() {
+	project := flag.String("project", "", "Project of the e2e cluster.")
+	region := flag.String("region", "", "Region of the e2e cluster.")
+	runID := flag.String("run-id", "", "ID of the e2e run whose labeled resources are deleted, as passed to the e2e tests with --e2e-run-id.")
+	dryRun := flag.Bool("dry-run", false, "Only log the leaked resources.")
+	klog.InitFlags(nil)
+	flag.Parse()
+	if *project == "" || *region == "" || *runID == "" {
+		klog.Errorf("--project, --region and --run-id are required")
+		os.Exit(2)
+	}
+
+	gceCloud, err := gcecloud.CreateGCECloud(&gcecloud.CloudConfig{
+		ProjectID:        *project,
+		Region:           *region,
+		AlphaFeatureGate: gcecloud.NewAlphaFeatureGate([]string{}),
+	})
+	if err != nil {
+		klog.Fatalf("Error building GCE provider: %v", err)
+	}
+	j := &janitor.Janitor{
+		Cloud:  gceCloud,
+		RunID:  *runID,
+		DryRun: *dryRun,
+	}
+	if err := j.Clean(context.Background()); err != nil {
+		klog.Fatalf("Failed to delete the leaked resources: %v", err)
+	}
+}
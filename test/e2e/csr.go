@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package e2e
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+// csrApprovalTimeout is how long the kubelet CSRs may stay pending before
+// the approver is deemed to have missed them.
+const csrApprovalTimeout = 5 * time.Minute
+
+var _ = Describe("[cloud-provider-gcp-e2e] CSR approval", func() {
+	f := framework.NewDefaultFramework("csr-approval")
+
+	var cs clientset.Interface
+	BeforeEach(func() {
+		cs = f.ClientSet
+	})
+
+	f.It("should neither deny nor leave pending the kubelet CSRs", func(ctx context.Context) {
+		csrs, err := cs.CertificatesV1().CertificateSigningRequests().List(ctx, metav1.ListOptions{})
+		framework.ExpectNoError(err)
+		for _, csr := range csrs.Items {
+			if csr.Spec.SignerName != certificatesv1.KubeAPIServerClientKubeletSignerName && csr.Spec.SignerName != certificatesv1.KubeletServingSignerName {
+				continue
+			}
+			approved, denied := csrStatus(&csr)
+			if denied {
+				framework.Failf("Kubelet CSR %s of %s was denied", csr.Name, csr.Spec.Username)
+			}
+			if !approved && time.Since(csr.CreationTimestamp.Time) > csrApprovalTimeout {
+				framework.Failf("Kubelet CSR %s of %s is still pending after %v", csr.Name, csr.Spec.Username, csrApprovalTimeout)
+			}
+		}
+	})
+})
+
+// csrStatus returns whether the CSR was approved or denied.
+func csrStatus(csr *certificatesv1.CertificateSigningRequest) (approved, denied bool) {
+	for _, c := range csr.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case certificatesv1.CertificateApproved:
+			approved = true
+		case certificatesv1.CertificateDenied:
+			denied = true
+		}
+	}
+	return approved, denied
+}
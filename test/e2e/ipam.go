@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package e2e
+
+import (
+	"context"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	. "github.com/onsi/ginkgo/v2"
+	"google.golang.org/api/compute/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2enode "k8s.io/kubernetes/test/e2e/framework/node"
+	netutils "k8s.io/utils/net"
+)
+
+var _ = Describe("[cloud-provider-gcp-e2e] Node IPAM", func() {
+	f := framework.NewDefaultFramework("node-ipam")
+
+	var cs clientset.Interface
+	BeforeEach(func() {
+		cs = f.ClientSet
+	})
+
+	f.It("should allocate distinct pod CIDRs to the nodes and program them in GCE", func(ctx context.Context) {
+		nodes, err := e2enode.GetReadySchedulableNodes(ctx, cs)
+		framework.ExpectNoError(err)
+		gceCloud, err := GetGCECloud()
+		framework.ExpectNoError(err)
+
+		By("Checking the pod CIDRs of the nodes")
+		owners := map[string]string{}
+		for _, node := range nodes.Items {
+			if len(node.Spec.PodCIDRs) == 0 {
+				framework.Failf("Node %s has no pod CIDR", node.Name)
+			}
+			for _, cidr := range node.Spec.PodCIDRs {
+				if owner, ok := owners[cidr]; ok {
+					framework.Failf("Pod CIDR %s is allocated to both node %s and node %s", cidr, owner, node.Name)
+				}
+				owners[cidr] = node.Name
+			}
+		}
+
+		By("Checking the pod CIDRs of the nodes are alias IP ranges or routes of their instances")
+		routes, err := gceCloud.Compute().Routes().List(ctx, filter.None)
+		framework.ExpectNoError(err)
+		for _, node := range nodes.Items {
+			instance, err := gceCloud.InstanceByProviderID(node.Spec.ProviderID)
+			framework.ExpectNoError(err, "failed to get the instance of node %s", node.Name)
+			for _, cidr := range node.Spec.PodCIDRs {
+				if netutils.IsIPv6CIDRString(cidr) {
+					// The IPv6 pod CIDRs are ranges of the interfaces of the
+					// nodes, which GCE assigns.
+					continue
+				}
+				if !hasAliasIPRange(instance, cidr) && !hasRoute(routes, instance, cidr) {
+					framework.Failf("Pod CIDR %s of node %s is neither an alias IP range nor a route of its instance", cidr, node.Name)
+				}
+			}
+		}
+	})
+})
+
+// hasAliasIPRange tells whether the CIDR is an alias IP range of an
+// interface of the instance.
+func hasAliasIPRange(instance *compute.Instance, cidr string) bool {
+	for _, nic := range instance.NetworkInterfaces {
+		for _, r := range nic.AliasIpRanges {
+			if r.IpCidrRange == cidr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasRoute tells whether one of the routes sends the CIDR to the instance.
+func hasRoute(routes []*compute.Route, instance *compute.Instance, cidr string) bool {
+	for _, r := range routes {
+		if r.DestRange == cidr && strings.HasSuffix(r.NextHopInstance, "/instances/"+instance.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package janitor deletes the GCE resources leaked by the e2e tests: the
+// ones the tests create themselves, which they label with RunLabel, and the
+// load balancer resources the cloud provider created for the Services of the
+// tests, which name their Service in their description.
+package janitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	gcecloud "k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/klog/v2"
+)
+
+// RunLabel is the label of the GCE resources created by the e2e tests, whose
+// value is the ID of the run.
+const RunLabel = "cloud-provider-gcp-e2e-run"
+
+// RunLabels returns the labels of the GCE resources created by the e2e tests
+// of the run.
+func RunLabels(runID string) map[string]string {
+	return map[string]string{RunLabel: runID}
+}
+
+// Janitor deletes the GCE resources leaked by the e2e tests in the project
+// and region of its cloud.
+type Janitor struct {
+	Cloud *gcecloud.Cloud
+	// RunID is the ID of the run whose labeled resources are deleted. It is
+	// required, so that the resources of concurrent runs sharing the project
+	// are never deleted.
+	RunID string
+	// Leaked tells whether the load balancer resources of the Service,
+	// named as namespace/name, are leaked, e.g. since its namespace was
+	// deleted.
+	Leaked func(serviceName string) bool
+	// DryRun only logs the leaked resources.
+	DryRun bool
+}
+
+// resource is a GCE resource the janitor may delete.
+type resource struct {
+	kind        string
+	key         *meta.Key
+	description string
+	labels      map[string]string
+	delete      func(context.Context, *meta.Key, ...cloud.Option) error
+}
+
+// Clean deletes the leaked resources, the ones referencing the others first,
+// and returns the errors of the lists and deletions.
+func (j *Janitor) Clean(ctx context.Context) error {
+	if j.RunID == "" {
+		return fmt.Errorf("the run ID of the resources to delete is required")
+	}
+	var errs []error
+	// Each group only references the ones after it.
+	for _, list := range []func(context.Context) ([]resource, error){
+		j.forwardingRules,
+		j.lbBackends,
+		j.healthChecks,
+		j.firewallsAndAddresses,
+	} {
+		resources, err := list(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, r := range resources {
+			if !j.leaked(r) {
+				continue
+			}
+			klog.Infof("Deleting leaked %s %s", r.kind, r.key)
+			if j.DryRun {
+				continue
+			}
+			if err := r.delete(ctx, r.key); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete %s %s: %w", r.kind, r.key, err))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// leaked tells whether the resource is labeled with the run, or is a load
+// balancer resource of a leaked Service.
+func (j *Janitor) leaked(r resource) bool {
+	if runID, ok := r.labels[RunLabel]; ok {
+		return runID == j.RunID
+	}
+	var desc struct {
+		ServiceName string `json:"kubernetes.io/service-name"`
+	}
+	if err := json.Unmarshal([]byte(r.description), &desc); err != nil || desc.ServiceName == "" {
+		return false
+	}
+	return j.Leaked != nil && j.Leaked(desc.ServiceName)
+}
+
+func (j *Janitor) forwardingRules(ctx context.Context) ([]resource, error) {
+	c := j.Cloud.Compute()
+	rules, err := c.ForwardingRules().List(ctx, j.Cloud.Region(), filter.None)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forwarding rules: %w", err)
+	}
+	var resources []resource
+	for _, fr := range rules {
+		resources = append(resources, resource{"forwarding rule", meta.RegionalKey(fr.Name, j.Cloud.Region()), fr.Description, fr.Labels, c.ForwardingRules().Delete})
+	}
+	return resources, nil
+}
+
+func (j *Janitor) lbBackends(ctx context.Context) ([]resource, error) {
+	c := j.Cloud.Compute()
+	var resources []resource
+	var errs []error
+	pools, err := c.TargetPools().List(ctx, j.Cloud.Region(), filter.None)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to list target pools: %w", err))
+	}
+	for _, tp := range pools {
+		resources = append(resources, resource{"target pool", meta.RegionalKey(tp.Name, j.Cloud.Region()), tp.Description, nil, c.TargetPools().Delete})
+	}
+	services, err := c.RegionBackendServices().List(ctx, j.Cloud.Region(), filter.None)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to list backend services: %w", err))
+	}
+	for _, bs := range services {
+		resources = append(resources, resource{"backend service", meta.RegionalKey(bs.Name, j.Cloud.Region()), bs.Description, nil, c.RegionBackendServices().Delete})
+	}
+	return resources, utilerrors.NewAggregate(errs)
+}
+
+func (j *Janitor) healthChecks(ctx context.Context) ([]resource, error) {
+	c := j.Cloud.Compute()
+	var resources []resource
+	var errs []error
+	hcs, err := c.HealthChecks().List(ctx, filter.None)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to list health checks: %w", err))
+	}
+	for _, hc := range hcs {
+		resources = append(resources, resource{"health check", meta.GlobalKey(hc.Name), hc.Description, nil, c.HealthChecks().Delete})
+	}
+	httpHCs, err := c.HttpHealthChecks().List(ctx, filter.None)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to list HTTP health checks: %w", err))
+	}
+	for _, hc := range httpHCs {
+		resources = append(resources, resource{"HTTP health check", meta.GlobalKey(hc.Name), hc.Description, nil, c.HttpHealthChecks().Delete})
+	}
+	return resources, utilerrors.NewAggregate(errs)
+}
+
+func (j *Janitor) firewallsAndAddresses(ctx context.Context) ([]resource, error) {
+	c := j.Cloud.Compute()
+	var resources []resource
+	var errs []error
+	firewalls, err := c.Firewalls().List(ctx, filter.None)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to list firewalls: %w", err))
+	}
+	for _, fw := range firewalls {
+		resources = append(resources, resource{"firewall", meta.GlobalKey(fw.Name), fw.Description, nil, c.Firewalls().Delete})
+	}
+	addrs, err := c.Addresses().List(ctx, j.Cloud.Region(), filter.None)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to list addresses: %w", err))
+	}
+	for _, addr := range addrs {
+		resources = append(resources, resource{"address", meta.RegionalKey(addr.Name, j.Cloud.Region()), addr.Description, addr.Labels, c.Addresses().Delete})
+	}
+	return resources, utilerrors.NewAggregate(errs)
+}
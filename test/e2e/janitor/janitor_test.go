@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package janitor
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/filter"
+	"github.com/GoogleCloudPlatform/k8s-cloud-provider/pkg/cloud/meta"
+	"google.golang.org/api/compute/v1"
+	gcecloud "k8s.io/cloud-provider-gcp/providers/gce"
+)
+
+func TestClean(t *testing.T) {
+	ctx := context.Background()
+	vals := gcecloud.DefaultTestClusterValues()
+	g := gcecloud.NewFakeGCECloud(vals)
+	c := g.Compute()
+	region := meta.RegionalKey("", vals.Region)
+	desc := func(svc string) string { return `{"kubernetes.io/service-name":"` + svc + `"}` }
+
+	for _, fr := range []*compute.ForwardingRule{
+		{Name: "leaked-fr", Description: desc("e2e-gone/svc")},
+		{Name: "live-fr", Description: desc("e2e-live/svc")},
+		{Name: "other-fr"},
+	} {
+		region.Name = fr.Name
+		if err := c.ForwardingRules().Insert(ctx, region, fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tp := range []*compute.TargetPool{
+		{Name: "leaked-fr", Description: desc("e2e-gone/svc")},
+		{Name: "live-fr", Description: desc("e2e-live/svc")},
+	} {
+		region.Name = tp.Name
+		if err := c.TargetPools().Insert(ctx, region, tp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Firewalls().Insert(ctx, meta.GlobalKey("k8s-fw-leaked-fr"), &compute.Firewall{Name: "k8s-fw-leaked-fr", Description: desc("e2e-gone/svc")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []*compute.Address{
+		{Name: "run-addr", Labels: RunLabels("run-1")},
+		{Name: "other-run-addr", Labels: RunLabels("run-0")},
+	} {
+		region.Name = addr.Name
+		if err := c.Addresses().Insert(ctx, region, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j := &Janitor{
+		Cloud:  g,
+		RunID:  "run-1",
+		Leaked: func(svc string) bool { return svc == "e2e-gone/svc" },
+	}
+	if err := j.Clean(ctx); err != nil {
+		t.Fatalf("Clean() = %v", err)
+	}
+
+	var remaining []string
+	frs, _ := c.ForwardingRules().List(ctx, vals.Region, filter.None)
+	for _, fr := range frs {
+		remaining = append(remaining, "fr/"+fr.Name)
+	}
+	tps, _ := c.TargetPools().List(ctx, vals.Region, filter.None)
+	for _, tp := range tps {
+		remaining = append(remaining, "tp/"+tp.Name)
+	}
+	fws, _ := c.Firewalls().List(ctx, filter.None)
+	for _, fw := range fws {
+		remaining = append(remaining, "fw/"+fw.Name)
+	}
+	addrs, _ := c.Addresses().List(ctx, vals.Region, filter.None)
+	for _, addr := range addrs {
+		remaining = append(remaining, "addr/"+addr.Name)
+	}
+	sort.Strings(remaining)
+	want := []string{"addr/other-run-addr", "fr/live-fr", "fr/other-fr", "tp/live-fr"}
+	if !reflect.DeepEqual(remaining, want) {
+		t.Errorf("got remaining resources %v, want %v", remaining, want)
+	}
+}
+
+func TestCleanRequiresRunID(t *testing.T) {
+	g := gcecloud.NewFakeGCECloud(gcecloud.DefaultTestClusterValues())
+	j := &Janitor{
+		Cloud:  g,
+		Leaked: func(string) bool { return true },
+	}
+	if err := j.Clean(context.Background()); err == nil {
+		t.Errorf("Clean() without a run ID succeeded")
+	}
+}
@@ -32,6 +32,7 @@ import (
 	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/cloud-provider-gcp/tests/e2e/janitor"
 	"k8s.io/kubernetes/test/e2e/framework"
 	e2epod "k8s.io/kubernetes/test/e2e/framework/pod"
 	e2eservice "k8s.io/kubernetes/test/e2e/framework/service"
@@ -103,7 +104,7 @@ var _ = Describe("[cloud-provider-gcp-e2e] LoadBalancer", func() {
 		gceCloud, err := GetGCECloud()
 		framework.ExpectNoError(err, "failed to get GCE cloud provider")
 
-		err = gceCloud.ReserveRegionAddress(&compute.Address{Name: staticIPName}, gceCloud.Region())
+		err = gceCloud.ReserveRegionAddress(&compute.Address{Name: staticIPName, Labels: janitor.RunLabels(e2eRunID)}, gceCloud.Region())
 		defer func() {
 			if staticIPName != "" {
 				// Release GCE static IP - this is not kube-managed and will not be automatically released.
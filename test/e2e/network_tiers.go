@@ -32,6 +32,7 @@ import (
 	clientset "k8s.io/client-go/kubernetes"
 	cloudprovider "k8s.io/cloud-provider"
 	gcecloud "k8s.io/cloud-provider-gcp/providers/gce"
+	"k8s.io/cloud-provider-gcp/tests/e2e/janitor"
 	"k8s.io/kubernetes/test/e2e/framework"
 	e2ekubectl "k8s.io/kubernetes/test/e2e/framework/kubectl"
 	e2eservice "k8s.io/kubernetes/test/e2e/framework/service"
@@ -220,6 +221,7 @@ func reserveRegionalAddress(cloud *gcecloud.Cloud, name string, netTier cloud.Ne
 	Addr := &compute.Address{
 		Name:        name,
 		NetworkTier: netTier.ToGCEValue(),
+		Labels:      janitor.RunLabels(e2eRunID),
 	}
 
 	if err := cloud.ReserveRegionAddress(Addr, cloud.Region()); err != nil {
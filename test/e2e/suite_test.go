@@ -50,7 +50,11 @@ func init() {
 	frameworkconfig.CopyFlags(frameworkconfig.Flags, flag.CommandLine)
 	framework.RegisterCommonFlags(flag.CommandLine)
 	framework.RegisterClusterFlags(flag.CommandLine)
+	flag.StringVar(&e2eRunID, "e2e-run-id", "", "ID labeling the GCE resources created by the tests, for the janitor to delete the ones leaked by the run. A random one if empty.")
 	flag.Parse()
+	if e2eRunID == "" {
+		e2eRunID = string(framework.RunID)
+	}
 
 	framework.AfterReadingAllFlags(&framework.TestContext)
 }